@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/BurntSushi/toml"
+	astilibav "github.com/asticode/go-astiencoder/libav"
 )
 
 var (
@@ -27,6 +28,50 @@ type ConfigurationExec struct {
 type ConfigurationServer struct {
 	Addr    string `toml:"addr"`
 	PathWeb string `toml:"path_web"`
+	// Endpoints are only mounted when configured
+	Clip      *ConfigurationServerClip      `toml:"clip"`
+	Job       *ConfigurationServerJob       `toml:"job"`
+	Thumbnail *ConfigurationServerThumbnail `toml:"thumbnail"`
+}
+
+type ConfigurationServerClip struct {
+	Inputs    ConfigurationServerInputs `toml:"inputs"`
+	OutputDir string                    `toml:"output_dir"`
+}
+
+type ConfigurationServerInputs struct {
+	Hosts     []string `toml:"hosts"`
+	Protocols []string `toml:"protocols"`
+}
+
+func (c ConfigurationServerInputs) policy() astilibav.HTTPInputPolicy {
+	return astilibav.HTTPInputPolicy{
+		Hosts:     c.Hosts,
+		Protocols: c.Protocols,
+	}
+}
+
+type ConfigurationServerJob struct {
+	Inputs  ConfigurationServerInputs  `toml:"inputs"`
+	Outputs ConfigurationServerOutputs `toml:"outputs"`
+}
+
+type ConfigurationServerOutputs struct {
+	Dir       string   `toml:"dir"`
+	Hosts     []string `toml:"hosts"`
+	Protocols []string `toml:"protocols"`
+}
+
+func (c ConfigurationServerOutputs) policy() astilibav.HTTPOutputPolicy {
+	return astilibav.HTTPOutputPolicy{
+		Dir:       c.Dir,
+		Hosts:     c.Hosts,
+		Protocols: c.Protocols,
+	}
+}
+
+type ConfigurationServerThumbnail struct {
+	Inputs ConfigurationServerInputs `toml:"inputs"`
 }
 
 func newConfiguration() (c Configuration, err error) {
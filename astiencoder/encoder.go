@@ -8,9 +8,11 @@ import (
 )
 
 type encoder struct {
+	bds       map[string]*buildData
 	c         *ConfigurationEncoder
 	eh        *astiencoder.EventHandler
 	m         *sync.Mutex
+	ma        *sync.Mutex
 	w         *astikit.Worker
 	wp        *astiencoder.WorkflowPool
 	wsStarted map[string]bool
@@ -18,9 +20,11 @@ type encoder struct {
 
 func newEncoder(c *ConfigurationEncoder, eh *astiencoder.EventHandler, wp *astiencoder.WorkflowPool, l astikit.StdLogger) (e *encoder) {
 	e = &encoder{
+		bds:       make(map[string]*buildData),
 		c:         c,
 		eh:        eh,
 		m:         &sync.Mutex{},
+		ma:        &sync.Mutex{},
 		w:         astikit.NewWorker(astikit.WorkerOptions{Logger: l}),
 		wp:        wp,
 		wsStarted: make(map[string]bool),
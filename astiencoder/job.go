@@ -1,6 +1,10 @@
 package main
 
-import "github.com/asticode/go-astikit"
+import (
+	"reflect"
+
+	"github.com/asticode/go-astikit"
+)
 
 // Job represents a job
 type Job struct {
@@ -11,9 +15,13 @@ type Job struct {
 
 // JobInput represents a job input
 type JobInput struct {
-	Dict        string `json:"dict"`
-	EmulateRate bool   `json:"emulate_rate"`
-	URL         string `json:"url"`
+	Dict        string            `json:"dict"`
+	Dictionary  map[string]string `json:"dictionary"`
+	EmulateRate bool              `json:"emulate_rate"`
+	FormatName  string            `json:"format_name"`
+	Loop        bool              `json:"loop"`
+	LoopCount   int               `json:"loop_count"`
+	URL         string            `json:"url"`
 }
 
 // Job output types
@@ -69,3 +77,99 @@ type JobOperationOutput struct {
 	Name string `json:"name"`
 	PID  *int   `json:"pid,omitempty"`
 }
+
+// jobDiff represents the names of the inputs, operations and outputs whose nodes must be replaced to transition from
+// a running job to a desired job. Nodes of items that are not listed are reused.
+// Old nodes of listed items are stopped if they exist, and new nodes are built if the item is still part of the
+// desired job
+type jobDiff struct {
+	Inputs     map[string]bool `json:"inputs"`
+	Operations map[string]bool `json:"operations"`
+	Outputs    map[string]bool `json:"outputs"`
+}
+
+func newJobDiff(old, new Job) (d jobDiff) {
+	// Create diff
+	d = jobDiff{
+		Inputs:     make(map[string]bool),
+		Operations: make(map[string]bool),
+		Outputs:    make(map[string]bool),
+	}
+
+	// Loop through inputs
+	for n := range old.Inputs {
+		if v, ok := new.Inputs[n]; !ok || !reflect.DeepEqual(v, old.Inputs[n]) {
+			d.Inputs[n] = true
+		}
+	}
+	for n := range new.Inputs {
+		if _, ok := old.Inputs[n]; !ok {
+			d.Inputs[n] = true
+		}
+	}
+
+	// Loop through outputs
+	for n := range old.Outputs {
+		if v, ok := new.Outputs[n]; !ok || !reflect.DeepEqual(v, old.Outputs[n]) {
+			d.Outputs[n] = true
+		}
+	}
+	for n := range new.Outputs {
+		if _, ok := old.Outputs[n]; !ok {
+			d.Outputs[n] = true
+		}
+	}
+
+	// Loop through operations
+	for n := range old.Operations {
+		if v, ok := new.Operations[n]; !ok || !reflect.DeepEqual(v, old.Operations[n]) {
+			d.Operations[n] = true
+		}
+	}
+	for n := range new.Operations {
+		if _, ok := old.Operations[n]; !ok {
+			d.Operations[n] = true
+		}
+	}
+
+	// An operation must be replaced when one of its inputs or outputs is replaced, and since streams can't be added
+	// to a muxer once its header has been written, an output must be replaced when one of the operations writing to
+	// it is replaced. Loop until nothing changes anymore.
+	for changed := true; changed; {
+		changed = false
+		for _, j := range []Job{old, new} {
+			for n, o := range j.Operations {
+				// Operation is not replaced yet
+				if !d.Operations[n] {
+					for _, i := range o.Inputs {
+						if d.Inputs[i.Name] {
+							d.Operations[n] = true
+						}
+					}
+					for _, op := range o.Outputs {
+						if d.Outputs[op.Name] {
+							d.Operations[n] = true
+						}
+					}
+					if !d.Operations[n] {
+						continue
+					}
+				}
+
+				// Replace outputs
+				for _, op := range o.Outputs {
+					if !d.Outputs[op.Name] {
+						d.Outputs[op.Name] = true
+						changed = true
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+// empty returns whether the diff is empty
+func (d jobDiff) empty() bool {
+	return len(d.Inputs) == 0 && len(d.Operations) == 0 && len(d.Outputs) == 0
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewJobDiff(t *testing.T) {
+	old := Job{
+		Inputs: map[string]JobInput{
+			"i1": {URL: "i1"},
+			"i2": {URL: "i2"},
+		},
+		Operations: map[string]JobOperation{
+			"copy": {
+				Codec:   JobOperationCodecCopy,
+				Inputs:  []JobOperationInput{{Name: "i1"}},
+				Outputs: []JobOperationOutput{{Name: "o1"}},
+			},
+			"encode1": {
+				Codec:   "libx264",
+				Inputs:  []JobOperationInput{{Name: "i2"}},
+				Outputs: []JobOperationOutput{{Name: "o2"}, {Name: "o3"}},
+			},
+			"encode2": {
+				Codec:   "aac",
+				Inputs:  []JobOperationInput{{Name: "i2"}},
+				Outputs: []JobOperationOutput{{Name: "o3"}},
+			},
+		},
+		Outputs: map[string]JobOutput{
+			"o1": {URL: "o1"},
+			"o2": {URL: "o2"},
+			"o3": {URL: "o3"},
+		},
+	}
+
+	// Nothing changes
+	d := newJobDiff(old, old)
+	if !d.empty() {
+		t.Errorf("expected empty diff, got %+v", d)
+	}
+
+	// An operation changes
+	new := Job{Inputs: old.Inputs, Operations: make(map[string]JobOperation), Outputs: old.Outputs}
+	for k, v := range old.Operations {
+		new.Operations[k] = v
+	}
+	o := new.Operations["encode2"]
+	o.Codec = "opus"
+	new.Operations["encode2"] = o
+	d = newJobDiff(old, new)
+	if e := (jobDiff{
+		Inputs:     map[string]bool{},
+		Operations: map[string]bool{"encode1": true, "encode2": true},
+		Outputs:    map[string]bool{"o2": true, "o3": true},
+	}); !reflect.DeepEqual(e, d) {
+		t.Errorf("expected %+v, got %+v", e, d)
+	}
+
+	// An input is removed and an output is added
+	new = Job{
+		Inputs:     map[string]JobInput{"i2": {URL: "i2"}},
+		Operations: map[string]JobOperation{"encode1": old.Operations["encode1"], "encode2": old.Operations["encode2"]},
+		Outputs:    map[string]JobOutput{"o2": {URL: "o2"}, "o3": {URL: "o3"}, "o4": {URL: "o4"}},
+	}
+	d = newJobDiff(old, new)
+	if e := (jobDiff{
+		Inputs:     map[string]bool{"i1": true},
+		Operations: map[string]bool{"copy": true},
+		Outputs:    map[string]bool{"o1": true, "o4": true},
+	}); !reflect.DeepEqual(e, d) {
+		t.Errorf("expected %+v, got %+v", e, d)
+	}
+}
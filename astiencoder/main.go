@@ -15,7 +15,8 @@ import (
 
 // Flags
 var (
-	job = flag.String("j", "", "the path to the job in JSON format")
+	input = flag.String("i", "", "the url of the input to probe")
+	job   = flag.String("j", "", "the path to the job in JSON format")
 )
 
 func main() {
@@ -29,6 +30,24 @@ func main() {
 	// Version
 	if cmd == "version" {
 		fmt.Print(astilibav.Version)
+		fmt.Print(astilibav.DetectCapabilities())
+		return
+	}
+
+	// Probe
+	if cmd == "probe" {
+		// Probe
+		r, err := astilibav.Probe(*input, astilibav.ProbeOptions{})
+		if err != nil {
+			l.Fatal(fmt.Errorf("main: probing %s failed: %w", *input, err))
+		}
+
+		// Print
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		if err = e.Encode(r); err != nil {
+			l.Fatal(fmt.Errorf("main: encoding probe result failed: %w", err))
+		}
 		return
 	}
 
@@ -55,9 +74,32 @@ func main() {
 
 	// Serve workflow pool
 	if err = wp.Serve(eh, c.Encoder.Server.PathWeb, l, func(h http.Handler) {
+		// Add job endpoint
+		m := http.NewServeMux()
+		if c.Encoder.Server.Job != nil {
+			m.Handle("/api/job", applyJobHandler(e, c.Encoder.Server.Job.Inputs.policy(), c.Encoder.Server.Job.Outputs.policy(), l))
+		}
+
+		// Add clip endpoint
+		if c.Encoder.Server.Clip != nil {
+			m.Handle("/api/clip", astilibav.ClipHandler(astilibav.ClipHandlerOptions{
+				Inputs:    c.Encoder.Server.Clip.Inputs.policy(),
+				OutputDir: c.Encoder.Server.Clip.OutputDir,
+			}, l))
+		}
+
+		// Add thumbnail endpoint
+		if c.Encoder.Server.Thumbnail != nil {
+			m.Handle("/api/thumbnail", astilibav.ThumbnailHandler(astilibav.ThumbnailHandlerOptions{
+				Inputs: c.Encoder.Server.Thumbnail.Inputs.policy(),
+			}, l))
+		}
+		m.Handle("/", h)
+
+		// Serve
 		astikit.ServeHTTP(e.w, astikit.ServeHTTPOptions{
 			Addr:    c.Encoder.Server.Addr,
-			Handler: h,
+			Handler: m,
 		})
 	}); err != nil {
 		l.Fatal(fmt.Errorf("main: serving workflow pool failed: %w", err))
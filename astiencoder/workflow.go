@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/asticode/go-astiencoder"
 	astilibav "github.com/asticode/go-astiencoder/libav"
@@ -13,6 +18,9 @@ import (
 	"github.com/asticode/goav/avutil"
 )
 
+// Replaced muxers are given this long to write their trailer
+const muxerFinishTimeout = 10 * time.Second
+
 func addWorkflow(name string, j Job, e *encoder) (w *astiencoder.Workflow, err error) {
 	// Create closer
 	c := astikit.NewCloser()
@@ -22,16 +30,172 @@ func addWorkflow(name string, j Job, e *encoder) (w *astiencoder.Workflow, err e
 
 	// Build workflow
 	b := newBuilder()
-	if err = b.buildWorkflow(j, w, e.eh, c); err != nil {
+	bd := newBuildData(w, e.eh, c)
+	if err = b.buildWorkflow(j, bd); err != nil {
 		err = fmt.Errorf("main: building workflow failed: %w", err)
 		return
 	}
 
+	// Store build data
+	e.m.Lock()
+	e.bds[name] = bd
+	e.m.Unlock()
+
 	// Add workflow to pool
 	e.wp.AddWorkflow(w)
 	return
 }
 
+// applyWorkflow transitions the workflow to the desired job with minimal disruption
+// Nodes of the inputs, operations and outputs that haven't changed are reused, whereas nodes that have changed are
+// stopped and replaced by new ones. Since new encoders start with a keyframe, and since new outputs of copy
+// operations drop pkts until the first keyframe, replaced outputs start at a keyframe boundary.
+// Replaced outputs are finished before being opened again so that their trailer is written. If something fails, the
+// previous job is built again, without the outputs that have been finished, so that the build data still matches
+// the job it contains.
+// If the workflow doesn't exist, it's added and started.
+func applyWorkflow(name string, j Job, e *encoder) (d jobDiff, err error) {
+	// Make sure concurrent applies don't add the same workflow twice
+	e.ma.Lock()
+	defer e.ma.Unlock()
+
+	// Get build data
+	e.m.Lock()
+	bd, ok := e.bds[name]
+	e.m.Unlock()
+
+	// Workflow doesn't exist or is stopped
+	if !ok || bd.w.Status() == astiencoder.StatusStopped {
+		// Add workflow
+		var w *astiencoder.Workflow
+		if w, err = addWorkflow(name, j, e); err != nil {
+			err = fmt.Errorf("main: adding workflow %s failed: %w", name, err)
+			return
+		}
+
+		// Start workflow
+		w.Start()
+		d = newJobDiff(Job{}, j)
+		return
+	}
+
+	// Lock
+	bd.m.Lock()
+	defer bd.m.Unlock()
+
+	// Get diff
+	if d = newJobDiff(bd.j, j); d.empty() {
+		return
+	}
+
+	// Make sure new nodes are started
+	b := newBuilder()
+	defer func() {
+		if bd.w.Status() == astiencoder.StatusRunning {
+			b.startNewNodes(bd.w, bd.w.Children())
+		}
+	}()
+
+	// Stop replaced nodes
+	if err = b.stopReplacedNodes(d, bd); err != nil {
+		err = fmt.Errorf("main: stopping replaced nodes failed: %w", err)
+		b.rollback(d, bd)
+		return
+	}
+
+	// Build workflow
+	if err = b.buildWorkflow(j, bd); err != nil {
+		err = fmt.Errorf("main: building workflow failed: %w", err)
+		b.rollback(d, bd)
+		return
+	}
+	return
+}
+
+// applyJobHandler applies the job provided in the body to the workflow whose name is provided in the query, and
+// writes the diff that has been applied
+func applyJobHandler(e *encoder, ip astilibav.HTTPInputPolicy, op astilibav.HTTPOutputPolicy, l astikit.StdLogger) http.Handler {
+	sl := astikit.AdaptStdLogger(l)
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		// Set content type
+		rw.Header().Set("Content-Type", "application/json")
+
+		// Check method
+		if r.Method != http.MethodPut {
+			astiencoder.WriteJSONError(sl, rw, http.StatusMethodNotAllowed, fmt.Errorf("main: invalid method %s", r.Method))
+			return
+		}
+
+		// Get name
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			astiencoder.WriteJSONError(sl, rw, http.StatusBadRequest, errors.New("main: no name provided"))
+			return
+		}
+
+		// Unmarshal
+		var j Job
+		if err := json.NewDecoder(r.Body).Decode(&j); err != nil {
+			astiencoder.WriteJSONError(sl, rw, http.StatusBadRequest, fmt.Errorf("main: unmarshaling job failed: %w", err))
+			return
+		}
+
+		// Check job
+		if err := checkJob(&j, ip, op); err != nil {
+			astiencoder.WriteJSONError(sl, rw, http.StatusForbidden, fmt.Errorf("main: checking job failed: %w", err))
+			return
+		}
+
+		// Apply
+		d, err := applyWorkflow(name, j, e)
+		if err != nil {
+			astiencoder.WriteJSONError(sl, rw, http.StatusInternalServerError, fmt.Errorf("main: applying job to workflow %s failed: %w", name, err))
+			return
+		}
+
+		// Write
+		if err = json.NewEncoder(rw).Encode(d); err != nil {
+			sl.Error(fmt.Errorf("main: json encoding failed: %w", err))
+			return
+		}
+	})
+}
+
+// checkJob makes sure the job only reads and writes what the policies allow, and rewrites file outputs
+// so that they're written in the output dir
+func checkJob(j *Job, ip astilibav.HTTPInputPolicy, op astilibav.HTTPOutputPolicy) (err error) {
+	// Loop through inputs
+	for n, i := range j.Inputs {
+		// Check url
+		if err = ip.Check(i.URL); err != nil {
+			err = fmt.Errorf("main: checking input %s failed: %w", n, err)
+			return
+		}
+
+		// Restrict protocols of nested inputs. Policy entries override the ones provided in the job.
+		d := make(map[string]string)
+		for k, v := range i.Dictionary {
+			d[k] = v
+		}
+		for k, v := range ip.Dictionary() {
+			d[k] = v
+		}
+		i.Dictionary = d
+		j.Inputs[n] = i
+	}
+
+	// Loop through outputs
+	for n, o := range j.Outputs {
+		// Check url
+		if o.URL, err = op.Check(o.URL); err != nil {
+			err = fmt.Errorf("main: checking output %s failed: %w", n, err)
+			return
+		}
+		j.Outputs[n] = o
+	}
+	return
+}
+
 type builder struct{}
 
 func newBuilder() *builder {
@@ -39,37 +203,62 @@ func newBuilder() *builder {
 }
 
 type openedInput struct {
-	c JobInput
-	d *astilibav.Demuxer
+	c  JobInput
+	cl *astikit.Closer
+	d  *astilibav.Demuxer
 }
 
 type openedOutput struct {
-	c JobOutput
-	m *astilibav.Muxer
+	c  JobOutput
+	cl *astikit.Closer
+	m  *astilibav.Muxer
+}
+
+// builtOperation keeps track of the nodes of an operation so that they can be replaced
+type builtOperation struct {
+	disconnects []func()
+	nodes       []astiencoder.Node
+}
+
+func (o *builtOperation) stop() {
+	// Disconnect upstream nodes first so that nothing comes in anymore
+	for _, fn := range o.disconnects {
+		fn()
+	}
+
+	// Stop nodes
+	for _, n := range o.nodes {
+		n.Stop()
+	}
 }
 
 type buildData struct {
-	c        *astikit.Closer
-	decoders map[*astilibav.Demuxer]map[*avformat.Stream]*astilibav.Decoder
-	eh       *astiencoder.EventHandler
-	inputs   map[string]openedInput
-	outputs  map[string]openedOutput
-	w        *astiencoder.Workflow
+	c          *astikit.Closer
+	decoders   map[*astilibav.Demuxer]map[*avformat.Stream]*astilibav.Decoder
+	eh         *astiencoder.EventHandler
+	inputs     map[string]openedInput
+	j          Job
+	m          *sync.Mutex
+	operations map[string]*builtOperation
+	outputs    map[string]openedOutput
+	w          *astiencoder.Workflow
 }
 
 func newBuildData(w *astiencoder.Workflow, eh *astiencoder.EventHandler, c *astikit.Closer) *buildData {
 	return &buildData{
-		c:        c,
-		eh:       eh,
-		decoders: make(map[*astilibav.Demuxer]map[*avformat.Stream]*astilibav.Decoder),
-		w:        w,
+		c:          c,
+		eh:         eh,
+		decoders:   make(map[*astilibav.Demuxer]map[*avformat.Stream]*astilibav.Decoder),
+		inputs:     make(map[string]openedInput),
+		m:          &sync.Mutex{},
+		operations: make(map[string]*builtOperation),
+		outputs:    make(map[string]openedOutput),
+		w:          w,
 	}
 }
 
-func (b *builder) buildWorkflow(j Job, w *astiencoder.Workflow, eh *astiencoder.EventHandler, c *astikit.Closer) (err error) {
-	// Create build data
-	bd := newBuildData(w, eh, c)
-
+// buildWorkflow only builds what is not part of the build data yet
+func (b *builder) buildWorkflow(j Job, bd *buildData) (err error) {
 	// No inputs
 	if len(j.Inputs) == 0 {
 		err = errors.New("main: no inputs provided")
@@ -77,7 +266,7 @@ func (b *builder) buildWorkflow(j Job, w *astiencoder.Workflow, eh *astiencoder.
 	}
 
 	// Open inputs
-	if bd.inputs, err = b.openInputs(j, bd); err != nil {
+	if err = b.openInputs(j, bd); err != nil {
 		err = fmt.Errorf("main: opening inputs failed: %w", err)
 		return
 	}
@@ -89,7 +278,7 @@ func (b *builder) buildWorkflow(j Job, w *astiencoder.Workflow, eh *astiencoder.
 	}
 
 	// Open outputs
-	if bd.outputs, err = b.openOutputs(j, bd); err != nil {
+	if err = b.openOutputs(j, bd); err != nil {
 		err = fmt.Errorf("main: opening outputs failed: %w", err)
 		return
 	}
@@ -102,43 +291,213 @@ func (b *builder) buildWorkflow(j Job, w *astiencoder.Workflow, eh *astiencoder.
 
 	// Loop through operations
 	for n, o := range j.Operations {
+		// Operation has already been built
+		if _, ok := bd.operations[n]; ok {
+			continue
+		}
+
 		// Add operation to workflow
 		if err = b.addOperationToWorkflow(n, o, bd); err != nil {
 			err = fmt.Errorf("main: adding operation %s with conf %+v to workflow failed: %w", n, o, err)
 			return
 		}
 	}
+
+	// Store job
+	bd.j = j
+	return
+}
+
+func (b *builder) stopReplacedNodes(d jobDiff, bd *buildData) (err error) {
+	// Loop through replaced operations
+	for n := range d.Operations {
+		if o, ok := bd.operations[n]; ok {
+			o.stop()
+			delete(bd.operations, n)
+		}
+	}
+
+	// Loop through replaced outputs
+	for n := range d.Outputs {
+		if o, ok := bd.outputs[n]; ok {
+			// Finish muxer so that its trailer is written and its output is closed before being opened again
+			if o.m != nil {
+				if errFinish := b.finishMuxer(o.m); errFinish != nil && err == nil {
+					err = fmt.Errorf("main: finishing output %s failed: %w", n, errFinish)
+				}
+				b.closeWhenStopped(o.m, o.cl, bd)
+			}
+			delete(bd.outputs, n)
+		}
+	}
+
+	// Loop through replaced inputs
+	for n := range d.Inputs {
+		if i, ok := bd.inputs[n]; ok {
+			bd.w.DelChild(i.d)
+			i.d.Stop()
+			for _, dc := range bd.decoders[i.d] {
+				dc.Stop()
+			}
+			b.closeWhenStopped(i.d, i.cl, bd)
+			delete(bd.decoders, i.d)
+			delete(bd.inputs, n)
+		}
+	}
+
+	// Stop decoders that are not used anymore
+	for dm, ds := range bd.decoders {
+		for s, dc := range ds {
+			if len(dc.Children()) == 0 {
+				dm.DisconnectForStream(dc, s)
+				dc.Stop()
+				delete(ds, s)
+			}
+		}
+	}
 	return
 }
 
-func (b *builder) openInputs(j Job, bd *buildData) (is map[string]openedInput, err error) {
+func (b *builder) finishMuxer(m *astilibav.Muxer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), muxerFinishTimeout)
+	defer cancel()
+	return m.Finish(ctx)
+}
+
+// closeWhenStopped closes the closer of a replaced node once it's stopped, instead of when the workflow is closed
+func (b *builder) closeWhenStopped(n astiencoder.Node, c *astikit.Closer, bd *buildData) {
+	// Make sure the closer is closed only once
+	o := &sync.Once{}
+	fn := func() {
+		o.Do(func() {
+			if err := c.Close(); err != nil {
+				bd.eh.Emit(astiencoder.EventError(n, fmt.Errorf("main: closing failed: %w", err)))
+			}
+		})
+	}
+
+	// The listener is added before checking the status so that the stopped event can't be missed
+	bd.eh.Add(n, astiencoder.EventNameNodeStopped, func(astiencoder.Event) bool {
+		fn()
+		return true
+	})
+	if n.Status() == astiencoder.StatusStopped {
+		fn()
+	}
+}
+
+// rollback removes what has been built for the new job and builds the previous job again, which replaces the nodes
+// that have been stopped. Replaced outputs have been finished already and opening them again would overwrite them,
+// therefore they're removed from the previous job, as well as the operations writing to them.
+func (b *builder) rollback(d jobDiff, bd *buildData) {
+	// Remove what has been built
+	if err := b.stopReplacedNodes(d, bd); err != nil {
+		bd.eh.Emit(astiencoder.EventError(bd.w, fmt.Errorf("main: stopping new nodes failed: %w", err)))
+	}
+
+	// Get previous job without replaced outputs
+	j := Job{
+		Inputs:     make(map[string]JobInput),
+		Operations: make(map[string]JobOperation),
+		Outputs:    make(map[string]JobOutput),
+	}
+	for n, o := range bd.j.Outputs {
+		if !d.Outputs[n] {
+			j.Outputs[n] = o
+		}
+	}
+	for n, o := range bd.j.Operations {
+		replaced := false
+		for _, op := range o.Outputs {
+			if d.Outputs[op.Name] {
+				replaced = true
+			}
+		}
+		if replaced {
+			continue
+		}
+		j.Operations[n] = o
+		for _, i := range o.Inputs {
+			if v, ok := bd.j.Inputs[i.Name]; ok {
+				j.Inputs[i.Name] = v
+			}
+		}
+	}
+
+	// Keep inputs that are still opened
+	for n, i := range bd.j.Inputs {
+		if _, ok := bd.inputs[n]; ok {
+			j.Inputs[n] = i
+		}
+	}
+
+	// Nothing to build
+	bd.j = j
+	if len(j.Operations) == 0 {
+		return
+	}
+
+	// Build previous job
+	if err := b.buildWorkflow(j, bd); err != nil {
+		bd.eh.Emit(astiencoder.EventError(bd.w, fmt.Errorf("main: building previous job failed: %w", err)))
+	}
+}
+
+func (b *builder) startNewNodes(w *astiencoder.Workflow, ns []astiencoder.Node) {
+	for _, n := range ns {
+		// Node has never been started. Start is a no-op for nodes that have been started already.
+		if n.Status() == astiencoder.StatusStopped {
+			w.StartNodes(n)
+		}
+
+		// Loop through children
+		b.startNewNodes(w, n.Children())
+	}
+}
+
+func (b *builder) openInputs(j Job, bd *buildData) (err error) {
 	// Loop through inputs
-	is = make(map[string]openedInput)
 	for n, cfg := range j.Inputs {
+		// Input has already been opened
+		if _, ok := bd.inputs[n]; ok {
+			continue
+		}
+
 		// Create demuxer
+		// It has its own closer so that it can be closed when it's replaced
+		cl := bd.c.NewChild()
 		var d *astilibav.Demuxer
 		if d, err = astilibav.NewDemuxer(astilibav.DemuxerOptions{
 			Dict:        cfg.Dict,
+			Dictionary:  cfg.Dictionary,
 			EmulateRate: cfg.EmulateRate,
+			FormatName:  cfg.FormatName,
+			Loop:        cfg.Loop,
+			LoopCount:   cfg.LoopCount,
 			URL:         cfg.URL,
-		}, bd.eh, bd.c); err != nil {
+		}, bd.eh, cl); err != nil {
 			err = fmt.Errorf("main: creating demuxer failed: %w", err)
 			return
 		}
 
 		// Index
-		is[n] = openedInput{
-			c: cfg,
-			d: d,
+		bd.inputs[n] = openedInput{
+			c:  cfg,
+			cl: cl,
+			d:  d,
 		}
 	}
 	return
 }
 
-func (b *builder) openOutputs(j Job, bd *buildData) (os map[string]openedOutput, err error) {
+func (b *builder) openOutputs(j Job, bd *buildData) (err error) {
 	// Loop through outputs
-	os = make(map[string]openedOutput)
 	for n, cfg := range j.Outputs {
+		// Output has already been opened
+		if _, ok := bd.outputs[n]; ok {
+			continue
+		}
+
 		// Create output
 		oo := openedOutput{
 			c: cfg,
@@ -151,14 +510,16 @@ func (b *builder) openOutputs(j Job, bd *buildData) (os map[string]openedOutput,
 			// The writer is created afterwards
 		default:
 			// Create muxer
-			if oo.m, err = astilibav.NewMuxer(astilibav.MuxerOptions{URL: cfg.URL}, bd.eh, bd.c); err != nil {
+			// It has its own closer so that it can be closed when it's replaced
+			oo.cl = bd.c.NewChild()
+			if oo.m, err = astilibav.NewMuxer(astilibav.MuxerOptions{URL: cfg.URL}, bd.eh, oo.cl); err != nil {
 				err = fmt.Errorf("main: creating muxer failed: %w", err)
 				return
 			}
 		}
 
 		// Index
-		os[n] = oo
+		bd.outputs[n] = oo
 	}
 	return
 }
@@ -182,6 +543,9 @@ func (b *builder) addOperationToWorkflow(name string, o JobOperation, bd *buildD
 		return
 	}
 
+	// Keep track of nodes
+	bo := &builtOperation{}
+
 	// Loop through inputs
 	for _, i := range ois {
 		// Loop through streams
@@ -211,10 +575,18 @@ func (b *builder) addOperationToWorkflow(name string, o JobOperation, bd *buildD
 					}
 
 					// Create muxer handler
-					h := o.o.m.NewPktHandler(os)
+					var h astilibav.PktHandler = o.o.m.NewPktHandler(os)
+
+					// Workflow is running and the output must start at a keyframe boundary
+					if bd.w.Status() == astiencoder.StatusRunning {
+						h = newKeyframeGate(h)
+					}
 
 					// Connect demuxer to handler
 					i.o.d.ConnectForStream(h, is)
+					bo.disconnects = append(bo.disconnects, func(d *astilibav.Demuxer, is *avformat.Stream) func() {
+						return func() { d.DisconnectForStream(h, is) }
+					}(i.o.d, is))
 				}
 				continue
 			}
@@ -250,9 +622,13 @@ func (b *builder) addOperationToWorkflow(name string, o JobOperation, bd *buildD
 			if f != nil {
 				d.Connect(f)
 				f.Connect(e)
+				bo.disconnects = append(bo.disconnects, func() { d.Disconnect(f) })
+				bo.nodes = append(bo.nodes, f)
 			} else {
 				d.Connect(e)
+				bo.disconnects = append(bo.disconnects, func() { d.Disconnect(e) })
 			}
+			bo.nodes = append(bo.nodes, e)
 
 			// Loop through outputs
 			for _, o := range oos {
@@ -269,6 +645,7 @@ func (b *builder) addOperationToWorkflow(name string, o JobOperation, bd *buildD
 						err = fmt.Errorf("main: creating pkt dumper for output %s with conf %+v failed: %w", o.c.Name, o.c, err)
 						return
 					}
+					bo.nodes = append(bo.nodes, h)
 				default:
 					// Add stream
 					var os *avformat.Stream
@@ -286,6 +663,9 @@ func (b *builder) addOperationToWorkflow(name string, o JobOperation, bd *buildD
 			}
 		}
 	}
+
+	// Index operation
+	bd.operations[name] = bo
 	return
 }
 
@@ -463,3 +843,31 @@ func (b *builder) createFilterer(bd *buildData, inCtx, outCtx astilibav.Context,
 	}
 	return
 }
+
+// keyframeGate drops pkts until the first keyframe so that outputs created while the workflow is running start at a
+// keyframe boundary
+type keyframeGate struct {
+	astilibav.PktHandler
+	open bool
+}
+
+func newKeyframeGate(h astilibav.PktHandler) *keyframeGate {
+	return &keyframeGate{PktHandler: h}
+}
+
+// HandlePkt implements the PktHandler interface
+func (g *keyframeGate) HandlePkt(p *astilibav.PktHandlerPayload) {
+	// Gate is closed
+	if !g.open {
+		// Pkt is not a keyframe
+		if p.Pkt.Flags()&avcodec.AV_PKT_FLAG_KEY == 0 {
+			return
+		}
+
+		// Open gate
+		g.open = true
+	}
+
+	// Handle pkt
+	g.PktHandler.HandlePkt(p)
+}
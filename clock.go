@@ -0,0 +1,83 @@
+package astiencoder
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock represents a time reference that can be shared by the nodes of a workflow so that they don't each rely on
+// their own
+type Clock interface {
+	// Now returns the current position of the clock
+	Now() time.Duration
+}
+
+// ClockUpdater represents a clock whose position is updated by the units flowing through the workflow
+type ClockUpdater interface {
+	Clock
+	Update(position time.Duration)
+}
+
+type externalClock struct {
+	now   func() time.Time
+	start time.Time
+}
+
+// NewWallClock creates a new clock that returns the time elapsed since its creation
+func NewWallClock() Clock {
+	return NewExternalClock(time.Now)
+}
+
+// NewExternalClock creates a new clock that returns the time elapsed since its creation according to the provided
+// func, for instance to rely on a time source disciplined by PTP or NTP
+func NewExternalClock(now func() time.Time) Clock {
+	return &externalClock{
+		now:   now,
+		start: now(),
+	}
+}
+
+// Now implements the Clock interface
+func (c *externalClock) Now() time.Duration {
+	return c.now().Sub(c.start)
+}
+
+type mediaClock struct {
+	at       time.Time
+	m        *sync.Mutex
+	now      func() time.Time
+	position *time.Duration
+}
+
+// NewMediaClock creates a new clock whose position is the last position it has been updated with extrapolated with
+// the time elapsed since then. It's 0 until it has been updated at least once
+// Feeding it with the timestamps of an audio stream makes it an audio master clock, and with the timestamps of a
+// video stream a video master clock
+func NewMediaClock() ClockUpdater {
+	return newMediaClock(time.Now)
+}
+
+func newMediaClock(now func() time.Time) *mediaClock {
+	return &mediaClock{
+		m:   &sync.Mutex{},
+		now: now,
+	}
+}
+
+// Now implements the Clock interface
+func (c *mediaClock) Now() time.Duration {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.position == nil {
+		return 0
+	}
+	return *c.position + c.now().Sub(c.at)
+}
+
+// Update implements the ClockUpdater interface
+func (c *mediaClock) Update(position time.Duration) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.at = c.now()
+	c.position = &position
+}
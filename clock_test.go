@@ -0,0 +1,28 @@
+package astiencoder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExternalClock(t *testing.T) {
+	n := time.Unix(10, 0)
+	c := NewExternalClock(func() time.Time { return n })
+	assert.Equal(t, time.Duration(0), c.Now())
+	n = n.Add(time.Second)
+	assert.Equal(t, time.Second, c.Now())
+}
+
+func TestMediaClock(t *testing.T) {
+	n := time.Unix(10, 0)
+	c := newMediaClock(func() time.Time { return n })
+	assert.Equal(t, time.Duration(0), c.Now())
+	c.Update(5 * time.Second)
+	assert.Equal(t, 5*time.Second, c.Now())
+	n = n.Add(100 * time.Millisecond)
+	assert.Equal(t, 5100*time.Millisecond, c.Now())
+	c.Update(5050 * time.Millisecond)
+	assert.Equal(t, 5050*time.Millisecond, c.Now())
+}
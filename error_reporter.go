@@ -0,0 +1,123 @@
+package astiencoder
+
+import (
+	"sync"
+	"time"
+)
+
+// ErrorReport represents an error forwarded to an error reporter
+type ErrorReport struct {
+	At time.Time
+	// Most recent events received before the error, oldest first
+	Breadcrumbs []ErrorReportBreadcrumb
+	Err         error
+	// Name of the node targeted by the error, if any
+	Node string
+	// Last stats received for the node targeted by the error, if any
+	Stats    []EventStat
+	Workflow string
+}
+
+// ErrorReportBreadcrumb represents an event received before an error
+type ErrorReportBreadcrumb struct {
+	At     time.Time
+	Record LogRecord
+}
+
+// ErrorReporter represents an object capable of forwarding errors to an error-reporting service such as Sentry
+type ErrorReporter interface {
+	Report(r ErrorReport)
+}
+
+// ErrorReporterFunc allows using a func as an error reporter
+type ErrorReporterFunc func(r ErrorReport)
+
+// Report implements the ErrorReporter interface
+func (f ErrorReporterFunc) Report(r ErrorReport) {
+	f(r)
+}
+
+// ErrorReporterOptions represents error reporter options
+type ErrorReporterOptions struct {
+	// Defaults to 50
+	BreadcrumbsSize int
+	// Used when the error target is not a workflow
+	Workflow string
+}
+
+type errorReporterAdapter struct {
+	bs    []ErrorReportBreadcrumb
+	m     *sync.Mutex
+	o     ErrorReporterOptions
+	r     ErrorReporter
+	stats map[string][]EventStat
+}
+
+// ErrorReporterEventHandlerAdapter adapts the event handler so that error events are forwarded to the error reporter
+func ErrorReporterEventHandlerAdapter(r ErrorReporter, h *EventHandler, o ErrorReporterOptions) {
+	// Default values
+	if o.BreadcrumbsSize <= 0 {
+		o.BreadcrumbsSize = 50
+	}
+
+	// Create adapter
+	a := &errorReporterAdapter{
+		m:     &sync.Mutex{},
+		o:     o,
+		r:     r,
+		stats: make(map[string][]EventStat),
+	}
+	h.AddForAll(a.handleEvent)
+}
+
+func (a *errorReporterAdapter) handleEvent(e Event) bool {
+	// Get time
+	now := time.Now()
+
+	// Lock
+	a.m.Lock()
+
+	// Store stats
+	if e.Name == EventNameNodeStats {
+		if n, ok := e.Target.(Node); ok {
+			if ss, ok := e.Payload.([]EventStat); ok {
+				a.stats[n.Metadata().Name] = ss
+			}
+		}
+		a.m.Unlock()
+		return false
+	}
+
+	// Not an error
+	lr, _ := newLogRecord(e, StructuredLoggerOptions{Workflow: a.o.Workflow})
+	err, ok := e.Payload.(error)
+	if e.Name != EventNameError || !ok {
+		// Add breadcrumb
+		a.bs = append(a.bs, ErrorReportBreadcrumb{
+			At:     now,
+			Record: lr,
+		})
+		if len(a.bs) > a.o.BreadcrumbsSize {
+			a.bs = a.bs[len(a.bs)-a.o.BreadcrumbsSize:]
+		}
+		a.m.Unlock()
+		return false
+	}
+
+	// Create report
+	r := ErrorReport{
+		At:          now,
+		Breadcrumbs: append([]ErrorReportBreadcrumb{}, a.bs...),
+		Err:         err,
+		Node:        lr.Node,
+		Workflow:    lr.Workflow,
+	}
+	if ss, ok := a.stats[lr.Node]; ok {
+		r.Stats = ss
+	}
+	a.m.Unlock()
+
+	// Report
+	a.r.Report(r)
+	return false
+}
@@ -0,0 +1,37 @@
+package astiencoder
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorReporter(t *testing.T) {
+	// Setup
+	eh := NewEventHandler()
+	var rs []ErrorReport
+	ErrorReporterEventHandlerAdapter(ErrorReporterFunc(func(r ErrorReport) { rs = append(rs, r) }), eh, ErrorReporterOptions{
+		BreadcrumbsSize: 2,
+		Workflow:        "test",
+	})
+	n := newMockedOutputNode("node", WorkflowReportOutput{}, eh)
+
+	// Emit
+	eh.Emit(Event{Name: EventNameNodeStarted, Target: n})
+	eh.Emit(Event{Name: EventNameNodeStats, Payload: []EventStat{{Label: "label"}}, Target: n})
+	eh.Emit(Event{Name: "event-1"})
+	eh.Emit(Event{Name: "event-2"})
+	eh.Emit(EventError(n, errors.New("error")))
+
+	// Assert
+	if assert.Equal(t, 1, len(rs)) {
+		assert.Equal(t, "error", rs[0].Err.Error())
+		assert.Equal(t, "node", rs[0].Node)
+		assert.Equal(t, "test", rs[0].Workflow)
+		assert.Equal(t, []EventStat{{Label: "label"}}, rs[0].Stats)
+		assert.Equal(t, 2, len(rs[0].Breadcrumbs))
+		assert.Equal(t, "event-1", rs[0].Breadcrumbs[0].Record.Event)
+		assert.Equal(t, "event-2", rs[0].Breadcrumbs[1].Record.Event)
+	}
+}
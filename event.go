@@ -18,6 +18,7 @@ var (
 	EventNameNodeStopped       = "astiencoder.node.stopped"
 	EventNameWorkflowContinued = "astiencoder.workflow.continued"
 	EventNameWorkflowPaused    = "astiencoder.workflow.paused"
+	EventNameWorkflowReport    = "astiencoder.workflow.report"
 	EventNameWorkflowStarted   = "astiencoder.workflow.started"
 	EventNameWorkflowStats     = "astiencoder.workflow.stats"
 	EventNameWorkflowStopped   = "astiencoder.workflow.stopped"
@@ -170,14 +171,7 @@ func LoggerEventHandlerAdapter(i astikit.StdLogger, h *EventHandler) {
 
 	// Error
 	h.AddForEventName(EventNameError, func(e Event) bool {
-		var t string
-		if v, ok := e.Target.(Node); ok {
-			t = v.Metadata().Name
-		} else if v, ok := e.Target.(*Workflow); ok {
-			t = v.Name()
-		} else if e.Target != nil {
-			t = fmt.Sprintf("%p", e.Target)
-		}
+		t := eventTargetName(e.Target)
 		if len(t) > 0 {
 			t = "(" + t + ")"
 		}
@@ -206,6 +200,17 @@ func LoggerEventHandlerAdapter(i astikit.StdLogger, h *EventHandler) {
 	})
 }
 
+func eventTargetName(target interface{}) (t string) {
+	if v, ok := target.(Node); ok {
+		t = v.Metadata().Name
+	} else if v, ok := target.(*Workflow); ok {
+		t = v.Name()
+	} else if target != nil {
+		t = fmt.Sprintf("%p", target)
+	}
+	return
+}
+
 // EventGenerator represents an object capable of generating an event based on its type
 type EventGenerator interface {
 	Event(eventType string, payload interface{}) Event
@@ -0,0 +1,208 @@
+package astilibav
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avformat"
+	"github.com/asticode/goav/avutil"
+)
+
+const defaultABRLadderKeyFrameInterval = 2 * time.Second
+
+// ABRLadder represents the nodes of an ABR ladder built on top of a decoded video stream
+type ABRLadder struct {
+	Renditions []ABRLadderRenditionNodes
+}
+
+// ABRLadderRenditionNodes represents the nodes of an ABR ladder rendition
+type ABRLadderRenditionNodes struct {
+	Encoder *Encoder
+	// Nil if the rendition has the same size as the input
+	Filterer *Filterer
+	Muxer    *Muxer
+}
+
+// ABRLadderOptions represents ABR ladder options
+type ABRLadderOptions struct {
+	// Such as "libx264"
+	CodecName string
+	// Shared by all renditions
+	CodecOptions EncoderCodecOptions
+	// Decoded video stream, such as a decoder and the ctx of its input stream. Its node must implement the
+	// FrameHandlerConnector interface
+	Input FiltererInput
+	// Interval between 2 keyframes of all renditions. Since renditions are fed with the same frames, their keyframes
+	// are aligned. When the input frame rate is known, the GOP size is fixed accordingly and scene cut detection is
+	// disabled. Defaults to 2s
+	KeyFrameInterval time.Duration
+	Renditions       []ABRLadderRendition
+}
+
+// ABRLadderRendition represents an ABR ladder rendition
+type ABRLadderRendition struct {
+	BitRate int
+	// Mandatory
+	Height int
+	// Output of the rendition
+	Muxer MuxerOptions
+	// If 0, it's computed from the height and the input aspect ratio
+	Width int
+}
+
+// NewABRLadder creates the scalers, encoders and muxers of each rendition and connects them to the input node. Since
+// they're children of the input node, they're part of the workflow as soon as the input node is
+func NewABRLadder(o ABRLadderOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (l *ABRLadder, err error) {
+	// Check input
+	if o.Input.Node == nil {
+		err = errors.New("astilibav: no input node provided")
+		return
+	}
+	in, ok := o.Input.Node.(FrameHandlerConnector)
+	if !ok {
+		err = fmt.Errorf("astilibav: input node %s is not a FrameHandlerConnector", o.Input.Node.Metadata().Name)
+		return
+	}
+	if o.Input.Context.CodecType != avcodec.AVMEDIA_TYPE_VIDEO {
+		err = errors.New("astilibav: input is not a video stream")
+		return
+	}
+
+	// No renditions
+	if len(o.Renditions) == 0 {
+		err = errors.New("astilibav: no renditions provided")
+		return
+	}
+
+	// Default values
+	if o.KeyFrameInterval <= 0 {
+		o.KeyFrameInterval = defaultABRLadderKeyFrameInterval
+	}
+
+	// Loop through renditions
+	l = &ABRLadder{}
+	for idx, r := range o.Renditions {
+		// Create rendition
+		var rn ABRLadderRenditionNodes
+		if rn, err = newABRLadderRendition(o, r, in, eh, c); err != nil {
+			err = fmt.Errorf("astilibav: creating rendition #%d failed: %w", idx, err)
+			return
+		}
+
+		// Append
+		l.Renditions = append(l.Renditions, rn)
+	}
+	return
+}
+
+func newABRLadderRendition(o ABRLadderOptions, r ABRLadderRendition, in FrameHandlerConnector, eh *astiencoder.EventHandler, c *astikit.Closer) (rn ABRLadderRenditionNodes, err error) {
+	// Get size
+	width, height := r.Width, r.Height
+	if width <= 0 {
+		width = abrLadderWidth(height, o.Input.Context.Width, o.Input.Context.Height)
+	}
+	if width <= 0 || height <= 0 {
+		err = fmt.Errorf("astilibav: invalid size %dx%d", width, height)
+		return
+	}
+
+	// Create muxer
+	if rn.Muxer, err = NewMuxer(r.Muxer, eh, c); err != nil {
+		err = fmt.Errorf("astilibav: creating muxer failed: %w", err)
+		return
+	}
+
+	// Create ctx
+	ctx := o.Input.Context
+	ctx.BitRate = r.BitRate
+	ctx.CodecName = o.CodecName
+	ctx.GlobalHeader = rn.Muxer.CtxFormat().Oformat().Flags()&avformat.AVFMT_GLOBALHEADER > 0
+	ctx.Height = height
+	ctx.Width = width
+	codecOptions := o.CodecOptions
+	if ctx.FrameRate.Num() > 0 && ctx.FrameRate.Den() > 0 {
+		ctx.TimeBase = avutil.NewRational(ctx.FrameRate.Den(), ctx.FrameRate.Num())
+		codecOptions = abrLadderCodecOptions(o.CodecOptions, int(math.Round(o.KeyFrameInterval.Seconds()*float64(ctx.FrameRate.Num())/float64(ctx.FrameRate.Den()))))
+	}
+
+	// Create filterer
+	if ctx.Width != o.Input.Context.Width || ctx.Height != o.Input.Context.Height {
+		if rn.Filterer, err = NewFilterer(FiltererOptions{
+			Content: fmt.Sprintf("scale='w=%d:h=%d'", ctx.Width, ctx.Height),
+			Inputs:  map[string]FiltererInput{"in": o.Input},
+		}, eh, c); err != nil {
+			err = fmt.Errorf("astilibav: creating filterer failed: %w", err)
+			return
+		}
+	}
+
+	// Create encoder
+	if rn.Encoder, err = NewEncoder(EncoderOptions{
+		ClosedGOP:        true,
+		CodecOptions:     codecOptions,
+		Ctx:              ctx,
+		KeyFrameInterval: o.KeyFrameInterval,
+	}, eh, c); err != nil {
+		err = fmt.Errorf("astilibav: creating encoder failed: %w", err)
+		return
+	}
+
+	// Add stream
+	var s *avformat.Stream
+	if s, err = rn.Encoder.AddStream(rn.Muxer.CtxFormat()); err != nil {
+		err = fmt.Errorf("astilibav: adding stream failed: %w", err)
+		return
+	}
+
+	// Connect
+	if rn.Filterer != nil {
+		in.Connect(rn.Filterer)
+		rn.Filterer.Connect(rn.Encoder)
+	} else {
+		in.Connect(rn.Encoder)
+	}
+	rn.Encoder.Connect(rn.Muxer.NewPktHandler(s))
+	return
+}
+
+// abrLadderCodecOptions makes sure the GOP has a fixed size and that the encoder doesn't insert keyframes on scene
+// changes, which would break the alignment of renditions. Options that have been set explicitly are kept
+func abrLadderCodecOptions(o EncoderCodecOptions, gopSize int) EncoderCodecOptions {
+	// Invalid GOP size
+	if gopSize <= 0 {
+		return o
+	}
+
+	// GOP size
+	if o.GOPSize == nil {
+		o.GOPSize = astikit.IntPtr(gopSize)
+	}
+
+	// Dictionary
+	d := make(map[string]string)
+	for k, v := range o.Dictionary {
+		d[k] = v
+	}
+	if _, ok := d["keyint_min"]; !ok {
+		d["keyint_min"] = strconv.Itoa(*o.GOPSize)
+	}
+	if _, ok := d["sc_threshold"]; !ok {
+		d["sc_threshold"] = "0"
+	}
+	o.Dictionary = d
+	return o
+}
+
+// abrLadderWidth keeps the aspect ratio and returns an even width since most encoders require it
+func abrLadderWidth(height, inWidth, inHeight int) int {
+	if inHeight <= 0 {
+		return inWidth
+	}
+	return int(math.Round(float64(height)*float64(inWidth)/float64(inHeight)/2)) * 2
+}
@@ -0,0 +1,37 @@
+package astilibav
+
+import (
+	"testing"
+
+	"github.com/asticode/go-astikit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestABRLadderWidth(t *testing.T) {
+	assert.Equal(t, 1280, abrLadderWidth(720, 1920, 1080))
+	assert.Equal(t, 854, abrLadderWidth(480, 1920, 1080))
+	assert.Equal(t, 640, abrLadderWidth(480, 640, 480))
+	assert.Equal(t, 1920, abrLadderWidth(480, 1920, 0))
+}
+
+func TestABRLadderCodecOptions(t *testing.T) {
+	assert.Equal(t, EncoderCodecOptions{}, abrLadderCodecOptions(EncoderCodecOptions{}, 0))
+	assert.Equal(t, EncoderCodecOptions{
+		GOPSize: astikit.IntPtr(50),
+		Dictionary: map[string]string{
+			"keyint_min":   "50",
+			"sc_threshold": "0",
+		},
+	}, abrLadderCodecOptions(EncoderCodecOptions{}, 50))
+
+	// Explicit options are kept
+	d := map[string]string{"sc_threshold": "40"}
+	assert.Equal(t, EncoderCodecOptions{
+		GOPSize: astikit.IntPtr(60),
+		Dictionary: map[string]string{
+			"keyint_min":   "60",
+			"sc_threshold": "40",
+		},
+	}, abrLadderCodecOptions(EncoderCodecOptions{Dictionary: d, GOPSize: astikit.IntPtr(60)}, 50))
+	assert.Equal(t, map[string]string{"sc_threshold": "40"}, d)
+}
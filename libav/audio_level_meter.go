@@ -0,0 +1,317 @@
+package astilibav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+)
+
+var countAudioLevelMeter uint64
+
+// Default audio level meter values
+const (
+	defaultAudioLevelMeterPeriod = 300 * time.Millisecond
+)
+
+// Levels reported for silence, since -Inf can't be marshaled to JSON
+const audioLevelMeterFloor = -100
+
+// AudioLevelMeter represents an object capable of measuring the RMS and peak levels of each audio channel, for
+// instance to render live VU meters
+// Levels are measured over periods of the audio timeline. They are exposed as stats and an
+// EventNameAudioLevelMeterLevels event is emitted at the end of each period with an AudioLevels payload
+// It doesn't forward anything
+type AudioLevelMeter struct {
+	*astiencoder.BaseNode
+	c                *astikit.Chan
+	eh               *astiencoder.EventHandler
+	last             AudioLevels
+	m                *sync.Mutex // Locks last
+	me               *audioLevelMeasurer
+	o                AudioLevelMeterOptions
+	statIncomingRate *astikit.CounterAvgStat
+	statWorkRatio    *astikit.DurationPercentageStat
+}
+
+// AudioLevelMeterOptions represents audio level meter options
+type AudioLevelMeterOptions struct {
+	// Context of the incoming frames. Only Channels and SampleRate are used
+	Context Context
+	Node    astiencoder.NodeOptions
+	// Defaults to 300ms
+	Period time.Duration
+}
+
+// AudioLevels represents the audio levels measured over a period
+type AudioLevels struct {
+	// Indexed by channel
+	Channels []AudioChannelLevels
+	// Start of the period
+	Time time.Duration
+}
+
+// AudioChannelLevels represents the levels of an audio channel
+// Levels are in dBFS and floored at -100 which is what silence is reported as
+type AudioChannelLevels struct {
+	Peak float64
+	RMS  float64
+}
+
+// NewAudioLevelMeter creates a new audio level meter
+func NewAudioLevelMeter(o AudioLevelMeterOptions, eh *astiencoder.EventHandler) (m *AudioLevelMeter, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countAudioLevelMeter, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("audio_level_meter_%d", count), fmt.Sprintf("Audio Level Meter #%d", count), "Measures audio levels")
+
+	// No channels
+	if o.Context.Channels <= 0 {
+		err = errors.New("astilibav: no channels provided")
+		return
+	}
+
+	// No sample rate
+	if o.Context.SampleRate <= 0 {
+		err = errors.New("astilibav: no sample rate provided")
+		return
+	}
+
+	// Default values
+	if o.Period <= 0 {
+		o.Period = defaultAudioLevelMeterPeriod
+	}
+
+	// Create audio level meter
+	m = &AudioLevelMeter{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh:               eh,
+		last:             newAudioLevels(o.Context.Channels),
+		m:                &sync.Mutex{},
+		me:               newAudioLevelMeasurer(o.Context.Channels, o.Context.SampleRate, o.Period),
+		o:                o,
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statWorkRatio:    astikit.NewDurationPercentageStat(),
+	}
+	m.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(m), eh)
+	m.addStats()
+	return
+}
+
+func (m *AudioLevelMeter) addStats() {
+	// Add incoming rate
+	m.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of frames coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "fps",
+	}, m.statIncomingRate)
+
+	// Loop through channels
+	for idx := 0; idx < m.o.Context.Channels; idx++ {
+		// Add rms
+		m.Stater().AddStat(astikit.StatMetadata{
+			Description: fmt.Sprintf("RMS level of channel #%d measured over the last period", idx+1),
+			Label:       fmt.Sprintf("Channel #%d RMS", idx+1),
+			Unit:        "dBFS",
+		}, newAudioLevelMeterStat(m, idx, func(l AudioChannelLevels) float64 { return l.RMS }))
+
+		// Add peak
+		m.Stater().AddStat(astikit.StatMetadata{
+			Description: fmt.Sprintf("Peak level of channel #%d measured over the last period", idx+1),
+			Label:       fmt.Sprintf("Channel #%d peak", idx+1),
+			Unit:        "dBFS",
+		}, newAudioLevelMeterStat(m, idx, func(l AudioChannelLevels) float64 { return l.Peak }))
+	}
+
+	// Add work ratio
+	m.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, m.statWorkRatio)
+
+	// Add chan stats
+	m.c.AddStats(m.Stater())
+}
+
+// Levels returns the levels measured over the last period
+func (m *AudioLevelMeter) Levels() AudioLevels {
+	m.m.Lock()
+	defer m.m.Unlock()
+	return m.last
+}
+
+// Start starts the audio level meter
+func (m *AudioLevelMeter) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	m.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to stop the chan properly
+		defer m.c.Stop()
+
+		// Start chan
+		m.c.Start(m.Context())
+	})
+}
+
+// HandleFrame implements the FrameHandler interface
+func (m *AudioLevelMeter) HandleFrame(p *FrameHandlerPayload) {
+	m.c.Add(func() {
+		// Handle pause
+		defer m.HandlePause()
+
+		// Increment incoming rate
+		m.statIncomingRate.Add(1)
+
+		// Get time
+		var at time.Duration
+		if pts := p.Frame.Pts(); pts != avutil.AV_NOPTS_VALUE && p.Descriptor != nil {
+			at = time.Duration(avutil.AvRescaleQ(pts, p.Descriptor.TimeBase(), nanosecondRational))
+		}
+
+		// Get samples
+		m.statWorkRatio.Begin()
+		s, err := frameExporterSamples(p.Frame)
+		if err != nil {
+			m.statWorkRatio.End()
+			m.eh.Emit(astiencoder.EventError(m, fmt.Errorf("astilibav: getting samples failed: %w", err)))
+			return
+		}
+
+		// Measure
+		ls := m.me.add(s, at)
+		m.statWorkRatio.End()
+
+		// Loop through levels
+		for _, l := range ls {
+			// Store levels
+			m.m.Lock()
+			m.last = l
+			m.m.Unlock()
+
+			// Emit
+			m.eh.Emit(astiencoder.Event{
+				Name:    EventNameAudioLevelMeterLevels,
+				Payload: l,
+				Target:  m,
+			})
+		}
+	})
+}
+
+type audioLevelMeterStat struct {
+	channel int
+	fn      func(l AudioChannelLevels) float64
+	m       *AudioLevelMeter
+}
+
+func newAudioLevelMeterStat(m *AudioLevelMeter, channel int, fn func(l AudioChannelLevels) float64) *audioLevelMeterStat {
+	return &audioLevelMeterStat{
+		channel: channel,
+		fn:      fn,
+		m:       m,
+	}
+}
+
+// Start implements the astikit.StatHandler interface
+func (s *audioLevelMeterStat) Start() {}
+
+// Stop implements the astikit.StatHandler interface
+func (s *audioLevelMeterStat) Stop() {}
+
+// Value implements the astikit.StatHandler interface
+func (s *audioLevelMeterStat) Value(delta time.Duration) interface{} {
+	return s.fn(s.m.Levels().Channels[s.channel])
+}
+
+func newAudioLevels(channels int) AudioLevels {
+	l := AudioLevels{Channels: make([]AudioChannelLevels, channels)}
+	for idx := range l.Channels {
+		l.Channels[idx] = AudioChannelLevels{
+			Peak: audioLevelMeterFloor,
+			RMS:  audioLevelMeterFloor,
+		}
+	}
+	return l
+}
+
+type audioLevelMeasurer struct {
+	channels   int
+	n          int
+	peaks      []float64
+	sampleRate int
+	start      time.Duration
+	sums       []float64
+	window     int
+}
+
+func newAudioLevelMeasurer(channels, sampleRate int, period time.Duration) *audioLevelMeasurer {
+	m := &audioLevelMeasurer{
+		channels:   channels,
+		peaks:      make([]float64, channels),
+		sampleRate: sampleRate,
+		sums:       make([]float64, channels),
+		window:     int(math.Max(1, math.Round(period.Seconds()*float64(sampleRate)))),
+	}
+	return m
+}
+
+// add adds interleaved normalized samples starting at the provided time and returns the levels of the periods that
+// have been completed
+func (m *audioLevelMeasurer) add(s []float64, at time.Duration) (ls []AudioLevels) {
+	// Loop through samples
+	for idx := 0; idx+m.channels <= len(s); idx += m.channels {
+		// Period is starting
+		if m.n == 0 {
+			m.start = at + time.Duration(idx/m.channels)*time.Second/time.Duration(m.sampleRate)
+		}
+
+		// Loop through channels
+		for c := 0; c < m.channels; c++ {
+			v := s[idx+c]
+			m.sums[c] += v * v
+			m.peaks[c] = math.Max(m.peaks[c], math.Abs(v))
+		}
+		m.n++
+
+		// Period is complete
+		if m.n >= m.window {
+			ls = append(ls, m.levels())
+			m.reset()
+		}
+	}
+	return
+}
+
+func (m *audioLevelMeasurer) levels() (l AudioLevels) {
+	l = AudioLevels{
+		Channels: make([]AudioChannelLevels, m.channels),
+		Time:     m.start,
+	}
+	for c := 0; c < m.channels; c++ {
+		l.Channels[c] = AudioChannelLevels{
+			Peak: audioLevelMeterDB(20 * math.Log10(m.peaks[c])),
+			RMS:  audioLevelMeterDB(10 * math.Log10(m.sums[c]/float64(m.n))),
+		}
+	}
+	return
+}
+
+func (m *audioLevelMeasurer) reset() {
+	m.n = 0
+	for c := 0; c < m.channels; c++ {
+		m.peaks[c] = 0
+		m.sums[c] = 0
+	}
+}
+
+func audioLevelMeterDB(v float64) float64 {
+	return math.Max(audioLevelMeterFloor, v)
+}
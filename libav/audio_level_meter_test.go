@@ -0,0 +1,35 @@
+package astilibav
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAudioLevelMeasurer(t *testing.T) {
+	m := newAudioLevelMeasurer(2, 4, time.Second)
+
+	// Period is not complete
+	ls := m.add([]float64{0.5, 0, -0.5, 0}, 0)
+	assert.Len(t, ls, 0)
+
+	// Period is complete
+	ls = m.add([]float64{0.5, 0, -0.5, 0, 1, 0.1, 1, 0.1}, 500*time.Millisecond)
+	assert.Len(t, ls, 1)
+	assert.Equal(t, time.Duration(0), ls[0].Time)
+	assert.Len(t, ls[0].Channels, 2)
+	assert.InDelta(t, -6.0206, ls[0].Channels[0].RMS, 0.0001)
+	assert.InDelta(t, -6.0206, ls[0].Channels[0].Peak, 0.0001)
+	assert.Equal(t, float64(audioLevelMeterFloor), ls[0].Channels[1].RMS)
+	assert.Equal(t, float64(audioLevelMeterFloor), ls[0].Channels[1].Peak)
+
+	// Next period starts in the middle of the frame
+	ls = m.add([]float64{1, 0.1, 1, 0.1}, 1500*time.Millisecond)
+	assert.Len(t, ls, 1)
+	assert.Equal(t, time.Second, ls[0].Time)
+	assert.InDelta(t, 0, ls[0].Channels[0].RMS, 0.0001)
+	assert.InDelta(t, 0, ls[0].Channels[0].Peak, 0.0001)
+	assert.InDelta(t, -20, ls[0].Channels[1].RMS, 0.0001)
+	assert.InDelta(t, -20, ls[0].Channels[1].Peak, 0.0001)
+}
@@ -0,0 +1,138 @@
+package astilibav
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+)
+
+var countAudioMixer uint64
+
+// AudioMixer represents an object capable of mixing audio frames coming from several nodes into a single stream
+// Frames are aligned by pts, each input having its own gain that can be updated at runtime. Inputs are summed
+// without being normalized, which requires ffmpeg >= 4.4
+type AudioMixer struct {
+	*Filterer
+	inputs    map[astiencoder.Node]string
+	outputCtx Context
+}
+
+// AudioMixerOptions represents audio mixer options
+type AudioMixerOptions struct {
+	// Possible values are "first", "longest" and "shortest". Defaults to "longest"
+	Duration  string
+	Inputs    []AudioMixerInput
+	Node      astiencoder.NodeOptions
+	Restamper FrameRestamper
+}
+
+// AudioMixerInput represents an audio mixer input
+type AudioMixerInput struct {
+	Context Context
+	// In dB. 0 means the volume is unchanged and -Inf means it's muted
+	Gain float64
+	Node astiencoder.Node
+}
+
+// NewAudioMixer creates a new audio mixer
+func NewAudioMixer(o AudioMixerOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (m *AudioMixer, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countAudioMixer, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("audio_mixer_%d", count), fmt.Sprintf("Audio Mixer #%d", count), "Mixes audio")
+
+	// No inputs
+	if len(o.Inputs) == 0 {
+		err = errors.New("astilibav: no inputs provided")
+		return
+	}
+
+	// Get duration
+	switch o.Duration {
+	case "":
+		o.Duration = "longest"
+	case "first", "longest", "shortest":
+	default:
+		err = fmt.Errorf("astilibav: invalid duration %s", o.Duration)
+		return
+	}
+
+	// Create audio mixer
+	m = &AudioMixer{inputs: make(map[astiencoder.Node]string)}
+
+	// Loop through inputs
+	is := make(map[string]FiltererInput)
+	var filters, pads []string
+	for idx, i := range o.Inputs {
+		// Check input
+		if i.Context.CodecType != avutil.AVMEDIA_TYPE_AUDIO {
+			err = fmt.Errorf("astilibav: input #%d is not audio", idx)
+			return
+		}
+
+		// Add filterer input
+		n := fmt.Sprintf("in%d", idx)
+		is[n] = FiltererInput{
+			Context: i.Context,
+			Node:    i.Node,
+		}
+		m.inputs[i.Node] = n
+
+		// Each input has its own volume filter so that its gain can be updated with a command
+		filters = append(filters, fmt.Sprintf("[%s]volume@%s=volume=%s:precision=float[%s_gain]", n, n, audioMixerVolume(i.Gain), n))
+		pads = append(pads, fmt.Sprintf("[%s_gain]", n))
+	}
+
+	// Mix
+	filters = append(filters, fmt.Sprintf("%samix=inputs=%d:duration=%s:normalize=0", strings.Join(pads, ""), len(o.Inputs), o.Duration))
+
+	// Create filterer
+	if m.Filterer, err = NewFilterer(FiltererOptions{
+		Content:   strings.Join(filters, ";"),
+		Inputs:    is,
+		Node:      o.Node,
+		Restamper: o.Restamper,
+	}, eh, c); err != nil {
+		err = fmt.Errorf("astilibav: creating filterer failed: %w", err)
+		return
+	}
+
+	// Output format is negotiated by the graph
+	m.outputCtx = newBufferSinkStreamDescriptor(m.os[0].bufferSinkCtx, nil).Context()
+	return
+}
+
+// SetInputGain updates the gain in dB of the input of the provided node
+// It's executed between 2 frames and blocks until then
+func (m *AudioMixer) SetInputGain(n astiencoder.Node, g float64) error {
+	// Get input
+	i, ok := m.inputs[n]
+	if !ok {
+		return errors.New("astilibav: node is not an input")
+	}
+
+	// Send command
+	if err := m.SendCommand("volume@"+i, "volume", audioMixerVolume(g), 0); err != nil {
+		return fmt.Errorf("astilibav: sending command failed: %w", err)
+	}
+	return nil
+}
+
+// OutputCtx returns the context of the frames coming out of the audio mixer
+// It should be used to create the next nodes, such as the encoder
+func (m *AudioMixer) OutputCtx() Context {
+	return m.outputCtx
+}
+
+func audioMixerVolume(g float64) string {
+	if math.IsInf(g, -1) {
+		return "0"
+	}
+	return strconv.FormatFloat(g, 'f', -1, 64) + "dB"
+}
@@ -0,0 +1,14 @@
+package astilibav
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAudioMixerVolume(t *testing.T) {
+	assert.Equal(t, "0dB", audioMixerVolume(0))
+	assert.Equal(t, "-6.5dB", audioMixerVolume(-6.5))
+	assert.Equal(t, "0", audioMixerVolume(math.Inf(-1)))
+}
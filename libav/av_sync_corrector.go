@@ -0,0 +1,436 @@
+package astilibav
+
+//#cgo pkg-config: libavutil
+//#include <libavutil/frame.h>
+//#include <libavutil/samplefmt.h>
+//#include "compat.h"
+//static int astilibav_av_sync_corrector_silence(AVFrame *dst, const AVFrame *src) {
+//	dst->format = src->format;
+//	dst->nb_samples = src->nb_samples;
+//	dst->sample_rate = src->sample_rate;
+//#ifdef ASTILIBAV_CH_LAYOUT
+//	int ret = av_channel_layout_copy(&dst->ch_layout, &src->ch_layout);
+//	if (ret < 0) return ret;
+//#else
+//	dst->channel_layout = src->channel_layout;
+//	dst->channels = src->channels;
+//	int ret;
+//#endif
+//	if ((ret = av_frame_get_buffer(dst, 0)) < 0) return ret;
+//	if ((ret = av_frame_copy_props(dst, src)) < 0) return ret;
+//	return av_samples_set_silence(dst->extended_data, 0, dst->nb_samples, astilibav_frame_channels(dst), dst->format);
+//}
+import "C"
+import (
+	"context"
+	"fmt"
+	"image"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+)
+
+var countAVSyncCorrector uint64
+
+// A/V sync corrector modes
+const (
+	AVSyncCorrectorModeAudio = "audio"
+	AVSyncCorrectorModeVideo = "video"
+)
+
+// Default A/V sync corrector values
+const (
+	defaultAVSyncCorrectorThreshold = 40 * time.Millisecond
+)
+
+// Weight of the latest measure in the smoothed offsets
+const avSyncCorrectorSmoothing = 0.05
+
+// AVSyncCorrector represents an object capable of keeping an audio branch and a video branch of a live input in sync
+// The drift is measured by comparing how the PTS of each branch progress against the wall clock. When it exceeds the
+// threshold, it's corrected on one branch only: video frames are either dropped or duplicated, or audio frames are
+// either trimmed or preceded by silence. Outgoing frames of the corrected branch are restamped accordingly
+// Audio frames are dispatched to the handlers connected to the audio output and video frames to the handlers connected
+// to the video output
+type AVSyncCorrector struct {
+	*astiencoder.BaseNode
+	audio            *AVSyncCorrectorOutput
+	c                *astikit.Chan
+	eh               *astiencoder.EventHandler
+	lastVideoPts     *int64
+	m                *sync.Mutex // Locks t
+	o                AVSyncCorrectorOptions
+	p                *framePool
+	start            time.Time
+	statCorrections  *astikit.CounterAvgStat
+	statIncomingRate *astikit.CounterAvgStat
+	statWorkRatio    *astikit.DurationPercentageStat
+	t                *avSyncTracker
+	video            *AVSyncCorrectorOutput
+}
+
+// AVSyncCorrectorOptions represents A/V sync corrector options
+type AVSyncCorrectorOptions struct {
+	// Branch being corrected. Possible values are "audio" and "video". Defaults to "video"
+	Mode string
+	Node astiencoder.NodeOptions
+	// Drift above which it is corrected. Defaults to 40ms
+	Threshold time.Duration
+}
+
+// AVSyncCorrectorOutput represents an output of an A/V sync corrector
+// Since it's not a node, connected handlers are children of the A/V sync corrector
+type AVSyncCorrectorOutput struct {
+	c *AVSyncCorrector
+	d *frameDispatcher
+}
+
+// NewAVSyncCorrector creates a new A/V sync corrector
+func NewAVSyncCorrector(o AVSyncCorrectorOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (s *AVSyncCorrector, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countAVSyncCorrector, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("av_sync_corrector_%d", count), fmt.Sprintf("A/V Sync Corrector #%d", count), "Corrects A/V sync")
+
+	// Check mode
+	switch o.Mode {
+	case "":
+		o.Mode = AVSyncCorrectorModeVideo
+	case AVSyncCorrectorModeAudio, AVSyncCorrectorModeVideo:
+	default:
+		err = fmt.Errorf("astilibav: invalid mode %s", o.Mode)
+		return
+	}
+
+	// Default values
+	if o.Threshold <= 0 {
+		o.Threshold = defaultAVSyncCorrectorThreshold
+	}
+
+	// Create A/V sync corrector
+	s = &AVSyncCorrector{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh:               eh,
+		m:                &sync.Mutex{},
+		o:                o,
+		p:                newFramePool(c),
+		statCorrections:  astikit.NewCounterAvgStat(),
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statWorkRatio:    astikit.NewDurationPercentageStat(),
+		t:                newAVSyncTracker(),
+	}
+	s.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(s), eh)
+	s.audio = &AVSyncCorrectorOutput{c: s, d: newFrameDispatcher(s, eh, c)}
+	s.video = &AVSyncCorrectorOutput{c: s, d: newFrameDispatcher(s, eh, c)}
+	s.addStats()
+	return
+}
+
+func (s *AVSyncCorrector) addStats() {
+	// Add incoming rate
+	s.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of frames coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "fps",
+	}, s.statIncomingRate)
+
+	// Add drift
+	s.Stater().AddStat(astikit.StatMetadata{
+		Description: "Smoothed difference between the audio and video offsets to the wall clock. Positive values mean audio is ahead",
+		Label:       "Drift",
+		Unit:        "ms",
+	}, newAVSyncCorrectorStat(s))
+
+	// Add corrections
+	s.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of corrections per second",
+		Label:       "Corrections",
+		Unit:        "cps",
+	}, s.statCorrections)
+
+	// Add work ratio
+	s.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, s.statWorkRatio)
+
+	// Add chan stats
+	s.c.AddStats(s.Stater())
+}
+
+// Audio returns the output audio frames are dispatched to
+func (s *AVSyncCorrector) Audio() *AVSyncCorrectorOutput {
+	return s.audio
+}
+
+// Video returns the output video frames are dispatched to
+func (s *AVSyncCorrector) Video() *AVSyncCorrectorOutput {
+	return s.video
+}
+
+// Drift returns the smoothed difference between the audio and video offsets to the wall clock, and whether it could
+// be measured. Positive values mean audio is ahead
+func (s *AVSyncCorrector) Drift() (time.Duration, bool) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.t.drift()
+}
+
+// Connect implements the FrameHandlerConnector interface
+func (o *AVSyncCorrectorOutput) Connect(h FrameHandler) {
+	// Add handler
+	o.d.addHandler(h)
+
+	// Connect nodes
+	astiencoder.ConnectNodes(o.c, h)
+}
+
+// Disconnect implements the FrameHandlerConnector interface
+func (o *AVSyncCorrectorOutput) Disconnect(h FrameHandler) {
+	// Delete handler
+	o.d.delHandler(h)
+
+	// Disconnect nodes
+	astiencoder.DisconnectNodes(o.c, h)
+}
+
+// Snapshot implements the astiencoder.Snapshotter interface
+func (s *AVSyncCorrector) Snapshot(ctx context.Context) (image.Image, error) {
+	return s.video.d.snapshot(ctx)
+}
+
+// Start starts the A/V sync corrector
+func (s *AVSyncCorrector) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	s.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to wait for all dispatcher subprocesses to be done so that they are properly closed
+		defer s.video.d.wait()
+		defer s.audio.d.wait()
+
+		// Make sure to stop the chan properly
+		defer s.c.Stop()
+
+		// Start chan
+		s.c.Start(s.Context())
+	})
+}
+
+// HandleEOS implements the EOSHandler interface
+func (s *AVSyncCorrector) HandleEOS(p *EOSHandlerPayload) {
+	s.c.Add(func() {
+		// Forward end of stream
+		s.audio.d.dispatchEOS()
+		s.video.d.dispatchEOS()
+	})
+}
+
+// HandleFrame implements the FrameHandler interface
+func (s *AVSyncCorrector) HandleFrame(p *FrameHandlerPayload) {
+	s.c.Add(func() {
+		// Handle pause
+		defer s.HandlePause()
+
+		// Increment incoming rate
+		s.statIncomingRate.Add(1)
+
+		// Get output
+		video := p.Frame.Width() > 0 && p.Frame.Height() > 0
+		o, b := s.audio, &s.t.audio
+		if video {
+			o, b = s.video, &s.t.video
+		}
+
+		// No pts
+		if p.Frame.Pts() == avutil.AV_NOPTS_VALUE || p.Descriptor == nil {
+			o.d.dispatch(p.Frame, p.Descriptor, p.Metadata)
+			return
+		}
+
+		// Copy frame since it's restamped and shared with the other handlers of the previous node
+		f := s.p.get()
+		defer s.p.put(f)
+		if ret := defaultBindings.frameRef(f, p.Frame); ret < 0 {
+			emitAvError(s, s.eh, ret, "avutil.AvFrameRef failed")
+			return
+		}
+
+		// Get unit duration
+		tb := p.Descriptor.TimeBase()
+		d := s.duration(f, tb, video)
+
+		// Measure
+		s.statWorkRatio.Begin()
+		if s.start.IsZero() {
+			s.start = time.Now()
+		}
+		s.m.Lock()
+		b.add(time.Duration(avutil.AvRescaleQ(f.Pts(), tb, nanosecondRational)), time.Since(s.start))
+		drift, ok := s.t.drift()
+		correction := b.correction
+		s.m.Unlock()
+		s.statWorkRatio.End()
+
+		// Restamp frame
+		f.SetPts(f.Pts() + avutil.AvRescaleQ(int64(correction), nanosecondRational, tb))
+
+		// Branch is not corrected
+		if !ok || d <= 0 || video != (s.o.Mode == AVSyncCorrectorModeVideo) {
+			o.d.dispatch(f, p.Descriptor, p.Metadata)
+			return
+		}
+
+		// Correct
+		switch avSyncCorrection(drift, s.o.Threshold, s.o.Mode) {
+		case -1:
+			// Drop or trim
+			s.correct(b, -d)
+		case 1:
+			// Insert silence
+			if !video {
+				if err := s.dispatchSilence(f, p.Descriptor, p.Metadata); err != nil {
+					s.eh.Emit(astiencoder.EventError(s, fmt.Errorf("astilibav: dispatching silence failed: %w", err)))
+					o.d.dispatch(f, p.Descriptor, p.Metadata)
+					return
+				}
+				f.SetPts(f.Pts() + avutil.AvRescaleQ(int64(d), nanosecondRational, tb))
+			}
+
+			// Dispatch frame
+			o.d.dispatch(f, p.Descriptor, p.Metadata)
+
+			// Duplicate
+			if video {
+				f.SetPts(f.Pts() + avutil.AvRescaleQ(int64(d), nanosecondRational, tb))
+				o.d.dispatch(f, p.Descriptor, p.Metadata)
+			}
+			s.correct(b, d)
+		default:
+			o.d.dispatch(f, p.Descriptor, p.Metadata)
+		}
+	})
+}
+
+func (s *AVSyncCorrector) duration(f *avutil.Frame, tb avutil.Rational, video bool) (d time.Duration) {
+	// Audio
+	if !video {
+		if f.SampleRate() > 0 {
+			d = time.Duration(f.NbSamples()) * time.Second / time.Duration(f.SampleRate())
+		}
+		return
+	}
+
+	// Video
+	if v := frameDuration(f); v > 0 {
+		d = time.Duration(avutil.AvRescaleQ(v, tb, nanosecondRational))
+	} else if s.lastVideoPts != nil && f.Pts() > *s.lastVideoPts {
+		d = time.Duration(avutil.AvRescaleQ(f.Pts()-*s.lastVideoPts, tb, nanosecondRational))
+	}
+	pts := f.Pts()
+	s.lastVideoPts = &pts
+	return
+}
+
+func (s *AVSyncCorrector) correct(b *avSyncBranch, d time.Duration) {
+	s.m.Lock()
+	b.correct(d)
+	s.m.Unlock()
+	s.statCorrections.Add(1)
+}
+
+func (s *AVSyncCorrector) dispatchSilence(src *avutil.Frame, d Descriptor, m *UnitMetadata) error {
+	// Create frame
+	f := s.p.get()
+	defer s.p.put(f)
+	if ret := C.astilibav_av_sync_corrector_silence((*C.AVFrame)(unsafe.Pointer(f)), (*C.AVFrame)(unsafe.Pointer(src))); ret < 0 {
+		return fmt.Errorf("astilibav: creating silence failed: %w", NewAvError(int(ret)))
+	}
+
+	// Dispatch frame
+	s.audio.d.dispatch(f, d, m)
+	return nil
+}
+
+type avSyncCorrectorStat struct {
+	s *AVSyncCorrector
+}
+
+func newAVSyncCorrectorStat(s *AVSyncCorrector) *avSyncCorrectorStat {
+	return &avSyncCorrectorStat{s: s}
+}
+
+// Start implements the astikit.StatHandler interface
+func (s *avSyncCorrectorStat) Start() {}
+
+// Stop implements the astikit.StatHandler interface
+func (s *avSyncCorrectorStat) Stop() {}
+
+// Value implements the astikit.StatHandler interface
+func (s *avSyncCorrectorStat) Value(delta time.Duration) interface{} {
+	d, _ := s.s.Drift()
+	return float64(d) / float64(time.Millisecond)
+}
+
+// avSyncCorrection returns 1 if the corrected branch must be delayed by one unit, which means either duplicating a
+// video frame or inserting silence, -1 if it must be advanced by one unit, which means either dropping a video frame
+// or trimming audio, and 0 if nothing must be done
+func avSyncCorrection(drift, threshold time.Duration, mode string) int {
+	// Drift is acceptable
+	if drift <= threshold && drift >= -threshold {
+		return 0
+	}
+
+	// Audio is ahead when drift is positive
+	c := 1
+	if drift < 0 {
+		c = -1
+	}
+	if mode == AVSyncCorrectorModeAudio {
+		c = -c
+	}
+	return c
+}
+
+type avSyncTracker struct {
+	audio avSyncBranch
+	video avSyncBranch
+}
+
+func newAVSyncTracker() *avSyncTracker {
+	return &avSyncTracker{}
+}
+
+func (t *avSyncTracker) drift() (time.Duration, bool) {
+	if !t.audio.ok || !t.video.ok {
+		return 0, false
+	}
+	return time.Duration(t.audio.offset - t.video.offset), true
+}
+
+type avSyncBranch struct {
+	// Duration added to the pts of outgoing units
+	correction time.Duration
+	// Smoothed difference between the corrected pts and the time elapsed since the first unit
+	offset float64
+	ok     bool
+}
+
+func (b *avSyncBranch) add(pts, elapsed time.Duration) {
+	o := float64(pts + b.correction - elapsed)
+	if !b.ok {
+		b.offset, b.ok = o, true
+		return
+	}
+	b.offset += avSyncCorrectorSmoothing * (o - b.offset)
+}
+
+func (b *avSyncBranch) correct(d time.Duration) {
+	b.correction += d
+	b.offset += float64(d)
+}
@@ -0,0 +1,44 @@
+package astilibav
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAVSyncCorrection(t *testing.T) {
+	th := 40 * time.Millisecond
+	assert.Equal(t, 0, avSyncCorrection(40*time.Millisecond, th, AVSyncCorrectorModeVideo))
+	assert.Equal(t, 0, avSyncCorrection(-40*time.Millisecond, th, AVSyncCorrectorModeAudio))
+	assert.Equal(t, 1, avSyncCorrection(50*time.Millisecond, th, AVSyncCorrectorModeVideo))
+	assert.Equal(t, -1, avSyncCorrection(-50*time.Millisecond, th, AVSyncCorrectorModeVideo))
+	assert.Equal(t, -1, avSyncCorrection(50*time.Millisecond, th, AVSyncCorrectorModeAudio))
+	assert.Equal(t, 1, avSyncCorrection(-50*time.Millisecond, th, AVSyncCorrectorModeAudio))
+}
+
+func TestAVSyncTracker(t *testing.T) {
+	tr := newAVSyncTracker()
+	_, ok := tr.drift()
+	assert.False(t, ok)
+
+	// Audio is ahead
+	tr.audio.add(10*time.Second+100*time.Millisecond, 0)
+	tr.video.add(10*time.Second, 0)
+	d, ok := tr.drift()
+	assert.True(t, ok)
+	assert.Equal(t, 100*time.Millisecond, d)
+
+	// Offsets are smoothed
+	tr.audio.add(11*time.Second, time.Second)
+	d, _ = tr.drift()
+	assert.Equal(t, 95*time.Millisecond, d)
+
+	// Correction
+	tr.video.correct(40 * time.Millisecond)
+	d, _ = tr.drift()
+	assert.Equal(t, 55*time.Millisecond, d)
+	tr.video.add(11*time.Second, time.Second)
+	d, _ = tr.drift()
+	assert.Equal(t, 55*time.Millisecond, d)
+}
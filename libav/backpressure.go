@@ -0,0 +1,280 @@
+package astilibav
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/asticode/go-astiencoder"
+)
+
+// BackpressureThreshold is the duration after which a node waiting for its children to process the previous
+// frame or pkt emits a backpressure event. If <= 0, backpressure events are disabled
+var BackpressureThreshold = 5 * time.Second
+
+// Trackers are registered the first time they wait, indexed by node name, which keeps the global mutex off the hot path
+// They're unregistered when their node stops
+var (
+	backpressureMutex    = &sync.Mutex{}
+	backpressureTrackers = make(map[string][]*backpressureTracker)
+)
+
+// Backpressure represents a chain of nodes blocked by a downstream bottleneck
+type Backpressure struct {
+	// Last node of the chain, which is busy processing rather than waiting for its own children
+	Bottleneck astiencoder.Node
+	// Nodes from the blocked node to the bottleneck, both included
+	Chain []astiencoder.Node
+	// Duration the blocked node has been waiting for
+	Duration time.Duration
+}
+
+type backpressureTracker struct {
+	eh *astiencoder.EventHandler
+	m  *sync.Mutex
+	n  astiencoder.Node
+	// Indexed by handler name, values are the wrapped nodes
+	pending    map[string]astiencoder.Node
+	registered bool
+	since      time.Time
+	// Reset on each wait
+	tm      *time.Timer
+	waiting bool
+}
+
+func newBackpressureTracker(n astiencoder.Node, eh *astiencoder.EventHandler) *backpressureTracker {
+	return &backpressureTracker{
+		eh:      eh,
+		m:       &sync.Mutex{},
+		n:       n,
+		pending: make(map[string]astiencoder.Node),
+	}
+}
+
+// backpressureNode returns the node wrapped by conditional handlers, whose name is not the one trackers are
+// registered with
+func backpressureNode(n astiencoder.Node) astiencoder.Node {
+	if c, ok := n.(*pktCond); ok {
+		return c.PktHandler
+	}
+	return n
+}
+
+func (t *backpressureTracker) add(n astiencoder.Node) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.pending[n.Metadata().Name] = backpressureNode(n)
+}
+
+func (t *backpressureTracker) done(n astiencoder.Node) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	delete(t.pending, n.Metadata().Name)
+}
+
+func (t *backpressureTracker) pendingNodes() (ns []astiencoder.Node) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	var ks []string
+	for k := range t.pending {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	for _, k := range ks {
+		ns = append(ns, t.pending[k])
+	}
+	return
+}
+
+func (t *backpressureTracker) wait(wg *sync.WaitGroup) {
+	// There's nothing to attribute
+	if t.n == nil || t.eh == nil {
+		wg.Wait()
+		return
+	}
+
+	// Start waiting
+	t.m.Lock()
+	t.register()
+	t.since = time.Now()
+	t.waiting = true
+
+	// Emit events if waiting for too long
+	if d := BackpressureThreshold; d > 0 {
+		if t.tm == nil {
+			t.tm = time.AfterFunc(d, t.emit)
+		} else {
+			t.tm.Reset(d)
+		}
+	}
+	t.m.Unlock()
+
+	// Wait
+	wg.Wait()
+
+	// Stop waiting
+	t.m.Lock()
+	t.waiting = false
+	if t.tm != nil {
+		t.tm.Stop()
+	}
+	t.m.Unlock()
+}
+
+// register must be called while holding t.m
+func (t *backpressureTracker) register() {
+	// Tracker is already registered
+	if t.registered {
+		return
+	}
+	t.registered = true
+
+	// Register
+	name := t.n.Metadata().Name
+	backpressureMutex.Lock()
+	backpressureTrackers[name] = append(backpressureTrackers[name], t)
+	backpressureMutex.Unlock()
+
+	// Unregister when the node stops
+	t.eh.Add(t.n, astiencoder.EventNameNodeStopped, func(astiencoder.Event) bool {
+		t.unregister()
+		return true
+	})
+}
+
+func (t *backpressureTracker) unregister() {
+	// Update tracker
+	t.m.Lock()
+	t.registered = false
+	t.waiting = false
+	if t.tm != nil {
+		t.tm.Stop()
+	}
+	t.m.Unlock()
+
+	// Unregister
+	name := t.n.Metadata().Name
+	backpressureMutex.Lock()
+	defer backpressureMutex.Unlock()
+	ts := backpressureTrackers[name][:0]
+	for _, v := range backpressureTrackers[name] {
+		if v != t {
+			ts = append(ts, v)
+		}
+	}
+	if len(ts) == 0 {
+		delete(backpressureTrackers, name)
+	} else {
+		backpressureTrackers[name] = ts
+	}
+}
+
+func (t *backpressureTracker) isWaiting() (since time.Time, ok bool) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	return t.since, t.waiting
+}
+
+func (t *backpressureTracker) emit() {
+	// Timer has fired for a previous wait
+	since, ok := t.isWaiting()
+	if !ok {
+		return
+	}
+	d := time.Since(since)
+	if d < BackpressureThreshold {
+		return
+	}
+
+	// Loop through chains
+	for _, c := range backpressureChains(t, backpressureTracked) {
+		t.eh.Emit(astiencoder.Event{
+			Name: EventNameBackpressure,
+			Payload: Backpressure{
+				Bottleneck: c[len(c)-1],
+				Chain:      c,
+				Duration:   d,
+			},
+			Target: t.n,
+		})
+	}
+}
+
+type backpressureWait struct {
+	n       astiencoder.Node
+	pending []astiencoder.Node
+	since   time.Time
+}
+
+// backpressureWaits returns a snapshot of the nodes currently waiting for their children
+func backpressureWaits() (ws []backpressureWait) {
+	// Copy trackers
+	backpressureMutex.Lock()
+	var ts []*backpressureTracker
+	for _, v := range backpressureTrackers {
+		ts = append(ts, v...)
+	}
+	backpressureMutex.Unlock()
+
+	// Loop through trackers
+	for _, t := range ts {
+		// Tracker is not waiting
+		since, ok := t.isWaiting()
+		if !ok {
+			continue
+		}
+		ws = append(ws, backpressureWait{
+			n:       t.n,
+			pending: t.pendingNodes(),
+			since:   since,
+		})
+	}
+
+	// Sort
+	sort.Slice(ws, func(i, j int) bool { return ws[i].n.Metadata().Name < ws[j].n.Metadata().Name })
+	return
+}
+
+// backpressureTracked returns the first tracker of the node that is currently waiting
+func backpressureTracked(name string) (t *backpressureTracker, ok bool) {
+	// Copy trackers
+	backpressureMutex.Lock()
+	ts := append([]*backpressureTracker{}, backpressureTrackers[name]...)
+	backpressureMutex.Unlock()
+
+	// Loop through trackers
+	for _, t = range ts {
+		if _, ok = t.isWaiting(); ok {
+			return
+		}
+	}
+	return nil, false
+}
+
+// backpressureChains walks pending children down to the nodes that are not waiting themselves
+func backpressureChains(t *backpressureTracker, tracked func(name string) (*backpressureTracker, bool)) (cs [][]astiencoder.Node) {
+	visited := map[string]bool{t.n.Metadata().Name: true}
+	var walk func(t *backpressureTracker, chain []astiencoder.Node)
+	walk = func(t *backpressureTracker, chain []astiencoder.Node) {
+		for _, n := range t.pendingNodes() {
+			// Copy chain since it's shared between siblings
+			c := append(append([]astiencoder.Node{}, chain...), n)
+
+			// Child is waiting as well
+			name := n.Metadata().Name
+			if ct, ok := tracked(name); ok && !visited[name] {
+				visited[name] = true
+				l := len(cs)
+				walk(ct, c)
+				if len(cs) > l {
+					continue
+				}
+			}
+
+			// Child is the bottleneck
+			cs = append(cs, c)
+		}
+	}
+	walk(t, []astiencoder.Node{t.n})
+	return
+}
@@ -0,0 +1,64 @@
+package astilibav
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockedNode struct {
+	*astiencoder.BaseNode
+}
+
+func newMockedNode(name string) *mockedNode {
+	n := &mockedNode{}
+	n.BaseNode = astiencoder.NewBaseNode(astiencoder.NodeOptions{Metadata: astiencoder.NodeMetadata{Name: name}}, astiencoder.NewEventGeneratorNode(n), astiencoder.NewEventHandler())
+	return n
+}
+
+func (n *mockedNode) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {}
+
+func TestBackpressureChains(t *testing.T) {
+	// demuxer -> decoder -> encoder -> muxer
+	//                    -> hasher
+	demuxer, decoder, encoder, muxer, hasher := newMockedNode("demuxer"), newMockedNode("decoder"), newMockedNode("encoder"), newMockedNode("muxer"), newMockedNode("hasher")
+	tDemuxer, tDecoder, tEncoder := newBackpressureTracker(demuxer, nil), newBackpressureTracker(decoder, nil), newBackpressureTracker(encoder, nil)
+	tDemuxer.add(decoder)
+	tDecoder.add(encoder)
+	tDecoder.add(hasher)
+	tEncoder.add(muxer)
+	ts := map[string]*backpressureTracker{"decoder": tDecoder, "encoder": tEncoder}
+	tracked := func(name string) (t *backpressureTracker, ok bool) {
+		t, ok = ts[name]
+		return
+	}
+	assert.Equal(t, [][]astiencoder.Node{
+		{demuxer, decoder, encoder, muxer},
+		{demuxer, decoder, hasher},
+	}, backpressureChains(tDemuxer, tracked))
+
+	// Muxer is done but encoder is still registered
+	tEncoder.done(muxer)
+	assert.Equal(t, [][]astiencoder.Node{
+		{demuxer, decoder, encoder},
+		{demuxer, decoder, hasher},
+	}, backpressureChains(tDemuxer, tracked))
+}
+
+func TestBackpressureTrackerUnregister(t *testing.T) {
+	n := newMockedNode("backpressure_unregister")
+	eh := astiencoder.NewEventHandler()
+	bt := newBackpressureTracker(n, eh)
+	bt.wait(&sync.WaitGroup{})
+	backpressureMutex.Lock()
+	assert.Len(t, backpressureTrackers[n.Metadata().Name], 1)
+	backpressureMutex.Unlock()
+	eh.Emit(astiencoder.Event{Name: astiencoder.EventNameNodeStopped, Target: n})
+	backpressureMutex.Lock()
+	_, ok := backpressureTrackers[n.Metadata().Name]
+	backpressureMutex.Unlock()
+	assert.False(t, ok)
+}
@@ -0,0 +1,62 @@
+package astilibav
+
+import (
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avutil"
+)
+
+// bindings gathers the frame and pkt lifecycle calls, which are shared by all nodes
+// Nodes should go through it instead of calling the bindings directly for those calls only. It still relies on goav
+// types, and codec, format and filter calls are still made directly on goav, therefore it doesn't abstract the
+// bindings away: it only limits what a change in the alloc/ref/unref/free semantics of the bindings would impact
+type bindings interface {
+	frameAlloc() *avutil.Frame
+	frameFree(f *avutil.Frame)
+	frameMoveRef(dst, src *avutil.Frame)
+	frameRef(dst, src *avutil.Frame) int
+	frameUnref(f *avutil.Frame)
+	pktAlloc() *avcodec.Packet
+	pktFree(pkt *avcodec.Packet)
+	pktRef(dst, src *avcodec.Packet) int
+	pktUnref(pkt *avcodec.Packet)
+}
+
+var defaultBindings bindings = goavBindings{}
+
+type goavBindings struct{}
+
+func (goavBindings) frameAlloc() *avutil.Frame {
+	return avutil.AvFrameAlloc()
+}
+
+func (goavBindings) frameFree(f *avutil.Frame) {
+	avutil.AvFrameFree(f)
+}
+
+func (goavBindings) frameMoveRef(dst, src *avutil.Frame) {
+	avutil.AvFrameMoveRef(dst, src)
+}
+
+func (goavBindings) frameRef(dst, src *avutil.Frame) int {
+	return avutil.AvFrameRef(dst, src)
+}
+
+func (goavBindings) frameUnref(f *avutil.Frame) {
+	avutil.AvFrameUnref(f)
+}
+
+func (goavBindings) pktAlloc() *avcodec.Packet {
+	return avcodec.AvPacketAlloc()
+}
+
+func (goavBindings) pktFree(pkt *avcodec.Packet) {
+	avcodec.AvPacketFree(pkt)
+}
+
+func (goavBindings) pktRef(dst, src *avcodec.Packet) int {
+	return dst.AvPacketRef(src)
+}
+
+func (goavBindings) pktUnref(pkt *avcodec.Packet) {
+	pkt.AvPacketUnref()
+}
@@ -0,0 +1,307 @@
+package astilibav
+
+//#cgo pkg-config: libavcodec libavutil
+//#include <stdlib.h>
+//#include <libavcodec/avcodec.h>
+//// Bitstream filters have been moved to their own header in libavcodec 59 (ffmpeg 5.0)
+//#if LIBAVCODEC_VERSION_MAJOR >= 59
+//#include <libavcodec/bsf.h>
+//#endif
+//static int astilibav_bsf_init(AVBSFContext **ctx, const char *filters, const AVCodecParameters *par, AVRational tb) {
+//	int ret = av_bsf_list_parse_str(filters, ctx);
+//	if (ret < 0) return ret;
+//	if ((ret = avcodec_parameters_copy((*ctx)->par_in, par)) < 0) goto fail;
+//	(*ctx)->time_base_in = tb;
+//	if ((ret = av_bsf_init(*ctx)) < 0) goto fail;
+//	return 0;
+//fail:
+//	av_bsf_free(ctx);
+//	return ret;
+//}
+import "C"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avformat"
+	"github.com/asticode/goav/avutil"
+)
+
+var countBitstreamFilterer uint64
+
+// BitstreamFilterer represents an object capable of passing packets through bitstream filters, such as
+// "h264_mp4toannexb" or "aac_adtstoasc", which many container/codec combinations require
+// Since filters may update the codec parameters, output streams must be added with AddStream
+type BitstreamFilterer struct {
+	*astiencoder.BaseNode
+	c                *astikit.Chan
+	ctx              *C.AVBSFContext
+	d                *pktDispatcher
+	eh               *astiencoder.EventHandler
+	flushed          bool
+	p                *pktPool
+	previous         Descriptor
+	statIncomingRate *astikit.CounterAvgStat
+	statWorkRatio    *astikit.DurationPercentageStat
+}
+
+// BitstreamFiltererOptions represents bitstream filterer options
+type BitstreamFiltererOptions struct {
+	// Comma separated list of filters with their options, such as "h264_mp4toannexb" or
+	// "hevc_metadata=level=5.1,dump_extra". If empty, pkts are passed through
+	Filters string
+	// Stream whose pkts are filtered, which is either a demuxer stream or a stream added with Encoder.AddStream
+	Input *avformat.Stream
+	Node  astiencoder.NodeOptions
+}
+
+// NewBitstreamFilterer creates a new bitstream filterer
+func NewBitstreamFilterer(o BitstreamFiltererOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (f *BitstreamFilterer, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countBitstreamFilterer, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("bitstream_filterer_%d", count), fmt.Sprintf("Bitstream Filterer #%d", count), "Filters bitstream")
+
+	// No input
+	if o.Input == nil {
+		err = errors.New("astilibav: no input provided")
+		return
+	}
+
+	// Create bitstream filterer
+	f = &BitstreamFilterer{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh:               eh,
+		p:                newPktPool(c),
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statWorkRatio:    astikit.NewDurationPercentageStat(),
+	}
+	f.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(f), eh)
+	f.d = newPktDispatcher(f, eh, c)
+	f.addStats()
+
+	// Init filters
+	filters := C.CString(o.Filters)
+	defer C.free(unsafe.Pointer(filters))
+	tb := o.Input.TimeBase()
+	if ret := C.astilibav_bsf_init(&f.ctx, filters, (*C.AVCodecParameters)(unsafe.Pointer(o.Input.CodecParameters())), C.AVRational{num: C.int(tb.Num()), den: C.int(tb.Den())}); ret < 0 {
+		err = fmt.Errorf("astilibav: initializing bitstream filters %s failed: %w", o.Filters, NewAvError(int(ret)))
+		return
+	}
+
+	// Make sure the ctx is freed
+	c.Add(func() error {
+		C.av_bsf_free(&f.ctx)
+		return nil
+	})
+	return
+}
+
+func (f *BitstreamFilterer) addStats() {
+	// Add incoming rate
+	f.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of packets coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "pps",
+	}, f.statIncomingRate)
+
+	// Add work ratio
+	f.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, f.statWorkRatio)
+
+	// Add dispatcher stats
+	f.d.addStats(f.Stater())
+
+	// Add chan stats
+	f.c.AddStats(f.Stater())
+}
+
+// AddStream adds a stream with the output codec parameters and time base of the filters
+func (f *BitstreamFilterer) AddStream(ctxFormat *avformat.Context) (o *avformat.Stream, err error) {
+	// Add stream
+	o = AddStream(ctxFormat)
+
+	// Copy codec parameters
+	if ret := C.avcodec_parameters_copy((*C.AVCodecParameters)(unsafe.Pointer(o.CodecParameters())), f.ctx.par_out); ret < 0 {
+		err = fmt.Errorf("astilibav: avcodec_parameters_copy failed: %w", NewAvError(int(ret)))
+		return
+	}
+
+	// Reset codec tag so that the muxer picks its own
+	o.CodecParameters().SetCodecTag(0)
+
+	// Set other attributes
+	o.SetTimeBase(f.timeBase())
+	return
+}
+
+func (f *BitstreamFilterer) timeBase() avutil.Rational {
+	return avutil.NewRational(int(f.ctx.time_base_out.num), int(f.ctx.time_base_out.den))
+}
+
+// Connect implements the PktHandlerConnector interface
+func (f *BitstreamFilterer) Connect(h PktHandler) {
+	// Add handler
+	f.d.addHandler(h)
+
+	// Connect nodes
+	astiencoder.ConnectNodes(f, h)
+}
+
+// Disconnect implements the PktHandlerConnector interface
+func (f *BitstreamFilterer) Disconnect(h PktHandler) {
+	// Delete handler
+	f.d.delHandler(h)
+
+	// Disconnect nodes
+	astiencoder.DisconnectNodes(f, h)
+}
+
+// Start starts the bitstream filterer
+func (f *BitstreamFilterer) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	f.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to wait for all dispatcher subprocesses to be done so that they are properly closed
+		defer f.d.wait()
+
+		// Make sure to flush the filters
+		defer f.flush()
+
+		// Make sure to stop the chan properly
+		defer f.c.Stop()
+
+		// Start chan
+		f.c.Start(f.Context())
+	})
+}
+
+func (f *BitstreamFilterer) flush() {
+	// Filters can only be flushed once
+	if f.flushed {
+		return
+	}
+	f.flushed = true
+	f.filter(&PktHandlerPayload{})
+}
+
+// HandleEOS implements the EOSHandler interface
+func (f *BitstreamFilterer) HandleEOS(p *EOSHandlerPayload) {
+	f.c.Add(func() {
+		// Drain pkts
+		f.flush()
+
+		// Forward end of stream
+		f.d.dispatchEOS()
+	})
+}
+
+// HandlePkt implements the PktHandler interface
+func (f *BitstreamFilterer) HandlePkt(p *PktHandlerPayload) {
+	f.c.Add(func() {
+		// Handle pause
+		defer f.HandlePause()
+
+		// Increment incoming rate
+		f.statIncomingRate.Add(1)
+
+		// Filter
+		f.filter(p)
+	})
+}
+
+func (f *BitstreamFilterer) filter(p *PktHandlerPayload) {
+	// Copy pkt since filters take ownership of its data
+	var pkt *avcodec.Packet
+	if p.Pkt != nil {
+		pkt = f.p.get()
+		defer f.p.put(pkt)
+		if ret := defaultBindings.pktRef(pkt, p.Pkt); ret < 0 {
+			emitAvError(f, f.eh, ret, "pkt.AvPacketRef failed")
+			return
+		}
+	}
+
+	// Send pkt to filters
+	// A nil pkt flushes them
+	f.statWorkRatio.Begin()
+	if ret := C.av_bsf_send_packet(f.ctx, (*C.AVPacket)(unsafe.Pointer(pkt))); ret < 0 {
+		f.statWorkRatio.End()
+		emitAvError(f, f.eh, int(ret), "av_bsf_send_packet failed")
+		return
+	}
+	f.statWorkRatio.End()
+
+	// Get descriptor
+	d := p.Descriptor
+	if d == nil && f.previous == nil {
+		return
+	} else if d == nil {
+		d = f.previous
+	} else {
+		f.previous = d
+	}
+
+	// Loop
+	for {
+		// Receive pkt
+		if stop := f.receivePkt(d, p.Metadata); stop {
+			return
+		}
+	}
+}
+
+func (f *BitstreamFilterer) receivePkt(d Descriptor, m *UnitMetadata) (stop bool) {
+	// Get pkt from pool
+	pkt := f.p.get()
+	defer f.p.put(pkt)
+
+	// Receive pkt
+	f.statWorkRatio.Begin()
+	if ret := int(C.av_bsf_receive_packet(f.ctx, (*C.AVPacket)(unsafe.Pointer(pkt)))); ret < 0 {
+		f.statWorkRatio.End()
+		if ret != avutil.AVERROR_EOF && ret != avutil.AVERROR_EAGAIN {
+			emitAvError(f, f.eh, ret, "av_bsf_receive_packet failed")
+		}
+		stop = true
+		return
+	}
+	f.statWorkRatio.End()
+
+	// Dispatch pkt
+	f.d.dispatch(pkt, newBitstreamFiltererDescriptor(d, f.timeBase()), m)
+	return
+}
+
+type bitstreamFiltererDescriptor struct {
+	prev     Descriptor
+	timeBase avutil.Rational
+}
+
+func newBitstreamFiltererDescriptor(prev Descriptor, timeBase avutil.Rational) *bitstreamFiltererDescriptor {
+	return &bitstreamFiltererDescriptor{
+		prev:     prev,
+		timeBase: timeBase,
+	}
+}
+
+// TimeBase implements the Descriptor interface
+func (d *bitstreamFiltererDescriptor) TimeBase() avutil.Rational {
+	return d.timeBase
+}
+
+// StreamDescriptor implements the StreamDescriber interface
+func (d *bitstreamFiltererDescriptor) StreamDescriptor() (sd StreamDescriptor) {
+	sd, _ = DescriptorStream(d.prev)
+	sd.ctx.TimeBase = d.timeBase
+	return
+}
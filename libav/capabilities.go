@@ -0,0 +1,86 @@
+package astilibav
+
+//#cgo pkg-config: libavformat
+//#include <libavformat/avio.h>
+import "C"
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avfilter"
+)
+
+// Capabilities represents the optional capabilities available at runtime
+// Capabilities provided by ffmpeg depend on how it has been configured whereas capabilities provided by this package
+// depend on build tags
+type Capabilities struct {
+	// Requires the "chromaprint" build tag
+	Chromaprint bool
+	// Requires ffmpeg to be configured with --enable-libass
+	LibASS bool
+	// Requires ffmpeg to be configured with --enable-libvmaf
+	LibVMAF bool
+	// Requires ffmpeg to be configured with --enable-nvenc
+	NVENC bool
+	// Requires ffmpeg to be configured with --enable-libsrt
+	SRT bool
+}
+
+// DetectCapabilities detects the optional capabilities available at runtime
+func DetectCapabilities() Capabilities {
+	return Capabilities{
+		Chromaprint: capabilityChromaprint,
+		LibASS:      HasFilter("subtitles") && HasFilter("ass"),
+		LibVMAF:     HasFilter("libvmaf"),
+		NVENC:       HasEncoder("h264_nvenc") || HasEncoder("hevc_nvenc"),
+		SRT:         HasProtocol("srt"),
+	}
+}
+
+// String implements the Stringer interface
+func (c Capabilities) String() string {
+	return fmt.Sprintf(`chromaprint: %v
+libass: %v
+libvmaf: %v
+nvenc: %v
+srt: %v
+`, c.Chromaprint, c.LibASS, c.LibVMAF, c.NVENC, c.SRT)
+}
+
+// HasDecoder checks whether a decoder is available
+func HasDecoder(name string) bool {
+	return avcodec.AvcodecFindDecoderByName(name) != nil
+}
+
+// HasEncoder checks whether an encoder is available
+func HasEncoder(name string) bool {
+	return avcodec.AvcodecFindEncoderByName(name) != nil
+}
+
+// HasFilter checks whether a filter is available
+func HasFilter(name string) bool {
+	return avfilter.AvfilterGetByName(name) != nil
+}
+
+// HasProtocol checks whether a protocol is available both for input and output
+func HasProtocol(name string) bool {
+	for _, output := range []C.int{0, 1} {
+		var found bool
+		var opaque unsafe.Pointer
+		for {
+			p := C.avio_enum_protocols(&opaque, output)
+			if p == nil {
+				break
+			}
+			if C.GoString(p) == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
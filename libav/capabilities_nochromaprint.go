@@ -0,0 +1,6 @@
+//go:build !chromaprint
+// +build !chromaprint
+
+package astilibav
+
+const capabilityChromaprint = false
@@ -0,0 +1,49 @@
+package astilibav
+
+//#cgo pkg-config: libavformat
+//#include <libavformat/avformat.h>
+import "C"
+import (
+	"time"
+	"unsafe"
+
+	"github.com/asticode/goav/avformat"
+	"github.com/asticode/goav/avutil"
+)
+
+// Chapter represents a chapter
+type Chapter struct {
+	End   time.Duration
+	ID    int
+	Start time.Duration
+	Title string
+}
+
+func chaptersFromCtxFormat(ctxFormat *avformat.Context) (cs []Chapter) {
+	// No chapters
+	c := (*C.struct_AVFormatContext)(unsafe.Pointer(ctxFormat))
+	n := int(c.nb_chapters)
+	if n == 0 {
+		return
+	}
+
+	// Loop through chapters
+	for _, ch := range (*[1 << 20]*C.struct_AVChapter)(unsafe.Pointer(c.chapters))[:n:n] {
+		// Create chapter
+		tb := avutil.NewRational(int(ch.time_base.num), int(ch.time_base.den))
+		o := Chapter{
+			End:   time.Duration(avutil.AvRescaleQ(int64(ch.end), tb, nanosecondRational)),
+			ID:    int(ch.id),
+			Start: time.Duration(avutil.AvRescaleQ(int64(ch.start), tb, nanosecondRational)),
+		}
+
+		// Get title
+		if e := avutil.AvDictGet((*avutil.Dictionary)(unsafe.Pointer(ch.metadata)), "title", nil, 0); e != nil {
+			o.Title = e.Value()
+		}
+
+		// Append
+		cs = append(cs, o)
+	}
+	return
+}
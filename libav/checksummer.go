@@ -0,0 +1,273 @@
+package astilibav
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/adler32"
+	"io"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+)
+
+var countChecksummer uint64
+
+// Checksum algorithms
+const (
+	// Same as ffmpeg's framecrc muxer
+	ChecksumAlgorithmAdler32 = "adler32"
+	// Same as ffmpeg's framemd5 muxer
+	ChecksumAlgorithmMD5 = "md5"
+)
+
+// Checksummer represents an object capable of writing a framemd5/framecrc compatible report of packets or frames
+// Since streams are discovered on the fly, stream headers are written before the first line of each stream
+type Checksummer struct {
+	*astiencoder.BaseNode
+	c                *astikit.Chan
+	eh               *astiencoder.EventHandler
+	headerWritten    bool
+	o                ChecksummerOptions
+	ss               map[int]bool
+	statIncomingRate *astikit.CounterAvgStat
+	statWorkRatio    *astikit.DurationPercentageStat
+}
+
+// ChecksummerOptions represents checksummer options
+type ChecksummerOptions struct {
+	// Defaults to md5
+	Algorithm string
+	Node      astiencoder.NodeOptions
+	Writer    io.Writer
+}
+
+// NewChecksummer creates a new checksummer
+func NewChecksummer(o ChecksummerOptions, eh *astiencoder.EventHandler) (c *Checksummer, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countChecksummer, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("checksummer_%d", count), fmt.Sprintf("Checksummer #%d", count), "Checksums")
+
+	// Default values
+	if o.Algorithm == "" {
+		o.Algorithm = ChecksumAlgorithmMD5
+	}
+
+	// Create checksummer
+	c = &Checksummer{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh:               eh,
+		o:                o,
+		ss:               make(map[int]bool),
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statWorkRatio:    astikit.NewDurationPercentageStat(),
+	}
+	c.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(c), eh)
+	c.addStats()
+
+	// Check algorithm
+	switch o.Algorithm {
+	case ChecksumAlgorithmAdler32, ChecksumAlgorithmMD5:
+	default:
+		err = fmt.Errorf("astilibav: invalid algorithm %s", o.Algorithm)
+		return
+	}
+
+	// No writer
+	if o.Writer == nil {
+		err = errors.New("astilibav: no writer provided")
+		return
+	}
+	return
+}
+
+func (c *Checksummer) addStats() {
+	// Add incoming rate
+	c.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of packets or frames coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "ps",
+	}, c.statIncomingRate)
+
+	// Add work ratio
+	c.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, c.statWorkRatio)
+
+	// Add chan stats
+	c.c.AddStats(c.Stater())
+}
+
+// Start starts the checksummer
+func (c *Checksummer) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	c.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to stop the chan properly
+		defer c.c.Stop()
+
+		// Start chan
+		c.c.Start(c.Context())
+	})
+}
+
+// HandlePkt implements the PktHandler interface
+func (c *Checksummer) HandlePkt(p *PktHandlerPayload) {
+	c.c.Add(func() {
+		// Handle pause
+		defer c.HandlePause()
+
+		// Increment incoming rate
+		c.statIncomingRate.Add(1)
+
+		// Get data
+		var b []byte
+		if p.Pkt.Size() > 0 {
+			b = (*[1 << 30]byte)(unsafe.Pointer(p.Pkt.Data()))[:p.Pkt.Size():p.Pkt.Size()]
+		}
+
+		// Write
+		if err := c.write(checksummerItem{
+			data:      b,
+			dts:       p.Pkt.Dts(),
+			duration:  p.Pkt.Duration(),
+			pts:       p.Pkt.Pts(),
+			streamIdx: p.Pkt.StreamIndex(),
+			timeBase:  p.Descriptor.TimeBase(),
+		}); err != nil {
+			c.eh.Emit(astiencoder.EventError(c, fmt.Errorf("astilibav: writing pkt checksum failed: %w", err)))
+			return
+		}
+	})
+}
+
+// ChecksummerFrameHandler is an object that can handle a frame for the checksummer
+type ChecksummerFrameHandler struct {
+	*Checksummer
+	streamIdx int
+}
+
+// NewFrameHandler creates a new frame handler writing lines for the provided stream index
+func (c *Checksummer) NewFrameHandler(streamIdx int) *ChecksummerFrameHandler {
+	return &ChecksummerFrameHandler{
+		Checksummer: c,
+		streamIdx:   streamIdx,
+	}
+}
+
+// HandleFrame implements the FrameHandler interface
+func (h *ChecksummerFrameHandler) HandleFrame(p *FrameHandlerPayload) {
+	h.c.Add(func() {
+		// Handle pause
+		defer h.HandlePause()
+
+		// Increment incoming rate
+		h.statIncomingRate.Add(1)
+
+		// Get data
+		h.statWorkRatio.Begin()
+		b, err := frameData(p.Frame)
+		h.statWorkRatio.End()
+		if err != nil {
+			h.eh.Emit(astiencoder.EventError(h, fmt.Errorf("astilibav: getting frame data failed: %w", err)))
+			return
+		}
+
+		// Get media type
+		mediaType := "audio"
+		if p.Frame.Width() > 0 && p.Frame.Height() > 0 {
+			mediaType = "video"
+		}
+
+		// Write
+		if err := h.write(checksummerItem{
+			data:      b,
+			dts:       p.Frame.PktDts(),
+			duration:  frameDuration(p.Frame),
+			mediaType: mediaType,
+			pts:       p.Frame.Pts(),
+			streamIdx: h.streamIdx,
+			timeBase:  p.Descriptor.TimeBase(),
+		}); err != nil {
+			h.eh.Emit(astiencoder.EventError(h, fmt.Errorf("astilibav: writing frame checksum failed: %w", err)))
+			return
+		}
+	})
+}
+
+type checksummerItem struct {
+	data      []byte
+	dts       int64
+	duration  int64
+	mediaType string
+	pts       int64
+	streamIdx int
+	timeBase  avutil.Rational
+}
+
+func (c *Checksummer) write(i checksummerItem) (err error) {
+	c.statWorkRatio.Begin()
+	defer c.statWorkRatio.End()
+
+	// Write header
+	if !c.headerWritten {
+		if _, err = fmt.Fprintf(c.o.Writer, "#format: frame checksums\n#version: 2\n#hash: %s\n", checksummerHashName(c.o.Algorithm)); err != nil {
+			err = fmt.Errorf("astilibav: writing header failed: %w", err)
+			return
+		}
+		c.headerWritten = true
+	}
+
+	// Write stream header
+	if !c.ss[i.streamIdx] {
+		h := fmt.Sprintf("#tb %d: %d/%d\n", i.streamIdx, i.timeBase.Num(), i.timeBase.Den())
+		if i.mediaType != "" {
+			h += fmt.Sprintf("#media_type %d: %s\n", i.streamIdx, i.mediaType)
+		}
+		if len(c.ss) == 0 {
+			h += "#stream#, dts,        pts, duration,     size, hash\n"
+		}
+		if _, err = io.WriteString(c.o.Writer, h); err != nil {
+			err = fmt.Errorf("astilibav: writing stream header failed: %w", err)
+			return
+		}
+		c.ss[i.streamIdx] = true
+	}
+
+	// Write line
+	if _, err = io.WriteString(c.o.Writer, checksummerLine(c.o.Algorithm, i)); err != nil {
+		err = fmt.Errorf("astilibav: writing line failed: %w", err)
+		return
+	}
+	return
+}
+
+func checksummerHashName(algorithm string) string {
+	switch algorithm {
+	case ChecksumAlgorithmAdler32:
+		return "adler32"
+	default:
+		return "MD5"
+	}
+}
+
+// checksummerLine formats a line the same way ffmpeg's framehash muxers do
+func checksummerLine(algorithm string, i checksummerItem) string {
+	var h string
+	switch algorithm {
+	case ChecksumAlgorithmAdler32:
+		h = fmt.Sprintf("0x%08x", adler32.Checksum(i.data))
+	default:
+		s := md5.Sum(i.data)
+		h = hex.EncodeToString(s[:])
+	}
+	return fmt.Sprintf("%-2d, %10d, %10d, %8d, %8d, %s\n", i.streamIdx, i.dts, i.pts, i.duration, len(i.data), h)
+}
@@ -0,0 +1,19 @@
+package astilibav
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecksummerLine(t *testing.T) {
+	i := checksummerItem{
+		data:      []byte("test"),
+		dts:       -1,
+		duration:  1,
+		pts:       2,
+		streamIdx: 0,
+	}
+	assert.Equal(t, "0 ,         -1,          2,        1,        4, 098f6bcd4621d373cade4e832627b4f6\n", checksummerLine(ChecksumAlgorithmMD5, i))
+	assert.Equal(t, "0 ,         -1,          2,        1,        4, 0x045d01c1\n", checksummerLine(ChecksumAlgorithmAdler32, i))
+}
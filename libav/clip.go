@@ -0,0 +1,698 @@
+package astilibav
+
+//#cgo pkg-config: libavcodec libavformat
+//#include <libavcodec/avcodec.h>
+//#include <libavformat/avformat.h>
+import "C"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avformat"
+	"github.com/asticode/goav/avutil"
+)
+
+// Clip modes
+const (
+	ClipModeCopy      = "copy"
+	ClipModeSmart     = "smart"
+	ClipModeTranscode = "transcode"
+)
+
+// ClipOptions represents clip options
+type ClipOptions struct {
+	// String content of the demuxer as you would use in ffmpeg
+	Dict string
+	// Options of the demuxer whose values can contain commas. Entries override the ones of Dict
+	Dictionary map[string]string
+	// If 0, the clip ends with the input
+	End time.Duration
+	// If empty, the output format is guessed from the output url
+	FormatName string
+	// If true, only the video GOPs spanning the cut points are transcoded and the rest is copied, which gives frame
+	// accurate cuts at near remux speed. Since the transcoded GOPs carry their own parameter sets, this requires an
+	// output format without global headers such as MPEG-TS. Otherwise it falls back to the regular behavior
+	Smart bool
+	Start time.Duration
+}
+
+// ClipResult represents a clip result
+type ClipResult struct {
+	Mode   string `json:"mode"`
+	Output string `json:"output"`
+}
+
+type clipStream struct {
+	ctxCodecDecoder *avcodec.Context
+	ctxCodecEncoder *avcodec.Context
+	ctxFormat       *avformat.Context
+	done            bool
+	dtsShift        int64
+	end             *int64
+	f               *avutil.Frame
+	i               *avformat.Stream
+	o               *avformat.Stream
+	pkt             *avcodec.Packet
+	smart           *clipSmart
+	start           int64
+	tolerance       int64
+}
+
+// Clip extracts the [start, end[ range of an input into a standalone output
+// Streams are copied when the start lands on a video keyframe. Otherwise the video stream is transcoded with the
+// input's codec and parameters, either entirely or, in smart mode, only around the cut points, whereas the other
+// streams are still copied
+func Clip(input, output string, o ClipOptions) (r ClipResult, err error) {
+	return ClipWithContext(context.Background(), input, output, o)
+}
+
+// ClipWithContext is the same as Clip except that probing, seeking and reading the input are interrupted once the
+// context is done
+func ClipWithContext(ctx context.Context, input, output string, o ClipOptions) (r ClipResult, err error) {
+	// Check options
+	if o.Start < 0 || (o.End > 0 && o.End <= o.Start) {
+		err = fmt.Errorf("astilibav: invalid range [%s, %s[", o.Start, o.End)
+		return
+	}
+
+	// Create closer
+	c := astikit.NewCloser()
+	defer c.Close()
+
+	// Create demuxer
+	eh := astiencoder.NewEventHandler()
+	var d *Demuxer
+	if d, err = NewDemuxer(DemuxerOptions{
+		Dict:              o.Dict,
+		Dictionary:        o.Dictionary,
+		FindStreamInfoCtx: ctx,
+		URL:               input,
+	}, eh, c); err != nil {
+		err = fmt.Errorf("astilibav: creating demuxer failed: %w", err)
+		return
+	}
+
+	// Make sure reading is interrupted once the context is done
+	defer interruptDemuxer(ctx, d)()
+
+	// Create muxer
+	var m *Muxer
+	if m, err = NewMuxer(MuxerOptions{
+		FormatName: o.FormatName,
+		URL:        output,
+	}, eh, c); err != nil {
+		err = fmt.Errorf("astilibav: creating muxer failed: %w", err)
+		return
+	}
+
+	// Get video stream
+	var v *avformat.Stream
+	for _, s := range d.ctxFormat.Streams() {
+		if s.CodecParameters().CodecType() == avutil.AVMEDIA_TYPE_VIDEO {
+			v = s
+			break
+		}
+	}
+
+	// Get mode
+	r = ClipResult{
+		Mode:   ClipModeCopy,
+		Output: output,
+	}
+	var aligned bool
+	if v != nil {
+		if aligned, err = clipKeyFrameAligned(d.ctxFormat, v, o.Start); err != nil {
+			err = fmt.Errorf("astilibav: checking whether start is aligned on a keyframe failed: %w", err)
+			return
+		}
+		if o.Smart && m.ctxFormat.Oformat().Flags()&avformat.AVFMT_GLOBALHEADER == 0 {
+			r.Mode = ClipModeSmart
+		} else if !aligned {
+			r.Mode = ClipModeTranscode
+		}
+	}
+
+	// Loop through streams
+	cs := make(map[int]*clipStream)
+	for _, s := range d.ctxFormat.Streams() {
+		// Only audio, subtitle and video streams are clipped
+		if t := s.CodecParameters().CodecType(); t != avutil.AVMEDIA_TYPE_AUDIO && t != avutil.AVMEDIA_TYPE_SUBTITLE && t != avutil.AVMEDIA_TYPE_VIDEO {
+			continue
+		}
+
+		// Create stream
+		cst := &clipStream{
+			ctxFormat: m.ctxFormat,
+			i:         s,
+			start:     clipTimestamp(o.Start, s),
+			tolerance: clipTolerance(s),
+		}
+		if o.End > 0 {
+			end := clipTimestamp(o.End, s)
+			cst.end = &end
+		}
+
+		// Transcode
+		if s == v && r.Mode == ClipModeTranscode {
+			if err = cst.addTranscoder(eh, c); err != nil {
+				err = fmt.Errorf("astilibav: adding transcoder failed: %w", err)
+				return
+			}
+		} else if cst.o, err = CloneStream(s, m.ctxFormat); err != nil {
+			err = fmt.Errorf("astilibav: cloning stream failed: %w", err)
+			return
+		} else if s == v && r.Mode == ClipModeSmart {
+			cst.addSmart(aligned, eh, c)
+		}
+		cs[s.Index()] = cst
+	}
+
+	// Seek
+	if v != nil {
+		if ret := d.ctxFormat.AvSeekFrame(v.Index(), clipTimestamp(o.Start, v), avformat.AVSEEK_FLAG_BACKWARD); ret < 0 {
+			err = fmt.Errorf("astilibav: ctxFormat.AvSeekFrame on %s failed: %w", input, NewAvError(ret))
+			return
+		}
+	} else if ret := d.ctxFormat.AvSeekFrame(-1, avutil.AvRescaleQ(int64(o.Start), nanosecondRational, avutil.NewRational(1, avutil.AV_TIME_BASE)), avformat.AVSEEK_FLAG_BACKWARD); ret < 0 {
+		err = fmt.Errorf("astilibav: ctxFormat.AvSeekFrame on %s failed: %w", input, NewAvError(ret))
+		return
+	}
+
+	// Write header
+	dict := m.dict
+	ret := m.ctxFormat.AvformatWriteHeader(&dict)
+	m.dict = dict
+	if ret < 0 {
+		err = fmt.Errorf("astilibav: m.ctxFormat.AvformatWriteHeader on %s failed: %w", output, NewAvError(ret))
+		return
+	}
+
+	// Clip
+	if err = clip(d.ctxFormat, cs); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		err = fmt.Errorf("astilibav: clipping failed: %w", err)
+		return
+	}
+
+	// Write trailer
+	if ret := m.ctxFormat.AvWriteTrailer(); ret < 0 {
+		err = fmt.Errorf("astilibav: m.ctxFormat.AvWriteTrailer on %s failed: %w", output, NewAvError(ret))
+		return
+	}
+	return
+}
+
+func clipStartTime(s *avformat.Stream) int64 {
+	if v := int64((*C.struct_AVStream)(unsafe.Pointer(s)).start_time); v != avutil.AV_NOPTS_VALUE {
+		return v
+	}
+	return 0
+}
+
+// clipTimestamp converts a duration relative to the beginning of the input into a stream timestamp
+func clipTimestamp(d time.Duration, s *avformat.Stream) int64 {
+	return clipStartTime(s) + avutil.AvRescaleQ(int64(d), nanosecondRational, s.TimeBase())
+}
+
+// clipTolerance returns half a frame duration in the stream time base, or 1ms if the frame rate is unknown
+func clipTolerance(s *avformat.Stream) int64 {
+	d := time.Millisecond
+	if fr := streamFrameRate(s); fr.Num() > 0 && fr.Den() > 0 {
+		d = time.Duration(int64(time.Second) * int64(fr.Den()) / int64(fr.Num()) / 2)
+	}
+	return avutil.AvRescaleQ(int64(d), nanosecondRational, s.TimeBase())
+}
+
+func clipAligned(pts, ts, tolerance int64) bool {
+	d := pts - ts
+	if d < 0 {
+		d = -d
+	}
+	return d <= tolerance
+}
+
+func clipPktTimestamp(pkt *avcodec.Packet) int64 {
+	if pkt.Pts() != avutil.AV_NOPTS_VALUE {
+		return pkt.Pts()
+	}
+	return pkt.Dts()
+}
+
+// clipKeyFrameAligned checks whether the keyframe preceding the start of the stream is close enough to the start
+func clipKeyFrameAligned(ctxFormat *avformat.Context, s *avformat.Stream, start time.Duration) (aligned bool, err error) {
+	// Seek
+	ts := clipTimestamp(start, s)
+	if ret := ctxFormat.AvSeekFrame(s.Index(), ts, avformat.AVSEEK_FLAG_BACKWARD); ret < 0 {
+		err = fmt.Errorf("astilibav: ctxFormat.AvSeekFrame failed: %w", NewAvError(ret))
+		return
+	}
+
+	// Alloc pkt
+	pkt := defaultBindings.pktAlloc()
+	defer defaultBindings.pktFree(pkt)
+
+	// Loop until the first pkt of the stream
+	for {
+		if ret := ctxFormat.AvReadFrame(pkt); ret < 0 {
+			if ret != avutil.AVERROR_EOF {
+				err = fmt.Errorf("astilibav: ctxFormat.AvReadFrame failed: %w", NewAvError(ret))
+			}
+			return
+		}
+		if pkt.StreamIndex() == s.Index() {
+			break
+		}
+		defaultBindings.pktUnref(pkt)
+	}
+	defer defaultBindings.pktUnref(pkt)
+	return pkt.Flags()&avcodec.AV_PKT_FLAG_KEY > 0 && clipAligned(clipPktTimestamp(pkt), ts, clipTolerance(s)), nil
+}
+
+func (s *clipStream) addTranscoder(eh *astiencoder.EventHandler, c *astikit.Closer) (err error) {
+	// Create decoder
+	var d *Decoder
+	if d, err = NewDecoder(DecoderOptions{CodecParams: s.i.CodecParameters()}, eh, c); err != nil {
+		err = fmt.Errorf("astilibav: creating decoder failed: %w", err)
+		return
+	}
+	s.ctxCodecDecoder = d.ctxCodec
+
+	// Create encoder
+	ctx := NewContextFromStream(s.i)
+	ctx.GlobalHeader = s.ctxFormat.Oformat().Flags()&avformat.AVFMT_GLOBALHEADER > 0
+	var e *Encoder
+	if e, err = NewEncoder(EncoderOptions{Ctx: ctx}, eh, c); err != nil {
+		err = fmt.Errorf("astilibav: creating encoder failed: %w", err)
+		return
+	}
+	s.ctxCodecEncoder = e.ctxCodec
+
+	// Add stream
+	if s.o, err = e.AddStream(s.ctxFormat); err != nil {
+		err = fmt.Errorf("astilibav: adding stream failed: %w", err)
+		return
+	}
+
+	// Alloc frame and pkt
+	s.f = defaultBindings.frameAlloc()
+	s.pkt = defaultBindings.pktAlloc()
+	c.Add(func() error {
+		defaultBindings.frameFree(s.f)
+		defaultBindings.pktFree(s.pkt)
+		return nil
+	})
+	return
+}
+
+func clip(ctxFormat *avformat.Context, cs map[int]*clipStream) (err error) {
+	// Alloc pkt
+	pkt := defaultBindings.pktAlloc()
+	defer defaultBindings.pktFree(pkt)
+
+	// Loop
+	for {
+		// Read pkt
+		if ret := ctxFormat.AvReadFrame(pkt); ret < 0 {
+			if ret != avutil.AVERROR_EOF {
+				err = fmt.Errorf("astilibav: ctxFormat.AvReadFrame failed: %w", NewAvError(ret))
+				return
+			}
+			break
+		}
+
+		// Handle pkt
+		if s, ok := cs[pkt.StreamIndex()]; ok && !s.done {
+			if err = s.handlePkt(pkt); err != nil {
+				defaultBindings.pktUnref(pkt)
+				err = fmt.Errorf("astilibav: handling pkt failed: %w", err)
+				return
+			}
+		}
+		defaultBindings.pktUnref(pkt)
+
+		// All streams are done
+		done := true
+		for _, s := range cs {
+			if !s.done {
+				done = false
+				break
+			}
+		}
+		if done {
+			break
+		}
+	}
+
+	// Flush transcoders
+	for _, s := range cs {
+		if err = s.flush(); err != nil {
+			err = fmt.Errorf("astilibav: flushing failed: %w", err)
+			return
+		}
+	}
+	return
+}
+
+func (s *clipStream) handlePkt(pkt *avcodec.Packet) (err error) {
+	// Smart
+	if s.smart != nil {
+		return s.handleSmartPkt(pkt)
+	}
+
+	// Transcode
+	if s.ctxCodecDecoder != nil {
+		if ret := avcodec.AvcodecSendPacket(s.ctxCodecDecoder, pkt); ret < 0 {
+			err = fmt.Errorf("astilibav: avcodec.AvcodecSendPacket failed: %w", NewAvError(ret))
+			return
+		}
+		return s.receiveFrames()
+	}
+
+	// Pkt is after the end
+	ts := clipPktTimestamp(pkt)
+	if s.end != nil && ts >= *s.end {
+		s.done = true
+		return
+	}
+
+	// Pkt is before the start
+	if ts < s.start-s.tolerance {
+		return
+	}
+
+	// Copy
+	return s.copyPkt(pkt)
+}
+
+func (s *clipStream) copyPkt(pkt *avcodec.Packet) error {
+	// Restamp
+	if pkt.Pts() != avutil.AV_NOPTS_VALUE {
+		pkt.SetPts(pkt.Pts() - s.start)
+	}
+	if pkt.Dts() != avutil.AV_NOPTS_VALUE {
+		pkt.SetDts(pkt.Dts() - s.start)
+	}
+	pkt.AvPacketRescaleTs(s.i.TimeBase(), s.o.TimeBase())
+
+	// Write
+	return s.write(pkt)
+}
+
+func (s *clipStream) write(pkt *avcodec.Packet) error {
+	pkt.SetStreamIndex(s.o.Index())
+	if ret := s.ctxFormat.AvInterleavedWriteFrame((*avformat.Packet)(unsafe.Pointer(pkt))); ret < 0 {
+		return fmt.Errorf("astilibav: ctxFormat.AvInterleavedWriteFrame failed: %w", NewAvError(ret))
+	}
+	return nil
+}
+
+func (s *clipStream) receiveFrames() (err error) {
+	for !s.done {
+		// Receive frame
+		if ret := avcodec.AvcodecReceiveFrame(s.ctxCodecDecoder, s.f); ret < 0 {
+			if ret != avutil.AVERROR_EOF && ret != avutil.AVERROR_EAGAIN {
+				err = fmt.Errorf("astilibav: avcodec.AvcodecReceiveFrame failed: %w", NewAvError(ret))
+			}
+			return
+		}
+
+		// Handle frame
+		err = s.handleFrame()
+		defaultBindings.frameUnref(s.f)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (s *clipStream) handleFrame() error {
+	// Get timestamp
+	ts := int64((*C.struct_AVFrame)(unsafe.Pointer(s.f)).best_effort_timestamp)
+	if ts == avutil.AV_NOPTS_VALUE {
+		return nil
+	}
+
+	// Frame is after the end
+	if s.end != nil && ts >= *s.end {
+		s.done = true
+		return nil
+	}
+
+	// Frame is before the start
+	if ts < s.start {
+		return nil
+	}
+
+	// Restamp and let the encoder decide on the picture type
+	s.f.SetPts(ts - s.start)
+	s.f.SetPictType(avutil.AV_PICTURE_TYPE_NONE)
+
+	// Encode
+	return s.encode(s.f)
+}
+
+func (s *clipStream) encode(f *avutil.Frame) (err error) {
+	// Send frame
+	// A nil frame flushes the encoder
+	if ret := avcodec.AvcodecSendFrame(s.ctxCodecEncoder, f); ret < 0 {
+		err = fmt.Errorf("astilibav: avcodec.AvcodecSendFrame failed: %w", NewAvError(ret))
+		return
+	}
+
+	// Loop
+	for {
+		// Receive pkt
+		if ret := avcodec.AvcodecReceivePacket(s.ctxCodecEncoder, s.pkt); ret < 0 {
+			if ret != avutil.AVERROR_EOF && ret != avutil.AVERROR_EAGAIN {
+				err = fmt.Errorf("astilibav: avcodec.AvcodecReceivePacket failed: %w", NewAvError(ret))
+			}
+			return
+		}
+
+		// Write
+		if s.dtsShift != 0 && s.pkt.Dts() != avutil.AV_NOPTS_VALUE {
+			s.pkt.SetDts(s.pkt.Dts() - s.dtsShift)
+		}
+		s.pkt.AvPacketRescaleTs(s.ctxCodecEncoder.TimeBase(), s.o.TimeBase())
+		if err = s.write(s.pkt); err != nil {
+			defaultBindings.pktUnref(s.pkt)
+			return
+		}
+	}
+}
+
+func (s *clipStream) flush() (err error) {
+	// Smart
+	if s.smart != nil {
+		return s.flushSmart()
+	}
+
+	// Nothing to flush
+	if s.ctxCodecDecoder == nil {
+		return
+	}
+
+	// Flush decoder
+	if !s.done {
+		if ret := avcodec.AvcodecSendPacket(s.ctxCodecDecoder, nil); ret < 0 {
+			err = fmt.Errorf("astilibav: avcodec.AvcodecSendPacket failed: %w", NewAvError(ret))
+			return
+		}
+		if err = s.receiveFrames(); err != nil {
+			err = fmt.Errorf("astilibav: receiving frames failed: %w", err)
+			return
+		}
+	}
+
+	// Flush encoder
+	return s.encode(nil)
+}
+
+const defaultClipHandlerMaxDuration = 10 * time.Minute
+
+// ClipHandlerOptions represents clip handler options
+type ClipHandlerOptions struct {
+	Inputs HTTPInputPolicy
+	// Max duration of the requested clips, whose end must therefore be provided. Defaults to 10m
+	MaxDuration time.Duration
+	// Outputs are written in this dir. If empty, no output is allowed
+	OutputDir string
+}
+
+// ClipHandler returns an http handler extracting a clip and writing the clip result in JSON format
+// It only accepts POST requests whose form values are "input", "output", "start" and "end" as durations such as
+// "1m30s", "format" and "smart". The input must be allowed by the input policy whereas the output is a path relative
+// to the output dir. The end is mandatory and the clip can't be longer than the max duration. The clip is cancelled
+// if the request is
+func ClipHandler(ho ClipHandlerOptions, l astikit.StdLogger) http.Handler {
+	// Default values
+	if ho.MaxDuration <= 0 {
+		ho.MaxDuration = defaultClipHandlerMaxDuration
+	}
+
+	sl := astikit.AdaptStdLogger(l)
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		// Set content type
+		rw.Header().Set("Content-Type", "application/json")
+
+		// Check method
+		if r.Method != http.MethodPost {
+			rw.Header().Set("Allow", http.MethodPost)
+			astiencoder.WriteJSONError(sl, rw, http.StatusMethodNotAllowed, fmt.Errorf("astilibav: method %s is not allowed", r.Method))
+			return
+		}
+
+		// Parse form
+		if err := r.ParseForm(); err != nil {
+			astiencoder.WriteJSONError(sl, rw, http.StatusBadRequest, fmt.Errorf("astilibav: parsing form failed: %w", err))
+			return
+		}
+
+		// Get options
+		input, output, o, err := newClipOptionsFromQuery(r.Form)
+		if err != nil {
+			astiencoder.WriteJSONError(sl, rw, http.StatusBadRequest, fmt.Errorf("astilibav: parsing form failed: %w", err))
+			return
+		}
+
+		// Check duration
+		if err = clipHandlerCheckDuration(o, ho.MaxDuration); err != nil {
+			astiencoder.WriteJSONError(sl, rw, http.StatusBadRequest, fmt.Errorf("astilibav: checking duration failed: %w", err))
+			return
+		}
+
+		// Check input
+		if err = ho.Inputs.Check(input); err != nil {
+			astiencoder.WriteJSONError(sl, rw, http.StatusForbidden, fmt.Errorf("astilibav: checking input failed: %w", err))
+			return
+		}
+
+		// Make sure the resources opened by the input are allowed as well
+		o.Dictionary = ho.Inputs.Dictionary()
+
+		// Get output
+		if output, err = clipHandlerOutput(ho.OutputDir, output); err != nil {
+			astiencoder.WriteJSONError(sl, rw, http.StatusForbidden, fmt.Errorf("astilibav: checking output failed: %w", err))
+			return
+		}
+
+		// Clip
+		var cr ClipResult
+		if cr, err = ClipWithContext(r.Context(), input, output, o); err != nil {
+			astiencoder.WriteJSONError(sl, rw, http.StatusInternalServerError, fmt.Errorf("astilibav: clipping %s failed: %w", input, err))
+			return
+		}
+
+		// Write
+		if err = json.NewEncoder(rw).Encode(cr); err != nil {
+			sl.Error(fmt.Errorf("astilibav: json encoding failed: %w", err))
+			return
+		}
+	})
+}
+
+func clipHandlerCheckDuration(o ClipOptions, max time.Duration) error {
+	// No end
+	if o.End <= 0 {
+		return errors.New("astilibav: no end provided")
+	}
+
+	// Invalid range
+	if o.End <= o.Start {
+		return fmt.Errorf("astilibav: end %s is not after start %s", o.End, o.Start)
+	}
+
+	// Duration is too long
+	if d := o.End - o.Start; d > max {
+		return fmt.Errorf("astilibav: duration %s is longer than %s", d, max)
+	}
+	return nil
+}
+
+// clipHandlerOutput returns the path of the output in the output dir
+func clipHandlerOutput(dir, output string) (p string, err error) {
+	// No output dir
+	if dir == "" {
+		err = errors.New("astilibav: no output dir")
+		return
+	}
+
+	// Output must be a relative path that stays in the output dir. Colons are rejected as well since libav would
+	// consider what precedes them as a protocol
+	if filepath.IsAbs(output) || strings.Contains(output, ":") {
+		err = fmt.Errorf("astilibav: output %s is not a relative path", output)
+		return
+	}
+	for _, v := range strings.Split(filepath.ToSlash(output), "/") {
+		if v == ".." {
+			err = fmt.Errorf("astilibav: output %s is outside the output dir", output)
+			return
+		}
+	}
+
+	// Clean
+	c := filepath.Clean(output)
+	if c == "." {
+		err = fmt.Errorf("astilibav: output %s is not a file", output)
+		return
+	}
+	p = filepath.Join(dir, c)
+	return
+}
+
+func newClipOptionsFromQuery(q url.Values) (input, output string, o ClipOptions, err error) {
+	// Get input
+	if input = q.Get("input"); input == "" {
+		err = errors.New("astilibav: no input provided")
+		return
+	}
+
+	// Get output
+	if output = q.Get("output"); output == "" {
+		err = errors.New("astilibav: no output provided")
+		return
+	}
+
+	// Get start
+	if v := q.Get("start"); v != "" {
+		if o.Start, err = time.ParseDuration(v); err != nil {
+			err = fmt.Errorf("astilibav: parsing start %s failed: %w", v, err)
+			return
+		}
+	}
+
+	// Get end
+	if v := q.Get("end"); v != "" {
+		if o.End, err = time.ParseDuration(v); err != nil {
+			err = fmt.Errorf("astilibav: parsing end %s failed: %w", v, err)
+			return
+		}
+	}
+
+	// Get smart
+	if v := q.Get("smart"); v != "" {
+		if o.Smart, err = strconv.ParseBool(v); err != nil {
+			err = fmt.Errorf("astilibav: parsing smart %s failed: %w", v, err)
+			return
+		}
+	}
+
+	// Get format
+	o.FormatName = q.Get("format")
+	return
+}
@@ -0,0 +1,264 @@
+package astilibav
+
+import (
+	"fmt"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avutil"
+)
+
+// clipSmart transcodes the GOP spanning the start, until the next keyframe, and the GOP spanning the end, which
+// requires buffering the current GOP when an end is provided. Everything in between is copied
+type clipSmart struct {
+	aligned bool
+	c       *astikit.Closer
+	eh      *astiencoder.EventHandler
+	gop     []*avcodec.Packet
+	head    bool
+	started bool
+}
+
+func (s *clipStream) addSmart(aligned bool, eh *astiencoder.EventHandler, c *astikit.Closer) {
+	s.smart = &clipSmart{
+		aligned: aligned,
+		c:       c,
+		eh:      eh,
+	}
+}
+
+// openSmartTranscoder creates a new decoder and a new encoder since encoders can't be reused once flushed
+// B frames are disabled and encoded dts are shifted by the delay of the input keyframe so that dts remain
+// monotonic when switching between encoded and copied pkts
+func (s *clipStream) openSmartTranscoder(keyFrame *avcodec.Packet) (err error) {
+	// Create decoder
+	var d *Decoder
+	if d, err = NewDecoder(DecoderOptions{CodecParams: s.i.CodecParameters()}, s.smart.eh, s.smart.c); err != nil {
+		err = fmt.Errorf("astilibav: creating decoder failed: %w", err)
+		return
+	}
+	s.ctxCodecDecoder = d.ctxCodec
+
+	// Create encoder
+	// Parameter sets must be in-band
+	ctx := NewContextFromStream(s.i)
+	ctx.Dict = "bf=0"
+	var e *Encoder
+	if e, err = NewEncoder(EncoderOptions{Ctx: ctx}, s.smart.eh, s.smart.c); err != nil {
+		err = fmt.Errorf("astilibav: creating encoder failed: %w", err)
+		return
+	}
+	s.ctxCodecEncoder = e.ctxCodec
+
+	// Get dts shift
+	s.dtsShift = 0
+	if keyFrame.Pts() != avutil.AV_NOPTS_VALUE && keyFrame.Dts() != avutil.AV_NOPTS_VALUE && keyFrame.Pts() > keyFrame.Dts() {
+		s.dtsShift = keyFrame.Pts() - keyFrame.Dts()
+	}
+
+	// Alloc frame and pkt
+	if s.f == nil {
+		s.f = defaultBindings.frameAlloc()
+		s.pkt = defaultBindings.pktAlloc()
+		s.smart.c.Add(func() error {
+			defaultBindings.frameFree(s.f)
+			defaultBindings.pktFree(s.pkt)
+			return nil
+		})
+	}
+	return
+}
+
+func (s *clipStream) closeSmartTranscoder() (err error) {
+	// Flush decoder
+	if !s.done {
+		if ret := avcodec.AvcodecSendPacket(s.ctxCodecDecoder, nil); ret < 0 {
+			err = fmt.Errorf("astilibav: avcodec.AvcodecSendPacket failed: %w", NewAvError(ret))
+			return
+		}
+		if err = s.receiveFrames(); err != nil {
+			err = fmt.Errorf("astilibav: receiving frames failed: %w", err)
+			return
+		}
+	}
+
+	// Flush encoder
+	if err = s.encode(nil); err != nil {
+		err = fmt.Errorf("astilibav: flushing encoder failed: %w", err)
+		return
+	}
+
+	// Codecs are closed by the closer
+	s.ctxCodecDecoder, s.ctxCodecEncoder = nil, nil
+	return
+}
+
+func (s *clipStream) transcodePkt(pkt *avcodec.Packet) (err error) {
+	if ret := avcodec.AvcodecSendPacket(s.ctxCodecDecoder, pkt); ret < 0 {
+		err = fmt.Errorf("astilibav: avcodec.AvcodecSendPacket failed: %w", NewAvError(ret))
+		return
+	}
+	return s.receiveFrames()
+}
+
+func (s *clipStream) handleSmartPkt(pkt *avcodec.Packet) (err error) {
+	// First pkt is the keyframe preceding the start
+	keyFrame := pkt.Flags()&avcodec.AV_PKT_FLAG_KEY > 0
+	ts := clipPktTimestamp(pkt)
+	if !s.smart.started {
+		s.smart.started = true
+
+		// Start is not aligned, the head GOP is transcoded
+		if !s.smart.aligned {
+			if err = s.openSmartTranscoder(pkt); err != nil {
+				err = fmt.Errorf("astilibav: opening transcoder failed: %w", err)
+				return
+			}
+			s.smart.head = true
+			return s.transcodePkt(pkt)
+		}
+	}
+
+	// Head GOP
+	if s.smart.head {
+		// Head GOP is still running
+		if !keyFrame {
+			return s.transcodePkt(pkt)
+		}
+
+		// Close transcoder
+		s.smart.head = false
+		if err = s.closeSmartTranscoder(); err != nil {
+			err = fmt.Errorf("astilibav: closing transcoder failed: %w", err)
+			return
+		}
+
+		// End has been reached in the head GOP
+		if s.done || (s.end != nil && ts >= *s.end) {
+			s.done = true
+			return
+		}
+	}
+
+	// Pkt is before the start
+	if ts < s.start-s.tolerance {
+		return
+	}
+
+	// No end, pkts can be copied right away
+	if s.end == nil {
+		return s.copyPkt(pkt)
+	}
+
+	// A new GOP starts
+	if keyFrame {
+		// Buffered GOP spans the end
+		if ts >= *s.end {
+			err = s.flushSmartGOP()
+			s.done = true
+			return
+		}
+
+		// Copy buffered GOP
+		if err = s.copySmartGOP(); err != nil {
+			err = fmt.Errorf("astilibav: copying gop failed: %w", err)
+			return
+		}
+	}
+
+	// Buffer pkt
+	p := defaultBindings.pktAlloc()
+	if ret := defaultBindings.pktRef(p, pkt); ret < 0 {
+		defaultBindings.pktFree(p)
+		err = fmt.Errorf("astilibav: pkt.AvPacketRef failed: %w", NewAvError(ret))
+		return
+	}
+	s.smart.gop = append(s.smart.gop, p)
+	return
+}
+
+func (s *clipStream) copySmartGOP() (err error) {
+	// Make sure buffered pkts are freed
+	defer s.freeSmartGOP()
+
+	// Copy
+	for _, p := range s.smart.gop {
+		if err = s.copyPkt(p); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (s *clipStream) freeSmartGOP() {
+	for _, p := range s.smart.gop {
+		defaultBindings.pktFree(p)
+	}
+	s.smart.gop = nil
+}
+
+// flushSmartGOP copies the buffered GOP if it ends before the end, and transcodes it otherwise
+func (s *clipStream) flushSmartGOP() (err error) {
+	// Nothing to flush
+	if len(s.smart.gop) == 0 {
+		return
+	}
+
+	// Check whether the buffered GOP spans the end
+	var spans bool
+	for _, p := range s.smart.gop {
+		if clipPktTimestamp(p) >= *s.end {
+			spans = true
+			break
+		}
+	}
+
+	// Copy
+	if !spans {
+		return s.copySmartGOP()
+	}
+
+	// Make sure buffered pkts are freed
+	defer s.freeSmartGOP()
+
+	// Open transcoder
+	if err = s.openSmartTranscoder(s.smart.gop[0]); err != nil {
+		err = fmt.Errorf("astilibav: opening transcoder failed: %w", err)
+		return
+	}
+
+	// Transcode
+	for _, p := range s.smart.gop {
+		if s.done {
+			break
+		}
+		if err = s.transcodePkt(p); err != nil {
+			err = fmt.Errorf("astilibav: transcoding pkt failed: %w", err)
+			return
+		}
+	}
+
+	// Close transcoder
+	if err = s.closeSmartTranscoder(); err != nil {
+		err = fmt.Errorf("astilibav: closing transcoder failed: %w", err)
+		return
+	}
+	return
+}
+
+func (s *clipStream) flushSmart() (err error) {
+	// Head GOP is still running
+	if s.smart.head {
+		s.smart.head = false
+		return s.closeSmartTranscoder()
+	}
+
+	// No end
+	if s.end == nil {
+		return
+	}
+
+	// Flush buffered GOP
+	return s.flushSmartGOP()
+}
@@ -0,0 +1,59 @@
+package astilibav
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClipAligned(t *testing.T) {
+	assert.True(t, clipAligned(100, 100, 0))
+	assert.True(t, clipAligned(98, 100, 2))
+	assert.True(t, clipAligned(102, 100, 2))
+	assert.False(t, clipAligned(97, 100, 2))
+}
+
+func TestNewClipOptionsFromQuery(t *testing.T) {
+	_, _, _, err := newClipOptionsFromQuery(url.Values{"output": []string{"o"}})
+	assert.Error(t, err)
+	_, _, _, err = newClipOptionsFromQuery(url.Values{"input": []string{"i"}})
+	assert.Error(t, err)
+	i, o, co, err := newClipOptionsFromQuery(url.Values{
+		"end":    []string{"1m"},
+		"format": []string{"mp4"},
+		"input":  []string{"i"},
+		"output": []string{"o"},
+		"smart":  []string{"true"},
+		"start":  []string{"30s"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "i", i)
+	assert.Equal(t, "o", o)
+	assert.Equal(t, ClipOptions{
+		End:        time.Minute,
+		FormatName: "mp4",
+		Smart:      true,
+		Start:      30 * time.Second,
+	}, co)
+}
+
+func TestClipHandlerOutput(t *testing.T) {
+	_, err := clipHandlerOutput("", "o.ts")
+	assert.Error(t, err)
+	for _, v := range []string{"", ".", "/etc/o.ts", "../o.ts", "a/../../o.ts", "a/..", "file:o.ts", "rtmp://host/o"} {
+		_, err = clipHandlerOutput("/clips", v)
+		assert.Error(t, err, v)
+	}
+	p, err := clipHandlerOutput("/clips", "a//./b/o.ts")
+	assert.NoError(t, err)
+	assert.Equal(t, "/clips/a/b/o.ts", p)
+}
+
+func TestClipHandlerCheckDuration(t *testing.T) {
+	assert.Error(t, clipHandlerCheckDuration(ClipOptions{Start: time.Second}, time.Minute))
+	assert.Error(t, clipHandlerCheckDuration(ClipOptions{End: time.Second, Start: time.Second}, time.Minute))
+	assert.Error(t, clipHandlerCheckDuration(ClipOptions{End: 2 * time.Minute, Start: 30 * time.Second}, time.Minute))
+	assert.NoError(t, clipHandlerCheckDuration(ClipOptions{End: 90 * time.Second, Start: 30 * time.Second}, time.Minute))
+}
@@ -0,0 +1,416 @@
+package astilibav
+
+//#cgo pkg-config: libavutil
+//#include <errno.h>
+//#include <string.h>
+//#include <libavutil/error.h>
+//#include <libavutil/frame.h>
+//static int astilibav_closed_captions_set(AVFrame *f, const uint8_t *b, int n) {
+//	av_frame_remove_side_data(f, AV_FRAME_DATA_A53_CC);
+//	if (n == 0) return 0;
+//	AVFrameSideData *sd = av_frame_new_side_data(f, AV_FRAME_DATA_A53_CC, n);
+//	if (!sd) return AVERROR(ENOMEM);
+//	memcpy(sd->data, b, n);
+//	return 0;
+//}
+import "C"
+import (
+	"context"
+	"fmt"
+	"image"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+)
+
+var (
+	countClosedCaptionsExtractor uint64
+	countClosedCaptionsInjector  uint64
+)
+
+// A53 cc_count is 5 bits long
+const closedCaptionsMaxTriplets = 31
+
+// Closed captions types as found in the cc_type field of A53 triplets
+const (
+	ClosedCaptionsTypeCEA608Field1 = 0
+	ClosedCaptionsTypeCEA608Field2 = 1
+	ClosedCaptionsTypeCEA708Data   = 2
+	ClosedCaptionsTypeCEA708Start  = 3
+)
+
+// ClosedCaptions represents the closed captions attached to a video frame
+type ClosedCaptions struct {
+	// Raw A53 cc_data triplets, which is what decoders export and encoders such as libx264 or libx265 write as SEI
+	Data []byte
+	// Pts of the frame converted to a duration
+	Time time.Duration
+}
+
+// ClosedCaptionsTriplet represents an A53 cc_data triplet
+// CEA-608 triplets carry a byte pair whereas CEA-708 triplets carry a chunk of a DTVCC packet, a new packet starting
+// with a ClosedCaptionsTypeCEA708Start triplet
+type ClosedCaptionsTriplet struct {
+	Data  [2]byte
+	Type  int
+	Valid bool
+}
+
+// Triplets parses the closed captions data
+func (cc ClosedCaptions) Triplets() (ts []ClosedCaptionsTriplet) {
+	for idx := 0; idx+2 < len(cc.Data); idx += 3 {
+		ts = append(ts, ClosedCaptionsTriplet{
+			Data:  [2]byte{cc.Data[idx+1], cc.Data[idx+2]},
+			Type:  int(cc.Data[idx] & 0x3),
+			Valid: cc.Data[idx]&0x4 > 0,
+		})
+	}
+	return
+}
+
+// frameClosedCaptions returns a copy of the A53 closed captions side data of the frame, if any
+func frameClosedCaptions(f *avutil.Frame) []byte {
+	sd := C.av_frame_get_side_data((*C.struct_AVFrame)(unsafe.Pointer(f)), C.AV_FRAME_DATA_A53_CC)
+	if sd == nil || sd.size <= 0 {
+		return nil
+	}
+	return C.GoBytes(unsafe.Pointer(sd.data), C.int(sd.size))
+}
+
+// ClosedCaptionsExtractor represents an object capable of extracting CEA-608/708 closed captions from video frames
+// Decoders export them as side data, which, for libavcodec h264 and hevc decoders, requires the "a53cc" flag of the
+// "export_side_data" option depending on the version
+// For each frame carrying closed captions, it emits an EventNameClosedCaptionsExtracted event whose payload is a
+// *ClosedCaptions
+type ClosedCaptionsExtractor struct {
+	*astiencoder.BaseNode
+	c                *astikit.Chan
+	eh               *astiencoder.EventHandler
+	statIncomingRate *astikit.CounterAvgStat
+	statWorkRatio    *astikit.DurationPercentageStat
+}
+
+// ClosedCaptionsExtractorOptions represents closed captions extractor options
+type ClosedCaptionsExtractorOptions struct {
+	Node astiencoder.NodeOptions
+}
+
+// NewClosedCaptionsExtractor creates a new closed captions extractor
+func NewClosedCaptionsExtractor(o ClosedCaptionsExtractorOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (e *ClosedCaptionsExtractor) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countClosedCaptionsExtractor, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("closed_captions_extractor_%d", count), fmt.Sprintf("Closed Captions Extractor #%d", count), "Extracts closed captions")
+
+	// Create closed captions extractor
+	e = &ClosedCaptionsExtractor{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh:               eh,
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statWorkRatio:    astikit.NewDurationPercentageStat(),
+	}
+	e.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(e), eh)
+	e.addStats()
+	return
+}
+
+func (e *ClosedCaptionsExtractor) addStats() {
+	// Add incoming rate
+	e.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of frames coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "fps",
+	}, e.statIncomingRate)
+
+	// Add work ratio
+	e.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, e.statWorkRatio)
+
+	// Add chan stats
+	e.c.AddStats(e.Stater())
+}
+
+// Start starts the closed captions extractor
+func (e *ClosedCaptionsExtractor) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	e.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to stop the chan properly
+		defer e.c.Stop()
+
+		// Start chan
+		e.c.Start(e.Context())
+	})
+}
+
+// HandleFrame implements the FrameHandler interface
+func (e *ClosedCaptionsExtractor) HandleFrame(p *FrameHandlerPayload) {
+	e.c.Add(func() {
+		// Handle pause
+		defer e.HandlePause()
+
+		// Increment incoming rate
+		e.statIncomingRate.Add(1)
+
+		// Get closed captions
+		e.statWorkRatio.Begin()
+		b := frameClosedCaptions(p.Frame)
+		e.statWorkRatio.End()
+
+		// No closed captions
+		if len(b) == 0 {
+			return
+		}
+
+		// Create closed captions
+		cc := &ClosedCaptions{Data: b}
+		if pts := p.Frame.Pts(); pts != avutil.AV_NOPTS_VALUE && p.Descriptor != nil {
+			cc.Time = time.Duration(avutil.AvRescaleQ(pts, p.Descriptor.TimeBase(), nanosecondRational))
+		}
+
+		// Emit event
+		e.eh.Emit(astiencoder.Event{
+			Name:    EventNameClosedCaptionsExtracted,
+			Payload: cc,
+			Target:  e,
+		})
+	})
+}
+
+// ClosedCaptionsInjector represents an object capable of injecting CEA-608/708 closed captions into video frames so
+// that encoders write them in the output, which libx264 and libx265 do by default
+// Closed captions are either provided by calling Inject or by listening to the events of closed captions extractors.
+// They are attached to the first frame whose time is greater than or equal to theirs, and are spread over the next
+// frames when there are more than 31 triplets. Closed captions already attached to frames are kept
+type ClosedCaptionsInjector struct {
+	*astiencoder.BaseNode
+	c                *astikit.Chan
+	d                *frameDispatcher
+	eh               *astiencoder.EventHandler
+	m                *sync.Mutex // Locks q
+	p                *framePool
+	q                *closedCaptionsQueue
+	statIncomingRate *astikit.CounterAvgStat
+	statWorkRatio    *astikit.DurationPercentageStat
+}
+
+// ClosedCaptionsInjectorOptions represents closed captions injector options
+type ClosedCaptionsInjectorOptions struct {
+	Node astiencoder.NodeOptions
+	// Closed captions extractors whose closed captions are injected
+	Sources []astiencoder.Node
+}
+
+// NewClosedCaptionsInjector creates a new closed captions injector
+func NewClosedCaptionsInjector(o ClosedCaptionsInjectorOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (i *ClosedCaptionsInjector) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countClosedCaptionsInjector, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("closed_captions_injector_%d", count), fmt.Sprintf("Closed Captions Injector #%d", count), "Injects closed captions")
+
+	// Create closed captions injector
+	i = &ClosedCaptionsInjector{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh:               eh,
+		m:                &sync.Mutex{},
+		p:                newFramePool(c),
+		q:                &closedCaptionsQueue{},
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statWorkRatio:    astikit.NewDurationPercentageStat(),
+	}
+	i.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(i), eh)
+	i.d = newFrameDispatcher(i, eh, c)
+	i.addStats()
+
+	// Listen to sources
+	for _, n := range o.Sources {
+		eh.Add(n, EventNameClosedCaptionsExtracted, func(e astiencoder.Event) bool {
+			if cc, ok := e.Payload.(*ClosedCaptions); ok {
+				i.Inject(cc)
+			}
+			return false
+		})
+	}
+	return
+}
+
+func (i *ClosedCaptionsInjector) addStats() {
+	// Add incoming rate
+	i.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of frames coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "fps",
+	}, i.statIncomingRate)
+
+	// Add work ratio
+	i.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, i.statWorkRatio)
+
+	// Add dispatcher stats
+	i.d.addStats(i.Stater())
+
+	// Add chan stats
+	i.c.AddStats(i.Stater())
+}
+
+// Inject queues closed captions, their time being on the timeline of the incoming frames
+func (i *ClosedCaptionsInjector) Inject(cc *ClosedCaptions) {
+	i.m.Lock()
+	defer i.m.Unlock()
+	i.q.add(cc)
+}
+
+// Connect implements the FrameHandlerConnector interface
+func (i *ClosedCaptionsInjector) Connect(h FrameHandler) {
+	// Add handler
+	i.d.addHandler(h)
+
+	// Connect nodes
+	astiencoder.ConnectNodes(i, h)
+}
+
+// Disconnect implements the FrameHandlerConnector interface
+func (i *ClosedCaptionsInjector) Disconnect(h FrameHandler) {
+	// Delete handler
+	i.d.delHandler(h)
+
+	// Disconnect nodes
+	astiencoder.DisconnectNodes(i, h)
+}
+
+// Snapshot implements the astiencoder.Snapshotter interface
+func (i *ClosedCaptionsInjector) Snapshot(ctx context.Context) (image.Image, error) {
+	return i.d.snapshot(ctx)
+}
+
+// Start starts the closed captions injector
+func (i *ClosedCaptionsInjector) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	i.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to wait for all dispatcher subprocesses to be done so that they are properly closed
+		defer i.d.wait()
+
+		// Make sure to stop the chan properly
+		defer i.c.Stop()
+
+		// Start chan
+		i.c.Start(i.Context())
+	})
+}
+
+// HandleEOS implements the EOSHandler interface
+func (i *ClosedCaptionsInjector) HandleEOS(p *EOSHandlerPayload) {
+	i.c.Add(func() {
+		// Forward end of stream
+		i.d.dispatchEOS()
+	})
+}
+
+// HandleFrame implements the FrameHandler interface
+func (i *ClosedCaptionsInjector) HandleFrame(p *FrameHandlerPayload) {
+	i.c.Add(func() {
+		// Handle pause
+		defer i.HandlePause()
+
+		// Increment incoming rate
+		i.statIncomingRate.Add(1)
+
+		// Get frame time
+		// Frames without pts get the pending closed captions whatever their time
+		t := time.Duration(1<<63 - 1)
+		if pts := p.Frame.Pts(); pts != avutil.AV_NOPTS_VALUE && p.Descriptor != nil {
+			t = time.Duration(avutil.AvRescaleQ(pts, p.Descriptor.TimeBase(), nanosecondRational))
+		}
+
+		// Get closed captions
+		// Closed captions already attached to the frame take precedence
+		b := frameClosedCaptions(p.Frame)
+		i.m.Lock()
+		inj := i.q.pop(t, closedCaptionsMaxTriplets*3-len(b)/3*3)
+		i.m.Unlock()
+
+		// Nothing to inject
+		if len(inj) == 0 {
+			i.d.dispatch(p.Frame, p.Descriptor, p.Metadata)
+			return
+		}
+		b = append(b, inj...)
+
+		// Copy frame
+		// Side data is not shared between references
+		f := i.p.get()
+		defer i.p.put(f)
+		if ret := defaultBindings.frameRef(f, p.Frame); ret < 0 {
+			emitAvError(i, i.eh, ret, "avutil.AvFrameRef failed")
+			return
+		}
+
+		// Attach closed captions
+		i.statWorkRatio.Begin()
+		if ret := C.astilibav_closed_captions_set((*C.struct_AVFrame)(unsafe.Pointer(f)), (*C.uint8_t)(unsafe.Pointer(&b[0])), C.int(len(b))); ret < 0 {
+			i.statWorkRatio.End()
+			emitAvError(i, i.eh, int(ret), "astilibav_closed_captions_set failed")
+			return
+		}
+		i.statWorkRatio.End()
+
+		// Dispatch frame
+		i.d.dispatch(f, p.Descriptor, p.Metadata)
+	})
+}
+
+type closedCaptionsQueueItem struct {
+	data []byte
+	t    time.Duration
+}
+
+// closedCaptionsQueue keeps track of closed captions in the order they have been added
+type closedCaptionsQueue struct {
+	is []closedCaptionsQueueItem
+}
+
+func (q *closedCaptionsQueue) add(cc *ClosedCaptions) {
+	// Only keep whole triplets
+	n := len(cc.Data) / 3 * 3
+	if n == 0 {
+		return
+	}
+	q.is = append(q.is, closedCaptionsQueueItem{
+		data: append([]byte{}, cc.Data[:n]...),
+		t:    cc.Time,
+	})
+}
+
+// pop returns at most max bytes of the closed captions whose time is lower than or equal to t
+func (q *closedCaptionsQueue) pop(t time.Duration, max int) (b []byte) {
+	for len(q.is) > 0 && q.is[0].t <= t && len(b)+3 <= max {
+		// Get size
+		n := len(q.is[0].data)
+		if len(b)+n > max {
+			n = (max - len(b)) / 3 * 3
+		}
+
+		// Append
+		b = append(b, q.is[0].data[:n]...)
+
+		// The rest is kept for the next frames
+		if n < len(q.is[0].data) {
+			q.is[0].data = q.is[0].data[n:]
+			break
+		}
+		q.is = q.is[1:]
+	}
+	return
+}
@@ -0,0 +1,29 @@
+package astilibav
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClosedCaptionsTriplets(t *testing.T) {
+	assert.Equal(t, []ClosedCaptionsTriplet{
+		{Data: [2]byte{0x94, 0x2c}, Type: ClosedCaptionsTypeCEA608Field1, Valid: true},
+		{Data: [2]byte{0x80, 0x80}, Type: ClosedCaptionsTypeCEA608Field2},
+		{Data: [2]byte{0x01, 0x02}, Type: ClosedCaptionsTypeCEA708Start, Valid: true},
+	}, ClosedCaptions{Data: []byte{0xfc, 0x94, 0x2c, 0xf9, 0x80, 0x80, 0xff, 0x01, 0x02, 0xfc}}.Triplets())
+}
+
+func TestClosedCaptionsQueue(t *testing.T) {
+	q := &closedCaptionsQueue{}
+	q.add(&ClosedCaptions{Data: []byte{1, 2, 3, 4}, Time: time.Second})
+	q.add(&ClosedCaptions{Data: []byte{5, 6}, Time: time.Second})
+	q.add(&ClosedCaptions{Data: []byte{7, 8, 9, 10, 11, 12}, Time: 2 * time.Second})
+	assert.Empty(t, q.pop(0, 93))
+	assert.Equal(t, []byte{1, 2, 3}, q.pop(time.Second, 93))
+	assert.Empty(t, q.pop(time.Second, 93))
+	assert.Equal(t, []byte{7, 8, 9}, q.pop(3*time.Second, 5))
+	assert.Equal(t, []byte{10, 11, 12}, q.pop(3*time.Second, 93))
+	assert.Empty(t, q.is)
+}
@@ -0,0 +1,75 @@
+package astilibav
+
+//#cgo pkg-config: libavcodec libavfilter libavformat libavutil
+//#include <libavutil/pixdesc.h>
+//#include "compat.h"
+import "C"
+import (
+	"unsafe"
+
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avformat"
+	"github.com/asticode/goav/avutil"
+)
+
+// NewContextFromStream creates a new context from a stream
+func NewContextFromStream(s *avformat.Stream) (ctx Context) {
+	// Get codec parameters
+	// AVStream.codec is not used since it has been removed in ffmpeg 5, which is why the gop size, that is not part of
+	// codec parameters, is left empty
+	cs := (*C.struct_AVStream)(unsafe.Pointer(s))
+	cp := cs.codecpar
+	ctx = Context{
+		// Shared
+		BitRate:   int(cp.bit_rate),
+		CodecID:   s.CodecParameters().CodecId(),
+		CodecType: s.CodecParameters().CodecType(),
+		Level:     int(cp.level),
+		Profile:   int(cp.profile),
+		TimeBase:  s.TimeBase(),
+	}
+
+	// Audio
+	if cp.codec_type == C.AVMEDIA_TYPE_AUDIO {
+		ctx.ChannelLayout = uint64(C.astilibav_codecpar_channel_layout(cp))
+		ctx.Channels = int(C.astilibav_codecpar_channels(cp))
+		ctx.SampleFmt = avcodec.AvSampleFormat(cp.format)
+		ctx.SampleRate = int(cp.sample_rate)
+		return
+	}
+
+	// Not video
+	if cp.codec_type != C.AVMEDIA_TYPE_VIDEO {
+		return
+	}
+
+	// Video
+	ctx.ColorPrimaries = int(cp.color_primaries)
+	ctx.ColorRange = int(cp.color_range)
+	ctx.ColorSpace = int(cp.color_space)
+	ctx.ColorTransfer = int(cp.color_trc)
+	ctx.FieldOrder = int(cp.field_order)
+	ctx.FrameRate = streamFrameRate(s)
+	ctx.Height = int(cp.height)
+	ctx.PixelFormat = avutil.PixelFormat(cp.format)
+	ctx.SampleAspectRatio = s.SampleAspectRatio()
+	ctx.Width = int(cp.width)
+
+	// HDR static metadata
+	sd := newSideData(streamSideDataEntries(s))
+	ctx.ContentLightLevel = sd.ContentLightLevel
+	ctx.MasteringDisplay = sd.MasteringDisplay
+
+	// Bit depth
+	if cp.bits_per_raw_sample > 0 {
+		ctx.BitDepth = int(cp.bits_per_raw_sample)
+	} else if d := C.av_pix_fmt_desc_get(C.enum_AVPixelFormat(cp.format)); d != nil {
+		ctx.BitDepth = int(d.comp[0].depth)
+	}
+	return
+}
+
+// HDR returns whether the transfer characteristic is either PQ or HLG
+func (ctx Context) HDR() bool {
+	return ctx.ColorTransfer == C.AVCOL_TRC_SMPTE2084 || ctx.ColorTransfer == C.AVCOL_TRC_ARIB_STD_B67
+}
@@ -0,0 +1,102 @@
+// Helpers hiding the differences between ffmpeg versions, from 4.1 to 7.x
+// Only the parts of the API used by this package are covered
+
+#include <libavcodec/avcodec.h>
+#include <libavfilter/buffersink.h>
+#include <libavformat/avformat.h>
+#include <libavutil/channel_layout.h>
+#include <libavutil/frame.h>
+
+// AVChannelLayout has been introduced in libavutil 57.24.100 (ffmpeg 5.1)
+#if LIBAVUTIL_VERSION_INT >= AV_VERSION_INT(57, 24, 100)
+#define ASTILIBAV_CH_LAYOUT 1
+#endif
+
+static inline uint64_t astilibav_codecpar_channel_layout(const AVCodecParameters *p) {
+#ifdef ASTILIBAV_CH_LAYOUT
+	return p->ch_layout.order == AV_CHANNEL_ORDER_NATIVE ? p->ch_layout.u.mask : 0;
+#else
+	return p->channel_layout;
+#endif
+}
+
+static inline int astilibav_codecpar_channels(const AVCodecParameters *p) {
+#ifdef ASTILIBAV_CH_LAYOUT
+	return p->ch_layout.nb_channels;
+#else
+	return p->channels;
+#endif
+}
+
+static inline int astilibav_frame_channels(const AVFrame *f) {
+#ifdef ASTILIBAV_CH_LAYOUT
+	return f->ch_layout.nb_channels;
+#else
+	return f->channels;
+#endif
+}
+
+// AVFrame.duration has been introduced in libavutil 57.30.100 (ffmpeg 5.1)
+static inline int64_t astilibav_frame_duration(const AVFrame *f) {
+#if LIBAVUTIL_VERSION_INT >= AV_VERSION_INT(57, 30, 100)
+	return f->duration;
+#else
+	return f->pkt_duration;
+#endif
+}
+
+static inline uint64_t astilibav_buffersink_channel_layout(const AVFilterContext *c) {
+#ifdef ASTILIBAV_CH_LAYOUT
+	AVChannelLayout l = {0};
+	uint64_t m = 0;
+	if (av_buffersink_get_ch_layout(c, &l) >= 0 && l.order == AV_CHANNEL_ORDER_NATIVE) m = l.u.mask;
+	av_channel_layout_uninit(&l);
+	return m;
+#else
+	return av_buffersink_get_channel_layout(c);
+#endif
+}
+
+// Stream side data has been moved to codec parameters in libavcodec 60.30.100 (ffmpeg 6.1)
+static inline const AVPacketSideData *astilibav_stream_side_data(const AVStream *s, int *n) {
+#if LIBAVCODEC_VERSION_INT >= AV_VERSION_INT(60, 30, 100)
+	*n = s->codecpar->nb_coded_side_data;
+	return s->codecpar->coded_side_data;
+#else
+	*n = s->nb_side_data;
+	return s->side_data;
+#endif
+}
+
+// AVFrame.interlaced_frame and AVFrame.top_field_first have been replaced with flags in libavutil 58.7.100 (ffmpeg 6.1)
+static inline int astilibav_frame_interlaced(const AVFrame *f) {
+#if LIBAVUTIL_VERSION_INT >= AV_VERSION_INT(58, 7, 100)
+	return !!(f->flags & AV_FRAME_FLAG_INTERLACED);
+#else
+	return f->interlaced_frame;
+#endif
+}
+
+static inline int astilibav_frame_top_field_first(const AVFrame *f) {
+#if LIBAVUTIL_VERSION_INT >= AV_VERSION_INT(58, 7, 100)
+	return !!(f->flags & AV_FRAME_FLAG_TOP_FIELD_FIRST);
+#else
+	return f->top_field_first;
+#endif
+}
+
+// av_stream_new_side_data() has been deprecated in favor of codec parameters side data in libavcodec 60.30.100 (ffmpeg 6.1)
+static inline uint8_t *astilibav_stream_new_side_data(AVStream *s, enum AVPacketSideDataType t, int n) {
+#if LIBAVCODEC_VERSION_INT >= AV_VERSION_INT(60, 30, 100)
+	AVPacketSideData *sd = av_packet_side_data_new(&s->codecpar->coded_side_data, &s->codecpar->nb_coded_side_data, t, n, 0);
+	return sd ? sd->data : NULL;
+#else
+	return av_stream_new_side_data(s, t, n);
+#endif
+}
+
+// Subtitles are the only media type that can't go through avcodec_send_packet() and avcodec_receive_frame(), up to
+// ffmpeg 7.x included, therefore avcodec_decode_subtitle2() is only called here
+static inline int astilibav_decode_subtitle(AVCodecContext *c, AVSubtitle *s, int *got, const AVPacket *pkt) {
+	return avcodec_decode_subtitle2(c, s, got, pkt);
+}
@@ -0,0 +1,516 @@
+package astilibav
+
+//#cgo pkg-config: libavutil libswscale
+//#include <errno.h>
+//#include <string.h>
+//#include <libavutil/frame.h>
+//#include <libswscale/swscale.h>
+//static int astilibav_compositor_alloc(AVFrame *f, int w, int h) {
+//	f->format = AV_PIX_FMT_YUV420P;
+//	f->height = h;
+//	f->width = w;
+//	int ret;
+//	if ((ret = av_frame_get_buffer(f, 0)) < 0) return ret;
+//	// Black background
+//	for (int y = 0; y < h; y++) memset(f->data[0] + y * f->linesize[0], 16, w);
+//	for (int y = 0; y < h / 2; y++) {
+//		memset(f->data[1] + y * f->linesize[1], 128, w / 2);
+//		memset(f->data[2] + y * f->linesize[2], 128, w / 2);
+//	}
+//	return 0;
+//}
+//static int astilibav_compositor_draw(struct SwsContext **c, const AVFrame *in, int top, int bottom, int left, int right, AVFrame *out, int x, int y, int w, int h, int flags) {
+//	AVFrame *src = av_frame_clone(in);
+//	if (!src) return AVERROR(ENOMEM);
+//	src->crop_top += top;
+//	src->crop_bottom += bottom;
+//	src->crop_left += left;
+//	src->crop_right += right;
+//	int ret;
+//	if ((ret = av_frame_apply_cropping(src, AV_FRAME_CROP_UNALIGNED)) < 0) {
+//		av_frame_free(&src);
+//		return ret;
+//	}
+//	*c = sws_getCachedContext(*c, src->width, src->height, src->format, w, h, AV_PIX_FMT_YUV420P, flags, NULL, NULL, NULL);
+//	if (!*c) {
+//		av_frame_free(&src);
+//		return AVERROR(EINVAL);
+//	}
+//	uint8_t *dst[4] = {
+//		out->data[0] + y * out->linesize[0] + x,
+//		out->data[1] + (y / 2) * out->linesize[1] + x / 2,
+//		out->data[2] + (y / 2) * out->linesize[2] + x / 2,
+//		NULL,
+//	};
+//	ret = sws_scale(*c, (const uint8_t * const *)src->data, src->linesize, 0, src->height, dst, out->linesize);
+//	av_frame_free(&src);
+//	return ret < 0 ? ret : 0;
+//}
+import "C"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+)
+
+var countCompositor uint64
+
+// Compositor layouts
+const (
+	CompositorLayoutGrid       = "grid"
+	CompositorLayoutPiP        = "pip"
+	CompositorLayoutSideBySide = "side_by_side"
+)
+
+// Compositor represents an object capable of laying out several video inputs on a single yuv420p video
+// An output frame is produced each time a frame of the first input comes in, with its timestamps, and contains the last
+// frame of each input. Inputs are drawn in their z-order, which also defines their position in the layout, and are
+// scaled to fit their cell while keeping their aspect ratio
+// Layout, z-order and cropping can be updated at runtime
+type Compositor struct {
+	*astiencoder.BaseNode
+	c                *astikit.Chan
+	d                *frameDispatcher
+	eh               *astiencoder.EventHandler
+	flags            C.int
+	inputs           map[astiencoder.Node]*compositorInput
+	layout           string
+	o                CompositorOptions
+	order            []*compositorInput
+	p                *framePool
+	primary          *compositorInput
+	statIncomingRate *astikit.CounterAvgStat
+	statWorkRatio    *astikit.DurationPercentageStat
+}
+
+// CompositorOptions represents compositor options
+type CompositorOptions struct {
+	// Must be even
+	Height int
+	// The first input drives the output. Their order is the initial z-order, bottom first
+	Inputs []CompositorInput
+	// Possible values are "grid", "pip" and "side_by_side". Defaults to "grid"
+	Layout string
+	Node   astiencoder.NodeOptions
+	// Must be even
+	Width int
+}
+
+// CompositorInput represents a compositor input
+type CompositorInput struct {
+	Crop CompositorCrop
+	Node astiencoder.Node
+}
+
+// CompositorCrop represents the number of pixels removed from each side of an input before it's drawn
+type CompositorCrop struct {
+	Bottom int
+	Left   int
+	Right  int
+	Top    int
+}
+
+type compositorInput struct {
+	crop CompositorCrop
+	ctx  *C.struct_SwsContext
+	f    *avutil.Frame
+	node astiencoder.Node
+}
+
+type compositorRect struct {
+	h, w, x, y int
+}
+
+// NewCompositor creates a new compositor
+func NewCompositor(o CompositorOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (cp *Compositor, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countCompositor, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("compositor_%d", count), fmt.Sprintf("Compositor #%d", count), "Composites")
+
+	// Check size
+	if o.Width <= 0 || o.Height <= 0 || o.Width%2 != 0 || o.Height%2 != 0 {
+		err = fmt.Errorf("astilibav: invalid size %dx%d", o.Width, o.Height)
+		return
+	}
+
+	// No inputs
+	if len(o.Inputs) == 0 {
+		err = errors.New("astilibav: no inputs provided")
+		return
+	}
+
+	// Check layout
+	if o.Layout == "" {
+		o.Layout = CompositorLayoutGrid
+	}
+	if err = compositorCheckLayout(o.Layout); err != nil {
+		return
+	}
+
+	// Create compositor
+	cp = &Compositor{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh:               eh,
+		flags:            scalerAlgorithms[defaultScalerAlgorithm],
+		inputs:           make(map[astiencoder.Node]*compositorInput),
+		layout:           o.Layout,
+		o:                o,
+		p:                newFramePool(c),
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statWorkRatio:    astikit.NewDurationPercentageStat(),
+	}
+
+	// Loop through inputs
+	for idx, i := range o.Inputs {
+		// Frames are matched with their input through their node
+		if _, ok := cp.inputs[i.Node]; ok {
+			err = fmt.Errorf("astilibav: node of input #%d is used by another input", idx)
+			return
+		}
+
+		// Check crop
+		if err = compositorCheckCrop(i.Crop); err != nil {
+			err = fmt.Errorf("astilibav: checking crop of input #%d failed: %w", idx, err)
+			return
+		}
+
+		// Add input
+		ci := &compositorInput{
+			crop: i.Crop,
+			node: i.Node,
+		}
+		cp.inputs[i.Node] = ci
+		cp.order = append(cp.order, ci)
+	}
+	cp.primary = cp.order[0]
+
+	cp.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(cp), eh)
+	cp.d = newFrameDispatcher(cp, eh, c)
+	cp.addStats()
+
+	// Make sure the scaling ctxs are freed
+	c.Add(func() error {
+		for _, i := range cp.inputs {
+			if i.ctx != nil {
+				C.sws_freeContext(i.ctx)
+			}
+		}
+		return nil
+	})
+	return
+}
+
+func (cp *Compositor) addStats() {
+	// Add incoming rate
+	cp.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of frames coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "fps",
+	}, cp.statIncomingRate)
+
+	// Add work ratio
+	cp.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, cp.statWorkRatio)
+
+	// Add dispatcher stats
+	cp.d.addStats(cp.Stater())
+
+	// Add chan stats
+	cp.c.AddStats(cp.Stater())
+}
+
+// Connect implements the FrameHandlerConnector interface
+func (cp *Compositor) Connect(h FrameHandler) {
+	// Add handler
+	cp.d.addHandler(h)
+
+	// Connect nodes
+	astiencoder.ConnectNodes(cp, h)
+}
+
+// Disconnect implements the FrameHandlerConnector interface
+func (cp *Compositor) Disconnect(h FrameHandler) {
+	// Delete handler
+	cp.d.delHandler(h)
+
+	// Disconnect nodes
+	astiencoder.DisconnectNodes(cp, h)
+}
+
+// Snapshot implements the astiencoder.Snapshotter interface
+func (cp *Compositor) Snapshot(ctx context.Context) (image.Image, error) {
+	return cp.d.snapshot(ctx)
+}
+
+// SetLayout updates the layout before the next output frame is produced
+func (cp *Compositor) SetLayout(l string) error {
+	// Check layout
+	if err := compositorCheckLayout(l); err != nil {
+		return err
+	}
+
+	// Update layout
+	cp.c.Add(func() {
+		cp.layout = l
+	})
+	return nil
+}
+
+// SetOrder updates the z-order, bottom first, before the next output frame is produced. All inputs must be provided
+func (cp *Compositor) SetOrder(ns []astiencoder.Node) error {
+	// Check nodes
+	if len(ns) != len(cp.inputs) {
+		return fmt.Errorf("astilibav: %d nodes provided but there are %d inputs", len(ns), len(cp.inputs))
+	}
+	var order []*compositorInput
+	done := make(map[astiencoder.Node]bool)
+	for idx, n := range ns {
+		i, ok := cp.inputs[n]
+		if !ok {
+			return fmt.Errorf("astilibav: node #%d is not an input", idx)
+		} else if done[n] {
+			return fmt.Errorf("astilibav: node #%d is provided several times", idx)
+		}
+		done[n] = true
+		order = append(order, i)
+	}
+
+	// Update order
+	cp.c.Add(func() {
+		cp.order = order
+	})
+	return nil
+}
+
+// SetCrop updates the crop of the input of the provided node before the next output frame is produced
+func (cp *Compositor) SetCrop(n astiencoder.Node, c CompositorCrop) error {
+	// Get input
+	i, ok := cp.inputs[n]
+	if !ok {
+		return errors.New("astilibav: node is not an input")
+	}
+
+	// Check crop
+	if err := compositorCheckCrop(c); err != nil {
+		return err
+	}
+
+	// Update crop
+	cp.c.Add(func() {
+		i.crop = c
+	})
+	return nil
+}
+
+// Start starts the compositor
+func (cp *Compositor) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	cp.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to wait for all dispatcher subprocesses to be done so that they are properly closed
+		defer cp.d.wait()
+
+		// Make sure to stop the chan properly
+		defer cp.c.Stop()
+
+		// Start chan
+		cp.c.Start(cp.Context())
+	})
+}
+
+// HandleEOS implements the EOSHandler interface
+func (cp *Compositor) HandleEOS(p *EOSHandlerPayload) {
+	cp.c.Add(func() {
+		// Output frames are only produced with frames of the first input
+		if p.Node != cp.primary.node {
+			return
+		}
+
+		// Forward end of stream
+		cp.d.dispatchEOS()
+	})
+}
+
+// HandleFrame implements the FrameHandler interface
+func (cp *Compositor) HandleFrame(p *FrameHandlerPayload) {
+	cp.c.Add(func() {
+		// Handle pause
+		defer cp.HandlePause()
+
+		// Increment incoming rate
+		cp.statIncomingRate.Add(1)
+
+		// Get input
+		i, ok := cp.inputs[p.Node]
+		if !ok {
+			return
+		}
+
+		// Keep track of the last frame
+		if i.f == nil {
+			i.f = cp.p.get()
+		} else {
+			defaultBindings.frameUnref(i.f)
+		}
+		if ret := defaultBindings.frameRef(i.f, p.Frame); ret < 0 {
+			emitAvError(cp, cp.eh, ret, "avutil.AvFrameRef failed")
+			cp.p.put(i.f)
+			i.f = nil
+			return
+		}
+
+		// Output frames are only produced with frames of the first input
+		if i != cp.primary {
+			return
+		}
+
+		// Get frame
+		f := cp.d.p.get()
+		defer cp.d.p.put(f)
+
+		// Composite
+		cp.statWorkRatio.Begin()
+		if err := cp.composite(f, p.Frame); err != nil {
+			cp.statWorkRatio.End()
+			cp.eh.Emit(astiencoder.EventError(cp, err))
+			return
+		}
+		cp.statWorkRatio.End()
+
+		// Dispatch frame
+		cp.d.dispatch(f, cp.descriptor(p.Descriptor), p.Metadata)
+	})
+}
+
+func (cp *Compositor) composite(f, primary *avutil.Frame) error {
+	// Allocate frame
+	cf := (*C.AVFrame)(unsafe.Pointer(f))
+	if ret := C.astilibav_compositor_alloc(cf, C.int(cp.o.Width), C.int(cp.o.Height)); ret < 0 {
+		return fmt.Errorf("astilibav: astilibav_compositor_alloc failed: %w", NewAvError(int(ret)))
+	}
+
+	// Copy timestamps
+	if ret := C.av_frame_copy_props(cf, (*C.AVFrame)(unsafe.Pointer(primary))); ret < 0 {
+		return fmt.Errorf("astilibav: av_frame_copy_props failed: %w", NewAvError(int(ret)))
+	}
+
+	// Loop through inputs
+	rs := compositorLayoutRects(cp.layout, len(cp.order), cp.o.Width, cp.o.Height)
+	for idx, i := range cp.order {
+		// No frame yet
+		if i.f == nil {
+			continue
+		}
+
+		// Get rect
+		icf := (*C.AVFrame)(unsafe.Pointer(i.f))
+		r := compositorFit(rs[idx], int(icf.width)-i.crop.Left-i.crop.Right, int(icf.height)-i.crop.Top-i.crop.Bottom)
+		if r.w <= 0 || r.h <= 0 {
+			continue
+		}
+
+		// Draw
+		if ret := C.astilibav_compositor_draw(&i.ctx, icf, C.int(i.crop.Top), C.int(i.crop.Bottom), C.int(i.crop.Left), C.int(i.crop.Right), cf, C.int(r.x), C.int(r.y), C.int(r.w), C.int(r.h), cp.flags); ret < 0 {
+			return fmt.Errorf("astilibav: astilibav_compositor_draw of input #%d failed: %w", idx, NewAvError(int(ret)))
+		}
+	}
+
+	// Output has square pixels
+	cf.sample_aspect_ratio = C.AVRational{num: 1, den: 1}
+	return nil
+}
+
+func (cp *Compositor) descriptor(prev Descriptor) StreamDescriptor {
+	psd, ok := DescriptorStream(prev)
+	ctx := Context{
+		CodecType:         avutil.AVMEDIA_TYPE_VIDEO,
+		Height:            cp.o.Height,
+		PixelFormat:       avutil.AV_PIX_FMT_YUV420P,
+		SampleAspectRatio: avutil.NewRational(1, 1),
+		TimeBase:          prev.TimeBase(),
+		Width:             cp.o.Width,
+	}
+	if ok {
+		ctx.FrameRate = psd.Context().FrameRate
+	}
+	return newStreamDescriptor(ctx, psd.Index(), psd.SideData())
+}
+
+func compositorCheckLayout(l string) error {
+	switch l {
+	case CompositorLayoutGrid, CompositorLayoutPiP, CompositorLayoutSideBySide:
+		return nil
+	}
+	return fmt.Errorf("astilibav: invalid layout %s", l)
+}
+
+func compositorCheckCrop(c CompositorCrop) error {
+	if c.Bottom < 0 || c.Left < 0 || c.Right < 0 || c.Top < 0 {
+		return fmt.Errorf("astilibav: invalid crop %+v", c)
+	}
+	return nil
+}
+
+// compositorLayoutRects returns the cells of the layout in z-order. Values are even since chroma is subsampled
+func compositorLayoutRects(layout string, n, width, height int) (rs []compositorRect) {
+	switch layout {
+	case CompositorLayoutPiP:
+		// First input is full screen, the others are in the bottom right corner from right to left
+		rs = append(rs, compositorRect{h: height, w: width})
+		w, h, m := width/4&^1, height/4&^1, width/32&^1
+		for idx := 1; idx < n; idx++ {
+			rs = append(rs, compositorRect{
+				h: h,
+				w: w,
+				x: width - idx*(w+m),
+				y: height - h - m,
+			})
+		}
+	default:
+		// Get grid
+		cols := n
+		if layout == CompositorLayoutGrid {
+			cols = int(math.Ceil(math.Sqrt(float64(n))))
+		}
+		rows := (n + cols - 1) / cols
+
+		// Loop through cells
+		w, h := width/cols&^1, height/rows&^1
+		for idx := 0; idx < n; idx++ {
+			rs = append(rs, compositorRect{
+				h: h,
+				w: w,
+				x: idx % cols * w,
+				y: idx / cols * h,
+			})
+		}
+	}
+	return
+}
+
+// compositorFit returns the largest rect centered in the cell that keeps the aspect ratio of the input
+func compositorFit(cell compositorRect, width, height int) compositorRect {
+	if width <= 0 || height <= 0 {
+		return compositorRect{}
+	}
+	s := math.Min(float64(cell.w)/float64(width), float64(cell.h)/float64(height))
+	w, h := int(math.Round(float64(width)*s))&^1, int(math.Round(float64(height)*s))&^1
+	return compositorRect{
+		h: h,
+		w: w,
+		x: cell.x + (cell.w-w)/2&^1,
+		y: cell.y + (cell.h-h)/2&^1,
+	}
+}
@@ -0,0 +1,32 @@
+package astilibav
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompositorLayoutRects(t *testing.T) {
+	assert.Equal(t, []compositorRect{
+		{h: 540, w: 960, x: 0, y: 0},
+		{h: 540, w: 960, x: 960, y: 0},
+		{h: 540, w: 960, x: 0, y: 540},
+	}, compositorLayoutRects(CompositorLayoutGrid, 3, 1920, 1080))
+	assert.Equal(t, []compositorRect{
+		{h: 1080, w: 640, x: 0, y: 0},
+		{h: 1080, w: 640, x: 640, y: 0},
+		{h: 1080, w: 640, x: 1280, y: 0},
+	}, compositorLayoutRects(CompositorLayoutSideBySide, 3, 1920, 1080))
+	assert.Equal(t, []compositorRect{
+		{h: 1080, w: 1920, x: 0, y: 0},
+		{h: 270, w: 480, x: 1380, y: 750},
+		{h: 270, w: 480, x: 840, y: 750},
+	}, compositorLayoutRects(CompositorLayoutPiP, 3, 1920, 1080))
+}
+
+func TestCompositorFit(t *testing.T) {
+	assert.Equal(t, compositorRect{h: 540, w: 960, x: 960, y: 0}, compositorFit(compositorRect{h: 540, w: 960, x: 960}, 1920, 1080))
+	assert.Equal(t, compositorRect{h: 540, w: 720, x: 120, y: 0}, compositorFit(compositorRect{h: 540, w: 960}, 640, 480))
+	assert.Equal(t, compositorRect{h: 270, w: 640, x: 0, y: 404}, compositorFit(compositorRect{h: 1080, w: 640}, 1920, 810))
+	assert.Equal(t, compositorRect{}, compositorFit(compositorRect{h: 540, w: 960}, 0, 480))
+}
@@ -0,0 +1,353 @@
+package astilibav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+)
+
+var countContentAdaptiveController uint64
+
+// Default content adaptive controller values
+const (
+	defaultContentAdaptiveControllerHighComplexity = 0.25
+	defaultContentAdaptiveControllerLowComplexity  = 0.02
+	defaultContentAdaptiveControllerMaxLookAhead   = 2 * time.Second
+)
+
+// ContentAdaptiveController represents an object capable of adjusting the rate control of an encoder per scene
+// Frames are buffered until a scene change is detected or the max look ahead is reached. The complexity of the
+// buffered chunk is then measured, the rate control of the encoder is updated accordingly and frames are forwarded
+// Complexity is the sum of the spatial activity (mean absolute difference between neighbouring samples) and of the
+// temporal activity (mean absolute frame difference) of the first plane, which is luma for YUV pixel formats
+type ContentAdaptiveController struct {
+	*astiencoder.BaseNode
+	buf              []*avutil.Frame
+	c                *astikit.Chan
+	complexity       float64
+	d                *frameDispatcher
+	descriptor       Descriptor
+	eh               *astiencoder.EventHandler
+	ms               []*UnitMetadata
+	o                ContentAdaptiveControllerOptions
+	p                *framePool
+	prevMafd         float64
+	prevSamples      []uint8
+	samples          []uint8
+	statIncomingRate *astikit.CounterAvgStat
+	statWorkRatio    *astikit.DurationPercentageStat
+}
+
+// ContentAdaptiveControllerOptions represents content adaptive controller options
+// Either both CRFs or both bit rates must be provided. Easy chunks get the max CRF or the min bit rate whereas hard
+// chunks get the min CRF or the max bit rate
+type ContentAdaptiveControllerOptions struct {
+	// Encoder whose rate control is updated. It must support being reconfigured between frames
+	Encoder *Encoder
+	// Complexity above which chunks are considered as hard. Defaults to 0.25
+	HighComplexity float64
+	// Complexity under which chunks are considered as easy. Defaults to 0.02
+	LowComplexity float64
+	MaxBitRate    int
+	MaxCRF        float64
+	// Chunks longer than this duration are split, which bounds memory usage. Defaults to 2s
+	MaxLookAhead time.Duration
+	MinBitRate   int
+	MinCRF       float64
+	Node         astiencoder.NodeOptions
+	// Number of pixels between 2 samples, both horizontally and vertically. Defaults to 8
+	SampleStep int
+	// Scene score between 0 and 1 above which a new chunk is started. Defaults to 0.4
+	Threshold float64
+}
+
+// ContentAdaptiveAdjustment represents a rate control adjustment
+type ContentAdaptiveAdjustment struct {
+	// 0 if no bit rates have been provided
+	BitRate    int
+	Complexity float64
+	// 0 if no CRFs have been provided
+	CRF      float64
+	Duration time.Duration
+	Frames   int
+	Start    time.Duration
+}
+
+// NewContentAdaptiveController creates a new content adaptive controller
+func NewContentAdaptiveController(o ContentAdaptiveControllerOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (cc *ContentAdaptiveController, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countContentAdaptiveController, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("content_adaptive_controller_%d", count), fmt.Sprintf("Content Adaptive Controller #%d", count), "Adapts rate control to content")
+
+	// Check options
+	if o.Encoder == nil {
+		err = errors.New("astilibav: no encoder provided")
+		return
+	}
+	if (o.MinCRF <= 0 || o.MaxCRF < o.MinCRF) && (o.MinBitRate <= 0 || o.MaxBitRate < o.MinBitRate) {
+		err = errors.New("astilibav: neither valid crfs nor valid bit rates provided")
+		return
+	}
+
+	// Default values
+	if o.HighComplexity <= 0 {
+		o.HighComplexity = defaultContentAdaptiveControllerHighComplexity
+	}
+	if o.LowComplexity <= 0 {
+		o.LowComplexity = defaultContentAdaptiveControllerLowComplexity
+	}
+	if o.MaxLookAhead <= 0 {
+		o.MaxLookAhead = defaultContentAdaptiveControllerMaxLookAhead
+	}
+	if o.SampleStep <= 0 {
+		o.SampleStep = defaultSceneDetectorSampleStep
+	}
+	if o.Threshold <= 0 {
+		o.Threshold = defaultSceneDetectorThreshold
+	}
+
+	// Create content adaptive controller
+	cc = &ContentAdaptiveController{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh:               eh,
+		o:                o,
+		p:                newFramePool(c),
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statWorkRatio:    astikit.NewDurationPercentageStat(),
+	}
+	cc.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(cc), eh)
+	cc.d = newFrameDispatcher(cc, eh, c)
+	cc.addStats()
+	return
+}
+
+func (cc *ContentAdaptiveController) addStats() {
+	// Add incoming rate
+	cc.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of frames coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "fps",
+	}, cc.statIncomingRate)
+
+	// Add work ratio
+	cc.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, cc.statWorkRatio)
+
+	// Add dispatcher stats
+	cc.d.addStats(cc.Stater())
+
+	// Add chan stats
+	cc.c.AddStats(cc.Stater())
+}
+
+// Connect implements the FrameHandlerConnector interface
+func (cc *ContentAdaptiveController) Connect(h FrameHandler) {
+	// Add handler
+	cc.d.addHandler(h)
+
+	// Connect nodes
+	astiencoder.ConnectNodes(cc, h)
+}
+
+// Disconnect implements the FrameHandlerConnector interface
+func (cc *ContentAdaptiveController) Disconnect(h FrameHandler) {
+	// Delete handler
+	cc.d.delHandler(h)
+
+	// Disconnect nodes
+	astiencoder.DisconnectNodes(cc, h)
+}
+
+// Snapshot implements the astiencoder.Snapshotter interface
+func (cc *ContentAdaptiveController) Snapshot(ctx context.Context) (image.Image, error) {
+	return cc.d.snapshot(ctx)
+}
+
+// Start starts the content adaptive controller
+func (cc *ContentAdaptiveController) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	cc.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to wait for all dispatcher subprocesses to be done so that they are properly closed
+		defer cc.d.wait()
+
+		// Make sure to dispatch the remaining chunk
+		defer cc.flush()
+
+		// Make sure to stop the chan properly
+		defer cc.c.Stop()
+
+		// Start chan
+		cc.c.Start(cc.Context())
+	})
+}
+
+// HandleFrame implements the FrameHandler interface
+func (cc *ContentAdaptiveController) HandleFrame(p *FrameHandlerPayload) {
+	cc.c.Add(func() {
+		// Handle pause
+		defer cc.HandlePause()
+
+		// Increment incoming rate
+		cc.statIncomingRate.Add(1)
+
+		// Sample frame
+		cc.statWorkRatio.Begin()
+		cc.prevSamples, cc.samples = cc.samples, sceneDetectorSamples(cc.prevSamples, p.Frame, cc.o.SampleStep)
+		var score float64
+		score, cc.prevMafd = sceneDetectorScore(cc.prevSamples, cc.samples, cc.prevMafd)
+		cc.statWorkRatio.End()
+
+		// Chunk is complete
+		if cc.chunkIsComplete(p.Frame, p.Descriptor, score) {
+			cc.flush()
+		}
+
+		// Copy frame
+		f := cc.p.get()
+		if ret := defaultBindings.frameRef(f, p.Frame); ret < 0 {
+			emitAvError(cc, cc.eh, ret, "avutil.AvFrameRef failed")
+			cc.p.put(f)
+			return
+		}
+
+		// Update complexity
+		// Temporal activity is meaningless for the first frame of a chunk
+		cc.statWorkRatio.Begin()
+		cc.complexity += contentAdaptiveSpatialActivity(cc.samples, (p.Frame.Width()+cc.o.SampleStep-1)/cc.o.SampleStep)
+		if len(cc.buf) > 0 {
+			cc.complexity += cc.prevMafd
+		}
+		cc.statWorkRatio.End()
+
+		// Append frame
+		cc.buf = append(cc.buf, f)
+		cc.descriptor = p.Descriptor
+		cc.ms = append(cc.ms, p.Metadata)
+	})
+}
+
+func (cc *ContentAdaptiveController) chunkIsComplete(f *avutil.Frame, d Descriptor, score float64) bool {
+	// No chunk
+	if len(cc.buf) == 0 {
+		return false
+	}
+
+	// New scene
+	if score >= cc.o.Threshold {
+		return true
+	}
+
+	// Max look ahead has been reached
+	return time.Duration(avutil.AvRescaleQ(f.Pts()-cc.buf[0].Pts(), d.TimeBase(), nanosecondRational)) >= cc.o.MaxLookAhead
+}
+
+func (cc *ContentAdaptiveController) flush() {
+	// Nothing to flush
+	if len(cc.buf) == 0 {
+		return
+	}
+
+	// Make sure frames are put back in the pool
+	defer func() {
+		for _, f := range cc.buf {
+			cc.p.put(f)
+		}
+		cc.buf = cc.buf[:0]
+		cc.complexity = 0
+		cc.ms = cc.ms[:0]
+	}()
+
+	// Create adjustment
+	a := cc.o.adjustment(cc.complexity / float64(len(cc.buf)))
+	a.Frames = len(cc.buf)
+	a.Start = time.Duration(avutil.AvRescaleQ(cc.buf[0].Pts(), cc.descriptor.TimeBase(), nanosecondRational))
+	a.Duration = time.Duration(avutil.AvRescaleQ(cc.buf[len(cc.buf)-1].Pts()-cc.buf[0].Pts(), cc.descriptor.TimeBase(), nanosecondRational))
+
+	// Previous frames must have reached the encoder before its rate control is updated
+	cc.d.wait()
+
+	// Update rate control
+	cc.o.Encoder.UpdateRateControl(EncoderRateControl{
+		BitRate: a.BitRate,
+		CRF:     a.CRF,
+	})
+
+	// Send event
+	cc.eh.Emit(astiencoder.Event{
+		Name:    EventNameContentAdaptiveControllerAdjusted,
+		Payload: a,
+		Target:  cc,
+	})
+
+	// Dispatch frames
+	for idx, f := range cc.buf {
+		cc.d.dispatch(f, cc.descriptor, cc.ms[idx])
+	}
+}
+
+// adjustment interpolates linearly between the min and max values based on where the complexity stands between the
+// low and high complexities
+func (o ContentAdaptiveControllerOptions) adjustment(complexity float64) (a ContentAdaptiveAdjustment) {
+	// Get ratio
+	a.Complexity = complexity
+	r := 1.0
+	if o.HighComplexity > o.LowComplexity {
+		r = math.Max(0, math.Min(1, (complexity-o.LowComplexity)/(o.HighComplexity-o.LowComplexity)))
+	}
+
+	// Interpolate
+	if o.MinCRF > 0 && o.MaxCRF >= o.MinCRF {
+		a.CRF = o.MaxCRF - r*(o.MaxCRF-o.MinCRF)
+	}
+	if o.MinBitRate > 0 && o.MaxBitRate >= o.MinBitRate {
+		a.BitRate = o.MinBitRate + int(math.Round(r*float64(o.MaxBitRate-o.MinBitRate)))
+	}
+	return
+}
+
+// contentAdaptiveSpatialActivity returns the mean absolute difference between each sample and its right and
+// bottom neighbours, between 0 and 1
+func contentAdaptiveSpatialActivity(samples []uint8, cols int) float64 {
+	// Samples can't be processed
+	if cols <= 0 || len(samples) < cols {
+		return 0
+	}
+
+	// Loop through samples
+	var sum, n uint64
+	diff := func(a, b uint8) uint64 {
+		if a > b {
+			return uint64(a - b)
+		}
+		return uint64(b - a)
+	}
+	for idx, v := range samples {
+		if (idx+1)%cols != 0 && idx+1 < len(samples) {
+			sum += diff(v, samples[idx+1])
+			n++
+		}
+		if idx+cols < len(samples) {
+			sum += diff(v, samples[idx+cols])
+			n++
+		}
+	}
+
+	// No neighbours
+	if n == 0 {
+		return 0
+	}
+	return float64(sum) / float64(n) / 255
+}
@@ -0,0 +1,30 @@
+package astilibav
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentAdaptiveControllerOptionsAdjustment(t *testing.T) {
+	o := ContentAdaptiveControllerOptions{
+		HighComplexity: 0.3,
+		LowComplexity:  0.1,
+		MaxBitRate:     3000,
+		MaxCRF:         28,
+		MinBitRate:     1000,
+		MinCRF:         18,
+	}
+	assert.Equal(t, ContentAdaptiveAdjustment{BitRate: 1000, Complexity: 0.05, CRF: 28}, o.adjustment(0.05))
+	assert.Equal(t, ContentAdaptiveAdjustment{BitRate: 2000, Complexity: 0.2, CRF: 23}, o.adjustment(0.2))
+	assert.Equal(t, ContentAdaptiveAdjustment{BitRate: 3000, Complexity: 0.5, CRF: 18}, o.adjustment(0.5))
+	o.MinBitRate = 0
+	assert.Equal(t, 0, o.adjustment(0.2).BitRate)
+}
+
+func TestContentAdaptiveSpatialActivity(t *testing.T) {
+	assert.Equal(t, 0.0, contentAdaptiveSpatialActivity([]uint8{1, 1, 1, 1}, 2))
+	assert.Equal(t, 0.0, contentAdaptiveSpatialActivity([]uint8{1}, 0))
+	assert.InDelta(t, 0.5, contentAdaptiveSpatialActivity([]uint8{0, 255, 0, 255}, 2), 0.0001)
+	assert.InDelta(t, 1.0, contentAdaptiveSpatialActivity([]uint8{0, 255, 0}, 3), 0.0001)
+}
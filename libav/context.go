@@ -2,7 +2,6 @@ package astilibav
 
 import (
 	"fmt"
-	"unsafe"
 
 	"github.com/asticode/goav/avcodec"
 	"github.com/asticode/goav/avformat"
@@ -18,6 +17,8 @@ type Context struct {
 	CodecType    avcodec.MediaType
 	Dict         string
 	GlobalHeader bool
+	Level        int
+	Profile      int
 	ThreadCount  *int
 	TimeBase     avutil.Rational
 
@@ -28,40 +29,27 @@ type Context struct {
 	SampleRate    int
 
 	// Video
-	FrameRate         avutil.Rational
-	GopSize           int
-	Height            int
+	BitDepth int
+	// Values are the ones of AVColorPrimaries, AVColorRange, AVColorSpace and AVColorTransferCharacteristic
+	ColorPrimaries int
+	ColorRange     int
+	ColorSpace     int
+	ColorTransfer  int
+	// HDR static metadata. Nil if unknown
+	ContentLightLevel *ContentLightLevel
+	// Value is the one of AVFieldOrder
+	FieldOrder int
+	FrameRate  avutil.Rational
+	// Not retrieved from streams since it's not part of codec parameters. If <= 0, the encoder default is used
+	GopSize int
+	Height  int
+	// HDR static metadata. Nil if unknown
+	MasteringDisplay  *MasteringDisplay
 	PixelFormat       avutil.PixelFormat
 	SampleAspectRatio avutil.Rational
 	Width             int
 }
 
-// NewContextFromStream creates a new context from a stream
-func NewContextFromStream(s *avformat.Stream) Context {
-	ctxCodec := (*avcodec.Context)(unsafe.Pointer(s.Codec()))
-	return Context{
-		// Shared
-		BitRate:   ctxCodec.BitRate(),
-		CodecID:   s.CodecParameters().CodecId(),
-		CodecType: s.CodecParameters().CodecType(),
-		TimeBase:  s.TimeBase(),
-
-		// Audio
-		ChannelLayout: ctxCodec.ChannelLayout(),
-		Channels:      ctxCodec.Channels(),
-		SampleFmt:     ctxCodec.SampleFmt(),
-		SampleRate:    ctxCodec.SampleRate(),
-
-		// Video
-		FrameRate:         streamFrameRate(s),
-		GopSize:           ctxCodec.GopSize(),
-		Height:            ctxCodec.Height(),
-		PixelFormat:       ctxCodec.PixFmt(),
-		SampleAspectRatio: s.SampleAspectRatio(),
-		Width:             ctxCodec.Width(),
-	}
-}
-
 func streamFrameRate(s *avformat.Stream) avutil.Rational {
 	if v := s.AvgFrameRate(); v.Num() > 0 {
 		return s.AvgFrameRate()
@@ -0,0 +1,260 @@
+package astilibav
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"sync"
+	"sync/atomic"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+)
+
+var countCorrelator uint64
+
+// correlator holds the correlation data attached to the units going through a correlator node
+// Since decoders, encoders and filterers match outgoing units with incoming units through their pts, correlation
+// data survives decode and encode boundaries
+type correlator struct {
+	data map[string]string
+	m    *sync.Mutex
+}
+
+// CorrelatorOptions represents correlator options
+type CorrelatorOptions struct {
+	// Correlation data attached from the start
+	Data map[string]string
+	Node astiencoder.NodeOptions
+}
+
+func newCorrelator(o CorrelatorOptions) *correlator {
+	c := &correlator{
+		data: make(map[string]string),
+		m:    &sync.Mutex{},
+	}
+	for k, v := range o.Data {
+		c.data[k] = v
+	}
+	return c
+}
+
+// Set attaches the correlation key/value to the next units
+func (c *correlator) Set(k, v string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.data[k] = v
+}
+
+// Delete stops attaching the correlation key to the next units
+func (c *correlator) Delete(k string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	delete(c.data, k)
+}
+
+func (c *correlator) correlate(m *UnitMetadata) *UnitMetadata {
+	// Lock
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	// No correlation data
+	if len(c.data) == 0 {
+		return m
+	}
+
+	// Add correlation data
+	for k, v := range c.data {
+		m = m.With(k, v)
+	}
+	return m
+}
+
+// FrameCorrelator represents an object capable of attaching correlation data, such as an ingest request id or an ad
+// break id, to the metadata of the frames going through it
+type FrameCorrelator struct {
+	*astiencoder.BaseNode
+	*correlator
+	c                *astikit.Chan
+	d                *frameDispatcher
+	statIncomingRate *astikit.CounterAvgStat
+}
+
+// NewFrameCorrelator creates a new frame correlator
+func NewFrameCorrelator(o CorrelatorOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (r *FrameCorrelator) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countCorrelator, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("frame_correlator_%d", count), fmt.Sprintf("Frame Correlator #%d", count), "Correlates frames")
+
+	// Create correlator
+	r = &FrameCorrelator{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		correlator:       newCorrelator(o),
+		statIncomingRate: astikit.NewCounterAvgStat(),
+	}
+	r.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(r), eh)
+	r.d = newFrameDispatcher(r, eh, c)
+	r.addStats()
+	return
+}
+
+func (r *FrameCorrelator) addStats() {
+	// Add incoming rate
+	r.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of frames coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "fps",
+	}, r.statIncomingRate)
+
+	// Add dispatcher stats
+	r.d.addStats(r.Stater())
+
+	// Add chan stats
+	r.c.AddStats(r.Stater())
+}
+
+// Connect implements the FrameHandlerConnector interface
+func (r *FrameCorrelator) Connect(h FrameHandler) {
+	// Add handler
+	r.d.addHandler(h)
+
+	// Connect nodes
+	astiencoder.ConnectNodes(r, h)
+}
+
+// Disconnect implements the FrameHandlerConnector interface
+func (r *FrameCorrelator) Disconnect(h FrameHandler) {
+	// Delete handler
+	r.d.delHandler(h)
+
+	// Disconnect nodes
+	astiencoder.DisconnectNodes(r, h)
+}
+
+// Snapshot implements the astiencoder.Snapshotter interface
+func (r *FrameCorrelator) Snapshot(ctx context.Context) (image.Image, error) {
+	return r.d.snapshot(ctx)
+}
+
+// Start starts the correlator
+func (r *FrameCorrelator) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	r.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to wait for all dispatcher subprocesses to be done so that they are properly closed
+		defer r.d.wait()
+
+		// Make sure to stop the chan properly
+		defer r.c.Stop()
+
+		// Start chan
+		r.c.Start(r.Context())
+	})
+}
+
+// HandleFrame implements the FrameHandler interface
+func (r *FrameCorrelator) HandleFrame(p *FrameHandlerPayload) {
+	r.c.Add(func() {
+		// Handle pause
+		defer r.HandlePause()
+
+		// Increment incoming rate
+		r.statIncomingRate.Add(1)
+
+		// Dispatch frame
+		r.d.dispatch(p.Frame, p.Descriptor, r.correlate(p.Metadata))
+	})
+}
+
+// PktCorrelator represents an object capable of attaching correlation data, such as an ingest request id or an ad
+// break id, to the metadata of the pkts going through it
+type PktCorrelator struct {
+	*astiencoder.BaseNode
+	*correlator
+	c                *astikit.Chan
+	d                *pktDispatcher
+	statIncomingRate *astikit.CounterAvgStat
+}
+
+// NewPktCorrelator creates a new pkt correlator
+func NewPktCorrelator(o CorrelatorOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (r *PktCorrelator) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countCorrelator, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("pkt_correlator_%d", count), fmt.Sprintf("Pkt Correlator #%d", count), "Correlates pkts")
+
+	// Create correlator
+	r = &PktCorrelator{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		correlator:       newCorrelator(o),
+		statIncomingRate: astikit.NewCounterAvgStat(),
+	}
+	r.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(r), eh)
+	r.d = newPktDispatcher(r, eh, c)
+	r.addStats()
+	return
+}
+
+func (r *PktCorrelator) addStats() {
+	// Add incoming rate
+	r.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of packets coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "pps",
+	}, r.statIncomingRate)
+
+	// Add dispatcher stats
+	r.d.addStats(r.Stater())
+
+	// Add chan stats
+	r.c.AddStats(r.Stater())
+}
+
+// Connect implements the PktHandlerConnector interface
+func (r *PktCorrelator) Connect(h PktHandler) {
+	// Add handler
+	r.d.addHandler(h)
+
+	// Connect nodes
+	astiencoder.ConnectNodes(r, h)
+}
+
+// Disconnect implements the PktHandlerConnector interface
+func (r *PktCorrelator) Disconnect(h PktHandler) {
+	// Delete handler
+	r.d.delHandler(h)
+
+	// Disconnect nodes
+	astiencoder.DisconnectNodes(r, h)
+}
+
+// Start starts the correlator
+func (r *PktCorrelator) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	r.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to wait for all dispatcher subprocesses to be done so that they are properly closed
+		defer r.d.wait()
+
+		// Make sure to stop the chan properly
+		defer r.c.Stop()
+
+		// Start chan
+		r.c.Start(r.Context())
+	})
+}
+
+// HandlePkt implements the PktHandler interface
+func (r *PktCorrelator) HandlePkt(p *PktHandlerPayload) {
+	r.c.Add(func() {
+		// Handle pause
+		defer r.HandlePause()
+
+		// Increment incoming rate
+		r.statIncomingRate.Add(1)
+
+		// Dispatch pkt
+		r.d.dispatch(p.Pkt, p.Descriptor, r.correlate(p.Metadata))
+	})
+}
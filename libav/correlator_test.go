@@ -0,0 +1,20 @@
+package astilibav
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCorrelator(t *testing.T) {
+	c := newCorrelator(CorrelatorOptions{Data: map[string]string{"request": "1"}})
+	m := c.correlate(nil)
+	assert.Equal(t, map[string]string{"request": "1"}, m.Data)
+	c.Set("ad_break", "2")
+	m2 := c.correlate(&UnitMetadata{Discontinuity: true})
+	assert.True(t, m2.Discontinuity)
+	assert.Equal(t, map[string]string{"ad_break": "2", "request": "1"}, m2.Data)
+	c.Delete("ad_break")
+	c.Delete("request")
+	assert.Equal(t, m, c.correlate(m))
+}
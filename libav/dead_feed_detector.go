@@ -0,0 +1,350 @@
+package astilibav
+
+//#cgo pkg-config: libavutil
+//#include <libavutil/frame.h>
+//#include <libavutil/pixfmt.h>
+import "C"
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+)
+
+var countDeadFeedDetector uint64
+
+// Default dead feed detector values
+const (
+	defaultDeadFeedDetectorBlackPixelThreshold = 0.1
+	defaultDeadFeedDetectorBlackRatio          = 0.98
+	defaultDeadFeedDetectorFrozenThreshold     = 0.001
+	defaultDeadFeedDetectorMinDuration         = 2 * time.Second
+	defaultDeadFeedDetectorSilenceThreshold    = -60
+)
+
+// Dead feed defect types
+const (
+	DeadFeedDefectTypeBlack   = "black"
+	DeadFeedDefectTypeFrozen  = "frozen"
+	DeadFeedDefectTypeSilence = "silence"
+)
+
+// DeadFeedDetector represents an object capable of detecting audio silence and black or frozen video frames lasting
+// longer than a min duration
+// An EventNameDeadFeedDetectorDefectStarted event is emitted once the min duration is reached and an
+// EventNameDeadFeedDetectorDefectEnded event is emitted when the defect ends or when the end of stream is reached.
+// Both have a DeadFeedDefect payload
+// It doesn't forward anything and it should be connected to at most one audio node and one video node
+type DeadFeedDetector struct {
+	*astiencoder.BaseNode
+	black            *deadFeedTracker
+	c                *astikit.Chan
+	eh               *astiencoder.EventHandler
+	frozen           *deadFeedTracker
+	last             *time.Duration
+	o                DeadFeedDetectorOptions
+	prevSamples      []uint8
+	samples          []uint8
+	silence          *deadFeedTracker
+	statIncomingRate *astikit.CounterAvgStat
+	statWorkRatio    *astikit.DurationPercentageStat
+}
+
+// DeadFeedDetectorOptions represents dead feed detector options
+type DeadFeedDetectorOptions struct {
+	// Luma value between 0 and 1 below which a pixel is considered black. Defaults to 0.1
+	BlackPixelThreshold float64
+	// Ratio of black pixels between 0 and 1 above which a frame is considered black. Defaults to 0.98
+	BlackRatio float64
+	// Mean absolute difference between 0 and 1 with the previous frame below which a frame is considered frozen.
+	// Defaults to 0.001
+	FrozenThreshold float64
+	// Defaults to 2s
+	MinDuration time.Duration
+	Node        astiencoder.NodeOptions
+	// Number of pixels between 2 samples, both horizontally and vertically. Defaults to 8
+	SampleStep int
+	// RMS level in dBFS below which audio is considered silent. Defaults to -60
+	SilenceThreshold float64
+}
+
+// DeadFeedDefect represents a dead feed defect
+type DeadFeedDefect struct {
+	// Only set when the defect has ended
+	Duration time.Duration
+	// Only set when the defect has ended
+	End   time.Duration
+	Start time.Duration
+	// Possible values are "black", "frozen" and "silence"
+	Type string
+}
+
+// NewDeadFeedDetector creates a new dead feed detector
+func NewDeadFeedDetector(o DeadFeedDetectorOptions, eh *astiencoder.EventHandler) (d *DeadFeedDetector) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countDeadFeedDetector, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("dead_feed_detector_%d", count), fmt.Sprintf("Dead Feed Detector #%d", count), "Detects dead feeds")
+
+	// Default values
+	if o.BlackPixelThreshold <= 0 {
+		o.BlackPixelThreshold = defaultDeadFeedDetectorBlackPixelThreshold
+	}
+	if o.BlackRatio <= 0 {
+		o.BlackRatio = defaultDeadFeedDetectorBlackRatio
+	}
+	if o.FrozenThreshold <= 0 {
+		o.FrozenThreshold = defaultDeadFeedDetectorFrozenThreshold
+	}
+	if o.MinDuration <= 0 {
+		o.MinDuration = defaultDeadFeedDetectorMinDuration
+	}
+	if o.SampleStep <= 0 {
+		o.SampleStep = defaultSceneDetectorSampleStep
+	}
+	if o.SilenceThreshold == 0 {
+		o.SilenceThreshold = defaultDeadFeedDetectorSilenceThreshold
+	}
+
+	// Create dead feed detector
+	d = &DeadFeedDetector{
+		black: newDeadFeedTracker(DeadFeedDefectTypeBlack),
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh:               eh,
+		frozen:           newDeadFeedTracker(DeadFeedDefectTypeFrozen),
+		o:                o,
+		silence:          newDeadFeedTracker(DeadFeedDefectTypeSilence),
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statWorkRatio:    astikit.NewDurationPercentageStat(),
+	}
+	d.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(d), eh)
+	d.addStats()
+	return
+}
+
+func (d *DeadFeedDetector) addStats() {
+	// Add incoming rate
+	d.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of frames coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "fps",
+	}, d.statIncomingRate)
+
+	// Add work ratio
+	d.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, d.statWorkRatio)
+
+	// Add chan stats
+	d.c.AddStats(d.Stater())
+}
+
+// Start starts the dead feed detector
+func (d *DeadFeedDetector) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	d.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to stop the chan properly
+		defer d.c.Stop()
+
+		// Start chan
+		d.c.Start(d.Context())
+	})
+}
+
+// HandleEOS implements the EOSHandler interface
+func (d *DeadFeedDetector) HandleEOS(p *EOSHandlerPayload) {
+	d.c.Add(func() {
+		// Nothing has been received
+		if d.last == nil {
+			return
+		}
+
+		// End ongoing defects
+		for _, t := range []*deadFeedTracker{d.black, d.frozen, d.silence} {
+			if df, ended := t.update(*d.last, false, d.o.MinDuration); df != nil && ended {
+				d.emit(EventNameDeadFeedDetectorDefectEnded, *df)
+			}
+		}
+	})
+}
+
+// HandleFrame implements the FrameHandler interface
+func (d *DeadFeedDetector) HandleFrame(p *FrameHandlerPayload) {
+	d.c.Add(func() {
+		// Handle pause
+		defer d.HandlePause()
+
+		// Increment incoming rate
+		d.statIncomingRate.Add(1)
+
+		// Get time
+		if p.Frame.Pts() == avutil.AV_NOPTS_VALUE || p.Descriptor == nil {
+			return
+		}
+		at := time.Duration(avutil.AvRescaleQ(p.Frame.Pts(), p.Descriptor.TimeBase(), nanosecondRational))
+		d.last = &at
+
+		// Video
+		if p.Frame.Width() > 0 && p.Frame.Height() > 0 {
+			// Detect
+			d.statWorkRatio.Begin()
+			black, frozen := d.detectVideo(p.Frame)
+			d.statWorkRatio.End()
+
+			// Update
+			d.update(d.black, at, black)
+			d.update(d.frozen, at, frozen)
+			return
+		}
+
+		// Get samples
+		d.statWorkRatio.Begin()
+		s, err := frameExporterSamples(p.Frame)
+		if err != nil {
+			d.statWorkRatio.End()
+			d.eh.Emit(astiencoder.EventError(d, fmt.Errorf("astilibav: getting samples failed: %w", err)))
+			return
+		}
+
+		// Detect
+		silent := deadFeedDetectorLevel(s) < d.o.SilenceThreshold
+		d.statWorkRatio.End()
+
+		// Update
+		d.update(d.silence, at, silent)
+	})
+}
+
+func (d *DeadFeedDetector) detectVideo(f *avutil.Frame) (black, frozen bool) {
+	// Sample frame
+	d.prevSamples, d.samples = d.samples, sceneDetectorSamples(d.prevSamples, f, d.o.SampleStep)
+
+	// Get black pixel threshold the same way ffmpeg's blackdetect filter does
+	th := uint8(16 + d.o.BlackPixelThreshold*(235-16))
+	switch (*C.AVFrame)(unsafe.Pointer(f)).format {
+	case C.AV_PIX_FMT_YUVJ420P, C.AV_PIX_FMT_YUVJ422P, C.AV_PIX_FMT_YUVJ440P, C.AV_PIX_FMT_YUVJ444P:
+		th = uint8(d.o.BlackPixelThreshold * 255)
+	}
+
+	// Detect
+	black = deadFeedDetectorBlackRatio(d.samples, th) >= d.o.BlackRatio
+	if len(d.prevSamples) > 0 && len(d.prevSamples) == len(d.samples) {
+		_, mafd := sceneDetectorScore(d.prevSamples, d.samples, 0)
+		frozen = mafd < d.o.FrozenThreshold
+	}
+	return
+}
+
+func (d *DeadFeedDetector) update(t *deadFeedTracker, at time.Duration, defect bool) {
+	// Update tracker
+	df, ended := t.update(at, defect, d.o.MinDuration)
+	if df == nil {
+		return
+	}
+
+	// Emit
+	if ended {
+		d.emit(EventNameDeadFeedDetectorDefectEnded, *df)
+	} else {
+		d.emit(EventNameDeadFeedDetectorDefectStarted, *df)
+	}
+}
+
+func (d *DeadFeedDetector) emit(eventName string, df DeadFeedDefect) {
+	d.eh.Emit(astiencoder.Event{
+		Name:    eventName,
+		Payload: df,
+		Target:  d,
+	})
+}
+
+// deadFeedDetectorBlackRatio returns the ratio of samples lower than or equal to the threshold
+func deadFeedDetectorBlackRatio(s []uint8, th uint8) float64 {
+	if len(s) == 0 {
+		return 0
+	}
+	var n int
+	for _, v := range s {
+		if v <= th {
+			n++
+		}
+	}
+	return float64(n) / float64(len(s))
+}
+
+// deadFeedDetectorLevel returns the RMS level of normalized samples in dBFS
+func deadFeedDetectorLevel(s []float64) float64 {
+	// Loop through samples
+	var sum float64
+	for _, v := range s {
+		sum += v * v
+	}
+
+	// No samples or only zeros
+	if len(s) == 0 || sum == 0 {
+		return math.Inf(-1)
+	}
+	return 10 * math.Log10(sum/float64(len(s)))
+}
+
+type deadFeedTracker struct {
+	reported bool
+	start    *time.Duration
+	t        string
+}
+
+func newDeadFeedTracker(t string) *deadFeedTracker {
+	return &deadFeedTracker{t: t}
+}
+
+// update returns the defect that has either started or ended at the provided time, if any
+// A defect starts once it has lasted at least the min duration
+func (t *deadFeedTracker) update(at time.Duration, defect bool, minDuration time.Duration) (d *DeadFeedDefect, ended bool) {
+	// Defect
+	if defect {
+		// Store start
+		if t.start == nil {
+			t.start = &at
+		}
+
+		// Min duration has been reached
+		if !t.reported && at-*t.start >= minDuration {
+			t.reported = true
+			d = &DeadFeedDefect{
+				Start: *t.start,
+				Type:  t.t,
+			}
+		}
+		return
+	}
+
+	// No defect
+	if t.start == nil {
+		return
+	}
+
+	// Defect has ended
+	if t.reported {
+		d = &DeadFeedDefect{
+			Duration: at - *t.start,
+			End:      at,
+			Start:    *t.start,
+			Type:     t.t,
+		}
+		ended = true
+	}
+
+	// Reset
+	t.reported = false
+	t.start = nil
+	return
+}
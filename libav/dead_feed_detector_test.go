@@ -0,0 +1,48 @@
+package astilibav
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadFeedDetectorBlackRatio(t *testing.T) {
+	assert.Equal(t, float64(0), deadFeedDetectorBlackRatio(nil, 16))
+	assert.Equal(t, 0.75, deadFeedDetectorBlackRatio([]uint8{0, 16, 10, 17}, 16))
+}
+
+func TestDeadFeedDetectorLevel(t *testing.T) {
+	assert.True(t, math.IsInf(deadFeedDetectorLevel(nil), -1))
+	assert.True(t, math.IsInf(deadFeedDetectorLevel([]float64{0, 0}), -1))
+	assert.InDelta(t, -6.0206, deadFeedDetectorLevel([]float64{0.5, -0.5}), 0.0001)
+}
+
+func TestDeadFeedTracker(t *testing.T) {
+	tr := newDeadFeedTracker(DeadFeedDefectTypeBlack)
+	d, ended := tr.update(0, false, 2*time.Second)
+	assert.Nil(t, d)
+	assert.False(t, ended)
+
+	// Defect shorter than min duration
+	d, _ = tr.update(time.Second, true, 2*time.Second)
+	assert.Nil(t, d)
+	d, ended = tr.update(2*time.Second, false, 2*time.Second)
+	assert.Nil(t, d)
+	assert.False(t, ended)
+
+	// Defect longer than min duration
+	d, _ = tr.update(3*time.Second, true, 2*time.Second)
+	assert.Nil(t, d)
+	d, ended = tr.update(5*time.Second, true, 2*time.Second)
+	assert.Equal(t, &DeadFeedDefect{Start: 3 * time.Second, Type: DeadFeedDefectTypeBlack}, d)
+	assert.False(t, ended)
+	d, _ = tr.update(6*time.Second, true, 2*time.Second)
+	assert.Nil(t, d)
+	d, ended = tr.update(7*time.Second, false, 2*time.Second)
+	assert.Equal(t, &DeadFeedDefect{Duration: 4 * time.Second, End: 7 * time.Second, Start: 3 * time.Second, Type: DeadFeedDefectTypeBlack}, d)
+	assert.True(t, ended)
+	d, _ = tr.update(8*time.Second, false, 2*time.Second)
+	assert.Nil(t, d)
+}
@@ -3,6 +3,7 @@ package astilibav
 import (
 	"context"
 	"fmt"
+	"image"
 	"sync/atomic"
 
 	"github.com/asticode/go-astiencoder"
@@ -20,6 +21,10 @@ type Decoder struct {
 	ctxCodec         *avcodec.Context
 	d                *frameDispatcher
 	eh               *astiencoder.EventHandler
+	flush            bool
+	hardwareFrames   bool
+	mt               *unitMetadataTracker
+	previous         Descriptor
 	statIncomingRate *astikit.CounterAvgStat
 	statWorkRatio    *astikit.DurationPercentageStat
 }
@@ -27,7 +32,14 @@ type Decoder struct {
 // DecoderOptions represents decoder options
 type DecoderOptions struct {
 	CodecParams *avcodec.CodecParameters
-	Node        astiencoder.NodeOptions
+	// If provided, frames are decoded by the hardware device when the codec supports it. Otherwise they're decoded by the
+	// CPU
+	HardwareDevice *HWDevice
+	// If true, hardware frames are dispatched as is instead of being downloaded to software frames, which is useful
+	// when the next nodes, such as hardware filters or encoders, use the same device. Downloaded frames have the software
+	// pixel format of the device, usually nv12, which may differ from the input's one
+	HardwareFrames bool
+	Node           astiencoder.NodeOptions
 }
 
 // NewDecoder creates a new decoder
@@ -43,6 +55,8 @@ func NewDecoder(o DecoderOptions, eh *astiencoder.EventHandler, c *astikit.Close
 			ProcessAll:  true,
 		}),
 		eh:               eh,
+		hardwareFrames:   o.HardwareFrames,
+		mt:               newUnitMetadataTracker(),
 		statIncomingRate: astikit.NewCounterAvgStat(),
 		statWorkRatio:    astikit.NewDurationPercentageStat(),
 	}
@@ -69,6 +83,14 @@ func NewDecoder(o DecoderOptions, eh *astiencoder.EventHandler, c *astikit.Close
 		return
 	}
 
+	// Set hardware device
+	if o.HardwareDevice != nil {
+		if err = d.setHWDevice(cdc, o.HardwareDevice, c); err != nil {
+			err = fmt.Errorf("astilibav: setting hardware device failed: %w", err)
+			return
+		}
+	}
+
 	// Open codec
 	if ret := d.ctxCodec.AvcodecOpen2(cdc, nil); ret < 0 {
 		err = fmt.Errorf("astilibav: d.ctxCodec.AvcodecOpen2 failed: %w", NewAvError(ret))
@@ -125,6 +147,11 @@ func (d *Decoder) Disconnect(h FrameHandler) {
 	astiencoder.DisconnectNodes(d, h)
 }
 
+// Snapshot implements the astiencoder.Snapshotter interface
+func (d *Decoder) Snapshot(ctx context.Context) (image.Image, error) {
+	return d.d.snapshot(ctx)
+}
+
 // Start starts the decoder
 func (d *Decoder) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
 	d.BaseNode.Start(ctx, t, func(t *astikit.Task) {
@@ -148,6 +175,19 @@ func (d *Decoder) HandlePkt(p *PktHandlerPayload) {
 		// Increment incoming rate
 		d.statIncomingRate.Add(1)
 
+		// Drop buffered frames
+		if p.Metadata != nil && p.Metadata.Flush {
+			d.ctxCodec.AvcodecFlushBuffers()
+			d.mt = newUnitMetadataTracker()
+			d.flush = true
+		}
+
+		// Keep track of metadata
+		d.mt.add(p.Pkt.Pts(), p.Metadata)
+
+		// Keep track of descriptor so that frames can be drained on end of stream
+		d.previous = p.Descriptor
+
 		// Send pkt to decoder
 		d.statWorkRatio.Begin()
 		if ret := avcodec.AvcodecSendPacket(d.ctxCodec, p.Pkt); ret < 0 {
@@ -167,6 +207,34 @@ func (d *Decoder) HandlePkt(p *PktHandlerPayload) {
 	})
 }
 
+// HandleEOS implements the EOSHandler interface
+func (d *Decoder) HandleEOS(p *EOSHandlerPayload) {
+	d.c.Add(func() {
+		// Send flush pkt to decoder
+		d.statWorkRatio.Begin()
+		if ret := avcodec.AvcodecSendPacket(d.ctxCodec, nil); ret < 0 {
+			d.statWorkRatio.End()
+			emitAvError(d, d.eh, ret, "avcodec.AvcodecSendPacket failed")
+			return
+		}
+		d.statWorkRatio.End()
+
+		// Drain frames
+		for {
+			if stop := d.receiveFrame(d.previous); stop {
+				break
+			}
+		}
+
+		// Make sure the decoder can be used again
+		d.ctxCodec.AvcodecFlushBuffers()
+		d.mt = newUnitMetadataTracker()
+
+		// Forward end of stream
+		d.d.dispatchEOS()
+	})
+}
+
 func (d *Decoder) receiveFrame(descriptor Descriptor) (stop bool) {
 	// Get frame
 	f := d.d.p.get()
@@ -184,7 +252,26 @@ func (d *Decoder) receiveFrame(descriptor Descriptor) (stop bool) {
 	}
 	d.statWorkRatio.End()
 
+	// Download hardware frame
+	df, err := d.downloadFrame(f)
+	if err != nil {
+		d.eh.Emit(astiencoder.EventError(d, fmt.Errorf("astilibav: downloading frame failed: %w", err)))
+		return
+	}
+	if df != f {
+		defer d.d.p.put(df)
+	}
+
+	// Get metadata
+	m := d.mt.get(f.Pts())
+
+	// Make sure the next nodes are flushed as well
+	if d.flush {
+		m = m.withFlush()
+		d.flush = false
+	}
+
 	// Dispatch frame
-	d.d.dispatch(f, descriptor)
+	d.d.dispatch(df, descriptor, m)
 	return
 }
@@ -0,0 +1,84 @@
+package astilibav
+
+//#cgo pkg-config: libavcodec libavutil
+//#include <errno.h>
+//#include <stdint.h>
+//#include <libavcodec/avcodec.h>
+//#include <libavutil/buffer.h>
+//#include <libavutil/frame.h>
+//#include <libavutil/hwcontext.h>
+//static enum AVPixelFormat astilibav_decoder_hw_get_format(AVCodecContext *ctx, const enum AVPixelFormat *fmts) {
+//	enum AVPixelFormat hw = (enum AVPixelFormat)(intptr_t)ctx->opaque;
+//	for (const enum AVPixelFormat *p = fmts; *p != AV_PIX_FMT_NONE; p++) {
+//		if (*p == hw) return *p;
+//	}
+//	// Fall back to software decoding
+//	return avcodec_default_get_format(ctx, fmts);
+//}
+//static int astilibav_decoder_set_hw_device(AVCodecContext *ctx, const AVCodec *codec, AVBufferRef *device, enum AVHWDeviceType type) {
+//	for (int i = 0;; i++) {
+//		const AVCodecHWConfig *cfg = avcodec_get_hw_config(codec, i);
+//		if (!cfg) return AVERROR(ENOSYS);
+//		if (!(cfg->methods & AV_CODEC_HW_CONFIG_METHOD_HW_DEVICE_CTX) || cfg->device_type != type) continue;
+//		if (!(ctx->hw_device_ctx = av_buffer_ref(device))) return AVERROR(ENOMEM);
+//		ctx->opaque = (void *)(intptr_t)cfg->pix_fmt;
+//		ctx->get_format = astilibav_decoder_hw_get_format;
+//		return 0;
+//	}
+//}
+import "C"
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avutil"
+)
+
+// It must be called before the codec is opened
+func (d *Decoder) setHWDevice(cdc *avcodec.Codec, hd *HWDevice, c *astikit.Closer) (err error) {
+	// Set device
+	cc := (*C.AVCodecContext)(unsafe.Pointer(d.ctxCodec))
+	if ret := C.astilibav_decoder_set_hw_device(cc, (*C.AVCodec)(unsafe.Pointer(cdc)), hd.ctx, hd.t); ret < 0 {
+		err = fmt.Errorf("astilibav: setting %s hardware device failed: %w", hd.Type(), NewAvError(int(ret)))
+		return
+	}
+
+	// Make sure the device ref is freed once the codec is closed
+	c.Add(func() error {
+		C.av_buffer_unref(&cc.hw_device_ctx)
+		return nil
+	})
+	return
+}
+
+// downloadFrame returns a software copy of the frame if it's a hardware one and hardware frames are not dispatched
+// The returned frame must be put back in the pool if it's different from the provided one
+func (d *Decoder) downloadFrame(f *avutil.Frame) (o *avutil.Frame, err error) {
+	// Nothing to download
+	cf := (*C.AVFrame)(unsafe.Pointer(f))
+	if d.hardwareFrames || cf.hw_frames_ctx == nil {
+		o = f
+		return
+	}
+
+	// Get frame from pool
+	o = d.d.p.get()
+
+	// Transfer data
+	co := (*C.AVFrame)(unsafe.Pointer(o))
+	if ret := C.av_hwframe_transfer_data(co, cf, 0); ret < 0 {
+		d.d.p.put(o)
+		err = fmt.Errorf("astilibav: av_hwframe_transfer_data failed: %w", NewAvError(int(ret)))
+		return
+	}
+
+	// Copy props
+	if ret := C.av_frame_copy_props(co, cf); ret < 0 {
+		d.d.p.put(o)
+		err = fmt.Errorf("astilibav: av_frame_copy_props failed: %w", NewAvError(int(ret)))
+		return
+	}
+	return
+}
@@ -0,0 +1,142 @@
+package astilibav
+
+//#cgo pkg-config: libavcodec libavfilter libavformat libavutil
+//#include "compat.h"
+import "C"
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+)
+
+var countDeinterlacer uint64
+
+// Deinterlacer represents an object capable of deinterlacing video frames
+// Only frames flagged as interlaced are deinterlaced, progressive frames go through untouched
+type Deinterlacer struct {
+	*Filterer
+	outputCtx                Context
+	statBottomFieldFirstRate *astikit.CounterAvgStat
+	statProgressiveRate      *astikit.CounterAvgStat
+	statTopFieldFirstRate    *astikit.CounterAvgStat
+}
+
+// DeinterlacerOptions represents deinterlacer options
+type DeinterlacerOptions struct {
+	// If true, one frame is output for each field, which doubles the frame rate. Otherwise one frame is output for
+	// each frame
+	FieldRate bool
+	// Possible values are "bwdif" and "yadif". Defaults to "yadif"
+	Filter    string
+	Input     FiltererInput
+	Node      astiencoder.NodeOptions
+	Restamper FrameRestamper
+}
+
+// NewDeinterlacer creates a new deinterlacer
+func NewDeinterlacer(o DeinterlacerOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (d *Deinterlacer, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countDeinterlacer, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("deinterlacer_%d", count), fmt.Sprintf("Deinterlacer #%d", count), "Deinterlaces")
+
+	// Check input
+	if o.Input.Context.CodecType != avutil.AVMEDIA_TYPE_VIDEO {
+		err = errors.New("astilibav: deinterlacer only handles video")
+		return
+	}
+
+	// Get filter
+	switch o.Filter {
+	case "":
+		o.Filter = "yadif"
+	case "bwdif", "yadif":
+	default:
+		err = fmt.Errorf("astilibav: invalid filter %s", o.Filter)
+		return
+	}
+
+	// Create deinterlacer
+	d = &Deinterlacer{
+		outputCtx:                o.Input.Context,
+		statBottomFieldFirstRate: astikit.NewCounterAvgStat(),
+		statProgressiveRate:      astikit.NewCounterAvgStat(),
+		statTopFieldFirstRate:    astikit.NewCounterAvgStat(),
+	}
+
+	// Get mode
+	mode := "send_frame"
+	if o.FieldRate {
+		mode = "send_field"
+		if f := o.Input.Context.FrameRate; f.Num() > 0 && f.Den() > 0 {
+			d.outputCtx.FrameRate = avutil.NewRational(f.Num()*2, f.Den())
+		}
+		if tb := o.Input.Context.TimeBase; tb.Num() > 0 && tb.Den() > 0 {
+			d.outputCtx.TimeBase = avutil.NewRational(tb.Num(), tb.Den()*2)
+		}
+	}
+
+	// Create filterer
+	// Field order is detected on each frame
+	if d.Filterer, err = NewFilterer(FiltererOptions{
+		Content:   fmt.Sprintf("%s=mode=%s:parity=auto:deint=interlaced", o.Filter, mode),
+		Inputs:    map[string]FiltererInput{"in": o.Input},
+		Node:      o.Node,
+		Restamper: o.Restamper,
+	}, eh, c); err != nil {
+		err = fmt.Errorf("astilibav: creating filterer failed: %w", err)
+		return
+	}
+	d.addStats()
+	return
+}
+
+func (d *Deinterlacer) addStats() {
+	// Add progressive rate
+	d.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of progressive frames coming in per second",
+		Label:       "Progressive rate",
+		Unit:        "fps",
+	}, d.statProgressiveRate)
+
+	// Add top field first rate
+	d.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of interlaced frames with top field first coming in per second",
+		Label:       "Top field first rate",
+		Unit:        "fps",
+	}, d.statTopFieldFirstRate)
+
+	// Add bottom field first rate
+	d.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of interlaced frames with bottom field first coming in per second",
+		Label:       "Bottom field first rate",
+		Unit:        "fps",
+	}, d.statBottomFieldFirstRate)
+}
+
+// HandleFrame implements the FrameHandler interface
+func (d *Deinterlacer) HandleFrame(p *FrameHandlerPayload) {
+	// Detect field order
+	cf := (*C.AVFrame)(unsafe.Pointer(p.Frame))
+	switch {
+	case C.astilibav_frame_interlaced(cf) == 0:
+		d.statProgressiveRate.Add(1)
+	case C.astilibav_frame_top_field_first(cf) != 0:
+		d.statTopFieldFirstRate.Add(1)
+	default:
+		d.statBottomFieldFirstRate.Add(1)
+	}
+
+	// Filter frame
+	d.Filterer.HandleFrame(p)
+}
+
+// OutputCtx returns the context of the frames coming out of the deinterlacer
+// It should be used to create the next nodes, such as the encoder
+func (d *Deinterlacer) OutputCtx() Context {
+	return d.outputCtx
+}
@@ -2,7 +2,10 @@ package astilibav
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -27,17 +30,26 @@ type Demuxer struct {
 	emulateRate   bool
 	interruptRet  *int
 	loop          bool
+	loopCount     int
 	loopFirstPkt  *demuxerPkt
+	loops         int
+	m             *sync.Mutex
+	opts          DemuxerOptions
 	restamper     PktRestamper
 	seekToLive    bool
+	seekc         chan struct{}
+	seeks         []*demuxerSeek
 	ss            map[int]*demuxerStream
 	statWorkRatio *astikit.DurationPercentageStat
 }
 
 type demuxerStream struct {
 	ctx               Context
+	discontinuity     bool
 	emulateRateNextAt time.Time
+	flush             bool
 	s                 *avformat.Stream
+	sd                StreamDescriptor
 	seekToLiveLastPkt *demuxerPkt
 }
 
@@ -59,22 +71,43 @@ func newDemuxerPkt(pkt *avcodec.Packet, s *avformat.Stream) *demuxerPkt {
 
 // DemuxerOptions represents demuxer options
 type DemuxerOptions struct {
-	// String content of the demuxer as you would use in ffmpeg
+	// String content of the demuxer as you would use in ffmpeg, such as "rtsp_transport=tcp,probesize=32"
 	Dict string
+	// Private options of the input format, such as {"rtsp_transport": "tcp", "listen": "1"}. Contrary to Dict, values
+	// can contain commas. Entries override the ones of Dict.
+	// Options that haven't been used by the input format are sent in an event once the input has been opened
+	Dictionary map[string]string
 	// If true, the demuxer will sleep between packets for the exact duration of the packet
 	EmulateRate bool
 	// Context used to cancel finding stream info
 	FindStreamInfoCtx context.Context
 	// Exact input format
 	Format *avformat.InputFormat
+	// Short name of the input format, such as "mpegts" or "rtsp", used when Format is not provided
+	FormatName string
 	// If true, at the end of the input the demuxer will seek to its beginning and start over
 	// In this case the packets are restamped
 	Loop bool
+	// If > 0, the demuxer stops once it has looped this number of times, in which case Loop is not needed. If 0 and
+	// Loop is true, the demuxer loops forever
+	LoopCount int
 	// Basic node options
 	Node astiencoder.NodeOptions
+	// If true, av_read_pause is called when the demuxer is paused and av_read_play when it's continued, so that live
+	// inputs supporting it, such as RTSP, stop sending data instead of it piling up while reads are stopped
+	ReadPause bool
+	// If provided, the input is read from it instead of the URL, in which case Format may be needed since the input
+	// format can't be guessed from the URL. It's not closed by the demuxer.
+	Reader io.Reader
+	// If provided, the demuxer reopens live inputs, such as RTMP, HTTP or UDP, with a backoff after a read error or
+	// EOF instead of stopping. It's not compatible with Loop and Reader
+	Reconnect *DemuxerReconnectOptions
 	// If true, the demuxer will not dispatch packets until, for at least one stream, 2 consecutive packets are received
 	// at an interval >= to the first packet's duration
 	SeekToLive bool
+	// If provided, only streams matching at least one selector are demuxed, the other ones are discarded at the demux
+	// level and are not part of the stream descriptors
+	Streams []DemuxerStreamSelector
 	// URL of the input
 	URL string
 }
@@ -85,17 +118,27 @@ func NewDemuxer(o DemuxerOptions, eh *astiencoder.EventHandler, c *astikit.Close
 	count := atomic.AddUint64(&countDemuxer, uint64(1))
 	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("demuxer_%d", count), fmt.Sprintf("Demuxer #%d", count), fmt.Sprintf("Demuxes %s", o.URL))
 
+	// Reconnecting requires the input to be opened by the demuxer
+	if o.Reconnect != nil && (o.Loop || o.LoopCount > 0 || o.Reader != nil) {
+		err = errors.New("astilibav: reconnect is not compatible with loop and reader")
+		return
+	}
+
 	// Create demuxer
 	d = &Demuxer{
-		d:             newPktDispatcher(c),
 		eh:            eh,
 		emulateRate:   o.EmulateRate,
-		loop:          o.Loop,
+		loop:          o.Loop || o.LoopCount > 0,
+		loopCount:     o.LoopCount,
+		m:             &sync.Mutex{},
+		opts:          o,
+		seekc:         make(chan struct{}, 1),
 		seekToLive:    o.SeekToLive,
 		ss:            make(map[int]*demuxerStream),
 		statWorkRatio: astikit.NewDurationPercentageStat(),
 	}
 	d.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(d), eh)
+	d.d = newPktDispatcher(d, eh, c)
 	d.addStats()
 
 	// If loop is enabled, we need to add a restamper
@@ -103,33 +146,54 @@ func NewDemuxer(o DemuxerOptions, eh *astiencoder.EventHandler, c *astikit.Close
 		d.restamper = NewPktRestamperWithPktDuration()
 	}
 
-	// Dict
-	var dict *avutil.Dictionary
-	if len(o.Dict) > 0 {
-		// Parse dict
-		if ret := avutil.AvDictParseString(&dict, o.Dict, "=", ",", 0); ret < 0 {
-			err = fmt.Errorf("astilibav: avutil.AvDictParseString on %s failed: %w", o.Dict, NewAvError(ret))
-			return
-		}
+	// Get input format
+	var format *avformat.InputFormat
+	if format, err = demuxerInputFormat(o); err != nil {
+		return
+	}
 
-		// Make sure the dict is freed
-		defer avutil.AvDictFree(&dict)
+	// Create dict
+	var dict *avutil.Dictionary
+	if dict, err = newDict(o.Dict, o.Dictionary); err != nil {
+		err = fmt.Errorf("astilibav: creating dict failed: %w", err)
+		return
 	}
 
+	// Make sure the dict is freed
+	defer avutil.AvDictFree(&dict)
+
 	// Alloc ctx
 	ctxFormat := avformat.AvformatAllocContext()
 
 	// Set interrupt callback
 	d.interruptRet = ctxFormat.SetInterruptCallback()
 
+	// Read from the reader
+	if o.Reader != nil {
+		if err = setDemuxerIO(ctxFormat, o.Reader, c); err != nil {
+			ctxFormat.AvformatFreeContext()
+			err = fmt.Errorf("astilibav: setting demuxer io failed: %w", err)
+			return
+		}
+	}
+
 	// Open input
 	// We need to create an intermediate variable to avoid "cgo argument has Go pointer to Go pointer" errors
-	if ret := avformat.AvformatOpenInput(&ctxFormat, o.URL, o.Format, &dict); ret < 0 {
+	if ret := avformat.AvformatOpenInput(&ctxFormat, o.URL, format, &dict); ret < 0 {
 		err = fmt.Errorf("astilibav: avformat.AvformatOpenInput on %+v failed: %w", o, NewAvError(ret))
 		return
 	}
 	d.ctxFormat = ctxFormat
 
+	// Send unused options
+	if e := dictEntries(dict); len(e) > 0 {
+		eh.Emit(astiencoder.Event{
+			Name:    EventNameDemuxerUnusedOptions,
+			Payload: e,
+			Target:  d,
+		})
+	}
+
 	// Make sure the input is properly closed
 	c.Add(func() error {
 		avformat.AvformatCloseInput(d.ctxFormat)
@@ -166,16 +230,46 @@ func NewDemuxer(o DemuxerOptions, eh *astiencoder.EventHandler, c *astikit.Close
 		return
 	}
 
+	// Select streams
+	var selected map[int]bool
+	if selected, err = selectStreams(d.ctxFormat, o.Streams); err != nil {
+		err = fmt.Errorf("astilibav: selecting streams failed: %w", err)
+		return
+	}
+
 	// Index streams
 	for _, s := range d.ctxFormat.Streams() {
+		// Stream is not selected
+		if !selected[s.Index()] {
+			discardStream(s)
+			continue
+		}
+
+		// Index
 		d.ss[s.Index()] = &demuxerStream{
 			ctx: NewContextFromStream(s),
 			s:   s,
+			sd:  NewStreamDescriptor(s),
 		}
 	}
 	return
 }
 
+func demuxerInputFormat(o DemuxerOptions) (f *avformat.InputFormat, err error) {
+	// Format has been provided
+	if o.Format != nil || o.FormatName == "" {
+		f = o.Format
+		return
+	}
+
+	// Find format
+	if f = avformat.AvFindInputFormat(o.FormatName); f == nil {
+		err = fmt.Errorf("astilibav: input format %s not found", o.FormatName)
+		return
+	}
+	return
+}
+
 func (d *Demuxer) addStats() {
 	// Add work ratio
 	d.Stater().AddStat(astikit.StatMetadata{
@@ -193,6 +287,20 @@ func (d *Demuxer) CtxFormat() *avformat.Context {
 	return d.ctxFormat
 }
 
+// StreamDescriptors returns the stream descriptors indexed by stream index
+func (d *Demuxer) StreamDescriptors() map[int]StreamDescriptor {
+	sds := make(map[int]StreamDescriptor)
+	for idx, s := range d.ss {
+		sds[idx] = s.sd
+	}
+	return sds
+}
+
+// Chapters returns the input chapters
+func (d *Demuxer) Chapters() []Chapter {
+	return chaptersFromCtxFormat(d.ctxFormat)
+}
+
 // Connect implements the PktHandlerConnector interface
 func (d *Demuxer) Connect(h PktHandler) {
 	// Add handler
@@ -244,13 +352,16 @@ func (d *Demuxer) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
 
 		// Loop
 		for {
+			// Handle seeks
+			d.handleSeeks()
+
 			// Read frame
 			if stop := d.readFrame(ctx); stop {
 				return
 			}
 
 			// Handle pause
-			d.HandlePause()
+			d.handlePause()
 
 			// Check context
 			if d.Context().Err() != nil {
@@ -269,9 +380,18 @@ func (d *Demuxer) readFrame(ctx context.Context) (stop bool) {
 	d.statWorkRatio.Begin()
 	if ret := d.ctxFormat.AvReadFrame(pkt); ret < 0 {
 		d.statWorkRatio.End()
-		if ret != avutil.AVERROR_EOF || !d.loop {
+		if d.opts.Reconnect != nil && d.Context().Err() == nil {
+			// Reconnect
+			if ret != avutil.AVERROR_EOF {
+				emitAvError(d, d.eh, ret, "ctxFormat.AvReadFrame on %s failed", d.ctxFormat.Filename())
+			}
+			stop = d.reconnect()
+		} else if ret != avutil.AVERROR_EOF || !d.loop || (d.loopCount > 0 && d.loops >= d.loopCount) {
 			if ret != avutil.AVERROR_EOF {
 				emitAvError(d, d.eh, ret, "ctxFormat.AvReadFrame on %s failed", d.ctxFormat.Filename())
+			} else {
+				// Let the next nodes know there won't be any more pkts
+				d.d.dispatchEOS()
 			}
 			stop = true
 		} else if d.loopFirstPkt != nil {
@@ -280,6 +400,14 @@ func (d *Demuxer) readFrame(ctx context.Context) (stop bool) {
 				emitAvError(d, d.eh, ret, "ctxFormat.AvSeekFrame on %s with stream idx %v and ts %v failed", d.ctxFormat.Filename(), d.loopFirstPkt.s.Index(), d.loopFirstPkt.dts)
 				stop = true
 			}
+
+			// Increment loops
+			d.loops++
+
+			// Next pkts follow a discontinuity
+			for _, s := range d.ss {
+				s.discontinuity = true
+			}
 		}
 		return
 	}
@@ -326,8 +454,18 @@ func (d *Demuxer) readFrame(ctx context.Context) (stop bool) {
 		s.emulateRateNextAt = s.emulateRateNextAt.Add(time.Duration(avutil.AvRescaleQ(d.emulateRatePktDuration(pkt, s.ctx), s.s.TimeBase(), nanosecondRational)))
 	}
 
+	// Create metadata
+	m := &UnitMetadata{
+		CaptureTime:   time.Now(),
+		Discontinuity: s.discontinuity,
+		Flush:         s.flush,
+		Source:        d,
+	}
+	s.discontinuity = false
+	s.flush = false
+
 	// Dispatch pkt
-	d.d.dispatch(pkt, s.s)
+	d.d.dispatch(pkt, s.sd, m)
 	return
 }
 
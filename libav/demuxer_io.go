@@ -0,0 +1,163 @@
+package astilibav
+
+//#cgo pkg-config: libavformat libavutil
+//#include <errno.h>
+//#include <stdint.h>
+//#include <libavformat/avformat.h>
+//#include <libavutil/mem.h>
+//extern int goAstilibavDemuxerIORead(void *opaque, uint8_t *buf, int size);
+//extern int64_t goAstilibavDemuxerIOSeek(void *opaque, int64_t offset, int whence);
+//static AVIOContext *astilibav_demuxer_io_alloc(int size, uintptr_t id, int seekable) {
+//	unsigned char *b = av_malloc(size);
+//	if (!b) return NULL;
+//	AVIOContext *c = avio_alloc_context(b, size, 0, (void *)id, goAstilibavDemuxerIORead, NULL, seekable ? goAstilibavDemuxerIOSeek : NULL);
+//	if (!c) av_free(b);
+//	return c;
+//}
+//static void astilibav_demuxer_io_free(AVIOContext *c) {
+//	av_freep(&c->buffer);
+//	avio_context_free(&c);
+//}
+//static int astilibav_demuxer_io_eof() { return AVERROR_EOF; }
+//static int astilibav_demuxer_io_error() { return AVERROR(EIO); }
+import "C"
+import (
+	"errors"
+	"io"
+	"sync"
+	"unsafe"
+
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avformat"
+)
+
+const demuxerIOBufferSize = 32 * 1024
+
+// Opaque pointers can't hold Go pointers, therefore readers are indexed by id
+var (
+	countDemuxerIOReader  uintptr
+	demuxerIOReaders      = make(map[uintptr]io.Reader)
+	demuxerIOReadersMutex = &sync.Mutex{}
+)
+
+func demuxerIOReader(opaque unsafe.Pointer) (r io.Reader, ok bool) {
+	demuxerIOReadersMutex.Lock()
+	defer demuxerIOReadersMutex.Unlock()
+	r, ok = demuxerIOReaders[uintptr(opaque)]
+	return
+}
+
+//export goAstilibavDemuxerIORead
+func goAstilibavDemuxerIORead(opaque unsafe.Pointer, buf *C.uint8_t, size C.int) C.int {
+	// Get reader
+	r, ok := demuxerIOReader(opaque)
+	if !ok {
+		return C.astilibav_demuxer_io_error()
+	}
+
+	// Nothing to read
+	if size <= 0 {
+		return 0
+	}
+
+	// Read
+	// Returning 0 is not allowed, therefore we wait for at least one byte
+	n, err := io.ReadAtLeast(r, (*[1 << 30]byte)(unsafe.Pointer(buf))[:size:size], 1)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return C.astilibav_demuxer_io_eof()
+		}
+		return C.astilibav_demuxer_io_error()
+	}
+	return C.int(n)
+}
+
+//export goAstilibavDemuxerIOSeek
+func goAstilibavDemuxerIOSeek(opaque unsafe.Pointer, offset C.int64_t, whence C.int) C.int64_t {
+	// Get seeker
+	r, ok := demuxerIOReader(opaque)
+	if !ok {
+		return C.int64_t(C.astilibav_demuxer_io_error())
+	}
+	s, ok := r.(io.Seeker)
+	if !ok {
+		return C.int64_t(C.astilibav_demuxer_io_error())
+	}
+
+	// Get size
+	if whence&C.AVSEEK_SIZE > 0 {
+		n, err := seekerSize(s)
+		if err != nil {
+			return -1
+		}
+		return C.int64_t(n)
+	}
+
+	// Seek
+	// SEEK_SET, SEEK_CUR and SEEK_END have the same values as their io counterparts
+	n, err := s.Seek(int64(offset), int(whence&^C.AVSEEK_FORCE))
+	if err != nil {
+		return C.int64_t(C.astilibav_demuxer_io_error())
+	}
+	return C.int64_t(n)
+}
+
+// seekerSize returns the size of the seeker without moving its offset
+func seekerSize(s io.Seeker) (n int64, err error) {
+	// Get current offset
+	var cur int64
+	if cur, err = s.Seek(0, io.SeekCurrent); err != nil {
+		return
+	}
+
+	// Get size
+	if n, err = s.Seek(0, io.SeekEnd); err != nil {
+		return
+	}
+
+	// Restore offset
+	_, err = s.Seek(cur, io.SeekStart)
+	return
+}
+
+// setDemuxerIO sets a format pb reading from the provided reader instead of a URL. The pb is seekable if the reader
+// implements io.Seeker, which is required by formats whose index is at the end, such as mp4 without faststart
+// It must be called before the input is opened
+func setDemuxerIO(ctxFormat *avformat.Context, r io.Reader, c *astikit.Closer) (err error) {
+	// Register reader
+	demuxerIOReadersMutex.Lock()
+	countDemuxerIOReader++
+	id := countDemuxerIOReader
+	demuxerIOReaders[id] = r
+	demuxerIOReadersMutex.Unlock()
+
+	// Alloc pb
+	var seekable C.int
+	if _, ok := r.(io.Seeker); ok {
+		seekable = 1
+	}
+	pb := C.astilibav_demuxer_io_alloc(demuxerIOBufferSize, C.uintptr_t(id), seekable)
+	if pb == nil {
+		demuxerIOReadersMutex.Lock()
+		delete(demuxerIOReaders, id)
+		demuxerIOReadersMutex.Unlock()
+		err = errors.New("astilibav: allocating pb failed")
+		return
+	}
+
+	// Make sure the pb is freed once the input has been closed
+	c.Add(func() error {
+		C.astilibav_demuxer_io_free(pb)
+		demuxerIOReadersMutex.Lock()
+		delete(demuxerIOReaders, id)
+		demuxerIOReadersMutex.Unlock()
+		return nil
+	})
+
+	// Set pb
+	// libavformat must not try to close it
+	cf := (*C.struct_AVFormatContext)(unsafe.Pointer(ctxFormat))
+	cf.pb = pb
+	cf.flags |= C.AVFMT_FLAG_CUSTOM_IO
+	return
+}
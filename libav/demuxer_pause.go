@@ -0,0 +1,60 @@
+package astilibav
+
+//#cgo pkg-config: libavutil
+//#include <errno.h>
+//#include <libavutil/error.h>
+//static int astilibav_demuxer_pause_not_supported() { return AVERROR(ENOSYS); }
+import "C"
+import (
+	"time"
+
+	"github.com/asticode/go-astiencoder"
+)
+
+// handlePause blocks while the demuxer is paused, which stops reads since they happen in the same goroutine
+// Format ctxs are not thread safe, therefore the input is paused here rather than in Pause
+func (d *Demuxer) handlePause() {
+	// Demuxer is not paused
+	if d.Status() != astiencoder.StatusPaused {
+		return
+	}
+
+	// Pause input
+	if d.opts.ReadPause {
+		if ret := d.ctxFormat.AvReadPause(); ret < 0 && ret != int(C.astilibav_demuxer_pause_not_supported()) {
+			emitAvError(d, d.eh, ret, "ctxFormat.AvReadPause on %s failed", d.ctxFormat.Filename())
+		}
+	}
+
+	// Wait for the demuxer to be continued while processing queued seeks
+	continued := make(chan struct{})
+	go func() {
+		d.HandlePause()
+		close(continued)
+	}()
+	for paused := true; paused; {
+		select {
+		case <-continued:
+			paused = false
+		case <-d.seekc:
+			d.handleSeeks()
+		}
+	}
+
+	// Demuxer has been stopped in the meantime
+	if d.Context().Err() != nil {
+		return
+	}
+
+	// Play input
+	if d.opts.ReadPause {
+		if ret := d.ctxFormat.AvReadPlay(); ret < 0 && ret != int(C.astilibav_demuxer_pause_not_supported()) {
+			emitAvError(d, d.eh, ret, "ctxFormat.AvReadPlay on %s failed", d.ctxFormat.Filename())
+		}
+	}
+
+	// The time spent paused must not be caught up
+	for _, s := range d.ss {
+		s.emulateRateNextAt = time.Time{}
+	}
+}
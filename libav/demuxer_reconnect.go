@@ -0,0 +1,182 @@
+package astilibav
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avformat"
+	"github.com/asticode/goav/avutil"
+)
+
+// Default demuxer reconnect values
+const (
+	defaultDemuxerReconnectBackoff    = time.Second
+	defaultDemuxerReconnectMaxBackoff = 30 * time.Second
+)
+
+// DemuxerReconnectOptions represents demuxer reconnect options
+type DemuxerReconnectOptions struct {
+	// Delay before the first attempt, which is doubled after each failed attempt. Defaults to 1s
+	Backoff time.Duration
+	// Defaults to 30s
+	MaxBackoff time.Duration
+	// Number of failed attempts after which the demuxer stops. If 0, the demuxer retries forever
+	MaxRetries int
+}
+
+func (o DemuxerReconnectOptions) withDefaults() DemuxerReconnectOptions {
+	if o.Backoff <= 0 {
+		o.Backoff = defaultDemuxerReconnectBackoff
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = defaultDemuxerReconnectMaxBackoff
+	}
+	if o.MaxBackoff < o.Backoff {
+		o.MaxBackoff = o.Backoff
+	}
+	return o
+}
+
+// reconnect returns true if the demuxer should stop
+func (d *Demuxer) reconnect() (stop bool) {
+	// Send event
+	d.eh.Emit(astiencoder.Event{
+		Name:    EventNameDemuxerReconnecting,
+		Payload: d.opts.URL,
+		Target:  d,
+	})
+
+	// Loop through attempts
+	o := d.opts.Reconnect.withDefaults()
+	backoff := o.Backoff
+	for attempt := 1; ; attempt++ {
+		// Wait
+		if err := astikit.Sleep(d.Context(), backoff); err != nil {
+			return true
+		}
+
+		// Reopen
+		if err := d.reopen(); err != nil {
+			// Send error
+			d.eh.Emit(astiencoder.EventError(d, fmt.Errorf("astilibav: reconnecting to %s failed: %w", d.opts.URL, err)))
+
+			// Max number of retries has been reached
+			if o.MaxRetries > 0 && attempt >= o.MaxRetries {
+				d.eh.Emit(astiencoder.EventError(d, fmt.Errorf("astilibav: max number of retries %d reached, stopping", o.MaxRetries)))
+				return true
+			}
+
+			// Update backoff
+			if backoff *= 2; backoff > o.MaxBackoff {
+				backoff = o.MaxBackoff
+			}
+			continue
+		}
+		break
+	}
+
+	// Next pkts follow a discontinuity
+	for _, s := range d.ss {
+		s.discontinuity = true
+		s.emulateRateNextAt = time.Time{}
+	}
+
+	// Send event
+	d.eh.Emit(astiencoder.Event{
+		Name:    EventNameDemuxerReconnected,
+		Payload: d.opts.URL,
+		Target:  d,
+	})
+	return
+}
+
+// reopen replaces the format ctx with a new one opened on the same input
+// Streams are matched by index so that descriptors and connections remain valid. Streams that are missing from the new
+// input are removed and an event is sent for each of them
+func (d *Demuxer) reopen() (err error) {
+	// Get input format
+	var format *avformat.InputFormat
+	if format, err = demuxerInputFormat(d.opts); err != nil {
+		return
+	}
+
+	// Create dict
+	var dict *avutil.Dictionary
+	if dict, err = newDict(d.opts.Dict, d.opts.Dictionary); err != nil {
+		err = fmt.Errorf("astilibav: creating dict failed: %w", err)
+		return
+	}
+
+	// Make sure the dict is freed
+	defer avutil.AvDictFree(&dict)
+
+	// Alloc ctx
+	ctxFormat := avformat.AvformatAllocContext()
+
+	// Set interrupt callback
+	interruptRet := ctxFormat.SetInterruptCallback()
+
+	// Make sure opening the input is interrupted if the demuxer is stopped in the meantime
+	ctx, cancel := context.WithCancel(d.Context())
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		if d.Context().Err() != nil {
+			*interruptRet = 1
+		}
+	}()
+
+	// Open input
+	// The ctx is freed by ffmpeg in case of error
+	if ret := avformat.AvformatOpenInput(&ctxFormat, d.opts.URL, format, &dict); ret < 0 {
+		err = fmt.Errorf("astilibav: avformat.AvformatOpenInput on %s failed: %w", d.opts.URL, NewAvError(ret))
+		return
+	}
+
+	// Retrieve stream information
+	if ret := ctxFormat.AvformatFindStreamInfo(nil); ret < 0 {
+		avformat.AvformatCloseInput(ctxFormat)
+		err = fmt.Errorf("astilibav: ctxFormat.AvformatFindStreamInfo on %s failed: %w", d.opts.URL, NewAvError(ret))
+		return
+	}
+
+	// Replace streams
+	for _, s := range ctxFormat.Streams() {
+		if ds, ok := d.ss[s.Index()]; ok {
+			ds.s = s
+			ds.seekToLiveLastPkt = nil
+		} else {
+			discardStream(s)
+		}
+	}
+
+	// Remove streams that are missing from the new format ctx before the old one is freed
+	// Stream indexes are contiguous, therefore missing streams are the ones whose index is out of range
+	var lost []StreamDescriptor
+	for idx, ds := range d.ss {
+		if idx >= len(ctxFormat.Streams()) {
+			lost = append(lost, ds.sd)
+			delete(d.ss, idx)
+		}
+	}
+
+	// Replace format ctx
+	avformat.AvformatCloseInput(d.ctxFormat)
+	d.ctxFormat = ctxFormat
+	d.interruptRet = interruptRet
+
+	// Send events
+	sort.Slice(lost, func(i, j int) bool { return lost[i].Index() < lost[j].Index() })
+	for _, sd := range lost {
+		d.eh.Emit(astiencoder.Event{
+			Name:    EventNameDemuxerStreamLost,
+			Payload: sd,
+			Target:  d,
+		})
+	}
+	return
+}
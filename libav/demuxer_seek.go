@@ -0,0 +1,93 @@
+package astilibav
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/goav/avformat"
+	"github.com/asticode/goav/avutil"
+)
+
+// SeekFlags represents seek flags
+type SeekFlags int
+
+// Seek flags
+// By default, the demuxer seeks to the first keyframe whose timestamp is >= to the requested timestamp
+const (
+	// Seeks to any pkt, keyframe or not
+	SeekFlagAny = SeekFlags(avformat.AVSEEK_FLAG_ANY)
+	// Seeks to the last keyframe whose timestamp is <= to the requested timestamp
+	SeekFlagBackward = SeekFlags(avformat.AVSEEK_FLAG_BACKWARD)
+)
+
+type demuxerSeek struct {
+	done      chan error
+	flags     SeekFlags
+	timestamp time.Duration
+}
+
+// Seek seeks the input to the timestamp, which is in the timeline of the input pkts
+// Next pkts follow a discontinuity and carry the flush flag so that nodes buffering units, such as decoders, drop them
+// If the demuxer has been started, the seek is executed between two reads, or while it's paused, and Seek blocks
+// until it's done
+func (d *Demuxer) Seek(timestamp time.Duration, flags SeekFlags) error {
+	// Create seek
+	s := &demuxerSeek{
+		done:      make(chan error, 1),
+		flags:     flags,
+		timestamp: timestamp,
+	}
+
+	// Demuxer has never been started or is stopped
+	if d.Status() == astiencoder.StatusStopped {
+		return d.seek(s)
+	}
+
+	// Queue seek
+	d.m.Lock()
+	d.seeks = append(d.seeks, s)
+	d.m.Unlock()
+
+	// Let the paused demuxer know a seek has been queued
+	select {
+	case d.seekc <- struct{}{}:
+	default:
+	}
+
+	// Wait
+	select {
+	case err := <-s.done:
+		return err
+	case <-d.Context().Done():
+		return d.Context().Err()
+	}
+}
+
+func (d *Demuxer) handleSeeks() {
+	// Get seeks
+	d.m.Lock()
+	ss := d.seeks
+	d.seeks = nil
+	d.m.Unlock()
+
+	// Loop through seeks
+	for _, s := range ss {
+		s.done <- d.seek(s)
+	}
+}
+
+func (d *Demuxer) seek(s *demuxerSeek) error {
+	// Seek
+	if ret := d.ctxFormat.AvSeekFrame(-1, avutil.AvRescaleQ(int64(s.timestamp), nanosecondRational, avutil.AV_TIME_BASE_Q), int(s.flags)); ret < 0 {
+		return fmt.Errorf("astilibav: ctxFormat.AvSeekFrame on %s to %s failed: %w", d.ctxFormat.Filename(), s.timestamp, NewAvError(ret))
+	}
+
+	// Next pkts follow a discontinuity
+	for _, st := range d.ss {
+		st.discontinuity = true
+		st.emulateRateNextAt = time.Time{}
+		st.flush = true
+	}
+	return nil
+}
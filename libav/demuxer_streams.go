@@ -0,0 +1,100 @@
+package astilibav
+
+//#cgo pkg-config: libavformat
+//#include <libavformat/avformat.h>
+import "C"
+import (
+	"errors"
+	"unsafe"
+
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avformat"
+	"github.com/asticode/goav/avutil"
+)
+
+// DemuxerStreamSelector represents a demuxer stream selector
+// A stream matches the selector if it matches all the fields that are set
+type DemuxerStreamSelector struct {
+	// If true, only the stream picked by av_find_best_stream among the ones of MediaType matches, in which case
+	// MediaType is required
+	Best  bool
+	Index *int
+	// Value of the "language" tag, such as "eng"
+	Language string
+	// Possible values are "audio", "subtitle" and "video"
+	MediaType string
+}
+
+func (s DemuxerStreamSelector) match(idx int, mediaType avcodec.MediaType, language string, best func(t avutil.MediaType) int) bool {
+	// Index
+	if s.Index != nil && *s.Index != idx {
+		return false
+	}
+
+	// Language
+	if s.Language != "" && s.Language != language {
+		return false
+	}
+
+	// Media type
+	t := avutil.MediaTypeFromString(s.MediaType)
+	typed := t > -1
+	if typed && avcodec.MediaType(t) != mediaType {
+		return false
+	}
+
+	// Best
+	if s.Best && (!typed || best(t) != idx) {
+		return false
+	}
+	return true
+}
+
+// selectStreams returns whether streams are selected indexed by stream index
+// If no selector is provided, all streams are selected
+func selectStreams(ctxFormat *avformat.Context, ss []DemuxerStreamSelector) (selected map[int]bool, err error) {
+	// Best streams are only looked for once per media type
+	bests := make(map[avutil.MediaType]int)
+	best := func(t avutil.MediaType) int {
+		if idx, ok := bests[t]; ok {
+			return idx
+		}
+		bests[t] = avformat.AvFindBestStream(ctxFormat, avformat.MediaType(t), -1, -1, nil, 0)
+		return bests[t]
+	}
+
+	// Loop through streams
+	selected = make(map[int]bool)
+	var atLeastOne bool
+	for _, s := range ctxFormat.Streams() {
+		// Loop through selectors
+		selected[s.Index()] = len(ss) == 0
+		for _, sel := range ss {
+			if sel.match(s.Index(), s.CodecParameters().CodecType(), streamLanguage(s), best) {
+				selected[s.Index()] = true
+				break
+			}
+		}
+
+		// Update
+		if selected[s.Index()] {
+			atLeastOne = true
+		}
+	}
+
+	// No stream has been selected
+	if !atLeastOne && len(ss) > 0 {
+		err = errors.New("astilibav: no stream matches the selectors")
+		return
+	}
+	return
+}
+
+func streamLanguage(s *avformat.Stream) string {
+	return probeMetadata((*C.struct_AVStream)(unsafe.Pointer(s)).metadata)["language"]
+}
+
+// discardStream makes sure the demuxer drops the stream's pkts as early as possible instead of returning them
+func discardStream(s *avformat.Stream) {
+	(*C.struct_AVStream)(unsafe.Pointer(s)).discard = C.AVDISCARD_ALL
+}
@@ -0,0 +1,32 @@
+package astilibav
+
+import (
+	"testing"
+
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDemuxerStreamSelector(t *testing.T) {
+	best := func(t avutil.MediaType) int {
+		if t == avutil.AVMEDIA_TYPE_AUDIO {
+			return 2
+		}
+		return 0
+	}
+	idx := 1
+	audio := avcodec.MediaType(avutil.AVMEDIA_TYPE_AUDIO)
+	video := avcodec.MediaType(avutil.AVMEDIA_TYPE_VIDEO)
+
+	assert.True(t, DemuxerStreamSelector{}.match(1, audio, "eng", best))
+	assert.True(t, DemuxerStreamSelector{Index: &idx}.match(1, audio, "eng", best))
+	assert.False(t, DemuxerStreamSelector{Index: &idx}.match(2, audio, "eng", best))
+	assert.True(t, DemuxerStreamSelector{Language: "eng", MediaType: "audio"}.match(1, audio, "eng", best))
+	assert.False(t, DemuxerStreamSelector{Language: "fre", MediaType: "audio"}.match(1, audio, "eng", best))
+	assert.False(t, DemuxerStreamSelector{MediaType: "video"}.match(1, audio, "eng", best))
+	assert.True(t, DemuxerStreamSelector{MediaType: "video"}.match(0, video, "", best))
+	assert.False(t, DemuxerStreamSelector{Best: true, MediaType: "audio"}.match(1, audio, "eng", best))
+	assert.True(t, DemuxerStreamSelector{Best: true, MediaType: "audio"}.match(2, audio, "eng", best))
+	assert.False(t, DemuxerStreamSelector{Best: true}.match(2, audio, "eng", best))
+}
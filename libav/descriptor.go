@@ -1,6 +1,7 @@
 package astilibav
 
 import (
+	"github.com/asticode/goav/avcodec"
 	"github.com/asticode/goav/avutil"
 )
 
@@ -8,3 +9,65 @@ import (
 type Descriptor interface {
 	TimeBase() avutil.Rational
 }
+
+// StreamDescriber represents a descriptor that can provide a stream descriptor
+type StreamDescriber interface {
+	StreamDescriptor() StreamDescriptor
+}
+
+// DescriptorStream returns the stream descriptor of a descriptor if it can provide one
+func DescriptorStream(d Descriptor) (sd StreamDescriptor, ok bool) {
+	var s StreamDescriber
+	if s, ok = d.(StreamDescriber); ok {
+		sd = s.StreamDescriptor()
+	}
+	return
+}
+
+// StreamDescriptor represents an immutable description of a stream
+// It is passed along connections as a Descriptor so that nodes and user code don't need to access raw contexts
+type StreamDescriptor struct {
+	ctx      Context
+	index    int
+	sideData []string
+}
+
+func newStreamDescriptor(ctx Context, index int, sideData []string) StreamDescriptor {
+	// Thread count is not a stream property and is a pointer
+	ctx.ThreadCount = nil
+	return StreamDescriptor{
+		ctx:      ctx,
+		index:    index,
+		sideData: sideData,
+	}
+}
+
+// Context returns a copy of the stream parameters
+func (d StreamDescriptor) Context() Context {
+	return d.ctx
+}
+
+// Index returns the stream index
+func (d StreamDescriptor) Index() int {
+	return d.index
+}
+
+// MediaType returns the stream media type
+func (d StreamDescriptor) MediaType() avcodec.MediaType {
+	return d.ctx.CodecType
+}
+
+// SideData returns the names of the stream side data
+func (d StreamDescriptor) SideData() []string {
+	return append([]string{}, d.sideData...)
+}
+
+// StreamDescriptor implements the StreamDescriber interface
+func (d StreamDescriptor) StreamDescriptor() StreamDescriptor {
+	return d
+}
+
+// TimeBase implements the Descriptor interface
+func (d StreamDescriptor) TimeBase() avutil.Rational {
+	return d.ctx.TimeBase
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"sync/atomic"
+	"time"
 
 	"github.com/asticode/go-astiencoder"
 	"github.com/asticode/go-astikit"
@@ -15,22 +16,54 @@ import (
 
 var countEncoder uint64
 
+// AV_CODEC_FLAG_CLOSED_GOP is not exposed by goav
+const encoderFlagClosedGOP = 1 << 31
+
 // Encoder represents an object capable of encoding frames
 type Encoder struct {
 	*astiencoder.BaseNode
 	c                  *astikit.Chan
+	closedGOP          bool
+	contentLightLevel  *ContentLightLevel
 	ctxCodec           *avcodec.Context
 	d                  *pktDispatcher
 	eh                 *astiencoder.EventHandler
+	flushed            bool
+	forceKeyFrames     bool
+	forcedKeyFrames    map[int64]bool // Indexed by pts in the encoder time base
+	fp                 *framePool
+	kf                 *encoderKeyFrameForcer
+	lastKeyFramePts    *int64
+	masteringDisplay   *MasteringDisplay
+	mt                 *unitMetadataTracker
 	previousDescriptor Descriptor
+	reconfigurations   encoderReconfigurations
+	sdt                *sideDataTracker
 	statIncomingRate   *astikit.CounterAvgStat
 	statWorkRatio      *astikit.DurationPercentageStat
 }
 
 // EncoderOptions represents encoder options
 type EncoderOptions struct {
-	Ctx  Context
-	Node astiencoder.NodeOptions
+	// If true, the encoder is asked to produce closed GOPs and IDR frames when keyframes are forced. Since some codecs
+	// may produce open GOPs anyway, an event is sent whenever an open GOP is detected
+	ClosedGOP bool
+	// Options such as the preset or the crf, applied on top of Ctx.Dict
+	CodecOptions EncoderCodecOptions
+	Ctx          Context
+	// If true, incoming I frames are forced as keyframes instead of having their picture type reset. This is useful
+	// when upstream nodes, such as the scene detector, flag segment boundaries
+	ForceKeyFrames bool
+	// If provided, the encoder uses the hardware device, such as with "h264_nvenc" or "hevc_vaapi" codecs. Software
+	// frames are uploaded to the device before being encoded, in which case Ctx.PixelFormat must be their pixel format
+	HardwareDevice *HWDevice
+	// If > 0, keyframes are forced on the first frame of each interval, intervals being computed on the frames' pts.
+	// Therefore encoders fed with the same frames, such as the renditions of an ABR ladder, produce aligned keyframes
+	KeyFrameInterval time.Duration
+	// Keyframes are forced on the first frames whose pts is >= to these values, which are in the time base of
+	// incoming frames
+	KeyFramePts []int64
+	Node        astiencoder.NodeOptions
 }
 
 // NewEncoder creates a new encoder
@@ -45,12 +78,20 @@ func NewEncoder(o EncoderOptions, eh *astiencoder.EventHandler, c *astikit.Close
 			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
 			ProcessAll:  true,
 		}),
-		d:                newPktDispatcher(c),
-		eh:               eh,
-		statIncomingRate: astikit.NewCounterAvgStat(),
-		statWorkRatio:    astikit.NewDurationPercentageStat(),
+		closedGOP:         o.ClosedGOP,
+		contentLightLevel: o.Ctx.ContentLightLevel,
+		eh:                eh,
+		forceKeyFrames:    o.ForceKeyFrames,
+		forcedKeyFrames:   make(map[int64]bool),
+		kf:                newEncoderKeyFrameForcer(o),
+		masteringDisplay:  o.Ctx.MasteringDisplay,
+		mt:                newUnitMetadataTracker(),
+		sdt:               newSideDataTracker(),
+		statIncomingRate:  astikit.NewCounterAvgStat(),
+		statWorkRatio:     astikit.NewDurationPercentageStat(),
 	}
 	e.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(e), eh)
+	e.d = newPktDispatcher(e, eh, c)
 	e.addStats()
 
 	// Find encoder
@@ -89,6 +130,9 @@ func NewEncoder(o EncoderOptions, eh *astiencoder.EventHandler, c *astikit.Close
 	if o.Ctx.ThreadCount != nil {
 		e.ctxCodec.SetThreadCount(*o.Ctx.ThreadCount)
 	}
+	if o.ClosedGOP {
+		e.ctxCodec.SetFlags(e.ctxCodec.Flags() | encoderFlagClosedGOP)
+	}
 
 	// Set media type-specific context parameters
 	switch o.Ctx.CodecType {
@@ -101,30 +145,55 @@ func NewEncoder(o EncoderOptions, eh *astiencoder.EventHandler, c *astikit.Close
 	case avutil.AVMEDIA_TYPE_VIDEO:
 		e.ctxCodec.SetBitRate(int64(o.Ctx.BitRate))
 		e.ctxCodec.SetFramerate(o.Ctx.FrameRate)
-		e.ctxCodec.SetGopSize(o.Ctx.GopSize)
+		if o.Ctx.GopSize > 0 {
+			e.ctxCodec.SetGopSize(o.Ctx.GopSize)
+		}
 		e.ctxCodec.SetHeight(o.Ctx.Height)
 		e.ctxCodec.SetPixFmt(o.Ctx.PixelFormat)
 		e.ctxCodec.SetSampleAspectRatio(o.Ctx.SampleAspectRatio)
 		e.ctxCodec.SetTimeBase(o.Ctx.TimeBase)
 		e.ctxCodec.SetWidth(o.Ctx.Width)
+		e.setColors(o.Ctx)
 	default:
 		err = fmt.Errorf("astilibav: encoder doesn't handle %v codec type", o.Ctx.CodecType)
 		return
 	}
 
-	// Dict
-	var dict *avutil.Dictionary
-	if len(o.Ctx.Dict) > 0 {
-		// Parse dict
-		if ret := avutil.AvDictParseString(&dict, o.Ctx.Dict, "=", ",", 0); ret < 0 {
-			err = fmt.Errorf("astilibav: avutil.AvDictParseString on %s failed: %w", o.Ctx.Dict, NewAvError(ret))
+	// Set hardware device
+	if o.HardwareDevice != nil {
+		if err = e.setHWDevice(cdc, o.HardwareDevice, c); err != nil {
+			err = fmt.Errorf("astilibav: setting hardware device failed: %w", err)
 			return
 		}
+	}
+
+	// Get dictionary entries
+	entries := o.CodecOptions.dictionary()
+
+	// Forced keyframes must be IDR frames
+	// This private option is shared by most H264 and HEVC encoders and is ignored by the others
+	if o.ClosedGOP {
+		if entries == nil {
+			entries = make(map[string]string)
+		}
+		entries["forced-idr"] = "1"
+	}
+
+	// libx265 needs HDR static metadata to be provided through its params
+	if encoderCodecName(cdc) == "libx265" {
+		entries = encoderAddX265HDRParams(entries, o.Ctx)
+	}
 
-		// Make sure the dict is freed
-		defer avutil.AvDictFree(&dict)
+	// Create dict
+	var dict *avutil.Dictionary
+	if dict, err = newDict(o.Ctx.Dict, entries); err != nil {
+		err = fmt.Errorf("astilibav: creating dict failed: %w", err)
+		return
 	}
 
+	// Make sure the dict is freed
+	defer avutil.AvDictFree(&dict)
+
 	// Open codec
 	if ret := e.ctxCodec.AvcodecOpen2(cdc, &dict); ret < 0 {
 		err = fmt.Errorf("astilibav: d.e.ctxCodec.AvcodecOpen2 failed: %w", NewAvError(ret))
@@ -199,9 +268,25 @@ func (e *Encoder) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
 }
 
 func (e *Encoder) flush() {
+	// Encoders can only be flushed once
+	if e.flushed {
+		return
+	}
+	e.flushed = true
 	e.encode(&FrameHandlerPayload{})
 }
 
+// HandleEOS implements the EOSHandler interface
+func (e *Encoder) HandleEOS(p *EOSHandlerPayload) {
+	e.c.Add(func() {
+		// Drain pkts
+		e.flush()
+
+		// Forward end of stream
+		e.d.dispatchEOS()
+	})
+}
+
 // HandleFrame implements the FrameHandler interface
 func (e *Encoder) HandleFrame(p *FrameHandlerPayload) {
 	e.c.Add(func() {
@@ -221,14 +306,48 @@ func (e *Encoder) encode(p *FrameHandlerPayload) {
 	if p.Frame != nil {
 		switch e.ctxCodec.CodecType() {
 		case avutil.AVMEDIA_TYPE_VIDEO:
-			p.Frame.SetKeyFrame(0)
-			p.Frame.SetPictType(avutil.AvPictureType(avutil.AV_PICTURE_TYPE_NONE))
+			if e.forceKeyFrames && framePictType(p.Frame) == avutil.AvPictureType(avutil.AV_PICTURE_TYPE_I) {
+				e.forcedKeyFrames[e.forcedKeyFramePts(p.Frame.Pts(), p.Descriptor)] = true
+			} else if e.kf.force(p.Frame.Pts(), e.framePtsNs(p)) {
+				p.Frame.SetKeyFrame(1)
+				p.Frame.SetPictType(avutil.AvPictureType(avutil.AV_PICTURE_TYPE_I))
+				if e.closedGOP {
+					e.forcedKeyFrames[e.forcedKeyFramePts(p.Frame.Pts(), p.Descriptor)] = true
+				}
+			} else {
+				p.Frame.SetKeyFrame(0)
+				p.Frame.SetPictType(avutil.AvPictureType(avutil.AV_PICTURE_TYPE_NONE))
+			}
+		}
+	}
+
+	// Keep track of metadata and side data
+	if p.Frame != nil {
+		e.mt.add(p.Frame.Pts(), p.Metadata)
+		e.sdt.add(p.Frame.Pts(), frameSideDataEntries(p.Frame))
+	}
+
+	// Apply reconfigurations
+	if p.Frame != nil && len(e.reconfigurations) > 0 {
+		e.applyReconfigurations(p.Frame.Pts())
+	}
+
+	// Upload frame
+	f := p.Frame
+	if f != nil && e.fp != nil {
+		var err error
+		if f, err = e.uploadFrame(f); err != nil {
+			e.eh.Emit(astiencoder.EventError(e, fmt.Errorf("astilibav: uploading frame failed: %w", err)))
+			return
+		}
+		if f != p.Frame {
+			defer e.fp.put(f)
 		}
 	}
 
 	// Send frame to encoder
 	e.statWorkRatio.Begin()
-	if ret := avcodec.AvcodecSendFrame(e.ctxCodec, p.Frame); ret < 0 {
+	if ret := avcodec.AvcodecSendFrame(e.ctxCodec, f); ret < 0 {
 		e.statWorkRatio.End()
 		emitAvError(e, e.eh, ret, "avcodec.AvcodecSendFrame failed")
 		return
@@ -244,6 +363,14 @@ func (e *Encoder) encode(p *FrameHandlerPayload) {
 	}
 }
 
+// framePtsNs returns nil if the frame pts can't be converted to nanoseconds
+func (e *Encoder) framePtsNs(p *FrameHandlerPayload) *int64 {
+	if !e.kf.needsNs() || p.Descriptor == nil || p.Frame.Pts() == avutil.AV_NOPTS_VALUE {
+		return nil
+	}
+	return astikit.Int64Ptr(avutil.AvRescaleQ(p.Frame.Pts(), p.Descriptor.TimeBase(), nanosecondRational))
+}
+
 func (e *Encoder) receivePkt(p *FrameHandlerPayload) (stop bool) {
 	// Get pkt from pool
 	pkt := e.d.p.get()
@@ -272,6 +399,20 @@ func (e *Encoder) receivePkt(p *FrameHandlerPayload) (stop bool) {
 		e.previousDescriptor = d
 	}
 
+	// Check GOP
+	if e.closedGOP {
+		e.checkGOP(pkt, d)
+	}
+
+	// Get metadata
+	// Pts is still in the time base of the incoming frames at this point
+	m := e.mt.get(pkt.Pts())
+
+	// Forward frame side data that pkts support, such as HDR metadata
+	if err := pktRestoreSideData(pkt, e.sdt.get(pkt.Pts())); err != nil {
+		e.eh.Emit(astiencoder.EventError(e, fmt.Errorf("astilibav: restoring side data failed: %w", err)))
+	}
+
 	// Set pkt duration based on framerate
 	if f := e.ctxCodec.Framerate(); f.Num() > 0 {
 		pkt.SetDuration(avutil.AvRescaleQ(int64(1e9/f.ToDouble()), nanosecondRational, d.TimeBase()))
@@ -281,10 +422,60 @@ func (e *Encoder) receivePkt(p *FrameHandlerPayload) (stop bool) {
 	pkt.AvPacketRescaleTs(d.TimeBase(), e.ctxCodec.TimeBase())
 
 	// Dispatch pkt
-	e.d.dispatch(pkt, newEncoderDescriptor(e.ctxCodec))
+	e.d.dispatch(pkt, newEncoderDescriptor(e.ctxCodec, d), m)
 	return
 }
 
+// forcedKeyFramePts returns the pts in the encoder time base so that forced keyframes are keyed the same way
+// whatever the time base of the incoming frames
+func (e *Encoder) forcedKeyFramePts(pts int64, d Descriptor) int64 {
+	if d == nil || pts == avutil.AV_NOPTS_VALUE {
+		return pts
+	}
+	return avutil.AvRescaleQ(pts, d.TimeBase(), e.ctxCodec.TimeBase())
+}
+
+func (e *Encoder) checkGOP(pkt *avcodec.Packet, d Descriptor) {
+	// Get forced keyframe pts
+	fkfPts := e.forcedKeyFramePts(pkt.Pts(), d)
+
+	// Keyframe
+	if pkt.Flags()&avcodec.AV_PKT_FLAG_KEY > 0 {
+		// Store pts
+		e.lastKeyFramePts = astikit.Int64Ptr(pkt.Pts())
+		delete(e.forcedKeyFrames, fkfPts)
+		return
+	}
+
+	// A forced keyframe has not been created
+	if e.forcedKeyFrames[fkfPts] {
+		delete(e.forcedKeyFrames, fkfPts)
+		e.eh.Emit(astiencoder.Event{
+			Name:    EventNameEncoderOpenGOPDetected,
+			Payload: EncoderOpenGOP{Pts: pkt.Pts(), Reason: "forced keyframe has not been created"},
+			Target:  e,
+		})
+		return
+	}
+
+	// Pkts following a keyframe in decoding order but preceding it in presentation order are leading pictures that
+	// may reference the previous GOP
+	if e.lastKeyFramePts != nil && pkt.Pts() < *e.lastKeyFramePts {
+		e.eh.Emit(astiencoder.Event{
+			Name:    EventNameEncoderOpenGOPDetected,
+			Payload: EncoderOpenGOP{Pts: pkt.Pts(), Reason: "leading picture detected"},
+			Target:  e,
+		})
+	}
+}
+
+// EncoderOpenGOP represents an open GOP detected by the encoder
+type EncoderOpenGOP struct {
+	// Pts of the faulty pkt, in the time base of the incoming frames
+	Pts    int64
+	Reason string
+}
+
 // AddStream adds a stream based on the codec ctx
 func (e *Encoder) AddStream(ctxFormat *avformat.Context) (o *avformat.Stream, err error) {
 	// Add stream
@@ -298,6 +489,12 @@ func (e *Encoder) AddStream(ctxFormat *avformat.Context) (o *avformat.Stream, er
 
 	// Set other attributes
 	o.SetTimeBase(e.ctxCodec.TimeBase())
+
+	// Add HDR static metadata
+	if err = e.addHDRStreamSideData(o); err != nil {
+		err = fmt.Errorf("astilibav: adding HDR stream side data failed: %w", err)
+		return
+	}
 	return
 }
 
@@ -308,13 +505,22 @@ func (e *Encoder) FrameSize() int {
 
 type encoderDescriptor struct {
 	ctxCodec *avcodec.Context
+	prev     Descriptor
 }
 
-func newEncoderDescriptor(ctxCodec *avcodec.Context) *encoderDescriptor {
-	return &encoderDescriptor{ctxCodec: ctxCodec}
+func newEncoderDescriptor(ctxCodec *avcodec.Context, prev Descriptor) *encoderDescriptor {
+	return &encoderDescriptor{
+		ctxCodec: ctxCodec,
+		prev:     prev,
+	}
 }
 
 // TimeBase implements the Descriptor interface
 func (d *encoderDescriptor) TimeBase() avutil.Rational {
 	return d.ctxCodec.TimeBase()
 }
+
+// StreamDescriptor implements the StreamDescriber interface
+func (d *encoderDescriptor) StreamDescriptor() StreamDescriptor {
+	return newEncoderStreamDescriptor(d.ctxCodec, d.prev)
+}
@@ -0,0 +1,70 @@
+package astilibav
+
+import (
+	"strconv"
+)
+
+// EncoderCodecOptions represents encoder codec options
+// Fields that are not set are left to the codec defaults. Options that are not supported by the codec are ignored
+type EncoderCodecOptions struct {
+	// Max number of B frames between 2 non-B frames
+	BFrames *int
+	// Rate control buffer size in bits
+	BufSize *int
+	// Constant rate factor of encoders such as libx264, libx265 or libvpx
+	CRF *float64
+	// Codec-private options, such as {"x264-params": "keyint=60:min-keyint=60"}. Entries override the ones of the
+	// other fields
+	Dictionary map[string]string
+	// Overrides the GOP size of the ctx
+	GOPSize *int
+	// Max bitrate in bits per second
+	MaxRate *int
+	// Such as "veryfast" for libx264 or "p4" for nvenc
+	Preset string
+	// Such as "high" or "main"
+	Profile string
+	// Such as "film" or "zerolatency"
+	Tune string
+}
+
+// dictionary returns nil if no option has been set
+func (o EncoderCodecOptions) dictionary() (d map[string]string) {
+	// Add entries
+	d = make(map[string]string)
+	if o.BFrames != nil {
+		d["bf"] = strconv.Itoa(*o.BFrames)
+	}
+	if o.BufSize != nil {
+		d["bufsize"] = strconv.Itoa(*o.BufSize)
+	}
+	if o.CRF != nil {
+		d["crf"] = strconv.FormatFloat(*o.CRF, 'f', -1, 64)
+	}
+	if o.GOPSize != nil {
+		d["g"] = strconv.Itoa(*o.GOPSize)
+	}
+	if o.MaxRate != nil {
+		d["maxrate"] = strconv.Itoa(*o.MaxRate)
+	}
+	if o.Preset != "" {
+		d["preset"] = o.Preset
+	}
+	if o.Profile != "" {
+		d["profile"] = o.Profile
+	}
+	if o.Tune != "" {
+		d["tune"] = o.Tune
+	}
+
+	// Add dictionary entries
+	for k, v := range o.Dictionary {
+		d[k] = v
+	}
+
+	// No options
+	if len(d) == 0 {
+		d = nil
+	}
+	return
+}
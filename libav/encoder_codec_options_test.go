@@ -0,0 +1,33 @@
+package astilibav
+
+import (
+	"testing"
+
+	"github.com/asticode/go-astikit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncoderCodecOptions(t *testing.T) {
+	assert.Nil(t, EncoderCodecOptions{}.dictionary())
+	crf := 23.5
+	assert.Equal(t, map[string]string{
+		"bf":      "2",
+		"bufsize": "4000000",
+		"crf":     "23.5",
+		"g":       "50",
+		"maxrate": "2000000",
+		"preset":  "medium",
+		"profile": "main",
+		"tune":    "zerolatency",
+	}, EncoderCodecOptions{
+		BFrames:    astikit.IntPtr(2),
+		BufSize:    astikit.IntPtr(4000000),
+		CRF:        &crf,
+		Dictionary: map[string]string{"preset": "medium"},
+		GOPSize:    astikit.IntPtr(50),
+		MaxRate:    astikit.IntPtr(2000000),
+		Preset:     "veryfast",
+		Profile:    "main",
+		Tune:       "zerolatency",
+	}.dictionary())
+}
@@ -0,0 +1,87 @@
+package astilibav
+
+//#cgo pkg-config: libavcodec
+//#include <libavcodec/avcodec.h>
+import "C"
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unsafe"
+
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avformat"
+)
+
+// setColors sets the color properties of the ctx, 0 values being left to the codec defaults
+// They are signaled in the bitstream by most encoders and copied to the codec parameters of the stream
+func (e *Encoder) setColors(ctx Context) {
+	cc := (*C.AVCodecContext)(unsafe.Pointer(e.ctxCodec))
+	if ctx.ColorPrimaries > 0 {
+		cc.color_primaries = C.enum_AVColorPrimaries(ctx.ColorPrimaries)
+	}
+	if ctx.ColorRange > 0 {
+		cc.color_range = C.enum_AVColorRange(ctx.ColorRange)
+	}
+	if ctx.ColorSpace > 0 {
+		cc.colorspace = C.enum_AVColorSpace(ctx.ColorSpace)
+	}
+	if ctx.ColorTransfer > 0 {
+		cc.color_trc = C.enum_AVColorTransferCharacteristic(ctx.ColorTransfer)
+	}
+}
+
+// addHDRStreamSideData adds the HDR static metadata of the ctx to the stream so that muxers can signal it in the
+// container, such as with the mdcv and clli boxes in mp4
+func (e *Encoder) addHDRStreamSideData(s *avformat.Stream) error {
+	return streamAddSideData(s, newHDRSideDataEntries(e.masteringDisplay, e.contentLightLevel))
+}
+
+// encoderColors returns the color properties of the codec ctx
+func encoderColors(ctxCodec *avcodec.Context) (primaries, colorRange, space, transfer int) {
+	cc := (*C.AVCodecContext)(unsafe.Pointer(ctxCodec))
+	return int(cc.color_primaries), int(cc.color_range), int(cc.colorspace), int(cc.color_trc)
+}
+
+// encoderAddX265HDRParams adds HDR static metadata to the x265 params since libx265 doesn't read it from frames
+func encoderAddX265HDRParams(entries map[string]string, ctx Context) map[string]string {
+	// Get params
+	ps := encoderX265HDRParams(ctx.MasteringDisplay, ctx.ContentLightLevel)
+	if ps == "" {
+		return entries
+	}
+
+	// Add params
+	if entries == nil {
+		entries = make(map[string]string)
+	}
+	if v := entries["x265-params"]; v != "" {
+		ps = v + ":" + ps
+	}
+	entries["x265-params"] = ps
+	return entries
+}
+
+func encoderX265HDRParams(md *MasteringDisplay, cll *ContentLightLevel) string {
+	var ps []string
+	if md != nil && md.HasPrimaries && md.HasLuminance {
+		c := func(v float64) int { return int(math.Round(v * masteringDisplayChromaticityDen)) }
+		l := func(v float64) int { return int(math.Round(v * masteringDisplayLuminanceDen)) }
+		// Primaries are stored as R, G and B
+		ps = append(ps, fmt.Sprintf("master-display=G(%d,%d)B(%d,%d)R(%d,%d)WP(%d,%d)L(%d,%d)",
+			c(md.DisplayPrimaries[1][0]), c(md.DisplayPrimaries[1][1]),
+			c(md.DisplayPrimaries[2][0]), c(md.DisplayPrimaries[2][1]),
+			c(md.DisplayPrimaries[0][0]), c(md.DisplayPrimaries[0][1]),
+			c(md.WhitePoint[0]), c(md.WhitePoint[1]),
+			l(md.MaxLuminance), l(md.MinLuminance),
+		))
+	}
+	if cll != nil {
+		ps = append(ps, fmt.Sprintf("max-cll=%d,%d", cll.MaxCLL, cll.MaxFALL))
+	}
+	return strings.Join(ps, ":")
+}
+
+func encoderCodecName(cdc *avcodec.Codec) string {
+	return C.GoString((*C.AVCodec)(unsafe.Pointer(cdc)).name)
+}
@@ -0,0 +1,27 @@
+package astilibav
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncoderX265HDRParams(t *testing.T) {
+	md := &MasteringDisplay{
+		DisplayPrimaries: [3][2]float64{{0.68, 0.32}, {0.265, 0.69}, {0.15, 0.06}},
+		HasLuminance:     true,
+		HasPrimaries:     true,
+		MaxLuminance:     1000,
+		MinLuminance:     0.0001,
+		WhitePoint:       [2]float64{0.3127, 0.329},
+	}
+	cll := &ContentLightLevel{MaxCLL: 1000, MaxFALL: 400}
+	assert.Equal(t, "", encoderX265HDRParams(nil, nil))
+	assert.Equal(t, "", encoderX265HDRParams(&MasteringDisplay{}, nil))
+	assert.Equal(t, "max-cll=1000,400", encoderX265HDRParams(nil, cll))
+	assert.Equal(t, "master-display=G(13250,34500)B(7500,3000)R(34000,16000)WP(15635,16450)L(10000000,1):max-cll=1000,400", encoderX265HDRParams(md, cll))
+
+	assert.Nil(t, encoderAddX265HDRParams(nil, Context{}))
+	assert.Equal(t, map[string]string{"x265-params": "max-cll=1000,400"}, encoderAddX265HDRParams(nil, Context{ContentLightLevel: cll}))
+	assert.Equal(t, map[string]string{"x265-params": "keyint=60:max-cll=1000,400"}, encoderAddX265HDRParams(map[string]string{"x265-params": "keyint=60"}, Context{ContentLightLevel: cll}))
+}
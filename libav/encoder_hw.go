@@ -0,0 +1,108 @@
+package astilibav
+
+//#cgo pkg-config: libavcodec libavutil
+//#include <errno.h>
+//#include <libavcodec/avcodec.h>
+//#include <libavutil/buffer.h>
+//#include <libavutil/frame.h>
+//#include <libavutil/hwcontext.h>
+//static int astilibav_encoder_set_hw_device(AVCodecContext *ctx, const AVCodec *codec, AVBufferRef *device, enum AVHWDeviceType type, int pool_size) {
+//	for (int i = 0;; i++) {
+//		const AVCodecHWConfig *cfg = avcodec_get_hw_config(codec, i);
+//		if (!cfg) return AVERROR(ENOSYS);
+//		if (cfg->device_type != type) continue;
+//		if (cfg->methods & AV_CODEC_HW_CONFIG_METHOD_HW_FRAMES_CTX) {
+//			AVBufferRef *frames = av_hwframe_ctx_alloc(device);
+//			if (!frames) return AVERROR(ENOMEM);
+//			AVHWFramesContext *fc = (AVHWFramesContext *)frames->data;
+//			fc->format = cfg->pix_fmt;
+//			fc->sw_format = ctx->pix_fmt;
+//			fc->width = ctx->width;
+//			fc->height = ctx->height;
+//			fc->initial_pool_size = pool_size;
+//			int ret = av_hwframe_ctx_init(frames);
+//			if (ret < 0) {
+//				av_buffer_unref(&frames);
+//				return ret;
+//			}
+//			ctx->hw_frames_ctx = frames;
+//			ctx->pix_fmt = cfg->pix_fmt;
+//			return 0;
+//		}
+//		if (cfg->methods & AV_CODEC_HW_CONFIG_METHOD_HW_DEVICE_CTX) {
+//			if (!(ctx->hw_device_ctx = av_buffer_ref(device))) return AVERROR(ENOMEM);
+//			return 0;
+//		}
+//	}
+//}
+import "C"
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avutil"
+)
+
+// Some encoders, such as qsv ones, need frames to be preallocated
+const encoderHWFramesPoolSize = 20
+
+// It must be called once the pixel format and the size have been set, and before the codec is opened
+// If the encoder needs hardware frames, a frames ctx is allocated with the pixel format of the ctx as software format
+func (e *Encoder) setHWDevice(cdc *avcodec.Codec, hd *HWDevice, c *astikit.Closer) (err error) {
+	// Set device
+	cc := (*C.AVCodecContext)(unsafe.Pointer(e.ctxCodec))
+	if ret := C.astilibav_encoder_set_hw_device(cc, (*C.AVCodec)(unsafe.Pointer(cdc)), hd.ctx, hd.t, encoderHWFramesPoolSize); ret < 0 {
+		err = fmt.Errorf("astilibav: setting %s hardware device failed: %w", hd.Type(), NewAvError(int(ret)))
+		return
+	}
+
+	// Create frame pool
+	e.fp = newFramePool(c)
+
+	// Make sure refs are freed once the codec is closed
+	c.Add(func() error {
+		C.av_buffer_unref(&cc.hw_frames_ctx)
+		C.av_buffer_unref(&cc.hw_device_ctx)
+		return nil
+	})
+	return
+}
+
+// uploadFrame returns a hardware copy of the frame if the encoder needs hardware frames and the frame is a software one
+// The returned frame must be put back in the pool if it's different from the provided one
+func (e *Encoder) uploadFrame(f *avutil.Frame) (o *avutil.Frame, err error) {
+	// Nothing to upload
+	cc, cf := (*C.AVCodecContext)(unsafe.Pointer(e.ctxCodec)), (*C.AVFrame)(unsafe.Pointer(f))
+	if cc.hw_frames_ctx == nil || cf.hw_frames_ctx != nil {
+		o = f
+		return
+	}
+
+	// Get frame from pool
+	o = e.fp.get()
+
+	// Get buffer
+	co := (*C.AVFrame)(unsafe.Pointer(o))
+	if ret := C.av_hwframe_get_buffer(cc.hw_frames_ctx, co, 0); ret < 0 {
+		e.fp.put(o)
+		err = fmt.Errorf("astilibav: av_hwframe_get_buffer failed: %w", NewAvError(int(ret)))
+		return
+	}
+
+	// Transfer data
+	if ret := C.av_hwframe_transfer_data(co, cf, 0); ret < 0 {
+		e.fp.put(o)
+		err = fmt.Errorf("astilibav: av_hwframe_transfer_data failed: %w", NewAvError(int(ret)))
+		return
+	}
+
+	// Copy props
+	if ret := C.av_frame_copy_props(co, cf); ret < 0 {
+		e.fp.put(o)
+		err = fmt.Errorf("astilibav: av_frame_copy_props failed: %w", NewAvError(int(ret)))
+		return
+	}
+	return
+}
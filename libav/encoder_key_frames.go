@@ -0,0 +1,60 @@
+package astilibav
+
+import (
+	"sort"
+	"time"
+)
+
+type encoderKeyFrameForcer struct {
+	interval     time.Duration
+	lastInterval *int64
+	next         bool
+	pts          []int64
+}
+
+func newEncoderKeyFrameForcer(o EncoderOptions) *encoderKeyFrameForcer {
+	f := &encoderKeyFrameForcer{
+		interval: o.KeyFrameInterval,
+		pts:      append([]int64{}, o.KeyFramePts...),
+	}
+	sort.Slice(f.pts, func(i, j int) bool { return f.pts[i] < f.pts[j] })
+	return f
+}
+
+// force returns whether the frame must be a keyframe. ns is the frame pts in nanoseconds and is only used if an
+// interval has been provided
+func (f *encoderKeyFrameForcer) force(pts int64, ns *int64) (force bool) {
+	// Next frame has been requested to be a keyframe
+	if f.next {
+		f.next = false
+		force = true
+	}
+
+	// Pts
+	for len(f.pts) > 0 && f.pts[0] <= pts {
+		f.pts = f.pts[1:]
+		force = true
+	}
+
+	// Interval
+	// Since intervals are based on pts, encoders fed with the same frames force the same keyframes
+	if f.interval > 0 && ns != nil {
+		i := *ns / int64(f.interval)
+		if f.lastInterval == nil || i > *f.lastInterval {
+			f.lastInterval = &i
+			force = true
+		}
+	}
+	return
+}
+
+func (f *encoderKeyFrameForcer) needsNs() bool {
+	return f.interval > 0
+}
+
+// ForceNextKeyFrame forces the next incoming frame to be encoded as a keyframe
+func (e *Encoder) ForceNextKeyFrame() {
+	e.c.Add(func() {
+		e.kf.next = true
+	})
+}
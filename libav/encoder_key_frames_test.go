@@ -0,0 +1,31 @@
+package astilibav
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncoderKeyFrameForcer(t *testing.T) {
+	f := newEncoderKeyFrameForcer(EncoderOptions{KeyFramePts: []int64{30, 10}})
+	assert.False(t, f.force(0, nil))
+	f.next = true
+	assert.True(t, f.force(5, nil))
+	assert.False(t, f.force(6, nil))
+	assert.True(t, f.force(12, nil))
+	assert.False(t, f.force(20, nil))
+	assert.True(t, f.force(40, nil))
+	assert.False(t, f.force(50, nil))
+
+	f = newEncoderKeyFrameForcer(EncoderOptions{KeyFrameInterval: 2 * time.Second})
+	ns := func(d time.Duration) *int64 {
+		v := int64(d)
+		return &v
+	}
+	assert.True(t, f.force(0, ns(0)))
+	assert.False(t, f.force(1, ns(time.Second)))
+	assert.True(t, f.force(2, ns(2*time.Second)))
+	assert.False(t, f.force(3, ns(3*time.Second)))
+	assert.True(t, f.force(5, ns(5*time.Second)))
+}
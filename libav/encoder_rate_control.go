@@ -0,0 +1,128 @@
+package astilibav
+
+//#cgo pkg-config: libavcodec libavutil
+//#include <stdlib.h>
+//#include <libavcodec/avcodec.h>
+//#include <libavutil/opt.h>
+import "C"
+import (
+	"unsafe"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+)
+
+// EncoderRateControl represents encoder rate control parameters that can be updated while encoding
+type EncoderRateControl struct {
+	// If > 0, the bit rate is updated
+	BitRate int
+	// If > 0, the "crf" private option is updated
+	CRF float64
+}
+
+// EncoderRateControlUpdate represents an encoder rate control update that has been applied
+type EncoderRateControlUpdate struct {
+	// Pts of the first frame encoded with the update, if it has been scheduled with ReconfigureAt
+	Pts         *int64
+	RateControl EncoderRateControl
+}
+
+type encoderReconfiguration struct {
+	pts int64
+	rc  EncoderRateControl
+}
+
+// encoderReconfigurations are sorted by pts
+type encoderReconfigurations []encoderReconfiguration
+
+func (rs encoderReconfigurations) add(r encoderReconfiguration) encoderReconfigurations {
+	// Get position
+	idx := len(rs)
+	for i, v := range rs {
+		if v.pts > r.pts {
+			idx = i
+			break
+		}
+	}
+
+	// Insert
+	rs = append(rs, encoderReconfiguration{})
+	copy(rs[idx+1:], rs[idx:])
+	rs[idx] = r
+	return rs
+}
+
+// due returns the reconfigurations whose pts is <= to the provided pts and the remaining ones
+func (rs encoderReconfigurations) due(pts int64) (due, remaining encoderReconfigurations) {
+	idx := 0
+	for idx < len(rs) && rs[idx].pts <= pts {
+		idx++
+	}
+	return rs[:idx], rs[idx:]
+}
+
+// UpdateRateControl updates the rate control of the encoder before the next incoming frame is encoded
+// Only encoders reconfiguring themselves between frames, such as libx264, take the update into account
+func (e *Encoder) UpdateRateControl(rc EncoderRateControl) {
+	e.c.Add(func() {
+		e.applyRateControl(rc, nil)
+	})
+}
+
+// SetBitrate updates the bit rate of the encoder before the next incoming frame is encoded
+func (e *Encoder) SetBitrate(b int64) {
+	e.UpdateRateControl(EncoderRateControl{BitRate: int(b)})
+}
+
+// ReconfigureAt updates the rate control of the encoder right before the first incoming frame whose pts is >= to the
+// provided pts is encoded, which allows several renditions to switch at the same frame. Pts is in the time base of
+// incoming frames
+func (e *Encoder) ReconfigureAt(pts int64, rc EncoderRateControl) {
+	e.c.Add(func() {
+		e.reconfigurations = e.reconfigurations.add(encoderReconfiguration{
+			pts: pts,
+			rc:  rc,
+		})
+	})
+}
+
+// Assumes it's called in the chan
+func (e *Encoder) applyReconfigurations(pts int64) {
+	// Get due reconfigurations
+	var due encoderReconfigurations
+	if due, e.reconfigurations = e.reconfigurations.due(pts); len(due) == 0 {
+		return
+	}
+
+	// Loop through due reconfigurations
+	for _, r := range due {
+		e.applyRateControl(r.rc, astikit.Int64Ptr(pts))
+	}
+}
+
+func (e *Encoder) applyRateControl(rc EncoderRateControl, pts *int64) {
+	// Update bit rate
+	if rc.BitRate > 0 {
+		e.ctxCodec.SetBitRate(int64(rc.BitRate))
+	}
+
+	// Update crf
+	if rc.CRF > 0 {
+		n := C.CString("crf")
+		defer C.free(unsafe.Pointer(n))
+		if ret := C.av_opt_set_double(unsafe.Pointer(e.ctxCodec), n, C.double(rc.CRF), C.AV_OPT_SEARCH_CHILDREN); ret < 0 {
+			emitAvError(e, e.eh, int(ret), "C.av_opt_set_double on crf %v failed", rc.CRF)
+			return
+		}
+	}
+
+	// Send event
+	e.eh.Emit(astiencoder.Event{
+		Name: EventNameEncoderRateControlUpdated,
+		Payload: EncoderRateControlUpdate{
+			Pts:         pts,
+			RateControl: rc,
+		},
+		Target: e,
+	})
+}
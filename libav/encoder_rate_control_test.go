@@ -0,0 +1,22 @@
+package astilibav
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncoderReconfigurations(t *testing.T) {
+	var rs encoderReconfigurations
+	rs = rs.add(encoderReconfiguration{pts: 20, rc: EncoderRateControl{BitRate: 2}})
+	rs = rs.add(encoderReconfiguration{pts: 10, rc: EncoderRateControl{BitRate: 1}})
+	rs = rs.add(encoderReconfiguration{pts: 30, rc: EncoderRateControl{BitRate: 3}})
+	assert.Equal(t, []int64{10, 20, 30}, []int64{rs[0].pts, rs[1].pts, rs[2].pts})
+
+	due, rs := rs.due(5)
+	assert.Empty(t, due)
+	assert.Len(t, rs, 3)
+	due, rs = rs.due(20)
+	assert.Equal(t, encoderReconfigurations{{pts: 10, rc: EncoderRateControl{BitRate: 1}}, {pts: 20, rc: EncoderRateControl{BitRate: 2}}}, due)
+	assert.Equal(t, encoderReconfigurations{{pts: 30, rc: EncoderRateControl{BitRate: 3}}}, rs)
+}
@@ -0,0 +1,95 @@
+package astilibav
+
+import (
+	"sync"
+
+	"github.com/asticode/go-astiencoder"
+)
+
+// EOSHandler represents a node that can handle the end of stream of one of its inputs
+// The demuxer sends it downstream on EOF. Decoders, encoders, filterers and bitstream filterers drain their internal
+// buffers before forwarding it and muxers write their trailer and stop once all their streams have ended. Nodes that
+// don't implement this interface don't forward it, in which case the workflow completes when the nodes are stopped
+type EOSHandler interface {
+	HandleEOS(p *EOSHandlerPayload)
+}
+
+// EOSHandlerPayload represents an EOSHandler payload
+type EOSHandlerPayload struct {
+	Node astiencoder.Node
+}
+
+func (d *pktDispatcher) dispatchEOS() {
+	// Copy handlers
+	d.m.Lock()
+	var hs []EOSHandler
+	for _, h := range d.hs {
+		if v, ok := h.(EOSHandler); ok {
+			hs = append(hs, v)
+		}
+	}
+	d.m.Unlock()
+
+	// Dispatch
+	dispatchEOS(hs, d.n, d.wait, d.wg)
+}
+
+func (d *frameDispatcher) dispatchEOS() {
+	// Copy handlers
+	d.m.Lock()
+	var hs []EOSHandler
+	for _, h := range d.hs {
+		if v, ok := h.(EOSHandler); ok {
+			hs = append(hs, v)
+		}
+	}
+	d.m.Unlock()
+
+	// Dispatch
+	dispatchEOS(hs, d.n, d.wait, d.wg)
+}
+
+func (d *subtitleDispatcher) dispatchEOS() {
+	// Copy handlers
+	d.m.Lock()
+	var hs []EOSHandler
+	for _, h := range d.hs {
+		if v, ok := h.(EOSHandler); ok {
+			hs = append(hs, v)
+		}
+	}
+	d.m.Unlock()
+
+	// Dispatch
+	dispatchEOS(hs, d.n, d.wait, d.wg)
+}
+
+func dispatchEOS(hs []EOSHandler, n astiencoder.Node, wait func(), wg *sync.WaitGroup) {
+	// No handlers
+	if len(hs) == 0 {
+		return
+	}
+
+	// Wait for all previous subprocesses to be done so that the end of stream is handled after the last unit
+	wait()
+
+	// Add subprocesses
+	wg.Add(len(hs))
+
+	// Loop through handlers
+	// Since nodes wait for their dispatcher before stopping, the end of stream has been handled downstream before the
+	// next nodes are stopped
+	for _, h := range hs {
+		go func(h EOSHandler) {
+			defer wg.Done()
+			h.HandleEOS(&EOSHandlerPayload{Node: n})
+		}(h)
+	}
+}
+
+// HandleEOS implements the EOSHandler interface
+func (c *pktCond) HandleEOS(p *EOSHandlerPayload) {
+	if v, ok := c.PktHandler.(EOSHandler); ok {
+		v.HandleEOS(p)
+	}
+}
@@ -2,7 +2,45 @@ package astilibav
 
 // Event names
 const (
-	EventNameFiltererSwitchInDone  = "astilibav.filterer.switch.in.done"
-	EventNameFiltererSwitchOutDone = "astilibav.filterer.switch.out.done"
-	EventNameRateEnforcerSwitched  = "astilibav.rate.enforcer.switched"
+	EventNameAudioLevelMeterLevels             = "astilibav.audio.level.meter.levels"
+	EventNameBackpressure                      = "astilibav.backpressure"
+	EventNameClosedCaptionsExtracted           = "astilibav.closed.captions.extracted"
+	EventNameContentAdaptiveControllerAdjusted = "astilibav.content.adaptive.controller.adjusted"
+	EventNameDeadFeedDetectorDefectEnded       = "astilibav.dead.feed.detector.defect.ended"
+	EventNameDeadFeedDetectorDefectStarted     = "astilibav.dead.feed.detector.defect.started"
+	EventNameDemuxerReconnected                = "astilibav.demuxer.reconnected"
+	EventNameDemuxerReconnecting               = "astilibav.demuxer.reconnecting"
+	EventNameDemuxerStreamLost                 = "astilibav.demuxer.stream.lost"
+	EventNameDemuxerUnusedOptions              = "astilibav.demuxer.unused.options"
+	EventNameEncoderOpenGOPDetected            = "astilibav.encoder.open.gop.detected"
+	EventNameEncoderRateControlUpdated         = "astilibav.encoder.rate.control.updated"
+	EventNameFiltererSwitchInDone              = "astilibav.filterer.switch.in.done"
+	EventNameFiltererSwitchOutDone             = "astilibav.filterer.switch.out.done"
+	EventNameFingerprinterFingerprint          = "astilibav.fingerprinter.fingerprint"
+	EventNameLiveToVODArchiverDone             = "astilibav.live.to.vod.archiver.done"
+	EventNameLoudnessMeterReport               = "astilibav.loudness.meter.report"
+	EventNameLoudnessNormalizerReport          = "astilibav.loudness.normalizer.report"
+	EventNameMuxerDisconnected                 = "astilibav.muxer.disconnected"
+	EventNameMuxerHeaderWritten                = "astilibav.muxer.header.written"
+	EventNameMuxerInterleaveOverflow           = "astilibav.muxer.interleave.overflow"
+	EventNameMuxerReconnected                  = "astilibav.muxer.reconnected"
+	EventNameMuxerSegmentDone                  = "astilibav.muxer.segment.done"
+	EventNameMuxerTrailerWritten               = "astilibav.muxer.trailer.written"
+	EventNameMuxerUnusedOptions                = "astilibav.muxer.unused.options"
+	EventNameNoSignalWatchdogAlarm             = "astilibav.no.signal.watchdog.alarm"
+	EventNameNoSignalWatchdogRestored          = "astilibav.no.signal.watchdog.restored"
+	EventNamePerceptualHasherHash              = "astilibav.perceptual.hasher.hash"
+	EventNamePktFanOutOutputDetached           = "astilibav.pkt.fan.out.output.detached"
+	EventNameQualityMeterReport                = "astilibav.quality.meter.report"
+	EventNameQualityMeterScores                = "astilibav.quality.meter.scores"
+	EventNameRateEnforcerSwitched              = "astilibav.rate.enforcer.switched"
+	EventNameRestamperDiscontinuity            = "astilibav.restamper.discontinuity"
+	EventNameRotatingMuxerFileFinalized        = "astilibav.rotating.muxer.file.finalized"
+	EventNameSceneDetectorScore                = "astilibav.scene.detector.score"
+	EventNameSceneDetectorSceneDetected        = "astilibav.scene.detector.scene.detected"
+	EventNameSplitterSegmentDone               = "astilibav.splitter.segment.done"
+	EventNameStallWatchdogNodeStalled          = "astilibav.stall.watchdog.node.stalled"
+	EventNameTeeMuxerOutputFailed              = "astilibav.tee.muxer.output.failed"
+	EventNameTR101290Violation                 = "astilibav.tr101290.violation"
+	EventNameVolumeSetGain                     = "astilibav.volume.set.gain"
 )
@@ -0,0 +1,262 @@
+package astilibav
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/asticode/goav/avfilter"
+)
+
+var (
+	filterGraphNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+	// Characters that are special when parsing filter options and when parsing the graph
+	filterGraphOptionEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`)
+	filterGraphGraphEscaper  = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `[`, `\[`, `]`, `\]`, `,`, `\,`, `;`, `\;`)
+)
+
+// Allows mocking filters lookup
+var filterGraphFilterExists = func(name string) bool {
+	return avfilter.AvfilterGetByName(name) != nil
+}
+
+// FilterGraph represents a builder of a linear chain of filters that can be used as filterer content instead of a raw
+// string, such as NewFilterGraph().Scale(1280, 720).Fps(30, 1).Build()
+// Values are escaped and options are validated as filters are added. Only the first error is kept and is returned by
+// Build
+type FilterGraph struct {
+	err *FilterGraphError
+	fs  []filterGraphFilter
+}
+
+type filterGraphFilter struct {
+	name    string
+	options []FilterGraphOption
+}
+
+// FilterGraphOption represents a filter option
+type FilterGraphOption struct {
+	Key   string
+	Value string
+}
+
+// FilterGraphError represents an error of a filter graph pointing to the offending filter and option
+type FilterGraphError struct {
+	Filter string
+	// Position of the filter in the chain
+	Index int
+	// Empty if the error is not related to an option
+	Option string
+	Reason string
+}
+
+// Error implements the error interface
+func (e *FilterGraphError) Error() string {
+	if e.Filter == "" {
+		return fmt.Sprintf("astilibav: filter graph is invalid: %s", e.Reason)
+	}
+	if e.Option != "" {
+		return fmt.Sprintf("astilibav: option %s of filter #%d %s is invalid: %s", e.Option, e.Index, e.Filter, e.Reason)
+	}
+	return fmt.Sprintf("astilibav: filter #%d %s is invalid: %s", e.Index, e.Filter, e.Reason)
+}
+
+// NewFilterGraph creates a new filter graph builder
+func NewFilterGraph() *FilterGraph {
+	return &FilterGraph{}
+}
+
+// Filter adds a filter with its options, in order. It can be used for filters that don't have a dedicated method
+func (g *FilterGraph) Filter(name string, options ...FilterGraphOption) *FilterGraph {
+	// An error has already occurred
+	if g.err != nil {
+		return g
+	}
+
+	// Check name
+	if !filterGraphNameRegexp.MatchString(name) {
+		return g.fail(name, "", "invalid name")
+	}
+
+	// Check options
+	for _, o := range options {
+		if !filterGraphNameRegexp.MatchString(o.Key) {
+			return g.fail(name, o.Key, "invalid key")
+		}
+	}
+
+	// Append
+	g.fs = append(g.fs, filterGraphFilter{
+		name:    name,
+		options: options,
+	})
+	return g
+}
+
+func (g *FilterGraph) fail(filter, option, reason string) *FilterGraph {
+	// Only the first error is kept
+	if g.err != nil {
+		return g
+	}
+	g.err = &FilterGraphError{
+		Filter: filter,
+		Index:  len(g.fs),
+		Option: option,
+		Reason: reason,
+	}
+	return g
+}
+
+// Scale adds a "scale" filter. A dimension can be -1 to keep the aspect ratio, or -2 to keep it with an even value
+func (g *FilterGraph) Scale(width, height int) *FilterGraph {
+	if width < -2 || width == 0 {
+		return g.fail("scale", "w", fmt.Sprintf("%d is not a valid width", width))
+	}
+	if height < -2 || height == 0 {
+		return g.fail("scale", "h", fmt.Sprintf("%d is not a valid height", height))
+	}
+	if width < 0 && height < 0 {
+		return g.fail("scale", "w", "width and height can't both be computed")
+	}
+	return g.Filter("scale", FilterGraphOption{Key: "w", Value: strconv.Itoa(width)}, FilterGraphOption{Key: "h", Value: strconv.Itoa(height)})
+}
+
+// Fps adds a "fps" filter with a num/den frame rate, such as 30000/1001
+func (g *FilterGraph) Fps(num, den int) *FilterGraph {
+	if num <= 0 || den <= 0 {
+		return g.fail("fps", "fps", fmt.Sprintf("%d/%d is not a valid frame rate", num, den))
+	}
+	return g.Filter("fps", FilterGraphOption{Key: "fps", Value: fmt.Sprintf("%d/%d", num, den)})
+}
+
+// Format adds a "format" filter with the name of a pixel format, such as "yuv420p"
+func (g *FilterGraph) Format(pixelFormat string) *FilterGraph {
+	if pixelFormat == "" {
+		return g.fail("format", "pix_fmts", "no pixel format provided")
+	}
+	return g.Filter("format", FilterGraphOption{Key: "pix_fmts", Value: pixelFormat})
+}
+
+// Crop adds a "crop" filter
+func (g *FilterGraph) Crop(width, height, x, y int) *FilterGraph {
+	if width <= 0 {
+		return g.fail("crop", "w", fmt.Sprintf("%d is not a valid width", width))
+	}
+	if height <= 0 {
+		return g.fail("crop", "h", fmt.Sprintf("%d is not a valid height", height))
+	}
+	if x < 0 {
+		return g.fail("crop", "x", fmt.Sprintf("%d is not a valid position", x))
+	}
+	if y < 0 {
+		return g.fail("crop", "y", fmt.Sprintf("%d is not a valid position", y))
+	}
+	return g.Filter("crop",
+		FilterGraphOption{Key: "w", Value: strconv.Itoa(width)},
+		FilterGraphOption{Key: "h", Value: strconv.Itoa(height)},
+		FilterGraphOption{Key: "x", Value: strconv.Itoa(x)},
+		FilterGraphOption{Key: "y", Value: strconv.Itoa(y)},
+	)
+}
+
+// FilterGraphDrawTextOptions represents "drawtext" filter options
+// Empty options are not added so that libavfilter defaults are used
+type FilterGraphDrawTextOptions struct {
+	// Such as "white" or "0xffffff@0.5"
+	FontColor string
+	FontFile  string
+	FontSize  int
+	Text      string
+	// Expressions, such as "(w-text_w)/2"
+	X string
+	Y string
+}
+
+// DrawText adds a "drawtext" filter
+func (g *FilterGraph) DrawText(o FilterGraphDrawTextOptions) *FilterGraph {
+	if o.Text == "" {
+		return g.fail("drawtext", "text", "no text provided")
+	}
+	if o.FontSize < 0 {
+		return g.fail("drawtext", "fontsize", fmt.Sprintf("%d is not a valid font size", o.FontSize))
+	}
+	opts := []FilterGraphOption{{Key: "text", Value: o.Text}}
+	if o.FontColor != "" {
+		opts = append(opts, FilterGraphOption{Key: "fontcolor", Value: o.FontColor})
+	}
+	if o.FontFile != "" {
+		opts = append(opts, FilterGraphOption{Key: "fontfile", Value: o.FontFile})
+	}
+	if o.FontSize > 0 {
+		opts = append(opts, FilterGraphOption{Key: "fontsize", Value: strconv.Itoa(o.FontSize)})
+	}
+	if o.X != "" {
+		opts = append(opts, FilterGraphOption{Key: "x", Value: o.X})
+	}
+	if o.Y != "" {
+		opts = append(opts, FilterGraphOption{Key: "y", Value: o.Y})
+	}
+	return g.Filter("drawtext", opts...)
+}
+
+// Volume adds a "volume" filter, 1 meaning the volume is unchanged
+func (g *FilterGraph) Volume(v float64) *FilterGraph {
+	if v < 0 {
+		return g.fail("volume", "volume", fmt.Sprintf("%g is not a valid volume", v))
+	}
+	return g.Filter("volume", FilterGraphOption{Key: "volume", Value: strconv.FormatFloat(v, 'f', -1, 64)})
+}
+
+// AResample adds an "aresample" filter
+func (g *FilterGraph) AResample(sampleRate int) *FilterGraph {
+	if sampleRate <= 0 {
+		return g.fail("aresample", "sample_rate", fmt.Sprintf("%d is not a valid sample rate", sampleRate))
+	}
+	return g.Filter("aresample", FilterGraphOption{Key: "sample_rate", Value: strconv.Itoa(sampleRate)})
+}
+
+// String returns the content of the graph, whether it's valid or not
+func (g *FilterGraph) String() string {
+	var fs []string
+	for _, f := range g.fs {
+		// No options
+		if len(f.options) == 0 {
+			fs = append(fs, f.name)
+			continue
+		}
+
+		// Loop through options
+		var opts []string
+		for _, o := range f.options {
+			opts = append(opts, o.Key+"="+filterGraphGraphEscaper.Replace(filterGraphOptionEscaper.Replace(o.Value)))
+		}
+		fs = append(fs, f.name+"="+strings.Join(opts, ":"))
+	}
+	return strings.Join(fs, ",")
+}
+
+// Build checks that filters exist and returns the content of the graph
+func (g *FilterGraph) Build() (string, error) {
+	// An error has occurred while adding filters
+	if g.err != nil {
+		return "", g.err
+	}
+
+	// No filters
+	if len(g.fs) == 0 {
+		return "", &FilterGraphError{Reason: "no filters"}
+	}
+
+	// Check filters exist
+	for idx, f := range g.fs {
+		if !filterGraphFilterExists(f.name) {
+			return "", &FilterGraphError{
+				Filter: f.name,
+				Index:  idx,
+				Reason: "filter doesn't exist",
+			}
+		}
+	}
+	return g.String(), nil
+}
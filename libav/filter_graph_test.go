@@ -0,0 +1,43 @@
+package astilibav
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterGraph(t *testing.T) {
+	// Mock filters lookup
+	fn := filterGraphFilterExists
+	defer func() { filterGraphFilterExists = fn }()
+	filterGraphFilterExists = func(name string) bool { return name != "invalid" }
+
+	// Valid
+	s, err := NewFilterGraph().Scale(1280, -2).Fps(30000, 1001).Format("yuv420p").DrawText(FilterGraphDrawTextOptions{
+		FontSize: 24,
+		Text:     "it's 10:00, [live]",
+		X:        "(w-text_w)/2",
+	}).Build()
+	assert.NoError(t, err)
+	assert.Equal(t, `scale=w=1280:h=-2,fps=fps=30000/1001,format=pix_fmts=yuv420p,drawtext=text=it\\\'s 10\\:00\, \[live\]:fontsize=24:x=(w-text_w)/2`, s)
+	s, err = NewFilterGraph().Filter("hflip").Volume(0.5).Build()
+	assert.NoError(t, err)
+	assert.Equal(t, "hflip,volume=volume=0.5", s)
+
+	// Invalid option
+	_, err = NewFilterGraph().Fps(30, 1).Scale(-1, -1).Crop(10, 10, 0, 0).Build()
+	var e *FilterGraphError
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, FilterGraphError{Filter: "scale", Index: 1, Option: "w", Reason: "width and height can't both be computed"}, *e)
+	_, err = NewFilterGraph().Filter("scale", FilterGraphOption{Key: "w=1", Value: "2"}).Build()
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, FilterGraphError{Filter: "scale", Option: "w=1", Reason: "invalid key"}, *e)
+
+	// Invalid filter
+	_, err = NewFilterGraph().Filter("hflip").Filter("invalid").Build()
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, FilterGraphError{Filter: "invalid", Index: 1, Reason: "filter doesn't exist"}, *e)
+	_, err = NewFilterGraph().Build()
+	assert.EqualError(t, err, "astilibav: filter graph is invalid: no filters")
+}
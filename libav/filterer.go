@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"image"
 	"sync"
 	"sync/atomic"
 
@@ -19,14 +20,17 @@ var countFilterer uint64
 // Filterer represents an object capable of applying a filter to frames
 type Filterer struct {
 	*astiencoder.BaseNode
-	bufferSinkCtx    *avfilter.Context
 	bufferSrcCtxs    map[astiencoder.Node]*avfilter.Context
 	c                *astikit.Chan
 	cl               *astikit.Closer
 	ccl              *astikit.Closer // Child closer used to close only things related to the filterer
-	d                *frameDispatcher
+	dropSideData     []int           // Types of the side data removed from outgoing frames
 	eh               *astiencoder.EventHandler
+	eos              map[astiencoder.Node]bool
 	g                *avfilter.Graph
+	inputTimeBases   map[astiencoder.Node]avutil.Rational
+	os               []*FiltererOutput
+	previous         Descriptor
 	restamper        FrameRestamper
 	s                FiltererSwitcher
 	statIncomingRate *astikit.CounterAvgStat
@@ -35,17 +39,29 @@ type Filterer struct {
 
 // FiltererOptions represents filterer options
 type FiltererOptions struct {
-	Content   string
-	Inputs    map[string]FiltererInput
-	Node      astiencoder.NodeOptions
+	Content string
+	// Indexed by the name of the pad they're linked to in the content. Several inputs allow using filters such as
+	// "overlay" or "amix", for instance with "[main][logo]overlay=10:10" and 2 inputs named "main" and "logo"
+	Inputs map[string]FiltererInput
+	Node   astiencoder.NodeOptions
+	// Names of the pads of the content that frames are pulled from, which allows using filters such as "split" or
+	// "asplit", for instance with "split[hd][sd];[sd]scale=w=640:h=360[sd]" and 2 outputs named "hd" and "sd".
+	// Frames of the first output are dispatched to the nodes connected to the filterer, frames of the other outputs
+	// are dispatched to the nodes connected with Output(). Defaults to a single output named "out"
+	Outputs []string
+	// Only applied to frames of the first output
 	Restamper FrameRestamper
-	Switcher  FiltererSwitcher
+	// Only applied to frames of the first output. Switching a filterer with several outputs is not supported
+	Switcher FiltererSwitcher
 }
 
 // FiltererInput represents a filterer input
 type FiltererInput struct {
+	// Parameters of the frames sent by the node. Frames whose descriptor has a different time base have their
+	// timestamps rescaled to this time base before being pushed in the graph
 	Context Context
-	Node    astiencoder.Node
+	// Each input must have a different node
+	Node astiencoder.Node
 }
 
 // NewFilterer creates a new filterer
@@ -56,7 +72,9 @@ func NewFilterer(o FiltererOptions, eh *astiencoder.EventHandler, c *astikit.Clo
 
 	// Create filterer
 	f = &Filterer{
-		bufferSrcCtxs: make(map[astiencoder.Node]*avfilter.Context),
+		bufferSrcCtxs:  make(map[astiencoder.Node]*avfilter.Context),
+		eos:            make(map[astiencoder.Node]bool),
+		inputTimeBases: make(map[astiencoder.Node]avutil.Rational),
 		c: astikit.NewChan(astikit.ChanOptions{
 			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
 			ProcessAll:  true,
@@ -71,7 +89,16 @@ func NewFilterer(o FiltererOptions, eh *astiencoder.EventHandler, c *astikit.Clo
 		statWorkRatio:    astikit.NewDurationPercentageStat(),
 	}
 	f.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(f), eh)
-	f.d = newFrameDispatcher(f, eh, f.ccl)
+
+	// Default outputs
+	if len(o.Outputs) == 0 {
+		o.Outputs = []string{"out"}
+	}
+
+	// Create outputs
+	for _, n := range o.Outputs {
+		f.os = append(f.os, newFiltererOutput(f, n))
+	}
 	f.addStats()
 
 	// We need a filterer switcher
@@ -120,25 +147,37 @@ func NewFilterer(o FiltererOptions, eh *astiencoder.EventHandler, c *astikit.Clo
 		bufferSink = avfilter.AvfilterGetByName("buffersink")
 	}
 
-	// Create buffer sink ctx
-	// We need to create an intermediate variable to avoid "cgo argument has Go pointer to Go pointer" errors
-	var bufferSinkCtx *avfilter.Context
-	if ret := avfilter.AvfilterGraphCreateFilter(&bufferSinkCtx, bufferSink, "out", "", nil, f.g); ret < 0 {
-		err = fmt.Errorf("astilibav: avfilter.AvfilterGraphCreateFilter on empty args failed: %w", NewAvError(ret))
-		return
+	// Loop through outputs in reverse order so that the first output is the head of the list
+	var inputs *avfilter.Input
+	for idx := len(f.os) - 1; idx >= 0; idx-- {
+		// Create buffer sink ctx
+		// We need to create an intermediate variable to avoid "cgo argument has Go pointer to Go pointer" errors
+		out := f.os[idx]
+		var bufferSinkCtx *avfilter.Context
+		if ret := avfilter.AvfilterGraphCreateFilter(&bufferSinkCtx, bufferSink, out.name, "", nil, f.g); ret < 0 {
+			err = fmt.Errorf("astilibav: avfilter.AvfilterGraphCreateFilter on empty args failed: %w", NewAvError(ret))
+			return
+		}
+		out.bufferSinkCtx = bufferSinkCtx
+
+		// Create inputs
+		i := avfilter.AvfilterInoutAlloc()
+		i.SetName(out.name)
+		i.SetFilterCtx(out.bufferSinkCtx)
+		i.SetPadIdx(0)
+		i.SetNext(inputs)
+		inputs = i
 	}
-	f.bufferSinkCtx = bufferSinkCtx
-
-	// Create inputs
-	inputs := avfilter.AvfilterInoutAlloc()
-	inputs.SetName("out")
-	inputs.SetFilterCtx(f.bufferSinkCtx)
-	inputs.SetPadIdx(0)
-	inputs.SetNext(nil)
 
 	// Loop through options inputs
 	var previousOutput *avfilter.Input
 	for n, i := range o.Inputs {
+		// Frames are matched with their input through their node
+		if _, ok := f.bufferSrcCtxs[i.Node]; ok {
+			err = fmt.Errorf("astilibav: node of input %s is used by another input", n)
+			return
+		}
+
 		// Create buffer
 		bufferSrc := bufferFunc()
 
@@ -155,8 +194,9 @@ func NewFilterer(o FiltererOptions, eh *astiencoder.EventHandler, c *astikit.Clo
 		}
 
 		// Create ctx
+		// It's named after its pad so that it can be targeted by commands
 		var bufferSrcCtx *avfilter.Context
-		if ret := avfilter.AvfilterGraphCreateFilter(&bufferSrcCtx, bufferSrc, "in", args, nil, f.g); ret < 0 {
+		if ret := avfilter.AvfilterGraphCreateFilter(&bufferSrcCtx, bufferSrc, n, args, nil, f.g); ret < 0 {
 			err = fmt.Errorf("astilibav: avfilter.AvfilterGraphCreateFilter on args %s failed: %w", args, NewAvError(ret))
 			return
 		}
@@ -170,6 +210,7 @@ func NewFilterer(o FiltererOptions, eh *astiencoder.EventHandler, c *astikit.Clo
 
 		// Store ctx
 		f.bufferSrcCtxs[i.Node] = bufferSrcCtx
+		f.inputTimeBases[i.Node] = i.Context.TimeBase
 
 		// Set previous output
 		previousOutput = outputs
@@ -205,35 +246,48 @@ func (f *Filterer) addStats() {
 	}, f.statWorkRatio)
 
 	// Add dispatcher stats
-	f.d.addStats(f.Stater())
+	// Labels of the other outputs are suffixed with their name so that stats don't collide
+	for idx, o := range f.os {
+		if idx == 0 {
+			o.d.addStats(f.Stater())
+			continue
+		}
+		f.Stater().AddStat(astikit.StatMetadata{
+			Description: fmt.Sprintf("Percentage of time spent waiting for first child to finish processing frame dispatched by output %s", o.name),
+			Label:       fmt.Sprintf("Dispatch ratio (%s)", o.name),
+			Unit:        "%",
+		}, o.d.statDispatch)
+	}
 
 	// Add queue stats
 	f.c.AddStats(f.Stater())
 }
 
 // Connect implements the FrameHandlerConnector interface
+// Handlers are connected to the first output
 func (f *Filterer) Connect(h FrameHandler) {
-	// Add handler
-	f.d.addHandler(h)
-
-	// Connect nodes
-	astiencoder.ConnectNodes(f, h)
+	f.os[0].Connect(h)
 }
 
 // Disconnect implements the FrameHandlerConnector interface
 func (f *Filterer) Disconnect(h FrameHandler) {
-	// Delete handler
-	f.d.delHandler(h)
+	f.os[0].Disconnect(h)
+}
 
-	// Disconnect nodes
-	astiencoder.DisconnectNodes(f, h)
+// Snapshot implements the astiencoder.Snapshotter interface
+func (f *Filterer) Snapshot(ctx context.Context) (image.Image, error) {
+	return f.os[0].d.snapshot(ctx)
 }
 
 // Start starts the filterer
 func (f *Filterer) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
 	f.BaseNode.Start(ctx, t, func(t *astikit.Task) {
 		// Make sure to wait for all dispatcher subprocesses to be done so that they are properly closed
-		defer f.d.wait()
+		defer func() {
+			for _, o := range f.os {
+				o.d.wait()
+			}
+		}()
 
 		// Make sure to stop the queue properly
 		defer f.c.Stop()
@@ -250,57 +304,137 @@ func (f *Filterer) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
 
 // HandleFrame implements the FrameHandler interface
 func (f *Filterer) HandleFrame(p *FrameHandlerPayload) {
-	f.c.Add(func() {
-		// Handle pause
-		defer f.HandlePause()
+	f.c.Add(func() { f.handleFrame(p) })
+}
 
-		// Increment incoming rate
-		f.statIncomingRate.Add(1)
+// handleFrame is executed in the filterer chan
+func (f *Filterer) handleFrame(p *FrameHandlerPayload) {
+	// Handle pause
+	defer f.HandlePause()
 
-		// Retrieve buffer ctx
-		bufferSrcCtx, ok := f.bufferSrcCtxs[p.Node]
-		if !ok {
+	// Increment incoming rate
+	f.statIncomingRate.Add(1)
+
+	// Retrieve buffer ctx
+	bufferSrcCtx, ok := f.bufferSrcCtxs[p.Node]
+	if !ok {
+		return
+	}
+
+	// Check switcher
+	if f.s != nil {
+		if ko := f.s.ShouldIn(p.Node); ko {
 			return
 		}
+	}
 
-		// Check switcher
-		if f.s != nil {
-			if ko := f.s.ShouldIn(p.Node); ko {
-				return
-			}
+	// Inputs may have different time bases, in which case the graph expects frames in the time base their
+	// input has been created with
+	f.rescaleFrame(p)
+
+	// Keep track of metadata and side data
+	// Outputs may have a different time base than the input, in which case entries are indexed by the pts the
+	// filtered frames will have
+	es := frameSideDataEntries(p.Frame)
+	for _, o := range f.os {
+		pts := o.pts(p.Frame.Pts(), f.inputTimeBases[p.Node])
+		o.mt.add(pts, p.Metadata)
+		o.sdt.add(pts, es)
+	}
+
+	// Keep track of descriptor so that frames can be drained on end of stream
+	f.previous = p.Descriptor
+
+	// Push frame in graph
+	f.statWorkRatio.Begin()
+	if ret := f.g.AvBuffersrcAddFrameFlags(bufferSrcCtx, p.Frame, avfilter.AV_BUFFERSRC_FLAG_KEEP_REF); ret < 0 {
+		f.statWorkRatio.End()
+		emitAvError(f, f.eh, ret, "f.g.AvBuffersrcAddFrameFlags failed")
+		return
+	}
+	f.statWorkRatio.End()
+
+	// Increment switcher
+	if f.s != nil {
+		f.s.IncIn(p.Node)
+	}
+
+	// Pull filtered frames
+	f.pullFilteredFrames(p.Descriptor)
+}
+
+func (f *Filterer) rescaleFrame(p *FrameHandlerPayload) {
+	// Nothing to rescale
+	tb := f.inputTimeBases[p.Node]
+	if p.Descriptor == nil || tb.Num() <= 0 || p.Frame.Pts() == avutil.AV_NOPTS_VALUE {
+		return
+	}
+	ptb := p.Descriptor.TimeBase()
+	if ptb.Num() <= 0 || (ptb.Num() == tb.Num() && ptb.Den() == tb.Den()) {
+		return
+	}
+
+	// Rescale
+	p.Frame.SetPts(avutil.AvRescaleQ(p.Frame.Pts(), ptb, tb))
+}
+
+// HandleEOS implements the EOSHandler interface
+func (f *Filterer) HandleEOS(p *EOSHandlerPayload) {
+	f.c.Add(func() {
+		// Retrieve buffer ctx
+		bufferSrcCtx, ok := f.bufferSrcCtxs[p.Node]
+		if !ok || f.eos[p.Node] {
+			return
 		}
+		f.eos[p.Node] = true
 
-		// Push frame in graph
+		// Close input
 		f.statWorkRatio.Begin()
-		if ret := f.g.AvBuffersrcAddFrameFlags(bufferSrcCtx, p.Frame, avfilter.AV_BUFFERSRC_FLAG_KEEP_REF); ret < 0 {
+		if ret := f.g.AvBuffersrcAddFrameFlags(bufferSrcCtx, nil, 0); ret < 0 {
 			f.statWorkRatio.End()
 			emitAvError(f, f.eh, ret, "f.g.AvBuffersrcAddFrameFlags failed")
 			return
 		}
 		f.statWorkRatio.End()
 
-		// Increment switcher
-		if f.s != nil {
-			f.s.IncIn(p.Node)
+		// Drain frames
+		if f.previous != nil {
+			f.pullFilteredFrames(f.previous)
+		}
+
+		// Forward end of stream once all inputs have ended
+		if len(f.eos) < len(f.bufferSrcCtxs) {
+			return
+		}
+		for _, o := range f.os {
+			o.d.dispatchEOS()
 		}
+	})
+}
 
+func (f *Filterer) pullFilteredFrames(descriptor Descriptor) {
+	// Loop through outputs
+	for _, o := range f.os {
 		// Loop
 		for {
 			// Pull filtered frame
-			if stop := f.pullFilteredFrame(p.Descriptor); stop {
-				return
+			if stop := f.pullFilteredFrame(o, descriptor); stop {
+				break
 			}
 		}
-	})
+	}
 }
 
-func (f *Filterer) pullFilteredFrame(descriptor Descriptor) (stop bool) {
+func (f *Filterer) pullFilteredFrame(o *FiltererOutput, descriptor Descriptor) (stop bool) {
 	// Get frame
-	fm := f.d.p.get()
-	defer f.d.p.put(fm)
+	fm := o.d.p.get()
+	defer o.d.p.put(fm)
+
+	// Restamper and switcher only apply to the first output
+	first := o == f.os[0]
 
 	// Check switcher
-	if f.s != nil {
+	if first && f.s != nil {
 		if stop = f.s.ShouldOut(); stop {
 			return
 		}
@@ -308,7 +442,7 @@ func (f *Filterer) pullFilteredFrame(descriptor Descriptor) (stop bool) {
 
 	// Pull filtered frame from graph
 	f.statWorkRatio.Begin()
-	if ret := f.g.AvBuffersinkGetFrame(f.bufferSinkCtx, fm); ret < 0 {
+	if ret := f.g.AvBuffersinkGetFrame(o.bufferSinkCtx, fm); ret < 0 {
 		f.statWorkRatio.End()
 		if ret != avutil.AVERROR_EOF && ret != avutil.AVERROR_EAGAIN {
 			emitAvError(f, f.eh, ret, "f.g.AvBuffersinkGetFrame failed")
@@ -318,30 +452,33 @@ func (f *Filterer) pullFilteredFrame(descriptor Descriptor) (stop bool) {
 	}
 	f.statWorkRatio.End()
 
+	// Get metadata
+	m := o.mt.get(fm.Pts())
+
+	// Restore side data lost in the graph
+	es := o.sdt.get(fm.Pts())
+	if len(f.dropSideData) > 0 {
+		frameRemoveSideData(fm, f.dropSideData)
+		es = sideDataEntriesWithoutTypes(es, f.dropSideData)
+	}
+	if err := frameRestoreSideData(fm, es); err != nil {
+		f.eh.Emit(astiencoder.EventError(f, fmt.Errorf("astilibav: restoring side data failed: %w", err)))
+	}
+
 	// Restamp
-	if f.restamper != nil {
+	if first && f.restamper != nil {
 		f.statWorkRatio.Begin()
 		f.restamper.Restamp(fm)
 		f.statWorkRatio.End()
 	}
 
 	// Increment switcher
-	if f.s != nil {
+	if first && f.s != nil {
 		f.s.IncOut()
 	}
 
 	// Dispatch frame
-	f.d.dispatch(fm, newFiltererDescriptor(f.bufferSinkCtx, descriptor))
-	return
-}
-
-// SendCommand sends a command to the filterer
-func (f *Filterer) SendCommand(target, cmd, arg string, flags int) (err error) {
-	var res string
-	if ret := f.g.AvfilterGraphSendCommand(target, cmd, arg, res, 255, flags); ret < 0 {
-		err = fmt.Errorf("astilibav: f.g.AvfilterGraphSendCommand for target %s, cmd %s, arg %s and flag %d failed with res %s: %w", target, cmd, arg, flags, res, NewAvError(ret))
-		return
-	}
+	o.d.dispatch(fm, newFiltererDescriptor(o.bufferSinkCtx, descriptor), m)
 	return
 }
 
@@ -431,11 +568,16 @@ func (f *Filterer) Switch(opt FiltererSwitchOptions) (nf *Filterer, err error) {
 }
 
 type filtererDescriptor struct {
-	timeBase avutil.Rational
+	bufferSinkCtx *avfilter.Context
+	prev          Descriptor
+	timeBase      avutil.Rational
 }
 
 func newFiltererDescriptor(bufferSinkCtx *avfilter.Context, prev Descriptor) (d *filtererDescriptor) {
-	d = &filtererDescriptor{}
+	d = &filtererDescriptor{
+		bufferSinkCtx: bufferSinkCtx,
+		prev:          prev,
+	}
 	if is := bufferSinkCtx.Inputs(); len(is) > 0 {
 		d.timeBase = is[0].TimeBase()
 	} else {
@@ -448,3 +590,8 @@ func newFiltererDescriptor(bufferSinkCtx *avfilter.Context, prev Descriptor) (d
 func (d *filtererDescriptor) TimeBase() avutil.Rational {
 	return d.timeBase
 }
+
+// StreamDescriptor implements the StreamDescriber interface
+func (d *filtererDescriptor) StreamDescriptor() StreamDescriptor {
+	return newBufferSinkStreamDescriptor(d.bufferSinkCtx, d.prev)
+}
@@ -0,0 +1,63 @@
+package astilibav
+
+//#cgo pkg-config: libavfilter
+//#include <stdlib.h>
+//#include <libavfilter/avfilter.h>
+import "C"
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"github.com/asticode/goav/avfilter"
+)
+
+// Size of the buffer in which filters write their response
+const filtererCommandResponseSize = 256
+
+// SendCommand sends a command to the filters matching the target, which can be a filter instance name, a filter name
+// or "all". It allows updating filters such as "drawtext", "volume" or "overlay" without rebuilding the graph
+// It's executed between 2 frames and blocks until then
+func (f *Filterer) SendCommand(target, cmd, arg string, flags int) (err error) {
+	_, err = f.SendCommandWithResponse(target, cmd, arg, flags)
+	return
+}
+
+// SendCommandWithResponse is the same as SendCommand but also returns the response of the filters
+func (f *Filterer) SendCommandWithResponse(target, cmd, arg string, flags int) (res string, err error) {
+	// Commands must not be sent while frames are being filtered
+	var done bool
+	f.c.Add(func() {
+		done = true
+		res, err = sendFilterCommand(f.g, target, cmd, arg, flags)
+	})
+
+	// Filterer has been stopped
+	if !done {
+		err = errors.New("astilibav: filterer is stopped")
+	}
+	return
+}
+
+func sendFilterCommand(g *avfilter.Graph, target, cmd, arg string, flags int) (res string, err error) {
+	// Create strings
+	ct := C.CString(target)
+	defer C.free(unsafe.Pointer(ct))
+	cc := C.CString(cmd)
+	defer C.free(unsafe.Pointer(cc))
+	ca := C.CString(arg)
+	defer C.free(unsafe.Pointer(ca))
+
+	// Create response buffer
+	cr := (*C.char)(C.calloc(filtererCommandResponseSize, 1))
+	defer C.free(unsafe.Pointer(cr))
+
+	// Send command
+	ret := C.avfilter_graph_send_command((*C.AVFilterGraph)(unsafe.Pointer(g)), ct, cc, ca, cr, filtererCommandResponseSize, C.int(flags))
+	res = C.GoString(cr)
+	if ret < 0 {
+		err = fmt.Errorf("astilibav: avfilter_graph_send_command for target %s, cmd %s, arg %s and flags %d failed with res %s: %w", target, cmd, arg, flags, res, NewAvError(int(ret)))
+		return
+	}
+	return
+}
@@ -0,0 +1,86 @@
+package astilibav
+
+import (
+	"context"
+	"image"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/goav/avfilter"
+	"github.com/asticode/goav/avutil"
+)
+
+// FiltererOutput represents an output pad of a filterer that frames are dispatched from
+// Since it's not a node, connected handlers are children of the filterer
+type FiltererOutput struct {
+	bufferSinkCtx *avfilter.Context
+	d             *frameDispatcher
+	f             *Filterer
+	mt            *unitMetadataTracker
+	name          string
+	sdt           *sideDataTracker
+}
+
+func newFiltererOutput(f *Filterer, name string) *FiltererOutput {
+	return &FiltererOutput{
+		d:    newFrameDispatcher(f, f.eh, f.ccl),
+		f:    f,
+		mt:   newUnitMetadataTracker(),
+		name: name,
+		sdt:  newSideDataTracker(),
+	}
+}
+
+// pts returns the pts, in the input time base, rescaled to the time base of the frames pulled from the buffer sink,
+// which is the pts metadata and side data are looked up with
+func (o *FiltererOutput) pts(pts int64, tb avutil.Rational) int64 {
+	// Nothing to rescale
+	is := o.bufferSinkCtx.Inputs()
+	if pts == avutil.AV_NOPTS_VALUE || tb.Num() <= 0 || len(is) == 0 {
+		return pts
+	}
+	otb := is[0].TimeBase()
+	if otb.Num() <= 0 || (otb.Num() == tb.Num() && otb.Den() == tb.Den()) {
+		return pts
+	}
+
+	// Rescale
+	return avutil.AvRescaleQ(pts, tb, otb)
+}
+
+// Output returns the output with the provided name, or nil if it doesn't exist
+func (f *Filterer) Output(name string) *FiltererOutput {
+	for _, o := range f.os {
+		if o.name == name {
+			return o
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the output pad
+func (o *FiltererOutput) Name() string {
+	return o.name
+}
+
+// Connect implements the FrameHandlerConnector interface
+func (o *FiltererOutput) Connect(h FrameHandler) {
+	// Add handler
+	o.d.addHandler(h)
+
+	// Connect nodes
+	astiencoder.ConnectNodes(o.f, h)
+}
+
+// Disconnect implements the FrameHandlerConnector interface
+func (o *FiltererOutput) Disconnect(h FrameHandler) {
+	// Delete handler
+	o.d.delHandler(h)
+
+	// Disconnect nodes
+	astiencoder.DisconnectNodes(o.f, h)
+}
+
+// Snapshot captures the next frame dispatched by the output pad as an image
+func (o *FiltererOutput) Snapshot(ctx context.Context) (image.Image, error) {
+	return o.d.snapshot(ctx)
+}
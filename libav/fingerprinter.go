@@ -0,0 +1,222 @@
+//go:build chromaprint
+// +build chromaprint
+
+package astilibav
+
+//#cgo pkg-config: libchromaprint
+//#include <stdlib.h>
+//#include <chromaprint.h>
+import "C"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+)
+
+var countFingerprinter uint64
+
+// Default fingerprinter values
+const defaultFingerprinterWindowDuration = 10 * time.Second
+
+// Fingerprinter represents an object capable of computing Chromaprint fingerprints over windows of audio frames
+// Only the packed s16 sample format is supported, which means an aformat filter may be needed upstream
+// It requires the "chromaprint" build tag as well as libchromaprint
+type Fingerprinter struct {
+	*astiencoder.BaseNode
+	c                *astikit.Chan
+	ctxChromaprint   *C.ChromaprintContext
+	eh               *astiencoder.EventHandler
+	o                FingerprinterOptions
+	statIncomingRate *astikit.CounterAvgStat
+	statWorkRatio    *astikit.DurationPercentageStat
+	w                *Fingerprint
+}
+
+// FingerprinterOptions represents fingerprinter options
+type FingerprinterOptions struct {
+	// Context of the incoming frames. Only Channels and SampleRate are used
+	Context Context
+	Node    astiencoder.NodeOptions
+	// Duration of each fingerprinted window. Defaults to 10s
+	WindowDuration time.Duration
+}
+
+// Fingerprint represents a fingerprint computed over a window
+type Fingerprint struct {
+	End   time.Duration
+	Start time.Duration
+	// Compressed and base64 encoded fingerprint, as expected by AcoustID
+	Value string
+}
+
+// NewFingerprinter creates a new fingerprinter
+func NewFingerprinter(o FingerprinterOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (f *Fingerprinter, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countFingerprinter, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("fingerprinter_%d", count), fmt.Sprintf("Fingerprinter #%d", count), "Fingerprints")
+
+	// Default values
+	if o.WindowDuration <= 0 {
+		o.WindowDuration = defaultFingerprinterWindowDuration
+	}
+
+	// Create fingerprinter
+	f = &Fingerprinter{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh:               eh,
+		o:                o,
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statWorkRatio:    astikit.NewDurationPercentageStat(),
+	}
+	f.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(f), eh)
+	f.addStats()
+
+	// No channels or sample rate
+	if o.Context.Channels <= 0 || o.Context.SampleRate <= 0 {
+		err = errors.New("astilibav: no channels or sample rate provided")
+		return
+	}
+
+	// Create chromaprint context
+	if f.ctxChromaprint = C.chromaprint_new(C.CHROMAPRINT_ALGORITHM_DEFAULT); f.ctxChromaprint == nil {
+		err = errors.New("astilibav: chromaprint_new failed")
+		return
+	}
+
+	// Make sure the chromaprint context is properly freed
+	c.Add(func() error {
+		C.chromaprint_free(f.ctxChromaprint)
+		return nil
+	})
+	return
+}
+
+func (f *Fingerprinter) addStats() {
+	// Add incoming rate
+	f.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of frames coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "fps",
+	}, f.statIncomingRate)
+
+	// Add work ratio
+	f.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, f.statWorkRatio)
+
+	// Add chan stats
+	f.c.AddStats(f.Stater())
+}
+
+// Start starts the fingerprinter
+func (f *Fingerprinter) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	f.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to fingerprint the remaining window
+		defer func() {
+			if err := f.finish(); err != nil {
+				f.eh.Emit(astiencoder.EventError(f, fmt.Errorf("astilibav: finishing window failed: %w", err)))
+			}
+		}()
+
+		// Make sure to stop the chan properly
+		defer f.c.Stop()
+
+		// Start chan
+		f.c.Start(f.Context())
+	})
+}
+
+// HandleFrame implements the FrameHandler interface
+func (f *Fingerprinter) HandleFrame(p *FrameHandlerPayload) {
+	f.c.Add(func() {
+		// Handle pause
+		defer f.HandlePause()
+
+		// Increment incoming rate
+		f.statIncomingRate.Add(1)
+
+		// Check sample format
+		if p.Frame.Format() != avutil.AV_SAMPLE_FMT_S16 {
+			f.eh.Emit(astiencoder.EventError(f, fmt.Errorf("astilibav: sample format %d is not supported", p.Frame.Format())))
+			return
+		}
+
+		// Get timestamps
+		start := time.Duration(avutil.AvRescaleQ(p.Frame.Pts(), p.Descriptor.TimeBase(), nanosecondRational))
+		d := time.Duration(float64(p.Frame.NbSamples()) / float64(f.o.Context.SampleRate) * 1e9)
+
+		// Start window
+		f.statWorkRatio.Begin()
+		defer f.statWorkRatio.End()
+		if f.w == nil {
+			if ret := C.chromaprint_start(f.ctxChromaprint, C.int(f.o.Context.SampleRate), C.int(f.o.Context.Channels)); ret != 1 {
+				f.eh.Emit(astiencoder.EventError(f, errors.New("astilibav: chromaprint_start failed")))
+				return
+			}
+			f.w = &Fingerprint{Start: start}
+		}
+
+		// Feed
+		if n := p.Frame.NbSamples() * f.o.Context.Channels; n > 0 && p.Frame.Data() != nil {
+			if ret := C.chromaprint_feed(f.ctxChromaprint, (*C.int16_t)(unsafe.Pointer(p.Frame.Data())), C.int(n)); ret != 1 {
+				f.eh.Emit(astiencoder.EventError(f, errors.New("astilibav: chromaprint_feed failed")))
+				return
+			}
+		}
+		f.w.End = start + d
+
+		// Window is complete
+		if f.w.End-f.w.Start >= f.o.WindowDuration {
+			if err := f.finish(); err != nil {
+				f.eh.Emit(astiencoder.EventError(f, fmt.Errorf("astilibav: finishing window failed: %w", err)))
+				return
+			}
+		}
+	})
+}
+
+func (f *Fingerprinter) finish() (err error) {
+	// No window
+	if f.w == nil {
+		return
+	}
+
+	// Reset window
+	w := *f.w
+	f.w = nil
+
+	// Finish
+	if ret := C.chromaprint_finish(f.ctxChromaprint); ret != 1 {
+		err = errors.New("astilibav: chromaprint_finish failed")
+		return
+	}
+
+	// Get fingerprint
+	var fp *C.char
+	if ret := C.chromaprint_get_fingerprint(f.ctxChromaprint, &fp); ret != 1 {
+		err = errors.New("astilibav: chromaprint_get_fingerprint failed")
+		return
+	}
+	defer C.chromaprint_dealloc(unsafe.Pointer(fp))
+	w.Value = C.GoString(fp)
+
+	// Send event
+	f.eh.Emit(astiencoder.Event{
+		Name:    EventNameFingerprinterFingerprint,
+		Payload: w,
+		Target:  f,
+	})
+	return
+}
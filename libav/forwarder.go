@@ -3,6 +3,7 @@ package astilibav
 import (
 	"context"
 	"fmt"
+	"image"
 	"sync/atomic"
 
 	"github.com/asticode/go-astiencoder"
@@ -89,6 +90,11 @@ func (f *Forwarder) Disconnect(h FrameHandler) {
 	astiencoder.DisconnectNodes(f, h)
 }
 
+// Snapshot implements the astiencoder.Snapshotter interface
+func (f *Forwarder) Snapshot(ctx context.Context) (image.Image, error) {
+	return f.d.snapshot(ctx)
+}
+
 // Start starts the forwarder
 func (f *Forwarder) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
 	f.BaseNode.Start(ctx, t, func(t *astikit.Task) {
@@ -120,6 +126,6 @@ func (f *Forwarder) HandleFrame(p *FrameHandlerPayload) {
 		}
 
 		// Dispatch frame
-		f.d.dispatch(p.Frame, p.Descriptor)
+		f.d.dispatch(p.Frame, p.Descriptor, p.Metadata)
 	})
 }
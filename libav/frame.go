@@ -24,22 +24,27 @@ type FrameHandlerConnector interface {
 type FrameHandlerPayload struct {
 	Descriptor Descriptor
 	Frame      *avutil.Frame
-	Node       astiencoder.Node
+	// May be nil if the frame has not been created by a node attaching metadata
+	Metadata *UnitMetadata
+	Node     astiencoder.Node
 }
 
 type frameDispatcher struct {
+	bp           *backpressureTracker
 	c            *astikit.Closer
 	eh           *astiencoder.EventHandler
 	hs           map[string]FrameHandler
 	m            *sync.Mutex
 	n            astiencoder.Node
 	p            *framePool
+	snapshots    []chan frameSnapshot
 	statDispatch *astikit.DurationPercentageStat
 	wg           *sync.WaitGroup
 }
 
 func newFrameDispatcher(n astiencoder.Node, eh *astiencoder.EventHandler, c *astikit.Closer) *frameDispatcher {
 	return &frameDispatcher{
+		bp:           newBackpressureTracker(n, eh),
 		c:            c,
 		eh:           eh,
 		hs:           make(map[string]FrameHandler),
@@ -63,15 +68,23 @@ func (d *frameDispatcher) delHandler(h FrameHandler) {
 	delete(d.hs, h.Metadata().Name)
 }
 
-func (d *frameDispatcher) dispatch(f *avutil.Frame, descriptor Descriptor) {
+func (d *frameDispatcher) dispatch(f *avutil.Frame, descriptor Descriptor, m *UnitMetadata) {
 	// Copy handlers
 	d.m.Lock()
 	var hs []FrameHandler
 	for _, h := range d.hs {
 		hs = append(hs, h)
 	}
+	ss := d.snapshots
+	d.snapshots = nil
 	d.m.Unlock()
 
+	// Snapshot
+	// Frames are only referenced, images are created by the callers
+	if len(ss) > 0 {
+		d.sendSnapshots(f, ss)
+	}
+
 	// No handlers
 	if len(hs) == 0 {
 		return
@@ -91,19 +104,29 @@ func (d *frameDispatcher) dispatch(f *avutil.Frame, descriptor Descriptor) {
 	for _, h := range hs {
 		// Copy frame
 		hF := d.p.get()
-		if ret := avutil.AvFrameRef(hF, f); ret < 0 {
+		if ret := defaultBindings.frameRef(hF, f); ret < 0 {
 			emitAvError(d, d.eh, ret, "avutil.AvFrameRef failed")
 			d.wg.Done()
 			continue
 		}
 
+		// Keep track of pending handlers
+		d.bp.add(h)
+
 		// Handle frame
 		go func(h FrameHandler) {
 			defer d.wg.Done()
+			defer d.bp.done(h)
 			defer d.p.put(hF)
+
+			// Handle rate limit
+			if v, ok := h.(astiencoder.RateLimitHandler); ok {
+				v.HandleRateLimit()
+			}
 			h.HandleFrame(&FrameHandlerPayload{
 				Descriptor: descriptor,
 				Frame:      hF,
+				Metadata:   m,
 				Node:       d.n,
 			})
 		}(h)
@@ -111,7 +134,7 @@ func (d *frameDispatcher) dispatch(f *avutil.Frame, descriptor Descriptor) {
 }
 
 func (d *frameDispatcher) wait() {
-	d.wg.Wait()
+	d.bp.wait(d.wg)
 }
 
 func (d *frameDispatcher) addStats(s *astikit.Stater) {
@@ -140,9 +163,9 @@ func (p *framePool) get() (f *avutil.Frame) {
 	p.m.Lock()
 	defer p.m.Unlock()
 	if len(p.p) == 0 {
-		f = avutil.AvFrameAlloc()
+		f = defaultBindings.frameAlloc()
 		p.c.Add(func() error {
-			avutil.AvFrameFree(f)
+			defaultBindings.frameFree(f)
 			return nil
 		})
 		return
@@ -155,6 +178,6 @@ func (p *framePool) get() (f *avutil.Frame) {
 func (p *framePool) put(f *avutil.Frame) {
 	p.m.Lock()
 	defer p.m.Unlock()
-	avutil.AvFrameUnref(f)
+	defaultBindings.frameUnref(f)
 	p.p = append(p.p, f)
 }
@@ -0,0 +1,82 @@
+package astilibav
+
+//#cgo pkg-config: libavcodec libavfilter libavformat libavutil
+//#include <stdlib.h>
+//#include <libavutil/dict.h>
+//#include <libavutil/imgutils.h>
+//#include <libavutil/samplefmt.h>
+//#include "compat.h"
+import "C"
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/asticode/goav/avutil"
+)
+
+// frameData returns the frame data as a contiguous buffer
+// Video planes are copied without padding and audio planes are concatenated
+func frameData(f *avutil.Frame) (b []byte, err error) {
+	c := (*C.struct_AVFrame)(unsafe.Pointer(f))
+
+	// Video
+	if c.width > 0 && c.height > 0 {
+		// Get size
+		n := C.av_image_get_buffer_size(C.enum_AVPixelFormat(c.format), c.width, c.height, 1)
+		if n < 0 {
+			err = fmt.Errorf("astilibav: av_image_get_buffer_size failed: %w", NewAvError(int(n)))
+			return
+		}
+
+		// Copy data
+		b = make([]byte, int(n))
+		if n == 0 {
+			return
+		}
+		if ret := C.av_image_copy_to_buffer((*C.uint8_t)(unsafe.Pointer(&b[0])), n, (**C.uint8_t)(unsafe.Pointer(&c.data[0])), &c.linesize[0], C.enum_AVPixelFormat(c.format), c.width, c.height, 1); ret < 0 {
+			err = fmt.Errorf("astilibav: av_image_copy_to_buffer failed: %w", NewAvError(int(ret)))
+			return
+		}
+		return
+	}
+
+	// Audio
+	planes, size := 1, int(C.av_get_bytes_per_sample(C.enum_AVSampleFormat(c.format)))*int(c.nb_samples)
+	if C.av_sample_fmt_is_planar(C.enum_AVSampleFormat(c.format)) == 1 {
+		planes = int(C.astilibav_frame_channels(c))
+	} else {
+		size *= int(C.astilibav_frame_channels(c))
+	}
+	if size <= 0 || c.extended_data == nil {
+		return
+	}
+
+	// Loop through planes
+	ds := (*[1 << 10]*C.uint8_t)(unsafe.Pointer(c.extended_data))[:planes:planes]
+	for _, d := range ds {
+		b = append(b, C.GoBytes(unsafe.Pointer(d), C.int(size))...)
+	}
+	return
+}
+
+// frameDuration returns the frame duration in the stream time base
+func frameDuration(f *avutil.Frame) int64 {
+	return int64(C.astilibav_frame_duration((*C.struct_AVFrame)(unsafe.Pointer(f))))
+}
+
+// framePictType returns the frame picture type
+func framePictType(f *avutil.Frame) avutil.AvPictureType {
+	return avutil.AvPictureType((*C.struct_AVFrame)(unsafe.Pointer(f)).pict_type)
+}
+
+// frameSetMetadata sets an entry of the frame metadata, which filters such as drawtext can read
+func frameSetMetadata(f *avutil.Frame, k, v string) error {
+	ck := C.CString(k)
+	defer C.free(unsafe.Pointer(ck))
+	cv := C.CString(v)
+	defer C.free(unsafe.Pointer(cv))
+	if ret := C.av_dict_set(&(*C.struct_AVFrame)(unsafe.Pointer(f)).metadata, ck, cv, 0); ret < 0 {
+		return fmt.Errorf("astilibav: av_dict_set on key %s failed: %w", k, NewAvError(int(ret)))
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package astilibav
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+)
+
+var countFrameDumper uint64
+
+// Frame dumper formats
+const (
+	FrameDumperFormatJPEG = "jpeg"
+	FrameDumperFormatPNG  = "png"
+)
+
+// FrameDumper represents an object capable of dumping video frames as images, for instance to generate thumbnails
+// alongside transcoding
+// Images are either written to the path the pattern results in, or handed to the handler, or both
+type FrameDumper struct {
+	*astiencoder.BaseNode
+	c                *astikit.Chan
+	count            int
+	eh               *astiencoder.EventHandler
+	next             *time.Duration
+	o                FrameDumperOptions
+	statDumpRate     *astikit.CounterAvgStat
+	statIncomingRate *astikit.CounterAvgStat
+	statWorkRatio    *astikit.DurationPercentageStat
+	t                *template.Template
+}
+
+// FrameDumperOptions represents frame dumper options
+// When neither Interval nor KeyFrames is set, all frames are dumped
+type FrameDumperOptions struct {
+	// Custom data available in the pattern
+	Data map[string]interface{}
+	// Possible values are "jpeg" and "png". Defaults to "jpeg"
+	Format string
+	// The image belongs to the handler
+	Handler func(b []byte, args FrameDumperHandlerArgs) error
+	// If > 0, the first frame of each interval is dumped, intervals being computed on the frames' pts. Frames without
+	// pts are ignored
+	Interval time.Duration
+	// If true, I frames are dumped
+	KeyFrames bool
+	Node      astiencoder.NodeOptions
+	// Path template executed with FrameDumperData, such as "/tmp/thumbnail-{{ .Count }}.jpg"
+	Pattern string
+	// JPEG quality between 1 and 100. Defaults to 75
+	Quality int
+	// If > 0, images are scaled to this width and the aspect ratio is preserved
+	Width int
+}
+
+// FrameDumperData represents the data the pattern of a frame dumper is executed with
+type FrameDumperData struct {
+	// Number of frames dumped so far, starting at 1
+	Count int
+	Data  map[string]interface{}
+	Pts   int64
+	// Pts converted to a duration
+	Time time.Duration
+}
+
+// FrameDumperHandlerArgs represents frame dumper handler args
+type FrameDumperHandlerArgs struct {
+	FrameDumperData
+	// Path the image has been written to, if any
+	Path string
+}
+
+// NewFrameDumper creates a new frame dumper
+func NewFrameDumper(o FrameDumperOptions, eh *astiencoder.EventHandler) (d *FrameDumper, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countFrameDumper, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("frame_dumper_%d", count), fmt.Sprintf("Frame Dumper #%d", count), "Dumps frames")
+
+	// Check format
+	switch o.Format {
+	case "":
+		o.Format = FrameDumperFormatJPEG
+	case FrameDumperFormatJPEG, FrameDumperFormatPNG:
+	default:
+		err = fmt.Errorf("astilibav: invalid format %s", o.Format)
+		return
+	}
+
+	// Default values
+	if o.Quality <= 0 {
+		o.Quality = jpeg.DefaultQuality
+	}
+
+	// Create frame dumper
+	d = &FrameDumper{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh:               eh,
+		o:                o,
+		statDumpRate:     astikit.NewCounterAvgStat(),
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statWorkRatio:    astikit.NewDurationPercentageStat(),
+	}
+	d.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(d), eh)
+	d.addStats()
+
+	// No output
+	if o.Pattern == "" && o.Handler == nil {
+		err = errors.New("astilibav: neither pattern nor handler provided")
+		return
+	}
+
+	// Parse pattern
+	if o.Pattern != "" {
+		if d.t, err = template.New("").Parse(o.Pattern); err != nil {
+			err = fmt.Errorf("astilibav: parsing pattern %s as template failed: %w", o.Pattern, err)
+			return
+		}
+	}
+	return
+}
+
+func (d *FrameDumper) addStats() {
+	// Add incoming rate
+	d.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of frames coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "fps",
+	}, d.statIncomingRate)
+
+	// Add dump rate
+	d.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of frames dumped per second",
+		Label:       "Dump rate",
+		Unit:        "fps",
+	}, d.statDumpRate)
+
+	// Add work ratio
+	d.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, d.statWorkRatio)
+
+	// Add chan stats
+	d.c.AddStats(d.Stater())
+}
+
+// Start starts the frame dumper
+func (d *FrameDumper) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	d.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to stop the chan properly
+		defer d.c.Stop()
+
+		// Start chan
+		d.c.Start(d.Context())
+	})
+}
+
+// HandleFrame implements the FrameHandler interface
+func (d *FrameDumper) HandleFrame(p *FrameHandlerPayload) {
+	d.c.Add(func() {
+		// Handle pause
+		defer d.HandlePause()
+
+		// Increment incoming rate
+		d.statIncomingRate.Add(1)
+
+		// Get time
+		var t *time.Duration
+		if pts := p.Frame.Pts(); pts != avutil.AV_NOPTS_VALUE && p.Descriptor != nil {
+			v := time.Duration(avutil.AvRescaleQ(pts, p.Descriptor.TimeBase(), nanosecondRational))
+			t = &v
+		}
+
+		// Check whether the frame should be dumped
+		var dump bool
+		kf := framePictType(p.Frame) == avutil.AvPictureType(avutil.AV_PICTURE_TYPE_I)
+		if dump, d.next = frameDumperShouldDump(t, d.next, d.o.Interval, d.o.KeyFrames, kf); !dump {
+			return
+		}
+
+		// Dump
+		d.statWorkRatio.Begin()
+		err := d.dump(p, t)
+		d.statWorkRatio.End()
+		if err != nil {
+			d.eh.Emit(astiencoder.EventError(d, fmt.Errorf("astilibav: dumping frame failed: %w", err)))
+			return
+		}
+		d.statDumpRate.Add(1)
+	})
+}
+
+// frameDumperShouldDump returns whether the frame must be dumped and the start of the next interval
+func frameDumperShouldDump(t, next *time.Duration, interval time.Duration, keyFrames, keyFrame bool) (dump bool, n *time.Duration) {
+	// Dump all frames
+	n = next
+	if interval <= 0 && !keyFrames {
+		dump = true
+		return
+	}
+
+	// Interval
+	if interval > 0 && t != nil && (next == nil || *t >= *next) {
+		v := (*t/interval + 1) * interval
+		dump, n = true, &v
+		return
+	}
+
+	// Key frame
+	dump = keyFrames && keyFrame
+	return
+}
+
+func (d *FrameDumper) dump(p *FrameHandlerPayload, t *time.Duration) (err error) {
+	// Get image
+	var i *image.RGBA
+	if i, err = thumbnailImage(p.Frame, d.o.Width); err != nil {
+		err = fmt.Errorf("astilibav: getting image failed: %w", err)
+		return
+	}
+
+	// Encode
+	buf := &bytes.Buffer{}
+	switch d.o.Format {
+	case FrameDumperFormatPNG:
+		if err = png.Encode(buf, i); err != nil {
+			err = fmt.Errorf("astilibav: png.Encode failed: %w", err)
+			return
+		}
+	default:
+		if err = jpeg.Encode(buf, i, &jpeg.Options{Quality: d.o.Quality}); err != nil {
+			err = fmt.Errorf("astilibav: jpeg.Encode failed: %w", err)
+			return
+		}
+	}
+
+	// Create args
+	d.count++
+	args := FrameDumperHandlerArgs{FrameDumperData: FrameDumperData{
+		Count: d.count,
+		Data:  d.o.Data,
+		Pts:   p.Frame.Pts(),
+	}}
+	if t != nil {
+		args.Time = *t
+	}
+
+	// Write to file
+	if d.t != nil {
+		// Execute template
+		pb := &bytes.Buffer{}
+		if err = d.t.Execute(pb, args.FrameDumperData); err != nil {
+			err = fmt.Errorf("astilibav: executing template %s failed: %w", d.o.Pattern, err)
+			return
+		}
+		args.Path = pb.String()
+
+		// Write
+		if err = ioutil.WriteFile(args.Path, buf.Bytes(), 0644); err != nil {
+			err = fmt.Errorf("astilibav: writing to file %s failed: %w", args.Path, err)
+			return
+		}
+	}
+
+	// Execute handler
+	if d.o.Handler != nil {
+		if err = d.o.Handler(buf.Bytes(), args); err != nil {
+			err = fmt.Errorf("astilibav: handler failed: %w", err)
+			return
+		}
+	}
+	return
+}
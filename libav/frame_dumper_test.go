@@ -0,0 +1,37 @@
+package astilibav
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrameDumperShouldDump(t *testing.T) {
+	d := func(v time.Duration) *time.Duration { return &v }
+
+	// All frames
+	dump, n := frameDumperShouldDump(nil, nil, 0, false, false)
+	assert.True(t, dump)
+	assert.Nil(t, n)
+
+	// Interval
+	dump, n = frameDumperShouldDump(d(1500*time.Millisecond), nil, time.Second, false, false)
+	assert.True(t, dump)
+	assert.Equal(t, d(2*time.Second), n)
+	dump, n = frameDumperShouldDump(d(1900*time.Millisecond), n, time.Second, false, false)
+	assert.False(t, dump)
+	assert.Equal(t, d(2*time.Second), n)
+	dump, n = frameDumperShouldDump(nil, n, time.Second, false, false)
+	assert.False(t, dump)
+	dump, n = frameDumperShouldDump(d(4100*time.Millisecond), n, time.Second, false, false)
+	assert.True(t, dump)
+	assert.Equal(t, d(5*time.Second), n)
+
+	// Key frames
+	dump, n = frameDumperShouldDump(d(4200*time.Millisecond), n, time.Second, true, true)
+	assert.True(t, dump)
+	assert.Equal(t, d(5*time.Second), n)
+	dump, _ = frameDumperShouldDump(d(time.Second), nil, 0, true, false)
+	assert.False(t, dump)
+}
@@ -0,0 +1,467 @@
+package astilibav
+
+//#cgo pkg-config: libavutil
+//#include <libavutil/frame.h>
+//#include <libavutil/pixfmt.h>
+//#include <libavutil/samplefmt.h>
+//#include "compat.h"
+import "C"
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+)
+
+var countFrameExporter uint64
+
+// Frame exporter formats
+const (
+	FrameExporterFormatFloat32 = "float32"
+	FrameExporterFormatInt16   = "int16"
+	FrameExporterFormatRGBA    = "rgba"
+	FrameExporterFormatYCbCr   = "ycbcr"
+)
+
+// FrameYCbCr returns a copy of the video frame as an image.YCbCr
+// Only planar 8-bit YUV pixel formats are supported. Bear in mind that image.YCbCr assumes full range values, which
+// means colors of limited range frames such as yuv420p will be slightly off once converted to RGB by the image pkg
+func FrameYCbCr(f *avutil.Frame) (i *image.YCbCr, err error) {
+	// Get subsample ratio
+	c := (*C.struct_AVFrame)(unsafe.Pointer(f))
+	var r image.YCbCrSubsampleRatio
+	switch c.format {
+	case C.AV_PIX_FMT_YUV410P:
+		r = image.YCbCrSubsampleRatio410
+	case C.AV_PIX_FMT_YUV411P:
+		r = image.YCbCrSubsampleRatio411
+	case C.AV_PIX_FMT_YUV420P, C.AV_PIX_FMT_YUVJ420P:
+		r = image.YCbCrSubsampleRatio420
+	case C.AV_PIX_FMT_YUV422P, C.AV_PIX_FMT_YUVJ422P:
+		r = image.YCbCrSubsampleRatio422
+	case C.AV_PIX_FMT_YUV440P, C.AV_PIX_FMT_YUVJ440P:
+		r = image.YCbCrSubsampleRatio440
+	case C.AV_PIX_FMT_YUV444P, C.AV_PIX_FMT_YUVJ444P:
+		r = image.YCbCrSubsampleRatio444
+	default:
+		err = fmt.Errorf("astilibav: pixel format %d is not supported", c.format)
+		return
+	}
+
+	// Invalid size
+	if c.width <= 0 || c.height <= 0 {
+		err = fmt.Errorf("astilibav: invalid size %dx%d", c.width, c.height)
+		return
+	}
+
+	// Create image
+	i = image.NewYCbCr(image.Rect(0, 0, int(c.width), int(c.height)), r)
+
+	// Copy planes
+	frameExporterCopyPlane(i.Y, i.YStride, c.data[0], int(c.linesize[0]))
+	frameExporterCopyPlane(i.Cb, i.CStride, c.data[1], int(c.linesize[1]))
+	frameExporterCopyPlane(i.Cr, i.CStride, c.data[2], int(c.linesize[2]))
+	return
+}
+
+func frameExporterCopyPlane(dst []byte, stride int, src *C.uint8_t, linesize int) {
+	if stride <= 0 {
+		return
+	}
+	for y := 0; y < len(dst)/stride; y++ {
+		copy(dst[y*stride:(y+1)*stride], (*[1 << 30]byte)(unsafe.Pointer(uintptr(unsafe.Pointer(src)) + uintptr(y*linesize)))[:stride:stride])
+	}
+}
+
+// FrameRGBA returns a copy of the video frame as an image.RGBA
+func FrameRGBA(f *avutil.Frame) (*image.RGBA, error) {
+	return thumbnailImage(f, 0)
+}
+
+// FrameFloat32Samples returns a copy of the audio frame samples, interleaved and normalized between -1 and 1
+func FrameFloat32Samples(f *avutil.Frame) (s []float32, err error) {
+	// Get samples
+	var vs []float64
+	if vs, err = frameExporterSamples(f); err != nil {
+		return
+	}
+
+	// Convert
+	s = make([]float32, len(vs))
+	for idx, v := range vs {
+		s[idx] = float32(v)
+	}
+	return
+}
+
+// FrameInt16Samples returns a copy of the audio frame samples, interleaved and converted to signed 16-bit integers
+func FrameInt16Samples(f *avutil.Frame) (s []int16, err error) {
+	// Get samples
+	var vs []float64
+	if vs, err = frameExporterSamples(f); err != nil {
+		return
+	}
+
+	// Convert
+	s = make([]int16, len(vs))
+	for idx, v := range vs {
+		s[idx] = int16(math.Max(math.MinInt16, math.Min(math.MaxInt16, math.Round(v*-math.MinInt16))))
+	}
+	return
+}
+
+func frameExporterSamples(f *avutil.Frame) (s []float64, err error) {
+	// Get data
+	var b []byte
+	if b, err = frameData(f); err != nil {
+		err = fmt.Errorf("astilibav: getting frame data failed: %w", err)
+		return
+	}
+
+	// Get samples
+	c := (*C.struct_AVFrame)(unsafe.Pointer(f))
+	if s, err = frameExporterInterleavedSamples(b, int(c.format), int(C.astilibav_frame_channels(c))); err != nil {
+		err = fmt.Errorf("astilibav: getting samples failed: %w", err)
+		return
+	}
+	return
+}
+
+// frameExporterSampleFormat describes how samples of a sample format are stored
+type frameExporterSampleFormat struct {
+	bps    int
+	planar bool
+	read   func(b []byte) float64
+	write  func(b []byte, v float64)
+}
+
+func newFrameExporterSampleFormat(sampleFmt int) (f frameExporterSampleFormat, err error) {
+	switch sampleFmt {
+	case avutil.AV_SAMPLE_FMT_U8, avutil.AV_SAMPLE_FMT_U8P:
+		f = frameExporterSampleFormat{
+			bps:    1,
+			planar: sampleFmt == avutil.AV_SAMPLE_FMT_U8P,
+			read:   func(b []byte) float64 { return (float64(b[0]) - 128) / 128 },
+			write:  func(b []byte, v float64) { b[0] = uint8(math.Max(0, math.Min(math.MaxUint8, math.Round(v*128+128)))) },
+		}
+	case avutil.AV_SAMPLE_FMT_S16, avutil.AV_SAMPLE_FMT_S16P:
+		f = frameExporterSampleFormat{
+			bps:    2,
+			planar: sampleFmt == avutil.AV_SAMPLE_FMT_S16P,
+			read:   func(b []byte) float64 { return float64(int16(binary.LittleEndian.Uint16(b))) / -math.MinInt16 },
+			write: func(b []byte, v float64) {
+				binary.LittleEndian.PutUint16(b, uint16(int16(math.Max(math.MinInt16, math.Min(math.MaxInt16, math.Round(v*-math.MinInt16))))))
+			},
+		}
+	case avutil.AV_SAMPLE_FMT_S32, avutil.AV_SAMPLE_FMT_S32P:
+		f = frameExporterSampleFormat{
+			bps:    4,
+			planar: sampleFmt == avutil.AV_SAMPLE_FMT_S32P,
+			read:   func(b []byte) float64 { return float64(int32(binary.LittleEndian.Uint32(b))) / -math.MinInt32 },
+			write: func(b []byte, v float64) {
+				binary.LittleEndian.PutUint32(b, uint32(int32(math.Max(math.MinInt32, math.Min(math.MaxInt32, math.Round(v*-math.MinInt32))))))
+			},
+		}
+	case avutil.AV_SAMPLE_FMT_S64, avutil.AV_SAMPLE_FMT_S64P:
+		f = frameExporterSampleFormat{
+			bps:    8,
+			planar: sampleFmt == avutil.AV_SAMPLE_FMT_S64P,
+			read:   func(b []byte) float64 { return float64(int64(binary.LittleEndian.Uint64(b))) / -math.MinInt64 },
+			write: func(b []byte, v float64) {
+				// math.MaxInt64 can't be represented as a float64, which is why the max value is handled separately
+				i := int64(math.MaxInt64)
+				if v = math.Round(v * -math.MinInt64); v < -math.MinInt64 {
+					i = int64(math.Max(math.MinInt64, v))
+				}
+				binary.LittleEndian.PutUint64(b, uint64(i))
+			},
+		}
+	case avutil.AV_SAMPLE_FMT_FLT, avutil.AV_SAMPLE_FMT_FLTP:
+		f = frameExporterSampleFormat{
+			bps:    4,
+			planar: sampleFmt == avutil.AV_SAMPLE_FMT_FLTP,
+			read:   func(b []byte) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))) },
+			write:  func(b []byte, v float64) { binary.LittleEndian.PutUint32(b, math.Float32bits(float32(v))) },
+		}
+	case avutil.AV_SAMPLE_FMT_DBL, avutil.AV_SAMPLE_FMT_DBLP:
+		f = frameExporterSampleFormat{
+			bps:    8,
+			planar: sampleFmt == avutil.AV_SAMPLE_FMT_DBLP,
+			read:   func(b []byte) float64 { return math.Float64frombits(binary.LittleEndian.Uint64(b)) },
+			write:  func(b []byte, v float64) { binary.LittleEndian.PutUint64(b, math.Float64bits(v)) },
+		}
+	default:
+		err = fmt.Errorf("astilibav: sample format %d is not supported", sampleFmt)
+	}
+	return
+}
+
+// interleavedIndex returns the index in the interleaved samples of the sample at index idx in b, n being the total
+// number of samples
+func (f frameExporterSampleFormat) interleavedIndex(idx, n, channels int) int {
+	if !f.planar {
+		return idx
+	}
+	samples := n / channels
+	return (idx%samples)*channels + idx/samples
+}
+
+// frameExporterInterleavedSamples converts samples to interleaved normalized floats, planes being concatenated in b
+func frameExporterInterleavedSamples(b []byte, sampleFmt, channels int) (s []float64, err error) {
+	// Get sample format
+	var f frameExporterSampleFormat
+	if f, err = newFrameExporterSampleFormat(sampleFmt); err != nil {
+		return
+	}
+
+	// Invalid channels
+	if channels <= 0 {
+		err = fmt.Errorf("astilibav: invalid number of channels %d", channels)
+		return
+	}
+
+	// Read samples
+	n := len(b) / f.bps
+	s = make([]float64, n)
+	for idx := 0; idx < n; idx++ {
+		s[f.interleavedIndex(idx, n, channels)] = f.read(b[idx*f.bps:])
+	}
+	return
+}
+
+// frameExporterWriteInterleavedSamples is the opposite of frameExporterInterleavedSamples: it writes the interleaved
+// normalized floats in b, planes being concatenated in b. Integer formats clip values out of range
+func frameExporterWriteInterleavedSamples(b []byte, s []float64, sampleFmt, channels int) (err error) {
+	// Get sample format
+	var f frameExporterSampleFormat
+	if f, err = newFrameExporterSampleFormat(sampleFmt); err != nil {
+		return
+	}
+
+	// Invalid channels
+	if channels <= 0 {
+		err = fmt.Errorf("astilibav: invalid number of channels %d", channels)
+		return
+	}
+
+	// Invalid size
+	n := len(b) / f.bps
+	if n != len(s) {
+		err = fmt.Errorf("astilibav: %d samples provided whereas %d are expected", len(s), n)
+		return
+	}
+
+	// Write samples
+	for idx := 0; idx < n; idx++ {
+		f.write(b[idx*f.bps:], s[f.interleavedIndex(idx, n, channels)])
+	}
+	return
+}
+
+// frameExporterSetSamples writes the interleaved normalized floats in the frame, which must be writable
+func frameExporterSetSamples(f *avutil.Frame, s []float64) (err error) {
+	// Get planes
+	c := (*C.struct_AVFrame)(unsafe.Pointer(f))
+	channels := int(C.astilibav_frame_channels(c))
+	planes, size := 1, int(C.av_get_bytes_per_sample(C.enum_AVSampleFormat(c.format)))*int(c.nb_samples)
+	if C.av_sample_fmt_is_planar(C.enum_AVSampleFormat(c.format)) == 1 {
+		planes = channels
+	} else {
+		size *= channels
+	}
+	if size <= 0 || c.extended_data == nil {
+		return
+	}
+
+	// Write samples
+	b := make([]byte, planes*size)
+	if err = frameExporterWriteInterleavedSamples(b, s, int(c.format), channels); err != nil {
+		err = fmt.Errorf("astilibav: writing samples failed: %w", err)
+		return
+	}
+
+	// Copy planes
+	ds := (*[1 << 10]*C.uint8_t)(unsafe.Pointer(c.extended_data))[:planes:planes]
+	for idx, d := range ds {
+		copy((*[1 << 30]byte)(unsafe.Pointer(d))[:size:size], b[idx*size:(idx+1)*size])
+	}
+	return
+}
+
+// FrameExporter represents an object capable of exporting frames as Go types so that they can be consumed by Go
+// code such as CV libraries or ML inference without any cgo knowledge
+// Video frames are exported as image.RGBA or image.YCbCr and audio frames as []float32 or []int16
+type FrameExporter struct {
+	*astiencoder.BaseNode
+	c                *astikit.Chan
+	eh               *astiencoder.EventHandler
+	o                FrameExporterOptions
+	statIncomingRate *astikit.CounterAvgStat
+	statWorkRatio    *astikit.DurationPercentageStat
+}
+
+// FrameExporterOptions represents frame exporter options
+type FrameExporterOptions struct {
+	// Possible values are "rgba" and "ycbcr" for video, "float32" and "int16" for audio. Defaults to "rgba" for video
+	// and "float32" for audio
+	Format  string
+	Handler func(f ExportedFrame) error
+	Node    astiencoder.NodeOptions
+}
+
+// ExportedFrame represents an exported frame
+// Data belongs to the handler
+type ExportedFrame struct {
+	// Only set for audio frames
+	Channels int
+	// Only set for audio frames with the "float32" format
+	Float32 []float32
+	// Only set for video frames
+	Image image.Image
+	// Only set for audio frames with the "int16" format
+	Int16    []int16
+	Metadata *UnitMetadata
+	Pts      int64
+	// Only set for audio frames
+	SampleRate int
+	// Pts converted to a duration
+	Time time.Duration
+}
+
+// NewFrameExporter creates a new frame exporter
+func NewFrameExporter(o FrameExporterOptions, eh *astiencoder.EventHandler) (e *FrameExporter, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countFrameExporter, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("frame_exporter_%d", count), fmt.Sprintf("Frame Exporter #%d", count), "Exports frames")
+
+	// Check format
+	switch o.Format {
+	case "", FrameExporterFormatFloat32, FrameExporterFormatInt16, FrameExporterFormatRGBA, FrameExporterFormatYCbCr:
+	default:
+		err = fmt.Errorf("astilibav: invalid format %s", o.Format)
+		return
+	}
+
+	// Create frame exporter
+	e = &FrameExporter{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh:               eh,
+		o:                o,
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statWorkRatio:    astikit.NewDurationPercentageStat(),
+	}
+	e.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(e), eh)
+	e.addStats()
+
+	// No handler
+	if o.Handler == nil {
+		err = errors.New("astilibav: no handler provided")
+		return
+	}
+	return
+}
+
+func (e *FrameExporter) addStats() {
+	// Add incoming rate
+	e.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of frames coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "fps",
+	}, e.statIncomingRate)
+
+	// Add work ratio
+	e.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, e.statWorkRatio)
+
+	// Add chan stats
+	e.c.AddStats(e.Stater())
+}
+
+// Start starts the frame exporter
+func (e *FrameExporter) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	e.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to stop the chan properly
+		defer e.c.Stop()
+
+		// Start chan
+		e.c.Start(e.Context())
+	})
+}
+
+// HandleFrame implements the FrameHandler interface
+func (e *FrameExporter) HandleFrame(p *FrameHandlerPayload) {
+	e.c.Add(func() {
+		// Handle pause
+		defer e.HandlePause()
+
+		// Increment incoming rate
+		e.statIncomingRate.Add(1)
+
+		// Export
+		e.statWorkRatio.Begin()
+		f, err := e.export(p)
+		e.statWorkRatio.End()
+		if err != nil {
+			e.eh.Emit(astiencoder.EventError(e, fmt.Errorf("astilibav: exporting frame failed: %w", err)))
+			return
+		}
+
+		// Execute handler
+		if err = e.o.Handler(f); err != nil {
+			e.eh.Emit(astiencoder.EventError(e, fmt.Errorf("astilibav: handler failed: %w", err)))
+			return
+		}
+	})
+}
+
+func (e *FrameExporter) export(p *FrameHandlerPayload) (f ExportedFrame, err error) {
+	// Create exported frame
+	f = ExportedFrame{
+		Metadata: p.Metadata,
+		Pts:      p.Frame.Pts(),
+	}
+	if f.Pts != avutil.AV_NOPTS_VALUE && p.Descriptor != nil {
+		f.Time = time.Duration(avutil.AvRescaleQ(f.Pts, p.Descriptor.TimeBase(), nanosecondRational))
+	}
+
+	// Video
+	if p.Frame.Width() > 0 && p.Frame.Height() > 0 {
+		switch e.o.Format {
+		case "", FrameExporterFormatRGBA:
+			f.Image, err = FrameRGBA(p.Frame)
+		case FrameExporterFormatYCbCr:
+			f.Image, err = FrameYCbCr(p.Frame)
+		default:
+			err = fmt.Errorf("astilibav: format %s is not a video format", e.o.Format)
+		}
+		return
+	}
+
+	// Audio
+	f.Channels = int(C.astilibav_frame_channels((*C.struct_AVFrame)(unsafe.Pointer(p.Frame))))
+	f.SampleRate = p.Frame.SampleRate()
+	switch e.o.Format {
+	case "", FrameExporterFormatFloat32:
+		f.Float32, err = FrameFloat32Samples(p.Frame)
+	case FrameExporterFormatInt16:
+		f.Int16, err = FrameInt16Samples(p.Frame)
+	default:
+		err = fmt.Errorf("astilibav: format %s is not an audio format", e.o.Format)
+	}
+	return
+}
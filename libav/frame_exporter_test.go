@@ -0,0 +1,70 @@
+package astilibav
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/asticode/goav/avutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrameExporterInterleavedSamples(t *testing.T) {
+	// Interleaved
+	b := make([]byte, 8)
+	for idx, v := range []int16{math.MinInt16, 0, 16384, -16384} {
+		binary.LittleEndian.PutUint16(b[idx*2:], uint16(v))
+	}
+	s, err := frameExporterInterleavedSamples(b, avutil.AV_SAMPLE_FMT_S16, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{-1, 0, 0.5, -0.5}, s)
+
+	// Planar
+	b = make([]byte, 16)
+	for idx, v := range []float32{0.1, 0.2, -0.1, -0.2} {
+		binary.LittleEndian.PutUint32(b[idx*4:], math.Float32bits(v))
+	}
+	s, err = frameExporterInterleavedSamples(b, avutil.AV_SAMPLE_FMT_FLTP, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{float64(float32(0.1)), float64(float32(-0.1)), float64(float32(0.2)), float64(float32(-0.2))}, s)
+
+	// Unsigned
+	s, err = frameExporterInterleavedSamples([]byte{0, 128, 192}, avutil.AV_SAMPLE_FMT_U8, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{-1, 0, 0.5}, s)
+
+	// Errors
+	_, err = frameExporterInterleavedSamples(b, avutil.AV_SAMPLE_FMT_NONE, 2)
+	assert.Error(t, err)
+	_, err = frameExporterInterleavedSamples(b, avutil.AV_SAMPLE_FMT_FLT, 0)
+	assert.Error(t, err)
+}
+
+func TestFrameExporterWriteInterleavedSamples(t *testing.T) {
+	for _, sampleFmt := range []int{
+		avutil.AV_SAMPLE_FMT_U8, avutil.AV_SAMPLE_FMT_S16P, avutil.AV_SAMPLE_FMT_S32,
+		avutil.AV_SAMPLE_FMT_S64P, avutil.AV_SAMPLE_FMT_FLTP, avutil.AV_SAMPLE_FMT_DBL,
+	} {
+		// Round trip
+		f, err := newFrameExporterSampleFormat(sampleFmt)
+		assert.NoError(t, err)
+		b := make([]byte, 4*f.bps)
+		assert.NoError(t, frameExporterWriteInterleavedSamples(b, []float64{0.5, -0.5, 0, 0.25}, sampleFmt, 2))
+		s, err := frameExporterInterleavedSamples(b, sampleFmt, 2)
+		assert.NoError(t, err)
+		assert.InDeltaSlice(t, []float64{0.5, -0.5, 0, 0.25}, s, 0.01)
+
+		// Values are clipped
+		assert.NoError(t, frameExporterWriteInterleavedSamples(b, []float64{2, -2, 0, 0}, sampleFmt, 2))
+		s, err = frameExporterInterleavedSamples(b, sampleFmt, 2)
+		assert.NoError(t, err)
+		if sampleFmt != avutil.AV_SAMPLE_FMT_FLTP && sampleFmt != avutil.AV_SAMPLE_FMT_DBL {
+			assert.InDelta(t, 1, s[0], 0.01)
+			assert.InDelta(t, -1, s[1], 0.01)
+		}
+	}
+
+	// Errors
+	assert.Error(t, frameExporterWriteInterleavedSamples(make([]byte, 4), []float64{0}, avutil.AV_SAMPLE_FMT_S16, 1))
+	assert.Error(t, frameExporterWriteInterleavedSamples(make([]byte, 4), []float64{0, 0}, avutil.AV_SAMPLE_FMT_NONE, 1))
+}
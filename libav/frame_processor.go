@@ -0,0 +1,261 @@
+package astilibav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"sync/atomic"
+	"time"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+)
+
+var countFrameProcessor uint64
+
+// FrameProcessorFunc processes a frame
+// It returns the frame that must be dispatched to the next nodes, which must be either a.Frame or a frame created
+// with a.NewFrame, or nil if the frame must be dropped
+type FrameProcessorFunc func(a *FrameProcessorArgs) (*avutil.Frame, error)
+
+// NewClockUpdaterFrameProcessorFunc creates a new frame processor func that updates the clock with the PTS of the
+// frames it processes, for instance to make it an audio or video master clock. It should be used with ReadOnly
+func NewClockUpdaterFrameProcessorFunc(c astiencoder.ClockUpdater) FrameProcessorFunc {
+	return func(a *FrameProcessorArgs) (*avutil.Frame, error) {
+		if a.Frame.Pts() != avutil.AV_NOPTS_VALUE && a.Descriptor != nil {
+			c.Update(time.Duration(avutil.AvRescaleQ(a.Frame.Pts(), a.Descriptor.TimeBase(), nanosecondRational)))
+		}
+		return a.Frame, nil
+	}
+}
+
+// FrameProcessor represents an object capable of processing frames with a Go func, for instance to apply ML filters
+// or custom analytics
+// Frames handed to the func belong to the processor which takes care of referencing and releasing them: the func
+// must not keep any of them once it has returned
+type FrameProcessor struct {
+	*astiencoder.BaseNode
+	c                *astikit.Chan
+	d                *frameDispatcher
+	eh               *astiencoder.EventHandler
+	o                FrameProcessorOptions
+	p                *framePool
+	statDropRate     *astikit.CounterAvgStat
+	statIncomingRate *astikit.CounterAvgStat
+	statWorkRatio    *astikit.DurationPercentageStat
+}
+
+// FrameProcessorOptions represents frame processor options
+type FrameProcessorOptions struct {
+	Func FrameProcessorFunc
+	Node astiencoder.NodeOptions
+	// If true, the frame handed to the func is not made writable which saves a copy when the func only reads it
+	ReadOnly bool
+}
+
+// FrameProcessorArgs represents frame processor func args
+type FrameProcessorArgs struct {
+	Descriptor Descriptor
+	// Unless ReadOnly is true, the frame is writable
+	Frame    *avutil.Frame
+	Metadata *UnitMetadata
+	// Node the frame comes from
+	Node astiencoder.Node
+	fs   []*avutil.Frame
+	p    *framePool
+}
+
+// NewFrame returns a new frame that can be returned by the func
+// It is released by the processor once the func has returned and the frame has been dispatched
+func (a *FrameProcessorArgs) NewFrame() *avutil.Frame {
+	f := a.p.get()
+	a.fs = append(a.fs, f)
+	return f
+}
+
+func (a *FrameProcessorArgs) valid(f *avutil.Frame) bool {
+	if f == nil || f == a.Frame {
+		return true
+	}
+	for _, v := range a.fs {
+		if v == f {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *FrameProcessorArgs) close() {
+	for _, f := range a.fs {
+		a.p.put(f)
+	}
+	a.fs = nil
+}
+
+// NewFrameProcessor creates a new frame processor
+func NewFrameProcessor(o FrameProcessorOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (p *FrameProcessor, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countFrameProcessor, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("frame_processor_%d", count), fmt.Sprintf("Frame Processor #%d", count), "Processes frames")
+
+	// No func
+	if o.Func == nil {
+		err = errors.New("astilibav: no func provided")
+		return
+	}
+
+	// Create frame processor
+	p = &FrameProcessor{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh:               eh,
+		o:                o,
+		p:                newFramePool(c),
+		statDropRate:     astikit.NewCounterAvgStat(),
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statWorkRatio:    astikit.NewDurationPercentageStat(),
+	}
+	p.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(p), eh)
+	p.d = newFrameDispatcher(p, eh, c)
+	p.addStats()
+	return
+}
+
+func (p *FrameProcessor) addStats() {
+	// Add incoming rate
+	p.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of frames coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "fps",
+	}, p.statIncomingRate)
+
+	// Add drop rate
+	p.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of frames dropped per second",
+		Label:       "Drop rate",
+		Unit:        "fps",
+	}, p.statDropRate)
+
+	// Add work ratio
+	p.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, p.statWorkRatio)
+
+	// Add dispatcher stats
+	p.d.addStats(p.Stater())
+
+	// Add chan stats
+	p.c.AddStats(p.Stater())
+}
+
+// Connect implements the FrameHandlerConnector interface
+func (p *FrameProcessor) Connect(h FrameHandler) {
+	// Add handler
+	p.d.addHandler(h)
+
+	// Connect nodes
+	astiencoder.ConnectNodes(p, h)
+}
+
+// Disconnect implements the FrameHandlerConnector interface
+func (p *FrameProcessor) Disconnect(h FrameHandler) {
+	// Delete handler
+	p.d.delHandler(h)
+
+	// Disconnect nodes
+	astiencoder.DisconnectNodes(p, h)
+}
+
+// Snapshot implements the astiencoder.Snapshotter interface
+func (p *FrameProcessor) Snapshot(ctx context.Context) (image.Image, error) {
+	return p.d.snapshot(ctx)
+}
+
+// Start starts the frame processor
+func (p *FrameProcessor) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	p.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to wait for all dispatcher subprocesses to be done so that they are properly closed
+		defer p.d.wait()
+
+		// Make sure to stop the chan properly
+		defer p.c.Stop()
+
+		// Start chan
+		p.c.Start(p.Context())
+	})
+}
+
+// HandleEOS implements the EOSHandler interface
+func (p *FrameProcessor) HandleEOS(pl *EOSHandlerPayload) {
+	p.c.Add(func() {
+		// Forward end of stream
+		p.d.dispatchEOS()
+	})
+}
+
+// HandleFrame implements the FrameHandler interface
+func (p *FrameProcessor) HandleFrame(pl *FrameHandlerPayload) {
+	p.c.Add(func() {
+		// Handle pause
+		defer p.HandlePause()
+
+		// Increment incoming rate
+		p.statIncomingRate.Add(1)
+
+		// Copy frame
+		f := p.p.get()
+		defer p.p.put(f)
+		if ret := defaultBindings.frameRef(f, pl.Frame); ret < 0 {
+			emitAvError(p, p.eh, ret, "avutil.AvFrameRef failed")
+			return
+		}
+
+		// Since data is shared with the other handlers of the previous node, it must be copied before being updated
+		if !p.o.ReadOnly {
+			if ret := avutil.AvFrameMakeWritable(f); ret < 0 {
+				emitAvError(p, p.eh, ret, "avutil.AvFrameMakeWritable failed")
+				return
+			}
+		}
+
+		// Create args
+		a := &FrameProcessorArgs{
+			Descriptor: pl.Descriptor,
+			Frame:      f,
+			Metadata:   pl.Metadata,
+			Node:       pl.Node,
+			p:          p.p,
+		}
+		defer a.close()
+
+		// Process
+		p.statWorkRatio.Begin()
+		o, err := p.o.Func(a)
+		p.statWorkRatio.End()
+		if err != nil {
+			p.eh.Emit(astiencoder.EventError(p, fmt.Errorf("astilibav: processing frame failed: %w", err)))
+			return
+		}
+
+		// Invalid frame
+		if !a.valid(o) {
+			p.eh.Emit(astiencoder.EventError(p, errors.New("astilibav: returned frame doesn't belong to the frame processor")))
+			return
+		}
+
+		// Drop frame
+		if o == nil {
+			p.statDropRate.Add(1)
+			return
+		}
+
+		// Dispatch frame
+		p.d.dispatch(o, pl.Descriptor, pl.Metadata)
+	})
+}
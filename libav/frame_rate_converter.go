@@ -0,0 +1,297 @@
+package astilibav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"sync/atomic"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+)
+
+var countFrameRateConverter uint64
+
+// FrameRateConverter represents an object capable of converting video frames to a constant frame rate by dropping
+// or duplicating them, the same way the ffmpeg fps filter does
+// Each output slot gets the last frame whose pts is rounded to it. Output timestamps are the slots indexes in a
+// 1/frame rate time base
+type FrameRateConverter struct {
+	*astiencoder.BaseNode
+	buf                 *avutil.Frame
+	c                   *astikit.Chan
+	d                   *frameDispatcher
+	descriptor          Descriptor
+	eh                  *astiencoder.EventHandler
+	frameRate           avutil.Rational
+	m                   *UnitMetadata
+	p                   *framePool
+	s                   *frameRateConverterSlots
+	statDropRate        *astikit.CounterAvgStat
+	statDuplicationRate *astikit.CounterAvgStat
+	statIncomingRate    *astikit.CounterAvgStat
+	statWorkRatio       *astikit.DurationPercentageStat
+	timeBase            avutil.Rational
+}
+
+// FrameRateConverterOptions represents frame rate converter options
+type FrameRateConverterOptions struct {
+	FrameRate avutil.Rational
+	Node      astiencoder.NodeOptions
+}
+
+// NewFrameRateConverter creates a new frame rate converter
+func NewFrameRateConverter(o FrameRateConverterOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (r *FrameRateConverter, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countFrameRateConverter, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("frame_rate_converter_%d", count), fmt.Sprintf("Frame Rate Converter #%d", count), "Converts frame rate")
+
+	// Check frame rate
+	if o.FrameRate.Num() <= 0 || o.FrameRate.Den() <= 0 {
+		err = errors.New("astilibav: invalid frame rate")
+		return
+	}
+
+	// Create frame rate converter
+	r = &FrameRateConverter{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh:                  eh,
+		frameRate:           o.FrameRate,
+		p:                   newFramePool(c),
+		s:                   &frameRateConverterSlots{},
+		statDropRate:        astikit.NewCounterAvgStat(),
+		statDuplicationRate: astikit.NewCounterAvgStat(),
+		statIncomingRate:    astikit.NewCounterAvgStat(),
+		statWorkRatio:       astikit.NewDurationPercentageStat(),
+		timeBase:            avutil.NewRational(o.FrameRate.Den(), o.FrameRate.Num()),
+	}
+	r.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(r), eh)
+	r.d = newFrameDispatcher(r, eh, c)
+	r.addStats()
+	return
+}
+
+func (r *FrameRateConverter) addStats() {
+	// Add incoming rate
+	r.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of frames coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "fps",
+	}, r.statIncomingRate)
+
+	// Add drop rate
+	r.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of frames dropped per second",
+		Label:       "Drop rate",
+		Unit:        "fps",
+	}, r.statDropRate)
+
+	// Add duplication rate
+	r.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of frames duplicated per second",
+		Label:       "Duplication rate",
+		Unit:        "fps",
+	}, r.statDuplicationRate)
+
+	// Add work ratio
+	r.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, r.statWorkRatio)
+
+	// Add dispatcher stats
+	r.d.addStats(r.Stater())
+
+	// Add chan stats
+	r.c.AddStats(r.Stater())
+}
+
+// Connect implements the FrameHandlerConnector interface
+func (r *FrameRateConverter) Connect(h FrameHandler) {
+	// Add handler
+	r.d.addHandler(h)
+
+	// Connect nodes
+	astiencoder.ConnectNodes(r, h)
+}
+
+// Disconnect implements the FrameHandlerConnector interface
+func (r *FrameRateConverter) Disconnect(h FrameHandler) {
+	// Delete handler
+	r.d.delHandler(h)
+
+	// Disconnect nodes
+	astiencoder.DisconnectNodes(r, h)
+}
+
+// Snapshot implements the astiencoder.Snapshotter interface
+func (r *FrameRateConverter) Snapshot(ctx context.Context) (image.Image, error) {
+	return r.d.snapshot(ctx)
+}
+
+// Start starts the frame rate converter
+func (r *FrameRateConverter) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	r.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to wait for all dispatcher subprocesses to be done so that they are properly closed
+		defer r.d.wait()
+
+		// Make sure to dispatch the buffered frame
+		defer r.flush()
+
+		// Make sure to stop the chan properly
+		defer r.c.Stop()
+
+		// Start chan
+		r.c.Start(r.Context())
+	})
+}
+
+// HandleEOS implements the EOSHandler interface
+func (r *FrameRateConverter) HandleEOS(p *EOSHandlerPayload) {
+	r.c.Add(func() {
+		// Dispatch the buffered frame
+		r.flush()
+
+		// Forward end of stream
+		r.d.dispatchEOS()
+	})
+}
+
+// HandleFrame implements the FrameHandler interface
+func (r *FrameRateConverter) HandleFrame(p *FrameHandlerPayload) {
+	r.c.Add(func() {
+		// Handle pause
+		defer r.HandlePause()
+
+		// Increment incoming rate
+		r.statIncomingRate.Add(1)
+
+		// Frames without pts can't be placed
+		if p.Frame.Pts() == avutil.AV_NOPTS_VALUE {
+			r.statDropRate.Add(1)
+			return
+		}
+
+		// Timestamps can't be trusted after a discontinuity
+		if p.Metadata != nil && p.Metadata.Discontinuity {
+			r.flush()
+		}
+
+		// Get slot
+		r.statWorkRatio.Begin()
+		slot := avutil.AvRescaleQRnd(p.Frame.Pts(), p.Descriptor.TimeBase(), r.timeBase, avutil.AV_ROUND_NEAR_INF|avutil.AV_ROUND_PASS_MINMAX)
+		n := r.s.add(slot)
+		r.statWorkRatio.End()
+
+		// Dispatch the buffered frame in the slots before the new frame's
+		if r.buf != nil {
+			if n == 0 {
+				r.statDropRate.Add(1)
+			} else if n > 1 {
+				r.statDuplicationRate.Add(float64(n - 1))
+			}
+			for idx := 0; idx < n; idx++ {
+				r.dispatch(r.s.take())
+			}
+		}
+
+		// Buffer frame
+		if r.buf == nil {
+			r.buf = r.p.get()
+		} else {
+			defaultBindings.frameUnref(r.buf)
+		}
+		if ret := defaultBindings.frameRef(r.buf, p.Frame); ret < 0 {
+			emitAvError(r, r.eh, ret, "avutil.AvFrameRef failed")
+			r.p.put(r.buf)
+			r.buf = nil
+			return
+		}
+		r.descriptor = p.Descriptor
+		r.m = p.Metadata
+	})
+}
+
+func (r *FrameRateConverter) dispatch(pts int64) {
+	// Restamp
+	r.buf.SetPts(pts)
+
+	// Dispatch frame
+	r.d.dispatch(r.buf, r.outputDescriptor(), r.m)
+}
+
+func (r *FrameRateConverter) flush() {
+	// Nothing to flush
+	if r.buf == nil {
+		return
+	}
+
+	// Dispatch buffered frame once
+	r.dispatch(r.s.flush())
+
+	// Put frame back in the pool
+	r.p.put(r.buf)
+	r.buf = nil
+}
+
+func (r *FrameRateConverter) outputDescriptor() StreamDescriptor {
+	psd, ok := DescriptorStream(r.descriptor)
+	ctx := Context{CodecType: avutil.AVMEDIA_TYPE_VIDEO}
+	if ok {
+		ctx = psd.Context()
+	}
+	ctx.FrameRate = r.frameRate
+	ctx.TimeBase = r.timeBase
+	return newStreamDescriptor(ctx, psd.Index(), psd.SideData())
+}
+
+// frameRateConverterSlots keeps track of the next output slot
+// Once flushed, the timeline restarts with the next frame but output slots keep following the previous ones so that
+// output timestamps remain monotonic
+type frameRateConverterSlots struct {
+	flushed bool
+	next    int64
+	offset  int64
+	started bool
+}
+
+// add returns the number of slots the buffered frame must fill before the frame of the provided slot is buffered
+func (s *frameRateConverterSlots) add(slot int64) (n int) {
+	// First frame starts the timeline
+	if !s.started {
+		if s.flushed {
+			s.offset = s.next - slot
+		} else {
+			s.next = slot
+		}
+		s.started = true
+		return
+	}
+
+	// Fill slots up to the new frame's
+	if slot += s.offset; slot > s.next {
+		n = int(slot - s.next)
+	}
+	return
+}
+
+// take returns the next slot to fill
+func (s *frameRateConverterSlots) take() (slot int64) {
+	slot = s.next
+	s.next++
+	return
+}
+
+// flush returns the next slot to fill and restarts the timeline with the next frame
+func (s *frameRateConverterSlots) flush() (slot int64) {
+	slot = s.take()
+	s.flushed = true
+	s.started = false
+	return
+}
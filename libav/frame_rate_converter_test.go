@@ -0,0 +1,37 @@
+package astilibav
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrameRateConverterSlots(t *testing.T) {
+	s := &frameRateConverterSlots{}
+	assert.Equal(t, 0, s.add(10))
+
+	// Duplicate
+	assert.Equal(t, 3, s.add(13))
+	assert.Equal(t, []int64{10, 11, 12}, []int64{s.take(), s.take(), s.take()})
+
+	// Drop
+	assert.Equal(t, 0, s.add(13))
+	assert.Equal(t, 0, s.add(12))
+
+	// Regular
+	assert.Equal(t, 1, s.add(14))
+	assert.Equal(t, int64(13), s.take())
+
+	// Flush
+	assert.Equal(t, int64(14), s.flush())
+	assert.Equal(t, 0, s.add(100))
+	assert.Equal(t, 1, s.add(101))
+	assert.Equal(t, int64(15), s.take())
+
+	// Timestamps going backward after a flush
+	assert.Equal(t, int64(16), s.flush())
+	assert.Equal(t, 0, s.add(5))
+	assert.Equal(t, 0, s.add(5))
+	assert.Equal(t, 2, s.add(7))
+	assert.Equal(t, []int64{17, 18}, []int64{s.take(), s.take()})
+}
@@ -1,6 +1,9 @@
 package astilibav
 
 import (
+	"sync"
+
+	"github.com/asticode/go-astiencoder"
 	"github.com/asticode/go-astikit"
 	"github.com/asticode/goav/avutil"
 )
@@ -83,3 +86,80 @@ func (r *frameRestamperWithModulo) Restamp(f *avutil.Frame) {
 		return astikit.Int64Ptr(f.Pts() - (f.Pts() % r.frameDuration))
 	})
 }
+
+// FrameRestamperOffset represents a frame restamper that adds an offset to timestamps
+// The offset can be updated at runtime, for instance to stitch a backup feed onto a primary feed
+type FrameRestamperOffset struct {
+	m      *sync.Mutex
+	offset int64
+}
+
+// NewFrameRestamperOffset creates a new frame restamper that adds an offset to timestamps
+// offset must be a duration in frame time base
+func NewFrameRestamperOffset(offset int64) *FrameRestamperOffset {
+	return &FrameRestamperOffset{
+		m:      &sync.Mutex{},
+		offset: offset,
+	}
+}
+
+// Offset returns the offset
+func (r *FrameRestamperOffset) Offset() int64 {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.offset
+}
+
+// SetOffset updates the offset
+func (r *FrameRestamperOffset) SetOffset(offset int64) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.offset = offset
+}
+
+// Restamp implements the FrameRestamper interface
+func (r *FrameRestamperOffset) Restamp(f *avutil.Frame) {
+	if f.Pts() != avutil.AV_NOPTS_VALUE {
+		f.SetPts(f.Pts() + r.Offset())
+	}
+}
+
+// RestamperAlignmentOffset returns the offset that must be added to the timestamps of an input so that its first
+// timestamp matches the first timestamp of a reference input
+// The offset is in the input time base
+func RestamperAlignmentOffset(referenceFirst int64, referenceTimeBase avutil.Rational, inputFirst int64, inputTimeBase avutil.Rational) int64 {
+	return avutil.AvRescaleQ(referenceFirst, referenceTimeBase, inputTimeBase) - inputFirst
+}
+
+type frameRestamperWithClock struct {
+	*frameRestamperWithValue
+	c        astiencoder.Clock
+	timeBase avutil.Rational
+}
+
+// NewFrameRestamperWithClock creates a new frame restamper that sets timestamps to the clock position, making sure
+// they're strictly increasing
+// timeBase must be the frame time base
+func NewFrameRestamperWithClock(c astiencoder.Clock, timeBase avutil.Rational) FrameRestamper {
+	return &frameRestamperWithClock{
+		frameRestamperWithValue: newFrameRestamperWithValue(),
+		c:                       c,
+		timeBase:                timeBase,
+	}
+}
+
+// Restamp implements the FrameRestamper interface
+func (r *frameRestamperWithClock) Restamp(f *avutil.Frame) {
+	r.restamp(f, func(v *int64) *int64 {
+		nv := astikit.Int64Ptr(clockPosition(r.c, r.timeBase))
+		if v != nil && *nv <= *v {
+			nv = astikit.Int64Ptr(*v + 1)
+		}
+		return nv
+	})
+}
+
+// clockPosition returns the clock position in the provided time base
+func clockPosition(c astiencoder.Clock, timeBase avutil.Rational) int64 {
+	return avutil.AvRescaleQ(int64(c.Now()), nanosecondRational, timeBase)
+}
@@ -2,11 +2,20 @@ package astilibav
 
 import (
 	"testing"
+	"time"
 
 	"github.com/asticode/goav/avutil"
 	"github.com/stretchr/testify/assert"
 )
 
+type clockTest struct {
+	d time.Duration
+}
+
+func (c *clockTest) Now() time.Duration {
+	return c.d
+}
+
 type frameTest struct {
 	input  int64
 	output int64
@@ -50,3 +59,41 @@ func TestFrameRestamperWithModulo(t *testing.T) {
 		assert.Equal(t, ft.output, f.Pts())
 	}
 }
+
+func TestFrameRestamperWithClock(t *testing.T) {
+	c := &clockTest{}
+	f := avutil.Frame{}
+	r := NewFrameRestamperWithClock(c, avutil.NewRational(1, 1000))
+	for _, ft := range []struct {
+		clock  time.Duration
+		output int64
+	}{
+		{clock: 10 * time.Millisecond, output: 10},
+		{clock: 30 * time.Millisecond, output: 30},
+		{clock: 30 * time.Millisecond, output: 31},
+		{clock: 50 * time.Millisecond, output: 50},
+	} {
+		c.d = ft.clock
+		r.Restamp(&f)
+		assert.Equal(t, ft.output, f.Pts())
+	}
+}
+
+func TestFrameRestamperOffset(t *testing.T) {
+	f := avutil.Frame{}
+	r := NewFrameRestamperOffset(10)
+	f.SetPts(5)
+	r.Restamp(&f)
+	assert.Equal(t, int64(15), f.Pts())
+	r.SetOffset(-5)
+	f.SetPts(20)
+	r.Restamp(&f)
+	assert.Equal(t, int64(15), f.Pts())
+	f.SetPts(avutil.AV_NOPTS_VALUE)
+	r.Restamp(&f)
+	assert.Equal(t, int64(avutil.AV_NOPTS_VALUE), f.Pts())
+}
+
+func TestRestamperAlignmentOffset(t *testing.T) {
+	assert.Equal(t, int64(-90000), RestamperAlignmentOffset(1000, avutil.NewRational(1, 1000), 180000, avutil.NewRational(1, 90000)))
+}
@@ -0,0 +1,108 @@
+package astilibav
+
+//#cgo pkg-config: libavutil
+//#include <stdlib.h>
+//#include <libavutil/buffer.h>
+//#include <libavutil/hwcontext.h>
+import "C"
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"github.com/asticode/go-astikit"
+)
+
+// HWDevice represents a hardware device, such as a GPU, that nodes can share
+type HWDevice struct {
+	ctx *C.AVBufferRef
+	o   HWDeviceOptions
+	t   C.enum_AVHWDeviceType
+}
+
+// HWDeviceOptions represents hardware device options
+type HWDeviceOptions struct {
+	// Device to open, such as "/dev/dri/renderD128" for vaapi or "0" for cuda. If empty, the default device is used
+	Device string
+	// Possible values are the ones of av_hwdevice_get_type_name, such as "cuda", "qsv", "vaapi" or "videotoolbox"
+	Type string
+}
+
+// NewHWDevice creates a new hardware device
+func NewHWDevice(o HWDeviceOptions, c *astikit.Closer) (d *HWDevice, err error) {
+	// Create device
+	d = &HWDevice{o: o}
+
+	// Get type
+	t := C.CString(o.Type)
+	defer C.free(unsafe.Pointer(t))
+	if d.t = C.av_hwdevice_find_type_by_name(t); d.t == C.AV_HWDEVICE_TYPE_NONE {
+		err = fmt.Errorf("astilibav: hardware device type %s not found", o.Type)
+		return
+	}
+
+	// Get device
+	var device *C.char
+	if o.Device != "" {
+		device = C.CString(o.Device)
+		defer C.free(unsafe.Pointer(device))
+	}
+
+	// Create ctx
+	if ret := C.av_hwdevice_ctx_create(&d.ctx, d.t, device, nil, 0); ret < 0 {
+		err = fmt.Errorf("astilibav: av_hwdevice_ctx_create on %+v failed: %w", o, NewAvError(int(ret)))
+		return
+	}
+
+	// Make sure the ctx is freed
+	c.Add(func() error {
+		C.av_buffer_unref(&d.ctx)
+		return nil
+	})
+	return
+}
+
+// Type returns the device type
+func (d *HWDevice) Type() string {
+	return d.o.Type
+}
+
+// HWDevicePool represents a pool of hardware devices that allows several nodes, such as encoders, to share a device
+// instead of each of them opening its own
+type HWDevicePool struct {
+	c  *astikit.Closer
+	ds map[HWDeviceOptions]*HWDevice
+	m  *sync.Mutex
+}
+
+// NewHWDevicePool creates a new hardware device pool. Devices are freed once the closer is closed
+func NewHWDevicePool(c *astikit.Closer) *HWDevicePool {
+	return &HWDevicePool{
+		c:  c,
+		ds: make(map[HWDeviceOptions]*HWDevice),
+		m:  &sync.Mutex{},
+	}
+}
+
+// Device returns the device matching the options, which is created if it doesn't exist yet
+func (p *HWDevicePool) Device(o HWDeviceOptions) (d *HWDevice, err error) {
+	// Lock
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	// Device already exists
+	var ok bool
+	if d, ok = p.ds[o]; ok {
+		return
+	}
+
+	// Create device
+	if d, err = NewHWDevice(o, p.c); err != nil {
+		err = fmt.Errorf("astilibav: creating hardware device failed: %w", err)
+		return
+	}
+
+	// Store device
+	p.ds[o] = d
+	return
+}
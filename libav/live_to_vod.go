@@ -0,0 +1,384 @@
+package astilibav
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+)
+
+var countLiveToVODArchiver uint64
+
+// LiveToVODArchiver represents an object capable of building a VOD archive out of a live HLS output
+// It polls the live playlist and keeps every segment it has ever listed in a growing VOD playlist. Once stopped,
+// the VOD playlist is ended and, optionally, its segments are remuxed into a MP4
+// The live output must not delete its segments, which means the "delete_segments" hls flag must not be used
+// Only HLS live outputs are supported: DASH manifests are not
+type LiveToVODArchiver struct {
+	*astiencoder.BaseNode
+	eh           *astiencoder.EventHandler
+	o            LiveToVODArchiverOptions
+	p            *liveToVODPlaylist
+	statSegments *astikit.CounterAvgStat
+}
+
+// LiveToVODArchiverOptions represents live to VOD archiver options
+type LiveToVODArchiverOptions struct {
+	// Path of the live HLS playlist
+	LivePlaylist string
+	// If not empty, the archived segments are remuxed into a MP4 at this path once the archiver is stopped
+	MP4  string
+	Node astiencoder.NodeOptions
+	// Period at which the live playlist is polled. Defaults to 1s
+	Period time.Duration
+	// Path of the VOD playlist. It must be in the same directory as the live playlist since segment uris are kept
+	// as is. Defaults to the live playlist path with a "_vod" suffix
+	Playlist string
+}
+
+// LiveToVODArchive represents a live to VOD archive
+type LiveToVODArchive struct {
+	Duration time.Duration
+	// Empty if no MP4 has been requested
+	MP4      string
+	Playlist string
+	Segments int
+}
+
+type liveToVODPlaylist struct {
+	archived       map[string]bool
+	segments       []liveToVODSegment
+	sequence       *int
+	targetDuration int
+	version        int
+}
+
+type liveToVODSegment struct {
+	discontinuity bool
+	duration      time.Duration
+	// #EXT-X-KEY and #EXT-X-MAP lines applying to the segment, if any
+	key      string
+	mapTag   string
+	sequence int
+	uri      string
+}
+
+// NewLiveToVODArchiver creates a new live to VOD archiver
+func NewLiveToVODArchiver(o LiveToVODArchiverOptions, eh *astiencoder.EventHandler) (a *LiveToVODArchiver, err error) {
+	// Check options
+	if o.LivePlaylist == "" {
+		err = errors.New("astilibav: no live playlist provided")
+		return
+	} else if strings.EqualFold(filepath.Ext(o.LivePlaylist), ".mpd") {
+		err = errors.New("astilibav: DASH live outputs are not supported")
+		return
+	}
+
+	// Extend node metadata
+	count := atomic.AddUint64(&countLiveToVODArchiver, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("live_to_vod_archiver_%d", count), fmt.Sprintf("Live To VOD Archiver #%d", count), fmt.Sprintf("Archives %s", o.LivePlaylist))
+
+	// Default values
+	if o.Period <= 0 {
+		o.Period = time.Second
+	}
+	if o.Playlist == "" {
+		ext := filepath.Ext(o.LivePlaylist)
+		o.Playlist = strings.TrimSuffix(o.LivePlaylist, ext) + "_vod" + ext
+	}
+
+	// Create archiver
+	a = &LiveToVODArchiver{
+		eh:           eh,
+		o:            o,
+		p:            &liveToVODPlaylist{},
+		statSegments: astikit.NewCounterAvgStat(),
+	}
+	a.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(a), eh)
+	a.addStats()
+	return
+}
+
+func (a *LiveToVODArchiver) addStats() {
+	// Add segments
+	a.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of segments archived per second",
+		Label:       "Segments",
+		Unit:        "sps",
+	}, a.statSegments)
+}
+
+// Start starts the archiver
+func (a *LiveToVODArchiver) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	a.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure the archive is finalized
+		defer a.finalize()
+
+		// Create ticker
+		tk := time.NewTicker(a.o.Period)
+		defer tk.Stop()
+
+		// Loop
+		for {
+			select {
+			case <-tk.C:
+				a.poll(false)
+			case <-a.Context().Done():
+				return
+			}
+		}
+	})
+}
+
+func (a *LiveToVODArchiver) poll(ended bool) {
+	// Read live playlist
+	b, err := ioutil.ReadFile(a.o.LivePlaylist)
+	if err != nil {
+		// Live playlist may not have been written yet
+		if !os.IsNotExist(err) {
+			a.eh.Emit(astiencoder.EventError(a, fmt.Errorf("astilibav: reading %s failed: %w", a.o.LivePlaylist, err)))
+		}
+		if !ended {
+			return
+		}
+	} else {
+		// Parse live playlist
+		var l liveToVODPlaylist
+		if l, err = parseLiveToVODPlaylist(b); err != nil {
+			a.eh.Emit(astiencoder.EventError(a, fmt.Errorf("astilibav: parsing %s failed: %w", a.o.LivePlaylist, err)))
+			if !ended {
+				return
+			}
+		}
+
+		// Merge
+		if n := a.p.merge(l); n > 0 {
+			a.statSegments.Add(float64(n))
+		} else if !ended {
+			return
+		}
+	}
+
+	// Write VOD playlist
+	if err = writeLiveToVODFile(a.o.Playlist, a.p.bytes(ended)); err != nil {
+		a.eh.Emit(astiencoder.EventError(a, fmt.Errorf("astilibav: writing %s failed: %w", a.o.Playlist, err)))
+		return
+	}
+}
+
+func (a *LiveToVODArchiver) finalize() {
+	// Last poll
+	a.poll(true)
+
+	// Create archive
+	v := LiveToVODArchive{
+		Playlist: a.o.Playlist,
+		Segments: len(a.p.segments),
+	}
+	for _, s := range a.p.segments {
+		v.Duration += s.duration
+	}
+
+	// Remux
+	if a.o.MP4 != "" && len(a.p.segments) > 0 {
+		if _, err := Clip(a.o.Playlist, a.o.MP4, ClipOptions{FormatName: "mp4"}); err != nil {
+			a.eh.Emit(astiencoder.EventError(a, fmt.Errorf("astilibav: remuxing %s into %s failed: %w", a.o.Playlist, a.o.MP4, err)))
+		} else {
+			v.MP4 = a.o.MP4
+		}
+	}
+
+	// Send event
+	a.eh.Emit(astiencoder.Event{
+		Name:    EventNameLiveToVODArchiverDone,
+		Payload: v,
+		Target:  a,
+	})
+}
+
+// writeLiveToVODFile writes to a temporary file first so that readers never see a partial playlist
+func writeLiveToVODFile(path string, b []byte) (err error) {
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		err = fmt.Errorf("astilibav: writing %s failed: %w", tmp, err)
+		return
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		err = fmt.Errorf("astilibav: renaming %s into %s failed: %w", tmp, path, err)
+		return
+	}
+	return
+}
+
+func parseLiveToVODPlaylist(b []byte) (p liveToVODPlaylist, err error) {
+	// Loop through lines
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	var s liveToVODSegment
+	var header bool
+	var key, mapTag string
+	for sc.Scan() {
+		l := strings.TrimSpace(sc.Text())
+		switch {
+		case l == "":
+		case l == "#EXTM3U":
+			header = true
+		case strings.HasPrefix(l, "#EXT-X-VERSION:"):
+			if p.version, err = strconv.Atoi(strings.TrimPrefix(l, "#EXT-X-VERSION:")); err != nil {
+				err = fmt.Errorf("astilibav: parsing %s failed: %w", l, err)
+				return
+			}
+		case strings.HasPrefix(l, "#EXT-X-TARGETDURATION:"):
+			if p.targetDuration, err = strconv.Atoi(strings.TrimPrefix(l, "#EXT-X-TARGETDURATION:")); err != nil {
+				err = fmt.Errorf("astilibav: parsing %s failed: %w", l, err)
+				return
+			}
+		case strings.HasPrefix(l, "#EXT-X-MEDIA-SEQUENCE:"):
+			var v int
+			if v, err = strconv.Atoi(strings.TrimPrefix(l, "#EXT-X-MEDIA-SEQUENCE:")); err != nil {
+				err = fmt.Errorf("astilibav: parsing %s failed: %w", l, err)
+				return
+			}
+			p.sequence = &v
+		case l == "#EXT-X-DISCONTINUITY":
+			s.discontinuity = true
+		case strings.HasPrefix(l, "#EXT-X-KEY:"):
+			key = l
+		case strings.HasPrefix(l, "#EXT-X-MAP:"):
+			mapTag = l
+		case strings.HasPrefix(l, "#EXTINF:"):
+			v := strings.TrimPrefix(l, "#EXTINF:")
+			if i := strings.Index(v, ","); i >= 0 {
+				v = v[:i]
+			}
+			var f float64
+			if f, err = strconv.ParseFloat(v, 64); err != nil {
+				err = fmt.Errorf("astilibav: parsing %s failed: %w", l, err)
+				return
+			}
+			s.duration = time.Duration(f * float64(time.Second))
+		case strings.HasPrefix(l, "#"):
+		default:
+			s.key = key
+			s.mapTag = mapTag
+			if p.sequence != nil {
+				s.sequence = *p.sequence + len(p.segments)
+			}
+			s.uri = l
+			p.segments = append(p.segments, s)
+			s = liveToVODSegment{}
+		}
+	}
+	if err = sc.Err(); err != nil {
+		err = fmt.Errorf("astilibav: scanning failed: %w", err)
+		return
+	}
+
+	// No header
+	if !header {
+		err = errors.New("astilibav: no #EXTM3U header")
+		return
+	}
+	return
+}
+
+// merge appends the segments of the live playlist that have not been archived yet and returns their number
+func (p *liveToVODPlaylist) merge(l liveToVODPlaylist) (n int) {
+	// Update header
+	if l.targetDuration > p.targetDuration {
+		p.targetDuration = l.targetDuration
+	}
+	if l.version > p.version {
+		p.version = l.version
+	}
+
+	// Without media sequence, rely on the last archived uri
+	var from int
+	if l.sequence == nil && len(p.segments) > 0 {
+		from = len(l.segments)
+		last := p.segments[len(p.segments)-1].uri
+		for i := len(l.segments) - 1; i >= 0; i-- {
+			if l.segments[i].uri == last {
+				from = i + 1
+				break
+			}
+		}
+	}
+
+	// Append
+	for i := from; i < len(l.segments); i++ {
+		s := l.segments[i]
+		if l.sequence != nil {
+			// Segments are identified by both their uri and their sequence number so that they're not mixed up when
+			// the media sequence is reset, for instance because the live output has restarted
+			k := strconv.Itoa(s.sequence) + ":" + s.uri
+			if p.archived[k] {
+				continue
+			}
+			if p.archived == nil {
+				p.archived = make(map[string]bool)
+			}
+			p.archived[k] = true
+
+			// Media sequence has been reset
+			if len(p.segments) > 0 && s.sequence <= p.segments[len(p.segments)-1].sequence {
+				s.discontinuity = true
+			}
+		}
+		p.segments = append(p.segments, s)
+		n++
+	}
+	return
+}
+
+func (p *liveToVODPlaylist) bytes(ended bool) []byte {
+	// Header
+	buf := &bytes.Buffer{}
+	buf.WriteString("#EXTM3U\n")
+	if p.version > 0 {
+		fmt.Fprintf(buf, "#EXT-X-VERSION:%d\n", p.version)
+	}
+	fmt.Fprintf(buf, "#EXT-X-TARGETDURATION:%d\n", p.targetDuration)
+	buf.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n")
+	if ended {
+		buf.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+	} else {
+		buf.WriteString("#EXT-X-PLAYLIST-TYPE:EVENT\n")
+	}
+
+	// Segments
+	var key, mapTag string
+	for _, s := range p.segments {
+		if s.discontinuity {
+			buf.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		if s.key != key {
+			if key = s.key; key == "" {
+				buf.WriteString("#EXT-X-KEY:METHOD=NONE\n")
+			} else {
+				buf.WriteString(key + "\n")
+			}
+		}
+		if s.mapTag != mapTag && s.mapTag != "" {
+			mapTag = s.mapTag
+			buf.WriteString(mapTag + "\n")
+		}
+		fmt.Fprintf(buf, "#EXTINF:%s,\n%s\n", strconv.FormatFloat(s.duration.Seconds(), 'f', 6, 64), s.uri)
+	}
+
+	// End
+	if ended {
+		buf.WriteString("#EXT-X-ENDLIST\n")
+	}
+	return buf.Bytes()
+}
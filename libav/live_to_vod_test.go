@@ -0,0 +1,61 @@
+package astilibav
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLiveToVODPlaylist(t *testing.T) {
+	_, err := parseLiveToVODPlaylist([]byte("#EXT-X-VERSION:3\n"))
+	assert.Error(t, err)
+
+	l, err := parseLiveToVODPlaylist([]byte("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:4\n#EXT-X-MEDIA-SEQUENCE:10\n#EXTINF:4.000000,\ns10.ts\n#EXT-X-DISCONTINUITY\n#EXTINF:3.5,\ns11.ts\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, l.version)
+	assert.Equal(t, 4, l.targetDuration)
+	assert.Equal(t, 10, *l.sequence)
+	assert.Equal(t, []liveToVODSegment{
+		{duration: 4 * time.Second, sequence: 10, uri: "s10.ts"},
+		{discontinuity: true, duration: 3500 * time.Millisecond, sequence: 11, uri: "s11.ts"},
+	}, l.segments)
+
+	// Merge with media sequence
+	p := &liveToVODPlaylist{}
+	assert.Equal(t, 2, p.merge(l))
+	l, err = parseLiveToVODPlaylist([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXT-X-MEDIA-SEQUENCE:11\n#EXTINF:3.5,\ns11.ts\n#EXTINF:4,\ns12.ts\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, p.merge(l))
+	assert.Equal(t, 0, p.merge(l))
+	assert.Len(t, p.segments, 3)
+	assert.Equal(t, "s12.ts", p.segments[2].uri)
+
+	// Merge without media sequence
+	p2 := &liveToVODPlaylist{segments: []liveToVODSegment{{uri: "s11.ts"}}}
+	l.sequence = nil
+	assert.Equal(t, 1, p2.merge(l))
+	assert.Equal(t, "s12.ts", p2.segments[1].uri)
+
+	// Bytes
+	assert.Equal(t, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:4\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:EVENT\n#EXTINF:4.000000,\ns10.ts\n#EXT-X-DISCONTINUITY\n#EXTINF:3.500000,\ns11.ts\n#EXTINF:4.000000,\ns12.ts\n", string(p.bytes(false)))
+	assert.Contains(t, string(p.bytes(true)), "#EXT-X-PLAYLIST-TYPE:VOD\n")
+	assert.Contains(t, string(p.bytes(true)), "#EXT-X-ENDLIST\n")
+
+	// Media sequence reset
+	l, err = parseLiveToVODPlaylist([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXT-X-MEDIA-SEQUENCE:0\n#EXTINF:4,\ns0.ts\n#EXTINF:4,\ns11.ts\n#EXTINF:4,\ns12.ts\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, p.merge(l))
+	assert.Equal(t, 0, p.merge(l))
+	assert.Len(t, p.segments, 6)
+	assert.True(t, p.segments[3].discontinuity)
+	assert.False(t, p.segments[4].discontinuity)
+	assert.Equal(t, "s11.ts", p.segments[4].uri)
+
+	// Key and map
+	l, err = parseLiveToVODPlaylist([]byte("#EXTM3U\n#EXT-X-VERSION:7\n#EXT-X-TARGETDURATION:4\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXT-X-KEY:METHOD=AES-128,URI=\"k1\"\n#EXTINF:4,\ns0.m4s\n#EXTINF:4,\ns1.m4s\n#EXT-X-KEY:METHOD=NONE\n#EXTINF:4,\ns2.m4s\n"))
+	assert.NoError(t, err)
+	p = &liveToVODPlaylist{}
+	assert.Equal(t, 3, p.merge(l))
+	assert.Equal(t, "#EXTM3U\n#EXT-X-VERSION:7\n#EXT-X-TARGETDURATION:4\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:EVENT\n#EXT-X-KEY:METHOD=AES-128,URI=\"k1\"\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:4.000000,\ns0.m4s\n#EXTINF:4.000000,\ns1.m4s\n#EXT-X-KEY:METHOD=NONE\n#EXTINF:4.000000,\ns2.m4s\n", string(p.bytes(false)))
+}
@@ -0,0 +1,282 @@
+package astilibav
+
+import (
+	"math"
+	"sort"
+)
+
+// EBU R128 gating values
+const (
+	loudnessAbsoluteGate           = -70
+	loudnessIntegratedRelativeGate = -10
+	loudnessRangeHighPercentile    = 0.95
+	loudnessRangeLowPercentile     = 0.1
+	loudnessRangeRelativeGate      = -20
+)
+
+// True peak oversampling values
+const (
+	loudnessTruePeakFactor = 4
+	loudnessTruePeakTaps   = 12
+)
+
+// loudnessMeasurer measures loudness as described in ITU-R BS.1770 and EBU Tech 3342
+// Samples are split in 100ms sub blocks: momentary blocks last 4 sub blocks and short term blocks last 30 sub blocks
+type loudnessMeasurer struct {
+	channels      []*loudnessChannel
+	momentary     []float64
+	shortTerm     []float64
+	subBlockSize  int
+	subBlocks     []float64
+	subBlockCount int
+	samples       int
+	taps          [loudnessTruePeakFactor][loudnessTruePeakTaps]float64
+	truePeak      float64
+}
+
+type loudnessChannel struct {
+	history  [loudnessTruePeakTaps]float64
+	sum      float64
+	weight   float64
+	weighter *loudnessKWeighter
+}
+
+// loudnessKWeighter is the K weighting filter: a high shelf followed by a high pass
+type loudnessKWeighter struct {
+	stages [2]*loudnessBiquad
+}
+
+type loudnessBiquad struct {
+	a1, a2, b0, b1, b2 float64
+	z1, z2             float64
+}
+
+func newLoudnessMeasurer(channels, sampleRate int) *loudnessMeasurer {
+	m := &loudnessMeasurer{subBlockSize: sampleRate / 10}
+	if m.subBlockSize <= 0 {
+		m.subBlockSize = 1
+	}
+
+	// Create channels
+	for idx := 0; idx < channels; idx++ {
+		m.channels = append(m.channels, &loudnessChannel{
+			weight:   loudnessChannelWeight(idx, channels),
+			weighter: newLoudnessKWeighter(float64(sampleRate)),
+		})
+	}
+
+	// Create true peak interpolation taps
+	// They are a Hann windowed sinc split in as many phases as the oversampling factor
+	n := loudnessTruePeakFactor * loudnessTruePeakTaps
+	for idx := 0; idx < n; idx++ {
+		x := float64(idx-n/2) / loudnessTruePeakFactor
+		v := 1.0
+		if x != 0 {
+			v = math.Sin(math.Pi*x) / (math.Pi * x)
+		}
+		v *= 0.5 * (1 - math.Cos(2*math.Pi*float64(idx)/float64(n)))
+		m.taps[idx%loudnessTruePeakFactor][idx/loudnessTruePeakFactor] = v
+	}
+	return m
+}
+
+// loudnessChannelWeight assumes the 5.1 channel order when there are 6 channels, in which case the LFE is excluded
+// and surround channels are boosted
+func loudnessChannelWeight(idx, channels int) float64 {
+	if channels == 6 {
+		switch idx {
+		case 3:
+			return 0
+		case 4, 5:
+			return 1.41
+		}
+	}
+	return 1
+}
+
+// Coefficients are computed for the sample rate so that they match the ones of ITU-R BS.1770 at 48kHz
+func newLoudnessKWeighter(sampleRate float64) *loudnessKWeighter {
+	// High shelf
+	k := math.Tan(math.Pi * 1681.974450955533 / sampleRate)
+	q := 0.7071752369554196
+	vh := math.Pow(10, 3.999843853973347/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	hs := &loudnessBiquad{
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+	}
+
+	// High pass
+	k = math.Tan(math.Pi * 38.13547087602444 / sampleRate)
+	q = 0.5003270373238773
+	a0 = 1 + k/q + k*k
+	hp := &loudnessBiquad{
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+		b0: 1,
+		b1: -2,
+		b2: 1,
+	}
+	return &loudnessKWeighter{stages: [2]*loudnessBiquad{hs, hp}}
+}
+
+func (w *loudnessKWeighter) process(x float64) float64 {
+	for _, s := range w.stages {
+		x = s.process(x)
+	}
+	return x
+}
+
+// Transposed direct form II
+func (b *loudnessBiquad) process(x float64) (y float64) {
+	y = b.b0*x + b.z1
+	b.z1 = b.b1*x - b.a1*y + b.z2
+	b.z2 = b.b2*x - b.a2*y
+	return
+}
+
+// add adds interleaved samples normalized between -1 and 1
+func (m *loudnessMeasurer) add(samples []float64) {
+	for idx := 0; idx+len(m.channels) <= len(samples); idx += len(m.channels) {
+		for ic, c := range m.channels {
+			// Update true peak
+			v := samples[idx+ic]
+			copy(c.history[1:], c.history[:loudnessTruePeakTaps-1])
+			c.history[0] = v
+			for _, taps := range m.taps {
+				var p float64
+				for it, t := range taps {
+					p += t * c.history[it]
+				}
+				if p = math.Abs(p); p > m.truePeak {
+					m.truePeak = p
+				}
+			}
+
+			// Update sum
+			f := c.weighter.process(v)
+			c.sum += f * f
+		}
+
+		// Sub block is complete
+		if m.subBlockCount++; m.subBlockCount >= m.subBlockSize {
+			m.addSubBlock()
+		}
+		m.samples++
+	}
+}
+
+func (m *loudnessMeasurer) addSubBlock() {
+	// Get weighted power
+	var p float64
+	for _, c := range m.channels {
+		p += c.weight * c.sum / float64(m.subBlockCount)
+		c.sum = 0
+	}
+	m.subBlockCount = 0
+
+	// Keep the last 30 sub blocks
+	m.subBlocks = append(m.subBlocks, p)
+	if len(m.subBlocks) > 30 {
+		m.subBlocks = m.subBlocks[1:]
+	}
+
+	// Add blocks
+	if len(m.subBlocks) >= 4 {
+		m.momentary = append(m.momentary, loudnessMean(m.subBlocks[len(m.subBlocks)-4:]))
+	}
+	if len(m.subBlocks) >= 30 {
+		m.shortTerm = append(m.shortTerm, loudnessMean(m.subBlocks))
+	}
+}
+
+func loudnessMean(ps []float64) (p float64) {
+	for _, v := range ps {
+		p += v
+	}
+	return p / float64(len(ps))
+}
+
+func loudnessFromPower(p float64) float64 {
+	if p <= 0 {
+		return math.Inf(-1)
+	}
+	return -0.691 + 10*math.Log10(p)
+}
+
+func loudnessToPower(l float64) float64 {
+	return math.Pow(10, (l+0.691)/10)
+}
+
+// loudnessGate returns the powers above the absolute gate and above the relative gate, itself relative to the
+// mean power of the powers above the absolute gate
+func loudnessGate(ps []float64, relativeGate float64) (o []float64) {
+	// Absolute gate
+	var a []float64
+	for _, p := range ps {
+		if p > loudnessToPower(loudnessAbsoluteGate) {
+			a = append(a, p)
+		}
+	}
+	if len(a) == 0 {
+		return
+	}
+
+	// Relative gate
+	t := loudnessMean(a) * math.Pow(10, relativeGate/10)
+	for _, p := range a {
+		if p > t {
+			o = append(o, p)
+		}
+	}
+	return
+}
+
+// integrated returns the integrated loudness in LUFS
+func (m *loudnessMeasurer) integrated() float64 {
+	ps := loudnessGate(m.momentary, loudnessIntegratedRelativeGate)
+	if len(ps) == 0 {
+		return math.Inf(-1)
+	}
+	return loudnessFromPower(loudnessMean(ps))
+}
+
+// loudnessRange returns the loudness range in LU
+func (m *loudnessMeasurer) loudnessRange() float64 {
+	// Gate
+	ps := loudnessGate(m.shortTerm, loudnessRangeRelativeGate)
+	if len(ps) == 0 {
+		return 0
+	}
+
+	// Get percentiles
+	sort.Float64s(ps)
+	percentile := func(v float64) float64 {
+		return loudnessFromPower(ps[int(math.Round(float64(len(ps)-1)*v))])
+	}
+	return percentile(loudnessRangeHighPercentile) - percentile(loudnessRangeLowPercentile)
+}
+
+// truePeakLevel returns the true peak in dBTP
+func (m *loudnessMeasurer) truePeakLevel() float64 {
+	if m.truePeak <= 0 {
+		return math.Inf(-1)
+	}
+	return 20 * math.Log10(m.truePeak)
+}
+
+// shortTermLoudness returns the loudness of the last 3s in LUFS, or of the last 400ms if less than 3s have been
+// measured
+func (m *loudnessMeasurer) shortTermLoudness() float64 {
+	if len(m.shortTerm) > 0 {
+		return loudnessFromPower(m.shortTerm[len(m.shortTerm)-1])
+	}
+	if len(m.momentary) > 0 {
+		return loudnessFromPower(m.momentary[len(m.momentary)-1])
+	}
+	return math.Inf(-1)
+}
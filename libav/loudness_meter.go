@@ -0,0 +1,200 @@
+package astilibav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+)
+
+var countLoudnessMeter uint64
+
+// Default loudness meter values, as recommended by EBU R128
+const (
+	defaultLoudnessMeterIntegratedTarget    = -23
+	defaultLoudnessMeterIntegratedTolerance = 1
+	defaultLoudnessMeterMaxTruePeak         = -1
+)
+
+// LoudnessMeter represents an object capable of measuring the loudness of the whole program as described in EBU R128
+// Once stopped, it emits a report stating whether the program complies with the targets
+type LoudnessMeter struct {
+	*astiencoder.BaseNode
+	c                *astikit.Chan
+	eh               *astiencoder.EventHandler
+	m                *loudnessMeasurer
+	o                LoudnessMeterOptions
+	statIncomingRate *astikit.CounterAvgStat
+	statWorkRatio    *astikit.DurationPercentageStat
+}
+
+// LoudnessMeterOptions represents loudness meter options
+type LoudnessMeterOptions struct {
+	// Context of the incoming frames. Only Channels and SampleRate are used
+	// When there are 6 channels, they are assumed to be in the 5.1 order
+	Context Context
+	// Integrated loudness target in LUFS. Defaults to -23
+	IntegratedTarget float64
+	// Integrated loudness tolerance in LU. Defaults to 1
+	IntegratedTolerance float64
+	// If > 0, loudness range in LU above which the program doesn't comply
+	MaxLRA float64
+	// True peak in dBTP above which the program doesn't comply. Defaults to -1
+	MaxTruePeak float64
+	Node        astiencoder.NodeOptions
+}
+
+// LoudnessReport represents a loudness report
+// Levels are floored at -70 which is what silence is reported as
+type LoudnessReport struct {
+	Compliant bool
+	Duration  time.Duration
+	// In LUFS
+	Integrated float64
+	// In LU
+	LRA float64
+	// In dBTP
+	TruePeak   float64
+	Violations []string
+}
+
+// NewLoudnessMeter creates a new loudness meter
+func NewLoudnessMeter(o LoudnessMeterOptions, eh *astiencoder.EventHandler) (m *LoudnessMeter, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countLoudnessMeter, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("loudness_meter_%d", count), fmt.Sprintf("Loudness Meter #%d", count), "Measures loudness")
+
+	// No channels
+	if o.Context.Channels <= 0 {
+		err = errors.New("astilibav: no channels provided")
+		return
+	}
+
+	// No sample rate
+	if o.Context.SampleRate <= 0 {
+		err = errors.New("astilibav: no sample rate provided")
+		return
+	}
+
+	// Default values
+	if o.IntegratedTarget == 0 {
+		o.IntegratedTarget = defaultLoudnessMeterIntegratedTarget
+	}
+	if o.IntegratedTolerance <= 0 {
+		o.IntegratedTolerance = defaultLoudnessMeterIntegratedTolerance
+	}
+	if o.MaxTruePeak == 0 {
+		o.MaxTruePeak = defaultLoudnessMeterMaxTruePeak
+	}
+
+	// Create loudness meter
+	m = &LoudnessMeter{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh:               eh,
+		m:                newLoudnessMeasurer(o.Context.Channels, o.Context.SampleRate),
+		o:                o,
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statWorkRatio:    astikit.NewDurationPercentageStat(),
+	}
+	m.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(m), eh)
+	m.addStats()
+
+	return
+}
+
+func (m *LoudnessMeter) addStats() {
+	// Add incoming rate
+	m.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of frames coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "fps",
+	}, m.statIncomingRate)
+
+	// Add work ratio
+	m.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, m.statWorkRatio)
+
+	// Add chan stats
+	m.c.AddStats(m.Stater())
+}
+
+// Start starts the loudness meter
+func (m *LoudnessMeter) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	m.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to send the report
+		defer m.report()
+
+		// Make sure to stop the chan properly
+		defer m.c.Stop()
+
+		// Start chan
+		m.c.Start(m.Context())
+	})
+}
+
+// HandleFrame implements the FrameHandler interface
+func (m *LoudnessMeter) HandleFrame(p *FrameHandlerPayload) {
+	m.c.Add(func() {
+		// Handle pause
+		defer m.HandlePause()
+
+		// Increment incoming rate
+		m.statIncomingRate.Add(1)
+
+		// Get samples
+		s, err := frameExporterSamples(p.Frame)
+		if err != nil {
+			m.eh.Emit(astiencoder.EventError(m, fmt.Errorf("astilibav: getting samples failed: %w", err)))
+			return
+		}
+
+		// Measure
+		m.statWorkRatio.Begin()
+		m.m.add(s)
+		m.statWorkRatio.End()
+	})
+}
+
+func (m *LoudnessMeter) report() {
+	m.eh.Emit(astiencoder.Event{
+		Name:    EventNameLoudnessMeterReport,
+		Payload: newLoudnessReport(m.m, m.o),
+		Target:  m,
+	})
+}
+
+func newLoudnessReport(m *loudnessMeasurer, o LoudnessMeterOptions) (r LoudnessReport) {
+	// Create report
+	r = LoudnessReport{
+		Integrated: math.Max(m.integrated(), loudnessAbsoluteGate),
+		LRA:        m.loudnessRange(),
+		TruePeak:   math.Max(m.truePeakLevel(), loudnessAbsoluteGate),
+	}
+	if o.Context.SampleRate > 0 {
+		r.Duration = time.Duration(float64(m.samples) / float64(o.Context.SampleRate) * 1e9)
+	}
+
+	// Check compliance
+	if math.Abs(r.Integrated-o.IntegratedTarget) > o.IntegratedTolerance {
+		r.Violations = append(r.Violations, fmt.Sprintf("integrated loudness %.1f LUFS is not within %.1f LU of %.1f LUFS", r.Integrated, o.IntegratedTolerance, o.IntegratedTarget))
+	}
+	if r.TruePeak > o.MaxTruePeak {
+		r.Violations = append(r.Violations, fmt.Sprintf("true peak %.1f dBTP is above %.1f dBTP", r.TruePeak, o.MaxTruePeak))
+	}
+	if o.MaxLRA > 0 && r.LRA > o.MaxLRA {
+		r.Violations = append(r.Violations, fmt.Sprintf("loudness range %.1f LU is above %.1f LU", r.LRA, o.MaxLRA))
+	}
+	r.Compliant = len(r.Violations) == 0
+	return
+}
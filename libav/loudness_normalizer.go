@@ -0,0 +1,373 @@
+package astilibav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+)
+
+var countLoudnessNormalizer uint64
+
+// Default loudness normalizer values
+const (
+	defaultLoudnessNormalizerMaxGain      = 12
+	defaultLoudnessNormalizerReportPeriod = 10 * time.Second
+	defaultLoudnessNormalizerSmoothing    = 3 * time.Second
+)
+
+// Passages whose loudness is this far below the target, such as silences, don't update the gain so that noise is not
+// boosted
+const loudnessNormalizerHoldThreshold = -20
+
+// LoudnessNormalizer represents an object capable of normalizing the loudness of frames in one pass, as described in
+// EBU R128
+// It acts as a gain rider: the gain slowly follows the difference between the target and the short term loudness
+// and is reduced whenever it would push the sample peak of a frame above the max true peak
+// Frames whose sample format is not supported are forwarded untouched
+type LoudnessNormalizer struct {
+	*astiencoder.BaseNode
+	c                *astikit.Chan
+	d                *frameDispatcher
+	eh               *astiencoder.EventHandler
+	g                *loudnessNormalizerGain
+	in               *loudnessMeasurer
+	o                LoudnessNormalizerOptions
+	out              *loudnessMeasurer
+	p                *framePool
+	reportSamples    int
+	statGain         *loudnessNormalizerGainStat
+	statIncomingRate *astikit.CounterAvgStat
+	statWorkRatio    *astikit.DurationPercentageStat
+}
+
+// LoudnessNormalizerOptions represents loudness normalizer options
+type LoudnessNormalizerOptions struct {
+	// Context of the incoming frames. Only Channels and SampleRate are used
+	// When there are 6 channels, they are assumed to be in the 5.1 order
+	Context Context
+	// Integrated loudness target in LUFS. Defaults to -23
+	IntegratedTarget float64
+	// Max absolute gain in dB. Defaults to 12
+	MaxGain float64
+	// Max true peak in dBTP. Defaults to -1
+	MaxTruePeak float64
+	Node        astiencoder.NodeOptions
+	// Media duration between 2 reports. Defaults to 10s
+	ReportPeriod time.Duration
+	// Time it takes for the gain to follow loudness changes. Defaults to 3s
+	Smoothing time.Duration
+}
+
+// LoudnessNormalizerReport represents a loudness normalizer report
+type LoudnessNormalizerReport struct {
+	// Current gain in dB
+	Gain float64
+	// Loudness of the incoming frames
+	Input LoudnessReport
+	// Loudness of the dispatched frames, whose compliance is checked against the options
+	Output LoudnessReport
+}
+
+// NewLoudnessNormalizer creates a new loudness normalizer
+func NewLoudnessNormalizer(o LoudnessNormalizerOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (n *LoudnessNormalizer, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countLoudnessNormalizer, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("loudness_normalizer_%d", count), fmt.Sprintf("Loudness Normalizer #%d", count), "Normalizes loudness")
+
+	// No channels
+	if o.Context.Channels <= 0 {
+		err = errors.New("astilibav: no channels provided")
+		return
+	}
+
+	// No sample rate
+	if o.Context.SampleRate <= 0 {
+		err = errors.New("astilibav: no sample rate provided")
+		return
+	}
+
+	// Default values
+	if o.IntegratedTarget == 0 {
+		o.IntegratedTarget = defaultLoudnessMeterIntegratedTarget
+	}
+	if o.MaxGain <= 0 {
+		o.MaxGain = defaultLoudnessNormalizerMaxGain
+	}
+	if o.MaxTruePeak == 0 {
+		o.MaxTruePeak = defaultLoudnessMeterMaxTruePeak
+	}
+	if o.ReportPeriod <= 0 {
+		o.ReportPeriod = defaultLoudnessNormalizerReportPeriod
+	}
+	if o.Smoothing <= 0 {
+		o.Smoothing = defaultLoudnessNormalizerSmoothing
+	}
+
+	// Create loudness normalizer
+	n = &LoudnessNormalizer{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh: eh,
+		g: &loudnessNormalizerGain{
+			maxGain:   o.MaxGain,
+			smoothing: o.Smoothing,
+			target:    o.IntegratedTarget,
+		},
+		in:               newLoudnessMeasurer(o.Context.Channels, o.Context.SampleRate),
+		o:                o,
+		out:              newLoudnessMeasurer(o.Context.Channels, o.Context.SampleRate),
+		p:                newFramePool(c),
+		statGain:         newLoudnessNormalizerGainStat(),
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statWorkRatio:    astikit.NewDurationPercentageStat(),
+	}
+	n.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(n), eh)
+	n.d = newFrameDispatcher(n, eh, c)
+	n.addStats()
+	return
+}
+
+func (n *LoudnessNormalizer) addStats() {
+	// Add incoming rate
+	n.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of frames coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "fps",
+	}, n.statIncomingRate)
+
+	// Add gain
+	n.Stater().AddStat(astikit.StatMetadata{
+		Description: "Gain applied to the last frame",
+		Label:       "Gain",
+		Unit:        "dB",
+	}, n.statGain)
+
+	// Add work ratio
+	n.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, n.statWorkRatio)
+
+	// Add dispatcher stats
+	n.d.addStats(n.Stater())
+
+	// Add chan stats
+	n.c.AddStats(n.Stater())
+}
+
+// Connect implements the FrameHandlerConnector interface
+func (n *LoudnessNormalizer) Connect(h FrameHandler) {
+	// Add handler
+	n.d.addHandler(h)
+
+	// Connect nodes
+	astiencoder.ConnectNodes(n, h)
+}
+
+// Disconnect implements the FrameHandlerConnector interface
+func (n *LoudnessNormalizer) Disconnect(h FrameHandler) {
+	// Delete handler
+	n.d.delHandler(h)
+
+	// Disconnect nodes
+	astiencoder.DisconnectNodes(n, h)
+}
+
+// Start starts the loudness normalizer
+func (n *LoudnessNormalizer) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	n.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to wait for all dispatcher subprocesses to be done so that they are properly closed
+		defer n.d.wait()
+
+		// Make sure to send the last report
+		defer n.report()
+
+		// Make sure to stop the chan properly
+		defer n.c.Stop()
+
+		// Start chan
+		n.c.Start(n.Context())
+	})
+}
+
+// HandleEOS implements the EOSHandler interface
+func (n *LoudnessNormalizer) HandleEOS(p *EOSHandlerPayload) {
+	n.c.Add(func() {
+		// Forward end of stream
+		n.d.dispatchEOS()
+	})
+}
+
+// HandleFrame implements the FrameHandler interface
+func (n *LoudnessNormalizer) HandleFrame(p *FrameHandlerPayload) {
+	n.c.Add(func() {
+		// Handle pause
+		defer n.HandlePause()
+
+		// Increment incoming rate
+		n.statIncomingRate.Add(1)
+
+		// Get samples
+		s, err := frameExporterSamples(p.Frame)
+		if err != nil {
+			// Frames whose sample format is not supported are forwarded untouched
+			n.d.dispatch(p.Frame, p.Descriptor, p.Metadata)
+			return
+		}
+
+		// No samples
+		if len(s) == 0 {
+			return
+		}
+
+		// Copy frame
+		f := n.p.get()
+		defer n.p.put(f)
+		if ret := defaultBindings.frameRef(f, p.Frame); ret < 0 {
+			emitAvError(n, n.eh, ret, "avutil.AvFrameRef failed")
+			return
+		}
+
+		// Since data is shared with the other handlers of the previous node, it must be copied before being updated
+		if ret := avutil.AvFrameMakeWritable(f); ret < 0 {
+			emitAvError(n, n.eh, ret, "avutil.AvFrameMakeWritable failed")
+			return
+		}
+
+		// Measure input
+		n.statWorkRatio.Begin()
+		n.in.add(s)
+
+		// Update gain
+		d := time.Duration(float64(p.Frame.NbSamples()) / float64(n.o.Context.SampleRate) * 1e9)
+		g := n.g.update(n.in.shortTermLoudness(), d)
+
+		// Apply gain
+		n.statGain.set(loudnessNormalizerApply(s, g, n.o.MaxTruePeak))
+		if err = frameExporterSetSamples(f, s); err != nil {
+			n.statWorkRatio.End()
+			n.eh.Emit(astiencoder.EventError(n, fmt.Errorf("astilibav: setting samples failed: %w", err)))
+			return
+		}
+
+		// Measure output
+		n.out.add(s)
+		n.statWorkRatio.End()
+
+		// Dispatch frame
+		n.d.dispatch(f, p.Descriptor, p.Metadata)
+
+		// Report
+		if n.reportSamples += p.Frame.NbSamples(); n.reportSamples >= int(n.o.ReportPeriod.Seconds()*float64(n.o.Context.SampleRate)) {
+			n.report()
+		}
+	})
+}
+
+func (n *LoudnessNormalizer) report() {
+	// Reset
+	n.reportSamples = 0
+
+	// Emit
+	o := LoudnessMeterOptions{
+		Context:             n.o.Context,
+		IntegratedTarget:    n.o.IntegratedTarget,
+		IntegratedTolerance: defaultLoudnessMeterIntegratedTolerance,
+		MaxTruePeak:         n.o.MaxTruePeak,
+	}
+	n.eh.Emit(astiencoder.Event{
+		Name: EventNameLoudnessNormalizerReport,
+		Payload: LoudnessNormalizerReport{
+			Gain:   n.g.current,
+			Input:  newLoudnessReport(n.in, o),
+			Output: newLoudnessReport(n.out, o),
+		},
+		Target: n,
+	})
+}
+
+// loudnessNormalizerGain keeps track of the gain in dB
+type loudnessNormalizerGain struct {
+	current   float64
+	maxGain   float64
+	smoothing time.Duration
+	target    float64
+}
+
+// update moves the gain towards the one bringing the loudness to the target, d being the duration since the last
+// update
+func (g *loudnessNormalizerGain) update(loudness float64, d time.Duration) float64 {
+	// Hold gain
+	if math.IsInf(loudness, 0) || loudness < g.target+loudnessNormalizerHoldThreshold {
+		return g.current
+	}
+
+	// Get desired gain
+	desired := math.Max(-g.maxGain, math.Min(g.maxGain, g.target-loudness))
+
+	// Smooth
+	g.current += (desired - g.current) * math.Min(1, float64(d)/float64(g.smoothing))
+	return g.current
+}
+
+// loudnessNormalizerApply applies the gain in dB to the interleaved normalized samples and returns the applied gain,
+// which may be lower so that the sample peak doesn't go above the max peak in dBTP
+func loudnessNormalizerApply(s []float64, gain, maxPeak float64) float64 {
+	// Get peak
+	var peak float64
+	for _, v := range s {
+		peak = math.Max(peak, math.Abs(v))
+	}
+
+	// Limit gain
+	l := math.Pow(10, gain/20)
+	if max := math.Pow(10, maxPeak/20); peak*l > max {
+		l = max / peak
+		gain = 20 * math.Log10(l)
+	}
+
+	// Apply gain
+	for idx := range s {
+		s[idx] *= l
+	}
+	return gain
+}
+
+type loudnessNormalizerGainStat struct {
+	g float64
+	m *sync.Mutex
+}
+
+func newLoudnessNormalizerGainStat() *loudnessNormalizerGainStat {
+	return &loudnessNormalizerGainStat{m: &sync.Mutex{}}
+}
+
+func (s *loudnessNormalizerGainStat) set(g float64) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.g = g
+}
+
+// Start implements the astikit.StatHandler interface
+func (s *loudnessNormalizerGainStat) Start() {}
+
+// Stop implements the astikit.StatHandler interface
+func (s *loudnessNormalizerGainStat) Stop() {}
+
+// Value implements the astikit.StatHandler interface
+func (s *loudnessNormalizerGainStat) Value(delta time.Duration) interface{} {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.g
+}
@@ -0,0 +1,42 @@
+package astilibav
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoudnessNormalizerGain(t *testing.T) {
+	g := &loudnessNormalizerGain{
+		maxGain:   12,
+		smoothing: 3 * time.Second,
+		target:    -23,
+	}
+
+	// Silence holds the gain
+	assert.Equal(t, 0.0, g.update(math.Inf(-1), time.Second))
+	assert.Equal(t, 0.0, g.update(-50, time.Second))
+
+	// Gain is smoothed
+	assert.InDelta(t, -1, g.update(-20, time.Second), 0.001)
+	assert.InDelta(t, -3, g.update(-20, 10*time.Second), 0.001)
+
+	// Gain is clamped
+	assert.InDelta(t, 12, g.update(-40, 10*time.Second), 0.001)
+	assert.InDelta(t, -12, g.update(0, 10*time.Second), 0.001)
+}
+
+func TestLoudnessNormalizerApply(t *testing.T) {
+	s := []float64{0.1, -0.1}
+	assert.InDelta(t, 6, loudnessNormalizerApply(s, 6, -1), 0.001)
+	assert.InDelta(t, 0.1995, s[0], 0.0001)
+	assert.InDelta(t, -0.1995, s[1], 0.0001)
+
+	// Gain is limited by the peak
+	s = []float64{0.5, 0.25}
+	g := loudnessNormalizerApply(s, 12, -1)
+	assert.InDelta(t, 20*math.Log10(math.Pow(10, -1.0/20)/0.5), g, 0.001)
+	assert.InDelta(t, math.Pow(10, -1.0/20), s[0], 0.0001)
+}
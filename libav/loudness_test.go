@@ -0,0 +1,69 @@
+package astilibav
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func loudnessTestSine(m *loudnessMeasurer, amplitude float64, d, sampleRate int) {
+	s := make([]float64, d*sampleRate)
+	for idx := range s {
+		s[idx] = amplitude * math.Sin(2*math.Pi*997*float64(idx)/float64(sampleRate))
+	}
+	m.add(s)
+}
+
+func TestLoudnessMeasurer(t *testing.T) {
+	// Silence
+	m := newLoudnessMeasurer(1, 48000)
+	m.add(make([]float64, 48000))
+	assert.True(t, math.IsInf(m.integrated(), -1))
+	assert.Equal(t, 0.0, m.loudnessRange())
+	assert.True(t, math.IsInf(m.truePeakLevel(), -1))
+
+	// A 997Hz sine at -20dBFS on a single channel is at -23 LUFS
+	m = newLoudnessMeasurer(1, 48000)
+	loudnessTestSine(m, 0.1, 10, 48000)
+	assert.InDelta(t, -23, m.integrated(), 0.1)
+	assert.InDelta(t, 0, m.loudnessRange(), 0.1)
+	assert.InDelta(t, -20, m.truePeakLevel(), 0.1)
+
+	// Loudness range
+	m = newLoudnessMeasurer(1, 44100)
+	loudnessTestSine(m, 0.1, 20, 44100)
+	loudnessTestSine(m, 0.01, 20, 44100)
+	assert.InDelta(t, 20, m.loudnessRange(), 0.5)
+
+	// Quiet part is below the relative gate
+	assert.InDelta(t, -23, m.integrated(), 0.1)
+}
+
+func TestNewLoudnessReport(t *testing.T) {
+	o := LoudnessMeterOptions{
+		Context:             Context{SampleRate: 48000},
+		IntegratedTarget:    -23,
+		IntegratedTolerance: 1,
+		MaxTruePeak:         -1,
+	}
+	m := newLoudnessMeasurer(1, 48000)
+	loudnessTestSine(m, 0.1, 10, 48000)
+	r := newLoudnessReport(m, o)
+	assert.True(t, r.Compliant)
+	assert.Equal(t, 10*time.Second, r.Duration)
+	assert.Empty(t, r.Violations)
+
+	o.MaxTruePeak = -30
+	r = newLoudnessReport(m, o)
+	assert.False(t, r.Compliant)
+	assert.Len(t, r.Violations, 1)
+
+	m = newLoudnessMeasurer(1, 48000)
+	m.add(make([]float64, 48000))
+	r = newLoudnessReport(m, o)
+	assert.Equal(t, -70.0, r.Integrated)
+	assert.Equal(t, -70.0, r.TruePeak)
+	assert.Len(t, r.Violations, 1)
+}
@@ -0,0 +1,144 @@
+package astilibav
+
+//#cgo pkg-config: libavcodec libavformat libavutil
+//#include <stdlib.h>
+//#include <string.h>
+//#include <libavcodec/avcodec.h>
+//#include <libavformat/avformat.h>
+//#include <libavutil/dict.h>
+//#include <libavutil/mem.h>
+import "C"
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avformat"
+	"github.com/asticode/goav/avutil"
+)
+
+// Attachment represents a file attached to an output, such as a font used by ASS subtitles or a thumbnail
+// It is only supported by formats handling attachments such as matroska
+type Attachment struct {
+	// Optional if mime type is provided
+	CodecID  avcodec.CodecId
+	Data     []byte
+	Filename string
+	// Optional if codec id is provided
+	MimeType string
+}
+
+func setDictEntry(d **C.AVDictionary, key, value string) (err error) {
+	// Create c strings
+	ck, cv := C.CString(key), C.CString(value)
+	defer C.free(unsafe.Pointer(ck))
+	defer C.free(unsafe.Pointer(cv))
+
+	// Set entry
+	if ret := C.av_dict_set(d, ck, cv, 0); ret < 0 {
+		err = fmt.Errorf("astilibav: av_dict_set failed: %w", NewAvError(int(ret)))
+		return
+	}
+	return
+}
+
+// newDict parses an ffmpeg-like string of options and adds the entries of the map, which override the parsed ones
+func newDict(s string, entries map[string]string) (d *avutil.Dictionary, err error) {
+	// Parse dict
+	// We need to create an intermediate variable to avoid "cgo argument has Go pointer to Go pointer" errors
+	var dict *avutil.Dictionary
+	if len(s) > 0 {
+		if ret := avutil.AvDictParseString(&dict, s, "=", ",", 0); ret < 0 {
+			err = fmt.Errorf("astilibav: avutil.AvDictParseString on %s failed: %w", s, NewAvError(ret))
+			return
+		}
+	}
+
+	// Add dictionary entries
+	for k, v := range entries {
+		if ret := avutil.AvDictSet(&dict, k, v, 0); ret < 0 {
+			avutil.AvDictFree(&dict)
+			err = fmt.Errorf("astilibav: avutil.AvDictSet on %s=%s failed: %w", k, v, NewAvError(ret))
+			return
+		}
+	}
+	d = dict
+	return
+}
+
+// dictEntries returns nil if the dict is empty
+func dictEntries(d *avutil.Dictionary) map[string]string {
+	return probeMetadata((*C.AVDictionary)(unsafe.Pointer(d)))
+}
+
+func setFormatMetadata(ctxFormat *avformat.Context, key, value string) error {
+	return setDictEntry(&(*C.struct_AVFormatContext)(unsafe.Pointer(ctxFormat)).metadata, key, value)
+}
+
+func setStreamMetadata(s *avformat.Stream, key, value string) error {
+	return setDictEntry(&(*C.struct_AVStream)(unsafe.Pointer(s)).metadata, key, value)
+}
+
+// copyMetadata copies the global and per-stream tags of a format ctx to another one with the same streams
+func copyMetadata(dst, src *avformat.Context) (err error) {
+	// Copy global tags
+	cd, cs := (*C.struct_AVFormatContext)(unsafe.Pointer(dst)), (*C.struct_AVFormatContext)(unsafe.Pointer(src))
+	if ret := C.av_dict_copy(&cd.metadata, cs.metadata, 0); ret < 0 {
+		err = fmt.Errorf("astilibav: av_dict_copy failed: %w", NewAvError(int(ret)))
+		return
+	}
+
+	// Copy per-stream tags
+	ds, ss := dst.Streams(), src.Streams()
+	for idx := 0; idx < len(ds) && idx < len(ss); idx++ {
+		d, s := (*C.struct_AVStream)(unsafe.Pointer(ds[idx])), (*C.struct_AVStream)(unsafe.Pointer(ss[idx]))
+		if ret := C.av_dict_copy(&d.metadata, s.metadata, 0); ret < 0 {
+			err = fmt.Errorf("astilibav: av_dict_copy on stream %d failed: %w", idx, NewAvError(int(ret)))
+			return
+		}
+	}
+	return
+}
+
+func addAttachmentStream(ctxFormat *avformat.Context, a Attachment) (s *avformat.Stream, err error) {
+	// Check attachment
+	if len(a.Data) == 0 {
+		err = errors.New("astilibav: no data provided")
+		return
+	} else if len(a.Filename) == 0 {
+		err = errors.New("astilibav: no filename provided")
+		return
+	} else if a.CodecID == 0 && len(a.MimeType) == 0 {
+		err = errors.New("astilibav: neither codec id nor mime type provided")
+		return
+	}
+
+	// Add stream
+	s = AddStream(ctxFormat)
+	cs := (*C.struct_AVStream)(unsafe.Pointer(s))
+	cs.codecpar.codec_type = C.enum_AVMediaType(C.AVMEDIA_TYPE_ATTACHMENT)
+	cs.codecpar.codec_id = C.enum_AVCodecID(a.CodecID)
+
+	// Set extradata
+	// Data is padded as expected by ffmpeg
+	if cs.codecpar.extradata = (*C.uint8_t)(C.av_mallocz(C.size_t(len(a.Data) + C.AV_INPUT_BUFFER_PADDING_SIZE))); cs.codecpar.extradata == nil {
+		err = errors.New("astilibav: allocating extradata failed")
+		return
+	}
+	C.memcpy(unsafe.Pointer(cs.codecpar.extradata), unsafe.Pointer(&a.Data[0]), C.size_t(len(a.Data)))
+	cs.codecpar.extradata_size = C.int(len(a.Data))
+
+	// Set metadata
+	if err = setStreamMetadata(s, "filename", a.Filename); err != nil {
+		err = fmt.Errorf("astilibav: setting filename failed: %w", err)
+		return
+	}
+	if len(a.MimeType) > 0 {
+		if err = setStreamMetadata(s, "mimetype", a.MimeType); err != nil {
+			err = fmt.Errorf("astilibav: setting mimetype failed: %w", err)
+			return
+		}
+	}
+	return
+}
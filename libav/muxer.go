@@ -2,14 +2,20 @@ package astilibav
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 
 	"github.com/asticode/go-astiencoder"
 	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avcodec"
 	"github.com/asticode/goav/avformat"
+	"github.com/asticode/goav/avutil"
 )
 
 var countMuxer uint64
@@ -18,22 +24,68 @@ var countMuxer uint64
 type Muxer struct {
 	*astiencoder.BaseNode
 	c                *astikit.Chan
+	cDone            chan struct{}
 	cl               *astikit.Closer
+	clIO             *astikit.Closer
 	ctxFormat        *avformat.Context
+	dict             *avutil.Dictionary
+	duration         int64
 	eh               *astiencoder.EventHandler
+	eos              *muxerEOS
+	finished         bool
+	it               *muxerInterleaveTracker
 	o                *sync.Once
+	opts             MuxerOptions
+	p                *pktPool
+	qs               []*MuxerPktHandler
+	r                *muxerReconnector
 	restamper        PktRestamper
 	statIncomingRate *astikit.CounterAvgStat
 	statWorkRatio    *astikit.DurationPercentageStat
+	tsa              *tsAnalyzer
+	writeErrors      int
 }
 
 // MuxerOptions represents muxer options
 type MuxerOptions struct {
+	// Private options of the output format, such as "muxrate=1000000,pcr_period=20"
+	Dict string
+	// Private options of the output format, such as {"movflags": "faststart"}. Contrary to Dict, values can contain
+	// commas. Entries override the ones of Dict.
+	// Options that haven't been used by the output format are sent in an event once the header has been written
+	Dictionary map[string]string
 	Format     *avformat.OutputFormat
 	FormatName string
-	Node       astiencoder.NodeOptions
-	Restamper  PktRestamper
-	URL        string
+	// If > 0, an event is sent when the oldest packet of the interleaving buffer has been held for longer than this
+	// duration
+	InterleaveMaxDuration time.Duration
+	// If > 0, an event is sent when the interleaving buffer holds more than this number of packets
+	InterleaveMaxPackets int
+	// If > 0, the muxer stops itself after this number of consecutive write errors, which allows the other outputs
+	// of a PktFanOut to keep going when this one fails
+	MaxWriteErrors int
+	// Global tags, such as "title" or "comment", written in the header
+	Metadata map[string]string
+	Node     astiencoder.NodeOptions
+	// If provided, the muxer reconnects to network outputs, such as RTMP or SRT, after a write error instead of
+	// failing
+	Reconnect *MuxerReconnectOptions
+	Restamper PktRestamper
+	// If provided, the muxer produces HLS or DASH segmented output
+	Segmenter *MuxerSegmenterOptions
+	// If > 0, sets the interval between 2 PCRs of MPEG-TS outputs
+	TSPCRPeriod time.Duration
+	// If true, the output is expected to be MPEG-TS and stats on stuffing and PCRs are added. PCR jitter is more
+	// accurate when the mux rate is set in Dict or Dictionary
+	TSStats bool
+	// Deprecated: use TSStats instead
+	TSStuffingStats bool
+	// Writers receiving a copy of the MPEG-TS bytes written, such as a TR101290Monitor
+	TSWriters []io.Writer
+	URL       string
+	// If provided, muxed bytes are written to it instead of the URL, in which case FormatName or Format should be
+	// provided as well. It's not closed by the muxer.
+	Writer io.Writer
 }
 
 // NewMuxer creates a new muxer
@@ -48,9 +100,13 @@ func NewMuxer(o MuxerOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (
 			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
 			ProcessAll:  true,
 		}),
-		cl:               c,
+		cDone:            make(chan struct{}),
 		eh:               eh,
+		eos:              newMuxerEOS(),
+		it:               newMuxerInterleaveTracker(),
 		o:                &sync.Once{},
+		opts:             o,
+		p:                newPktPool(c),
 		restamper:        o.Restamper,
 		statIncomingRate: astikit.NewCounterAvgStat(),
 		statWorkRatio:    astikit.NewDurationPercentageStat(),
@@ -58,6 +114,25 @@ func NewMuxer(o MuxerOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (
 	m.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(m), eh)
 	m.addStats()
 
+	// Create reconnector
+	if o.Reconnect != nil {
+		m.r = newMuxerReconnector(m, *o.Reconnect, c)
+	}
+
+	// Segmenter
+	if o.Segmenter != nil {
+		// Set format name
+		if o.Format == nil && o.FormatName == "" {
+			o.FormatName = o.Segmenter.formatName()
+		}
+
+		// Add segmenter options so that they can be overridden by the dict
+		if len(o.Dict) > 0 {
+			o.Dict = "," + o.Dict
+		}
+		o.Dict = o.Segmenter.dict() + o.Dict
+	}
+
 	// Alloc format context
 	// We need to create an intermediate variable to avoid "cgo argument has Go pointer to Go pointer" errors
 	var ctxFormat *avformat.Context
@@ -73,26 +148,124 @@ func NewMuxer(o MuxerOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (
 		return nil
 	})
 
-	// This is a file
-	if m.ctxFormat.Flags()&avformat.AVFMT_NOFILE == 0 {
-		// Open
+	// Trailer and pb are closed by a child closer so that they can be closed before the format ctx is freed, either
+	// when finishing the muxer or when closing the closer
+	m.cl = c.NewChild()
+
+	// IO is closed by its own closer, right after the trailer has been written, so that it can be replaced after a
+	// reconnection without writing the trailer
+	m.clIO = astikit.NewCloser()
+	m.cl.Add(func() error { return m.clIO.Close() })
+
+	// Set metadata
+	for k, v := range o.Metadata {
+		if err = m.SetMetadata(k, v); err != nil {
+			err = fmt.Errorf("astilibav: setting metadata %s=%s failed: %w", k, v, err)
+			return
+		}
+	}
+
+	// Add PCR period
+	if o.TSPCRPeriod > 0 {
+		if len(o.Dict) > 0 {
+			o.Dict += ","
+		}
+		o.Dict += fmt.Sprintf("pcr_period=%d", o.TSPCRPeriod.Milliseconds())
+	}
+
+	// Store options since they're needed to reconnect
+	m.opts = o
+
+	// Dict
+	if len(o.Dict) > 0 || len(o.Dictionary) > 0 {
+		// Create dict
+		if m.dict, err = newDict(o.Dict, o.Dictionary); err != nil {
+			err = fmt.Errorf("astilibav: creating dict failed: %w", err)
+			return
+		}
+
+		// Make sure the dict is freed
+		c.Add(func() error {
+			dict := m.dict
+			avutil.AvDictFree(&dict)
+			return nil
+		})
+	}
+
+	// Create MPEG-TS analyzer
+	if o.TSStats || o.TSStuffingStats || len(o.TSWriters) > 0 {
+		// Get mux rate
+		var muxRate int
+		if v, ok := dictEntries(m.dict)["muxrate"]; ok {
+			muxRate, _ = strconv.Atoi(v)
+		}
+
+		// Create analyzer
+		m.tsa = newTSAnalyzer(muxRate)
+		if o.TSStats || o.TSStuffingStats {
+			m.tsa.addStats(m.Stater())
+		}
+	}
+
+	// Open IO
+	if err = m.openIO(m.ctxFormat, m.clIO); err != nil {
+		err = fmt.Errorf("astilibav: opening io failed: %w", err)
+		return
+	}
+	return
+}
+
+// openIO hooks the segmenter and sets the pb of the format ctx, either writing to the writer or to the URL, and wrapped
+// by the MPEG-TS analyzer if needed
+// It's used both when creating the muxer and when reconnecting so that the new format ctx behaves the same
+func (m *Muxer) openIO(ctxFormat *avformat.Context, c *astikit.Closer) (err error) {
+	// Send an event every time a segment is done
+	if m.opts.Segmenter != nil {
+		hookMuxerSegmenter(m, ctxFormat, c)
+	}
+
+	// Write to the writer
+	if m.opts.Writer != nil {
+		// Format doesn't write to a pb
+		if ctxFormat.Oformat().Flags()&avformat.AVFMT_NOFILE > 0 {
+			err = errors.New("astilibav: format doesn't support writers")
+			return
+		}
+
+		// Set pb
+		if err = setMuxerIO(ctxFormat, m.opts.Writer, c); err != nil {
+			err = fmt.Errorf("astilibav: setting muxer io failed: %w", err)
+			return
+		}
+	} else if ctxFormat.Flags()&avformat.AVFMT_NOFILE == 0 {
+		// This is a file, open it
+		// We need to create an intermediate variable to avoid "cgo argument has Go pointer to Go pointer" errors
 		var ctxAvIO *avformat.AvIOContext
-		if ret := avformat.AvIOOpen(&ctxAvIO, o.URL, avformat.AVIO_FLAG_WRITE); ret < 0 {
-			err = fmt.Errorf("astilibav: avformat.AvIOOpen on %+v failed: %w", o, NewAvError(ret))
+		if ret := avformat.AvIOOpen(&ctxAvIO, m.opts.URL, avformat.AVIO_FLAG_WRITE); ret < 0 {
+			err = fmt.Errorf("astilibav: avformat.AvIOOpen on %s failed: %w", m.opts.URL, NewAvError(ret))
 			return
 		}
 
 		// Set pb
-		m.ctxFormat.SetPb(ctxAvIO)
+		ctxFormat.SetPb(ctxAvIO)
 
 		// Make sure the avio ctx is properly closed
 		c.Add(func() error {
+			ctxFormat.SetPb(nil)
 			if ret := avformat.AvIOClosep(&ctxAvIO); ret < 0 {
-				return fmt.Errorf("astilibav: avformat.AvIOClosep on %+v failed: %w", o, NewAvError(ret))
+				return fmt.Errorf("astilibav: avformat.AvIOClosep on %s failed: %w", m.opts.URL, NewAvError(ret))
 			}
 			return nil
 		})
 	}
+
+	// Analyze MPEG-TS
+	if m.tsa != nil {
+		if err = wrapTSAnalyzer(ctxFormat, m.tsa, m.opts.TSWriters, c); err != nil {
+			err = fmt.Errorf("astilibav: wrapping pb failed: %w", err)
+			return
+		}
+	}
 	return
 }
 
@@ -111,6 +284,13 @@ func (m *Muxer) addStats() {
 		Unit:        "%",
 	}, m.statWorkRatio)
 
+	// Add interleave stats
+	m.Stater().AddStat(astikit.StatMetadata{
+		Description: "Estimated number of packets held by the interleaving buffer",
+		Label:       "Interleave buffer",
+		Unit:        "p",
+	}, m.it)
+
 	// Add chan stats
 	m.c.AddStats(m.Stater())
 }
@@ -120,49 +300,238 @@ func (m *Muxer) CtxFormat() *avformat.Context {
 	return m.ctxFormat
 }
 
+// SetMetadata sets a global tag
+// It must be called before the muxer is started
+func (m *Muxer) SetMetadata(key, value string) error {
+	return setFormatMetadata(m.ctxFormat, key, value)
+}
+
+// SetStreamMetadata sets a per-stream tag
+// It must be called before the muxer is started
+func (m *Muxer) SetStreamMetadata(s *avformat.Stream, key, value string) error {
+	return setStreamMetadata(s, key, value)
+}
+
+// AddAttachment adds an attachment stream
+// It must be called before the muxer is started
+func (m *Muxer) AddAttachment(a Attachment) (*avformat.Stream, error) {
+	return addAttachmentStream(m.ctxFormat, a)
+}
+
 // Start starts the muxer
 func (m *Muxer) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
 	m.BaseNode.Start(ctx, t, func(t *astikit.Task) {
-		// Make sure to write header once
-		var ret int
-		m.o.Do(func() { ret = m.ctxFormat.AvformatWriteHeader(nil) })
-		if ret < 0 {
+		// Let Finish know nothing is written anymore
+		defer close(m.cDone)
+
+		// Write header
+		if ret := m.writeHeader(); ret < 0 {
 			emitAvError(m, m.eh, ret, "m.ctxFormat.AvformatWriteHeader on %s failed", m.ctxFormat.Filename())
 			return
 		}
 
-		// Write trailer once everything is done
-		m.cl.Add(func() error {
-			if ret := m.ctxFormat.AvWriteTrailer(); ret < 0 {
-				return fmt.Errorf("m.ctxFormat.AvWriteTrailer on %s failed: %w", m.ctxFormat.Filename(), NewAvError(ret))
-			}
-			return nil
-		})
+		// Make sure to wait for the reconnection loop to be done
+		defer t.Wait()
 
 		// Make sure to stop the chan properly
 		defer m.c.Stop()
 
+		// Reconnection loop is executed in a sub task
+		if m.r != nil {
+			m.r.setTask(m.Context(), t)
+		}
+
+		// Queued pkts are written by sub tasks
+		for _, h := range m.qs {
+			h := h
+			t.NewSubTask().Do(func() { h.drainQueue(m.Context()) })
+		}
+
 		// Start chan
 		m.c.Start(m.Context())
 	})
 }
 
+// Finish writes the pkts that have been handled so far, writes the trailer and closes the output without waiting for
+// the closer to be closed, which allows rotating output files. The muxer is stopped afterwards and pkts handled in
+// the meantime are dropped
+func (m *Muxer) Finish(ctx context.Context) (err error) {
+	// Make sure the muxer is stopped
+	defer m.Stop()
+
+	// Muxer is not running
+	if m.Status() != astiencoder.StatusRunning {
+		return m.finish()
+	}
+
+	// Finish in the chan so that pkts added previously are written first
+	// Adding is done in a goroutine since it blocks until the func has been executed
+	done := make(chan error, 1)
+	go func() {
+		var executed bool
+		m.c.Add(func() {
+			executed = true
+			done <- m.finish()
+		})
+
+		// The chan is stopped and the func has been dropped, therefore we wait for the pkts that are still being
+		// written before finishing
+		if !executed {
+			<-m.cDone
+			done <- m.finish()
+		}
+	}()
+
+	// Wait
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return
+}
+
+func (m *Muxer) finish() error {
+	// Muxer has already been finished
+	if m.finished {
+		return nil
+	}
+	m.finished = true
+
+	// Write trailer and close pb
+	return m.cl.Close()
+}
+
+func (m *Muxer) writeHeader() (ret int) {
+	// Make sure to write header once
+	var done bool
+	var d time.Duration
+	m.o.Do(func() {
+		dict := m.dict
+		n := time.Now()
+		ret = m.ctxFormat.AvformatWriteHeader(&dict)
+		d = time.Since(n)
+		m.dict = dict
+		done = true
+	})
+	if !done || ret < 0 {
+		return
+	}
+
+	// Send event
+	m.emitWrite(EventNameMuxerHeaderWritten, d)
+
+	// Send unused options
+	if m.dict != nil {
+		if d := dictEntries(m.dict); len(d) > 0 {
+			m.eh.Emit(astiencoder.Event{
+				Name:    EventNameMuxerUnusedOptions,
+				Payload: d,
+				Target:  m,
+			})
+		}
+	}
+
+	// Write trailer once everything is done
+	m.cl.Add(func() error {
+		n := time.Now()
+		if ret := m.ctxFormat.AvWriteTrailer(); ret < 0 {
+			return fmt.Errorf("m.ctxFormat.AvWriteTrailer on %s failed: %w", m.ctxFormat.Filename(), NewAvError(ret))
+		}
+		m.emitWrite(EventNameMuxerTrailerWritten, time.Since(n))
+		return nil
+	})
+	return
+}
+
+// MuxerWrite represents a header or trailer write
+type MuxerWrite struct {
+	// Time spent writing
+	Duration time.Duration
+	// Number of bytes written to the output once the write is done, or -1 if unknown, which is the case of formats
+	// writing several files such as hls. Once the header has been written, it is the offset of the first pkt
+	Offset int64
+	URL    string
+	// Time at which the write was done
+	WrittenAt time.Time
+}
+
+func (m *Muxer) emitWrite(name string, d time.Duration) {
+	m.eh.Emit(astiencoder.Event{
+		Name: name,
+		Payload: MuxerWrite{
+			Duration:  d,
+			Offset:    muxerIOOffset(m.ctxFormat),
+			URL:       m.opts.URL,
+			WrittenAt: time.Now(),
+		},
+		Target: m,
+	})
+}
+
 // MuxerPktHandler is an object that can handle a pkt for the muxer
 type MuxerPktHandler struct {
 	*Muxer
-	o *avformat.Stream
+	// Streams are retrieved through their index since they're replaced after a reconnection
+	idx          int
+	q            *muxerDropQueue
+	statDropRate *astikit.CounterAvgStat
 }
 
 // NewHandler creates
 func (m *Muxer) NewPktHandler(o *avformat.Stream) *MuxerPktHandler {
-	return &MuxerPktHandler{
+	return m.NewPktHandlerWithOptions(o, MuxerPktHandlerOptions{})
+}
+
+// NewPktHandlerWithOptions creates a new pkt handler whose pkts may be dropped instead of blocking when the muxer
+// can't keep up
+// When a drop policy is provided, it must be called before the muxer is started
+func (m *Muxer) NewPktHandlerWithOptions(o *avformat.Stream, ho MuxerPktHandlerOptions) (h *MuxerPktHandler) {
+	// Create handler
+	h = &MuxerPktHandler{
 		Muxer: m,
-		o:     o,
+		idx:   o.Index(),
+	}
+
+	// Keep track of streams that need to end before the muxer finishes on end of stream
+	m.eos.add(h.idx)
+
+	// Only streams with a handler are interleaved
+	m.it.addStream(h.idx)
+
+	// Pkts are never dropped
+	if ho.DropPolicy == MuxerDropPolicyNone {
+		return
 	}
+
+	// Create queue
+	h.q = newMuxerDropQueue(ho)
+	m.qs = append(m.qs, h)
+
+	// Add drop rate
+	h.statDropRate = astikit.NewCounterAvgStat()
+	m.Stater().AddStat(astikit.StatMetadata{
+		Description: fmt.Sprintf("Number of packets of stream #%d dropped per second", h.idx),
+		Label:       fmt.Sprintf("Drop rate #%d", h.idx),
+		Unit:        "pps",
+	}, h.statDropRate)
+	return
+}
+
+// SetStreamMetadata sets a tag, such as "language" or "handler_name", on the stream of the handler
+// It must be called before the muxer is started
+func (h *MuxerPktHandler) SetStreamMetadata(key, value string) error {
+	return h.Muxer.SetStreamMetadata(h.ctxFormat.Streams()[h.idx], key, value)
 }
 
 // HandlePkt implements the PktHandler interface
 func (h *MuxerPktHandler) HandlePkt(p *PktHandlerPayload) {
+	// Pkts may be dropped
+	if h.q != nil {
+		h.queuePkt(p)
+		return
+	}
+
 	h.c.Add(func() {
 		// Handle pause
 		defer h.HandlePause()
@@ -170,24 +539,108 @@ func (h *MuxerPktHandler) HandlePkt(p *PktHandlerPayload) {
 		// Increment incoming rate
 		h.statIncomingRate.Add(1)
 
-		// Rescale timestamps
-		p.Pkt.AvPacketRescaleTs(p.Descriptor.TimeBase(), h.o.TimeBase())
+		// Write pkt
+		h.write(p.Pkt, p.Descriptor)
+	})
+}
+
+// write is executed in the muxer chan
+func (h *MuxerPktHandler) write(pkt *avcodec.Packet, d Descriptor) {
+	// Muxer is reconnecting
+	if h.r != nil && h.r.buffer(pkt, d, h.idx) {
+		return
+	}
+
+	// Write pkt
+	if ret := h.writePkt(pkt, d, h.ctxFormat.Streams()[h.idx]); ret < 0 {
+		emitAvError(h, h.eh, ret, "h.ctxFormat.AvInterleavedWriteFrame failed")
 
-		// Set stream index
-		p.Pkt.SetStreamIndex(h.o.Index())
+		// Reconnect
+		if h.r != nil {
+			h.r.start()
+			return
+		}
 
-		// Restamp
-		if h.restamper != nil {
-			h.restamper.Restamp(p.Pkt)
+		// Max number of write errors has been reached
+		if h.writeErrors++; h.opts.MaxWriteErrors > 0 && h.writeErrors >= h.opts.MaxWriteErrors {
+			h.eh.Emit(astiencoder.EventError(h, fmt.Errorf("astilibav: max number of write errors %d reached, stopping", h.opts.MaxWriteErrors)))
+			h.Stop()
 		}
+		return
+	}
+	h.writeErrors = 0
+}
+
+// writePkt takes ownership of the pkt data
+func (m *Muxer) writePkt(pkt *avcodec.Packet, d Descriptor, o *avformat.Stream) (ret int) {
+	// Muxer has been finished
+	if m.finished {
+		return
+	}
+
+	// Rescale timestamps
+	pkt.AvPacketRescaleTs(d.TimeBase(), o.TimeBase())
+
+	// Set stream index
+	pkt.SetStreamIndex(o.Index())
+
+	// Restamp
+	if m.restamper != nil {
+		m.restamper.Restamp(pkt)
+	}
+
+	// Get dts before the pkt is handed to the muxer
+	dts := time.Duration(avutil.AvRescaleQ(pkt.Dts(), o.TimeBase(), nanosecondRational))
+
+	// Update duration
+	m.updateDuration(time.Duration(avutil.AvRescaleQ(pkt.Pts()+pkt.Duration(), o.TimeBase(), nanosecondRational)))
 
-		// Write frame
-		h.statWorkRatio.Begin()
-		if ret := h.ctxFormat.AvInterleavedWriteFrame((*avformat.Packet)(unsafe.Pointer(p.Pkt))); ret < 0 {
-			h.statWorkRatio.End()
-			emitAvError(h, h.eh, ret, "h.ctxFormat.AvInterleavedWriteFrame failed")
+	// Write frame
+	m.statWorkRatio.Begin()
+	ret = m.ctxFormat.AvInterleavedWriteFrame((*avformat.Packet)(unsafe.Pointer(pkt)))
+	m.statWorkRatio.End()
+	if ret < 0 {
+		return
+	}
+
+	// Check interleaving buffer
+	m.checkInterleave(o.Index(), dts)
+	return
+}
+
+func (m *Muxer) updateDuration(end time.Duration) {
+	for {
+		d := atomic.LoadInt64(&m.duration)
+		if int64(end) <= d || atomic.CompareAndSwapInt64(&m.duration, d, int64(end)) {
 			return
 		}
-		h.statWorkRatio.End()
-	})
+	}
+}
+
+// WorkflowReportOutput implements the astiencoder.WorkflowReportOutputter interface
+func (m *Muxer) WorkflowReportOutput() astiencoder.WorkflowReportOutput {
+	return astiencoder.WorkflowReportOutput{
+		Duration: time.Duration(atomic.LoadInt64(&m.duration)),
+		URL:      m.opts.URL,
+	}
+}
+
+func (m *Muxer) checkInterleave(streamIdx int, dts time.Duration) {
+	// Nothing to check
+	if m.opts.InterleaveMaxDuration <= 0 && m.opts.InterleaveMaxPackets <= 0 {
+		return
+	}
+
+	// Add pkt
+	now := time.Now()
+	m.it.add(streamIdx, dts, now)
+
+	// Check
+	if o := m.it.check(m.opts.InterleaveMaxPackets, m.opts.InterleaveMaxDuration, now); o != nil {
+		m.eh.Emit(astiencoder.Event{
+			Name:    EventNameMuxerInterleaveOverflow,
+			Payload: *o,
+			Target:  m,
+		})
+	}
 }
@@ -0,0 +1,171 @@
+package astilibav
+
+import (
+	"context"
+	"sync"
+)
+
+// Muxer drop policies
+const (
+	// Pkts are never dropped and handling a pkt blocks until it has been written
+	MuxerDropPolicyNone = ""
+	// When the queue is full, the newest pkt is dropped
+	MuxerDropPolicyNewest = "newest"
+	// When the queue is full, pkts are dropped the same way the PktQueue drops them so that the output remains
+	// decodable: disposable pkts first, then audio pkts, then non-key video pkts along with the following ones until
+	// the next keyframe. Keyframes are always queued
+	MuxerDropPolicyNonKeyframes = "non.keyframes"
+	// When the queue is full, the oldest queued pkt is dropped
+	MuxerDropPolicyOldest = "oldest"
+)
+
+const defaultMuxerMaxQueuedPkts = 100
+
+// MuxerPktHandlerOptions represents muxer pkt handler options
+// When a drop policy is provided, pkts are queued instead of blocking the upstream nodes until they're written, so
+// that live pipelines can favor latency over completeness when the output can't keep up
+type MuxerPktHandlerOptions struct {
+	// Possible values are "newest", "non.keyframes" and "oldest". If empty, pkts are never dropped
+	DropPolicy string
+	// Max number of pkts queued before the drop policy applies. Defaults to 100
+	MaxQueuedPkts int
+}
+
+type muxerDropQueue struct {
+	b *pktQueueBuffer
+	// The drainer writes queued pkts and closes the provided chan once it's done
+	flush  chan chan bool
+	m      *sync.Mutex
+	signal chan bool
+}
+
+func newMuxerDropQueue(o MuxerPktHandlerOptions) *muxerDropQueue {
+	// Default values
+	if o.MaxQueuedPkts <= 0 {
+		o.MaxQueuedPkts = defaultMuxerMaxQueuedPkts
+	}
+
+	// Create buffer
+	b := newPktQueueBuffer(0, o.MaxQueuedPkts)
+	b.dropPolicy = o.DropPolicy
+	return &muxerDropQueue{
+		b:      b,
+		flush:  make(chan chan bool),
+		m:      &sync.Mutex{},
+		signal: make(chan bool, 1),
+	}
+}
+
+func (h *MuxerPktHandler) queuePkt(p *PktHandlerPayload) {
+	// Increment incoming rate
+	h.statIncomingRate.Add(1)
+
+	// Copy pkt since it's written asynchronously
+	pkt := h.p.get()
+	if ret := defaultBindings.pktRef(pkt, p.Pkt); ret < 0 {
+		emitAvError(h, h.eh, ret, "pkt.AvPacketRef failed")
+		h.p.put(pkt)
+		return
+	}
+
+	// Lock
+	h.q.m.Lock()
+	defer h.q.m.Unlock()
+
+	// Push
+	for _, i := range h.q.b.push(newPktQueueItem(pkt, p)) {
+		h.statDropRate.Add(1)
+		h.p.put(i.pkt)
+	}
+
+	// Signal
+	select {
+	case h.q.signal <- true:
+	default:
+	}
+}
+
+// drainQueue is executed in a sub task of the muxer and writes queued pkts one at a time so that other streams' pkts
+// are written in between
+func (h *MuxerPktHandler) drainQueue(ctx context.Context) {
+	// Make sure queued pkts are put back in the pool
+	defer h.resetQueue()
+
+	// Loop
+	for {
+		// Wait for pkts or for a flush
+		var flushed chan bool
+		select {
+		case <-h.q.signal:
+		case flushed = <-h.q.flush:
+		case <-ctx.Done():
+			return
+		}
+
+		// Write queued pkts
+		h.writeQueuedPkts(ctx)
+
+		// Let the flusher know queued pkts have been written
+		if flushed != nil {
+			close(flushed)
+		}
+
+		// Check context
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (h *MuxerPktHandler) writeQueuedPkts(ctx context.Context) {
+	for {
+		// Pop
+		h.q.m.Lock()
+		i := h.q.b.pop()
+		h.q.m.Unlock()
+		if i == nil {
+			return
+		}
+
+		// Write pkt
+		// Adding to the chan blocks until the func has been executed
+		h.c.Add(func() {
+			// Handle pause
+			defer h.HandlePause()
+
+			// Write
+			h.write(i.pkt, i.d)
+		})
+		h.p.put(i.pkt)
+
+		// Check context
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// flushQueue blocks until the drainer has written queued pkts
+func (h *MuxerPktHandler) flushQueue() {
+	// Muxer has never been started
+	ctx := h.Context()
+	if ctx == nil {
+		return
+	}
+
+	// Flush
+	flushed := make(chan bool)
+	select {
+	case h.q.flush <- flushed:
+		<-flushed
+	case <-ctx.Done():
+	}
+}
+
+func (h *MuxerPktHandler) resetQueue() {
+	h.q.m.Lock()
+	defer h.q.m.Unlock()
+	for i := h.q.b.pop(); i != nil; i = h.q.b.pop() {
+		h.p.put(i.pkt)
+	}
+}
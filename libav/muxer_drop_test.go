@@ -0,0 +1,42 @@
+package astilibav
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMuxerDropQueue(t *testing.T) {
+	i1 := &pktQueueItem{dts: 1 * time.Millisecond, key: true, priority: pktQueuePriorityKeep}
+	i2 := &pktQueueItem{dts: 2 * time.Millisecond, priority: pktQueuePriorityVideo}
+	i3 := &pktQueueItem{dts: 3 * time.Millisecond, priority: pktQueuePriorityVideo}
+	i4 := &pktQueueItem{dts: 4 * time.Millisecond, key: true, priority: pktQueuePriorityKeep}
+
+	q := newMuxerDropQueue(MuxerPktHandlerOptions{DropPolicy: MuxerDropPolicyNewest, MaxQueuedPkts: 2})
+	assert.Empty(t, q.b.push(i1))
+	assert.Empty(t, q.b.push(i2))
+	assert.Equal(t, []*pktQueueItem{i3}, q.b.push(i3))
+	assert.Equal(t, []*pktQueueItem{i1, i2}, q.b.items)
+
+	q = newMuxerDropQueue(MuxerPktHandlerOptions{DropPolicy: MuxerDropPolicyOldest, MaxQueuedPkts: 2})
+	assert.Empty(t, q.b.push(i1))
+	assert.Empty(t, q.b.push(i2))
+	assert.Equal(t, []*pktQueueItem{i1}, q.b.push(i3))
+	assert.Equal(t, []*pktQueueItem{i2, i3}, q.b.items)
+	assert.Equal(t, i2, q.b.pop())
+	assert.Equal(t, i3, q.b.pop())
+	assert.Nil(t, q.b.pop())
+
+	q = newMuxerDropQueue(MuxerPktHandlerOptions{DropPolicy: MuxerDropPolicyNonKeyframes, MaxQueuedPkts: 1})
+	assert.Empty(t, q.b.push(i1))
+	assert.Equal(t, []*pktQueueItem{i2}, q.b.push(i2))
+	q.b.pop()
+	assert.Equal(t, []*pktQueueItem{i3}, q.b.push(i3))
+	assert.Empty(t, q.b.push(i4))
+	assert.Empty(t, q.b.push(i1))
+	assert.Equal(t, []*pktQueueItem{i4, i1}, q.b.items)
+
+	// Default max queued pkts
+	assert.Equal(t, defaultMuxerMaxQueuedPkts, newMuxerDropQueue(MuxerPktHandlerOptions{DropPolicy: MuxerDropPolicyOldest}).b.maxSize)
+}
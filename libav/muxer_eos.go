@@ -0,0 +1,70 @@
+package astilibav
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/asticode/go-astiencoder"
+)
+
+type muxerEOS struct {
+	m  *sync.Mutex
+	ss map[int]bool // Indexed by stream index
+}
+
+func newMuxerEOS() *muxerEOS {
+	return &muxerEOS{
+		m:  &sync.Mutex{},
+		ss: make(map[int]bool),
+	}
+}
+
+func (e *muxerEOS) add(idx int) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	if _, ok := e.ss[idx]; !ok {
+		e.ss[idx] = false
+	}
+}
+
+// done returns true if all streams have ended
+func (e *muxerEOS) done(idx int) bool {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.ss[idx] = true
+	for _, v := range e.ss {
+		if !v {
+			return false
+		}
+	}
+	return true
+}
+
+// HandleEOS implements the EOSHandler interface
+// Once all streams of the muxer have ended, the trailer is written and the muxer is stopped
+func (h *MuxerPktHandler) HandleEOS(p *EOSHandlerPayload) {
+	// Write queued pkts first
+	// They're written by the drainer so that a pkt it has popped already isn't written after the trailer
+	if h.q != nil {
+		h.flushQueue()
+	}
+
+	// End stream in the chan so that pkts added previously are written first
+	h.c.Add(func() {
+		// The stream doesn't hold the interleaving buffer anymore
+		h.it.endStream(h.idx)
+
+		// Other streams have not ended yet
+		if !h.eos.done(h.idx) {
+			return
+		}
+
+		// Finish
+		if err := h.finish(); err != nil {
+			h.eh.Emit(astiencoder.EventError(h, fmt.Errorf("astilibav: finishing muxer failed: %w", err)))
+		}
+
+		// Stop
+		h.Stop()
+	})
+}
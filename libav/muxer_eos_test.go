@@ -0,0 +1,17 @@
+package astilibav
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMuxerEOS(t *testing.T) {
+	e := newMuxerEOS()
+	e.add(0)
+	e.add(1)
+	e.add(1)
+	assert.False(t, e.done(1))
+	assert.False(t, e.done(1))
+	assert.True(t, e.done(0))
+}
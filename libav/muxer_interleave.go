@@ -0,0 +1,204 @@
+package astilibav
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MuxerInterleaveOverflow represents a muxer interleave overflow
+type MuxerInterleaveOverflow struct {
+	// Estimated number of packets held by the interleaving buffer
+	BufferedPackets int
+	// Time spent by the oldest packet in the interleaving buffer
+	BufferedDuration time.Duration
+	// Index of the stream preventing the interleaving buffer from being flushed, most of the time because it has stalled
+	StalledStreamIdx int
+}
+
+// ffmpeg's default max_interleave_delta
+const defaultMuxerInterleaveMaxDelta = 10 * time.Second
+
+// muxerInterleaveTracker estimates the interleaving buffer state by mimicking ffmpeg's interleaving by dts: a packet can
+// only leave the buffer once every stream has received a packet with a greater or equal dts, once the buffer spans
+// more than the max interleave delta or once the streams preventing it from leaving have ended
+// Only streams with a registered handler are taken into account since the others will never receive packets
+type muxerInterleaveTracker struct {
+	lastDtss   map[int]time.Duration
+	m          *sync.Mutex
+	maxDelta   time.Duration
+	maxDts     *time.Duration
+	overflowed bool
+	q          []muxerInterleaveItem
+	streams    map[int]bool // Indexed by stream index, true once the stream has ended
+}
+
+type muxerInterleaveItem struct {
+	addedAt time.Time
+	dts     time.Duration
+}
+
+func newMuxerInterleaveTracker() *muxerInterleaveTracker {
+	return &muxerInterleaveTracker{
+		lastDtss: make(map[int]time.Duration),
+		m:        &sync.Mutex{},
+		maxDelta: defaultMuxerInterleaveMaxDelta,
+		streams:  make(map[int]bool),
+	}
+}
+
+func (t *muxerInterleaveTracker) addStream(streamIdx int) {
+	// Lock
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	// Add stream
+	if _, ok := t.streams[streamIdx]; !ok {
+		t.streams[streamIdx] = false
+	}
+}
+
+func (t *muxerInterleaveTracker) endStream(streamIdx int) {
+	// Lock
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	// End stream
+	t.streams[streamIdx] = true
+
+	// Release
+	t.release()
+}
+
+func (t *muxerInterleaveTracker) add(streamIdx int, dts time.Duration, now time.Time) {
+	// Lock
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	// Update dtss
+	t.lastDtss[streamIdx] = dts
+	if t.maxDts == nil || dts > *t.maxDts {
+		t.maxDts = &dts
+	}
+
+	// Add item
+	t.q = append(t.q, muxerInterleaveItem{
+		addedAt: now,
+		dts:     dts,
+	})
+
+	// Release
+	t.release()
+}
+
+// release removes items that have left the buffer
+func (t *muxerInterleaveTracker) release() {
+	min, ok := t.minDts()
+	idx := 0
+	for idx < len(t.q) && ((ok && t.q[idx].dts <= min) || (t.maxDelta > 0 && t.maxDts != nil && *t.maxDts-t.q[idx].dts > t.maxDelta)) {
+		idx++
+	}
+	t.q = t.q[idx:]
+}
+
+// minDts returns the smallest last dts of streams that have not ended. If all streams have ended, all items can
+// leave the buffer
+func (t *muxerInterleaveTracker) minDts() (min time.Duration, ok bool) {
+	// No streams
+	if len(t.streams) == 0 {
+		return
+	}
+
+	// Loop through streams
+	min, ok = time.Duration(math.MaxInt64), true
+	for idx, ended := range t.streams {
+		// Stream has ended
+		if ended {
+			continue
+		}
+
+		// Stream hasn't received any packet
+		dts, received := t.lastDtss[idx]
+		if !received {
+			return 0, false
+		}
+
+		// Update min
+		if dts < min {
+			min = dts
+		}
+	}
+	return
+}
+
+func (t *muxerInterleaveTracker) stalledStreamIdx() int {
+	// Get streams that have not ended
+	var idxs []int
+	for idx, ended := range t.streams {
+		if !ended {
+			idxs = append(idxs, idx)
+		}
+	}
+	sort.Ints(idxs)
+
+	// A stream hasn't received any packet
+	for _, idx := range idxs {
+		if _, ok := t.lastDtss[idx]; !ok {
+			return idx
+		}
+	}
+
+	// Get stream with the smallest dts
+	stalled := -1
+	var min time.Duration
+	for _, idx := range idxs {
+		if dts := t.lastDtss[idx]; stalled == -1 || dts < min {
+			min = dts
+			stalled = idx
+		}
+	}
+	return stalled
+}
+
+// check returns an overflow if thresholds are exceeded. An overflow is only returned once until the buffer goes back
+// under thresholds
+func (t *muxerInterleaveTracker) check(maxPackets int, maxDuration time.Duration, now time.Time) (o *MuxerInterleaveOverflow) {
+	// Lock
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	// Get buffer state
+	var d time.Duration
+	if len(t.q) > 0 {
+		d = now.Sub(t.q[0].addedAt)
+	}
+
+	// Check thresholds
+	overflowed := (maxPackets > 0 && len(t.q) > maxPackets) || (maxDuration > 0 && d > maxDuration)
+	if !overflowed {
+		t.overflowed = false
+		return
+	} else if t.overflowed {
+		return
+	}
+	t.overflowed = true
+	return &MuxerInterleaveOverflow{
+		BufferedDuration: d,
+		BufferedPackets:  len(t.q),
+		StalledStreamIdx: t.stalledStreamIdx(),
+	}
+}
+
+// Value implements the astikit.StatHandler interface
+func (t *muxerInterleaveTracker) Value(_ time.Duration) interface{} {
+	t.m.Lock()
+	defer t.m.Unlock()
+	return len(t.q)
+}
+
+// Start implements the astikit.StatHandler interface
+func (t *muxerInterleaveTracker) Start() {}
+
+// Stop implements the astikit.StatHandler interface
+func (t *muxerInterleaveTracker) Stop() {}
@@ -0,0 +1,60 @@
+package astilibav
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMuxerInterleaveTracker(t *testing.T) {
+	n := time.Unix(0, 0)
+	tr := newMuxerInterleaveTracker()
+	tr.addStream(0)
+	tr.addStream(1)
+	tr.add(0, 0, n)
+	tr.add(0, time.Second, n)
+	assert.Equal(t, 2, len(tr.q))
+	assert.Equal(t, &MuxerInterleaveOverflow{BufferedDuration: 2 * time.Second, BufferedPackets: 2, StalledStreamIdx: 1}, tr.check(1, 0, n.Add(2*time.Second)))
+	assert.Nil(t, tr.check(1, 0, n.Add(2*time.Second)))
+	tr.add(1, 500*time.Millisecond, n)
+	assert.Equal(t, 2, len(tr.q))
+	tr.add(1, time.Second, n)
+	assert.Equal(t, 0, len(tr.q))
+	assert.Nil(t, tr.check(1, 0, n))
+}
+
+func TestMuxerInterleaveTrackerStreams(t *testing.T) {
+	// Streams without handler are ignored
+	n := time.Unix(0, 0)
+	tr := newMuxerInterleaveTracker()
+	tr.addStream(0)
+	tr.addStream(2)
+	tr.add(0, 0, n)
+	tr.add(0, time.Second, n)
+	assert.Equal(t, 2, tr.stalledStreamIdx())
+	tr.add(2, time.Second, n)
+	assert.Equal(t, 0, len(tr.q))
+
+	// Queue is released on end of stream
+	tr.add(0, 2*time.Second, n)
+	tr.add(0, 3*time.Second, n)
+	assert.Equal(t, 2, len(tr.q))
+	tr.endStream(2)
+	assert.Equal(t, 0, len(tr.q))
+	tr.add(0, 4*time.Second, n)
+	assert.Equal(t, 0, len(tr.q))
+
+	// Queue is released once it spans more than the max interleave delta
+	tr = newMuxerInterleaveTracker()
+	tr.maxDelta = 2 * time.Second
+	tr.addStream(0)
+	tr.addStream(1)
+	tr.add(0, 0, n)
+	tr.add(0, time.Second, n)
+	tr.add(0, 2*time.Second, n)
+	assert.Equal(t, 3, len(tr.q))
+	tr.add(0, 3*time.Second, n)
+	assert.Equal(t, 3, len(tr.q))
+	assert.Equal(t, time.Second, tr.q[0].dts)
+}
@@ -0,0 +1,150 @@
+package astilibav
+
+//#cgo pkg-config: libavformat libavutil
+//#include <errno.h>
+//#include <stdint.h>
+//#include <libavformat/avformat.h>
+//#include <libavutil/mem.h>
+//extern int goAstilibavMuxerIOWrite(void *opaque, uint8_t *buf, int size);
+//extern int64_t goAstilibavMuxerIOSeek(void *opaque, int64_t offset, int whence);
+//// The write callback takes a const buffer since libavformat 61 (ffmpeg 7.0)
+//#if LIBAVFORMAT_VERSION_MAJOR >= 61
+//static int astilibav_muxer_io_write(void *opaque, const uint8_t *buf, int size) { return goAstilibavMuxerIOWrite(opaque, (uint8_t *)buf, size); }
+//#else
+//static int astilibav_muxer_io_write(void *opaque, uint8_t *buf, int size) { return goAstilibavMuxerIOWrite(opaque, buf, size); }
+//#endif
+//static AVIOContext *astilibav_muxer_io_alloc(int size, uintptr_t id, int seekable) {
+//	unsigned char *b = av_malloc(size);
+//	if (!b) return NULL;
+//	AVIOContext *c = avio_alloc_context(b, size, 1, (void *)id, NULL, astilibav_muxer_io_write, seekable ? goAstilibavMuxerIOSeek : NULL);
+//	if (!c) av_free(b);
+//	return c;
+//}
+//static void astilibav_muxer_io_free(AVIOContext *c) {
+//	avio_flush(c);
+//	av_freep(&c->buffer);
+//	avio_context_free(&c);
+//}
+//static int astilibav_muxer_io_error() { return AVERROR(EIO); }
+//static int64_t astilibav_muxer_io_offset(AVFormatContext *s) { return s->pb ? avio_tell(s->pb) : -1; }
+import "C"
+import (
+	"errors"
+	"io"
+	"sync"
+	"unsafe"
+
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avformat"
+)
+
+const muxerIOBufferSize = 32 * 1024
+
+// Opaque pointers can't hold Go pointers, therefore writers are indexed by id
+var (
+	countMuxerIOWriter  uintptr
+	muxerIOWriters      = make(map[uintptr]io.Writer)
+	muxerIOWritersMutex = &sync.Mutex{}
+)
+
+func muxerIOWriter(opaque unsafe.Pointer) (w io.Writer, ok bool) {
+	muxerIOWritersMutex.Lock()
+	defer muxerIOWritersMutex.Unlock()
+	w, ok = muxerIOWriters[uintptr(opaque)]
+	return
+}
+
+//export goAstilibavMuxerIOWrite
+func goAstilibavMuxerIOWrite(opaque unsafe.Pointer, buf *C.uint8_t, size C.int) C.int {
+	// Get writer
+	w, ok := muxerIOWriter(opaque)
+	if !ok {
+		return C.astilibav_muxer_io_error()
+	}
+
+	// Nothing to write
+	if size <= 0 {
+		return 0
+	}
+
+	// Write
+	n, err := w.Write((*[1 << 30]byte)(unsafe.Pointer(buf))[:size:size])
+	if err != nil {
+		return C.astilibav_muxer_io_error()
+	}
+	return C.int(n)
+}
+
+//export goAstilibavMuxerIOSeek
+func goAstilibavMuxerIOSeek(opaque unsafe.Pointer, offset C.int64_t, whence C.int) C.int64_t {
+	// Get seeker
+	w, ok := muxerIOWriter(opaque)
+	if !ok {
+		return C.int64_t(C.astilibav_muxer_io_error())
+	}
+	s, ok := w.(io.Seeker)
+	if !ok {
+		return C.int64_t(C.astilibav_muxer_io_error())
+	}
+
+	// Size is unknown
+	if whence&C.AVSEEK_SIZE > 0 {
+		return -1
+	}
+
+	// Seek
+	// SEEK_SET, SEEK_CUR and SEEK_END have the same values as their io counterparts
+	n, err := s.Seek(int64(offset), int(whence&^C.AVSEEK_FORCE))
+	if err != nil {
+		return C.int64_t(C.astilibav_muxer_io_error())
+	}
+	return C.int64_t(n)
+}
+
+// setMuxerIO sets a format pb writing to the provided writer instead of a URL. The pb is seekable if the writer
+// implements io.Seeker, which is required by formats rewriting their header, such as mp4 without fragmentation
+func setMuxerIO(ctxFormat *avformat.Context, w io.Writer, c *astikit.Closer) (err error) {
+	// Register writer
+	muxerIOWritersMutex.Lock()
+	countMuxerIOWriter++
+	id := countMuxerIOWriter
+	muxerIOWriters[id] = w
+	muxerIOWritersMutex.Unlock()
+
+	// Alloc pb
+	var seekable C.int
+	if _, ok := w.(io.Seeker); ok {
+		seekable = 1
+	}
+	pb := C.astilibav_muxer_io_alloc(muxerIOBufferSize, C.uintptr_t(id), seekable)
+	if pb == nil {
+		muxerIOWritersMutex.Lock()
+		delete(muxerIOWriters, id)
+		muxerIOWritersMutex.Unlock()
+		err = errors.New("astilibav: allocating pb failed")
+		return
+	}
+
+	// Make sure the pb is flushed and freed once the trailer has been written
+	cf := (*C.struct_AVFormatContext)(unsafe.Pointer(ctxFormat))
+	c.Add(func() error {
+		C.astilibav_muxer_io_free(pb)
+		cf.pb = nil
+		muxerIOWritersMutex.Lock()
+		delete(muxerIOWriters, id)
+		muxerIOWritersMutex.Unlock()
+		return nil
+	})
+
+	// Set pb
+	// libavformat must not try to close it
+	cf.pb = pb
+	cf.flags |= C.AVFMT_FLAG_CUSTOM_IO
+	return
+}
+
+// muxerIOOffset returns the number of bytes written to the format pb so far, or -1 if the format has no pb, which is
+// the case of formats writing several files such as hls
+func muxerIOOffset(ctxFormat *avformat.Context) int64 {
+	return int64(C.astilibav_muxer_io_offset((*C.struct_AVFormatContext)(unsafe.Pointer(ctxFormat))))
+}
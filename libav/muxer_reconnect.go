@@ -0,0 +1,317 @@
+package astilibav
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avformat"
+	"github.com/asticode/goav/avutil"
+)
+
+// Default muxer reconnect values
+const (
+	defaultMuxerReconnectBackoff    = time.Second
+	defaultMuxerReconnectMaxBackoff = 30 * time.Second
+)
+
+// MuxerReconnectOptions represents muxer reconnect options
+type MuxerReconnectOptions struct {
+	// Delay before the first attempt, which is doubled after each failed attempt. Defaults to 1s
+	Backoff time.Duration
+	// Defaults to 30s
+	MaxBackoff time.Duration
+	// Max number of pkts buffered while reconnecting, the oldest ones being dropped first. Buffered pkts are written
+	// once reconnected. If 0, pkts are dropped while reconnecting
+	MaxBufferedPkts int
+	// Number of failed attempts after which the muxer stops itself. If 0, the muxer retries forever
+	MaxRetries int
+}
+
+type muxerReconnector struct {
+	buf []*muxerReconnectorItem
+	// Executes a func in the chan pkts are written in
+	add  func(fn func())
+	ctx  context.Context
+	fail func(err error)
+	m    *sync.Mutex
+	mx   *Muxer
+	o    MuxerReconnectOptions
+	p    *pktPool
+	// Locked by m
+	reconnecting bool
+	t            *astikit.Task
+}
+
+type muxerReconnectorItem struct {
+	d   Descriptor
+	idx int
+	pkt *avcodec.Packet
+}
+
+func newMuxerReconnector(mx *Muxer, o MuxerReconnectOptions, c *astikit.Closer) *muxerReconnector {
+	// Default values
+	if o.Backoff <= 0 {
+		o.Backoff = defaultMuxerReconnectBackoff
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = defaultMuxerReconnectMaxBackoff
+	}
+	if o.MaxBackoff < o.Backoff {
+		o.MaxBackoff = o.Backoff
+	}
+	return &muxerReconnector{
+		add: mx.c.Add,
+		fail: func(err error) {
+			mx.eh.Emit(astiencoder.EventError(mx, err))
+			mx.Stop()
+		},
+		m:  &sync.Mutex{},
+		mx: mx,
+		o:  o,
+		p:  newPktPool(c),
+	}
+}
+
+// setTask must be called before pkts are written. The reconnection loop is executed in a sub task so that the node
+// waits for it before being stopped
+func (r *muxerReconnector) setTask(ctx context.Context, t *astikit.Task) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.ctx = ctx
+	r.t = t
+}
+
+// buffer returns true if the muxer is reconnecting, in which case the pkt must not be written
+func (r *muxerReconnector) buffer(pkt *avcodec.Packet, d Descriptor, idx int) bool {
+	// Lock
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	// Muxer is not reconnecting
+	if !r.reconnecting {
+		return false
+	}
+
+	// Pkts are not buffered
+	if r.o.MaxBufferedPkts <= 0 {
+		return true
+	}
+
+	// Copy pkt
+	bPkt := r.p.get()
+	if ret := defaultBindings.pktRef(bPkt, pkt); ret < 0 {
+		emitAvError(r.mx, r.mx.eh, ret, "pkt.AvPacketRef failed")
+		r.p.put(bPkt)
+		return true
+	}
+
+	// Append pkt
+	r.buf = append(r.buf, &muxerReconnectorItem{
+		d:   d,
+		idx: idx,
+		pkt: bPkt,
+	})
+
+	// Drop oldest pkts
+	for len(r.buf) > r.o.MaxBufferedPkts {
+		r.p.put(r.buf[0].pkt)
+		r.buf = r.buf[1:]
+	}
+	return true
+}
+
+// start is executed in the muxer chan
+func (r *muxerReconnector) start() {
+	// Lock
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	// Muxer is already reconnecting
+	if r.reconnecting {
+		return
+	}
+	r.reconnecting = true
+
+	// Send event
+	r.mx.eh.Emit(astiencoder.Event{
+		Name:    EventNameMuxerDisconnected,
+		Payload: r.mx.opts.URL,
+		Target:  r.mx,
+	})
+
+	// Reconnect
+	r.t.NewSubTask().Do(r.reconnect)
+}
+
+func (r *muxerReconnector) reconnect() {
+	// Loop through attempts
+	backoff := r.o.Backoff
+	for attempt := 1; ; attempt++ {
+		// Wait
+		select {
+		case <-time.After(backoff):
+		case <-r.ctx.Done():
+			return
+		}
+
+		// Reopen
+		// No pkts are written in the meantime since the muxer is reconnecting
+		ctxFormat, cl, d, err := r.mx.reopen()
+		if err != nil {
+			// Send error
+			r.mx.eh.Emit(astiencoder.EventError(r.mx, fmt.Errorf("astilibav: reconnecting to %s failed: %w", r.mx.opts.URL, err)))
+
+			// Max number of retries has been reached
+			if r.o.MaxRetries > 0 && attempt >= r.o.MaxRetries {
+				r.fail(fmt.Errorf("astilibav: max number of retries %d reached, stopping", r.o.MaxRetries))
+				return
+			}
+
+			// Update backoff
+			if backoff *= 2; backoff > r.o.MaxBackoff {
+				backoff = r.o.MaxBackoff
+			}
+			continue
+		}
+
+		// Replace the format ctx and write buffered pkts in the chan so that nothing else uses the format ctx in the
+		// meantime and buffered pkts are written before the next pkts
+		r.add(func() {
+			// Replace
+			if !r.mx.replace(ctxFormat, cl, d) {
+				return
+			}
+
+			// Send event
+			r.mx.eh.Emit(astiencoder.Event{
+				Name:    EventNameMuxerReconnected,
+				Payload: r.mx.opts.URL,
+				Target:  r.mx,
+			})
+
+			// Flush
+			r.flush()
+		})
+		return
+	}
+}
+
+func (r *muxerReconnector) flush() {
+	// Get buffered pkts
+	r.m.Lock()
+	buf := r.buf
+	r.buf = nil
+	r.reconnecting = false
+	r.m.Unlock()
+
+	// Loop through buffered pkts
+	for idx, i := range buf {
+		// Write pkt
+		ret := r.mx.writePkt(i.pkt, i.d, r.mx.ctxFormat.Streams()[i.idx])
+		r.p.put(i.pkt)
+		if ret < 0 {
+			emitAvError(r.mx, r.mx.eh, ret, "r.mx.ctxFormat.AvInterleavedWriteFrame failed")
+
+			// Reconnect
+			r.start()
+
+			// Remaining pkts are written once reconnected
+			r.m.Lock()
+			r.buf = append(buf[idx+1:], r.buf...)
+			r.m.Unlock()
+			return
+		}
+	}
+}
+
+// reopen creates a new format ctx whose streams are the same, and writes its header
+// Its IO is opened the same way it was when the muxer was created, and is closed by the returned closer
+func (m *Muxer) reopen() (ctxFormat *avformat.Context, cl *astikit.Closer, d time.Duration, err error) {
+	// Alloc format context
+	// We need to create an intermediate variable to avoid "cgo argument has Go pointer to Go pointer" errors
+	if ret := avformat.AvformatAllocOutputContext2(&ctxFormat, m.opts.Format, m.opts.FormatName, m.opts.URL); ret < 0 {
+		err = fmt.Errorf("astilibav: avformat.AvformatAllocOutputContext2 on %s failed: %w", m.opts.URL, NewAvError(ret))
+		return
+	}
+
+	// Make sure everything is freed in case of error
+	cl = astikit.NewCloser()
+	defer func() {
+		if err != nil {
+			cl.Close()
+			ctxFormat.AvformatFreeContext()
+		}
+	}()
+
+	// Clone streams
+	for _, i := range m.ctxFormat.Streams() {
+		var o *avformat.Stream
+		if o, err = CloneStream(i, ctxFormat); err != nil {
+			err = fmt.Errorf("astilibav: cloning stream %d failed: %w", i.Index(), err)
+			return
+		}
+		o.SetTimeBase(i.TimeBase())
+	}
+
+	// Copy tags
+	if err = copyMetadata(ctxFormat, m.ctxFormat); err != nil {
+		err = fmt.Errorf("astilibav: copying metadata failed: %w", err)
+		return
+	}
+
+	// Open IO
+	if err = m.openIO(ctxFormat, cl); err != nil {
+		err = fmt.Errorf("astilibav: opening io failed: %w", err)
+		return
+	}
+
+	// Create dict
+	var dict *avutil.Dictionary
+	if dict, err = newDict(m.opts.Dict, m.opts.Dictionary); err != nil {
+		err = fmt.Errorf("astilibav: creating dict failed: %w", err)
+		return
+	}
+	defer avutil.AvDictFree(&dict)
+
+	// Write header
+	n := time.Now()
+	if ret := ctxFormat.AvformatWriteHeader(&dict); ret < 0 {
+		err = fmt.Errorf("astilibav: ctxFormat.AvformatWriteHeader on %s failed: %w", m.opts.URL, NewAvError(ret))
+		return
+	}
+	d = time.Since(n)
+	return
+}
+
+// replace is executed in the chan and replaces the format ctx with a reopened one
+// It returns false if the muxer has been finished in the meantime, in which case the reopened format ctx is freed
+func (m *Muxer) replace(ctxFormat *avformat.Context, cl *astikit.Closer, d time.Duration) bool {
+	// Muxer has been finished
+	if m.finished {
+		if err := cl.Close(); err != nil {
+			m.eh.Emit(astiencoder.EventError(m, fmt.Errorf("astilibav: closing reopened io failed: %w", err)))
+		}
+		ctxFormat.AvformatFreeContext()
+		return false
+	}
+
+	// Close previous IO before freeing the previous format ctx since its closers reference it
+	// Its pb is broken, therefore no trailer is written
+	if err := m.clIO.Close(); err != nil {
+		m.eh.Emit(astiencoder.EventError(m, fmt.Errorf("astilibav: closing previous io failed: %w", err)))
+	}
+	m.ctxFormat.AvformatFreeContext()
+
+	// Replace format ctx
+	m.ctxFormat = ctxFormat
+	m.clIO = cl
+
+	// Send event
+	m.emitWrite(EventNameMuxerHeaderWritten, d)
+	return true
+}
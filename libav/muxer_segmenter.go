@@ -0,0 +1,209 @@
+package astilibav
+
+//#cgo pkg-config: libavformat libavutil
+//#include <stdint.h>
+//#include <libavformat/avformat.h>
+//extern void goAstilibavMuxerSegmenterOpened(AVFormatContext *s, AVIOContext *pb, char *url);
+//extern void goAstilibavMuxerSegmenterClosed(AVFormatContext *s, AVIOContext *pb);
+//// Segmenting muxers open and close each file through the format ctx callbacks, and pass them to the nested format
+//// ctxs they create, along with the opaque
+//static int (*astilibav_muxer_segmenter_io_open_default)(AVFormatContext *s, AVIOContext **pb, const char *url, int flags, AVDictionary **options);
+//static int astilibav_muxer_segmenter_io_open(AVFormatContext *s, AVIOContext **pb, const char *url, int flags, AVDictionary **options) {
+//	int ret = astilibav_muxer_segmenter_io_open_default(s, pb, url, flags, options);
+//	if (ret >= 0 && (flags & AVIO_FLAG_WRITE)) goAstilibavMuxerSegmenterOpened(s, *pb, (char *)url);
+//	return ret;
+//}
+//// io_close has been replaced by io_close2 in libavformat 59.16 (ffmpeg 5.0)
+//#if LIBAVFORMAT_VERSION_INT >= AV_VERSION_INT(59, 16, 100)
+//static int (*astilibav_muxer_segmenter_io_close_default)(AVFormatContext *s, AVIOContext *pb);
+//static int astilibav_muxer_segmenter_io_close(AVFormatContext *s, AVIOContext *pb) {
+//	int ret = astilibav_muxer_segmenter_io_close_default(s, pb);
+//	goAstilibavMuxerSegmenterClosed(s, pb);
+//	return ret;
+//}
+//#else
+//static void (*astilibav_muxer_segmenter_io_close_default)(AVFormatContext *s, AVIOContext *pb);
+//static void astilibav_muxer_segmenter_io_close(AVFormatContext *s, AVIOContext *pb) {
+//	astilibav_muxer_segmenter_io_close_default(s, pb);
+//	goAstilibavMuxerSegmenterClosed(s, pb);
+//}
+//#endif
+//static void astilibav_muxer_segmenter_hook(AVFormatContext *s, uintptr_t id) {
+//	s->opaque = (void *)id;
+//	astilibav_muxer_segmenter_io_open_default = s->io_open;
+//	s->io_open = astilibav_muxer_segmenter_io_open;
+//#if LIBAVFORMAT_VERSION_INT >= AV_VERSION_INT(59, 16, 100)
+//	astilibav_muxer_segmenter_io_close_default = s->io_close2;
+//	s->io_close2 = astilibav_muxer_segmenter_io_close;
+//#else
+//	astilibav_muxer_segmenter_io_close_default = s->io_close;
+//	s->io_close = astilibav_muxer_segmenter_io_close;
+//#endif
+//}
+import "C"
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avformat"
+)
+
+// Muxer segmenter formats
+const (
+	MuxerSegmenterFormatDASH = "dash"
+	MuxerSegmenterFormatHLS  = "hls"
+)
+
+// MuxerSegmenterOptions represents muxer segmenter options
+// When provided, the muxer URL is the URL of the playlist (.m3u8) or of the manifest (.mpd), and an event is sent
+// every time a segment has been completely written
+type MuxerSegmenterOptions struct {
+	// Possible values are "dash" and "hls". Defaults to "hls"
+	Format string
+	// Only used by HLS. If true, segments are fragmented mp4 instead of MPEG-TS
+	FragmentedMP4 bool
+	// Template used to generate the init segment names, such as "init-$RepresentationID$.m4s" for DASH or "init.mp4"
+	// for HLS
+	InitSegmentTemplate string
+	// Number of segments kept in the playlist. If 0, all segments are kept
+	PlaylistSize    int
+	SegmentDuration time.Duration
+	// Template used to generate the segment names, such as "chunk-$RepresentationID$-$Number%05d$.m4s" for DASH or
+	// "segment-%05d.ts" for HLS
+	SegmentTemplate string
+}
+
+func (o MuxerSegmenterOptions) formatName() string {
+	if o.Format == MuxerSegmenterFormatDASH {
+		return MuxerSegmenterFormatDASH
+	}
+	return MuxerSegmenterFormatHLS
+}
+
+// dict returns the private options of the segmenting format
+func (o MuxerSegmenterOptions) dict() string {
+	var ds []string
+	switch o.formatName() {
+	case MuxerSegmenterFormatDASH:
+		if o.InitSegmentTemplate != "" {
+			ds = append(ds, "init_seg_name="+o.InitSegmentTemplate)
+		}
+		if o.SegmentTemplate != "" {
+			ds = append(ds, "media_seg_name="+o.SegmentTemplate)
+		}
+		if o.SegmentDuration > 0 {
+			ds = append(ds, fmt.Sprintf("seg_duration=%g", o.SegmentDuration.Seconds()))
+		}
+		ds = append(ds, fmt.Sprintf("window_size=%d", o.PlaylistSize))
+	default:
+		if o.FragmentedMP4 {
+			ds = append(ds, "hls_segment_type=fmp4")
+			if o.InitSegmentTemplate != "" {
+				ds = append(ds, "hls_fmp4_init_filename="+o.InitSegmentTemplate)
+			}
+		}
+		if o.SegmentTemplate != "" {
+			ds = append(ds, "hls_segment_filename="+o.SegmentTemplate)
+		}
+		if o.SegmentDuration > 0 {
+			ds = append(ds, fmt.Sprintf("hls_time=%g", o.SegmentDuration.Seconds()))
+		}
+		ds = append(ds, fmt.Sprintf("hls_list_size=%d", o.PlaylistSize))
+	}
+	return strings.Join(ds, ",")
+}
+
+// Opaque pointers can't hold Go pointers, therefore segmenters are indexed by id
+var (
+	countMuxerSegmenter  uintptr
+	muxerSegmenters      = make(map[uintptr]*muxerSegmenter)
+	muxerSegmentersMutex = &sync.Mutex{}
+)
+
+type muxerSegmenter struct {
+	m    *Muxer
+	mu   *sync.Mutex
+	urls map[*C.AVIOContext]string
+}
+
+func muxerSegmenterFromCtx(s *C.AVFormatContext) (sg *muxerSegmenter, ok bool) {
+	muxerSegmentersMutex.Lock()
+	defer muxerSegmentersMutex.Unlock()
+	sg, ok = muxerSegmenters[uintptr(s.opaque)]
+	return
+}
+
+//export goAstilibavMuxerSegmenterOpened
+func goAstilibavMuxerSegmenterOpened(s *C.AVFormatContext, pb *C.AVIOContext, url *C.char) {
+	// Get segmenter
+	sg, ok := muxerSegmenterFromCtx(s)
+	if !ok {
+		return
+	}
+
+	// Store url
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+	sg.urls[pb] = C.GoString(url)
+}
+
+//export goAstilibavMuxerSegmenterClosed
+func goAstilibavMuxerSegmenterClosed(s *C.AVFormatContext, pb *C.AVIOContext) {
+	// Get segmenter
+	sg, ok := muxerSegmenterFromCtx(s)
+	if !ok {
+		return
+	}
+
+	// Get url
+	sg.mu.Lock()
+	url, ok := sg.urls[pb]
+	delete(sg.urls, pb)
+	sg.mu.Unlock()
+	if !ok || muxerSegmenterIsPlaylist(url) {
+		return
+	}
+
+	// Send event
+	sg.m.eh.Emit(astiencoder.Event{
+		Name:    EventNameMuxerSegmentDone,
+		Payload: url,
+		Target:  sg.m,
+	})
+}
+
+// Playlists and manifests may be written to a temporary file first
+func muxerSegmenterIsPlaylist(url string) bool {
+	url = strings.TrimSuffix(url, ".tmp")
+	return strings.HasSuffix(url, ".m3u8") || strings.HasSuffix(url, ".mpd")
+}
+
+// hookMuxerSegmenter makes sure an event is sent every time a segment written by the format ctx is closed
+func hookMuxerSegmenter(m *Muxer, ctxFormat *avformat.Context, c *astikit.Closer) {
+	// Register segmenter
+	muxerSegmentersMutex.Lock()
+	countMuxerSegmenter++
+	id := countMuxerSegmenter
+	muxerSegmenters[id] = &muxerSegmenter{
+		m:    m,
+		mu:   &sync.Mutex{},
+		urls: make(map[*C.AVIOContext]string),
+	}
+	muxerSegmentersMutex.Unlock()
+
+	// Make sure the segmenter is unregistered once the trailer has been written
+	c.Add(func() error {
+		muxerSegmentersMutex.Lock()
+		delete(muxerSegmenters, id)
+		muxerSegmentersMutex.Unlock()
+		return nil
+	})
+
+	// Hook
+	C.astilibav_muxer_segmenter_hook((*C.struct_AVFormatContext)(unsafe.Pointer(ctxFormat)), C.uintptr_t(id))
+}
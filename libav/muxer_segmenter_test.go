@@ -0,0 +1,37 @@
+package astilibav
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMuxerSegmenterOptions(t *testing.T) {
+	o := MuxerSegmenterOptions{
+		PlaylistSize:    5,
+		SegmentDuration: 2 * time.Second,
+		SegmentTemplate: "segment-%05d.ts",
+	}
+	assert.Equal(t, MuxerSegmenterFormatHLS, o.formatName())
+	assert.Equal(t, "hls_segment_filename=segment-%05d.ts,hls_time=2,hls_list_size=5", o.dict())
+	o.FragmentedMP4 = true
+	o.InitSegmentTemplate = "init.mp4"
+	o.SegmentDuration = 1500 * time.Millisecond
+	o.SegmentTemplate = "segment-%05d.m4s"
+	assert.Equal(t, "hls_segment_type=fmp4,hls_fmp4_init_filename=init.mp4,hls_segment_filename=segment-%05d.m4s,hls_time=1.5,hls_list_size=5", o.dict())
+	o = MuxerSegmenterOptions{
+		Format:              MuxerSegmenterFormatDASH,
+		InitSegmentTemplate: "init-$RepresentationID$.m4s",
+		SegmentDuration:     4 * time.Second,
+	}
+	assert.Equal(t, MuxerSegmenterFormatDASH, o.formatName())
+	assert.Equal(t, "init_seg_name=init-$RepresentationID$.m4s,seg_duration=4,window_size=0", o.dict())
+}
+
+func TestMuxerSegmenterIsPlaylist(t *testing.T) {
+	assert.True(t, muxerSegmenterIsPlaylist("/tmp/index.m3u8"))
+	assert.True(t, muxerSegmenterIsPlaylist("/tmp/index.m3u8.tmp"))
+	assert.True(t, muxerSegmenterIsPlaylist("/tmp/manifest.mpd"))
+	assert.False(t, muxerSegmenterIsPlaylist("/tmp/segment-00001.ts"))
+}
@@ -0,0 +1,129 @@
+package astilibav
+
+//#cgo pkg-config: libavformat libavutil
+//#include <stdint.h>
+//#include <libavformat/avformat.h>
+//#include <libavutil/mem.h>
+//extern int goAstilibavTSAnalyzerWrite(void *opaque, uint8_t *buf, int size);
+//// The write callback takes a const buffer since libavformat 61 (ffmpeg 7.0)
+//#if LIBAVFORMAT_VERSION_MAJOR >= 61
+//static int astilibav_ts_analyzer_write(void *opaque, const uint8_t *buf, int size) { return goAstilibavTSAnalyzerWrite(opaque, (uint8_t *)buf, size); }
+//#else
+//static int astilibav_ts_analyzer_write(void *opaque, uint8_t *buf, int size) { return goAstilibavTSAnalyzerWrite(opaque, buf, size); }
+//#endif
+//static AVIOContext *astilibav_ts_analyzer_alloc(int size, uintptr_t id) {
+//	unsigned char *b = av_malloc(size);
+//	if (!b) return NULL;
+//	AVIOContext *c = avio_alloc_context(b, size, 1, (void *)id, NULL, astilibav_ts_analyzer_write, NULL);
+//	if (!c) av_free(b);
+//	return c;
+//}
+//static void astilibav_ts_analyzer_free(AVIOContext *c) {
+//	avio_flush(c);
+//	av_freep(&c->buffer);
+//	avio_context_free(&c);
+//}
+import "C"
+import (
+	"errors"
+	"io"
+	"sync"
+	"unsafe"
+
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avformat"
+)
+
+// Opaque pointers can't hold Go pointers, therefore writers are indexed by id
+var (
+	countTSAnalyzerWriter  uintptr
+	tsAnalyzerWriters      = make(map[uintptr]*tsAnalyzerWriter)
+	tsAnalyzerWritersMutex = &sync.Mutex{}
+)
+
+type tsAnalyzerWriter struct {
+	a  *tsAnalyzer
+	pb *C.AVIOContext
+	ws []io.Writer
+}
+
+//export goAstilibavTSAnalyzerWrite
+func goAstilibavTSAnalyzerWrite(opaque unsafe.Pointer, buf *C.uint8_t, size C.int) C.int {
+	// Get writer
+	tsAnalyzerWritersMutex.Lock()
+	w, ok := tsAnalyzerWriters[uintptr(opaque)]
+	tsAnalyzerWritersMutex.Unlock()
+	if !ok {
+		return -1
+	}
+
+	// Analyze
+	if size > 0 {
+		b := (*[1 << 30]byte)(unsafe.Pointer(buf))[:size:size]
+		w.a.write(b)
+		for _, ww := range w.ws {
+			ww.Write(b)
+		}
+	}
+
+	// Write
+	C.avio_write(w.pb, (*C.uchar)(unsafe.Pointer(buf)), size)
+	if w.pb.error < 0 {
+		return w.pb.error
+	}
+	return size
+}
+
+// wrapTSAnalyzer replaces the format pb with one analyzing the MPEG-TS stream and copying it to the provided writers
+// before writing to the original pb
+// The analyzer can be reused when the format ctx is replaced so that stats are kept
+func wrapTSAnalyzer(ctxFormat *avformat.Context, a *tsAnalyzer, ws []io.Writer, c *astikit.Closer) (err error) {
+	// No pb
+	cf := (*C.struct_AVFormatContext)(unsafe.Pointer(ctxFormat))
+	if cf.pb == nil {
+		err = errors.New("astilibav: no pb to wrap")
+		return
+	}
+
+	// Get buffer size
+	size := C.int(7 * tsPacketSize)
+	if cf.pb.max_packet_size > 0 {
+		size = cf.pb.max_packet_size
+	}
+
+	// Register writer
+	orig := cf.pb
+	tsAnalyzerWritersMutex.Lock()
+	countTSAnalyzerWriter++
+	id := countTSAnalyzerWriter
+	tsAnalyzerWriters[id] = &tsAnalyzerWriter{
+		a:  a,
+		pb: orig,
+		ws: ws,
+	}
+	tsAnalyzerWritersMutex.Unlock()
+
+	// Alloc pb
+	pb := C.astilibav_ts_analyzer_alloc(size, C.uintptr_t(id))
+	if pb == nil {
+		tsAnalyzerWritersMutex.Lock()
+		delete(tsAnalyzerWriters, id)
+		tsAnalyzerWritersMutex.Unlock()
+		err = errors.New("astilibav: allocating pb failed")
+		return
+	}
+
+	// Make sure the pb is flushed and freed before the original pb is closed
+	c.Add(func() error {
+		C.astilibav_ts_analyzer_free(pb)
+		cf.pb = orig
+		tsAnalyzerWritersMutex.Lock()
+		delete(tsAnalyzerWriters, id)
+		tsAnalyzerWritersMutex.Unlock()
+		return nil
+	})
+
+	// Replace pb
+	cf.pb = pb
+	return
+}
@@ -0,0 +1,120 @@
+package astilibav
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+)
+
+// Size of a MPEG-TS packet
+const tsPacketSize = 188
+
+// UDPTSMuxerOptions represents UDP MPEG-TS muxer options
+type UDPTSMuxerOptions struct {
+	// If true, the output is padded with null packets to hold exactly the mux rate, datagrams are sent at a constant
+	// rate and MPEG-TS stats are added. Mux rate is mandatory in that case
+	CBR  bool
+	Host string
+	// Local address the socket is bound to. If empty, the system picks one
+	LocalAddr string
+	// Local port the socket is bound to. If 0, the system picks one
+	LocalPort int
+	// Mux rate in bits per second. If 0, the output is VBR
+	MuxRate int
+	Node    astiencoder.NodeOptions
+	// If 0, ffmpeg's default is used
+	PCRPeriod time.Duration
+	// Size of UDP datagrams. It must be a multiple of 188 and defaults to 1316 (7 TS packets)
+	PktSize   int
+	Port      int
+	Restamper PktRestamper
+	// If 0, the system default is used
+	TTL int
+}
+
+// NewUDPTSMuxer creates a new muxer sending MPEG-TS over UDP
+func NewUDPTSMuxer(o UDPTSMuxerOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (m *Muxer, err error) {
+	// Get muxer options
+	var mo MuxerOptions
+	if mo, err = o.MuxerOptions(); err != nil {
+		err = fmt.Errorf("astilibav: getting muxer options failed: %w", err)
+		return
+	}
+
+	// Create muxer
+	return NewMuxer(mo, eh, c)
+}
+
+// MuxerOptions returns the muxer options matching the UDP MPEG-TS options
+func (o UDPTSMuxerOptions) MuxerOptions() (mo MuxerOptions, err error) {
+	// Check options
+	if o.Host == "" {
+		err = errors.New("astilibav: no host provided")
+		return
+	} else if o.Port <= 0 {
+		err = errors.New("astilibav: no port provided")
+		return
+	} else if o.CBR && o.MuxRate <= 0 {
+		err = errors.New("astilibav: no mux rate provided in CBR mode")
+		return
+	}
+
+	// Default values
+	if o.PktSize == 0 {
+		o.PktSize = 7 * tsPacketSize
+	}
+
+	// Check packet size
+	if o.PktSize < 0 || o.PktSize%tsPacketSize != 0 {
+		err = fmt.Errorf("astilibav: packet size %d is not a multiple of %d", o.PktSize, tsPacketSize)
+		return
+	}
+
+	// Create url
+	u := url.URL{
+		Host:   net.JoinHostPort(o.Host, strconv.Itoa(o.Port)),
+		Scheme: "udp",
+	}
+
+	// Add url options
+	// Keys are sorted by url.Values
+	vs := url.Values{}
+	if o.CBR {
+		vs.Set("bitrate", strconv.Itoa(o.MuxRate))
+	}
+	if o.LocalAddr != "" {
+		vs.Set("localaddr", o.LocalAddr)
+	}
+	if o.LocalPort > 0 {
+		vs.Set("localport", strconv.Itoa(o.LocalPort))
+	}
+	vs.Set("pkt_size", strconv.Itoa(o.PktSize))
+	if o.TTL > 0 {
+		vs.Set("ttl", strconv.Itoa(o.TTL))
+	}
+	u.RawQuery = vs.Encode()
+
+	// Add format options
+	var dict string
+	if o.MuxRate > 0 {
+		dict = fmt.Sprintf("muxrate=%d", o.MuxRate)
+	}
+
+	// Create muxer options
+	mo = MuxerOptions{
+		Dict:        dict,
+		FormatName:  "mpegts",
+		Node:        o.Node,
+		Restamper:   o.Restamper,
+		TSPCRPeriod: o.PCRPeriod,
+		TSStats:     o.CBR,
+		URL:         u.String(),
+	}
+	return
+}
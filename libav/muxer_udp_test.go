@@ -0,0 +1,44 @@
+package astilibav
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUDPTSMuxerOptions(t *testing.T) {
+	_, err := UDPTSMuxerOptions{Port: 1234}.MuxerOptions()
+	assert.Error(t, err)
+	_, err = UDPTSMuxerOptions{Host: "239.0.0.1", PktSize: 1000, Port: 1234}.MuxerOptions()
+	assert.Error(t, err)
+	mo, err := UDPTSMuxerOptions{Host: "239.0.0.1", Port: 1234}.MuxerOptions()
+	assert.NoError(t, err)
+	assert.Equal(t, MuxerOptions{FormatName: "mpegts", URL: "udp://239.0.0.1:1234?pkt_size=1316"}, mo)
+	mo, err = UDPTSMuxerOptions{
+		Host:      "239.0.0.1",
+		LocalAddr: "10.0.0.1",
+		LocalPort: 5000,
+		MuxRate:   5000000,
+		PCRPeriod: 20 * time.Millisecond,
+		Port:      1234,
+		TTL:       16,
+	}.MuxerOptions()
+	assert.NoError(t, err)
+	assert.Equal(t, MuxerOptions{
+		Dict:        "muxrate=5000000",
+		FormatName:  "mpegts",
+		TSPCRPeriod: 20 * time.Millisecond,
+		URL:         "udp://239.0.0.1:1234?localaddr=10.0.0.1&localport=5000&pkt_size=1316&ttl=16",
+	}, mo)
+	_, err = UDPTSMuxerOptions{CBR: true, Host: "239.0.0.1", Port: 1234}.MuxerOptions()
+	assert.Error(t, err)
+	mo, err = UDPTSMuxerOptions{CBR: true, Host: "239.0.0.1", MuxRate: 1000000, Port: 1234}.MuxerOptions()
+	assert.NoError(t, err)
+	assert.Equal(t, MuxerOptions{
+		Dict:       "muxrate=1000000",
+		FormatName: "mpegts",
+		TSStats:    true,
+		URL:        "udp://239.0.0.1:1234?bitrate=1000000&pkt_size=1316",
+	}, mo)
+}
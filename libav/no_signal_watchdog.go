@@ -0,0 +1,238 @@
+package astilibav
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+)
+
+var countNoSignalWatchdog uint64
+
+// NoSignalWatchdog represents an object capable of raising an alarm when no pkt or frame has been received for a
+// configurable duration
+// It can be connected at any point of the workflow and doesn't forward anything
+type NoSignalWatchdog struct {
+	*astiencoder.BaseNode
+	alarm            *NoSignalAlarm
+	eh               *astiencoder.EventHandler
+	lastAt           time.Time
+	m                *sync.Mutex
+	o                NoSignalWatchdogOptions
+	statIncomingRate *astikit.CounterAvgStat
+}
+
+// NoSignalWatchdogOptions represents no signal watchdog options
+type NoSignalWatchdogOptions struct {
+	// Actions executed in order when the alarm is raised
+	AlarmActions []NoSignalWatchdogAction
+	Node         astiencoder.NodeOptions
+	// Defaults to 100ms
+	Period time.Duration
+	// Actions executed in order when the signal is restored
+	RestoreActions []NoSignalWatchdogAction
+	// Defaults to 5s
+	SilenceDuration time.Duration
+}
+
+// NoSignalAlarm represents a no signal alarm
+type NoSignalAlarm struct {
+	// Last time a pkt or a frame was received. If nothing has been received yet, it is the time the watchdog was started
+	LastAt time.Time
+	// Only set when the signal is restored
+	RestoredAt time.Time
+	RaisedAt   time.Time
+}
+
+// NoSignalWatchdogAction represents an action executed when the alarm is raised or the signal is restored
+type NoSignalWatchdogAction func(a NoSignalAlarm) error
+
+// NoSignalWatchdogActionSwitch returns an action switching the rate enforcer to the provided node, which can be a
+// backup input or a node generating a slate
+func NoSignalWatchdogActionSwitch(r *RateEnforcer, n astiencoder.Node) NoSignalWatchdogAction {
+	return func(a NoSignalAlarm) error {
+		r.Switch(n)
+		return nil
+	}
+}
+
+// NoSignalWatchdogActionRestart returns an action stopping the provided node, waiting for it to be stopped and
+// starting it again
+func NoSignalWatchdogActionRestart(ctx context.Context, n astiencoder.Node, t astiencoder.CreateTaskFunc) NoSignalWatchdogAction {
+	var done chan struct{}
+	return func(a NoSignalAlarm) (err error) {
+		// Stop
+		n.Stop()
+
+		// Wait for the previous task to be done otherwise its deferred calls may stop the new one or overwrite its
+		// status. When the node has not been started by this action, we can only rely on its status.
+		if done != nil {
+			select {
+			case <-done:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		} else if err = noSignalWatchdogWaitStopped(ctx, n); err != nil {
+			return
+		}
+
+		// Start
+		d := make(chan struct{})
+		n.Start(ctx, func() *astikit.Task {
+			// The node is given a sub task so that we know when it's done
+			pt := t()
+			st := pt.NewSubTask()
+			go func() {
+				pt.Wait()
+				pt.Done()
+				close(d)
+			}()
+			return st
+		})
+		done = d
+		return
+	}
+}
+
+func noSignalWatchdogWaitStopped(ctx context.Context, n astiencoder.Node) error {
+	tk := time.NewTicker(10 * time.Millisecond)
+	defer tk.Stop()
+	for n.Status() != astiencoder.StatusStopped {
+		select {
+		case <-tk.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// NewNoSignalWatchdog creates a new no signal watchdog
+func NewNoSignalWatchdog(o NoSignalWatchdogOptions, eh *astiencoder.EventHandler) (w *NoSignalWatchdog) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countNoSignalWatchdog, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("no_signal_watchdog_%d", count), fmt.Sprintf("No Signal Watchdog #%d", count), "Watches signal")
+
+	// Default values
+	if o.Period <= 0 {
+		o.Period = 100 * time.Millisecond
+	}
+	if o.SilenceDuration <= 0 {
+		o.SilenceDuration = 5 * time.Second
+	}
+
+	// Create watchdog
+	w = &NoSignalWatchdog{
+		eh:               eh,
+		m:                &sync.Mutex{},
+		o:                o,
+		statIncomingRate: astikit.NewCounterAvgStat(),
+	}
+	w.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(w), eh)
+	w.addStats()
+	return
+}
+
+func (w *NoSignalWatchdog) addStats() {
+	// Add incoming rate
+	w.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of packets or frames coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "ps",
+	}, w.statIncomingRate)
+}
+
+// Start starts the watchdog
+func (w *NoSignalWatchdog) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	w.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Reset
+		w.m.Lock()
+		w.alarm = nil
+		w.lastAt = time.Now()
+		w.m.Unlock()
+
+		// Create ticker
+		tk := time.NewTicker(w.o.Period)
+		defer tk.Stop()
+
+		// Loop
+		for {
+			select {
+			case n := <-tk.C:
+				w.check(n)
+			case <-w.Context().Done():
+				return
+			}
+		}
+	})
+}
+
+// HandlePkt implements the PktHandler interface
+func (w *NoSignalWatchdog) HandlePkt(p *PktHandlerPayload) {
+	w.handle(time.Now())
+}
+
+// HandleFrame implements the FrameHandler interface
+func (w *NoSignalWatchdog) HandleFrame(p *FrameHandlerPayload) {
+	w.handle(time.Now())
+}
+
+func (w *NoSignalWatchdog) handle(now time.Time) {
+	// Increment incoming rate
+	w.statIncomingRate.Add(1)
+
+	// Update last at
+	w.m.Lock()
+	w.lastAt = now
+	a := w.alarm
+	w.alarm = nil
+	w.m.Unlock()
+
+	// Signal is restored
+	if a != nil {
+		a.RestoredAt = now
+		w.emit(EventNameNoSignalWatchdogRestored, *a, w.o.RestoreActions)
+	}
+}
+
+func (w *NoSignalWatchdog) check(now time.Time) {
+	// Lock
+	w.m.Lock()
+
+	// Alarm has already been raised or silence is not long enough
+	if w.alarm != nil || now.Sub(w.lastAt) < w.o.SilenceDuration {
+		w.m.Unlock()
+		return
+	}
+
+	// Raise alarm
+	w.alarm = &NoSignalAlarm{
+		LastAt:   w.lastAt,
+		RaisedAt: now,
+	}
+	a := *w.alarm
+	w.m.Unlock()
+
+	// Emit
+	w.emit(EventNameNoSignalWatchdogAlarm, a, w.o.AlarmActions)
+}
+
+func (w *NoSignalWatchdog) emit(eventName string, a NoSignalAlarm, as []NoSignalWatchdogAction) {
+	// Send event
+	w.eh.Emit(astiencoder.Event{
+		Name:    eventName,
+		Payload: a,
+		Target:  w,
+	})
+
+	// Loop through actions
+	for idx, fn := range as {
+		if err := fn(a); err != nil {
+			w.eh.Emit(astiencoder.EventError(w, fmt.Errorf("astilibav: executing action #%d failed: %w", idx+1, err)))
+		}
+	}
+}
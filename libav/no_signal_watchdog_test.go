@@ -0,0 +1,76 @@
+package astilibav
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNoSignalWatchdog(t *testing.T) {
+	eh := astiencoder.NewEventHandler()
+	var es []string
+	var as []NoSignalAlarm
+	eh.AddForAll(func(e astiencoder.Event) bool {
+		if a, ok := e.Payload.(NoSignalAlarm); ok {
+			es = append(es, e.Name)
+			as = append(as, a)
+		}
+		return false
+	})
+	var actions int
+	w := NewNoSignalWatchdog(NoSignalWatchdogOptions{
+		AlarmActions: []NoSignalWatchdogAction{func(a NoSignalAlarm) error {
+			actions++
+			return nil
+		}},
+		SilenceDuration: time.Second,
+	}, eh)
+	n := time.Unix(0, 0)
+	w.lastAt = n
+	w.check(n.Add(500 * time.Millisecond))
+	assert.Equal(t, 0, len(es))
+	w.check(n.Add(time.Second))
+	w.check(n.Add(2 * time.Second))
+	assert.Equal(t, []string{EventNameNoSignalWatchdogAlarm}, es)
+	assert.Equal(t, 1, actions)
+	w.handle(n.Add(3 * time.Second))
+	assert.Equal(t, []string{EventNameNoSignalWatchdogAlarm, EventNameNoSignalWatchdogRestored}, es)
+	assert.Equal(t, NoSignalAlarm{LastAt: n, RaisedAt: n.Add(time.Second), RestoredAt: n.Add(3 * time.Second)}, as[1])
+	w.check(n.Add(3500 * time.Millisecond))
+	assert.Equal(t, 2, len(es))
+}
+
+func TestNoSignalWatchdogActionRestart(t *testing.T) {
+	eh := astiencoder.NewEventHandler()
+	m := &sync.Mutex{}
+	var es []string
+	eh.AddForAll(func(e astiencoder.Event) bool {
+		if e.Name == astiencoder.EventNameNodeStarted || e.Name == astiencoder.EventNameNodeStopped {
+			m.Lock()
+			es = append(es, e.Name)
+			m.Unlock()
+		}
+		return false
+	})
+	w := NewNoSignalWatchdog(NoSignalWatchdogOptions{}, eh)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wk := astikit.NewWorker(astikit.WorkerOptions{})
+	w.Start(ctx, wk.NewTask)
+	fn := NoSignalWatchdogActionRestart(ctx, w, wk.NewTask)
+	assert.NoError(t, fn(NoSignalAlarm{}))
+	assert.Equal(t, astiencoder.StatusRunning, w.Status())
+	assert.NoError(t, fn(NoSignalAlarm{}))
+	assert.Equal(t, astiencoder.StatusRunning, w.Status())
+	cancel()
+	wk.Stop()
+	wk.Wait()
+	m.Lock()
+	defer m.Unlock()
+	assert.Equal(t, []string{astiencoder.EventNameNodeStopped, astiencoder.EventNameNodeStarted, astiencoder.EventNameNodeStopped}, es[3:])
+}
@@ -0,0 +1,144 @@
+package astilibav
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avutil"
+)
+
+// ownership keeps track of whether a wrapped frame or pkt can still be used
+// A borrowed one belongs to the node that handed it to a callback and is only valid until the callback returns.
+// Using it afterwards panics instead of silently reading memory that may have been reused by the node. An owned
+// one is created with Ref and is valid until Unref is called
+type ownership struct {
+	name     string
+	owned    bool
+	released int32
+}
+
+func (o *ownership) check() {
+	if atomic.LoadInt32(&o.released) > 0 {
+		if o.owned {
+			panic(fmt.Sprintf("astilibav: %s used after being unref-ed", o.name))
+		}
+		panic(fmt.Sprintf("astilibav: borrowed %s used after its callback returned", o.name))
+	}
+}
+
+func (o *ownership) release() {
+	atomic.StoreInt32(&o.released, 1)
+}
+
+func (o *ownership) unref() {
+	if !o.owned {
+		panic(fmt.Sprintf("astilibav: borrowed %s can't be unref-ed, Ref it first", o.name))
+	}
+	if !atomic.CompareAndSwapInt32(&o.released, 0, 1) {
+		panic(fmt.Sprintf("astilibav: %s unref-ed twice", o.name))
+	}
+}
+
+// Owned indicates whether the wrapper has been created with Ref and must therefore be unref-ed
+func (o *ownership) Owned() bool {
+	return o.owned
+}
+
+// Frame wraps a frame handed to a callback and makes its ownership explicit
+type Frame struct {
+	ownership
+	f *avutil.Frame
+}
+
+// BorrowFrame hands a borrowed frame to the callback. The borrowed frame is no longer valid once the callback returns
+func BorrowFrame(f *avutil.Frame, fn func(f *Frame) error) error {
+	b := &Frame{
+		f:         f,
+		ownership: ownership{name: "frame"},
+	}
+	defer b.release()
+	return fn(b)
+}
+
+// MustNotOutlive returns the wrapped frame which must not be used once the wrapper is no longer valid
+func (f *Frame) MustNotOutlive() *avutil.Frame {
+	f.check()
+	return f.f
+}
+
+// Ref creates an owned frame referencing the same data, which allows keeping it after the callback returns
+func (f *Frame) Ref() (o *Frame, err error) {
+	// Check
+	f.check()
+
+	// Ref
+	o = &Frame{
+		f:         defaultBindings.frameAlloc(),
+		ownership: ownership{name: "frame", owned: true},
+	}
+	if ret := defaultBindings.frameRef(o.f, f.f); ret < 0 {
+		defaultBindings.frameFree(o.f)
+		err = fmt.Errorf("astilibav: avutil.AvFrameRef failed: %w", NewAvError(ret))
+		return
+	}
+
+	// Set finalizer
+	setFrameFinalizer(o)
+	return
+}
+
+// Unref releases an owned frame. Unref-ing a borrowed frame panics
+func (f *Frame) Unref() {
+	f.unref()
+	defaultBindings.frameFree(f.f)
+}
+
+// Pkt wraps a pkt handed to a callback and makes its ownership explicit
+type Pkt struct {
+	ownership
+	pkt *avcodec.Packet
+}
+
+// BorrowPkt hands a borrowed pkt to the callback. The borrowed pkt is no longer valid once the callback returns
+func BorrowPkt(pkt *avcodec.Packet, fn func(pkt *Pkt) error) error {
+	b := &Pkt{
+		ownership: ownership{name: "pkt"},
+		pkt:       pkt,
+	}
+	defer b.release()
+	return fn(b)
+}
+
+// MustNotOutlive returns the wrapped pkt which must not be used once the wrapper is no longer valid
+func (p *Pkt) MustNotOutlive() *avcodec.Packet {
+	p.check()
+	return p.pkt
+}
+
+// Ref creates an owned pkt referencing the same data, which allows keeping it after the callback returns
+func (p *Pkt) Ref() (o *Pkt, err error) {
+	// Check
+	p.check()
+
+	// Ref
+	o = &Pkt{
+		ownership: ownership{name: "pkt", owned: true},
+		pkt:       defaultBindings.pktAlloc(),
+	}
+	if ret := defaultBindings.pktRef(o.pkt, p.pkt); ret < 0 {
+		defaultBindings.pktFree(o.pkt)
+		err = fmt.Errorf("astilibav: pkt.AvPacketRef failed: %w", NewAvError(ret))
+		return
+	}
+
+	// Set finalizer
+	setPktFinalizer(o)
+	return
+}
+
+// Unref releases an owned pkt. Unref-ing a borrowed pkt panics
+func (p *Pkt) Unref() {
+	p.unref()
+	defaultBindings.pktFree(p.pkt)
+}
@@ -0,0 +1,30 @@
+//go:build astilibavdebug
+// +build astilibavdebug
+
+package astilibav
+
+import (
+	"log"
+	"runtime"
+	"sync/atomic"
+)
+
+// In debug builds, owned frames and pkts that are garbage collected without having been unref-ed are reported and
+// unref-ed so that leaks can be spotted without crashing
+func setFrameFinalizer(f *Frame) {
+	runtime.SetFinalizer(f, func(f *Frame) {
+		if atomic.LoadInt32(&f.released) == 0 {
+			log.Println("astilibav: owned frame garbage collected without being unref-ed")
+			f.Unref()
+		}
+	})
+}
+
+func setPktFinalizer(p *Pkt) {
+	runtime.SetFinalizer(p, func(p *Pkt) {
+		if atomic.LoadInt32(&p.released) == 0 {
+			log.Println("astilibav: owned pkt garbage collected without being unref-ed")
+			p.Unref()
+		}
+	})
+}
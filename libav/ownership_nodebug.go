@@ -0,0 +1,8 @@
+//go:build !astilibavdebug
+// +build !astilibavdebug
+
+package astilibav
+
+func setFrameFinalizer(f *Frame) {}
+
+func setPktFinalizer(p *Pkt) {}
@@ -0,0 +1,79 @@
+package astilibav
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockedBindings struct {
+	goavBindings
+	frees int
+	refs  int
+}
+
+func (b *mockedBindings) frameAlloc() *avutil.Frame { return &avutil.Frame{} }
+
+func (b *mockedBindings) frameFree(f *avutil.Frame) { b.frees++ }
+
+func (b *mockedBindings) frameRef(dst, src *avutil.Frame) int {
+	b.refs++
+	return 0
+}
+
+func (b *mockedBindings) pktAlloc() *avcodec.Packet { return &avcodec.Packet{} }
+
+func (b *mockedBindings) pktFree(pkt *avcodec.Packet) { b.frees++ }
+
+func (b *mockedBindings) pktRef(dst, src *avcodec.Packet) int {
+	b.refs++
+	return 0
+}
+
+func TestBorrowFrame(t *testing.T) {
+	b := &mockedBindings{}
+	defaultBindings = b
+	defer func() { defaultBindings = goavBindings{} }()
+
+	f := &avutil.Frame{}
+	var bf, of *Frame
+	err := BorrowFrame(f, func(v *Frame) (err error) {
+		bf = v
+		assert.False(t, v.Owned())
+		assert.Equal(t, f, v.MustNotOutlive())
+		assert.Panics(t, func() { v.Unref() })
+		of, err = v.Ref()
+		return errors.New("test")
+	})
+	assert.EqualError(t, err, "test")
+	assert.Panics(t, func() { bf.MustNotOutlive() })
+	assert.Equal(t, 1, b.refs)
+	assert.True(t, of.Owned())
+	assert.NotNil(t, of.MustNotOutlive())
+	of.Unref()
+	assert.Equal(t, 1, b.frees)
+	assert.Panics(t, func() { of.MustNotOutlive() })
+	assert.Panics(t, func() { of.Unref() })
+}
+
+func TestBorrowPkt(t *testing.T) {
+	b := &mockedBindings{}
+	defaultBindings = b
+	defer func() { defaultBindings = goavBindings{} }()
+
+	pkt := &avcodec.Packet{}
+	var bp, op *Pkt
+	assert.NoError(t, BorrowPkt(pkt, func(v *Pkt) (err error) {
+		bp = v
+		assert.Equal(t, pkt, v.MustNotOutlive())
+		op, err = v.Ref()
+		return
+	}))
+	assert.Panics(t, func() { bp.MustNotOutlive() })
+	op.Unref()
+	assert.Equal(t, 1, b.refs)
+	assert.Equal(t, 1, b.frees)
+}
@@ -0,0 +1,249 @@
+package astilibav
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+)
+
+var countPerceptualHasher uint64
+
+// Perceptual hash algorithms
+const (
+	PerceptualHashAlgorithmDHash = "dhash"
+	PerceptualHashAlgorithmPHash = "phash"
+)
+
+// PerceptualHasher represents an object capable of computing perceptual hashes of sampled video frames
+// Hashes are computed on the first plane of each frame, which is luma for YUV pixel formats
+type PerceptualHasher struct {
+	*astiencoder.BaseNode
+	c                *astikit.Chan
+	eh               *astiencoder.EventHandler
+	lastPts          *time.Duration
+	o                PerceptualHasherOptions
+	statIncomingRate *astikit.CounterAvgStat
+	statWorkRatio    *astikit.DurationPercentageStat
+}
+
+// PerceptualHasherOptions represents perceptual hasher options
+type PerceptualHasherOptions struct {
+	// Defaults to dhash
+	Algorithm string
+	// Minimum duration between 2 hashed frames. If 0, every frame is hashed
+	Interval time.Duration
+	Node     astiencoder.NodeOptions
+}
+
+// PerceptualHash represents a perceptual hash
+type PerceptualHash struct {
+	Algorithm string
+	Pts       time.Duration
+	Value     uint64
+}
+
+// Distance returns the hamming distance between 2 hashes
+func (h PerceptualHash) Distance(i PerceptualHash) int {
+	return bits.OnesCount64(h.Value ^ i.Value)
+}
+
+// NewPerceptualHasher creates a new perceptual hasher
+func NewPerceptualHasher(o PerceptualHasherOptions, eh *astiencoder.EventHandler) (h *PerceptualHasher, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countPerceptualHasher, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("perceptual_hasher_%d", count), fmt.Sprintf("Perceptual Hasher #%d", count), "Hashes frames")
+
+	// Default values
+	if o.Algorithm == "" {
+		o.Algorithm = PerceptualHashAlgorithmDHash
+	}
+
+	// Create perceptual hasher
+	h = &PerceptualHasher{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh:               eh,
+		o:                o,
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statWorkRatio:    astikit.NewDurationPercentageStat(),
+	}
+	h.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(h), eh)
+	h.addStats()
+
+	// Check algorithm
+	switch o.Algorithm {
+	case PerceptualHashAlgorithmDHash, PerceptualHashAlgorithmPHash:
+	default:
+		err = fmt.Errorf("astilibav: invalid algorithm %s", o.Algorithm)
+		return
+	}
+	return
+}
+
+func (h *PerceptualHasher) addStats() {
+	// Add incoming rate
+	h.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of frames coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "fps",
+	}, h.statIncomingRate)
+
+	// Add work ratio
+	h.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, h.statWorkRatio)
+
+	// Add chan stats
+	h.c.AddStats(h.Stater())
+}
+
+// Start starts the perceptual hasher
+func (h *PerceptualHasher) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	h.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to stop the chan properly
+		defer h.c.Stop()
+
+		// Start chan
+		h.c.Start(h.Context())
+	})
+}
+
+// HandleFrame implements the FrameHandler interface
+func (h *PerceptualHasher) HandleFrame(p *FrameHandlerPayload) {
+	h.c.Add(func() {
+		// Handle pause
+		defer h.HandlePause()
+
+		// Increment incoming rate
+		h.statIncomingRate.Add(1)
+
+		// Check interval
+		pts := time.Duration(avutil.AvRescaleQ(p.Frame.Pts(), p.Descriptor.TimeBase(), nanosecondRational))
+		if h.lastPts != nil && pts-*h.lastPts < h.o.Interval {
+			return
+		}
+		h.lastPts = &pts
+
+		// No data
+		if p.Frame.Data() == nil {
+			return
+		}
+
+		// Hash
+		h.statWorkRatio.Begin()
+		var v uint64
+		switch h.o.Algorithm {
+		case PerceptualHashAlgorithmPHash:
+			v = perceptualHasherPHash(perceptualHasherGrid(p.Frame, 32, 32))
+		default:
+			v = perceptualHasherDHash(perceptualHasherGrid(p.Frame, 9, 8))
+		}
+		h.statWorkRatio.End()
+
+		// Send event
+		h.eh.Emit(astiencoder.Event{
+			Name: EventNamePerceptualHasherHash,
+			Payload: PerceptualHash{
+				Algorithm: h.o.Algorithm,
+				Pts:       pts,
+				Value:     v,
+			},
+			Target: h,
+		})
+	})
+}
+
+// perceptualHasherGrid downscales the first plane of the frame to a w x h grid by averaging blocks
+func perceptualHasherGrid(f *avutil.Frame, w, h int) [][]float64 {
+	// Create grid
+	g := make([][]float64, h)
+	data, linesize, fw, fh := uintptr(unsafe.Pointer(f.Data())), f.Linesize(), f.Width(), f.Height()
+
+	// Loop through cells
+	for y := 0; y < h; y++ {
+		g[y] = make([]float64, w)
+		y0, y1 := y*fh/h, (y+1)*fh/h
+		for x := 0; x < w; x++ {
+			// Average block
+			x0, x1 := x*fw/w, (x+1)*fw/w
+			var sum, n float64
+			for by := y0; by < y1; by++ {
+				for bx := x0; bx < x1; bx++ {
+					sum += float64(*(*uint8)(unsafe.Pointer(data + uintptr(by*linesize+bx))))
+					n++
+				}
+			}
+			if n > 0 {
+				g[y][x] = sum / n
+			}
+		}
+	}
+	return g
+}
+
+// perceptualHasherDHash computes the difference hash of a 9x8 grid
+func perceptualHasherDHash(g [][]float64) (v uint64) {
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			v <<= 1
+			if g[y][x] < g[y][x+1] {
+				v |= 1
+			}
+		}
+	}
+	return
+}
+
+// perceptualHasherPHash computes the DCT based hash of a 32x32 grid
+func perceptualHasherPHash(g [][]float64) (v uint64) {
+	// Compute the 8x8 lowest frequencies of the 2D DCT
+	const n = 32
+	var cs [8][8]float64
+	for u := 0; u < 8; u++ {
+		for w := 0; w < 8; w++ {
+			var sum float64
+			for y := 0; y < n; y++ {
+				for x := 0; x < n; x++ {
+					sum += g[y][x] * math.Cos(float64(2*x+1)*float64(w)*math.Pi/(2*n)) * math.Cos(float64(2*y+1)*float64(u)*math.Pi/(2*n))
+				}
+			}
+			cs[u][w] = sum
+		}
+	}
+
+	// Get median without the DC coefficient
+	var vs []float64
+	for u := 0; u < 8; u++ {
+		for w := 0; w < 8; w++ {
+			if u != 0 || w != 0 {
+				vs = append(vs, cs[u][w])
+			}
+		}
+	}
+	sort.Float64s(vs)
+	m := vs[len(vs)/2]
+
+	// Compute hash
+	for u := 0; u < 8; u++ {
+		for w := 0; w < 8; w++ {
+			v <<= 1
+			if cs[u][w] > m {
+				v |= 1
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,27 @@
+package astilibav
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPerceptualHasherDHash(t *testing.T) {
+	g := make([][]float64, 8)
+	for y := range g {
+		g[y] = make([]float64, 9)
+		for x := range g[y] {
+			if y < 4 {
+				g[y][x] = float64(x)
+			} else {
+				g[y][x] = float64(9 - x)
+			}
+		}
+	}
+	assert.Equal(t, uint64(0xffffffff00000000), perceptualHasherDHash(g))
+}
+
+func TestPerceptualHashDistance(t *testing.T) {
+	assert.Equal(t, 0, PerceptualHash{Value: 0xf0}.Distance(PerceptualHash{Value: 0xf0}))
+	assert.Equal(t, 5, PerceptualHash{Value: 0xf0}.Distance(PerceptualHash{Value: 0x13}))
+}
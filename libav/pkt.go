@@ -25,21 +25,27 @@ type PktHandlerConnector interface {
 // PktHandlerPayload represents a PktHandler payload
 type PktHandlerPayload struct {
 	Descriptor Descriptor
-	Pkt        *avcodec.Packet
+	// May be nil if the pkt has not been created by a node attaching metadata
+	Metadata *UnitMetadata
+	Pkt      *avcodec.Packet
 }
 
 type pktDispatcher struct {
+	bp           *backpressureTracker
 	hs           map[string]PktHandler
 	m            *sync.Mutex
+	n            astiencoder.Node
 	p            *pktPool
 	statDispatch *astikit.DurationPercentageStat
 	wg           *sync.WaitGroup
 }
 
-func newPktDispatcher(c *astikit.Closer) *pktDispatcher {
+func newPktDispatcher(n astiencoder.Node, eh *astiencoder.EventHandler, c *astikit.Closer) *pktDispatcher {
 	return &pktDispatcher{
+		bp:           newBackpressureTracker(n, eh),
 		hs:           make(map[string]PktHandler),
 		m:            &sync.Mutex{},
+		n:            n,
 		p:            newPktPool(c),
 		statDispatch: astikit.NewDurationPercentageStat(),
 		wg:           &sync.WaitGroup{},
@@ -58,7 +64,7 @@ func (d *pktDispatcher) delHandler(h PktHandler) {
 	delete(d.hs, h.Metadata().Name)
 }
 
-func (d *pktDispatcher) dispatch(pkt *avcodec.Packet, descriptor Descriptor) {
+func (d *pktDispatcher) dispatch(pkt *avcodec.Packet, descriptor Descriptor, m *UnitMetadata) {
 	// Copy handlers
 	d.m.Lock()
 	var hs []PktHandler
@@ -89,14 +95,24 @@ func (d *pktDispatcher) dispatch(pkt *avcodec.Packet, descriptor Descriptor) {
 	for _, h := range hs {
 		// Copy pkt
 		hPkt := d.p.get()
-		hPkt.AvPacketRef(pkt)
+		defaultBindings.pktRef(hPkt, pkt)
+
+		// Keep track of pending handlers
+		d.bp.add(h)
 
 		// Handle pkt
 		go func(h PktHandler) {
 			defer d.wg.Done()
+			defer d.bp.done(h)
 			defer d.p.put(hPkt)
+
+			// Handle rate limit
+			if v, ok := h.(astiencoder.RateLimitHandler); ok {
+				v.HandleRateLimit()
+			}
 			h.HandlePkt(&PktHandlerPayload{
 				Descriptor: descriptor,
+				Metadata:   m,
 				Pkt:        hPkt,
 			})
 		}(h)
@@ -104,7 +120,7 @@ func (d *pktDispatcher) dispatch(pkt *avcodec.Packet, descriptor Descriptor) {
 }
 
 func (d *pktDispatcher) wait() {
-	d.wg.Wait()
+	d.bp.wait(d.wg)
 }
 
 func (d *pktDispatcher) addStats(s *astikit.Stater) {
@@ -123,12 +139,13 @@ type PktCond interface {
 
 type pktCond struct {
 	PktHandler
-	i *avformat.Stream
+	// Streams are retrieved through their index since they're replaced after a reconnection
+	idx int
 }
 
 func newPktCond(i *avformat.Stream, h PktHandler) *pktCond {
 	return &pktCond{
-		i:          i,
+		idx:        i.Index(),
 		PktHandler: h,
 	}
 }
@@ -136,13 +153,20 @@ func newPktCond(i *avformat.Stream, h PktHandler) *pktCond {
 // Metadata implements the NodeDescriptor interface
 func (c *pktCond) Metadata() astiencoder.NodeMetadata {
 	m := c.PktHandler.Metadata()
-	m.Name = fmt.Sprintf("%s_%d", c.PktHandler.Metadata().Name, c.i.Index())
+	m.Name = fmt.Sprintf("%s_%d", c.PktHandler.Metadata().Name, c.idx)
 	return m
 }
 
 // UsePkt implements the PktCond interface
 func (c *pktCond) UsePkt(pkt *avcodec.Packet) bool {
-	return pkt.StreamIndex() == c.i.Index()
+	return pkt.StreamIndex() == c.idx
+}
+
+// HandleRateLimit implements the RateLimitHandler interface
+func (c *pktCond) HandleRateLimit() {
+	if v, ok := c.PktHandler.(astiencoder.RateLimitHandler); ok {
+		v.HandleRateLimit()
+	}
 }
 
 type pktPool struct {
@@ -162,9 +186,9 @@ func (p *pktPool) get() (pkt *avcodec.Packet) {
 	p.m.Lock()
 	defer p.m.Unlock()
 	if len(p.p) == 0 {
-		pkt = avcodec.AvPacketAlloc()
+		pkt = defaultBindings.pktAlloc()
 		p.c.Add(func() error {
-			avcodec.AvPacketFree(pkt)
+			defaultBindings.pktFree(pkt)
 			return nil
 		})
 		return
@@ -177,6 +201,6 @@ func (p *pktPool) get() (pkt *avcodec.Packet) {
 func (p *pktPool) put(pkt *avcodec.Packet) {
 	p.m.Lock()
 	defer p.m.Unlock()
-	pkt.AvPacketUnref()
+	defaultBindings.pktUnref(pkt)
 	p.p = append(p.p, pkt)
 }
@@ -4,8 +4,12 @@ import "C"
 import (
 	"bytes"
 	"context"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"sync"
 	"sync/atomic"
 	"text/template"
 	"unsafe"
@@ -64,6 +68,9 @@ func NewPktDumper(o PktDumperOptions, eh *astiencoder.EventHandler) (d *PktDumpe
 
 	// Parse pattern
 	if len(o.Pattern) > 0 {
+		if d.o.Data == nil {
+			d.o.Data = make(map[string]interface{})
+		}
 		if d.t, err = template.New("").Parse(o.Pattern); err != nil {
 			err = fmt.Errorf("astilibav: parsing pattern %s as template failed: %w", o.Pattern, err)
 			return
@@ -147,7 +154,7 @@ func (d *PktDumper) HandlePkt(p *PktHandlerPayload) {
 	})
 }
 
-// PktDumpFunc is a PktDumpFunc that dumps the packet to a file
+// PktDumpFile is a pkt dumper handler that dumps the pkt data to a file whose path is the pattern
 var PktDumpFile = func(pkt *avcodec.Packet, args PktDumperHandlerArgs) (err error) {
 	// Create file
 	var f *os.File
@@ -164,3 +171,164 @@ var PktDumpFile = func(pkt *avcodec.Packet, args PktDumperHandlerArgs) (err erro
 	}
 	return
 }
+
+// Pkt dump formats
+const (
+	// Hexadecimal dump of the pkt data preceded by a line describing the pkt
+	PktDumpFormatHex = "hex"
+	// One JSON object per line describing the pkt, without its data
+	PktDumpFormatJSON = "json"
+	// Pkt data as is, which, for a video stream, is an elementary stream that analysis tools can read. H264 and HEVC
+	// pkts coming from containers such as mp4 must go through an "h264_mp4toannexb" or "hevc_mp4toannexb" bitstream
+	// filterer first
+	PktDumpFormatRaw = "raw"
+)
+
+// PktDumpHeader represents the non-data fields of a dumped pkt
+type PktDumpHeader struct {
+	DTS         int64 `json:"dts"`
+	Duration    int64 `json:"duration"`
+	Flags       int   `json:"flags"`
+	KeyFrame    bool  `json:"key_frame"`
+	Pos         int64 `json:"pos"`
+	PTS         int64 `json:"pts"`
+	Size        int   `json:"size"`
+	StreamIndex int   `json:"stream_index"`
+}
+
+func newPktDumpHeader(pkt *avcodec.Packet) PktDumpHeader {
+	return PktDumpHeader{
+		DTS:         pkt.Dts(),
+		Duration:    pkt.Duration(),
+		Flags:       pkt.Flags(),
+		KeyFrame:    pkt.Flags()&avcodec.AV_PKT_FLAG_KEY > 0,
+		Pos:         pkt.Pos(),
+		PTS:         pkt.Pts(),
+		Size:        pkt.Size(),
+		StreamIndex: pkt.StreamIndex(),
+	}
+}
+
+// PktDump returns the pkt in the provided format
+func PktDump(pkt *avcodec.Packet, format string) (b []byte, err error) {
+	// Get header
+	h := newPktDumpHeader(pkt)
+
+	// JSON doesn't need data
+	if format == PktDumpFormatJSON {
+		return pktDumpJSON(h)
+	}
+
+	// Get data
+	var data []byte
+	if pkt.Size() > 0 {
+		data = C.GoBytes(unsafe.Pointer(pkt.Data()), (C.int)(pkt.Size()))
+	}
+	return pktDumpData(h, data, format)
+}
+
+func pktDumpJSON(h PktDumpHeader) (b []byte, err error) {
+	if b, err = json.Marshal(h); err != nil {
+		err = fmt.Errorf("astilibav: marshaling failed: %w", err)
+		return
+	}
+	b = append(b, '\n')
+	return
+}
+
+func pktDumpData(h PktDumpHeader, data []byte, format string) (b []byte, err error) {
+	switch format {
+	case PktDumpFormatHex:
+		flags := "_"
+		if h.KeyFrame {
+			flags = "K"
+		}
+		b = []byte(fmt.Sprintf("stream=%d pts=%d dts=%d duration=%d pos=%d size=%d flags=%s\n", h.StreamIndex, h.PTS, h.DTS, h.Duration, h.Pos, h.Size, flags))
+		b = append(b, hex.Dump(data)...)
+	case PktDumpFormatJSON:
+		return pktDumpJSON(h)
+	case PktDumpFormatRaw:
+		b = data
+	default:
+		err = fmt.Errorf("astilibav: invalid format %s", format)
+	}
+	return
+}
+
+// PktDumpWriter returns a pkt dumper handler that writes pkts to the writer in the provided format
+// Pkts are written one after the other, which, with the raw format, allows piping an elementary stream
+func PktDumpWriter(w io.Writer, format string) func(pkt *avcodec.Packet, args PktDumperHandlerArgs) error {
+	return PktDumpCallback(format, func(b []byte, args PktDumperHandlerArgs) (err error) {
+		if _, err = w.Write(b); err != nil {
+			err = fmt.Errorf("astilibav: writing failed: %w", err)
+			return
+		}
+		return
+	})
+}
+
+// PktDumpCallback returns a pkt dumper handler that executes the callback with pkts in the provided format
+// Contrary to the pkt, the dump belongs to the callback
+func PktDumpCallback(format string, fn func(b []byte, args PktDumperHandlerArgs) error) func(pkt *avcodec.Packet, args PktDumperHandlerArgs) error {
+	return func(pkt *avcodec.Packet, args PktDumperHandlerArgs) (err error) {
+		// Dump
+		var b []byte
+		if b, err = PktDump(pkt, format); err != nil {
+			err = fmt.Errorf("astilibav: dumping pkt failed: %w", err)
+			return
+		}
+
+		// Execute callback
+		return fn(b, args)
+	}
+}
+
+// PktDumpRingBuffer keeps the last dumps in memory, which helps inspecting what happened right before an issue, for
+// instance in tests
+type PktDumpRingBuffer struct {
+	bs     [][]byte
+	format string
+	idx    int
+	m      *sync.Mutex // Locks bs and idx
+	n      int
+}
+
+// NewPktDumpRingBuffer creates a new pkt dump ring buffer keeping the last size dumps in the provided format
+func NewPktDumpRingBuffer(size int, format string) *PktDumpRingBuffer {
+	return &PktDumpRingBuffer{
+		bs:     make([][]byte, size),
+		format: format,
+		m:      &sync.Mutex{},
+	}
+}
+
+// Handler returns the pkt dumper handler filling the ring buffer
+func (r *PktDumpRingBuffer) Handler() func(pkt *avcodec.Packet, args PktDumperHandlerArgs) error {
+	return PktDumpCallback(r.format, func(b []byte, args PktDumperHandlerArgs) error {
+		r.add(b)
+		return nil
+	})
+}
+
+func (r *PktDumpRingBuffer) add(b []byte) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if len(r.bs) == 0 {
+		return
+	}
+	r.bs[r.idx] = b
+	r.idx = (r.idx + 1) % len(r.bs)
+	if r.n < len(r.bs) {
+		r.n++
+	}
+}
+
+// Dumps returns the dumps from the oldest to the newest
+func (r *PktDumpRingBuffer) Dumps() (bs [][]byte) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	for idx := 0; idx < r.n; idx++ {
+		bs = append(bs, r.bs[(r.idx-r.n+idx+len(r.bs))%len(r.bs)])
+	}
+	return
+}
@@ -0,0 +1,32 @@
+package astilibav
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPktDumpData(t *testing.T) {
+	h := PktDumpHeader{DTS: 1, Duration: 2, Flags: 1, KeyFrame: true, Pos: 3, PTS: 4, Size: 2, StreamIndex: 5}
+	b, err := pktDumpData(h, []byte{0, 1}, PktDumpFormatHex)
+	assert.NoError(t, err)
+	assert.Equal(t, "stream=5 pts=4 dts=1 duration=2 pos=3 size=2 flags=K\n00000000  00 01                                             |..|\n", string(b))
+	b, err = pktDumpData(h, []byte{0, 1}, PktDumpFormatJSON)
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"dts\":1,\"duration\":2,\"flags\":1,\"key_frame\":true,\"pos\":3,\"pts\":4,\"size\":2,\"stream_index\":5}\n", string(b))
+	b, err = pktDumpData(h, []byte{0, 1}, PktDumpFormatRaw)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0, 1}, b)
+	_, err = pktDumpData(h, nil, "invalid")
+	assert.Error(t, err)
+}
+
+func TestPktDumpRingBuffer(t *testing.T) {
+	r := NewPktDumpRingBuffer(2, PktDumpFormatRaw)
+	assert.Empty(t, r.Dumps())
+	r.add([]byte{1})
+	assert.Equal(t, [][]byte{{1}}, r.Dumps())
+	r.add([]byte{2})
+	r.add([]byte{3})
+	assert.Equal(t, [][]byte{{2}, {3}}, r.Dumps())
+}
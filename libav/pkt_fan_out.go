@@ -0,0 +1,331 @@
+package astilibav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+)
+
+var countPktFanOut uint64
+
+// PktFanOut represents an object capable of sending the pkts of a single encode to several outputs, such as an RTMP
+// muxer, an HLS recorder and an archive muxer
+// Pkts are ref-counted instead of being copied, and each output has its own bounded queue and goroutine so that a
+// slow output never delays the other ones: when its queue is full, pkts are dropped the same way a PktQueue does.
+// An output whose node stops while the fan out is still running, for instance because a muxer has reached its max
+// number of write errors, is detached without disrupting the other ones
+type PktFanOut struct {
+	*astiencoder.BaseNode
+	ctx              context.Context
+	eh               *astiencoder.EventHandler
+	m                *sync.Mutex
+	o                PktFanOutOptions
+	os               map[string]*pktFanOutOutput
+	p                *pktPool
+	statDropRate     *astikit.CounterAvgStat
+	statIncomingRate *astikit.CounterAvgStat
+	wg               *sync.WaitGroup
+}
+
+// PktFanOutOptions represents pkt fan out options
+// At least one of MaxDelay or MaxSize must be provided
+type PktFanOutOptions struct {
+	// An output queue is full when the dts difference between its oldest and newest pkts exceeds this duration
+	MaxDelay time.Duration
+	// An output queue is full when it holds more than this number of pkts
+	MaxSize int
+	Node    astiencoder.NodeOptions
+}
+
+type pktFanOutOutput struct {
+	b       *pktQueueBuffer
+	h       PktHandler
+	m       *sync.Mutex
+	signal  chan bool
+	started bool
+}
+
+// NewPktFanOut creates a new pkt fan out
+func NewPktFanOut(o PktFanOutOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (f *PktFanOut, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countPktFanOut, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("pkt_fan_out_%d", count), fmt.Sprintf("Pkt Fan Out #%d", count), "Fans out pkts")
+
+	// Queues must be bounded
+	if o.MaxDelay <= 0 && o.MaxSize <= 0 {
+		err = errors.New("astilibav: neither max delay nor max size provided")
+		return
+	}
+
+	// Create fan out
+	f = &PktFanOut{
+		eh:               eh,
+		m:                &sync.Mutex{},
+		o:                o,
+		os:               make(map[string]*pktFanOutOutput),
+		p:                newPktPool(c),
+		statDropRate:     astikit.NewCounterAvgStat(),
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		wg:               &sync.WaitGroup{},
+	}
+	f.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(f), eh)
+	f.addStats()
+	return
+}
+
+func (f *PktFanOut) addStats() {
+	// Add incoming rate
+	f.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of packets coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "pps",
+	}, f.statIncomingRate)
+
+	// Add drop rate
+	f.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of packets dropped per second, all outputs included",
+		Label:       "Drop rate",
+		Unit:        "pps",
+	}, f.statDropRate)
+}
+
+// Connect implements the PktHandlerConnector interface
+func (f *PktFanOut) Connect(h PktHandler) {
+	// Lock
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	// Add output
+	o := &pktFanOutOutput{
+		b:      newPktQueueBuffer(f.o.MaxDelay, f.o.MaxSize),
+		h:      h,
+		m:      &sync.Mutex{},
+		signal: make(chan bool, 1),
+	}
+	f.os[h.Metadata().Name] = o
+
+	// Fan out is already running
+	if f.ctx != nil && f.ctx.Err() == nil {
+		f.startOutput(o)
+	}
+
+	// Connect nodes
+	astiencoder.ConnectNodes(f, h)
+}
+
+// Disconnect implements the PktHandlerConnector interface
+func (f *PktFanOut) Disconnect(h PktHandler) {
+	// Delete output
+	f.m.Lock()
+	o, ok := f.os[h.Metadata().Name]
+	delete(f.os, h.Metadata().Name)
+	f.m.Unlock()
+
+	// Make sure the output goroutine exits
+	if ok {
+		f.closeOutput(o)
+	}
+
+	// Disconnect nodes
+	astiencoder.DisconnectNodes(f, h)
+}
+
+// Start starts the fan out
+func (f *PktFanOut) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	f.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to wait for all outputs to be done
+		defer f.wg.Wait()
+
+		// Start outputs
+		f.m.Lock()
+		f.ctx = f.Context()
+		for _, o := range f.os {
+			f.startOutput(o)
+		}
+		f.m.Unlock()
+
+		// Wait for context to be done
+		<-f.Context().Done()
+	})
+}
+
+// Assumes the fan out is locked
+func (f *PktFanOut) startOutput(o *pktFanOutOutput) {
+	// Output has already been started
+	if o.started {
+		return
+	}
+	o.started = true
+
+	// Start output
+	f.wg.Add(1)
+	go func(ctx context.Context) {
+		// Make sure the wait group is updated
+		defer f.wg.Done()
+
+		// Make sure queued pkts are put back in the pool and the output can be started again
+		defer func() {
+			f.m.Lock()
+			o.started = false
+			f.m.Unlock()
+			o.reset(f.p, false)
+		}()
+
+		// Loop
+		for {
+			// Wait for pkts
+			select {
+			case <-o.signal:
+			case <-ctx.Done():
+				return
+			}
+
+			// Handle queued pkts
+			for {
+				// Handle pause
+				f.HandlePause()
+
+				// Pop
+				i, closed := o.pop()
+				if closed {
+					return
+				} else if i == nil {
+					break
+				}
+
+				// Handle pkt
+				o.h.HandlePkt(&PktHandlerPayload{
+					Descriptor: i.d,
+					Metadata:   i.m,
+					Pkt:        i.pkt,
+				})
+				f.p.put(i.pkt)
+
+				// Check context
+				if ctx.Err() != nil {
+					return
+				}
+
+				// Output node has stopped on its own
+				if n, ok := o.h.(astiencoder.Node); ok && n.Status() == astiencoder.StatusStopped {
+					f.detach(o)
+					return
+				}
+			}
+		}
+	}(f.ctx)
+}
+
+func (f *PktFanOut) closeOutput(o *pktFanOutOutput) {
+	// Close
+	o.reset(f.p, true)
+
+	// Make sure the output goroutine exits
+	select {
+	case o.signal <- true:
+	default:
+	}
+}
+
+func (o *pktFanOutOutput) pop() (i *pktQueueItem, closed bool) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	if o.b == nil {
+		return nil, true
+	}
+	return o.b.pop(), false
+}
+
+func (o *pktFanOutOutput) reset(p *pktPool, close bool) {
+	// Lock
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	// Output is closed
+	if o.b == nil {
+		return
+	}
+
+	// Put queued pkts back in the pool
+	for i := o.b.pop(); i != nil; i = o.b.pop() {
+		p.put(i.pkt)
+	}
+
+	// Nothing can be pushed anymore
+	if close {
+		o.b = nil
+	}
+}
+
+func (f *PktFanOut) detach(o *pktFanOutOutput) {
+	// Delete output
+	f.m.Lock()
+	delete(f.os, o.h.Metadata().Name)
+	f.m.Unlock()
+
+	// Close output
+	o.reset(f.p, true)
+
+	// Disconnect nodes
+	astiencoder.DisconnectNodes(f, o.h)
+
+	// Send event
+	f.eh.Emit(astiencoder.Event{
+		Name:    EventNamePktFanOutOutputDetached,
+		Payload: o.h,
+		Target:  f,
+	})
+}
+
+// HandlePkt implements the PktHandler interface
+func (f *PktFanOut) HandlePkt(p *PktHandlerPayload) {
+	// Increment incoming rate
+	f.statIncomingRate.Add(1)
+
+	// Lock
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	// Create item once so that its priority is the same for all outputs
+	i := newPktQueueItem(p.Pkt, p)
+
+	// Loop through outputs
+	for _, o := range f.os {
+		// Copy pkt
+		pkt := f.p.get()
+		if ret := defaultBindings.pktRef(pkt, p.Pkt); ret < 0 {
+			emitAvError(f, f.eh, ret, "pkt.AvPacketRef failed")
+			f.p.put(pkt)
+			continue
+		}
+
+		// Create output item
+		oi := *i
+		oi.pkt = pkt
+
+		// Push
+		o.m.Lock()
+		if o.b == nil {
+			o.m.Unlock()
+			f.p.put(pkt)
+			continue
+		}
+		for _, d := range o.b.push(&oi) {
+			f.statDropRate.Add(1)
+			f.p.put(d.pkt)
+		}
+		o.m.Unlock()
+
+		// Signal
+		select {
+		case o.signal <- true:
+		default:
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package astilibav
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+)
+
+var countPktPacer uint64
+
+// PktPacer represents an object capable of smoothing pkts emission so that they're dispatched at the pace
+// indicated by their dts
+// This is useful for UDP/RTP outputs where bursts cause receiver buffer overruns
+type PktPacer struct {
+	*astiencoder.BaseNode
+	c                *astikit.Chan
+	d                *pktDispatcher
+	o                PktPacerOptions
+	pc               pacer
+	statIncomingRate *astikit.CounterAvgStat
+	statPacingRatio  *astikit.DurationPercentageStat
+	statResyncs      *astikit.CounterAvgStat
+}
+
+// PktPacerOptions represents pkt pacer options
+type PktPacerOptions struct {
+	Node astiencoder.NodeOptions
+	// When a pkt is either late or early by more than this duration, the pacer resyncs on it instead of trying to
+	// catch up or waiting. Defaults to 1s
+	ResyncThreshold time.Duration
+	// 2 means pkts are dispatched twice as fast as their dts indicate. Defaults to 1
+	Speed float64
+}
+
+// NewPktPacer creates a new pkt pacer
+func NewPktPacer(o PktPacerOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (p *PktPacer) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countPktPacer, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("pkt_pacer_%d", count), fmt.Sprintf("Pkt Pacer #%d", count), "Paces pkts")
+
+	// Default values
+	if o.ResyncThreshold <= 0 {
+		o.ResyncThreshold = time.Second
+	}
+	if o.Speed <= 0 {
+		o.Speed = 1
+	}
+
+	// Create pacer
+	p = &PktPacer{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		o:                o,
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statPacingRatio:  astikit.NewDurationPercentageStat(),
+		statResyncs:      astikit.NewCounterAvgStat(),
+	}
+	p.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(p), eh)
+	p.d = newPktDispatcher(p, eh, c)
+	p.addStats()
+	return
+}
+
+func (p *PktPacer) addStats() {
+	// Add incoming rate
+	p.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of packets coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "pps",
+	}, p.statIncomingRate)
+
+	// Add pacing ratio
+	p.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent waiting for packets to be due",
+		Label:       "Pacing ratio",
+		Unit:        "%",
+	}, p.statPacingRatio)
+
+	// Add resyncs
+	p.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of resyncs per second",
+		Label:       "Resyncs",
+		Unit:        "rps",
+	}, p.statResyncs)
+
+	// Add dispatcher stats
+	p.d.addStats(p.Stater())
+
+	// Add chan stats
+	p.c.AddStats(p.Stater())
+}
+
+// Connect implements the PktHandlerConnector interface
+func (p *PktPacer) Connect(h PktHandler) {
+	// Add handler
+	p.d.addHandler(h)
+
+	// Connect nodes
+	astiencoder.ConnectNodes(p, h)
+}
+
+// Disconnect implements the PktHandlerConnector interface
+func (p *PktPacer) Disconnect(h PktHandler) {
+	// Delete handler
+	p.d.delHandler(h)
+
+	// Disconnect nodes
+	astiencoder.DisconnectNodes(p, h)
+}
+
+// Start starts the pacer
+func (p *PktPacer) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	p.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to wait for all dispatcher subprocesses to be done so that they are properly closed
+		defer p.d.wait()
+
+		// Make sure to stop the chan properly
+		defer p.c.Stop()
+
+		// Start chan
+		p.c.Start(p.Context())
+	})
+}
+
+// HandlePkt implements the PktHandler interface
+func (p *PktPacer) HandlePkt(pl *PktHandlerPayload) {
+	p.c.Add(func() {
+		// Handle pause
+		defer p.HandlePause()
+
+		// Increment incoming rate
+		p.statIncomingRate.Add(1)
+
+		// Wait for the pkt to be due
+		if pl.Pkt.Dts() != avutil.AV_NOPTS_VALUE {
+			if d := p.delay(time.Duration(avutil.AvRescaleQ(pl.Pkt.Dts(), pl.Descriptor.TimeBase(), nanosecondRational)), time.Now()); d > 0 {
+				p.statPacingRatio.Begin()
+				astikit.Sleep(p.Context(), d)
+				p.statPacingRatio.End()
+			}
+		}
+
+		// Dispatch pkt
+		p.d.dispatch(pl.Pkt, pl.Descriptor, pl.Metadata)
+	})
+}
+
+// delay returns the duration to wait before the pkt with the provided dts is due
+func (p *PktPacer) delay(dts time.Duration, now time.Time) (d time.Duration) {
+	var resynced bool
+	if d, resynced = p.pc.delay(dts, time.Duration(now.UnixNano()), p.o.Speed, p.o.ResyncThreshold); resynced {
+		p.statResyncs.Add(1)
+	}
+	return
+}
+
+// pacer keeps track of the reference that timestamps are paced against
+type pacer struct {
+	refAt time.Duration
+	refTs *time.Duration
+}
+
+// delay returns the duration to wait before the unit with the provided timestamp is due, now being the position of
+// the clock it's paced against. When the unit is either late or early by more than the threshold, the pacer resyncs
+// on it
+func (p *pacer) delay(ts, now time.Duration, speed float64, threshold time.Duration) (d time.Duration, resynced bool) {
+	// Get delay
+	if p.refTs != nil {
+		d = p.refAt + time.Duration(float64(ts-*p.refTs)/speed) - now
+	}
+
+	// Resync
+	if p.refTs == nil || d > threshold || d < -threshold {
+		resynced = p.refTs != nil
+		p.refAt = now
+		p.refTs = &ts
+		d = 0
+	}
+	return
+}
@@ -0,0 +1,27 @@
+package astilibav
+
+import (
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astikit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPktPacerDelay(t *testing.T) {
+	n := time.Unix(0, 0)
+	p := &PktPacer{
+		o:           PktPacerOptions{ResyncThreshold: time.Second, Speed: 1},
+		statResyncs: astikit.NewCounterAvgStat(),
+	}
+	assert.Equal(t, time.Duration(0), p.delay(10*time.Second, n))
+	assert.Equal(t, 100*time.Millisecond, p.delay(10100*time.Millisecond, n))
+	assert.Equal(t, 50*time.Millisecond, p.delay(10200*time.Millisecond, n.Add(150*time.Millisecond)))
+	assert.Equal(t, -100*time.Millisecond, p.delay(10300*time.Millisecond, n.Add(400*time.Millisecond)))
+	assert.Equal(t, time.Duration(0), p.delay(20*time.Second, n.Add(500*time.Millisecond)))
+	assert.Equal(t, 40*time.Millisecond, p.delay(20040*time.Millisecond, n.Add(500*time.Millisecond)))
+
+	// Speed
+	p.o.Speed = 2
+	assert.Equal(t, 20*time.Millisecond, p.delay(20080*time.Millisecond, n.Add(520*time.Millisecond)))
+}
@@ -0,0 +1,261 @@
+package astilibav
+
+//#cgo pkg-config: libavcodec
+//#include <libavcodec/avcodec.h>
+import "C"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avutil"
+)
+
+var countPktProcessor uint64
+
+// PktProcessorFunc processes a pkt
+// It returns the pkts that must be dispatched to the next nodes, in order, which must be either a.Pkt or pkts
+// created with a.NewPkt. Returning no pkts drops the pkt
+type PktProcessorFunc func(a *PktProcessorArgs) ([]*avcodec.Packet, error)
+
+// NewClockUpdaterPktProcessorFunc creates a new pkt processor func that updates the clock with the DTS of the pkts
+// it processes, for instance to make it an audio or video master clock. It should be used with ReadOnly
+func NewClockUpdaterPktProcessorFunc(c astiencoder.ClockUpdater) PktProcessorFunc {
+	return func(a *PktProcessorArgs) ([]*avcodec.Packet, error) {
+		if a.Pkt.Dts() != avutil.AV_NOPTS_VALUE && a.Descriptor != nil {
+			c.Update(time.Duration(avutil.AvRescaleQ(a.Pkt.Dts(), a.Descriptor.TimeBase(), nanosecondRational)))
+		}
+		return []*avcodec.Packet{a.Pkt}, nil
+	}
+}
+
+// PktProcessor represents an object capable of processing pkts with a Go func, for instance to inject SEI, rewrite
+// NAL units or encrypt pkts between the encoder and the muxer
+// Pkts handed to the func belong to the processor which takes care of referencing and releasing them: the func
+// must not keep any of them once it has returned
+type PktProcessor struct {
+	*astiencoder.BaseNode
+	c                *astikit.Chan
+	d                *pktDispatcher
+	eh               *astiencoder.EventHandler
+	o                PktProcessorOptions
+	p                *pktPool
+	statDropRate     *astikit.CounterAvgStat
+	statIncomingRate *astikit.CounterAvgStat
+	statWorkRatio    *astikit.DurationPercentageStat
+}
+
+// PktProcessorOptions represents pkt processor options
+type PktProcessorOptions struct {
+	Func PktProcessorFunc
+	Node astiencoder.NodeOptions
+	// If true, the pkt handed to the func is not made writable which saves a copy when the func only reads it
+	ReadOnly bool
+}
+
+// PktProcessorArgs represents pkt processor func args
+type PktProcessorArgs struct {
+	Descriptor Descriptor
+	Metadata   *UnitMetadata
+	// Unless ReadOnly is true, the pkt is writable
+	Pkt  *avcodec.Packet
+	p    *pktPool
+	pkts []*avcodec.Packet
+}
+
+// NewPkt returns a new pkt that can be returned by the func
+// It is released by the processor once the func has returned and the pkt has been dispatched
+func (a *PktProcessorArgs) NewPkt() *avcodec.Packet {
+	pkt := a.p.get()
+	a.pkts = append(a.pkts, pkt)
+	return pkt
+}
+
+func (a *PktProcessorArgs) valid(pkt *avcodec.Packet) bool {
+	if pkt == a.Pkt {
+		return true
+	}
+	for _, v := range a.pkts {
+		if v == pkt {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *PktProcessorArgs) close() {
+	for _, pkt := range a.pkts {
+		a.p.put(pkt)
+	}
+	a.pkts = nil
+}
+
+// NewPktProcessor creates a new pkt processor
+func NewPktProcessor(o PktProcessorOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (p *PktProcessor, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countPktProcessor, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("pkt_processor_%d", count), fmt.Sprintf("Pkt Processor #%d", count), "Processes pkts")
+
+	// No func
+	if o.Func == nil {
+		err = errors.New("astilibav: no func provided")
+		return
+	}
+
+	// Create pkt processor
+	p = &PktProcessor{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh:               eh,
+		o:                o,
+		p:                newPktPool(c),
+		statDropRate:     astikit.NewCounterAvgStat(),
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statWorkRatio:    astikit.NewDurationPercentageStat(),
+	}
+	p.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(p), eh)
+	p.d = newPktDispatcher(p, eh, c)
+	p.addStats()
+	return
+}
+
+func (p *PktProcessor) addStats() {
+	// Add incoming rate
+	p.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of packets coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "pps",
+	}, p.statIncomingRate)
+
+	// Add drop rate
+	p.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of packets dropped per second",
+		Label:       "Drop rate",
+		Unit:        "pps",
+	}, p.statDropRate)
+
+	// Add work ratio
+	p.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, p.statWorkRatio)
+
+	// Add dispatcher stats
+	p.d.addStats(p.Stater())
+
+	// Add chan stats
+	p.c.AddStats(p.Stater())
+}
+
+// Connect implements the PktHandlerConnector interface
+func (p *PktProcessor) Connect(h PktHandler) {
+	// Add handler
+	p.d.addHandler(h)
+
+	// Connect nodes
+	astiencoder.ConnectNodes(p, h)
+}
+
+// Disconnect implements the PktHandlerConnector interface
+func (p *PktProcessor) Disconnect(h PktHandler) {
+	// Delete handler
+	p.d.delHandler(h)
+
+	// Disconnect nodes
+	astiencoder.DisconnectNodes(p, h)
+}
+
+// Start starts the pkt processor
+func (p *PktProcessor) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	p.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to wait for all dispatcher subprocesses to be done so that they are properly closed
+		defer p.d.wait()
+
+		// Make sure to stop the chan properly
+		defer p.c.Stop()
+
+		// Start chan
+		p.c.Start(p.Context())
+	})
+}
+
+// HandleEOS implements the EOSHandler interface
+func (p *PktProcessor) HandleEOS(pl *EOSHandlerPayload) {
+	p.c.Add(func() {
+		// Forward end of stream
+		p.d.dispatchEOS()
+	})
+}
+
+// HandlePkt implements the PktHandler interface
+func (p *PktProcessor) HandlePkt(pl *PktHandlerPayload) {
+	p.c.Add(func() {
+		// Handle pause
+		defer p.HandlePause()
+
+		// Increment incoming rate
+		p.statIncomingRate.Add(1)
+
+		// Copy pkt
+		pkt := p.p.get()
+		defer p.p.put(pkt)
+		if ret := defaultBindings.pktRef(pkt, pl.Pkt); ret < 0 {
+			emitAvError(p, p.eh, ret, "pkt.AvPacketRef failed")
+			return
+		}
+
+		// Since data is shared with the other handlers of the previous node, it must be copied before being updated
+		if !p.o.ReadOnly {
+			if ret := C.av_packet_make_writable((*C.AVPacket)(unsafe.Pointer(pkt))); ret < 0 {
+				emitAvError(p, p.eh, int(ret), "av_packet_make_writable failed")
+				return
+			}
+		}
+
+		// Create args
+		a := &PktProcessorArgs{
+			Descriptor: pl.Descriptor,
+			Metadata:   pl.Metadata,
+			Pkt:        pkt,
+			p:          p.p,
+		}
+		defer a.close()
+
+		// Process
+		p.statWorkRatio.Begin()
+		pkts, err := p.o.Func(a)
+		p.statWorkRatio.End()
+		if err != nil {
+			p.eh.Emit(astiencoder.EventError(p, fmt.Errorf("astilibav: processing pkt failed: %w", err)))
+			return
+		}
+
+		// Invalid pkts
+		for _, v := range pkts {
+			if v == nil || !a.valid(v) {
+				p.eh.Emit(astiencoder.EventError(p, errors.New("astilibav: returned pkt doesn't belong to the pkt processor")))
+				return
+			}
+		}
+
+		// Drop pkt
+		if len(pkts) == 0 {
+			p.statDropRate.Add(1)
+			return
+		}
+
+		// Dispatch pkts
+		for _, v := range pkts {
+			p.d.dispatch(v, pl.Descriptor, pl.Metadata)
+		}
+	})
+}
@@ -0,0 +1,374 @@
+package astilibav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avutil"
+)
+
+var countPktQueue uint64
+
+// AV_PKT_FLAG_DISPOSABLE is not exposed by goav
+const pktQueueFlagDisposable = 0x0010
+
+// Pkts with a lower priority are dropped first
+const (
+	pktQueuePriorityDisposable = iota
+	pktQueuePriorityAudio
+	pktQueuePriorityVideo
+	pktQueuePriorityKeep
+)
+
+// PktQueue represents an object capable of decoupling a live producer from slower consumers through a bounded queue
+// Incoming pkts are never blocked. When the queue is full, pkts are dropped by priority so that the output remains
+// decodable instead of being corrupted randomly:
+//   - disposable video pkts first, which are the ones flagged as such by the encoder or the demuxer. B frames can't be
+//     detected through their timestamps only since they may be referenced by other frames (e.g. B-pyramids)
+//   - then the oldest audio pkts
+//   - then the oldest non-key video pkt, along with the following pkts of its stream until the next keyframe
+//
+// Keyframes, pkts carrying new extradata and pkts of other media types are never dropped
+type PktQueue struct {
+	*astiencoder.BaseNode
+	b                *pktQueueBuffer
+	d                *pktDispatcher
+	eh               *astiencoder.EventHandler
+	m                *sync.Mutex
+	p                *pktPool
+	signal           chan bool
+	statDropRate     *astikit.CounterAvgStat
+	statIncomingRate *astikit.CounterAvgStat
+}
+
+// PktQueueOptions represents pkt queue options
+// At least one of MaxDelay or MaxSize must be provided
+type PktQueueOptions struct {
+	// The queue is full when the dts difference between its oldest and newest pkts exceeds this duration
+	MaxDelay time.Duration
+	// The queue is full when it holds more than this number of pkts
+	MaxSize int
+	Node    astiencoder.NodeOptions
+}
+
+type pktQueueBuffer struct {
+	// Possible values are the muxer drop policies. Pkts are dropped by priority unless it's "newest" or "oldest"
+	dropPolicy string
+	items      []*pktQueueItem
+	maxDelay   time.Duration
+	maxSize    int
+	waitKey    map[int]bool
+}
+
+type pktQueueItem struct {
+	d        Descriptor
+	dts      time.Duration
+	key      bool
+	m        *UnitMetadata
+	pkt      *avcodec.Packet
+	priority int
+	stream   int
+}
+
+// NewPktQueue creates a new pkt queue
+func NewPktQueue(o PktQueueOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (q *PktQueue, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countPktQueue, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("pkt_queue_%d", count), fmt.Sprintf("Pkt Queue #%d", count), "Queues pkts")
+
+	// Queue must be bounded
+	if o.MaxDelay <= 0 && o.MaxSize <= 0 {
+		err = errors.New("astilibav: neither max delay nor max size provided")
+		return
+	}
+
+	// Create queue
+	q = &PktQueue{
+		b:                newPktQueueBuffer(o.MaxDelay, o.MaxSize),
+		eh:               eh,
+		m:                &sync.Mutex{},
+		p:                newPktPool(c),
+		signal:           make(chan bool, 1),
+		statDropRate:     astikit.NewCounterAvgStat(),
+		statIncomingRate: astikit.NewCounterAvgStat(),
+	}
+	q.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(q), eh)
+	q.d = newPktDispatcher(q, eh, c)
+	q.addStats()
+	return
+}
+
+func (q *PktQueue) addStats() {
+	// Add incoming rate
+	q.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of packets coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "pps",
+	}, q.statIncomingRate)
+
+	// Add drop rate
+	q.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of packets dropped per second",
+		Label:       "Drop rate",
+		Unit:        "pps",
+	}, q.statDropRate)
+
+	// Add dispatcher stats
+	q.d.addStats(q.Stater())
+}
+
+// Connect implements the PktHandlerConnector interface
+func (q *PktQueue) Connect(h PktHandler) {
+	// Add handler
+	q.d.addHandler(h)
+
+	// Connect nodes
+	astiencoder.ConnectNodes(q, h)
+}
+
+// Disconnect implements the PktHandlerConnector interface
+func (q *PktQueue) Disconnect(h PktHandler) {
+	// Delete handler
+	q.d.delHandler(h)
+
+	// Disconnect nodes
+	astiencoder.DisconnectNodes(q, h)
+}
+
+// Start starts the queue
+func (q *PktQueue) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	q.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to wait for all dispatcher subprocesses to be done so that they are properly closed
+		defer q.d.wait()
+
+		// Make sure queued pkts are put back in the pool
+		defer q.reset()
+
+		// Loop
+		for {
+			// Wait for pkts
+			select {
+			case <-q.signal:
+			case <-q.Context().Done():
+				return
+			}
+
+			// Dispatch queued pkts
+			for {
+				// Handle pause
+				q.HandlePause()
+
+				// Pop
+				q.m.Lock()
+				i := q.b.pop()
+				q.m.Unlock()
+				if i == nil {
+					break
+				}
+
+				// Dispatch pkt
+				q.d.dispatch(i.pkt, i.d, i.m)
+				q.p.put(i.pkt)
+
+				// Check context
+				if q.Context().Err() != nil {
+					return
+				}
+			}
+		}
+	})
+}
+
+func (q *PktQueue) reset() {
+	q.m.Lock()
+	defer q.m.Unlock()
+	for i := q.b.pop(); i != nil; i = q.b.pop() {
+		q.p.put(i.pkt)
+	}
+}
+
+// HandlePkt implements the PktHandler interface
+func (q *PktQueue) HandlePkt(p *PktHandlerPayload) {
+	// Increment incoming rate
+	q.statIncomingRate.Add(1)
+
+	// Copy pkt
+	pkt := q.p.get()
+	if ret := defaultBindings.pktRef(pkt, p.Pkt); ret < 0 {
+		emitAvError(q, q.eh, ret, "pkt.AvPacketRef failed")
+		q.p.put(pkt)
+		return
+	}
+
+	// Lock
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	// Push
+	for _, i := range q.b.push(newPktQueueItem(pkt, p)) {
+		q.statDropRate.Add(1)
+		q.p.put(i.pkt)
+	}
+
+	// Signal
+	select {
+	case q.signal <- true:
+	default:
+	}
+}
+
+func newPktQueueItem(pkt *avcodec.Packet, p *PktHandlerPayload) *pktQueueItem {
+	// Create item
+	i := &pktQueueItem{
+		d:        p.Descriptor,
+		dts:      time.Duration(avutil.AvRescaleQ(pkt.Dts(), p.Descriptor.TimeBase(), nanosecondRational)),
+		key:      pkt.Flags()&avcodec.AV_PKT_FLAG_KEY > 0,
+		m:        p.Metadata,
+		pkt:      pkt,
+		priority: pktQueuePriorityKeep,
+		stream:   pkt.StreamIndex(),
+	}
+
+	// Get media type
+	var mt avcodec.MediaType = avutil.AVMEDIA_TYPE_UNKNOWN
+	if sd, ok := DescriptorStream(p.Descriptor); ok {
+		mt = sd.MediaType()
+	}
+
+	// Get priority
+	switch {
+	case i.key || pkt.AvPacketGetSideData(avcodec.AV_PKT_DATA_NEW_EXTRADATA, nil) != nil:
+		// Keyframes and headers are kept
+	case mt == avutil.AVMEDIA_TYPE_AUDIO:
+		i.priority = pktQueuePriorityAudio
+	case mt == avutil.AVMEDIA_TYPE_VIDEO:
+		i.priority = pktQueuePriorityVideo
+		if pkt.Flags()&pktQueueFlagDisposable > 0 {
+			i.priority = pktQueuePriorityDisposable
+		}
+	}
+	return i
+}
+
+func newPktQueueBuffer(maxDelay time.Duration, maxSize int) *pktQueueBuffer {
+	return &pktQueueBuffer{
+		maxDelay: maxDelay,
+		maxSize:  maxSize,
+		waitKey:  make(map[int]bool),
+	}
+}
+
+func (b *pktQueueBuffer) full() bool {
+	return (b.maxSize > 0 && len(b.items) > b.maxSize) ||
+		(b.maxDelay > 0 && len(b.items) > 1 && b.items[len(b.items)-1].dts-b.items[0].dts > b.maxDelay)
+}
+
+// push returns the items that have been dropped
+func (b *pktQueueBuffer) push(i *pktQueueItem) (dropped []*pktQueueItem) {
+	// Stream is waiting for a keyframe since pkts it depends on have been dropped
+	if b.waitKey[i.stream] {
+		if i.key {
+			delete(b.waitKey, i.stream)
+		} else if i.priority == pktQueuePriorityDisposable || i.priority == pktQueuePriorityVideo {
+			return []*pktQueueItem{i}
+		}
+	}
+
+	// Append
+	b.items = append(b.items, i)
+
+	// Drop until the queue is no longer full or there's nothing left to drop
+	for b.full() {
+		ds := b.drop()
+		if len(ds) == 0 {
+			break
+		}
+		dropped = append(dropped, ds...)
+	}
+	return
+}
+
+func (b *pktQueueBuffer) drop() (dropped []*pktQueueItem) {
+	// Nothing to drop
+	if len(b.items) == 0 {
+		return
+	}
+
+	// Drop by age
+	switch b.dropPolicy {
+	case MuxerDropPolicyNewest:
+		dropped = []*pktQueueItem{b.items[len(b.items)-1]}
+		b.items = b.items[:len(b.items)-1]
+		return
+	case MuxerDropPolicyOldest:
+		dropped = []*pktQueueItem{b.items[0]}
+		b.items = b.items[1:]
+		return
+	}
+
+	// Loop through priorities
+	for p := pktQueuePriorityDisposable; p < pktQueuePriorityKeep; p++ {
+		// Get oldest item with this priority
+		idx := -1
+		for k, i := range b.items {
+			if i.priority == p {
+				idx = k
+				break
+			}
+		}
+		if idx < 0 {
+			continue
+		}
+
+		// Only this item is dropped
+		i := b.items[idx]
+		if p != pktQueuePriorityVideo {
+			b.items = append(b.items[:idx], b.items[idx+1:]...)
+			return []*pktQueueItem{i}
+		}
+
+		// Following pkts of the stream depend on this item, they're dropped until the next keyframe
+		items := append([]*pktQueueItem{}, b.items[:idx]...)
+		key := false
+		for _, v := range b.items[idx:] {
+			if v.stream != i.stream || key {
+				items = append(items, v)
+				continue
+			}
+			if v.key {
+				key = true
+				items = append(items, v)
+				continue
+			}
+			if v.priority == pktQueuePriorityDisposable || v.priority == pktQueuePriorityVideo {
+				dropped = append(dropped, v)
+			} else {
+				items = append(items, v)
+			}
+		}
+		b.items = items
+
+		// Next keyframe is not in the queue yet
+		if !key {
+			b.waitKey[i.stream] = true
+		}
+		return
+	}
+	return
+}
+
+func (b *pktQueueBuffer) pop() (i *pktQueueItem) {
+	if len(b.items) == 0 {
+		return
+	}
+	i = b.items[0]
+	b.items = b.items[1:]
+	return
+}
@@ -0,0 +1,51 @@
+package astilibav
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func pktQueueTestStreams(is []*pktQueueItem) (ss []int) {
+	for _, i := range is {
+		ss = append(ss, i.stream*100+int(i.dts/time.Millisecond))
+	}
+	return
+}
+
+func TestPktQueueBuffer(t *testing.T) {
+	// Video is stream 0, audio is stream 1
+	b := newPktQueueBuffer(0, 4)
+	assert.Empty(t, b.push(&pktQueueItem{dts: 0, key: true, priority: pktQueuePriorityKeep}))
+	assert.Empty(t, b.push(&pktQueueItem{dts: 1, priority: pktQueuePriorityVideo}))
+	assert.Empty(t, b.push(&pktQueueItem{dts: 2, priority: pktQueuePriorityDisposable}))
+	assert.Empty(t, b.push(&pktQueueItem{dts: 3 * time.Millisecond, priority: pktQueuePriorityAudio, stream: 1}))
+
+	// Disposable pkts are dropped first
+	assert.Equal(t, []int{0}, pktQueueTestStreams(b.push(&pktQueueItem{dts: 4 * time.Millisecond, priority: pktQueuePriorityAudio, stream: 1})))
+
+	// Audio pkts are dropped next
+	assert.Equal(t, []int{103}, pktQueueTestStreams(b.push(&pktQueueItem{dts: 5 * time.Millisecond, priority: pktQueuePriorityVideo})))
+
+	// Non-key video pkts are dropped along with the following ones
+	assert.Equal(t, []int{104}, pktQueueTestStreams(b.push(&pktQueueItem{dts: 6 * time.Millisecond, priority: pktQueuePriorityVideo})))
+	assert.Equal(t, []int{0, 5, 6}, pktQueueTestStreams(b.drop()))
+	assert.Equal(t, []int{0}, pktQueueTestStreams(b.items))
+
+	// Stream is waiting for a keyframe
+	assert.Equal(t, []int{7}, pktQueueTestStreams(b.push(&pktQueueItem{dts: 7 * time.Millisecond, priority: pktQueuePriorityDisposable})))
+	assert.Empty(t, b.push(&pktQueueItem{dts: 8 * time.Millisecond, key: true, priority: pktQueuePriorityKeep}))
+	assert.Empty(t, b.push(&pktQueueItem{dts: 9 * time.Millisecond, priority: pktQueuePriorityVideo}))
+	assert.Equal(t, []int{0, 8, 9}, pktQueueTestStreams(b.items))
+
+	// Pop
+	assert.Equal(t, time.Duration(0), b.pop().dts)
+	assert.Len(t, b.items, 2)
+
+	// Keyframes are never dropped
+	b = newPktQueueBuffer(time.Millisecond, 0)
+	assert.Empty(t, b.push(&pktQueueItem{dts: 0, key: true, priority: pktQueuePriorityKeep}))
+	assert.Empty(t, b.push(&pktQueueItem{dts: 5 * time.Millisecond, key: true, priority: pktQueuePriorityKeep}))
+	assert.Len(t, b.items, 2)
+}
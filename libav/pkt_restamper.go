@@ -3,7 +3,10 @@ package astilibav
 import (
 	"sync"
 
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
 	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avutil"
 )
 
 // PktRestamper represents an object capable of restamping packets
@@ -56,6 +59,84 @@ func (r *pktRestamperStartFromZero) Restamp(pkt *avcodec.Packet) {
 	})
 }
 
+// PktRestamperOffset represents a pkt restamper that adds an offset to timestamps
+// The offset can be updated at runtime, for instance to stitch a backup feed onto a primary feed
+type PktRestamperOffset struct {
+	m      *sync.Mutex
+	offset int64
+}
+
+// NewPktRestamperOffset creates a new pkt restamper that adds an offset to timestamps
+// offset must be a duration in pkt time base
+func NewPktRestamperOffset(offset int64) *PktRestamperOffset {
+	return &PktRestamperOffset{
+		m:      &sync.Mutex{},
+		offset: offset,
+	}
+}
+
+// Offset returns the offset
+func (r *PktRestamperOffset) Offset() int64 {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.offset
+}
+
+// SetOffset updates the offset
+func (r *PktRestamperOffset) SetOffset(offset int64) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.offset = offset
+}
+
+// Restamp implements the Restamper interface
+func (r *PktRestamperOffset) Restamp(pkt *avcodec.Packet) {
+	offset := r.Offset()
+	if pkt.Dts() != avutil.AV_NOPTS_VALUE {
+		pkt.SetDts(pkt.Dts() + offset)
+	}
+	if pkt.Pts() != avutil.AV_NOPTS_VALUE {
+		pkt.SetPts(pkt.Pts() + offset)
+	}
+}
+
+type pktRestamperWithClock struct {
+	c        astiencoder.Clock
+	m        *sync.Mutex
+	offset   *int64
+	timeBase avutil.Rational
+}
+
+// NewPktRestamperWithClock creates a new pkt restamper that starts timestamps from the clock position at the time the
+// first pkt is restamped
+// The offset is computed once, on the first pkt of any stream, and applied to all streams so that they keep their
+// relative offsets
+// timeBase must be the pkt time base
+func NewPktRestamperWithClock(c astiencoder.Clock, timeBase avutil.Rational) PktRestamper {
+	return &pktRestamperWithClock{
+		c:        c,
+		m:        &sync.Mutex{},
+		timeBase: timeBase,
+	}
+}
+
+// Restamp implements the Restamper interface
+func (r *pktRestamperWithClock) Restamp(pkt *avcodec.Packet) {
+	// Compute offset
+	r.m.Lock()
+	if r.offset == nil {
+		r.offset = astikit.Int64Ptr(clockPosition(r.c, r.timeBase) - pkt.Dts())
+	}
+	offset := *r.offset
+	r.m.Unlock()
+
+	// Restamp
+	delta := pkt.Pts() - pkt.Dts()
+	dts := pkt.Dts() + offset
+	pkt.SetDts(dts)
+	pkt.SetPts(dts + delta)
+}
+
 type pktRestamperWithPktDuration struct {
 	lastItem map[int]*pktRestamperWithPktDurationItem
 	m        *sync.Mutex
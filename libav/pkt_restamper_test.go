@@ -2,8 +2,10 @@ package astilibav
 
 import (
 	"testing"
+	"time"
 
 	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avutil"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -56,3 +58,40 @@ func TestPktRestamperWithPktDuration(t *testing.T) {
 		assert.Equal(t, ft.outputPts, pkt.Pts())
 	}
 }
+
+func TestPktRestamperOffset(t *testing.T) {
+	pkt := avcodec.Packet{}
+	r := NewPktRestamperOffset(10)
+	pkt.SetDts(5)
+	pkt.SetPts(7)
+	r.Restamp(&pkt)
+	assert.Equal(t, int64(15), pkt.Dts())
+	assert.Equal(t, int64(17), pkt.Pts())
+	r.SetOffset(-5)
+	assert.Equal(t, int64(-5), r.Offset())
+	pkt.SetDts(20)
+	pkt.SetPts(22)
+	r.Restamp(&pkt)
+	assert.Equal(t, int64(15), pkt.Dts())
+	assert.Equal(t, int64(17), pkt.Pts())
+}
+
+func TestPktRestamperWithClock(t *testing.T) {
+	c := &clockTest{d: 100 * time.Millisecond}
+	pkt := avcodec.Packet{}
+	r := NewPktRestamperWithClock(c, avutil.NewRational(1, 1000))
+	for _, ft := range []pktTest{
+		{inputDts: 10, inputPts: 12, outputDts: 100, outputPts: 102, streamIdx: 1},
+		{inputDts: 15, inputPts: 15, outputDts: 105, outputPts: 105, streamIdx: 2},
+		{inputDts: 20, inputPts: 23, outputDts: 110, outputPts: 113, streamIdx: 1},
+		{inputDts: 25, inputPts: 25, outputDts: 115, outputPts: 115, streamIdx: 2},
+	} {
+		pkt.SetDts(ft.inputDts)
+		pkt.SetPts(ft.inputPts)
+		pkt.SetStreamIndex(ft.streamIdx)
+		r.Restamp(&pkt)
+		assert.Equal(t, ft.outputDts, pkt.Dts())
+		assert.Equal(t, ft.outputPts, pkt.Pts())
+		c.d += 50 * time.Millisecond
+	}
+}
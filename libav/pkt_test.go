@@ -0,0 +1,47 @@
+package astilibav
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avformat"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockedRateLimitedPktHandler struct {
+	*mockedNode
+	pkts       uint64
+	rateLimits uint64
+}
+
+func (h *mockedRateLimitedPktHandler) HandlePkt(p *PktHandlerPayload) {
+	atomic.AddUint64(&h.pkts, 1)
+}
+
+func (h *mockedRateLimitedPktHandler) HandleRateLimit() {
+	atomic.AddUint64(&h.rateLimits, 1)
+}
+
+func TestPktCondRateLimit(t *testing.T) {
+	ctxFormat := avformat.AvformatAllocContext()
+	defer ctxFormat.AvformatFreeContext()
+	s := ctxFormat.AvformatNewStream(nil)
+
+	c := astikit.NewCloser()
+	defer c.Close()
+	d := &Demuxer{BaseNode: newMockedNode("demuxer").BaseNode}
+	d.d = newPktDispatcher(d, astiencoder.NewEventHandler(), c)
+	h := &mockedRateLimitedPktHandler{mockedNode: newMockedNode("handler")}
+	d.ConnectForStream(h, s)
+
+	pkt := avcodec.AvPacketAlloc()
+	defer avcodec.AvPacketFree(pkt)
+	pkt.SetStreamIndex(s.Index())
+	d.d.dispatch(pkt, nil, nil)
+	d.d.wait()
+	assert.Equal(t, uint64(1), atomic.LoadUint64(&h.pkts))
+	assert.Equal(t, uint64(1), atomic.LoadUint64(&h.rateLimits))
+}
@@ -0,0 +1,272 @@
+package astilibav
+
+//#cgo pkg-config: libavformat libavutil
+//#include <stdlib.h>
+//#include <libavformat/avformat.h>
+//#include <libavutil/dict.h>
+//#include <libavutil/pixdesc.h>
+import "C"
+import (
+	"context"
+	"fmt"
+	"time"
+	"unsafe"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avformat"
+	"github.com/asticode/goav/avutil"
+)
+
+// ProbeOptions represents probe options
+type ProbeOptions struct {
+	// Context used to cancel finding stream info and reading packets
+	Context context.Context
+	// String content of the demuxer as you would use in ffmpeg
+	Dict string
+	// Private options of the input format. Entries override the ones of Dict.
+	Dictionary map[string]string
+	// Exact input format
+	Format *avformat.InputFormat
+	// Short name of the input format, used when Format is not provided
+	FormatName string
+	// If > 0, reading packets stops after this number of packets
+	MaxPackets int
+	// If true, packets are read and described
+	Packets bool
+}
+
+// ProbeResult represents information gathered on an input
+type ProbeResult struct {
+	Chapters []Chapter     `json:"chapters,omitempty"`
+	Format   ProbeFormat   `json:"format"`
+	Packets  []ProbePacket `json:"packets,omitempty"`
+	Streams  []ProbeStream `json:"streams"`
+}
+
+// ProbeFormat represents information gathered on an input format
+type ProbeFormat struct {
+	BitRate   int               `json:"bit_rate"`
+	Duration  time.Duration     `json:"duration"`
+	LongName  string            `json:"long_name"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Name      string            `json:"name"`
+	NbStreams int               `json:"nb_streams"`
+	StartTime time.Duration     `json:"start_time"`
+	URL       string            `json:"url"`
+}
+
+// ProbeStream represents information gathered on an input stream
+type ProbeStream struct {
+	BitDepth          int               `json:"bit_depth,omitempty"`
+	BitRate           int               `json:"bit_rate"`
+	ChannelLayout     uint64            `json:"channel_layout,omitempty"`
+	ChannelLayoutName string            `json:"channel_layout_name,omitempty"`
+	Channels          int               `json:"channels,omitempty"`
+	CodecName         string            `json:"codec_name"`
+	CodecType         string            `json:"codec_type"`
+	Disposition       int               `json:"disposition"`
+	Duration          time.Duration     `json:"duration"`
+	FrameRate         string            `json:"frame_rate,omitempty"`
+	HDR               bool              `json:"hdr,omitempty"`
+	Height            int               `json:"height,omitempty"`
+	ID                int               `json:"id"`
+	Index             int               `json:"index"`
+	Level             int               `json:"level"`
+	Metadata          map[string]string `json:"metadata,omitempty"`
+	NbFrames          int64             `json:"nb_frames"`
+	PixelFormat       string            `json:"pixel_format,omitempty"`
+	Profile           int               `json:"profile"`
+	SampleAspectRatio string            `json:"sample_aspect_ratio,omitempty"`
+	SampleFormat      string            `json:"sample_format,omitempty"`
+	SampleRate        int               `json:"sample_rate,omitempty"`
+	SideData          []string          `json:"side_data,omitempty"`
+	StartTime         time.Duration     `json:"start_time"`
+	TimeBase          string            `json:"time_base"`
+	Width             int               `json:"width,omitempty"`
+}
+
+// ProbePacket represents information gathered on an input packet
+// Timestamps are nil when they are not set
+type ProbePacket struct {
+	Dts         *time.Duration `json:"dts,omitempty"`
+	Duration    time.Duration  `json:"duration"`
+	KeyFrame    bool           `json:"key_frame"`
+	Pos         int64          `json:"pos"`
+	Pts         *time.Duration `json:"pts,omitempty"`
+	Size        int            `json:"size"`
+	StreamIndex int            `json:"stream_index"`
+}
+
+// Probe opens an input and gathers information on its format, streams, chapters and, optionally, packets
+func Probe(url string, o ProbeOptions) (r ProbeResult, err error) {
+	// Create closer
+	c := astikit.NewCloser()
+	defer c.Close()
+
+	// Create demuxer
+	var d *Demuxer
+	if d, err = NewDemuxer(DemuxerOptions{
+		Dict:              o.Dict,
+		Dictionary:        o.Dictionary,
+		FindStreamInfoCtx: o.Context,
+		Format:            o.Format,
+		FormatName:        o.FormatName,
+		URL:               url,
+	}, astiencoder.NewEventHandler(), c); err != nil {
+		err = fmt.Errorf("astilibav: creating demuxer failed: %w", err)
+		return
+	}
+
+	// Format
+	cf := (*C.struct_AVFormatContext)(unsafe.Pointer(d.ctxFormat))
+	r.Format = ProbeFormat{
+		BitRate:   d.ctxFormat.BitRate(),
+		Duration:  probeDuration(d.ctxFormat.Duration(), avutil.NewRational(1, avutil.AV_TIME_BASE)),
+		Metadata:  probeMetadata(cf.metadata),
+		NbStreams: len(d.ctxFormat.Streams()),
+		StartTime: probeDuration(d.ctxFormat.StartTime(), avutil.NewRational(1, avutil.AV_TIME_BASE)),
+		URL:       url,
+	}
+	if cf.iformat != nil {
+		r.Format.LongName = C.GoString(cf.iformat.long_name)
+		r.Format.Name = C.GoString(cf.iformat.name)
+	}
+
+	// Streams
+	for _, s := range d.ctxFormat.Streams() {
+		r.Streams = append(r.Streams, newProbeStream(s, d.ss[s.Index()].sd))
+	}
+
+	// Chapters
+	r.Chapters = d.Chapters()
+
+	// No packets
+	if !o.Packets {
+		return
+	}
+
+	// Read packets
+	pkt := d.d.p.get()
+	defer d.d.p.put(pkt)
+	for o.MaxPackets <= 0 || len(r.Packets) < o.MaxPackets {
+		// Check context
+		if o.Context != nil && o.Context.Err() != nil {
+			err = fmt.Errorf("astilibav: reading packets has been cancelled: %w", o.Context.Err())
+			return
+		}
+
+		// Read frame
+		if ret := d.ctxFormat.AvReadFrame(pkt); ret < 0 {
+			if ret != avutil.AVERROR_EOF {
+				err = fmt.Errorf("astilibav: ctxFormat.AvReadFrame on %s failed: %w", url, NewAvError(ret))
+			}
+			return
+		}
+
+		// Append packet
+		if s, ok := d.ss[pkt.StreamIndex()]; ok {
+			r.Packets = append(r.Packets, newProbePacket(pkt, s.s.TimeBase()))
+		}
+		defaultBindings.pktUnref(pkt)
+	}
+	return
+}
+
+func newProbeStream(s *avformat.Stream, sd StreamDescriptor) (o ProbeStream) {
+	// Shared
+	cs := (*C.struct_AVStream)(unsafe.Pointer(s))
+	ctx := sd.Context()
+	o = ProbeStream{
+		BitRate:     ctx.BitRate,
+		CodecName:   avcodec.AvcodecGetName(ctx.CodecID),
+		CodecType:   avutil.AvGetMediaTypeString(avutil.MediaType(ctx.CodecType)),
+		Disposition: s.Disposition(),
+		Duration:    probeDuration(s.Duration(), s.TimeBase()),
+		ID:          s.Id(),
+		Index:       s.Index(),
+		Level:       ctx.Level,
+		Metadata:    probeMetadata(cs.metadata),
+		NbFrames:    s.NbFrames(),
+		Profile:     ctx.Profile,
+		SideData:    sd.SideData(),
+		StartTime:   probeDuration(int64(cs.start_time), s.TimeBase()),
+		TimeBase:    probeRational(s.TimeBase()),
+	}
+
+	// Switch on media type
+	switch ctx.CodecType {
+	case avutil.AVMEDIA_TYPE_AUDIO:
+		o.ChannelLayout = ctx.ChannelLayout
+		if ctx.ChannelLayout > 0 {
+			o.ChannelLayoutName = avutil.AvGetChannelLayoutString(ctx.ChannelLayout)
+		}
+		o.Channels = ctx.Channels
+		o.SampleFormat = avutil.AvGetSampleFmtName(int(ctx.SampleFmt))
+		o.SampleRate = ctx.SampleRate
+	case avutil.AVMEDIA_TYPE_VIDEO:
+		o.BitDepth = ctx.BitDepth
+		o.FrameRate = probeRational(ctx.FrameRate)
+		o.HDR = ctx.HDR()
+		o.Height = ctx.Height
+		if n := C.av_get_pix_fmt_name(C.enum_AVPixelFormat(ctx.PixelFormat)); n != nil {
+			o.PixelFormat = C.GoString(n)
+		}
+		o.SampleAspectRatio = probeRational(ctx.SampleAspectRatio)
+		o.Width = ctx.Width
+	}
+	return
+}
+
+func newProbePacket(pkt *avcodec.Packet, timeBase avutil.Rational) (p ProbePacket) {
+	p = ProbePacket{
+		Duration:    probeDuration(pkt.Duration(), timeBase),
+		KeyFrame:    pkt.Flags()&avcodec.AV_PKT_FLAG_KEY > 0,
+		Pos:         pkt.Pos(),
+		Size:        pkt.Size(),
+		StreamIndex: pkt.StreamIndex(),
+	}
+	if pkt.Dts() != avutil.AV_NOPTS_VALUE {
+		d := probeDuration(pkt.Dts(), timeBase)
+		p.Dts = &d
+	}
+	if pkt.Pts() != avutil.AV_NOPTS_VALUE {
+		d := probeDuration(pkt.Pts(), timeBase)
+		p.Pts = &d
+	}
+	return
+}
+
+func probeDuration(v int64, timeBase avutil.Rational) time.Duration {
+	if v == avutil.AV_NOPTS_VALUE {
+		return 0
+	}
+	return time.Duration(avutil.AvRescaleQ(v, timeBase, nanosecondRational))
+}
+
+func probeRational(r avutil.Rational) string {
+	if r.Den() == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", r.Num(), r.Den())
+}
+
+func probeMetadata(d *C.AVDictionary) (m map[string]string) {
+	// Loop through entries
+	var e *C.AVDictionaryEntry
+	k := C.CString("")
+	defer C.free(unsafe.Pointer(k))
+	for {
+		// Get next entry
+		if e = C.av_dict_get(d, k, e, C.AV_DICT_IGNORE_SUFFIX); e == nil {
+			return
+		}
+
+		// Add entry
+		if m == nil {
+			m = make(map[string]string)
+		}
+		m[C.GoString(e.key)] = C.GoString(e.value)
+	}
+}
@@ -0,0 +1,438 @@
+package astilibav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+)
+
+var countQualityMeter uint64
+
+// Default quality meter values
+const (
+	defaultQualityMeterPeriod    = 10 * time.Second
+	defaultQualityMeterTolerance = time.Millisecond
+)
+
+const (
+	// PSNR reported for identical frames, since +Inf can't be marshaled to JSON
+	qualityMeterMaxPSNR = 100
+	// Max number of frames waiting for their peer
+	qualityMeterMaxPending = 64
+	// SSIM is computed on 8x8 windows every 4 pixels
+	qualityMeterSSIMStep   = 4
+	qualityMeterSSIMWindow = 8
+)
+
+// QualityMeter represents an object capable of measuring the quality of a distorted video, such as the output of an
+// encoder once decoded, compared to its reference, such as the input of the encoder
+// Frames of both inputs are paired by timestamps and must have the same size and an 8-bit planar YUV pixel format.
+// PSNR is computed on all planes and SSIM on the luma plane
+// An EventNameQualityMeterScores event is emitted at the end of each period of the timeline and an
+// EventNameQualityMeterReport event is emitted once the quality meter is stopped, both with a QualityReport payload
+// VMAF is not computed, ffmpeg's libvmaf filter should be used instead
+type QualityMeter struct {
+	*astiencoder.BaseNode
+	c                *astikit.Chan
+	distorted        []qualityMeterFrame
+	eh               *astiencoder.EventHandler
+	o                QualityMeterOptions
+	period           *qualityMeasurer
+	reference        []qualityMeterFrame
+	statIncomingRate *astikit.CounterAvgStat
+	statWorkRatio    *astikit.DurationPercentageStat
+	total            *qualityMeasurer
+}
+
+// QualityMeterOptions represents quality meter options
+type QualityMeterOptions struct {
+	Distorted astiencoder.Node
+	Node      astiencoder.NodeOptions
+	// Defaults to 10s
+	Period    time.Duration
+	Reference astiencoder.Node
+	// Max difference between the timestamps of 2 frames for them to be paired. Defaults to 1ms
+	Tolerance time.Duration
+}
+
+// QualityScores represents the quality scores of a frame
+// PSNRs are in dB and capped at 100 which is what identical frames are reported as
+type QualityScores struct {
+	// Average of all planes weighted by their number of pixels
+	PSNR  float64
+	PSNRU float64
+	PSNRV float64
+	PSNRY float64
+	// Between 0 and 1
+	SSIM float64
+}
+
+// QualityReport represents a quality report
+// Average PSNRs are computed on the average MSE, the same way ffmpeg's psnr filter does
+type QualityReport struct {
+	Average QualityScores
+	End     time.Duration
+	Frames  int
+	Min     QualityScores
+	Start   time.Duration
+}
+
+type qualityMeterFrame struct {
+	i *image.YCbCr
+	t time.Duration
+}
+
+// NewQualityMeter creates a new quality meter
+func NewQualityMeter(o QualityMeterOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (m *QualityMeter, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countQualityMeter, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("quality_meter_%d", count), fmt.Sprintf("Quality Meter #%d", count), "Measures quality")
+
+	// No inputs
+	if o.Distorted == nil || o.Reference == nil {
+		err = errors.New("astilibav: distorted and reference inputs must be provided")
+		return
+	}
+
+	// Default values
+	if o.Period <= 0 {
+		o.Period = defaultQualityMeterPeriod
+	}
+	if o.Tolerance <= 0 {
+		o.Tolerance = defaultQualityMeterTolerance
+	}
+
+	// Create quality meter
+	m = &QualityMeter{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh:               eh,
+		o:                o,
+		period:           newQualityMeasurer(),
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statWorkRatio:    astikit.NewDurationPercentageStat(),
+		total:            newQualityMeasurer(),
+	}
+	m.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(m), eh)
+	m.addStats()
+	return
+}
+
+func (m *QualityMeter) addStats() {
+	// Add incoming rate
+	m.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of frames coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "fps",
+	}, m.statIncomingRate)
+
+	// Add work ratio
+	m.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, m.statWorkRatio)
+
+	// Add chan stats
+	m.c.AddStats(m.Stater())
+}
+
+// Start starts the quality meter
+func (m *QualityMeter) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	m.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to send the reports
+		defer m.report()
+
+		// Make sure to stop the chan properly
+		defer m.c.Stop()
+
+		// Start chan
+		m.c.Start(m.Context())
+	})
+}
+
+// HandleFrame implements the FrameHandler interface
+func (m *QualityMeter) HandleFrame(p *FrameHandlerPayload) {
+	m.c.Add(func() {
+		// Handle pause
+		defer m.HandlePause()
+
+		// Increment incoming rate
+		m.statIncomingRate.Add(1)
+
+		// Get time
+		if p.Frame.Pts() == avutil.AV_NOPTS_VALUE || p.Descriptor == nil {
+			return
+		}
+		t := time.Duration(avutil.AvRescaleQ(p.Frame.Pts(), p.Descriptor.TimeBase(), nanosecondRational))
+
+		// Get queues
+		var own, peer *[]qualityMeterFrame
+		switch p.Node {
+		case m.o.Distorted:
+			own, peer = &m.distorted, &m.reference
+		case m.o.Reference:
+			own, peer = &m.reference, &m.distorted
+		default:
+			return
+		}
+
+		// Get image
+		m.statWorkRatio.Begin()
+		defer m.statWorkRatio.End()
+		i, err := FrameYCbCr(p.Frame)
+		if err != nil {
+			m.eh.Emit(astiencoder.EventError(m, fmt.Errorf("astilibav: getting image failed: %w", err)))
+			return
+		}
+		f := qualityMeterFrame{i: i, t: t}
+
+		// Pair frame
+		var pf *qualityMeterFrame
+		if pf, *peer, *own = qualityMeterPair(f, *peer, *own, m.o.Tolerance); pf == nil {
+			return
+		}
+
+		// Measure quality
+		ref, dist := pf.i, f.i
+		if p.Node == m.o.Reference {
+			ref, dist = f.i, pf.i
+		}
+		me, err := qualityMeterMeasure(ref, dist)
+		if err != nil {
+			m.eh.Emit(astiencoder.EventError(m, fmt.Errorf("astilibav: measuring quality failed: %w", err)))
+			return
+		}
+
+		// Period is complete
+		if m.period.frames > 0 && t-m.period.start >= m.o.Period {
+			m.emit(EventNameQualityMeterScores, m.period.report())
+			m.period = newQualityMeasurer()
+		}
+
+		// Add measurement
+		m.period.add(t, me)
+		m.total.add(t, me)
+	})
+}
+
+func (m *QualityMeter) report() {
+	// Last period
+	if m.period.frames > 0 {
+		m.emit(EventNameQualityMeterScores, m.period.report())
+		m.period = newQualityMeasurer()
+	}
+
+	// Summary
+	m.emit(EventNameQualityMeterReport, m.total.report())
+}
+
+func (m *QualityMeter) emit(eventName string, r QualityReport) {
+	m.eh.Emit(astiencoder.Event{
+		Name:    eventName,
+		Payload: r,
+		Target:  m,
+	})
+}
+
+// qualityMeterPair looks for the frame of the peer queue matching the provided frame and returns it as well as the
+// updated queues. Peer frames older than the provided frame are dropped and, if no match is found, the provided frame
+// is added to its own queue
+func qualityMeterPair(f qualityMeterFrame, peer, own []qualityMeterFrame, tolerance time.Duration) (pf *qualityMeterFrame, newPeer, newOwn []qualityMeterFrame) {
+	// Drop old peer frames
+	for len(peer) > 0 && peer[0].t < f.t-tolerance {
+		peer = peer[1:]
+	}
+
+	// Match
+	if len(peer) > 0 && peer[0].t <= f.t+tolerance {
+		pf = &peer[0]
+		return pf, peer[1:], own
+	}
+
+	// Add to own queue
+	own = append(own, f)
+	if len(own) > qualityMeterMaxPending {
+		own = own[len(own)-qualityMeterMaxPending:]
+	}
+	return nil, peer, own
+}
+
+// qualityMeterMeasurement represents the raw measurement of a frame
+type qualityMeterMeasurement struct {
+	chromaPixels int
+	lumaPixels   int
+	mseU         float64
+	mseV         float64
+	mseY         float64
+	ssim         float64
+}
+
+func qualityMeterMeasure(ref, dist *image.YCbCr) (m qualityMeterMeasurement, err error) {
+	// Check images
+	if ref.Rect != dist.Rect || ref.SubsampleRatio != dist.SubsampleRatio {
+		err = fmt.Errorf("astilibav: reference %s and distorted %s images don't match", ref.Rect, dist.Rect)
+		return
+	}
+
+	// Get sizes
+	w, h := ref.Rect.Dx(), ref.Rect.Dy()
+	cw, ch := ref.CStride, len(ref.Cb)/ref.CStride
+	m.chromaPixels, m.lumaPixels = cw*ch, w*h
+
+	// Measure
+	m.mseY = qualityMeterMSE(ref.Y, dist.Y, w, h, ref.YStride, dist.YStride)
+	m.mseU = qualityMeterMSE(ref.Cb, dist.Cb, cw, ch, ref.CStride, dist.CStride)
+	m.mseV = qualityMeterMSE(ref.Cr, dist.Cr, cw, ch, ref.CStride, dist.CStride)
+	m.ssim = qualityMeterSSIM(ref.Y, dist.Y, w, h, ref.YStride, dist.YStride)
+	return
+}
+
+func (m qualityMeterMeasurement) scores() QualityScores {
+	return QualityScores{
+		PSNR:  qualityMeterPSNR((m.mseY*float64(m.lumaPixels) + (m.mseU+m.mseV)*float64(m.chromaPixels)) / float64(m.lumaPixels+2*m.chromaPixels)),
+		PSNRU: qualityMeterPSNR(m.mseU),
+		PSNRV: qualityMeterPSNR(m.mseV),
+		PSNRY: qualityMeterPSNR(m.mseY),
+		SSIM:  m.ssim,
+	}
+}
+
+// qualityMeterMSE returns the mean squared error between 2 planes
+func qualityMeterMSE(a, b []byte, w, h, strideA, strideB int) float64 {
+	if w <= 0 || h <= 0 {
+		return 0
+	}
+	var sum uint64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			d := int(a[y*strideA+x]) - int(b[y*strideB+x])
+			sum += uint64(d * d)
+		}
+	}
+	return float64(sum) / float64(w*h)
+}
+
+// qualityMeterPSNR converts a mean squared error to a PSNR in dB
+func qualityMeterPSNR(mse float64) float64 {
+	if mse <= 0 {
+		return qualityMeterMaxPSNR
+	}
+	return math.Min(qualityMeterMaxPSNR, 10*math.Log10(255*255/mse))
+}
+
+// qualityMeterSSIM returns the mean SSIM of overlapping windows of 2 planes
+func qualityMeterSSIM(a, b []byte, w, h, strideA, strideB int) float64 {
+	// Constants
+	const c1 = (0.01 * 255) * (0.01 * 255)
+	const c2 = (0.03 * 255) * (0.03 * 255)
+
+	// Plane is smaller than a window
+	ww, wh := qualityMeterSSIMWindow, qualityMeterSSIMWindow
+	if w < ww {
+		ww = w
+	}
+	if h < wh {
+		wh = h
+	}
+	if ww <= 0 || wh <= 0 {
+		return 1
+	}
+
+	// Loop through windows
+	var sum float64
+	var count int
+	n := float64(ww * wh)
+	for y := 0; y+wh <= h; y += qualityMeterSSIMStep {
+		for x := 0; x+ww <= w; x += qualityMeterSSIMStep {
+			// Get sums
+			var sa, sb, saa, sbb, sab float64
+			for wy := y; wy < y+wh; wy++ {
+				for wx := x; wx < x+ww; wx++ {
+					va, vb := float64(a[wy*strideA+wx]), float64(b[wy*strideB+wx])
+					sa += va
+					sb += vb
+					saa += va * va
+					sbb += vb * vb
+					sab += va * vb
+				}
+			}
+
+			// Get ssim
+			ma, mb := sa/n, sb/n
+			va, vb, cov := saa/n-ma*ma, sbb/n-mb*mb, sab/n-ma*mb
+			sum += ((2*ma*mb + c1) * (2*cov + c2)) / ((ma*ma + mb*mb + c1) * (va + vb + c2))
+			count++
+		}
+	}
+	return sum / float64(count)
+}
+
+type qualityMeasurer struct {
+	end    time.Duration
+	frames int
+	min    QualityScores
+	start  time.Duration
+	sum    qualityMeterMeasurement
+}
+
+func newQualityMeasurer() *qualityMeasurer {
+	return &qualityMeasurer{}
+}
+
+func (m *qualityMeasurer) add(t time.Duration, me qualityMeterMeasurement) {
+	// Update times
+	s := me.scores()
+	if m.frames == 0 {
+		m.start = t
+		m.min = s
+	}
+	m.end = t
+	m.frames++
+
+	// Update min
+	m.min.PSNR = math.Min(m.min.PSNR, s.PSNR)
+	m.min.PSNRU = math.Min(m.min.PSNRU, s.PSNRU)
+	m.min.PSNRV = math.Min(m.min.PSNRV, s.PSNRV)
+	m.min.PSNRY = math.Min(m.min.PSNRY, s.PSNRY)
+	m.min.SSIM = math.Min(m.min.SSIM, s.SSIM)
+
+	// Update sums
+	m.sum.chromaPixels, m.sum.lumaPixels = me.chromaPixels, me.lumaPixels
+	m.sum.mseU += me.mseU
+	m.sum.mseV += me.mseV
+	m.sum.mseY += me.mseY
+	m.sum.ssim += me.ssim
+}
+
+func (m *qualityMeasurer) report() (r QualityReport) {
+	r = QualityReport{
+		End:    m.end,
+		Frames: m.frames,
+		Min:    m.min,
+		Start:  m.start,
+	}
+	if m.frames == 0 {
+		return
+	}
+	n := float64(m.frames)
+	r.Average = qualityMeterMeasurement{
+		chromaPixels: m.sum.chromaPixels,
+		lumaPixels:   m.sum.lumaPixels,
+		mseU:         m.sum.mseU / n,
+		mseV:         m.sum.mseV / n,
+		mseY:         m.sum.mseY / n,
+		ssim:         m.sum.ssim / n,
+	}.scores()
+	return
+}
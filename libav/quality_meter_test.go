@@ -0,0 +1,75 @@
+package astilibav
+
+import (
+	"image"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQualityMeterPair(t *testing.T) {
+	f := func(t time.Duration) qualityMeterFrame { return qualityMeterFrame{t: t} }
+
+	// No peer frames
+	pf, peer, own := qualityMeterPair(f(0), nil, nil, time.Millisecond)
+	assert.Nil(t, pf)
+	assert.Len(t, peer, 0)
+	assert.Equal(t, []qualityMeterFrame{f(0)}, own)
+
+	// Old peer frames are dropped and the matching frame is returned
+	pf, peer, own = qualityMeterPair(f(2*time.Second), []qualityMeterFrame{f(0), f(time.Second), f(2*time.Second + time.Millisecond), f(3 * time.Second)}, nil, time.Millisecond)
+	assert.Equal(t, f(2*time.Second+time.Millisecond), *pf)
+	assert.Equal(t, []qualityMeterFrame{f(3 * time.Second)}, peer)
+	assert.Len(t, own, 0)
+
+	// No match
+	pf, peer, own = qualityMeterPair(f(2*time.Second), []qualityMeterFrame{f(3 * time.Second)}, []qualityMeterFrame{f(time.Second)}, time.Millisecond)
+	assert.Nil(t, pf)
+	assert.Equal(t, []qualityMeterFrame{f(3 * time.Second)}, peer)
+	assert.Equal(t, []qualityMeterFrame{f(time.Second), f(2 * time.Second)}, own)
+}
+
+func TestQualityMeterMeasure(t *testing.T) {
+	// Create images
+	ref := image.NewYCbCr(image.Rect(0, 0, 16, 16), image.YCbCrSubsampleRatio420)
+	dist := image.NewYCbCr(image.Rect(0, 0, 16, 16), image.YCbCrSubsampleRatio420)
+	for idx := range ref.Y {
+		ref.Y[idx] = uint8(idx % 200)
+		dist.Y[idx] = uint8(idx % 200)
+	}
+
+	// Identical
+	m, err := qualityMeterMeasure(ref, dist)
+	assert.NoError(t, err)
+	s := m.scores()
+	assert.Equal(t, float64(qualityMeterMaxPSNR), s.PSNR)
+	assert.InDelta(t, 1, s.SSIM, 0.0001)
+
+	// Distorted
+	for idx := range dist.Y {
+		dist.Y[idx] += 4
+	}
+	m, err = qualityMeterMeasure(ref, dist)
+	assert.NoError(t, err)
+	s = m.scores()
+	assert.InDelta(t, 36.0896, s.PSNRY, 0.0001)
+	assert.Equal(t, float64(qualityMeterMaxPSNR), s.PSNRU)
+	assert.InDelta(t, 37.8505, s.PSNR, 0.0001)
+	assert.True(t, s.SSIM < 1)
+
+	// Measurer
+	qm := newQualityMeasurer()
+	qm.add(time.Second, m)
+	qm.add(2*time.Second, qualityMeterMeasurement{chromaPixels: 64, lumaPixels: 256, ssim: 1})
+	r := qm.report()
+	assert.Equal(t, 2, r.Frames)
+	assert.Equal(t, time.Second, r.Start)
+	assert.Equal(t, 2*time.Second, r.End)
+	assert.InDelta(t, 39.0999, r.Average.PSNRY, 0.0001)
+	assert.InDelta(t, 36.0896, r.Min.PSNRY, 0.0001)
+
+	// Sizes don't match
+	_, err = qualityMeterMeasure(ref, image.NewYCbCr(image.Rect(0, 0, 8, 8), image.YCbCrSubsampleRatio420))
+	assert.Error(t, err)
+}
@@ -3,6 +3,7 @@ package astilibav
 import (
 	"context"
 	"fmt"
+	"image"
 	"math"
 	"sync"
 	"sync/atomic"
@@ -15,22 +16,40 @@ import (
 
 var countRateEnforcer uint64
 
+// Rate enforcer modes
+const (
+	RateEnforcerModeFrameRate = "frame_rate"
+	RateEnforcerModeWallClock = "wall_clock"
+)
+
 // RateEnforcer represents an object capable of enforcing rate based on PTS
+// In the "frame_rate" mode, a frame is dispatched every frame rate period, frames being picked based on their PTS
+// and the previous frame being duplicated when there's none
+// In the "wall_clock" mode, frames are dispatched when they're due according to their PTS and the clock, which is
+// useful to stream files as pseudo-live. When a frame is either late or early by more than the resync threshold, the
+// rate enforcer resyncs on it instead of trying to catch up or waiting
+// Both modes rely on the clock, which is the wall clock by default. Sharing a clock across nodes, for instance the
+// workflow clock or an audio master clock, keeps them paced against the same time reference
 type RateEnforcer struct {
 	*astiencoder.BaseNode
 	buf              []*rateEnforcerItem
 	c                *astikit.Chan
+	clock            astiencoder.Clock
 	d                *frameDispatcher
 	eh               *astiencoder.EventHandler
 	m                *sync.Mutex
 	n                astiencoder.Node
+	o                RateEnforcerOptions
 	p                *framePool
+	pc               pacer
 	period           time.Duration
 	previousItem     *rateEnforcerItem
 	restamper        FrameRestamper
 	slotsCount       int
 	slots            []*rateEnforcerSlot
 	statIncomingRate *astikit.CounterAvgStat
+	statPacingRatio  *astikit.DurationPercentageStat
+	statResyncs      *astikit.CounterAvgStat
 	statWorkRatio    *astikit.DurationPercentageStat
 	timeBase         avutil.Rational
 }
@@ -45,15 +64,26 @@ type rateEnforcerSlot struct {
 type rateEnforcerItem struct {
 	d Descriptor
 	f *avutil.Frame
+	m *UnitMetadata
 	n astiencoder.Node
 }
 
 // RateEnforcerOptions represents rate enforcer options
 type RateEnforcerOptions struct {
-	Delay     time.Duration
+	// Clock frames are paced against, for instance the workflow clock. Defaults to a wall clock
+	Clock astiencoder.Clock
+	// Only used in the "frame_rate" mode
+	Delay time.Duration
+	// Only used in the "frame_rate" mode
 	FrameRate avutil.Rational
+	// Possible values are "frame_rate" and "wall_clock". Defaults to "frame_rate"
+	Mode      string
 	Node      astiencoder.NodeOptions
 	Restamper FrameRestamper
+	// Only used in the "wall_clock" mode. Defaults to 1s
+	ResyncThreshold time.Duration
+	// Only used in the "wall_clock" mode. 2 means frames are dispatched twice as fast as real time. Defaults to 1
+	Speed float64
 }
 
 // NewRateEnforcer creates a new rate enforcer
@@ -62,25 +92,45 @@ func NewRateEnforcer(o RateEnforcerOptions, eh *astiencoder.EventHandler, c *ast
 	count := atomic.AddUint64(&countRateEnforcer, uint64(1))
 	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("rate_enforcer_%d", count), fmt.Sprintf("Rate Enforcer #%d", count), "Enforces rate")
 
+	// Default values
+	if o.Mode == "" {
+		o.Mode = RateEnforcerModeFrameRate
+	}
+	if o.ResyncThreshold <= 0 {
+		o.ResyncThreshold = time.Second
+	}
+	if o.Speed <= 0 {
+		o.Speed = 1
+	}
+	if o.Clock == nil {
+		o.Clock = astiencoder.NewWallClock()
+	}
+
 	// Create rate enforcer
 	r = &RateEnforcer{
 		c: astikit.NewChan(astikit.ChanOptions{
 			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
 			ProcessAll:  true,
 		}),
+		clock:            o.Clock,
 		eh:               eh,
 		m:                &sync.Mutex{},
+		o:                o,
 		p:                newFramePool(c),
-		period:           time.Duration(float64(1e9) / o.FrameRate.ToDouble()),
 		restamper:        o.Restamper,
 		slots:            []*rateEnforcerSlot{nil},
 		statIncomingRate: astikit.NewCounterAvgStat(),
+		statPacingRatio:  astikit.NewDurationPercentageStat(),
+		statResyncs:      astikit.NewCounterAvgStat(),
 		statWorkRatio:    astikit.NewDurationPercentageStat(),
-		timeBase:         avutil.NewRational(o.FrameRate.Den(), o.FrameRate.Num()),
+	}
+	if o.Mode == RateEnforcerModeFrameRate {
+		r.period = time.Duration(float64(1e9) / o.FrameRate.ToDouble())
+		r.slotsCount = int(math.Max(math.Floor(float64(o.Delay)/float64(r.period)), 1))
+		r.timeBase = avutil.NewRational(o.FrameRate.Den(), o.FrameRate.Num())
 	}
 	r.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(r), eh)
 	r.d = newFrameDispatcher(r, eh, c)
-	r.slotsCount = int(math.Max(math.Floor(float64(o.Delay)/float64(r.period)), 1))
 	r.addStats()
 	return
 }
@@ -93,6 +143,23 @@ func (r *RateEnforcer) addStats() {
 		Unit:        "fps",
 	}, r.statIncomingRate)
 
+	// Add wall clock stats
+	if r.o.Mode == RateEnforcerModeWallClock {
+		// Add pacing ratio
+		r.Stater().AddStat(astikit.StatMetadata{
+			Description: "Percentage of time spent waiting for frames to be due",
+			Label:       "Pacing ratio",
+			Unit:        "%",
+		}, r.statPacingRatio)
+
+		// Add resyncs
+		r.Stater().AddStat(astikit.StatMetadata{
+			Description: "Number of resyncs per second",
+			Label:       "Resyncs",
+			Unit:        "rps",
+		}, r.statResyncs)
+	}
+
 	// Add work ratio
 	r.Stater().AddStat(astikit.StatMetadata{
 		Description: "Percentage of time spent doing some actual work",
@@ -132,6 +199,11 @@ func (r *RateEnforcer) Disconnect(h FrameHandler) {
 	astiencoder.DisconnectNodes(r, h)
 }
 
+// Snapshot implements the astiencoder.Snapshotter interface
+func (r *RateEnforcer) Snapshot(ctx context.Context) (image.Image, error) {
+	return r.d.snapshot(ctx)
+}
+
 // Start starts the rate enforcer
 func (r *RateEnforcer) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
 	r.BaseNode.Start(ctx, t, func(t *astikit.Task) {
@@ -142,7 +214,9 @@ func (r *RateEnforcer) Start(ctx context.Context, t astiencoder.CreateTaskFunc)
 		defer r.c.Stop()
 
 		// Start tick
-		r.startTick(r.Context())
+		if r.o.Mode == RateEnforcerModeFrameRate {
+			r.startTick(r.Context())
+		}
 
 		// Start chan
 		r.c.Start(r.Context())
@@ -158,6 +232,12 @@ func (r *RateEnforcer) HandleFrame(p *FrameHandlerPayload) {
 		// Increment incoming rate
 		r.statIncomingRate.Add(1)
 
+		// Wall clock
+		if r.o.Mode == RateEnforcerModeWallClock {
+			r.handleFrameWallClock(p)
+			return
+		}
+
 		// Lock
 		r.m.Lock()
 		defer r.m.Unlock()
@@ -180,7 +260,7 @@ func (r *RateEnforcer) HandleFrame(p *FrameHandlerPayload) {
 		i := r.newRateEnforcerItem(p)
 
 		// Copy frame
-		if ret := avutil.AvFrameRef(i.f, p.Frame); ret < 0 {
+		if ret := defaultBindings.frameRef(i.f, p.Frame); ret < 0 {
 			emitAvError(r, r.eh, ret, "avutil.AvFrameRef failed")
 			return
 		}
@@ -190,6 +270,42 @@ func (r *RateEnforcer) HandleFrame(p *FrameHandlerPayload) {
 	})
 }
 
+func (r *RateEnforcer) handleFrameWallClock(p *FrameHandlerPayload) {
+	// Frame doesn't come from the desired node
+	r.m.Lock()
+	n := r.n
+	r.m.Unlock()
+	if n != nil && n != p.Node {
+		return
+	}
+
+	// Wait for the frame to be due
+	if p.Frame.Pts() != avutil.AV_NOPTS_VALUE {
+		if d := r.delay(time.Duration(avutil.AvRescaleQ(p.Frame.Pts(), p.Descriptor.TimeBase(), nanosecondRational)), r.clock.Now()); d > 0 {
+			r.statPacingRatio.Begin()
+			astikit.Sleep(r.Context(), d)
+			r.statPacingRatio.End()
+		}
+	}
+
+	// Restamp frame
+	if r.restamper != nil {
+		r.restamper.Restamp(p.Frame)
+	}
+
+	// Dispatch frame
+	r.d.dispatch(p.Frame, p.Descriptor, p.Metadata)
+}
+
+// delay returns the duration to wait before the frame with the provided pts is due, now being the clock position
+func (r *RateEnforcer) delay(pts, now time.Duration) (d time.Duration) {
+	var resynced bool
+	if d, resynced = r.pc.delay(pts, now, r.o.Speed, r.o.ResyncThreshold); resynced {
+		r.statResyncs.Add(1)
+	}
+	return
+}
+
 func (r *RateEnforcer) newRateEnforcerSlot(p *FrameHandlerPayload) *rateEnforcerSlot {
 	return &rateEnforcerSlot{
 		n:      r.n,
@@ -202,13 +318,14 @@ func (r *RateEnforcer) newRateEnforcerItem(p *FrameHandlerPayload) *rateEnforcer
 	return &rateEnforcerItem{
 		d: p.Descriptor,
 		f: r.p.get(),
+		m: p.Metadata,
 		n: p.Node,
 	}
 }
 
 func (r *RateEnforcer) startTick(ctx context.Context) {
 	go func() {
-		nextAt := time.Now()
+		nextAt := r.clock.Now()
 		for {
 			if stop := r.tickFunc(ctx, &nextAt); stop {
 				return
@@ -217,12 +334,12 @@ func (r *RateEnforcer) startTick(ctx context.Context) {
 	}()
 }
 
-func (r *RateEnforcer) tickFunc(ctx context.Context, nextAt *time.Time) (stop bool) {
+func (r *RateEnforcer) tickFunc(ctx context.Context, nextAt *time.Duration) (stop bool) {
 	// Compute next at
-	*nextAt = nextAt.Add(r.period)
+	*nextAt += r.period
 
 	// Sleep until next at
-	if delta := time.Until(*nextAt); delta > 0 {
+	if delta := *nextAt - r.clock.Now(); delta > 0 {
 		astikit.Sleep(ctx, delta)
 	}
 
@@ -261,7 +378,7 @@ func (r *RateEnforcer) tickFunc(ctx context.Context, nextAt *time.Time) (stop bo
 		}
 
 		// Dispatch frame
-		r.d.dispatch(i.f, i.d)
+		r.d.dispatch(i.f, i.d, i.m)
 	}
 
 	// Remove first slot
@@ -354,11 +471,11 @@ func (r *RateEnforcer) current() (i *rateEnforcerItem, previous bool) {
 				f: r.p.get(),
 			}
 		} else {
-			avutil.AvFrameUnref(r.previousItem.f)
+			defaultBindings.frameUnref(r.previousItem.f)
 		}
 
 		// Copy frame
-		if ret := avutil.AvFrameRef(r.previousItem.f, i.f); ret < 0 {
+		if ret := defaultBindings.frameRef(r.previousItem.f, i.f); ret < 0 {
 			emitAvError(r, r.eh, ret, "avutil.AvFrameRef failed")
 			r.p.put(r.previousItem.f)
 			r.previousItem = nil
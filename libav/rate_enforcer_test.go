@@ -0,0 +1,23 @@
+package astilibav
+
+import (
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astikit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateEnforcerDelay(t *testing.T) {
+	n := 10 * time.Minute
+	r := &RateEnforcer{
+		o:           RateEnforcerOptions{ResyncThreshold: time.Second, Speed: 2},
+		statResyncs: astikit.NewCounterAvgStat(),
+	}
+	assert.Equal(t, time.Duration(0), r.delay(10*time.Second, n))
+	assert.Equal(t, 50*time.Millisecond, r.delay(10100*time.Millisecond, n))
+	assert.Equal(t, 50*time.Millisecond, r.delay(10200*time.Millisecond, n+50*time.Millisecond))
+	assert.Equal(t, -100*time.Millisecond, r.delay(10400*time.Millisecond, n+300*time.Millisecond))
+	assert.Equal(t, time.Duration(0), r.delay(20*time.Second, n+500*time.Millisecond))
+	assert.Equal(t, 20*time.Millisecond, r.delay(20040*time.Millisecond, n+500*time.Millisecond))
+}
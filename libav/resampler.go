@@ -0,0 +1,453 @@
+package astilibav
+
+//#cgo pkg-config: libavcodec libavfilter libavformat libavutil libswresample
+//#include <errno.h>
+//#include <libavutil/audio_fifo.h>
+//#include <libavutil/mem.h>
+//#include <libavutil/samplefmt.h>
+//#include <libswresample/swresample.h>
+//#include "compat.h"
+//static uint64_t astilibav_resampler_frame_channel_layout(const AVFrame *f) {
+//#ifdef ASTILIBAV_CH_LAYOUT
+//	if (f->ch_layout.order == AV_CHANNEL_ORDER_NATIVE) return f->ch_layout.u.mask;
+//	AVChannelLayout l = {0};
+//	av_channel_layout_default(&l, f->ch_layout.nb_channels);
+//	return l.order == AV_CHANNEL_ORDER_NATIVE ? l.u.mask : 0;
+//#else
+//	return f->channel_layout ? f->channel_layout : (uint64_t)av_get_default_channel_layout(f->channels);
+//#endif
+//}
+//static int astilibav_resampler_init(SwrContext **s, uint64_t out_layout, int out_fmt, int out_rate, uint64_t in_layout, int in_fmt, int in_rate) {
+//#ifdef ASTILIBAV_CH_LAYOUT
+//	AVChannelLayout out = {0}, in = {0};
+//	av_channel_layout_from_mask(&out, out_layout);
+//	av_channel_layout_from_mask(&in, in_layout);
+//	int ret = swr_alloc_set_opts2(s, &out, out_fmt, out_rate, &in, in_fmt, in_rate, 0, NULL);
+//	av_channel_layout_uninit(&out);
+//	av_channel_layout_uninit(&in);
+//	if (ret < 0) return ret;
+//#else
+//	if (!(*s = swr_alloc_set_opts(*s, out_layout, out_fmt, out_rate, in_layout, in_fmt, in_rate, 0, NULL))) return AVERROR(ENOMEM);
+//#endif
+//	return swr_init(*s);
+//}
+//static int astilibav_resampler_convert(SwrContext *s, AVAudioFifo *fifo, const AVFrame *in, int channels, int fmt) {
+//	int in_samples = in ? in->nb_samples : 0;
+//	int n = swr_get_out_samples(s, in_samples);
+//	if (n <= 0) return n;
+//	uint8_t **buf = NULL;
+//	int ret = av_samples_alloc_array_and_samples(&buf, NULL, channels, n, fmt, 0);
+//	if (ret < 0) return ret;
+//	ret = swr_convert(s, buf, n, in ? (const uint8_t **)in->extended_data : NULL, in_samples);
+//	if (ret > 0) {
+//		int w = av_audio_fifo_write(fifo, (void **)buf, ret);
+//		if (w < 0) ret = w;
+//	}
+//	av_freep(&buf[0]);
+//	av_freep(&buf);
+//	return ret;
+//}
+//static int astilibav_resampler_read(AVAudioFifo *fifo, AVFrame *f, uint64_t layout, int fmt, int rate, int nb_samples) {
+//	f->format = fmt;
+//	f->nb_samples = nb_samples;
+//	f->sample_rate = rate;
+//#ifdef ASTILIBAV_CH_LAYOUT
+//	int ret = av_channel_layout_from_mask(&f->ch_layout, layout);
+//	if (ret < 0) return ret;
+//#else
+//	f->channel_layout = layout;
+//	f->channels = av_get_channel_layout_nb_channels(layout);
+//	int ret;
+//#endif
+//	if ((ret = av_frame_get_buffer(f, 0)) < 0) return ret;
+//	if ((ret = av_audio_fifo_read(fifo, (void **)f->extended_data, nb_samples)) < 0) return ret;
+//	return 0;
+//}
+import "C"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/bits"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avutil"
+)
+
+var countResampler uint64
+
+// Input pts gaps larger than this are considered jumps
+const resamplerPtsJumpThreshold = 100 * time.Millisecond
+
+// Resampler represents an object capable of converting the sample rate, the sample format and the channel layout of
+// audio frames, such as between a decoder and an encoder
+// Since resampled frames are buffered, it can dispatch frames with a fixed number of samples as required by encoders
+// such as AAC ones
+type Resampler struct {
+	*astiencoder.BaseNode
+	c                *astikit.Chan
+	d                *frameDispatcher
+	eh               *astiencoder.EventHandler
+	fifo             *C.AVAudioFifo
+	in               resamplerFormat
+	m                *UnitMetadata
+	nextInPts        *int64
+	nextPts          *int64
+	o                ResamplerOptions
+	out              resamplerFormat
+	previous         Descriptor
+	statIncomingRate *astikit.CounterAvgStat
+	statWorkRatio    *astikit.DurationPercentageStat
+	swr              *C.SwrContext
+}
+
+// ResamplerOptions represents resampler options
+type ResamplerOptions struct {
+	// Output channel layout. If 0, the input channel layout is kept
+	ChannelLayout uint64
+	// Number of samples of dispatched frames, such as the one returned by Encoder.FrameSize(). The last frame may be
+	// smaller. If 0, samples are dispatched as soon as they're resampled
+	FrameSize int
+	Node      astiencoder.NodeOptions
+	// Output sample format. If nil, the input sample format is kept
+	SampleFmt *avcodec.AvSampleFormat
+	// Output sample rate. If 0, the input sample rate is kept
+	SampleRate int
+}
+
+type resamplerFormat struct {
+	channelLayout uint64
+	sampleFmt     avcodec.AvSampleFormat
+	sampleRate    int
+}
+
+// NewResampler creates a new resampler
+func NewResampler(o ResamplerOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (r *Resampler, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countResampler, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("resampler_%d", count), fmt.Sprintf("Resampler #%d", count), "Resamples")
+
+	// Check frame size
+	if o.FrameSize < 0 {
+		err = errors.New("astilibav: frame size must be positive")
+		return
+	}
+
+	// Create resampler
+	r = &Resampler{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh:               eh,
+		o:                o,
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statWorkRatio:    astikit.NewDurationPercentageStat(),
+	}
+	r.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(r), eh)
+	r.d = newFrameDispatcher(r, eh, c)
+	r.addStats()
+
+	// Make sure the resampling ctx and the fifo are freed
+	c.Add(func() error {
+		if r.swr != nil {
+			C.swr_free(&r.swr)
+		}
+		if r.fifo != nil {
+			C.av_audio_fifo_free(r.fifo)
+		}
+		return nil
+	})
+	return
+}
+
+func (r *Resampler) addStats() {
+	// Add incoming rate
+	r.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of frames coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "fps",
+	}, r.statIncomingRate)
+
+	// Add work ratio
+	r.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, r.statWorkRatio)
+
+	// Add dispatcher stats
+	r.d.addStats(r.Stater())
+
+	// Add chan stats
+	r.c.AddStats(r.Stater())
+}
+
+// Connect implements the FrameHandlerConnector interface
+func (r *Resampler) Connect(h FrameHandler) {
+	// Add handler
+	r.d.addHandler(h)
+
+	// Connect nodes
+	astiencoder.ConnectNodes(r, h)
+}
+
+// Disconnect implements the FrameHandlerConnector interface
+func (r *Resampler) Disconnect(h FrameHandler) {
+	// Delete handler
+	r.d.delHandler(h)
+
+	// Disconnect nodes
+	astiencoder.DisconnectNodes(r, h)
+}
+
+// Start starts the resampler
+func (r *Resampler) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	r.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to wait for all dispatcher subprocesses to be done so that they are properly closed
+		defer r.d.wait()
+
+		// Make sure to dispatch the remaining samples
+		defer r.flush()
+
+		// Make sure to stop the chan properly
+		defer r.c.Stop()
+
+		// Start chan
+		r.c.Start(r.Context())
+	})
+}
+
+// HandleEOS implements the EOSHandler interface
+func (r *Resampler) HandleEOS(p *EOSHandlerPayload) {
+	r.c.Add(func() {
+		// Dispatch the remaining samples
+		r.flush()
+
+		// Forward end of stream
+		r.d.dispatchEOS()
+	})
+}
+
+// HandleFrame implements the FrameHandler interface
+func (r *Resampler) HandleFrame(p *FrameHandlerPayload) {
+	r.c.Add(func() {
+		// Handle pause
+		defer r.HandlePause()
+
+		// Increment incoming rate
+		r.statIncomingRate.Add(1)
+
+		// Keep track of descriptor and metadata
+		r.m = p.Metadata
+		r.previous = p.Descriptor
+
+		// Get pts in the input sample rate
+		pts := int64(avutil.AV_NOPTS_VALUE)
+		if p.Frame.Pts() != avutil.AV_NOPTS_VALUE && p.Frame.SampleRate() > 0 {
+			pts = avutil.AvRescaleQ(p.Frame.Pts(), p.Descriptor.TimeBase(), avutil.NewRational(1, p.Frame.SampleRate()))
+		}
+
+		// Input timestamps have jumped, for instance after a discontinuity: samples resampled so far are dispatched
+		// and output timestamps are computed again from this frame
+		if pts != avutil.AV_NOPTS_VALUE && r.nextInPts != nil && resamplerPtsJumped(*r.nextInPts, pts, p.Frame.SampleRate()) {
+			r.flush()
+		}
+
+		// Make sure the resampling ctx matches the input format
+		cf := (*C.AVFrame)(unsafe.Pointer(p.Frame))
+		if err := r.init(cf); err != nil {
+			r.eh.Emit(astiencoder.EventError(r, fmt.Errorf("astilibav: initializing resampling ctx failed: %w", err)))
+			return
+		}
+
+		// Output timestamps are computed from the first frame and the number of dispatched samples since the fifo
+		// doesn't keep input frame boundaries
+		if pts != avutil.AV_NOPTS_VALUE {
+			if r.nextPts == nil {
+				v := avutil.AvRescaleQ(pts, avutil.NewRational(1, p.Frame.SampleRate()), avutil.NewRational(1, r.out.sampleRate))
+				r.nextPts = &v
+			}
+			v := pts + int64(p.Frame.NbSamples())
+			r.nextInPts = &v
+		}
+
+		// Resample
+		r.statWorkRatio.Begin()
+		if ret := C.astilibav_resampler_convert(r.swr, r.fifo, cf, C.int(r.out.channels()), C.int(r.out.sampleFmt)); ret < 0 {
+			r.statWorkRatio.End()
+			emitAvError(r, r.eh, int(ret), "swr_convert failed")
+			return
+		}
+		r.statWorkRatio.End()
+
+		// Dispatch frames
+		r.dispatch(false)
+	})
+}
+
+func (r *Resampler) init(f *C.AVFrame) (err error) {
+	// Get input format
+	in := resamplerFormat{
+		channelLayout: uint64(C.astilibav_resampler_frame_channel_layout(f)),
+		sampleFmt:     avcodec.AvSampleFormat(f.format),
+		sampleRate:    int(f.sample_rate),
+	}
+
+	// Nothing to do
+	if r.swr != nil && in == r.in {
+		return
+	}
+
+	// Input format has changed
+	if r.swr != nil {
+		// Make sure samples buffered in the resampling ctx are not lost
+		r.drain()
+	}
+
+	// Get output format
+	// It can't change once the fifo has been created since it's the one expected downstream
+	if r.fifo == nil {
+		r.out = resamplerOutputFormat(r.o, in)
+	}
+
+	// Create resampling ctx
+	if ret := C.astilibav_resampler_init(&r.swr, C.uint64_t(r.out.channelLayout), C.int(r.out.sampleFmt), C.int(r.out.sampleRate), C.uint64_t(in.channelLayout), C.int(in.sampleFmt), C.int(in.sampleRate)); ret < 0 {
+		C.swr_free(&r.swr)
+		err = fmt.Errorf("astilibav: astilibav_resampler_init failed: %w", NewAvError(int(ret)))
+		return
+	}
+	r.in = in
+
+	// Create fifo
+	if r.fifo == nil {
+		if r.fifo = C.av_audio_fifo_alloc(C.enum_AVSampleFormat(r.out.sampleFmt), C.int(r.out.channels()), 1); r.fifo == nil {
+			C.swr_free(&r.swr)
+			err = errors.New("astilibav: av_audio_fifo_alloc failed")
+			return
+		}
+	}
+	return
+}
+
+func (r *Resampler) drain() {
+	// Nothing to drain
+	if r.swr == nil {
+		return
+	}
+
+	// Drain resampling ctx
+	r.statWorkRatio.Begin()
+	if ret := C.astilibav_resampler_convert(r.swr, r.fifo, nil, C.int(r.out.channels()), C.int(r.out.sampleFmt)); ret < 0 {
+		emitAvError(r, r.eh, int(ret), "swr_convert failed")
+	}
+	r.statWorkRatio.End()
+
+	// Free resampling ctx
+	C.swr_free(&r.swr)
+}
+
+func (r *Resampler) flush() {
+	// Drain resampling ctx
+	r.drain()
+
+	// Dispatch remaining samples
+	r.dispatch(true)
+
+	// Timestamps are computed again from the next frame
+	r.nextInPts = nil
+	r.nextPts = nil
+}
+
+func (r *Resampler) dispatch(all bool) {
+	// Nothing to dispatch
+	if r.fifo == nil {
+		return
+	}
+
+	// Loop
+	for {
+		// Get number of samples
+		n := int(C.av_audio_fifo_size(r.fifo))
+		if n == 0 || (!all && r.o.FrameSize > 0 && n < r.o.FrameSize) {
+			return
+		}
+		if r.o.FrameSize > 0 && n > r.o.FrameSize {
+			n = r.o.FrameSize
+		}
+
+		// Get frame
+		f := r.d.p.get()
+
+		// Read samples
+		r.statWorkRatio.Begin()
+		if ret := C.astilibav_resampler_read(r.fifo, (*C.AVFrame)(unsafe.Pointer(f)), C.uint64_t(r.out.channelLayout), C.int(r.out.sampleFmt), C.int(r.out.sampleRate), C.int(n)); ret < 0 {
+			r.statWorkRatio.End()
+			r.d.p.put(f)
+			emitAvError(r, r.eh, int(ret), "astilibav_resampler_read failed")
+			return
+		}
+
+		// Set pts
+		if r.nextPts != nil {
+			f.SetPts(*r.nextPts)
+			*r.nextPts += int64(n)
+		} else {
+			f.SetPts(avutil.AV_NOPTS_VALUE)
+		}
+		r.statWorkRatio.End()
+
+		// Dispatch frame
+		r.d.dispatch(f, r.descriptor(), r.m)
+		r.d.p.put(f)
+	}
+}
+
+func (r *Resampler) descriptor() StreamDescriptor {
+	psd, _ := DescriptorStream(r.previous)
+	return newStreamDescriptor(Context{
+		ChannelLayout: r.out.channelLayout,
+		Channels:      r.out.channels(),
+		CodecType:     avutil.AVMEDIA_TYPE_AUDIO,
+		SampleFmt:     r.out.sampleFmt,
+		SampleRate:    r.out.sampleRate,
+		TimeBase:      avutil.NewRational(1, r.out.sampleRate),
+	}, psd.Index(), psd.SideData())
+}
+
+func resamplerOutputFormat(o ResamplerOptions, in resamplerFormat) resamplerFormat {
+	f := resamplerFormat{
+		channelLayout: o.ChannelLayout,
+		sampleFmt:     in.sampleFmt,
+		sampleRate:    o.SampleRate,
+	}
+	if f.channelLayout == 0 {
+		f.channelLayout = in.channelLayout
+	}
+	if o.SampleFmt != nil {
+		f.sampleFmt = *o.SampleFmt
+	}
+	if f.sampleRate <= 0 {
+		f.sampleRate = in.sampleRate
+	}
+	return f
+}
+
+// resamplerPtsJumped indicates whether the pts, in the input sample rate, is too far from the expected one for the
+// difference to be a rounding error
+func resamplerPtsJumped(expected, pts int64, sampleRate int) bool {
+	d := pts - expected
+	if d < 0 {
+		d = -d
+	}
+	return d > int64(sampleRate)*int64(resamplerPtsJumpThreshold)/int64(time.Second)
+}
+
+func (f resamplerFormat) channels() int {
+	return bits.OnesCount64(f.channelLayout)
+}
@@ -0,0 +1,40 @@
+package astilibav
+
+import (
+	"testing"
+
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResamplerOutputFormat(t *testing.T) {
+	in := resamplerFormat{
+		channelLayout: 0x3f,
+		sampleFmt:     avcodec.AvSampleFormat(avutil.AV_SAMPLE_FMT_FLTP),
+		sampleRate:    48000,
+	}
+	f := resamplerOutputFormat(ResamplerOptions{}, in)
+	assert.Equal(t, in, f)
+	assert.Equal(t, 6, f.channels())
+	sampleFmt := avcodec.AvSampleFormat(avutil.AV_SAMPLE_FMT_S16)
+	f = resamplerOutputFormat(ResamplerOptions{
+		ChannelLayout: 0x3,
+		SampleFmt:     &sampleFmt,
+		SampleRate:    44100,
+	}, in)
+	assert.Equal(t, resamplerFormat{
+		channelLayout: 0x3,
+		sampleFmt:     sampleFmt,
+		sampleRate:    44100,
+	}, f)
+	assert.Equal(t, 2, f.channels())
+}
+
+func TestResamplerPtsJumped(t *testing.T) {
+	assert.False(t, resamplerPtsJumped(48000, 48000, 48000))
+	assert.False(t, resamplerPtsJumped(48000, 48001, 48000))
+	assert.False(t, resamplerPtsJumped(48000, 43200, 48000))
+	assert.True(t, resamplerPtsJumped(48000, 43199, 48000))
+	assert.True(t, resamplerPtsJumped(48000, 96000, 48000))
+}
@@ -0,0 +1,212 @@
+package astilibav
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avutil"
+)
+
+// Default restamper discontinuity values
+const (
+	defaultRestamperDiscontinuityThreshold = 10 * time.Second
+)
+
+// RestamperDiscontinuityOptions represents discontinuity tolerant restamper options
+type RestamperDiscontinuityOptions struct {
+	// If set, an EventNameRestamperDiscontinuity event is emitted with a RestamperDiscontinuity payload every time a
+	// discontinuity is detected
+	EventHandler *astiencoder.EventHandler
+	// Target of the emitted events
+	Target interface{}
+	// Forward jumps larger than the threshold are considered discontinuities. Backward jumps always are, whereas equal
+	// timestamps are not.
+	// Defaults to 10s
+	Threshold time.Duration
+	// Time base of the timestamps
+	TimeBase avutil.Rational
+}
+
+// RestamperDiscontinuity represents a discontinuity detected by a restamper
+type RestamperDiscontinuity struct {
+	// Difference between the timestamp and the previous one, before rebasing. Negative values mean timestamps went
+	// backward
+	Gap time.Duration
+	// Only set for pkts
+	StreamIndex int
+}
+
+// restamperDiscontinuityTracker keeps track of the last timestamp of each stream, whereas the offset is shared by all
+// streams so that they keep their relative offsets once rebased
+type restamperDiscontinuityTracker struct {
+	lastDeltas map[int]int64
+	lastValues map[int]int64
+	offset     int64
+	threshold  int64
+}
+
+func newRestamperDiscontinuityTracker(threshold int64) *restamperDiscontinuityTracker {
+	return &restamperDiscontinuityTracker{
+		lastDeltas: make(map[int]int64),
+		lastValues: make(map[int]int64),
+		threshold:  threshold,
+	}
+}
+
+// rebase returns the offset that must be added to the timestamp and, when a discontinuity is detected, the gap with
+// the previous timestamp of the stream. Once rebased, the timestamp follows the previous one by duration or, if
+// duration is not known, by the previous delta
+func (t *restamperDiscontinuityTracker) rebase(streamIdx int, v, duration int64) (offset int64, gap *int64) {
+	// Get rebased value
+	nv := v + t.offset
+
+	// First value
+	lastValue, ok := t.lastValues[streamIdx]
+	if !ok {
+		t.lastValues[streamIdx] = nv
+		return t.offset, nil
+	}
+
+	// No discontinuity
+	delta := nv - lastValue
+	if delta >= 0 && delta <= t.threshold {
+		if delta > 0 {
+			t.lastDeltas[streamIdx] = delta
+		}
+		t.lastValues[streamIdx] = nv
+		return t.offset, nil
+	}
+
+	// Get increment
+	inc := duration
+	if inc <= 0 {
+		inc = t.lastDeltas[streamIdx]
+	}
+	if inc <= 0 {
+		inc = 1
+	}
+
+	// Rebase
+	t.offset += lastValue + inc - nv
+	t.lastValues[streamIdx] = v + t.offset
+	return t.offset, &delta
+}
+
+type pktRestamperDiscontinuity struct {
+	m *sync.Mutex
+	o RestamperDiscontinuityOptions
+	t *restamperDiscontinuityTracker
+}
+
+// NewPktRestamperDiscontinuity creates a new pkt restamper that detects discontinuities, such as HLS discontinuities,
+// looped files or encoder restarts, and rebases timestamps so that they remain monotonic
+// Discontinuities are detected per stream but the offset is shared by all streams, which must therefore share the
+// same time base
+func NewPktRestamperDiscontinuity(o RestamperDiscontinuityOptions) (PktRestamper, error) {
+	t, err := newRestamperDiscontinuityTrackerFromOptions(&o)
+	if err != nil {
+		return nil, err
+	}
+	return &pktRestamperDiscontinuity{
+		m: &sync.Mutex{},
+		o: o,
+		t: t,
+	}, nil
+}
+
+func newRestamperDiscontinuityTrackerFromOptions(o *RestamperDiscontinuityOptions) (*restamperDiscontinuityTracker, error) {
+	// Check time base
+	if o.TimeBase.Num() <= 0 || o.TimeBase.Den() <= 0 {
+		return nil, fmt.Errorf("astilibav: invalid time base %d/%d", o.TimeBase.Num(), o.TimeBase.Den())
+	}
+
+	// Default threshold
+	if o.Threshold <= 0 {
+		o.Threshold = defaultRestamperDiscontinuityThreshold
+	}
+	return newRestamperDiscontinuityTracker(avutil.AvRescaleQ(int64(o.Threshold), nanosecondRational, o.TimeBase)), nil
+}
+
+// Restamp implements the Restamper interface
+func (r *pktRestamperDiscontinuity) Restamp(pkt *avcodec.Packet) {
+	// Get value
+	v := pkt.Dts()
+	if v == avutil.AV_NOPTS_VALUE {
+		v = pkt.Pts()
+	}
+	if v == avutil.AV_NOPTS_VALUE {
+		return
+	}
+
+	// Rebase
+	r.m.Lock()
+	offset, gap := r.t.rebase(pkt.StreamIndex(), v, pkt.Duration())
+	r.m.Unlock()
+
+	// Restamp
+	if pkt.Dts() != avutil.AV_NOPTS_VALUE {
+		pkt.SetDts(pkt.Dts() + offset)
+	}
+	if pkt.Pts() != avutil.AV_NOPTS_VALUE {
+		pkt.SetPts(pkt.Pts() + offset)
+	}
+
+	// Emit
+	if gap != nil {
+		emitRestamperDiscontinuity(r.o, *gap, pkt.StreamIndex())
+	}
+}
+
+type frameRestamperDiscontinuity struct {
+	o RestamperDiscontinuityOptions
+	t *restamperDiscontinuityTracker
+}
+
+// NewFrameRestamperDiscontinuity creates a new frame restamper that detects discontinuities, such as HLS
+// discontinuities, looped files or encoder restarts, and rebases timestamps so that they remain monotonic
+func NewFrameRestamperDiscontinuity(o RestamperDiscontinuityOptions) (FrameRestamper, error) {
+	t, err := newRestamperDiscontinuityTrackerFromOptions(&o)
+	if err != nil {
+		return nil, err
+	}
+	return &frameRestamperDiscontinuity{
+		o: o,
+		t: t,
+	}, nil
+}
+
+// Restamp implements the FrameRestamper interface
+func (r *frameRestamperDiscontinuity) Restamp(f *avutil.Frame) {
+	// No pts
+	if f.Pts() == avutil.AV_NOPTS_VALUE {
+		return
+	}
+
+	// Rebase
+	offset, gap := r.t.rebase(0, f.Pts(), frameDuration(f))
+
+	// Restamp
+	f.SetPts(f.Pts() + offset)
+
+	// Emit
+	if gap != nil {
+		emitRestamperDiscontinuity(r.o, *gap, 0)
+	}
+}
+
+func emitRestamperDiscontinuity(o RestamperDiscontinuityOptions, gap int64, streamIndex int) {
+	if o.EventHandler == nil {
+		return
+	}
+	o.EventHandler.Emit(astiencoder.Event{
+		Name: EventNameRestamperDiscontinuity,
+		Payload: RestamperDiscontinuity{
+			Gap:         time.Duration(avutil.AvRescaleQ(gap, o.TimeBase, nanosecondRational)),
+			StreamIndex: streamIndex,
+		},
+		Target: o.Target,
+	})
+}
@@ -0,0 +1,70 @@
+package astilibav
+
+import (
+	"testing"
+
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestamperDiscontinuityTracker(t *testing.T) {
+	tr := newRestamperDiscontinuityTracker(100)
+	for _, v := range []struct {
+		duration int64
+		gap      *int64
+		offset   int64
+		v        int64
+	}{
+		{v: 10},
+		{v: 20},
+		{v: 30},
+		// Backward jump
+		{gap: astikit.Int64Ptr(-30), offset: 40, v: 0},
+		{offset: 40, v: 10},
+		// Forward jump with duration
+		{duration: 5, gap: astikit.Int64Ptr(990), offset: -945, v: 1000},
+		{offset: -945, v: 1010},
+		// Same value
+		{offset: -945, v: 1010},
+		{offset: -945, v: 1020},
+	} {
+		offset, gap := tr.rebase(0, v.v, v.duration)
+		assert.Equal(t, v.offset, offset)
+		assert.Equal(t, v.gap, gap)
+	}
+}
+
+func TestRestamperDiscontinuityTrackerSharedOffset(t *testing.T) {
+	tr := newRestamperDiscontinuityTracker(100)
+	for _, v := range []struct {
+		gap       *int64
+		offset    int64
+		streamIdx int
+		v         int64
+	}{
+		{streamIdx: 0, v: 1000},
+		{streamIdx: 1, v: 1005},
+		{streamIdx: 0, v: 1010},
+		{streamIdx: 1, v: 1015},
+		// Both streams loop
+		{gap: astikit.Int64Ptr(-1010), offset: 1020, streamIdx: 0, v: 0},
+		{offset: 1020, streamIdx: 1, v: 5},
+		{offset: 1020, streamIdx: 0, v: 10},
+	} {
+		offset, gap := tr.rebase(v.streamIdx, v.v, 0)
+		assert.Equal(t, v.offset, offset)
+		assert.Equal(t, v.gap, gap)
+	}
+}
+
+func TestNewRestamperDiscontinuity(t *testing.T) {
+	for _, tb := range []avutil.Rational{avutil.NewRational(0, 1), avutil.NewRational(1, 0), avutil.NewRational(-1, 1000)} {
+		_, err := NewPktRestamperDiscontinuity(RestamperDiscontinuityOptions{TimeBase: tb})
+		assert.Error(t, err)
+		_, err = NewFrameRestamperDiscontinuity(RestamperDiscontinuityOptions{TimeBase: tb})
+		assert.Error(t, err)
+	}
+	_, err := NewPktRestamperDiscontinuity(RestamperDiscontinuityOptions{TimeBase: avutil.NewRational(1, 1000)})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,214 @@
+package astilibav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"sync/atomic"
+	"time"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+)
+
+var countReverser uint64
+
+// Reverser represents an object capable of buffering a bounded clip of video frames and dispatching them in reverse
+// order
+type Reverser struct {
+	*astiencoder.BaseNode
+	buf              []*avutil.Frame
+	c                *astikit.Chan
+	ms               []*UnitMetadata
+	d                *frameDispatcher
+	descriptor       Descriptor
+	eh               *astiencoder.EventHandler
+	maxDuration      time.Duration
+	maxFrames        int
+	p                *framePool
+	statIncomingRate *astikit.CounterAvgStat
+	statWorkRatio    *astikit.DurationPercentageStat
+}
+
+// ReverserOptions represents reverser options
+// At least one of MaxDuration or MaxFrames must be provided so that memory usage is bounded
+type ReverserOptions struct {
+	// Once the buffered clip reaches this duration, it is dispatched in reverse
+	MaxDuration time.Duration
+	// Once the buffered clip reaches this number of frames, it is dispatched in reverse
+	MaxFrames int
+	Node      astiencoder.NodeOptions
+}
+
+// NewReverser creates a new reverser
+func NewReverser(o ReverserOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (r *Reverser, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countReverser, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("reverser_%d", count), fmt.Sprintf("Reverser #%d", count), "Reverses")
+
+	// Buffer must be bounded
+	if o.MaxDuration <= 0 && o.MaxFrames <= 0 {
+		err = errors.New("astilibav: neither max duration nor max frames provided")
+		return
+	}
+
+	// Create reverser
+	r = &Reverser{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh:               eh,
+		maxDuration:      o.MaxDuration,
+		maxFrames:        o.MaxFrames,
+		p:                newFramePool(c),
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statWorkRatio:    astikit.NewDurationPercentageStat(),
+	}
+	r.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(r), eh)
+	r.d = newFrameDispatcher(r, eh, c)
+	r.addStats()
+	return
+}
+
+func (r *Reverser) addStats() {
+	// Add incoming rate
+	r.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of frames coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "fps",
+	}, r.statIncomingRate)
+
+	// Add work ratio
+	r.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, r.statWorkRatio)
+
+	// Add dispatcher stats
+	r.d.addStats(r.Stater())
+
+	// Add chan stats
+	r.c.AddStats(r.Stater())
+}
+
+// Connect implements the FrameHandlerConnector interface
+func (r *Reverser) Connect(h FrameHandler) {
+	// Add handler
+	r.d.addHandler(h)
+
+	// Connect nodes
+	astiencoder.ConnectNodes(r, h)
+}
+
+// Disconnect implements the FrameHandlerConnector interface
+func (r *Reverser) Disconnect(h FrameHandler) {
+	// Delete handler
+	r.d.delHandler(h)
+
+	// Disconnect nodes
+	astiencoder.DisconnectNodes(r, h)
+}
+
+// Snapshot implements the astiencoder.Snapshotter interface
+func (r *Reverser) Snapshot(ctx context.Context) (image.Image, error) {
+	return r.d.snapshot(ctx)
+}
+
+// Start starts the reverser
+func (r *Reverser) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	r.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to wait for all dispatcher subprocesses to be done so that they are properly closed
+		defer r.d.wait()
+
+		// Make sure to dispatch the remaining clip
+		defer r.flush()
+
+		// Make sure to stop the chan properly
+		defer r.c.Stop()
+
+		// Start chan
+		r.c.Start(r.Context())
+	})
+}
+
+// HandleFrame implements the FrameHandler interface
+func (r *Reverser) HandleFrame(p *FrameHandlerPayload) {
+	r.c.Add(func() {
+		// Handle pause
+		defer r.HandlePause()
+
+		// Increment incoming rate
+		r.statIncomingRate.Add(1)
+
+		// Copy frame
+		f := r.p.get()
+		if ret := defaultBindings.frameRef(f, p.Frame); ret < 0 {
+			emitAvError(r, r.eh, ret, "avutil.AvFrameRef failed")
+			r.p.put(f)
+			return
+		}
+
+		// Append frame
+		r.buf = append(r.buf, f)
+		r.descriptor = p.Descriptor
+		r.ms = append(r.ms, p.Metadata)
+
+		// Clip is complete
+		if r.clipIsComplete() {
+			r.flush()
+		}
+	})
+}
+
+func (r *Reverser) clipIsComplete() bool {
+	// Check number of frames
+	if r.maxFrames > 0 && len(r.buf) >= r.maxFrames {
+		return true
+	}
+
+	// Check duration
+	if r.maxDuration > 0 && len(r.buf) > 1 {
+		d := avutil.AvRescaleQ(r.buf[len(r.buf)-1].Pts()-r.buf[0].Pts(), r.descriptor.TimeBase(), nanosecondRational)
+		if time.Duration(d) >= r.maxDuration {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Reverser) flush() {
+	// Nothing to flush
+	if len(r.buf) == 0 {
+		return
+	}
+
+	// Make sure frames are put back in the pool
+	defer func() {
+		for _, f := range r.buf {
+			r.p.put(f)
+		}
+		r.buf = r.buf[:0]
+		r.ms = r.ms[:0]
+	}()
+
+	// Store timestamps in their original order
+	r.statWorkRatio.Begin()
+	ptss := make([]int64, len(r.buf))
+	for idx, f := range r.buf {
+		ptss[idx] = f.Pts()
+	}
+	r.statWorkRatio.End()
+
+	// Loop through frames in reverse order
+	for idx := len(r.buf) - 1; idx >= 0; idx-- {
+		// Frames are dispatched in reverse order but timestamps must keep increasing
+		r.buf[idx].SetPts(ptss[len(r.buf)-1-idx])
+
+		// Dispatch frame
+		r.d.dispatch(r.buf[idx], r.descriptor, r.ms[idx])
+	}
+}
@@ -0,0 +1,402 @@
+package astilibav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avformat"
+	"github.com/asticode/goav/avutil"
+)
+
+var countRotatingMuxer uint64
+
+// RotatingMuxer represents an object capable of muxing packets into successive files, closing the current file and
+// opening a new one every time it has reached a max duration or a max size, which is what DVR-style recorders need
+// Files are cut on keyframes of the reference stream, video streams being preferred, therefore they may be slightly
+// longer or bigger than the limits
+type RotatingMuxer struct {
+	*astiencoder.BaseNode
+	c                *astikit.Chan
+	count            int
+	ctxFormat        *avformat.Context
+	eh               *astiencoder.EventHandler
+	f                *rotatingMuxerFile
+	o                RotatingMuxerOptions
+	refStreamIdx     *int
+	statIncomingRate *astikit.CounterAvgStat
+	statWorkRatio    *astikit.DurationPercentageStat
+}
+
+type rotatingMuxerFile struct {
+	// Timestamp of the last pkt of the reference stream
+	end      time.Duration
+	openedAt time.Time
+	start    time.Duration
+	w        *segmentWriter
+}
+
+// RotatingMuxerOptions represents rotating muxer options
+// At least one of MaxDuration or MaxSize must be provided
+type RotatingMuxerOptions struct {
+	Format     *avformat.OutputFormat
+	FormatName string
+	// A new file is opened once the current one lasts for this duration
+	MaxDuration time.Duration
+	// A new file is opened once this number of bytes has been written to the current one
+	MaxSize int64
+	Node    astiencoder.NodeOptions
+	// Pattern used to generate each file URL, such as "out-%Y%m%d-%H%M%S.mp4". %Y, %m, %d, %H, %M and %S are replaced
+	// with the local time at which the file is opened, %n with the number of the file starting at 1, and %% with %
+	URLPattern string
+}
+
+// RotatingMuxerFile represents a file that has been finalized by the rotating muxer
+type RotatingMuxerFile struct {
+	// Difference between the timestamps of the first and last pkts of the reference stream
+	Duration time.Duration
+	OpenedAt time.Time
+	// Number of bytes written, or -1 if unknown
+	Size int64
+	URL  string
+}
+
+// NewRotatingMuxer creates a new rotating muxer
+func NewRotatingMuxer(o RotatingMuxerOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (m *RotatingMuxer, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countRotatingMuxer, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("rotating_muxer_%d", count), fmt.Sprintf("Rotating Muxer #%d", count), fmt.Sprintf("Muxes to %s", o.URLPattern))
+
+	// Check options
+	if len(o.URLPattern) == 0 {
+		err = errors.New("astilibav: no url pattern provided")
+		return
+	}
+	if o.MaxDuration <= 0 && o.MaxSize <= 0 {
+		err = errors.New("astilibav: neither max duration nor max size provided")
+		return
+	}
+
+	// Create rotating muxer
+	m = &RotatingMuxer{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh:               eh,
+		o:                o,
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statWorkRatio:    astikit.NewDurationPercentageStat(),
+	}
+	m.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(m), eh)
+	m.addStats()
+
+	// Alloc format context
+	// This context is never opened and is only used as a template to store streams
+	// We need to create an intermediate variable to avoid "cgo argument has Go pointer to Go pointer" errors
+	var ctxFormat *avformat.Context
+	if ret := avformat.AvformatAllocOutputContext2(&ctxFormat, o.Format, o.FormatName, o.URLPattern); ret < 0 {
+		err = fmt.Errorf("astilibav: avformat.AvformatAllocOutputContext2 on %+v failed: %w", o, NewAvError(ret))
+		return
+	}
+	m.ctxFormat = ctxFormat
+
+	// Make sure the format ctx is properly closed
+	c.Add(func() error {
+		m.ctxFormat.AvformatFreeContext()
+		return nil
+	})
+
+	// Make sure the current file is properly closed
+	c.Add(m.closeFile)
+	return
+}
+
+func (m *RotatingMuxer) addStats() {
+	// Add incoming rate
+	m.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of packets coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "pps",
+	}, m.statIncomingRate)
+
+	// Add work ratio
+	m.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, m.statWorkRatio)
+
+	// Add chan stats
+	m.c.AddStats(m.Stater())
+}
+
+// CtxFormat returns the format ctx streams and global tags must be added to
+// It is only used as a template for every file and is never written to
+func (m *RotatingMuxer) CtxFormat() *avformat.Context {
+	return m.ctxFormat
+}
+
+// Start starts the rotating muxer
+func (m *RotatingMuxer) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	m.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to close the current file once everything is done
+		defer func() {
+			if err := m.closeFile(); err != nil {
+				m.eh.Emit(astiencoder.EventError(m, fmt.Errorf("astilibav: closing file failed: %w", err)))
+			}
+		}()
+
+		// Make sure to stop the chan properly
+		defer m.c.Stop()
+
+		// Start chan
+		m.c.Start(m.Context())
+	})
+}
+
+// RotatingMuxerPktHandler is an object that can handle a pkt for the rotating muxer
+type RotatingMuxerPktHandler struct {
+	*RotatingMuxer
+	o *avformat.Stream
+}
+
+// NewPktHandler creates a new pkt handler for a stream of the rotating muxer format ctx
+func (m *RotatingMuxer) NewPktHandler(o *avformat.Stream) *RotatingMuxerPktHandler {
+	return &RotatingMuxerPktHandler{
+		RotatingMuxer: m,
+		o:             o,
+	}
+}
+
+// HandlePkt implements the PktHandler interface
+func (h *RotatingMuxerPktHandler) HandlePkt(p *PktHandlerPayload) {
+	h.c.Add(func() {
+		// Handle pause
+		defer h.HandlePause()
+
+		// Increment incoming rate
+		h.statIncomingRate.Add(1)
+
+		// Handle file
+		h.statWorkRatio.Begin()
+		if err := h.handleFile(p, h.o); err != nil {
+			h.statWorkRatio.End()
+			h.eh.Emit(astiencoder.EventError(h, fmt.Errorf("astilibav: handling file failed: %w", err)))
+			return
+		}
+		h.statWorkRatio.End()
+
+		// No file
+		if h.f == nil {
+			return
+		}
+
+		// Rescale timestamps
+		so := h.f.w.ctxFormat.Streams()[h.o.Index()]
+		p.Pkt.AvPacketRescaleTs(p.Descriptor.TimeBase(), so.TimeBase())
+
+		// Set stream index
+		p.Pkt.SetStreamIndex(so.Index())
+
+		// Restamp
+		h.f.w.restamp(p.Pkt)
+
+		// Write frame
+		h.statWorkRatio.Begin()
+		if ret := h.f.w.ctxFormat.AvInterleavedWriteFrame((*avformat.Packet)(unsafe.Pointer(p.Pkt))); ret < 0 {
+			h.statWorkRatio.End()
+			emitAvError(h, h.eh, ret, "h.f.w.ctxFormat.AvInterleavedWriteFrame failed")
+			return
+		}
+		h.statWorkRatio.End()
+	})
+}
+
+func (m *RotatingMuxer) referenceStreamIndex() int {
+	// Index has already been computed
+	if m.refStreamIdx != nil {
+		return *m.refStreamIdx
+	}
+
+	// Compute index
+	idx := referenceStreamIndex(m.ctxFormat)
+	m.refStreamIdx = astikit.IntPtr(idx)
+	return idx
+}
+
+func (m *RotatingMuxer) handleFile(p *PktHandlerPayload, o *avformat.Stream) (err error) {
+	// Files can only be cut on pkts of the reference stream
+	if o.Index() != m.referenceStreamIndex() {
+		return
+	}
+
+	// Update end
+	pts := time.Duration(avutil.AvRescaleQ(p.Pkt.Pts(), p.Descriptor.TimeBase(), nanosecondRational))
+	if m.f != nil {
+		m.f.end = pts
+	}
+
+	// Files can only be cut on keyframes
+	if p.Pkt.Flags()&avcodec.AV_PKT_FLAG_KEY == 0 {
+		return
+	}
+
+	// A file is already opened and no limit has been reached
+	if m.f != nil && !m.shouldRotate(pts) {
+		return
+	}
+
+	// Close previous file
+	if err = m.closeFile(); err != nil {
+		err = fmt.Errorf("astilibav: closing file failed: %w", err)
+		return
+	}
+
+	// Open next file
+	if err = m.openFile(pts); err != nil {
+		err = fmt.Errorf("astilibav: opening file failed: %w", err)
+		return
+	}
+	return
+}
+
+func (m *RotatingMuxer) shouldRotate(pts time.Duration) bool {
+	// Max duration has been reached
+	if m.o.MaxDuration > 0 && pts-m.f.start >= m.o.MaxDuration {
+		return true
+	}
+
+	// Max size has been reached
+	if m.o.MaxSize > 0 && muxerIOOffset(m.f.w.ctxFormat) >= m.o.MaxSize {
+		return true
+	}
+	return false
+}
+
+func (m *RotatingMuxer) openFile(start time.Duration) (err error) {
+	// Increment count
+	m.count++
+
+	// Create file
+	f := &rotatingMuxerFile{
+		end:      start,
+		openedAt: time.Now(),
+		start:    start,
+	}
+	url := rotatingMuxerURL(m.o.URLPattern, f.openedAt, m.count)
+	if f.w, err = newSegmentWriter(m.o.Format, m.o.FormatName, url); err != nil {
+		err = fmt.Errorf("astilibav: creating segment writer failed: %w", err)
+		return
+	}
+
+	// Make sure the file is freed in case of error
+	defer func() {
+		if err != nil {
+			f.w.close()
+		}
+	}()
+
+	// Clone streams
+	for _, i := range m.ctxFormat.Streams() {
+		var o *avformat.Stream
+		if o, err = CloneStream(i, f.w.ctxFormat); err != nil {
+			err = fmt.Errorf("astilibav: cloning stream %d failed: %w", i.Index(), err)
+			return
+		}
+		o.SetTimeBase(i.TimeBase())
+	}
+
+	// Copy tags
+	if err = copyMetadata(f.w.ctxFormat, m.ctxFormat); err != nil {
+		err = fmt.Errorf("astilibav: copying metadata failed: %w", err)
+		return
+	}
+
+	// Open
+	if err = f.w.open(); err != nil {
+		err = fmt.Errorf("astilibav: opening segment writer failed: %w", err)
+		return
+	}
+
+	// Store file
+	m.f = f
+	return
+}
+
+func (m *RotatingMuxer) closeFile() (err error) {
+	// No file
+	if m.f == nil {
+		return
+	}
+
+	// Reset file
+	f := m.f
+	m.f = nil
+
+	// Close
+	var size int64
+	if size, err = f.w.close(); err != nil {
+		err = fmt.Errorf("astilibav: closing segment writer failed: %w", err)
+		return
+	}
+
+	// Send event
+	m.eh.Emit(astiencoder.Event{
+		Name: EventNameRotatingMuxerFileFinalized,
+		Payload: RotatingMuxerFile{
+			Duration: f.end - f.start,
+			OpenedAt: f.openedAt,
+			Size:     size,
+			URL:      f.w.url,
+		},
+		Target: m,
+	})
+	return
+}
+
+// rotatingMuxerURL replaces the verbs of the pattern
+func rotatingMuxerURL(pattern string, t time.Time, count int) string {
+	var b strings.Builder
+	for idx := 0; idx < len(pattern); idx++ {
+		// Not a verb
+		if pattern[idx] != '%' || idx == len(pattern)-1 {
+			b.WriteByte(pattern[idx])
+			continue
+		}
+
+		// Replace verb
+		idx++
+		switch pattern[idx] {
+		case 'Y':
+			b.WriteString(fmt.Sprintf("%04d", t.Year()))
+		case 'm':
+			b.WriteString(fmt.Sprintf("%02d", t.Month()))
+		case 'd':
+			b.WriteString(fmt.Sprintf("%02d", t.Day()))
+		case 'H':
+			b.WriteString(fmt.Sprintf("%02d", t.Hour()))
+		case 'M':
+			b.WriteString(fmt.Sprintf("%02d", t.Minute()))
+		case 'S':
+			b.WriteString(fmt.Sprintf("%02d", t.Second()))
+		case 'n':
+			b.WriteString(strconv.Itoa(count))
+		case '%':
+			b.WriteByte('%')
+		default:
+			// Unknown verbs are left untouched
+			b.WriteByte('%')
+			b.WriteByte(pattern[idx])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,15 @@
+package astilibav
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotatingMuxerURL(t *testing.T) {
+	n := time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC)
+	assert.Equal(t, "out-20200304-050607.mp4", rotatingMuxerURL("out-%Y%m%d-%H%M%S.mp4", n, 1))
+	assert.Equal(t, "/tmp/out-12-100%.ts", rotatingMuxerURL("/tmp/out-%n-100%%.ts", n, 12))
+	assert.Equal(t, "out-%x-%", rotatingMuxerURL("out-%x-%", n, 1))
+}
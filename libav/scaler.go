@@ -0,0 +1,273 @@
+package astilibav
+
+//#cgo pkg-config: libavutil libswscale
+//#include <errno.h>
+//#include <stdlib.h>
+//#include <libavutil/frame.h>
+//#include <libavutil/pixdesc.h>
+//#include <libavutil/rational.h>
+//#include <libswscale/swscale.h>
+//static int astilibav_scaler_scale(struct SwsContext **c, const AVFrame *in, AVFrame *out, int w, int h, int fmt, int flags) {
+//	*c = sws_getCachedContext(*c, in->width, in->height, in->format, w, h, fmt, flags, NULL, NULL, NULL);
+//	if (!*c) return AVERROR(EINVAL);
+//	out->format = fmt;
+//	out->height = h;
+//	out->width = w;
+//	int ret;
+//	if ((ret = av_frame_get_buffer(out, 0)) < 0) return ret;
+//	if ((ret = sws_scale(*c, (const uint8_t * const *)in->data, in->linesize, 0, in->height, out->data, out->linesize)) < 0) return ret;
+//	if ((ret = av_frame_copy_props(out, in)) < 0) return ret;
+//	// Keep the display aspect ratio
+//	if (in->sample_aspect_ratio.num > 0) out->sample_aspect_ratio = av_mul_q(in->sample_aspect_ratio, (AVRational){h * in->width, w * in->height});
+//	return 0;
+//}
+import "C"
+import (
+	"context"
+	"fmt"
+	"image"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+)
+
+var countScaler uint64
+
+// Default scaler algorithm, which is the one of the ffmpeg scale filter
+const defaultScalerAlgorithm = "bicubic"
+
+var scalerAlgorithms = map[string]C.int{
+	"area":          C.SWS_AREA,
+	"bicubic":       C.SWS_BICUBIC,
+	"bilinear":      C.SWS_BILINEAR,
+	"fast_bilinear": C.SWS_FAST_BILINEAR,
+	"gauss":         C.SWS_GAUSS,
+	"lanczos":       C.SWS_LANCZOS,
+	"neighbor":      C.SWS_POINT,
+	"sinc":          C.SWS_SINC,
+	"spline":        C.SWS_SPLINE,
+}
+
+// Scaler represents an object capable of converting the size and the pixel format of video frames
+// It's a lighter alternative to a filterer when only a "scale" or a "format" filter is needed
+type Scaler struct {
+	*astiencoder.BaseNode
+	c                *astikit.Chan
+	ctx              *C.struct_SwsContext
+	d                *frameDispatcher
+	eh               *astiencoder.EventHandler
+	flags            C.int
+	o                ScalerOptions
+	pixelFormat      avutil.PixelFormat
+	statIncomingRate *astikit.CounterAvgStat
+	statWorkRatio    *astikit.DurationPercentageStat
+}
+
+// ScalerOptions represents scaler options
+type ScalerOptions struct {
+	// Possible values are "area", "bicubic", "bilinear", "fast_bilinear", "gauss", "lanczos", "neighbor", "sinc" and
+	// "spline". Defaults to "bicubic"
+	Algorithm string
+	// If 0, it's computed from the width and the input aspect ratio. If the width is 0 as well, the input height is kept
+	Height int
+	Node   astiencoder.NodeOptions
+	// Name of the output pixel format, such as "yuv420p". If empty, the input pixel format is kept
+	PixelFormat string
+	// If 0, it's computed from the height and the input aspect ratio. If the height is 0 as well, the input width is kept
+	Width int
+}
+
+// NewScaler creates a new scaler
+func NewScaler(o ScalerOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (s *Scaler, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countScaler, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("scaler_%d", count), fmt.Sprintf("Scaler #%d", count), "Scales")
+
+	// Get algorithm
+	if o.Algorithm == "" {
+		o.Algorithm = defaultScalerAlgorithm
+	}
+	flags, ok := scalerAlgorithms[o.Algorithm]
+	if !ok {
+		err = fmt.Errorf("astilibav: invalid algorithm %s", o.Algorithm)
+		return
+	}
+
+	// Create scaler
+	s = &Scaler{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh:               eh,
+		flags:            flags,
+		o:                o,
+		pixelFormat:      avutil.AV_PIX_FMT_NONE,
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statWorkRatio:    astikit.NewDurationPercentageStat(),
+	}
+
+	// Get pixel format
+	if o.PixelFormat != "" {
+		n := C.CString(o.PixelFormat)
+		defer C.free(unsafe.Pointer(n))
+		if s.pixelFormat = avutil.PixelFormat(C.av_get_pix_fmt(n)); s.pixelFormat == avutil.AV_PIX_FMT_NONE {
+			err = fmt.Errorf("astilibav: invalid pixel format %s", o.PixelFormat)
+			return
+		}
+	}
+
+	s.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(s), eh)
+	s.d = newFrameDispatcher(s, eh, c)
+	s.addStats()
+
+	// Make sure the scaling ctx is freed
+	c.Add(func() error {
+		if s.ctx != nil {
+			C.sws_freeContext(s.ctx)
+		}
+		return nil
+	})
+	return
+}
+
+func (s *Scaler) addStats() {
+	// Add incoming rate
+	s.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of frames coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "fps",
+	}, s.statIncomingRate)
+
+	// Add work ratio
+	s.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, s.statWorkRatio)
+
+	// Add dispatcher stats
+	s.d.addStats(s.Stater())
+
+	// Add chan stats
+	s.c.AddStats(s.Stater())
+}
+
+// Connect implements the FrameHandlerConnector interface
+func (s *Scaler) Connect(h FrameHandler) {
+	// Add handler
+	s.d.addHandler(h)
+
+	// Connect nodes
+	astiencoder.ConnectNodes(s, h)
+}
+
+// Disconnect implements the FrameHandlerConnector interface
+func (s *Scaler) Disconnect(h FrameHandler) {
+	// Delete handler
+	s.d.delHandler(h)
+
+	// Disconnect nodes
+	astiencoder.DisconnectNodes(s, h)
+}
+
+// Snapshot implements the astiencoder.Snapshotter interface
+func (s *Scaler) Snapshot(ctx context.Context) (image.Image, error) {
+	return s.d.snapshot(ctx)
+}
+
+// Start starts the scaler
+func (s *Scaler) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	s.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to wait for all dispatcher subprocesses to be done so that they are properly closed
+		defer s.d.wait()
+
+		// Make sure to stop the chan properly
+		defer s.c.Stop()
+
+		// Start chan
+		s.c.Start(s.Context())
+	})
+}
+
+// HandleEOS implements the EOSHandler interface
+func (s *Scaler) HandleEOS(p *EOSHandlerPayload) {
+	s.c.Add(func() {
+		// Forward end of stream
+		s.d.dispatchEOS()
+	})
+}
+
+// HandleFrame implements the FrameHandler interface
+func (s *Scaler) HandleFrame(p *FrameHandlerPayload) {
+	s.c.Add(func() {
+		// Handle pause
+		defer s.HandlePause()
+
+		// Increment incoming rate
+		s.statIncomingRate.Add(1)
+
+		// Get output format
+		cf := (*C.AVFrame)(unsafe.Pointer(p.Frame))
+		w, h := scalerSize(s.o.Width, s.o.Height, int(cf.width), int(cf.height))
+		pixelFormat := s.pixelFormat
+		if pixelFormat == avutil.AV_PIX_FMT_NONE {
+			pixelFormat = avutil.PixelFormat(cf.format)
+		}
+
+		// Nothing to convert
+		if w == int(cf.width) && h == int(cf.height) && pixelFormat == avutil.PixelFormat(cf.format) {
+			s.d.dispatch(p.Frame, s.descriptor(p.Descriptor, p.Frame), p.Metadata)
+			return
+		}
+
+		// Get frame
+		f := s.d.p.get()
+		defer s.d.p.put(f)
+
+		// Scale
+		s.statWorkRatio.Begin()
+		if ret := C.astilibav_scaler_scale(&s.ctx, cf, (*C.AVFrame)(unsafe.Pointer(f)), C.int(w), C.int(h), C.int(pixelFormat), s.flags); ret < 0 {
+			s.statWorkRatio.End()
+			emitAvError(s, s.eh, int(ret), "astilibav_scaler_scale failed")
+			return
+		}
+		s.statWorkRatio.End()
+
+		// Dispatch frame
+		s.d.dispatch(f, s.descriptor(p.Descriptor, f), p.Metadata)
+	})
+}
+
+func (s *Scaler) descriptor(prev Descriptor, f *avutil.Frame) StreamDescriptor {
+	cf := (*C.AVFrame)(unsafe.Pointer(f))
+	psd, ok := DescriptorStream(prev)
+	ctx := Context{
+		CodecType:         avutil.AVMEDIA_TYPE_VIDEO,
+		Height:            int(cf.height),
+		PixelFormat:       avutil.PixelFormat(cf.format),
+		SampleAspectRatio: avutil.NewRational(int(cf.sample_aspect_ratio.num), int(cf.sample_aspect_ratio.den)),
+		TimeBase:          prev.TimeBase(),
+		Width:             int(cf.width),
+	}
+	if ok {
+		ctx.FrameRate = psd.Context().FrameRate
+	}
+	return newStreamDescriptor(ctx, psd.Index(), psd.SideData())
+}
+
+func scalerSize(width, height, inWidth, inHeight int) (w, h int) {
+	w, h = width, height
+	switch {
+	case w <= 0 && h <= 0:
+		w, h = inWidth, inHeight
+	case w <= 0:
+		w = abrLadderWidth(h, inWidth, inHeight)
+	case h <= 0:
+		h = abrLadderWidth(w, inHeight, inWidth)
+	}
+	return
+}
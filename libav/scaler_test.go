@@ -0,0 +1,18 @@
+package astilibav
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScalerSize(t *testing.T) {
+	w, h := scalerSize(0, 0, 1920, 1080)
+	assert.Equal(t, []int{1920, 1080}, []int{w, h})
+	w, h = scalerSize(1280, 720, 1920, 1080)
+	assert.Equal(t, []int{1280, 720}, []int{w, h})
+	w, h = scalerSize(0, 360, 1920, 1080)
+	assert.Equal(t, []int{640, 360}, []int{w, h})
+	w, h = scalerSize(854, 0, 1920, 1080)
+	assert.Equal(t, []int{854, 480}, []int{w, h})
+}
@@ -0,0 +1,336 @@
+package astilibav
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+)
+
+var countSceneDetector uint64
+
+// Default scene detector values
+const (
+	defaultSceneDetectorSampleStep = 8
+	defaultSceneDetectorThreshold  = 0.4
+)
+
+// Scene detector metadata keys
+const (
+	// Set to "1" on frames starting a new scene
+	SceneDetectorMetadataKeySceneChange = "astilibav.scene_detector.scene_change"
+	// Scene score formatted with 6 decimals
+	SceneDetectorMetadataKeyScore = "astilibav.scene_detector.score"
+	// Frame metadata key also used by ffmpeg's select filter, which filters such as drawtext can read
+	sceneDetectorFrameMetadataKeyScore = "lavfi.scene_score"
+)
+
+// SceneDetector represents an object capable of detecting scene changes in video frames and forwarding them
+// A scene score is computed on the first plane of each frame (which is luma for YUV pixel formats) and compared
+// to the threshold. Min and max durations are enforced between 2 consecutive scenes
+type SceneDetector struct {
+	*astiencoder.BaseNode
+	c                *astikit.Chan
+	d                *frameDispatcher
+	eh               *astiencoder.EventHandler
+	lastScene        *time.Duration
+	o                SceneDetectorOptions
+	prevMafd         float64
+	prevSamples      []uint8
+	samples          []uint8
+	statIncomingRate *astikit.CounterAvgStat
+	statWorkRatio    *astikit.DurationPercentageStat
+}
+
+// SceneDetectorOptions represents scene detector options
+type SceneDetectorOptions struct {
+	// If true, an EventNameSceneDetectorScore event is emitted for every frame with a SceneDetectorScore payload
+	EmitScores bool
+	// If true, frames starting a new scene are marked as I frames and other frames have their picture type reset so
+	// that an encoder with ForceKeyFrames enabled creates keyframes at scene boundaries only
+	ForceKeyFrame bool
+	// Maximum duration of a scene. Once it's reached, a new scene is forced
+	MaxDuration time.Duration
+	// Minimum duration of a scene. Scene changes happening before it's reached are ignored
+	MinDuration time.Duration
+	Node        astiencoder.NodeOptions
+	// Number of pixels between 2 samples, both horizontally and vertically. Defaults to 8
+	SampleStep int
+	// If set, detected scenes are added as cues to the splitter
+	Splitter *Splitter
+	// If true, scores are added to both the frame metadata and the unit metadata, and frames starting a new scene are
+	// tagged in the unit metadata
+	TagFrames bool
+	// Score between 0 and 1 above which a scene change is detected. Defaults to 0.4
+	Threshold float64
+}
+
+// SceneDetectorScene represents a detected scene
+type SceneDetectorScene struct {
+	// Score is 0 when the scene has been forced because of the max duration
+	Score float64
+	Start time.Duration
+}
+
+// SceneDetectorScore represents the scene score of a frame
+type SceneDetectorScore struct {
+	Score float64
+	Time  time.Duration
+}
+
+// NewSceneDetector creates a new scene detector
+func NewSceneDetector(o SceneDetectorOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (s *SceneDetector) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countSceneDetector, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("scene_detector_%d", count), fmt.Sprintf("Scene detector #%d", count), "Detects scenes")
+
+	// Default values
+	if o.SampleStep <= 0 {
+		o.SampleStep = defaultSceneDetectorSampleStep
+	}
+	if o.Threshold <= 0 {
+		o.Threshold = defaultSceneDetectorThreshold
+	}
+
+	// Create scene detector
+	s = &SceneDetector{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh:               eh,
+		o:                o,
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statWorkRatio:    astikit.NewDurationPercentageStat(),
+	}
+	s.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(s), eh)
+	s.d = newFrameDispatcher(s, eh, c)
+	s.addStats()
+	return
+}
+
+func (s *SceneDetector) addStats() {
+	// Add incoming rate
+	s.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of frames coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "fps",
+	}, s.statIncomingRate)
+
+	// Add work ratio
+	s.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, s.statWorkRatio)
+
+	// Add dispatcher stats
+	s.d.addStats(s.Stater())
+
+	// Add chan stats
+	s.c.AddStats(s.Stater())
+}
+
+// Connect implements the FrameHandlerConnector interface
+func (s *SceneDetector) Connect(h FrameHandler) {
+	// Add handler
+	s.d.addHandler(h)
+
+	// Connect nodes
+	astiencoder.ConnectNodes(s, h)
+}
+
+// Disconnect implements the FrameHandlerConnector interface
+func (s *SceneDetector) Disconnect(h FrameHandler) {
+	// Delete handler
+	s.d.delHandler(h)
+
+	// Disconnect nodes
+	astiencoder.DisconnectNodes(s, h)
+}
+
+// Snapshot implements the astiencoder.Snapshotter interface
+func (s *SceneDetector) Snapshot(ctx context.Context) (image.Image, error) {
+	return s.d.snapshot(ctx)
+}
+
+// Start starts the scene detector
+func (s *SceneDetector) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	s.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to wait for all dispatcher subprocesses to be done so that they are properly closed
+		defer s.d.wait()
+
+		// Make sure to stop the chan properly
+		defer s.c.Stop()
+
+		// Start chan
+		s.c.Start(s.Context())
+	})
+}
+
+// HandleFrame implements the FrameHandler interface
+func (s *SceneDetector) HandleFrame(p *FrameHandlerPayload) {
+	s.c.Add(func() {
+		// Handle pause
+		defer s.HandlePause()
+
+		// Increment incoming rate
+		s.statIncomingRate.Add(1)
+
+		// Detect scene
+		s.statWorkRatio.Begin()
+		pts := time.Duration(avutil.AvRescaleQ(p.Frame.Pts(), p.Descriptor.TimeBase(), nanosecondRational))
+		score, ok := s.detect(p.Frame, pts)
+		s.statWorkRatio.End()
+
+		// New scene
+		if ok {
+			s.newScene(p.Frame, SceneDetectorScene{
+				Score: score,
+				Start: pts,
+			})
+		} else if s.o.ForceKeyFrame {
+			p.Frame.SetKeyFrame(0)
+			p.Frame.SetPictType(avutil.AvPictureType(avutil.AV_PICTURE_TYPE_NONE))
+		}
+
+		// Emit score
+		if s.o.EmitScores {
+			s.eh.Emit(astiencoder.Event{
+				Name: EventNameSceneDetectorScore,
+				Payload: SceneDetectorScore{
+					Score: score,
+					Time:  pts,
+				},
+				Target: s,
+			})
+		}
+
+		// Tag frame
+		m := p.Metadata
+		if s.o.TagFrames {
+			m = s.tag(p.Frame, m, score, ok)
+		}
+
+		// Dispatch frame
+		s.d.dispatch(p.Frame, p.Descriptor, m)
+	})
+}
+
+func (s *SceneDetector) detect(f *avutil.Frame, pts time.Duration) (score float64, ok bool) {
+	// Sample frame
+	s.prevSamples, s.samples = s.samples, sceneDetectorSamples(s.prevSamples, f, s.o.SampleStep)
+
+	// First frame always starts a new scene
+	if s.lastScene == nil {
+		return 0, true
+	}
+
+	// Compute score
+	score, s.prevMafd = sceneDetectorScore(s.prevSamples, s.samples, s.prevMafd)
+
+	// Max duration has been reached
+	elapsed := pts - *s.lastScene
+	if s.o.MaxDuration > 0 && elapsed >= s.o.MaxDuration {
+		return 0, true
+	}
+
+	// Min duration has not been reached
+	if s.o.MinDuration > 0 && elapsed < s.o.MinDuration {
+		return score, false
+	}
+	return score, score >= s.o.Threshold
+}
+
+func (s *SceneDetector) tag(f *avutil.Frame, m *UnitMetadata, score float64, sceneChange bool) *UnitMetadata {
+	// Add frame metadata
+	v := strconv.FormatFloat(score, 'f', 6, 64)
+	if err := frameSetMetadata(f, sceneDetectorFrameMetadataKeyScore, v); err != nil {
+		s.eh.Emit(astiencoder.EventError(s, fmt.Errorf("astilibav: setting frame metadata failed: %w", err)))
+	}
+
+	// Add unit metadata
+	m = m.With(SceneDetectorMetadataKeyScore, v)
+	if sceneChange {
+		m = m.With(SceneDetectorMetadataKeySceneChange, "1")
+	}
+	return m
+}
+
+func (s *SceneDetector) newScene(f *avutil.Frame, sc SceneDetectorScene) {
+	// Store last scene
+	s.lastScene = &sc.Start
+
+	// Force key frame
+	if s.o.ForceKeyFrame {
+		f.SetKeyFrame(1)
+		f.SetPictType(avutil.AvPictureType(avutil.AV_PICTURE_TYPE_I))
+	}
+
+	// Add splitter cue
+	if s.o.Splitter != nil {
+		s.o.Splitter.AddCue(SplitterCue{Start: sc.Start})
+	}
+
+	// Send event
+	s.eh.Emit(astiencoder.Event{
+		Name:    EventNameSceneDetectorSceneDetected,
+		Payload: sc,
+		Target:  s,
+	})
+}
+
+// sceneDetectorSamples samples the first plane of the frame, reusing the provided buffer if possible
+func sceneDetectorSamples(buf []uint8, f *avutil.Frame, step int) []uint8 {
+	// Reset buffer
+	buf = buf[:0]
+
+	// No data
+	data := f.Data()
+	if data == nil {
+		return buf
+	}
+
+	// Loop through rows
+	linesize := f.Linesize()
+	for y := 0; y < f.Height(); y += step {
+		// Loop through columns
+		for x := 0; x < f.Width(); x += step {
+			buf = append(buf, *(*uint8)(unsafe.Pointer(uintptr(unsafe.Pointer(data)) + uintptr(y*linesize+x))))
+		}
+	}
+	return buf
+}
+
+// sceneDetectorScore computes the scene score between 2 sets of samples the same way ffmpeg's select filter does:
+// the mean absolute frame difference is compared to the previous one so that high motion doesn't trigger a
+// new scene
+func sceneDetectorScore(prev, curr []uint8, prevMafd float64) (score, mafd float64) {
+	// Samples can't be compared
+	if len(prev) == 0 || len(prev) != len(curr) {
+		return 0, 0
+	}
+
+	// Compute mean absolute frame difference
+	var sad uint64
+	for idx := range curr {
+		if curr[idx] > prev[idx] {
+			sad += uint64(curr[idx] - prev[idx])
+		} else {
+			sad += uint64(prev[idx] - curr[idx])
+		}
+	}
+	mafd = float64(sad) / float64(len(curr)) / 255
+
+	// Compute score
+	score = math.Max(0, math.Min(1, math.Min(mafd, math.Abs(mafd-prevMafd))))
+	return
+}
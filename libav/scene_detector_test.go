@@ -0,0 +1,19 @@
+package astilibav
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSceneDetectorScore(t *testing.T) {
+	s, m := sceneDetectorScore(nil, []uint8{0, 0}, 0)
+	assert.Equal(t, 0.0, s)
+	assert.Equal(t, 0.0, m)
+	s, m = sceneDetectorScore([]uint8{0, 0}, []uint8{255, 255}, 0)
+	assert.Equal(t, 1.0, s)
+	assert.Equal(t, 1.0, m)
+	s, m = sceneDetectorScore([]uint8{0, 255}, []uint8{255, 0}, 1)
+	assert.Equal(t, 0.0, s)
+	assert.Equal(t, 1.0, m)
+}
@@ -0,0 +1,126 @@
+package astilibav
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avformat"
+	"github.com/asticode/goav/avutil"
+)
+
+// segmentWriter writes pkts to one of the successive outputs of a node, such as a splitter segment or a rotating
+// muxer file
+// Timestamps start from 0 in every output. The offset is taken from the first pkt and shared by all streams so that
+// they keep their relative offsets
+type segmentWriter struct {
+	ctxAvIO       *avformat.AvIOContext
+	ctxFormat     *avformat.Context
+	headerWritten bool
+	offset        *time.Duration
+	url           string
+}
+
+func newSegmentWriter(f *avformat.OutputFormat, formatName, url string) (w *segmentWriter, err error) {
+	// Alloc format context
+	// We need to create an intermediate variable to avoid "cgo argument has Go pointer to Go pointer" errors
+	var ctxFormat *avformat.Context
+	if ret := avformat.AvformatAllocOutputContext2(&ctxFormat, f, formatName, url); ret < 0 {
+		err = fmt.Errorf("astilibav: avformat.AvformatAllocOutputContext2 on %s failed: %w", url, NewAvError(ret))
+		return
+	}
+
+	// Create writer
+	w = &segmentWriter{
+		ctxFormat: ctxFormat,
+		url:       url,
+	}
+	return
+}
+
+// open opens the output and writes the header. Streams must have been added beforehand
+func (w *segmentWriter) open() (err error) {
+	// This is a file
+	if w.ctxFormat.Oformat().Flags()&avformat.AVFMT_NOFILE == 0 {
+		// Open
+		var ctxAvIO *avformat.AvIOContext
+		if ret := avformat.AvIOOpen(&ctxAvIO, w.url, avformat.AVIO_FLAG_WRITE); ret < 0 {
+			err = fmt.Errorf("astilibav: avformat.AvIOOpen on %s failed: %w", w.url, NewAvError(ret))
+			return
+		}
+		w.ctxAvIO = ctxAvIO
+
+		// Set pb
+		w.ctxFormat.SetPb(w.ctxAvIO)
+	}
+
+	// Write header
+	if ret := w.ctxFormat.AvformatWriteHeader(nil); ret < 0 {
+		err = fmt.Errorf("astilibav: w.ctxFormat.AvformatWriteHeader on %s failed: %w", w.url, NewAvError(ret))
+		return
+	}
+	w.headerWritten = true
+	return
+}
+
+// restamp restamps a pkt whose timestamps are in the time base of its output stream
+func (w *segmentWriter) restamp(pkt *avcodec.Packet) {
+	// Get timestamp
+	v := pkt.Dts()
+	if v == avutil.AV_NOPTS_VALUE {
+		v = pkt.Pts()
+	}
+	if v == avutil.AV_NOPTS_VALUE {
+		return
+	}
+
+	// Get offset
+	tb := w.ctxFormat.Streams()[pkt.StreamIndex()].TimeBase()
+	if w.offset == nil {
+		w.offset = astikit.DurationPtr(time.Duration(avutil.AvRescaleQ(v, tb, nanosecondRational)))
+	}
+	offset := avutil.AvRescaleQ(int64(*w.offset), nanosecondRational, tb)
+
+	// Restamp
+	if pkt.Dts() != avutil.AV_NOPTS_VALUE {
+		pkt.SetDts(pkt.Dts() - offset)
+	}
+	if pkt.Pts() != avutil.AV_NOPTS_VALUE {
+		pkt.SetPts(pkt.Pts() - offset)
+	}
+}
+
+// close writes the trailer if the header has been written, and always closes the output and frees the format
+// context. It returns the number of bytes written, or -1 if unknown
+func (w *segmentWriter) close() (size int64, err error) {
+	// Make sure the format context is freed
+	defer w.ctxFormat.AvformatFreeContext()
+
+	// Make sure the avio is closed
+	size = -1
+	defer func() {
+		if w.ctxAvIO == nil {
+			return
+		}
+		w.ctxFormat.SetPb(nil)
+		if ret := avformat.AvIOClosep(&w.ctxAvIO); ret < 0 && err == nil {
+			err = fmt.Errorf("astilibav: avformat.AvIOClosep on %s failed: %w", w.url, NewAvError(ret))
+		}
+	}()
+
+	// Header has not been written
+	if !w.headerWritten {
+		return
+	}
+
+	// Write trailer
+	if ret := w.ctxFormat.AvWriteTrailer(); ret < 0 {
+		err = fmt.Errorf("astilibav: w.ctxFormat.AvWriteTrailer on %s failed: %w", w.url, NewAvError(ret))
+		return
+	}
+
+	// Get size before the pb is closed
+	size = muxerIOOffset(w.ctxFormat)
+	return
+}
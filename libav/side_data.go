@@ -0,0 +1,425 @@
+package astilibav
+
+//#cgo pkg-config: libavcodec libavfilter libavformat libavutil
+//#include <errno.h>
+//#include <string.h>
+//#include <libavcodec/avcodec.h>
+//#include <libavutil/error.h>
+//#include <libavutil/frame.h>
+//#include <libavutil/mastering_display_metadata.h>
+//#include <libavutil/stereo3d.h>
+//#include "compat.h"
+//// AV_FRAME_DATA_SEI_UNREGISTERED has been introduced in libavutil 56.70.100 (ffmpeg 4.4)
+//#if LIBAVUTIL_VERSION_INT >= AV_VERSION_INT(56, 70, 100)
+//#define ASTILIBAV_SEI_UNREGISTERED 1
+//#endif
+//static int astilibav_frame_side_data_type(int t) {
+//	switch (t) {
+//	case 1: return AV_FRAME_DATA_A53_CC;
+//	case 2: return AV_FRAME_DATA_CONTENT_LIGHT_LEVEL;
+//	case 3: return AV_FRAME_DATA_MASTERING_DISPLAY_METADATA;
+//#ifdef ASTILIBAV_SEI_UNREGISTERED
+//	case 4: return AV_FRAME_DATA_SEI_UNREGISTERED;
+//#endif
+//	case 5: return AV_FRAME_DATA_STEREO3D;
+//	}
+//	return -1;
+//}
+//static int astilibav_pkt_side_data_type(int t) {
+//	switch (t) {
+//	case 1: return AV_PKT_DATA_A53_CC;
+//	case 2: return AV_PKT_DATA_CONTENT_LIGHT_LEVEL;
+//	case 3: return AV_PKT_DATA_MASTERING_DISPLAY_METADATA;
+//	case 5: return AV_PKT_DATA_STEREO3D;
+//	}
+//	return -1;
+//}
+//static int astilibav_side_data_type_from_pkt(int pt) {
+//	switch (pt) {
+//	case AV_PKT_DATA_A53_CC: return 1;
+//	case AV_PKT_DATA_CONTENT_LIGHT_LEVEL: return 2;
+//	case AV_PKT_DATA_MASTERING_DISPLAY_METADATA: return 3;
+//	case AV_PKT_DATA_STEREO3D: return 5;
+//	}
+//	return -1;
+//}
+//// Frames may hold several side data of the same type, such as SEI messages
+//static AVFrameSideData *astilibav_frame_side_data(const AVFrame *f, int t, int i) {
+//	int ft = astilibav_frame_side_data_type(t);
+//	if (ft < 0) return NULL;
+//	for (int j = 0; j < f->nb_side_data; j++) {
+//		if ((int)f->side_data[j]->type != ft) continue;
+//		if (i-- == 0) return f->side_data[j];
+//	}
+//	return NULL;
+//}
+//static void astilibav_frame_remove_side_data(AVFrame *f, int t) {
+//	int ft = astilibav_frame_side_data_type(t);
+//	if (ft >= 0) av_frame_remove_side_data(f, (enum AVFrameSideDataType)ft);
+//}
+//static int astilibav_frame_add_side_data(AVFrame *f, int t, const uint8_t *b, int n) {
+//	int ft = astilibav_frame_side_data_type(t);
+//	if (ft < 0) return AVERROR(ENOSYS);
+//	AVFrameSideData *sd = av_frame_new_side_data(f, (enum AVFrameSideDataType)ft, n);
+//	if (!sd) return AVERROR(ENOMEM);
+//	memcpy(sd->data, b, n);
+//	return 0;
+//}
+//// Side data size is an int before libavcodec 59 and a size_t afterwards
+//static const uint8_t *astilibav_pkt_side_data(const AVPacket *p, int t, int *n) {
+//	int pt = astilibav_pkt_side_data_type(t);
+//	*n = 0;
+//	if (pt < 0) return NULL;
+//	for (int j = 0; j < p->side_data_elems; j++) {
+//		if ((int)p->side_data[j].type != pt) continue;
+//		*n = (int)p->side_data[j].size;
+//		return p->side_data[j].data;
+//	}
+//	return NULL;
+//}
+//static int astilibav_pkt_add_side_data(AVPacket *p, int t, const uint8_t *b, int n) {
+//	int pt = astilibav_pkt_side_data_type(t);
+//	if (pt < 0) return AVERROR(ENOSYS);
+//	uint8_t *d = av_packet_new_side_data(p, (enum AVPacketSideDataType)pt, n);
+//	if (!d) return AVERROR(ENOMEM);
+//	memcpy(d, b, n);
+//	return 0;
+//}
+import "C"
+import (
+	"errors"
+	"math"
+	"unsafe"
+
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avformat"
+	"github.com/asticode/goav/avutil"
+)
+
+// Side data types handled by this package. Values are shared between frames and pkts, and are mapped to their
+// libav counterparts in C
+const (
+	sideDataTypeA53ClosedCaptions = 1
+	sideDataTypeContentLightLevel = 2
+	sideDataTypeMasteringDisplay  = 3
+	sideDataTypeSEIUnregistered   = 4
+	sideDataTypeStereo3D          = 5
+)
+
+var sideDataTypes = []int{
+	sideDataTypeA53ClosedCaptions,
+	sideDataTypeContentLightLevel,
+	sideDataTypeMasteringDisplay,
+	sideDataTypeSEIUnregistered,
+	sideDataTypeStereo3D,
+}
+
+// SideData represents the side data of a frame or a pkt
+// Nil or empty fields mean the side data is missing
+type SideData struct {
+	// Raw A53 cc_data triplets. See ClosedCaptions
+	A53ClosedCaptions []byte
+	ContentLightLevel *ContentLightLevel
+	MasteringDisplay  *MasteringDisplay
+	// User data unregistered SEI messages, each one starting with its 16 bytes UUID. Only available on frames starting
+	// with ffmpeg 4.4
+	SEIUnregistered [][]byte
+	Stereo3D        *Stereo3D
+}
+
+// ContentLightLevel represents HDR content light level metadata, in cd/m²
+type ContentLightLevel struct {
+	MaxCLL  int
+	MaxFALL int
+}
+
+// MasteringDisplay represents HDR mastering display metadata as described in SMPTE ST 2086
+type MasteringDisplay struct {
+	// CIE 1931 xy chromaticity coordinates of the R, G and B primaries
+	DisplayPrimaries [3][2]float64
+	HasLuminance     bool
+	HasPrimaries     bool
+	// In cd/m²
+	MaxLuminance float64
+	// In cd/m²
+	MinLuminance float64
+	// CIE 1931 xy chromaticity coordinates of the white point
+	WhitePoint [2]float64
+}
+
+// Stereo3D represents stereoscopic 3D metadata
+type Stereo3D struct {
+	// Whether the views are inverted, e.g. the right view comes first
+	Inverted bool
+	// Packing of the views as named by libavutil, such as "side by side" or "top and bottom"
+	Type string
+}
+
+// SideData returns the side data of the frame
+func (p *FrameHandlerPayload) SideData() SideData {
+	return newSideData(frameSideDataEntries(p.Frame))
+}
+
+// SideData returns the side data of the pkt
+func (p *PktHandlerPayload) SideData() SideData {
+	return newSideData(pktSideDataEntries(p.Pkt))
+}
+
+// sideDataEntry represents a copy of a side data, which doesn't hold any libav memory
+type sideDataEntry struct {
+	data []byte
+	t    int
+}
+
+func frameSideDataEntries(f *avutil.Frame) (es []sideDataEntry) {
+	cf := (*C.struct_AVFrame)(unsafe.Pointer(f))
+	for _, t := range sideDataTypes {
+		for idx := 0; ; idx++ {
+			sd := C.astilibav_frame_side_data(cf, C.int(t), C.int(idx))
+			if sd == nil {
+				break
+			}
+			es = append(es, sideDataEntry{
+				data: C.GoBytes(unsafe.Pointer(sd.data), C.int(sd.size)),
+				t:    t,
+			})
+		}
+	}
+	return
+}
+
+func pktSideDataEntries(pkt *avcodec.Packet) (es []sideDataEntry) {
+	cp := (*C.struct_AVPacket)(unsafe.Pointer(pkt))
+	for _, t := range sideDataTypes {
+		var n C.int
+		if d := C.astilibav_pkt_side_data(cp, C.int(t), &n); d != nil {
+			es = append(es, sideDataEntry{
+				data: C.GoBytes(unsafe.Pointer(d), n),
+				t:    t,
+			})
+		}
+	}
+	return
+}
+
+func streamSideDataEntries(s *avformat.Stream) (es []sideDataEntry) {
+	var cn C.int
+	csd := C.astilibav_stream_side_data((*C.struct_AVStream)(unsafe.Pointer(s)), &cn)
+	if n := int(cn); n > 0 {
+		for _, sd := range (*[1 << 10]C.AVPacketSideData)(unsafe.Pointer(csd))[:n:n] {
+			if t := int(C.astilibav_side_data_type_from_pkt(C.int(sd._type))); t > 0 && sd.size > 0 {
+				es = append(es, sideDataEntry{
+					data: C.GoBytes(unsafe.Pointer(sd.data), C.int(sd.size)),
+					t:    t,
+				})
+			}
+		}
+	}
+	return
+}
+
+// streamAddSideData adds the entries that pkts support to the stream so that muxers can write them in the container
+func streamAddSideData(s *avformat.Stream, es []sideDataEntry) error {
+	cs := (*C.struct_AVStream)(unsafe.Pointer(s))
+	for _, e := range es {
+		pt := C.astilibav_pkt_side_data_type(C.int(e.t))
+		if len(e.data) == 0 || pt < 0 {
+			continue
+		}
+		d := C.astilibav_stream_new_side_data(cs, C.enum_AVPacketSideDataType(pt), C.int(len(e.data)))
+		if d == nil {
+			return errors.New("astilibav: astilibav_stream_new_side_data failed")
+		}
+		copy((*[1 << 30]byte)(unsafe.Pointer(d))[:len(e.data):len(e.data)], e.data)
+	}
+	return nil
+}
+
+// frameRemoveSideData removes the side data of the provided types from the frame
+func frameRemoveSideData(f *avutil.Frame, ts []int) {
+	for _, t := range ts {
+		C.astilibav_frame_remove_side_data((*C.struct_AVFrame)(unsafe.Pointer(f)), C.int(t))
+	}
+}
+
+// frameRestoreSideData adds the entries whose type is missing in the frame
+func frameRestoreSideData(f *avutil.Frame, es []sideDataEntry) error {
+	cf := (*C.struct_AVFrame)(unsafe.Pointer(f))
+	fes := frameSideDataEntries(f)
+	for _, e := range es {
+		if len(e.data) == 0 || sideDataEntriesHaveType(fes, e.t) {
+			continue
+		}
+		if ret := C.astilibav_frame_add_side_data(cf, C.int(e.t), (*C.uint8_t)(unsafe.Pointer(&e.data[0])), C.int(len(e.data))); ret < 0 {
+			return NewAvError(int(ret))
+		}
+	}
+	return nil
+}
+
+// pktRestoreSideData adds the entries whose type is missing in the pkt and that pkts support
+func pktRestoreSideData(pkt *avcodec.Packet, es []sideDataEntry) error {
+	cp := (*C.struct_AVPacket)(unsafe.Pointer(pkt))
+	pes := pktSideDataEntries(pkt)
+	for _, e := range es {
+		if len(e.data) == 0 || C.astilibav_pkt_side_data_type(C.int(e.t)) < 0 || sideDataEntriesHaveType(pes, e.t) {
+			continue
+		}
+		if ret := C.astilibav_pkt_add_side_data(cp, C.int(e.t), (*C.uint8_t)(unsafe.Pointer(&e.data[0])), C.int(len(e.data))); ret < 0 {
+			return NewAvError(int(ret))
+		}
+	}
+	return nil
+}
+
+func sideDataEntriesHaveType(es []sideDataEntry, t int) bool {
+	for _, e := range es {
+		if e.t == t {
+			return true
+		}
+	}
+	return false
+}
+
+func sideDataEntriesWithoutTypes(es []sideDataEntry, ts []int) (o []sideDataEntry) {
+	for _, e := range es {
+		var found bool
+		for _, t := range ts {
+			if e.t == t {
+				found = true
+				break
+			}
+		}
+		if !found {
+			o = append(o, e)
+		}
+	}
+	return
+}
+
+func newSideData(es []sideDataEntry) (d SideData) {
+	for _, e := range es {
+		switch e.t {
+		case sideDataTypeA53ClosedCaptions:
+			d.A53ClosedCaptions = e.data
+		case sideDataTypeContentLightLevel:
+			if len(e.data) >= int(C.sizeof_AVContentLightMetadata) {
+				m := (*C.AVContentLightMetadata)(unsafe.Pointer(&e.data[0]))
+				d.ContentLightLevel = &ContentLightLevel{
+					MaxCLL:  int(m.MaxCLL),
+					MaxFALL: int(m.MaxFALL),
+				}
+			}
+		case sideDataTypeMasteringDisplay:
+			if len(e.data) >= int(C.sizeof_AVMasteringDisplayMetadata) {
+				m := (*C.AVMasteringDisplayMetadata)(unsafe.Pointer(&e.data[0]))
+				md := &MasteringDisplay{
+					HasLuminance: m.has_luminance > 0,
+					HasPrimaries: m.has_primaries > 0,
+					MaxLuminance: sideDataRational(m.max_luminance),
+					MinLuminance: sideDataRational(m.min_luminance),
+					WhitePoint:   [2]float64{sideDataRational(m.white_point[0]), sideDataRational(m.white_point[1])},
+				}
+				for idx := range md.DisplayPrimaries {
+					md.DisplayPrimaries[idx] = [2]float64{sideDataRational(m.display_primaries[idx][0]), sideDataRational(m.display_primaries[idx][1])}
+				}
+				d.MasteringDisplay = md
+			}
+		case sideDataTypeSEIUnregistered:
+			d.SEIUnregistered = append(d.SEIUnregistered, e.data)
+		case sideDataTypeStereo3D:
+			// Only type and flags, which are the first fields, are read since the struct has grown over time
+			if len(e.data) >= 2*int(C.sizeof_int) {
+				m := (*C.AVStereo3D)(unsafe.Pointer(&e.data[0]))
+				d.Stereo3D = &Stereo3D{
+					Inverted: m.flags&C.AV_STEREO3D_FLAG_INVERT > 0,
+					Type:     C.GoString(C.av_stereo3d_type_name(C.uint(m._type))),
+				}
+			}
+		}
+	}
+	return
+}
+
+// newHDRSideDataEntries converts HDR static metadata to side data entries
+func newHDRSideDataEntries(md *MasteringDisplay, cll *ContentLightLevel) (es []sideDataEntry) {
+	// Mastering display
+	if md != nil {
+		b := make([]byte, int(C.sizeof_AVMasteringDisplayMetadata))
+		m := (*C.AVMasteringDisplayMetadata)(unsafe.Pointer(&b[0]))
+		for idx := range md.DisplayPrimaries {
+			m.display_primaries[idx][0] = newSideDataRational(md.DisplayPrimaries[idx][0], masteringDisplayChromaticityDen)
+			m.display_primaries[idx][1] = newSideDataRational(md.DisplayPrimaries[idx][1], masteringDisplayChromaticityDen)
+		}
+		m.white_point[0] = newSideDataRational(md.WhitePoint[0], masteringDisplayChromaticityDen)
+		m.white_point[1] = newSideDataRational(md.WhitePoint[1], masteringDisplayChromaticityDen)
+		m.max_luminance = newSideDataRational(md.MaxLuminance, masteringDisplayLuminanceDen)
+		m.min_luminance = newSideDataRational(md.MinLuminance, masteringDisplayLuminanceDen)
+		if md.HasLuminance {
+			m.has_luminance = 1
+		}
+		if md.HasPrimaries {
+			m.has_primaries = 1
+		}
+		es = append(es, sideDataEntry{data: b, t: sideDataTypeMasteringDisplay})
+	}
+
+	// Content light level
+	if cll != nil {
+		b := make([]byte, int(C.sizeof_AVContentLightMetadata))
+		m := (*C.AVContentLightMetadata)(unsafe.Pointer(&b[0]))
+		m.MaxCLL = C.uint(cll.MaxCLL)
+		m.MaxFALL = C.uint(cll.MaxFALL)
+		es = append(es, sideDataEntry{data: b, t: sideDataTypeContentLightLevel})
+	}
+	return
+}
+
+// Denominators used by SMPTE ST 2086
+const (
+	masteringDisplayChromaticityDen = 50000
+	masteringDisplayLuminanceDen    = 10000
+)
+
+func newSideDataRational(v float64, den int) C.AVRational {
+	return C.AVRational{num: C.int(math.Round(v * float64(den))), den: C.int(den)}
+}
+
+func sideDataRational(r C.AVRational) float64 {
+	if r.den == 0 {
+		return 0
+	}
+	return float64(r.num) / float64(r.den)
+}
+
+// sideDataTracker keeps track of the side data of the units sent to a codec or a filter graph so that it can be
+// restored on the units coming out of it when it has been lost
+// Contrary to the unit metadata tracker, outgoing units are only matched through their pts since restoring side data
+// such as closed captions on the wrong unit would duplicate it
+type sideDataTracker struct {
+	t *ptsTracker
+}
+
+func newSideDataTracker() *sideDataTracker {
+	return &sideDataTracker{t: newPtsTracker(defaultPtsTrackerSize)}
+}
+
+func (t *sideDataTracker) add(pts int64, es []sideDataEntry) {
+	if len(es) > 0 && pts != avutil.AV_NOPTS_VALUE {
+		t.t.add(pts, es)
+	}
+}
+
+func (t *sideDataTracker) get(pts int64) []sideDataEntry {
+	// No pts
+	if pts == avutil.AV_NOPTS_VALUE {
+		return nil
+	}
+
+	// Get side data
+	v, ok := t.t.get(pts)
+	if !ok {
+		return nil
+	}
+	return v.([]sideDataEntry)
+}
@@ -0,0 +1,33 @@
+package astilibav
+
+import (
+	"testing"
+
+	"github.com/asticode/goav/avutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSideDataTracker(t *testing.T) {
+	es1 := []sideDataEntry{{data: []byte{1}, t: sideDataTypeA53ClosedCaptions}}
+	es2 := []sideDataEntry{{data: []byte{2}, t: sideDataTypeMasteringDisplay}}
+	tr := newSideDataTracker()
+	tr.add(1, es1)
+	tr.add(2, nil)
+	tr.add(3, es2)
+	tr.add(avutil.AV_NOPTS_VALUE, es1)
+	assert.Equal(t, es1, tr.get(1))
+	assert.Nil(t, tr.get(1))
+	assert.Nil(t, tr.get(2))
+	assert.Nil(t, tr.get(avutil.AV_NOPTS_VALUE))
+	assert.Equal(t, es2, tr.get(3))
+	assert.Empty(t, tr.t.m)
+
+	// Pkts come out of the encoder in decode order
+	tr.add(4, es1)
+	tr.add(6, es2)
+	tr.add(5, es1)
+	assert.Equal(t, es1, tr.get(4))
+	assert.Equal(t, es2, tr.get(6))
+	assert.Equal(t, es1, tr.get(5))
+	assert.Empty(t, tr.t.m)
+}
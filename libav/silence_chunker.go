@@ -0,0 +1,371 @@
+package astilibav
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync/atomic"
+	"text/template"
+	"time"
+	"unsafe"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+)
+
+var countSilenceChunker uint64
+
+// Default silence chunker values
+const (
+	defaultSilenceChunkerMinSilenceDuration = 500 * time.Millisecond
+	defaultSilenceChunkerThreshold          = -40
+)
+
+// SilenceChunker represents an object capable of splitting audio frames into utterance chunks at silence boundaries
+// Only packed s16 and flt sample formats are supported, which means an aformat filter may be needed upstream
+type SilenceChunker struct {
+	*astiencoder.BaseNode
+	c                *astikit.Chan
+	chunk            *SilenceChunk
+	count            uint32
+	eh               *astiencoder.EventHandler
+	o                SilenceChunkerOptions
+	silenceDuration  time.Duration
+	statIncomingRate *astikit.CounterAvgStat
+	statWorkRatio    *astikit.DurationPercentageStat
+	t                *template.Template
+}
+
+// SilenceChunkerOptions represents silence chunker options
+type SilenceChunkerOptions struct {
+	// Context of the incoming frames. Only Channels is used
+	Context Context
+	Data    map[string]interface{}
+	Handler func(c SilenceChunk, args SilenceChunkerHandlerArgs) error
+	// If > 0, chunks are cut once they reach this duration even if no silence has been detected
+	MaxDuration time.Duration
+	// Chunks can't be shorter than this duration
+	MinDuration time.Duration
+	// Duration of silence needed to cut a chunk. Defaults to 500ms
+	MinSilenceDuration time.Duration
+	Node               astiencoder.NodeOptions
+	// "count", "start" and "end" are available in addition to data
+	Pattern string
+	// Level in dBFS under which audio is considered as silence. Defaults to -40
+	Threshold float64
+}
+
+// SilenceChunkerHandlerArgs represents silence chunker handler args
+type SilenceChunkerHandlerArgs struct {
+	Pattern string
+}
+
+// SilenceChunk represents an utterance chunk
+type SilenceChunk struct {
+	Channels int
+	// Interleaved samples
+	Data         []byte
+	End          time.Duration
+	SampleFormat int
+	SampleRate   int
+	Start        time.Duration
+}
+
+// NewSilenceChunker creates a new silence chunker
+func NewSilenceChunker(o SilenceChunkerOptions, eh *astiencoder.EventHandler) (s *SilenceChunker, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countSilenceChunker, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("silence_chunker_%d", count), fmt.Sprintf("Silence Chunker #%d", count), "Chunks audio at silences")
+
+	// Default values
+	if o.MinSilenceDuration <= 0 {
+		o.MinSilenceDuration = defaultSilenceChunkerMinSilenceDuration
+	}
+	if o.Threshold == 0 {
+		o.Threshold = defaultSilenceChunkerThreshold
+	}
+	if o.Data == nil {
+		o.Data = make(map[string]interface{})
+	}
+
+	// Create silence chunker
+	s = &SilenceChunker{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh:               eh,
+		o:                o,
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statWorkRatio:    astikit.NewDurationPercentageStat(),
+	}
+	s.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(s), eh)
+	s.addStats()
+
+	// No handler
+	if o.Handler == nil {
+		err = errors.New("astilibav: no handler provided")
+		return
+	}
+
+	// No channels
+	if o.Context.Channels <= 0 {
+		err = errors.New("astilibav: no channels provided")
+		return
+	}
+
+	// Parse pattern
+	if len(o.Pattern) > 0 {
+		if s.t, err = template.New("").Parse(o.Pattern); err != nil {
+			err = fmt.Errorf("astilibav: parsing pattern %s as template failed: %w", o.Pattern, err)
+			return
+		}
+	}
+	return
+}
+
+func (s *SilenceChunker) addStats() {
+	// Add incoming rate
+	s.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of frames coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "fps",
+	}, s.statIncomingRate)
+
+	// Add work ratio
+	s.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, s.statWorkRatio)
+
+	// Add chan stats
+	s.c.AddStats(s.Stater())
+}
+
+// Start starts the silence chunker
+func (s *SilenceChunker) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	s.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to handle the remaining chunk
+		defer s.flush()
+
+		// Make sure to stop the chan properly
+		defer s.c.Stop()
+
+		// Start chan
+		s.c.Start(s.Context())
+	})
+}
+
+// HandleFrame implements the FrameHandler interface
+func (s *SilenceChunker) HandleFrame(p *FrameHandlerPayload) {
+	s.c.Add(func() {
+		// Handle pause
+		defer s.HandlePause()
+
+		// Increment incoming rate
+		s.statIncomingRate.Add(1)
+
+		// Get bytes per sample
+		bps := silenceChunkerBytesPerSample(p.Frame.Format())
+		if bps == 0 {
+			s.eh.Emit(astiencoder.EventError(s, fmt.Errorf("astilibav: sample format %d is not supported", p.Frame.Format())))
+			return
+		}
+
+		// Get samples
+		s.statWorkRatio.Begin()
+		n := p.Frame.NbSamples() * s.o.Context.Channels * bps
+		var b []byte
+		if n > 0 && p.Frame.Data() != nil {
+			b = (*[1 << 30]byte)(unsafe.Pointer(p.Frame.Data()))[:n:n]
+		}
+
+		// Get timestamps
+		start := time.Duration(avutil.AvRescaleQ(p.Frame.Pts(), p.Descriptor.TimeBase(), nanosecondRational))
+		var d time.Duration
+		if p.Frame.SampleRate() > 0 {
+			d = time.Duration(float64(p.Frame.NbSamples()) / float64(p.Frame.SampleRate()) * 1e9)
+		}
+
+		// Check level
+		silent := silenceChunkerLevel(b, p.Frame.Format()) < s.o.Threshold
+		s.statWorkRatio.End()
+
+		// Update silence duration
+		if silent {
+			s.silenceDuration += d
+		} else {
+			s.silenceDuration = 0
+		}
+
+		// Chunks don't start with silence
+		if s.chunk == nil {
+			if silent {
+				return
+			}
+			s.chunk = &SilenceChunk{
+				Channels:     s.o.Context.Channels,
+				SampleFormat: p.Frame.Format(),
+				SampleRate:   p.Frame.SampleRate(),
+				Start:        start,
+			}
+		}
+
+		// Append samples
+		s.chunk.Data = append(s.chunk.Data, b...)
+		s.chunk.End = start + d
+
+		// Chunk is complete
+		if l := s.chunk.End - s.chunk.Start; (s.o.MaxDuration > 0 && l >= s.o.MaxDuration) ||
+			(s.silenceDuration >= s.o.MinSilenceDuration && l >= s.o.MinDuration) {
+			s.flush()
+		}
+	})
+}
+
+func (s *SilenceChunker) flush() {
+	// No chunk
+	if s.chunk == nil {
+		return
+	}
+
+	// Reset chunk
+	c := *s.chunk
+	s.chunk = nil
+
+	// Get pattern
+	var args SilenceChunkerHandlerArgs
+	if s.t != nil {
+		// Increment count
+		s.count++
+
+		// Create data
+		s.o.Data["count"] = s.count
+		s.o.Data["end"] = c.End
+		s.o.Data["start"] = c.Start
+
+		// Execute template
+		buf := &bytes.Buffer{}
+		if err := s.t.Execute(buf, s.o.Data); err != nil {
+			s.eh.Emit(astiencoder.EventError(s, fmt.Errorf("astilibav: executing template %s with data %+v failed: %w", s.o.Pattern, s.o.Data, err)))
+			return
+		}
+
+		// Add to args
+		args.Pattern = buf.String()
+	}
+
+	// Handle chunk
+	s.statWorkRatio.Begin()
+	if err := s.o.Handler(c, args); err != nil {
+		s.statWorkRatio.End()
+		s.eh.Emit(astiencoder.EventError(s, fmt.Errorf("astilibav: silence chunk handler with args %+v failed: %w", args, err)))
+		return
+	}
+	s.statWorkRatio.End()
+}
+
+func silenceChunkerBytesPerSample(sampleFmt int) int {
+	switch sampleFmt {
+	case avutil.AV_SAMPLE_FMT_S16:
+		return 2
+	case avutil.AV_SAMPLE_FMT_FLT:
+		return 4
+	}
+	return 0
+}
+
+// silenceChunkerLevel returns the RMS level of the samples in dBFS
+func silenceChunkerLevel(b []byte, sampleFmt int) float64 {
+	// Loop through samples
+	var sum float64
+	var n int
+	switch sampleFmt {
+	case avutil.AV_SAMPLE_FMT_S16:
+		for idx := 0; idx+1 < len(b); idx += 2 {
+			v := float64(int16(binary.LittleEndian.Uint16(b[idx:]))) / math.MaxInt16
+			sum += v * v
+			n++
+		}
+	case avutil.AV_SAMPLE_FMT_FLT:
+		for idx := 0; idx+3 < len(b); idx += 4 {
+			v := float64(math.Float32frombits(binary.LittleEndian.Uint32(b[idx:])))
+			sum += v * v
+			n++
+		}
+	}
+
+	// No samples or only zeros
+	if n == 0 || sum == 0 {
+		return math.Inf(-1)
+	}
+	return 10 * math.Log10(sum/float64(n))
+}
+
+// WriteWAV writes the chunk to the writer in the WAV format
+func (c SilenceChunk) WriteWAV(w io.Writer) (err error) {
+	// Get format
+	var format, bps uint16
+	switch c.SampleFormat {
+	case avutil.AV_SAMPLE_FMT_S16:
+		format, bps = 1, 2
+	case avutil.AV_SAMPLE_FMT_FLT:
+		format, bps = 3, 4
+	default:
+		err = fmt.Errorf("astilibav: sample format %d is not supported", c.SampleFormat)
+		return
+	}
+
+	// Write header
+	for _, v := range []interface{}{
+		[]byte("RIFF"),
+		uint32(36 + len(c.Data)),
+		[]byte("WAVEfmt "),
+		uint32(16),
+		format,
+		uint16(c.Channels),
+		uint32(c.SampleRate),
+		uint32(c.SampleRate * c.Channels * int(bps)),
+		uint16(c.Channels * int(bps)),
+		bps * 8,
+		[]byte("data"),
+		uint32(len(c.Data)),
+	} {
+		if err = binary.Write(w, binary.LittleEndian, v); err != nil {
+			err = fmt.Errorf("astilibav: writing wav header failed: %w", err)
+			return
+		}
+	}
+
+	// Write data
+	if _, err = w.Write(c.Data); err != nil {
+		err = fmt.Errorf("astilibav: writing wav data failed: %w", err)
+		return
+	}
+	return
+}
+
+// SilenceChunkWAVFile is a silence chunk handler that writes the chunk to a WAV file
+var SilenceChunkWAVFile = func(c SilenceChunk, args SilenceChunkerHandlerArgs) (err error) {
+	// Create file
+	var f *os.File
+	if f, err = os.Create(args.Pattern); err != nil {
+		err = fmt.Errorf("astilibav: creating file %s failed: %w", args.Pattern, err)
+		return
+	}
+	defer f.Close()
+
+	// Write wav
+	if err = c.WriteWAV(f); err != nil {
+		err = fmt.Errorf("astilibav: writing wav to file %s failed: %w", args.Pattern, err)
+		return
+	}
+	return
+}
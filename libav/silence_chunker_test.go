@@ -0,0 +1,31 @@
+package astilibav
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/asticode/goav/avutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSilenceChunkerLevel(t *testing.T) {
+	assert.True(t, math.IsInf(silenceChunkerLevel([]byte{0, 0, 0, 0}, avutil.AV_SAMPLE_FMT_S16), -1))
+	assert.InDelta(t, 0, silenceChunkerLevel([]byte{0xff, 0x7f, 0x01, 0x80}, avutil.AV_SAMPLE_FMT_S16), 0.001)
+	assert.InDelta(t, -6.02, silenceChunkerLevel([]byte{0, 0, 0, 0x3f}, avutil.AV_SAMPLE_FMT_FLT), 0.01)
+}
+
+func TestSilenceChunkWriteWAV(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := SilenceChunk{
+		Channels:     2,
+		Data:         []byte{1, 2, 3, 4},
+		SampleFormat: avutil.AV_SAMPLE_FMT_S16,
+		SampleRate:   16000,
+	}.WriteWAV(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{
+		'R', 'I', 'F', 'F', 40, 0, 0, 0, 'W', 'A', 'V', 'E', 'f', 'm', 't', ' ', 16, 0, 0, 0, 1, 0, 2, 0,
+		0x80, 0x3e, 0, 0, 0, 0xfa, 0, 0, 4, 0, 16, 0, 'd', 'a', 't', 'a', 4, 0, 0, 0, 1, 2, 3, 4,
+	}, buf.Bytes())
+}
@@ -0,0 +1,88 @@
+package astilibav
+
+import (
+	"context"
+	"fmt"
+	"image"
+
+	"github.com/asticode/goav/avutil"
+)
+
+type frameSnapshot struct {
+	err error
+	f   *avutil.Frame
+}
+
+// Snapshot captures the next frame dispatched to the handlers as an image
+// The dispatcher only references the frame, the image is created in the caller's goroutine so that the conversion
+// doesn't stall the node
+func (d *frameDispatcher) snapshot(ctx context.Context) (i image.Image, err error) {
+	// Add request
+	// Channel is buffered so that the dispatcher never blocks
+	ch := make(chan frameSnapshot, 1)
+	d.m.Lock()
+	d.snapshots = append(d.snapshots, ch)
+	d.m.Unlock()
+
+	// Wait
+	var s frameSnapshot
+	select {
+	case s = <-ch:
+	case <-ctx.Done():
+		// Remove request
+		var found bool
+		d.m.Lock()
+		for idx, v := range d.snapshots {
+			if v == ch {
+				d.snapshots = append(d.snapshots[:idx], d.snapshots[idx+1:]...)
+				found = true
+				break
+			}
+		}
+		d.m.Unlock()
+
+		// Request has already been taken by the dispatcher, which sends without blocking, therefore the frame must be
+		// received in order to be put back in the pool
+		if !found {
+			if s = <-ch; s.f != nil {
+				d.p.put(s.f)
+			}
+		}
+		err = ctx.Err()
+		return
+	}
+
+	// Copying the frame has failed
+	if s.err != nil {
+		err = s.err
+		return
+	}
+
+	// Make sure the frame is put back in the pool
+	defer d.p.put(s.f)
+
+	// Get image
+	var rgba *image.RGBA
+	if rgba, err = thumbnailImage(s.f, 0); err != nil {
+		err = fmt.Errorf("astilibav: getting image failed: %w", err)
+		return
+	}
+	i = rgba
+	return
+}
+
+func (d *frameDispatcher) sendSnapshots(f *avutil.Frame, ss []chan frameSnapshot) {
+	// Loop through requests
+	for _, ch := range ss {
+		// Copy frame
+		var s frameSnapshot
+		s.f = d.p.get()
+		if ret := defaultBindings.frameRef(s.f, f); ret < 0 {
+			d.p.put(s.f)
+			s = frameSnapshot{err: fmt.Errorf("astilibav: avutil.AvFrameRef failed: %w", NewAvError(ret))}
+		}
+
+		// Send frame
+		ch <- s
+	}
+}
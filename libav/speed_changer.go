@@ -0,0 +1,106 @@
+package astilibav
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+)
+
+var countSpeedChanger uint64
+
+// SpeedChanger represents an object capable of changing the playback speed of frames
+type SpeedChanger struct {
+	*Filterer
+	outputCtx Context
+}
+
+// SpeedChangerOptions represents speed changer options
+type SpeedChangerOptions struct {
+	// If provided, video frames are resampled to this frame rate after their speed has been changed
+	FrameRate avutil.Rational
+	Input     FiltererInput
+	Node      astiencoder.NodeOptions
+	Restamper FrameRestamper
+	// 2 means twice as fast, 0.5 means twice as slow
+	Speed float64
+}
+
+// NewSpeedChanger creates a new speed changer
+func NewSpeedChanger(o SpeedChangerOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (s *SpeedChanger, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countSpeedChanger, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("speed_changer_%d", count), fmt.Sprintf("Speed Changer #%d", count), fmt.Sprintf("Changes speed by %sx", strconv.FormatFloat(o.Speed, 'f', -1, 64)))
+
+	// Invalid speed
+	if o.Speed <= 0 {
+		err = fmt.Errorf("astilibav: speed %f is invalid", o.Speed)
+		return
+	}
+
+	// Create speed changer
+	s = &SpeedChanger{outputCtx: o.Input.Context}
+
+	// Create filters
+	var filters []string
+	switch o.Input.Context.CodecType {
+	case avutil.AVMEDIA_TYPE_AUDIO:
+		// Restamp
+		filters = append(filters, "asetpts=PTS-STARTPTS")
+
+		// Change tempo
+		filters = append(filters, speedChangerAtempoFilters(o.Speed)...)
+	case avutil.AVMEDIA_TYPE_VIDEO:
+		// Restamp
+		filters = append(filters, fmt.Sprintf("setpts=(PTS-STARTPTS)/%s", strconv.FormatFloat(o.Speed, 'f', -1, 64)))
+
+		// Update frame rate
+		if o.FrameRate.Num() > 0 && o.FrameRate.Den() > 0 {
+			filters = append(filters, fmt.Sprintf("fps=fps=%d/%d", o.FrameRate.Num(), o.FrameRate.Den()))
+			s.outputCtx.FrameRate = o.FrameRate
+		} else if f := o.Input.Context.FrameRate; f.Num() > 0 && f.Den() > 0 {
+			s.outputCtx.FrameRate = avutil.NewRational(int(math.Round(float64(f.Num())*o.Speed*1000)), f.Den()*1000)
+		}
+	default:
+		err = errors.New("astilibav: speed changer only handles audio and video")
+		return
+	}
+
+	// Create filterer
+	if s.Filterer, err = NewFilterer(FiltererOptions{
+		Content:   strings.Join(filters, ","),
+		Inputs:    map[string]FiltererInput{"in": o.Input},
+		Node:      o.Node,
+		Restamper: o.Restamper,
+	}, eh, c); err != nil {
+		err = fmt.Errorf("astilibav: creating filterer failed: %w", err)
+		return
+	}
+	return
+}
+
+// OutputCtx returns the context of the frames coming out of the speed changer
+// It should be used to create the next nodes, such as the encoder
+func (s *SpeedChanger) OutputCtx() Context {
+	return s.outputCtx
+}
+
+// atempo only accepts values between 0.5 and 2 therefore we need to chain several atempo filters
+func speedChangerAtempoFilters(speed float64) (fs []string) {
+	for speed > 2 {
+		fs = append(fs, "atempo=2")
+		speed /= 2
+	}
+	for speed < 0.5 {
+		fs = append(fs, "atempo=0.5")
+		speed /= 0.5
+	}
+	fs = append(fs, "atempo="+strconv.FormatFloat(speed, 'f', -1, 64))
+	return
+}
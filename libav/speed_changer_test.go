@@ -0,0 +1,14 @@
+package astilibav
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpeedChangerAtempoFilters(t *testing.T) {
+	assert.Equal(t, []string{"atempo=1.5"}, speedChangerAtempoFilters(1.5))
+	assert.Equal(t, []string{"atempo=2", "atempo=2"}, speedChangerAtempoFilters(4))
+	assert.Equal(t, []string{"atempo=2", "atempo=1.5"}, speedChangerAtempoFilters(3))
+	assert.Equal(t, []string{"atempo=0.5", "atempo=0.5"}, speedChangerAtempoFilters(0.25))
+}
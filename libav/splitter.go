@@ -0,0 +1,389 @@
+package astilibav
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+	"unsafe"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avformat"
+	"github.com/asticode/goav/avutil"
+)
+
+var countSplitter uint64
+
+// Splitter represents an object capable of muxing packets into several outputs, cutting them at specific cues
+type Splitter struct {
+	*astiencoder.BaseNode
+	c                *astikit.Chan
+	ctxFormat        *avformat.Context
+	count            int
+	cues             []SplitterCue
+	eh               *astiencoder.EventHandler
+	m                *sync.Mutex
+	o                SplitterOptions
+	refStreamIdx     *int
+	s                *splitterSegment
+	statIncomingRate *astikit.CounterAvgStat
+	statWorkRatio    *astikit.DurationPercentageStat
+	t                *template.Template
+}
+
+type splitterSegment struct {
+	cue SplitterCue
+	w   *segmentWriter
+}
+
+// SplitterCue represents a splitter cue
+type SplitterCue struct {
+	// Timestamp at which the segment starts
+	// The actual cut happens on the first keyframe of the reference stream whose timestamp is >= to this value
+	Start time.Duration
+	Title string
+}
+
+// SplitterCuesFromChapters creates splitter cues based on chapters
+func SplitterCuesFromChapters(cs []Chapter) (o []SplitterCue) {
+	for _, c := range cs {
+		o = append(o, SplitterCue{
+			Start: c.Start,
+			Title: c.Title,
+		})
+	}
+	return
+}
+
+// SplitterOptions represents splitter options
+type SplitterOptions struct {
+	Cues []SplitterCue
+	// Additional data available in the URL pattern
+	Data       map[string]interface{}
+	Format     *avformat.OutputFormat
+	FormatName string
+	Node       astiencoder.NodeOptions
+	// Template used to generate each segment URL. "count", "start" and "title" are available in addition to data
+	URLPattern string
+}
+
+// NewSplitter creates a new splitter
+func NewSplitter(o SplitterOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (s *Splitter, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countSplitter, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("splitter_%d", count), fmt.Sprintf("Splitter #%d", count), fmt.Sprintf("Splits to %s", o.URLPattern))
+
+	// Create splitter
+	s = &Splitter{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		cues:             append([]SplitterCue{}, o.Cues...),
+		eh:               eh,
+		m:                &sync.Mutex{},
+		o:                o,
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statWorkRatio:    astikit.NewDurationPercentageStat(),
+	}
+	s.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(s), eh)
+	s.addStats()
+
+	// Sort cues
+	sort.Slice(s.cues, func(i, j int) bool { return s.cues[i].Start < s.cues[j].Start })
+
+	// Make sure data is not nil
+	if s.o.Data == nil {
+		s.o.Data = make(map[string]interface{})
+	}
+
+	// Parse pattern
+	if len(o.URLPattern) == 0 {
+		err = errors.New("astilibav: no url pattern provided")
+		return
+	}
+	if s.t, err = template.New("").Parse(o.URLPattern); err != nil {
+		err = fmt.Errorf("astilibav: parsing pattern %s as template failed: %w", o.URLPattern, err)
+		return
+	}
+
+	// Alloc format context
+	// This context is never opened and is only used as a template to store streams
+	// We need to create an intermediate variable to avoid "cgo argument has Go pointer to Go pointer" errors
+	var ctxFormat *avformat.Context
+	if ret := avformat.AvformatAllocOutputContext2(&ctxFormat, o.Format, o.FormatName, o.URLPattern); ret < 0 {
+		err = fmt.Errorf("astilibav: avformat.AvformatAllocOutputContext2 on %+v failed: %w", o, NewAvError(ret))
+		return
+	}
+	s.ctxFormat = ctxFormat
+
+	// Make sure the format ctx is properly closed
+	c.Add(func() error {
+		s.ctxFormat.AvformatFreeContext()
+		return nil
+	})
+
+	// Make sure the current segment is properly closed
+	c.Add(s.closeSegment)
+	return
+}
+
+func (s *Splitter) addStats() {
+	// Add incoming rate
+	s.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of packets coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "pps",
+	}, s.statIncomingRate)
+
+	// Add work ratio
+	s.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, s.statWorkRatio)
+
+	// Add chan stats
+	s.c.AddStats(s.Stater())
+}
+
+// CtxFormat returns the format ctx streams must be added to
+// It is only used as a template for every segment and is never written to
+func (s *Splitter) CtxFormat() *avformat.Context {
+	return s.ctxFormat
+}
+
+// AddCue adds a cue while the splitter is running
+func (s *Splitter) AddCue(c SplitterCue) {
+	// Lock
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	// Insert cue
+	idx := sort.Search(len(s.cues), func(i int) bool { return s.cues[i].Start > c.Start })
+	s.cues = append(s.cues[:idx], append([]SplitterCue{c}, s.cues[idx:]...)...)
+}
+
+// Start starts the splitter
+func (s *Splitter) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	s.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to close the current segment once everything is done
+		defer func() {
+			if err := s.closeSegment(); err != nil {
+				s.eh.Emit(astiencoder.EventError(s, fmt.Errorf("astilibav: closing segment failed: %w", err)))
+			}
+		}()
+
+		// Make sure to stop the chan properly
+		defer s.c.Stop()
+
+		// Start chan
+		s.c.Start(s.Context())
+	})
+}
+
+// SplitterPktHandler is an object that can handle a pkt for the splitter
+type SplitterPktHandler struct {
+	*Splitter
+	o *avformat.Stream
+}
+
+// NewPktHandler creates a new pkt handler for a stream of the splitter format ctx
+func (s *Splitter) NewPktHandler(o *avformat.Stream) *SplitterPktHandler {
+	return &SplitterPktHandler{
+		Splitter: s,
+		o:        o,
+	}
+}
+
+// HandlePkt implements the PktHandler interface
+func (h *SplitterPktHandler) HandlePkt(p *PktHandlerPayload) {
+	h.c.Add(func() {
+		// Handle pause
+		defer h.HandlePause()
+
+		// Increment incoming rate
+		h.statIncomingRate.Add(1)
+
+		// Handle segment
+		h.statWorkRatio.Begin()
+		if err := h.handleSegment(p, h.o); err != nil {
+			h.statWorkRatio.End()
+			h.eh.Emit(astiencoder.EventError(h, fmt.Errorf("astilibav: handling segment failed: %w", err)))
+			return
+		}
+		h.statWorkRatio.End()
+
+		// No segment
+		if h.s == nil {
+			return
+		}
+
+		// Rescale timestamps
+		so := h.s.w.ctxFormat.Streams()[h.o.Index()]
+		p.Pkt.AvPacketRescaleTs(p.Descriptor.TimeBase(), so.TimeBase())
+
+		// Set stream index
+		p.Pkt.SetStreamIndex(so.Index())
+
+		// Restamp
+		h.s.w.restamp(p.Pkt)
+
+		// Write frame
+		h.statWorkRatio.Begin()
+		if ret := h.s.w.ctxFormat.AvInterleavedWriteFrame((*avformat.Packet)(unsafe.Pointer(p.Pkt))); ret < 0 {
+			h.statWorkRatio.End()
+			emitAvError(h, h.eh, ret, "h.s.w.ctxFormat.AvInterleavedWriteFrame failed")
+			return
+		}
+		h.statWorkRatio.End()
+	})
+}
+
+func (s *Splitter) referenceStreamIndex() int {
+	// Index has already been computed
+	if s.refStreamIdx != nil {
+		return *s.refStreamIdx
+	}
+
+	// Compute index
+	idx := referenceStreamIndex(s.ctxFormat)
+	s.refStreamIdx = astikit.IntPtr(idx)
+	return idx
+}
+
+// referenceStreamIndex returns the index of the stream outputs are cut on
+func referenceStreamIndex(ctxFormat *avformat.Context) int {
+	// Video streams are preferred
+	for _, st := range ctxFormat.Streams() {
+		if st.CodecParameters().CodecType() == avutil.AVMEDIA_TYPE_VIDEO {
+			return st.Index()
+		}
+	}
+	return 0
+}
+
+func (s *Splitter) handleSegment(p *PktHandlerPayload, o *avformat.Stream) (err error) {
+	// Segments can only be cut on keyframes of the reference stream
+	if o.Index() != s.referenceStreamIndex() || p.Pkt.Flags()&avcodec.AV_PKT_FLAG_KEY == 0 {
+		return
+	}
+
+	// Get the last cue the pkt has reached
+	pts := time.Duration(avutil.AvRescaleQ(p.Pkt.Pts(), p.Descriptor.TimeBase(), nanosecondRational))
+	var cue *SplitterCue
+	s.m.Lock()
+	for len(s.cues) > 0 && s.cues[0].Start <= pts {
+		c := s.cues[0]
+		cue = &c
+		s.cues = s.cues[1:]
+	}
+	s.m.Unlock()
+
+	// A segment is already opened and no cue has been reached
+	if s.s != nil && cue == nil {
+		return
+	}
+
+	// Close previous segment
+	if err = s.closeSegment(); err != nil {
+		err = fmt.Errorf("astilibav: closing segment failed: %w", err)
+		return
+	}
+
+	// The first segment starts with the first keyframe
+	if cue == nil {
+		cue = &SplitterCue{Start: pts}
+	}
+
+	// Open next segment
+	if err = s.openSegment(*cue); err != nil {
+		err = fmt.Errorf("astilibav: opening segment failed: %w", err)
+		return
+	}
+	return
+}
+
+func (s *Splitter) openSegment(cue SplitterCue) (err error) {
+	// Increment count
+	s.count++
+
+	// Create data
+	s.o.Data["count"] = s.count
+	s.o.Data["start"] = cue.Start
+	s.o.Data["title"] = cue.Title
+
+	// Execute template
+	buf := &bytes.Buffer{}
+	if err = s.t.Execute(buf, s.o.Data); err != nil {
+		err = fmt.Errorf("astilibav: executing template %s with data %+v failed: %w", s.o.URLPattern, s.o.Data, err)
+		return
+	}
+
+	// Create segment
+	sg := &splitterSegment{cue: cue}
+	url := buf.String()
+	if sg.w, err = newSegmentWriter(s.o.Format, s.o.FormatName, url); err != nil {
+		err = fmt.Errorf("astilibav: creating segment writer failed: %w", err)
+		return
+	}
+
+	// Make sure the segment is freed in case of error
+	defer func() {
+		if err != nil {
+			sg.w.close()
+		}
+	}()
+
+	// Copy streams
+	for _, i := range s.ctxFormat.Streams() {
+		o := AddStream(sg.w.ctxFormat)
+		if ret := avcodec.AvcodecParametersCopy(o.CodecParameters(), i.CodecParameters()); ret < 0 {
+			err = fmt.Errorf("astilibav: avcodec.AvcodecParametersCopy from %+v to %+v failed: %w", i.CodecParameters(), o.CodecParameters(), NewAvError(ret))
+			return
+		}
+		o.SetTimeBase(i.TimeBase())
+	}
+
+	// Open
+	if err = sg.w.open(); err != nil {
+		err = fmt.Errorf("astilibav: opening segment writer failed: %w", err)
+		return
+	}
+
+	// Store segment
+	s.s = sg
+	return
+}
+
+func (s *Splitter) closeSegment() (err error) {
+	// No segment
+	if s.s == nil {
+		return
+	}
+
+	// Reset segment
+	sg := s.s
+	s.s = nil
+
+	// Close
+	if _, err = sg.w.close(); err != nil {
+		err = fmt.Errorf("astilibav: closing segment writer failed: %w", err)
+		return
+	}
+
+	// Send event
+	s.eh.Emit(astiencoder.Event{
+		Name:    EventNameSplitterSegmentDone,
+		Payload: sg.w.url,
+		Target:  s,
+	})
+	return
+}
@@ -0,0 +1,199 @@
+package astilibav
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/asticode/go-astiencoder"
+)
+
+// StallWatchdog represents an object capable of detecting nodes that haven't processed their pending input
+// within a deadline
+// A node is considered stalled when its parents have been waiting for it for too long while it is not waiting
+// for its own children, which means it is stuck doing its own work
+type StallWatchdog struct {
+	eh       *astiencoder.EventHandler
+	o        StallWatchdogOptions
+	reported map[string]bool
+}
+
+// StallWatchdogOptions represents stall watchdog options
+type StallWatchdogOptions struct {
+	// Defaults to 30s
+	Deadline time.Duration
+	// Defaults to 1s
+	Period time.Duration
+	// If true, an error event is emitted and stalled nodes are stopped
+	StopStalledNodes bool
+}
+
+// StalledNode represents a stalled node
+type StalledNode struct {
+	// Longest duration parents have been waiting for the node
+	Duration time.Duration
+	// Stack traces of all goroutines when the stall was detected
+	Goroutines string
+	Node       astiencoder.Node
+	Queues     []StalledNodeQueue
+	// Parents waiting for the node
+	Upstream []astiencoder.Node
+}
+
+// StalledNodeQueue represents the state of a node waiting for its children when the stall was detected
+type StalledNodeQueue struct {
+	Duration time.Duration
+	Node     astiencoder.Node
+	Pending  []astiencoder.Node
+}
+
+// NewStallWatchdog creates a new stall watchdog
+func NewStallWatchdog(o StallWatchdogOptions, eh *astiencoder.EventHandler) *StallWatchdog {
+	// Default values
+	if o.Deadline <= 0 {
+		o.Deadline = 30 * time.Second
+	}
+	if o.Period <= 0 {
+		o.Period = time.Second
+	}
+
+	// Create watchdog
+	return &StallWatchdog{
+		eh:       eh,
+		o:        o,
+		reported: make(map[string]bool),
+	}
+}
+
+// Start starts the watchdog. It is blocking until the context is done
+func (w *StallWatchdog) Start(ctx context.Context) {
+	// Create ticker
+	t := time.NewTicker(w.o.Period)
+	defer t.Stop()
+
+	// Loop
+	for {
+		select {
+		case n := <-t.C:
+			w.check(n)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (w *StallWatchdog) check(now time.Time) {
+	// Get stalled nodes
+	ws := backpressureWaits()
+	ss := stalledNodes(ws, now, w.o.Deadline)
+
+	// Forget nodes that are not stalled anymore
+	stalled := make(map[string]bool)
+	for _, s := range ss {
+		stalled[s.Node.Metadata().Name] = true
+	}
+	for name := range w.reported {
+		if !stalled[name] {
+			delete(w.reported, name)
+		}
+	}
+
+	// Loop through stalled nodes
+	var goroutines string
+	for _, s := range ss {
+		// Already reported
+		name := s.Node.Metadata().Name
+		if w.reported[name] {
+			continue
+		}
+		w.reported[name] = true
+
+		// Dump goroutines only once per check
+		if goroutines == "" {
+			goroutines = stallWatchdogGoroutines()
+		}
+		s.Goroutines = goroutines
+
+		// Send event
+		w.eh.Emit(astiencoder.Event{
+			Name:    EventNameStallWatchdogNodeStalled,
+			Payload: s,
+			Target:  s.Node,
+		})
+
+		// Stop node
+		if w.o.StopStalledNodes {
+			w.eh.Emit(astiencoder.EventError(s.Node, fmt.Errorf("astilibav: node %s has been stalled for %s", name, s.Duration)))
+			s.Node.Stop()
+		}
+	}
+}
+
+// stalledNodes returns the nodes that parents have been waiting for at least the deadline and that are not
+// waiting themselves
+func stalledNodes(ws []backpressureWait, now time.Time, deadline time.Duration) (ss []StalledNode) {
+	// Index waiting nodes and build queues
+	var qs []StalledNodeQueue
+	waiting := make(map[string]bool)
+	for _, w := range ws {
+		waiting[w.n.Metadata().Name] = true
+		qs = append(qs, StalledNodeQueue{
+			Duration: now.Sub(w.since),
+			Node:     w.n,
+			Pending:  w.pending,
+		})
+	}
+
+	// Loop through waiting nodes
+	is := make(map[string]int)
+	for _, w := range ws {
+		// Deadline has not been reached
+		d := now.Sub(w.since)
+		if d < deadline {
+			continue
+		}
+
+		// Loop through pending children
+		for _, p := range w.pending {
+			// Child is waiting as well
+			name := p.Metadata().Name
+			if waiting[name] {
+				continue
+			}
+
+			// Create stalled node
+			i, ok := is[name]
+			if !ok {
+				i = len(ss)
+				is[name] = i
+				ss = append(ss, StalledNode{
+					Node:   p,
+					Queues: qs,
+				})
+			}
+
+			// Update stalled node
+			if d > ss[i].Duration {
+				ss[i].Duration = d
+			}
+			ss[i].Upstream = append(ss[i].Upstream, w.n)
+		}
+	}
+
+	// Sort
+	sort.Slice(ss, func(i, j int) bool { return ss[i].Node.Metadata().Name < ss[j].Node.Metadata().Name })
+	return
+}
+
+func stallWatchdogGoroutines() string {
+	b := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(b, true)
+		if n < len(b) || len(b) >= 1<<24 {
+			return string(b[:n])
+		}
+		b = make([]byte, 2*len(b))
+	}
+}
@@ -0,0 +1,26 @@
+package astilibav
+
+import (
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStalledNodes(t *testing.T) {
+	demuxer, decoder1, decoder2, encoder := newMockedNode("demuxer"), newMockedNode("decoder1"), newMockedNode("decoder2"), newMockedNode("encoder")
+	n := time.Unix(100, 0)
+	ws := []backpressureWait{
+		{n: decoder1, pending: []astiencoder.Node{encoder}, since: n.Add(-40 * time.Second)},
+		{n: decoder2, pending: []astiencoder.Node{encoder}, since: n.Add(-35 * time.Second)},
+		{n: demuxer, pending: []astiencoder.Node{decoder1, decoder2}, since: n.Add(-45 * time.Second)},
+	}
+	ss := stalledNodes(ws, n, 30*time.Second)
+	assert.Equal(t, 1, len(ss))
+	assert.Equal(t, encoder, ss[0].Node)
+	assert.Equal(t, 40*time.Second, ss[0].Duration)
+	assert.Equal(t, []astiencoder.Node{decoder1, decoder2}, ss[0].Upstream)
+	assert.Equal(t, 3, len(ss[0].Queues))
+	assert.Equal(t, 0, len(stalledNodes(ws, n, time.Minute)))
+}
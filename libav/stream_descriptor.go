@@ -0,0 +1,88 @@
+package astilibav
+
+//#cgo pkg-config: libavcodec libavfilter libavformat libavutil
+//#include "compat.h"
+import "C"
+import (
+	"unsafe"
+
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avfilter"
+	"github.com/asticode/goav/avformat"
+	"github.com/asticode/goav/avutil"
+)
+
+// NewStreamDescriptor creates a new stream descriptor
+func NewStreamDescriptor(s *avformat.Stream) StreamDescriptor {
+	// Loop through side data
+	var cn C.int
+	csd := C.astilibav_stream_side_data((*C.struct_AVStream)(unsafe.Pointer(s)), &cn)
+	var sideData []string
+	if n := int(cn); n > 0 {
+		for _, sd := range (*[1 << 10]C.AVPacketSideData)(unsafe.Pointer(csd))[:n:n] {
+			sideData = append(sideData, C.GoString(C.av_packet_side_data_name(sd._type)))
+		}
+	}
+	return newStreamDescriptor(NewContextFromStream(s), s.Index(), sideData)
+}
+
+// newBufferSinkStreamDescriptor creates a stream descriptor based on the buffersink output
+func newBufferSinkStreamDescriptor(bufferSinkCtx *avfilter.Context, prev Descriptor) StreamDescriptor {
+	// Get previous stream descriptor
+	c := (*C.AVFilterContext)(unsafe.Pointer(bufferSinkCtx))
+	psd, _ := DescriptorStream(prev)
+
+	// Create context
+	ctx := Context{
+		CodecType: avcodec.MediaType(C.av_buffersink_get_type(c)),
+		TimeBase:  newRationalFromC(C.av_buffersink_get_time_base(c)),
+	}
+	switch ctx.CodecType {
+	case avutil.AVMEDIA_TYPE_AUDIO:
+		ctx.ChannelLayout = uint64(C.astilibav_buffersink_channel_layout(c))
+		ctx.Channels = int(C.av_buffersink_get_channels(c))
+		ctx.SampleFmt = avcodec.AvSampleFormat(C.av_buffersink_get_format(c))
+		ctx.SampleRate = int(C.av_buffersink_get_sample_rate(c))
+	case avutil.AVMEDIA_TYPE_VIDEO:
+		ctx.FrameRate = newRationalFromC(C.av_buffersink_get_frame_rate(c))
+		ctx.Height = int(C.av_buffersink_get_h(c))
+		ctx.PixelFormat = avutil.PixelFormat(C.av_buffersink_get_format(c))
+		ctx.SampleAspectRatio = newRationalFromC(C.av_buffersink_get_sample_aspect_ratio(c))
+		ctx.Width = int(C.av_buffersink_get_w(c))
+	}
+	return newStreamDescriptor(ctx, psd.Index(), psd.SideData())
+}
+
+// newEncoderStreamDescriptor creates a stream descriptor based on the encoder codec ctx
+func newEncoderStreamDescriptor(ctxCodec *avcodec.Context, prev Descriptor) StreamDescriptor {
+	// Get previous stream descriptor
+	psd, _ := DescriptorStream(prev)
+
+	// Create context
+	ctx := Context{
+		BitRate:   ctxCodec.BitRate(),
+		CodecID:   ctxCodec.CodecId(),
+		CodecType: ctxCodec.CodecType(),
+		TimeBase:  ctxCodec.TimeBase(),
+	}
+	switch ctx.CodecType {
+	case avutil.AVMEDIA_TYPE_AUDIO:
+		ctx.ChannelLayout = ctxCodec.ChannelLayout()
+		ctx.Channels = ctxCodec.Channels()
+		ctx.SampleFmt = ctxCodec.SampleFmt()
+		ctx.SampleRate = ctxCodec.SampleRate()
+	case avutil.AVMEDIA_TYPE_VIDEO:
+		ctx.FrameRate = ctxCodec.Framerate()
+		ctx.GopSize = ctxCodec.GopSize()
+		ctx.ColorPrimaries, ctx.ColorRange, ctx.ColorSpace, ctx.ColorTransfer = encoderColors(ctxCodec)
+		ctx.Height = ctxCodec.Height()
+		ctx.PixelFormat = ctxCodec.PixFmt()
+		ctx.SampleAspectRatio = ctxCodec.SampleAspectRatio()
+		ctx.Width = ctxCodec.Width()
+	}
+	return newStreamDescriptor(ctx, psd.Index(), psd.SideData())
+}
+
+func newRationalFromC(r C.AVRational) avutil.Rational {
+	return avutil.NewRational(int(r.num), int(r.den))
+}
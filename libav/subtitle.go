@@ -0,0 +1,266 @@
+package astilibav
+
+//#cgo pkg-config: libavcodec libavformat
+//#include <libavcodec/avcodec.h>
+//#include <libavformat/avformat.h>
+import "C"
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avformat"
+)
+
+var subtitleASSTagsRegexp = regexp.MustCompile(`\{[^}]*\}`)
+
+// Subtitle represents a decoded subtitle
+// Contrary to frames, it doesn't hold any libav memory and can be shared freely, but it must be considered as immutable
+// since it's shared between handlers
+type Subtitle struct {
+	// 0 means the subtitle is displayed until the next one starts. A subtitle without rects usually clears the previous
+	// one, for instance with DVB subtitles
+	Duration time.Duration
+	Rects    []SubtitleRect
+	// Based on the pts of the pkt, which means it's on the same timeline as the other streams of the input
+	Start time.Duration
+}
+
+// SubtitleRect represents a subtitle rect, which contains either a bitmap or some text
+type SubtitleRect struct {
+	// ASS dialogue event as provided by the decoder. Only set for text rects
+	ASS string
+	// Only set for bitmap rects, in which case the position and the size are in the subtitles canvas
+	Height int
+	// Straight alpha RGBA pixels, row by row. Only set for bitmap rects
+	RGBA []byte
+	// Plain text without ASS tags, lines being separated with "\n". Only set for text rects
+	Text  string
+	Width int
+	X     int
+	Y     int
+}
+
+// SubtitleHandler represents a node that can handle a subtitle
+type SubtitleHandler interface {
+	astiencoder.Node
+	HandleSubtitle(p *SubtitleHandlerPayload)
+}
+
+// SubtitleHandlerConnector represents an object that can connect/disconnect with a subtitle handler
+type SubtitleHandlerConnector interface {
+	Connect(next SubtitleHandler)
+	Disconnect(next SubtitleHandler)
+}
+
+// SubtitleHandlerPayload represents a SubtitleHandler payload
+type SubtitleHandlerPayload struct {
+	Descriptor Descriptor
+	// May be nil if the subtitle has not been created by a node attaching metadata
+	Metadata *UnitMetadata
+	Node     astiencoder.Node
+	Subtitle *Subtitle
+}
+
+type subtitleDispatcher struct {
+	bp           *backpressureTracker
+	hs           map[string]SubtitleHandler
+	m            *sync.Mutex
+	n            astiencoder.Node
+	statDispatch *astikit.DurationPercentageStat
+	wg           *sync.WaitGroup
+}
+
+func newSubtitleDispatcher(n astiencoder.Node, eh *astiencoder.EventHandler) *subtitleDispatcher {
+	return &subtitleDispatcher{
+		bp:           newBackpressureTracker(n, eh),
+		hs:           make(map[string]SubtitleHandler),
+		m:            &sync.Mutex{},
+		n:            n,
+		statDispatch: astikit.NewDurationPercentageStat(),
+		wg:           &sync.WaitGroup{},
+	}
+}
+
+func (d *subtitleDispatcher) addHandler(h SubtitleHandler) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	d.hs[h.Metadata().Name] = h
+}
+
+func (d *subtitleDispatcher) delHandler(h SubtitleHandler) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	delete(d.hs, h.Metadata().Name)
+}
+
+func (d *subtitleDispatcher) dispatch(s *Subtitle, descriptor Descriptor, m *UnitMetadata) {
+	// Copy handlers
+	d.m.Lock()
+	var hs []SubtitleHandler
+	for _, h := range d.hs {
+		hs = append(hs, h)
+	}
+	d.m.Unlock()
+
+	// No handlers
+	if len(hs) == 0 {
+		return
+	}
+
+	// Wait for all previous subprocesses to be done so that subtitles are handled in order
+	d.statDispatch.Begin()
+	d.wait()
+	d.statDispatch.End()
+
+	// Add subprocesses
+	d.wg.Add(len(hs))
+
+	// Loop through handlers
+	for _, h := range hs {
+		// Keep track of pending handlers
+		d.bp.add(h)
+
+		// Handle subtitle
+		go func(h SubtitleHandler) {
+			defer d.wg.Done()
+			defer d.bp.done(h)
+			h.HandleSubtitle(&SubtitleHandlerPayload{
+				Descriptor: descriptor,
+				Metadata:   m,
+				Node:       d.n,
+				Subtitle:   s,
+			})
+		}(h)
+	}
+}
+
+func (d *subtitleDispatcher) wait() {
+	d.bp.wait(d.wg)
+}
+
+func (d *subtitleDispatcher) addStats(s *astikit.Stater) {
+	// Add wait time
+	s.AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent waiting for first child to finish processing dispatched subtitle",
+		Label:       "Dispatch ratio",
+		Unit:        "%",
+	}, d.statDispatch)
+}
+
+// newSubtitleFromC converts an AVSubtitle, start being the time of its pkt
+func newSubtitleFromC(cs *C.AVSubtitle, start, pktDuration time.Duration) (s *Subtitle) {
+	// Create subtitle
+	s = &Subtitle{Start: start + time.Duration(cs.start_display_time)*time.Millisecond}
+
+	// Get duration
+	// End display time is sometimes set to UINT32_MAX when it's unknown
+	if cs.end_display_time > cs.start_display_time && cs.end_display_time != C.UINT32_MAX {
+		s.Duration = time.Duration(cs.end_display_time-cs.start_display_time) * time.Millisecond
+	} else if pktDuration > 0 {
+		s.Duration = pktDuration
+	}
+
+	// Loop through rects
+	rs := (*[1 << 16]*C.AVSubtitleRect)(unsafe.Pointer(cs.rects))[:cs.num_rects:cs.num_rects]
+	for _, r := range rs {
+		switch r._type {
+		case C.SUBTITLE_BITMAP:
+			s.Rects = append(s.Rects, SubtitleRect{
+				Height: int(r.h),
+				RGBA:   subtitleBitmapRGBA(r),
+				Width:  int(r.w),
+				X:      int(r.x),
+				Y:      int(r.y),
+			})
+		case C.SUBTITLE_TEXT:
+			s.Rects = append(s.Rects, SubtitleRect{Text: C.GoString(r.text)})
+		case C.SUBTITLE_ASS:
+			ass := C.GoString(r.ass)
+			s.Rects = append(s.Rects, SubtitleRect{
+				ASS:  ass,
+				Text: subtitleASSText(ass),
+			})
+		}
+	}
+	return
+}
+
+// subtitleBitmapRGBA converts the paletted bitmap of a rect to RGBA
+func subtitleBitmapRGBA(r *C.AVSubtitleRect) []byte {
+	// No bitmap
+	w, h := int(r.w), int(r.h)
+	if w <= 0 || h <= 0 || r.data[0] == nil || r.data[1] == nil {
+		return nil
+	}
+
+	// Palette is AV_PIX_FMT_RGB32, which is native endian ARGB
+	n := int(r.nb_colors)
+	if n <= 0 || n > 256 {
+		n = 256
+	}
+	ps := (*[256]uint32)(unsafe.Pointer(r.data[1]))[:n:n]
+
+	// Loop through pixels
+	ls := int(r.linesize[0])
+	is := (*[1 << 30]byte)(unsafe.Pointer(r.data[0]))[: ls*h : ls*h]
+	b := make([]byte, 0, w*h*4)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var p uint32
+			if i := int(is[y*ls+x]); i < n {
+				p = ps[i]
+			}
+			b = append(b, byte(p>>16), byte(p>>8), byte(p), byte(p>>24))
+		}
+	}
+	return b
+}
+
+// subtitleASSText returns the plain text of an ASS dialogue event, which is either a "Dialogue:" line or the event
+// without its timings as provided by libavcodec since ffmpeg 3.0
+func subtitleASSText(ass string) string {
+	// Get text
+	// It's the last field and may contain commas
+	n := 9
+	if strings.HasPrefix(ass, "Dialogue:") {
+		n = 10
+	}
+	fs := strings.SplitN(strings.TrimRight(ass, "\r\n"), ",", n)
+	if len(fs) < n {
+		return ""
+	}
+	t := fs[n-1]
+
+	// Remove tags and convert line breaks
+	t = subtitleASSTagsRegexp.ReplaceAllString(t, "")
+	t = strings.NewReplacer(`\N`, "\n", `\n`, "\n", `\h`, " ").Replace(t)
+	return t
+}
+
+// CloneSubtitleStream clones a text subtitle stream, such as SRT, ASS or mov_text, and adds it to the format ctx so that
+// its pkts can be muxed without being transcoded
+// It fails if the codec is not a text one or if the muxer doesn't support it, for instance SRT in mp4, which requires
+// mov_text
+func CloneSubtitleStream(i *avformat.Stream, ctxFormat *avformat.Context) (o *avformat.Stream, err error) {
+	// Check codec
+	id := C.enum_AVCodecID(i.CodecParameters().CodecId())
+	if d := C.avcodec_descriptor_get(id); d == nil || d._type != C.AVMEDIA_TYPE_SUBTITLE || d.props&C.AV_CODEC_PROP_TEXT_SUB == 0 {
+		err = errors.New("astilibav: stream is not a text subtitle stream")
+		return
+	}
+
+	// Check muxer
+	cf := (*C.AVFormatContext)(unsafe.Pointer(ctxFormat))
+	if cf.oformat != nil && C.avformat_query_codec(cf.oformat, id, C.FF_COMPLIANCE_NORMAL) != 1 {
+		err = fmt.Errorf("astilibav: muxer doesn't support codec %s", C.GoString(C.avcodec_get_name(id)))
+		return
+	}
+	return CloneStream(i, ctxFormat)
+}
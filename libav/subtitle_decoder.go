@@ -0,0 +1,201 @@
+package astilibav
+
+//#cgo pkg-config: libavcodec libavfilter libavformat libavutil
+//#include <libavcodec/avcodec.h>
+//#include "compat.h"
+import "C"
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avutil"
+)
+
+var countSubtitleDecoder uint64
+
+// SubtitleDecoder represents an object capable of decoding subtitle packets
+// Subtitles don't go through frames, they are dispatched to subtitle handlers, such as the subtitle renderer
+type SubtitleDecoder struct {
+	*astiencoder.BaseNode
+	c                *astikit.Chan
+	ctxCodec         *avcodec.Context
+	d                *subtitleDispatcher
+	eh               *astiencoder.EventHandler
+	statIncomingRate *astikit.CounterAvgStat
+	statWorkRatio    *astikit.DurationPercentageStat
+}
+
+// SubtitleDecoderOptions represents subtitle decoder options
+type SubtitleDecoderOptions struct {
+	CodecParams *avcodec.CodecParameters
+	Node        astiencoder.NodeOptions
+}
+
+// NewSubtitleDecoder creates a new subtitle decoder
+func NewSubtitleDecoder(o SubtitleDecoderOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (d *SubtitleDecoder, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countSubtitleDecoder, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("subtitle_decoder_%d", count), fmt.Sprintf("Subtitle Decoder #%d", count), "Decodes subtitles")
+
+	// Check codec type
+	if o.CodecParams.CodecType() != avutil.AVMEDIA_TYPE_SUBTITLE {
+		err = fmt.Errorf("astilibav: codec type %v is not subtitle", o.CodecParams.CodecType())
+		return
+	}
+
+	// Create subtitle decoder
+	d = &SubtitleDecoder{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh:               eh,
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statWorkRatio:    astikit.NewDurationPercentageStat(),
+	}
+	d.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(d), eh)
+	d.d = newSubtitleDispatcher(d, eh)
+	d.addStats()
+
+	// Find decoder
+	var cdc *avcodec.Codec
+	if cdc = avcodec.AvcodecFindDecoder(o.CodecParams.CodecId()); cdc == nil {
+		err = fmt.Errorf("astilibav: no decoder found for codec id %+v", o.CodecParams.CodecId())
+		return
+	}
+
+	// Alloc context
+	if d.ctxCodec = cdc.AvcodecAllocContext3(); d.ctxCodec == nil {
+		err = fmt.Errorf("astilibav: no context allocated for codec %+v", cdc)
+		return
+	}
+
+	// Copy codec parameters
+	if ret := avcodec.AvcodecParametersToContext(d.ctxCodec, o.CodecParams); ret < 0 {
+		err = fmt.Errorf("astilibav: avcodec.AvcodecParametersToContext failed: %w", NewAvError(ret))
+		return
+	}
+
+	// Open codec
+	if ret := d.ctxCodec.AvcodecOpen2(cdc, nil); ret < 0 {
+		err = fmt.Errorf("astilibav: d.ctxCodec.AvcodecOpen2 failed: %w", NewAvError(ret))
+		return
+	}
+
+	// Make sure the codec is closed
+	c.Add(func() error {
+		if ret := d.ctxCodec.AvcodecClose(); ret < 0 {
+			emitAvError(nil, eh, ret, "d.ctxCodec.AvcodecClose failed")
+		}
+		return nil
+	})
+	return
+}
+
+func (d *SubtitleDecoder) addStats() {
+	// Add incoming rate
+	d.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of packets coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "pps",
+	}, d.statIncomingRate)
+
+	// Add work ratio
+	d.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, d.statWorkRatio)
+
+	// Add dispatcher stats
+	d.d.addStats(d.Stater())
+
+	// Add chan stats
+	d.c.AddStats(d.Stater())
+}
+
+// Connect implements the SubtitleHandlerConnector interface
+func (d *SubtitleDecoder) Connect(h SubtitleHandler) {
+	// Add handler
+	d.d.addHandler(h)
+
+	// Connect nodes
+	astiencoder.ConnectNodes(d, h)
+}
+
+// Disconnect implements the SubtitleHandlerConnector interface
+func (d *SubtitleDecoder) Disconnect(h SubtitleHandler) {
+	// Delete handler
+	d.d.delHandler(h)
+
+	// Disconnect nodes
+	astiencoder.DisconnectNodes(d, h)
+}
+
+// Start starts the subtitle decoder
+func (d *SubtitleDecoder) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	d.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to wait for all dispatcher subprocesses to be done so that they are properly closed
+		defer d.d.wait()
+
+		// Make sure to stop the chan properly
+		defer d.c.Stop()
+
+		// Start chan
+		d.c.Start(d.Context())
+	})
+}
+
+// HandlePkt implements the PktHandler interface
+func (d *SubtitleDecoder) HandlePkt(p *PktHandlerPayload) {
+	d.c.Add(func() {
+		// Handle pause
+		defer d.HandlePause()
+
+		// Increment incoming rate
+		d.statIncomingRate.Add(1)
+
+		// Decode
+		var cs C.AVSubtitle
+		var got C.int
+		d.statWorkRatio.Begin()
+		if ret := C.astilibav_decode_subtitle((*C.AVCodecContext)(unsafe.Pointer(d.ctxCodec)), &cs, &got, (*C.AVPacket)(unsafe.Pointer(p.Pkt))); ret < 0 {
+			d.statWorkRatio.End()
+			emitAvError(d, d.eh, int(ret), "astilibav_decode_subtitle failed")
+			return
+		}
+		d.statWorkRatio.End()
+
+		// No subtitle
+		if got == 0 {
+			return
+		}
+		defer C.avsubtitle_free(&cs)
+
+		// Get times
+		var start, duration time.Duration
+		if pts := p.Pkt.Pts(); pts != avutil.AV_NOPTS_VALUE && p.Descriptor != nil {
+			start = time.Duration(avutil.AvRescaleQ(pts, p.Descriptor.TimeBase(), nanosecondRational))
+		}
+		if p.Descriptor != nil && p.Pkt.Duration() > 0 {
+			duration = time.Duration(avutil.AvRescaleQ(p.Pkt.Duration(), p.Descriptor.TimeBase(), nanosecondRational))
+		}
+
+		// Dispatch subtitle
+		d.d.dispatch(newSubtitleFromC(&cs, start, duration), p.Descriptor, p.Metadata)
+	})
+}
+
+// HandleEOS implements the EOSHandler interface
+func (d *SubtitleDecoder) HandleEOS(p *EOSHandlerPayload) {
+	d.c.Add(func() {
+		// Forward end of stream
+		d.d.dispatchEOS()
+	})
+}
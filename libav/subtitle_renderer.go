@@ -0,0 +1,232 @@
+package astilibav
+
+//#cgo pkg-config: libavutil
+//#include <errno.h>
+//#include <libavutil/error.h>
+//#include <libavutil/frame.h>
+//static int astilibav_subtitle_renderer_blend(AVFrame *f, const uint8_t *rgba, int x, int y, int w, int h) {
+//	if (f->format != AV_PIX_FMT_YUV420P && f->format != AV_PIX_FMT_YUVJ420P) return AVERROR(ENOSYS);
+//	for (int j = 0; j < h; j++) {
+//		int py = y + j;
+//		if (py < 0 || py >= f->height) continue;
+//		for (int i = 0; i < w; i++) {
+//			int px = x + i;
+//			if (px < 0 || px >= f->width) continue;
+//			const uint8_t *p = rgba + (j * w + i) * 4;
+//			int r = p[0], g = p[1], b = p[2], a = p[3];
+//			if (!a) continue;
+//			// BT.601 limited range
+//			uint8_t *d = f->data[0] + py * f->linesize[0] + px;
+//			*d = (*d * (255 - a) + (((66 * r + 129 * g + 25 * b + 128) >> 8) + 16) * a) / 255;
+//			if (py & 1 || px & 1) continue;
+//			d = f->data[1] + (py / 2) * f->linesize[1] + px / 2;
+//			*d = (*d * (255 - a) + (((-38 * r - 74 * g + 112 * b + 128) >> 8) + 128) * a) / 255;
+//			d = f->data[2] + (py / 2) * f->linesize[2] + px / 2;
+//			*d = (*d * (255 - a) + (((112 * r - 94 * g - 18 * b + 128) >> 8) + 128) * a) / 255;
+//		}
+//	}
+//	return 0;
+//}
+import "C"
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+)
+
+var countSubtitleRenderer uint64
+
+// Frame metadata key the text is stored in before being rendered by drawtext
+const subtitleRendererMetadataKey = "astilibav.subtitle_renderer.text"
+
+// SubtitleRenderer represents an object capable of burning subtitles into video frames
+// It must be connected to both a subtitle handler connector, such as the subtitle decoder, and the video frame handler
+// connector of its input. Video frames are drawn with the subtitles displayed at their time
+// Text is rendered with drawtext and bitmaps are blended at their position, which assumes the video has the size of
+// the subtitles canvas. Bitmaps are only supported on yuv420p and yuvj420p video frames
+type SubtitleRenderer struct {
+	*Filterer
+	eh *astiencoder.EventHandler
+	m  *sync.Mutex // Locks q
+	p  *framePool
+	q  *subtitleRendererQueue
+}
+
+// SubtitleRendererOptions represents subtitle renderer options
+type SubtitleRendererOptions struct {
+	// Text is ignored. Text is centered at the bottom of the video by default
+	DrawText  FilterGraphDrawTextOptions
+	Input     FiltererInput
+	Node      astiencoder.NodeOptions
+	Restamper FrameRestamper
+}
+
+// NewSubtitleRenderer creates a new subtitle renderer
+func NewSubtitleRenderer(o SubtitleRendererOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (r *SubtitleRenderer, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countSubtitleRenderer, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("subtitle_renderer_%d", count), fmt.Sprintf("Subtitle Renderer #%d", count), "Renders subtitles")
+
+	// Check input
+	if o.Input.Context.CodecType != avutil.AVMEDIA_TYPE_VIDEO {
+		err = errors.New("astilibav: subtitle renderer only handles video")
+		return
+	}
+
+	// Create subtitle renderer
+	r = &SubtitleRenderer{
+		eh: eh,
+		m:  &sync.Mutex{},
+		p:  newFramePool(c),
+		q:  &subtitleRendererQueue{},
+	}
+
+	// Create content
+	// drawtext renders the text stored in the frame metadata
+	o.DrawText.Text = "%{metadata:" + subtitleRendererMetadataKey + "}"
+	if o.DrawText.X == "" {
+		o.DrawText.X = "(w-text_w)/2"
+	}
+	if o.DrawText.Y == "" {
+		o.DrawText.Y = "h-text_h-h/20"
+	}
+	var content string
+	if content, err = NewFilterGraph().DrawText(o.DrawText).Build(); err != nil {
+		err = fmt.Errorf("astilibav: building filter graph failed: %w", err)
+		return
+	}
+
+	// Create filterer
+	if r.Filterer, err = NewFilterer(FiltererOptions{
+		Content:   content,
+		Inputs:    map[string]FiltererInput{"in": o.Input},
+		Node:      o.Node,
+		Restamper: o.Restamper,
+	}, eh, c); err != nil {
+		err = fmt.Errorf("astilibav: creating filterer failed: %w", err)
+		return
+	}
+	return
+}
+
+// HandleSubtitle implements the SubtitleHandler interface
+func (r *SubtitleRenderer) HandleSubtitle(p *SubtitleHandlerPayload) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.q.add(p.Subtitle)
+}
+
+// HandleFrame implements the FrameHandler interface
+func (r *SubtitleRenderer) HandleFrame(p *FrameHandlerPayload) {
+	// Get active subtitles
+	var t time.Duration
+	if pts := p.Frame.Pts(); pts != avutil.AV_NOPTS_VALUE && p.Descriptor != nil {
+		t = time.Duration(avutil.AvRescaleQ(pts, p.Descriptor.TimeBase(), nanosecondRational))
+	}
+	r.m.Lock()
+	ss := r.q.active(t)
+	r.m.Unlock()
+
+	// Copy frame
+	// Frame metadata is not shared between references
+	f := r.p.get()
+	defer r.p.put(f)
+	if ret := defaultBindings.frameRef(f, p.Frame); ret < 0 {
+		emitAvError(r, r.eh, ret, "avutil.AvFrameRef failed")
+		return
+	}
+
+	// Loop through rects
+	var lines []string
+	var writable bool
+	for _, s := range ss {
+		for _, rect := range s.Rects {
+			// Text
+			if len(rect.RGBA) == 0 {
+				if rect.Text != "" {
+					lines = append(lines, rect.Text)
+				}
+				continue
+			}
+
+			// Since data is shared with the other handlers of the previous node, it must be copied before being updated
+			if !writable {
+				if ret := avutil.AvFrameMakeWritable(f); ret < 0 {
+					emitAvError(r, r.eh, ret, "avutil.AvFrameMakeWritable failed")
+					return
+				}
+				writable = true
+			}
+
+			// Blend bitmap
+			if len(rect.RGBA) < rect.Width*rect.Height*4 {
+				continue
+			}
+			if ret := C.astilibav_subtitle_renderer_blend((*C.AVFrame)(unsafe.Pointer(f)), (*C.uint8_t)(unsafe.Pointer(&rect.RGBA[0])), C.int(rect.X), C.int(rect.Y), C.int(rect.Width), C.int(rect.Height)); ret < 0 {
+				emitAvError(r, r.eh, int(ret), "astilibav_subtitle_renderer_blend failed")
+				return
+			}
+		}
+	}
+
+	// Store text
+	if err := frameSetMetadata(f, subtitleRendererMetadataKey, strings.Join(lines, "\n")); err != nil {
+		r.eh.Emit(astiencoder.EventError(r, fmt.Errorf("astilibav: setting frame metadata failed: %w", err)))
+		return
+	}
+
+	// Filter frame
+	// It blocks until the frame has been pushed in the graph, therefore it can be put back in the pool afterwards
+	r.Filterer.HandleFrame(&FrameHandlerPayload{
+		Descriptor: p.Descriptor,
+		Frame:      f,
+		Metadata:   p.Metadata,
+		Node:       p.Node,
+	})
+}
+
+// subtitleRendererQueue keeps track of subtitles ordered by start
+type subtitleRendererQueue struct {
+	ss []*Subtitle
+}
+
+func (q *subtitleRendererQueue) add(s *Subtitle) {
+	idx := sort.Search(len(q.ss), func(i int) bool { return q.ss[i].Start > s.Start })
+	q.ss = append(q.ss, nil)
+	copy(q.ss[idx+1:], q.ss[idx:])
+	q.ss[idx] = s
+}
+
+// active returns the subtitles displayed at the provided time and removes the ones that have ended
+func (q *subtitleRendererQueue) active(t time.Duration) (as []*Subtitle) {
+	var ss []*Subtitle
+	for idx, s := range q.ss {
+		// Subtitles without duration end when the next one starts
+		var ended bool
+		if s.Duration > 0 {
+			ended = t >= s.Start+s.Duration
+		} else if idx+1 < len(q.ss) {
+			ended = t >= q.ss[idx+1].Start
+		}
+		if ended {
+			continue
+		}
+		ss = append(ss, s)
+
+		// Subtitle has started
+		if s.Start <= t && len(s.Rects) > 0 {
+			as = append(as, s)
+		}
+	}
+	q.ss = ss
+	return
+}
@@ -0,0 +1,32 @@
+package astilibav
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubtitleASSText(t *testing.T) {
+	assert.Equal(t, "Hello\nworld", subtitleASSText(`0,0,Default,,0,0,0,,{\i1}Hello{\i0}\Nworld`))
+	assert.Equal(t, "a, b c", subtitleASSText("Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,a, b\\hc\r\n"))
+	assert.Equal(t, "", subtitleASSText("invalid"))
+}
+
+func TestSubtitleRendererQueue(t *testing.T) {
+	q := &subtitleRendererQueue{}
+	s1 := &Subtitle{Duration: 2 * time.Second, Rects: []SubtitleRect{{Text: "1"}}, Start: time.Second}
+	s2 := &Subtitle{Rects: []SubtitleRect{{Text: "2"}}, Start: 4 * time.Second}
+	s3 := &Subtitle{Start: 6 * time.Second}
+	q.add(s3)
+	q.add(s1)
+	q.add(s2)
+	assert.Equal(t, []*Subtitle{s1, s2, s3}, q.ss)
+	assert.Empty(t, q.active(0))
+	assert.Equal(t, []*Subtitle{s1}, q.active(2*time.Second))
+	assert.Empty(t, q.active(3*time.Second))
+	assert.Equal(t, []*Subtitle{s2, s3}, q.ss)
+	assert.Equal(t, []*Subtitle{s2}, q.active(5*time.Second))
+	assert.Empty(t, q.active(7*time.Second))
+	assert.Equal(t, []*Subtitle{s3}, q.ss)
+}
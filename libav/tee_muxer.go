@@ -0,0 +1,415 @@
+package astilibav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avformat"
+)
+
+var countTeeMuxer uint64
+
+// Tee muxer on fail policies
+const (
+	// When an output fails, the other outputs keep being written to. The tee muxer only stops once all outputs have
+	// failed
+	TeeMuxerOnFailIgnore = ""
+	// When an output fails, the tee muxer stops
+	TeeMuxerOnFailAbort = "abort"
+)
+
+// TeeMuxer represents an object capable of muxing packets into several outputs at once, such as a file, an RTMP
+// server and an HLS playlist
+// Outputs are isolated from each other: each output has its own bounded queue and writes its pkts in its own chan, so
+// that a stalled output drops pkts according to the drop policy instead of blocking the other ones. When an output
+// fails, either because its header can't be written or because it has reached its max number of write errors, an
+// event is sent and the on fail policy applies
+// Outputs whose options have Reconnect set reconnect instead of failing after a write error
+type TeeMuxer struct {
+	*astiencoder.BaseNode
+	c                *astikit.Chan
+	eh               *astiencoder.EventHandler
+	o                TeeMuxerOptions
+	os               []*teeMuxerOutput
+	p                *pktPool
+	statDropRate     *astikit.CounterAvgStat
+	statIncomingRate *astikit.CounterAvgStat
+}
+
+// TeeMuxerOptions represents tee muxer options
+type TeeMuxerOptions struct {
+	// Possible values are "newest", "non.keyframes" and "oldest". Defaults to "non.keyframes"
+	DropPolicy string
+	// Max number of pkts queued per output before the drop policy applies. Defaults to 100
+	MaxQueuedPkts int
+	// Number of consecutive write errors after which an output is considered as failed. Defaults to 1
+	MaxWriteErrors int
+	Node           astiencoder.NodeOptions
+	// Possible values are "" and "abort". See constants with the pattern TeeMuxerOnFail*
+	OnFail string
+	// Node options of the outputs are ignored
+	Outputs []MuxerOptions
+}
+
+type teeMuxerOutput struct {
+	c *astikit.Chan
+	// Locked by m
+	failed bool
+	m      *sync.Mutex
+	mx     *Muxer
+	q      *muxerDropQueue
+	// Only used in c
+	writeErrors int
+}
+
+type teeMuxerItem struct {
+	i *pktQueueItem
+	o *teeMuxerOutput
+}
+
+func (o *teeMuxerOutput) isFailed() bool {
+	o.m.Lock()
+	defer o.m.Unlock()
+	return o.failed
+}
+
+// TeeMuxerOutputFailure represents a tee muxer output failure
+type TeeMuxerOutputFailure struct {
+	Err error
+	URL string
+}
+
+// NewTeeMuxer creates a new tee muxer
+func NewTeeMuxer(o TeeMuxerOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (t *TeeMuxer, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countTeeMuxer, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("tee_muxer_%d", count), fmt.Sprintf("Tee Muxer #%d", count), fmt.Sprintf("Muxes to %d outputs", len(o.Outputs)))
+
+	// No outputs
+	if len(o.Outputs) == 0 {
+		err = errors.New("astilibav: no outputs provided")
+		return
+	}
+
+	// Default values
+	if o.DropPolicy == MuxerDropPolicyNone {
+		o.DropPolicy = MuxerDropPolicyNonKeyframes
+	}
+	if o.MaxWriteErrors <= 0 {
+		o.MaxWriteErrors = 1
+	}
+
+	// Create tee muxer
+	t = &TeeMuxer{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh:               eh,
+		o:                o,
+		p:                newPktPool(c),
+		statDropRate:     astikit.NewCounterAvgStat(),
+		statIncomingRate: astikit.NewCounterAvgStat(),
+	}
+	t.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(t), eh)
+	t.addStats()
+
+	// Loop through outputs
+	for _, mo := range o.Outputs {
+		// Create muxer
+		var m *Muxer
+		if m, err = NewMuxer(mo, eh, c); err != nil {
+			err = fmt.Errorf("astilibav: creating muxer for %s failed: %w", mo.URL, err)
+			return
+		}
+
+		// Create output
+		to := &teeMuxerOutput{
+			c: astikit.NewChan(astikit.ChanOptions{
+				AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+				ProcessAll:  true,
+			}),
+			m:  &sync.Mutex{},
+			mx: m,
+			q: newMuxerDropQueue(MuxerPktHandlerOptions{
+				DropPolicy:    o.DropPolicy,
+				MaxQueuedPkts: o.MaxQueuedPkts,
+			}),
+		}
+
+		// Reconnector is executed in the output chan, and failing to reconnect makes the output fail
+		if m.r != nil {
+			m.r.add = to.c.Add
+			m.r.fail = func(err error) { to.c.Add(func() { t.fail(to, err) }) }
+		}
+
+		// Append output
+		t.os = append(t.os, to)
+	}
+	return
+}
+
+func (t *TeeMuxer) addStats() {
+	// Add drop rate
+	t.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of packets dropped per second, all outputs included",
+		Label:       "Drop rate",
+		Unit:        "pps",
+	}, t.statDropRate)
+
+	// Add incoming rate
+	t.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of packets coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "pps",
+	}, t.statIncomingRate)
+
+	// Add chan stats
+	t.c.AddStats(t.Stater())
+}
+
+// Muxers returns the muxers of the outputs, in the same order as the options
+func (t *TeeMuxer) Muxers() (ms []*Muxer) {
+	for _, o := range t.os {
+		ms = append(ms, o.mx)
+	}
+	return
+}
+
+// Start starts the tee muxer
+func (t *TeeMuxer) Start(ctx context.Context, tc astiencoder.CreateTaskFunc) {
+	t.BaseNode.Start(ctx, tc, func(task *astikit.Task) {
+		// Write headers
+		for _, o := range t.os {
+			// Output has failed
+			if o.isFailed() {
+				continue
+			}
+
+			// Write header
+			if ret := o.mx.writeHeader(); ret < 0 {
+				t.fail(o, fmt.Errorf("astilibav: writing header failed: %w", NewAvError(ret)))
+			}
+		}
+
+		// Tee muxer has been stopped since outputs have failed
+		if t.Context().Err() != nil {
+			return
+		}
+
+		// Make sure to wait for the outputs and the reconnection loops to be done
+		defer task.Wait()
+
+		// Queued pkts are written once the tee muxer chan is done, and only then are the output chans stopped
+		done := make(chan bool)
+		defer close(done)
+
+		// Make sure to stop the chan properly
+		defer t.c.Stop()
+
+		// Loop through outputs
+		for _, o := range t.os {
+			// Reconnection loops are executed in sub tasks
+			if o.mx.r != nil {
+				o.mx.r.setTask(t.Context(), task)
+			}
+
+			// Output chans are not started with the node context since they must process queued pkts after it's done
+			oCtx, oCancel := context.WithCancel(context.Background())
+			o := o
+
+			// Start output chan
+			task.NewSubTask().Do(func() { o.c.Start(oCtx) })
+
+			// Write queued pkts
+			task.NewSubTask().Do(func() {
+				defer oCancel()
+				t.drainQueue(o, done)
+			})
+		}
+
+		// Start chan
+		t.c.Start(t.Context())
+	})
+}
+
+// drainQueue is executed in a sub task and writes the queued pkts of the output in its chan until done is closed
+func (t *TeeMuxer) drainQueue(o *teeMuxerOutput, done chan bool) {
+	for {
+		// Wait for pkts
+		var stop bool
+		select {
+		case <-o.q.signal:
+		case <-done:
+			stop = true
+		}
+
+		// Write queued pkts
+		for {
+			// Pop
+			o.q.m.Lock()
+			i := o.q.b.pop()
+			o.q.m.Unlock()
+			if i == nil {
+				break
+			}
+
+			// Write pkt
+			// Adding to the chan blocks until the func has been executed
+			o.c.Add(func() { t.write(o, i) })
+			t.p.put(i.pkt)
+		}
+
+		// Check stop
+		if stop {
+			return
+		}
+	}
+}
+
+// write is executed in the output chan
+func (t *TeeMuxer) write(o *teeMuxerOutput, i *pktQueueItem) {
+	// Output has failed
+	if o.isFailed() {
+		return
+	}
+
+	// Output is reconnecting
+	if o.mx.r != nil && o.mx.r.buffer(i.pkt, i.d, i.stream) {
+		return
+	}
+
+	// Write pkt
+	ret := o.mx.writePkt(i.pkt, i.d, o.mx.ctxFormat.Streams()[i.stream])
+	if ret < 0 {
+		// Reconnect
+		if o.mx.r != nil {
+			emitAvError(t, t.eh, ret, "o.mx.ctxFormat.AvInterleavedWriteFrame failed")
+			o.mx.r.start()
+			return
+		}
+
+		// Max number of write errors has been reached
+		if o.writeErrors++; o.writeErrors >= t.o.MaxWriteErrors {
+			t.fail(o, fmt.Errorf("astilibav: writing pkt failed: %w", NewAvError(ret)))
+		}
+		return
+	}
+	o.writeErrors = 0
+}
+
+func (t *TeeMuxer) fail(o *teeMuxerOutput, err error) {
+	// Update output
+	o.m.Lock()
+	if o.failed {
+		o.m.Unlock()
+		return
+	}
+	o.failed = true
+	o.m.Unlock()
+
+	// Send event
+	t.eh.Emit(astiencoder.Event{
+		Name: EventNameTeeMuxerOutputFailed,
+		Payload: TeeMuxerOutputFailure{
+			Err: err,
+			URL: o.mx.opts.URL,
+		},
+		Target: t,
+	})
+
+	// Abort
+	if t.o.OnFail == TeeMuxerOnFailAbort {
+		t.eh.Emit(astiencoder.EventError(t, fmt.Errorf("astilibav: output %s has failed, stopping", o.mx.opts.URL)))
+		t.Stop()
+		return
+	}
+
+	// Some outputs have not failed
+	for _, v := range t.os {
+		if !v.isFailed() {
+			return
+		}
+	}
+
+	// All outputs have failed
+	t.eh.Emit(astiencoder.EventError(t, errors.New("astilibav: all outputs have failed")))
+	t.Stop()
+}
+
+// TeeMuxerPktHandler is an object that can handle a pkt for the tee muxer
+type TeeMuxerPktHandler struct {
+	*TeeMuxer
+	// Streams are retrieved through their index since they're replaced after a reconnection
+	idxs []int
+}
+
+// AddStream adds a stream to each output and returns the handler writing pkts to them
+// The callback is executed once per output muxer, and is usually a call to Encoder.AddStream or CloneStream
+func (t *TeeMuxer) AddStream(fn func(m *Muxer) (*avformat.Stream, error)) (h *TeeMuxerPktHandler, err error) {
+	// Create handler
+	h = &TeeMuxerPktHandler{TeeMuxer: t}
+
+	// Loop through outputs
+	for _, o := range t.os {
+		// Add stream
+		var s *avformat.Stream
+		if s, err = fn(o.mx); err != nil {
+			err = fmt.Errorf("astilibav: adding stream to %s failed: %w", o.mx.opts.URL, err)
+			return
+		}
+
+		// Append stream
+		h.idxs = append(h.idxs, s.Index())
+	}
+	return
+}
+
+// HandlePkt implements the PktHandler interface
+func (h *TeeMuxerPktHandler) HandlePkt(p *PktHandlerPayload) {
+	h.c.Add(func() {
+		// Handle pause
+		defer h.HandlePause()
+
+		// Increment incoming rate
+		h.statIncomingRate.Add(1)
+
+		// Loop through outputs
+		for idx, o := range h.os {
+			// Output has failed
+			if o.isFailed() {
+				continue
+			}
+
+			// Copy pkt since it's written asynchronously
+			pkt := h.p.get()
+			if ret := defaultBindings.pktRef(pkt, p.Pkt); ret < 0 {
+				emitAvError(h, h.eh, ret, "pkt.AvPacketRef failed")
+				h.p.put(pkt)
+				continue
+			}
+
+			// Set the output stream index so that the queue keeps track of it
+			pkt.SetStreamIndex(h.idxs[idx])
+
+			// Push
+			o.q.m.Lock()
+			for _, i := range o.q.b.push(newPktQueueItem(pkt, p)) {
+				h.statDropRate.Add(1)
+				h.p.put(i.pkt)
+			}
+			o.q.m.Unlock()
+
+			// Signal
+			select {
+			case o.q.signal <- true:
+			default:
+			}
+		}
+	})
+}
@@ -0,0 +1,219 @@
+package astilibav
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+)
+
+var countTextBurner uint64
+
+// Frame metadata key the text is stored in before being rendered by drawtext
+const textBurnerMetadataKey = "astilibav.text_burner.text"
+
+// TextBurner represents an object capable of burning text onto video frames, the text being updated for each frame
+// The text is the result of a template executed with TextBurnerData, for instance
+// "{{ .Timecode }} - {{ .WallClock.Format \"15:04:05.000\" }} - {{ index .Stats \"encoder_1\" \"Work ratio\" }}",
+// which helps debugging latency and A/V sync
+type TextBurner struct {
+	*Filterer
+	count int
+	data  map[string]interface{}
+	eh    *astiencoder.EventHandler
+	m     *sync.Mutex // Locks stats
+	o     TextBurnerOptions
+	p     *framePool
+	stats map[string]map[string]interface{}
+	t     *template.Template
+}
+
+// TextBurnerOptions represents text burner options
+type TextBurnerOptions struct {
+	// Custom data available in the template
+	Data map[string]interface{}
+	// Text is ignored
+	DrawText  FilterGraphDrawTextOptions
+	Input     FiltererInput
+	Node      astiencoder.NodeOptions
+	Pattern   string
+	Restamper FrameRestamper
+	// Nodes whose last stats are available in the template
+	StatsNodes []astiencoder.Node
+}
+
+// TextBurnerData represents the data the pattern of a text burner is executed with
+type TextBurnerData struct {
+	Data map[string]interface{}
+	// Number of frames handled so far, starting at 1
+	Frame    int
+	Metadata *UnitMetadata
+	Pts      int64
+	// Last stats values indexed by node name, as in the node metadata (e.g. "encoder_1"), and stat label
+	Stats map[string]map[string]interface{}
+	// Pts converted to a duration
+	Time time.Duration
+	// HH:MM:SS:FF if the input has a frame rate, HH:MM:SS.mmm otherwise
+	Timecode  string
+	WallClock time.Time
+}
+
+// NewTextBurner creates a new text burner
+func NewTextBurner(o TextBurnerOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (b *TextBurner, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countTextBurner, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("text_burner_%d", count), fmt.Sprintf("Text Burner #%d", count), "Burns text")
+
+	// Check input
+	if o.Input.Context.CodecType != avutil.AVMEDIA_TYPE_VIDEO {
+		err = errors.New("astilibav: text burner only handles video")
+		return
+	}
+
+	// Create text burner
+	b = &TextBurner{
+		data:  o.Data,
+		eh:    eh,
+		m:     &sync.Mutex{},
+		o:     o,
+		p:     newFramePool(c),
+		stats: make(map[string]map[string]interface{}),
+	}
+
+	// Parse pattern
+	if b.t, err = template.New("").Parse(o.Pattern); err != nil {
+		err = fmt.Errorf("astilibav: parsing pattern %s as template failed: %w", o.Pattern, err)
+		return
+	}
+
+	// Create content
+	// drawtext renders the text stored in the frame metadata
+	o.DrawText.Text = "%{metadata:" + textBurnerMetadataKey + "}"
+	var content string
+	if content, err = NewFilterGraph().DrawText(o.DrawText).Build(); err != nil {
+		err = fmt.Errorf("astilibav: building filter graph failed: %w", err)
+		return
+	}
+
+	// Create filterer
+	if b.Filterer, err = NewFilterer(FiltererOptions{
+		Content:   content,
+		Inputs:    map[string]FiltererInput{"in": o.Input},
+		Node:      o.Node,
+		Restamper: o.Restamper,
+	}, eh, c); err != nil {
+		err = fmt.Errorf("astilibav: creating filterer failed: %w", err)
+		return
+	}
+
+	// Keep track of stats
+	for _, n := range o.StatsNodes {
+		name := n.Metadata().Name
+		eh.Add(n, astiencoder.EventNameNodeStats, func(e astiencoder.Event) bool {
+			ss, ok := e.Payload.([]astiencoder.EventStat)
+			if !ok {
+				return false
+			}
+			vs := make(map[string]interface{})
+			for _, s := range ss {
+				vs[s.Label] = s.Value
+			}
+			b.m.Lock()
+			b.stats[name] = vs
+			b.m.Unlock()
+			return false
+		})
+	}
+	return
+}
+
+// HandleFrame implements the FrameHandler interface
+func (b *TextBurner) HandleFrame(p *FrameHandlerPayload) {
+	b.c.Add(func() { b.handleFrame(p) })
+}
+
+// handleFrame is executed in the filterer chan
+func (b *TextBurner) handleFrame(p *FrameHandlerPayload) {
+	// Execute template
+	b.count++
+	buf := &bytes.Buffer{}
+	if err := b.t.Execute(buf, b.newData(p)); err != nil {
+		b.eh.Emit(astiencoder.EventError(b, fmt.Errorf("astilibav: executing template %s failed: %w", b.o.Pattern, err)))
+		b.Filterer.handleFrame(p)
+		return
+	}
+
+	// Copy frame
+	// Frame metadata is not shared between references
+	f := b.p.get()
+	defer b.p.put(f)
+	if ret := defaultBindings.frameRef(f, p.Frame); ret < 0 {
+		emitAvError(b, b.eh, ret, "avutil.AvFrameRef failed")
+		return
+	}
+
+	// Store text
+	if err := frameSetMetadata(f, textBurnerMetadataKey, buf.String()); err != nil {
+		b.eh.Emit(astiencoder.EventError(b, fmt.Errorf("astilibav: setting frame metadata failed: %w", err)))
+		return
+	}
+
+	// Filter frame
+	// The frame is referenced by the graph, therefore it can be put back in the pool afterwards
+	b.Filterer.handleFrame(&FrameHandlerPayload{
+		Descriptor: p.Descriptor,
+		Frame:      f,
+		Metadata:   p.Metadata,
+		Node:       p.Node,
+	})
+}
+
+func (b *TextBurner) newData(p *FrameHandlerPayload) (d TextBurnerData) {
+	// Create data
+	d = TextBurnerData{
+		Data:      b.data,
+		Frame:     b.count,
+		Metadata:  p.Metadata,
+		Pts:       p.Frame.Pts(),
+		Stats:     make(map[string]map[string]interface{}),
+		WallClock: time.Now(),
+	}
+
+	// Get time
+	if d.Pts != avutil.AV_NOPTS_VALUE && p.Descriptor != nil {
+		d.Time = time.Duration(avutil.AvRescaleQ(d.Pts, p.Descriptor.TimeBase(), nanosecondRational))
+	}
+	fr := b.o.Input.Context.FrameRate
+	d.Timecode = textBurnerTimecode(d.Time, fr.Num(), fr.Den())
+
+	// Copy stats
+	b.m.Lock()
+	for k, v := range b.stats {
+		d.Stats[k] = v
+	}
+	b.m.Unlock()
+	return
+}
+
+func textBurnerTimecode(d time.Duration, frameRateNum, frameRateDen int) string {
+	// Negative
+	var sign string
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+	h, m, s := int(d/time.Hour), int(d/time.Minute%60), int(d/time.Second%60)
+
+	// No frame rate
+	if frameRateNum <= 0 || frameRateDen <= 0 {
+		return fmt.Sprintf("%s%02d:%02d:%02d.%03d", sign, h, m, s, int(d/time.Millisecond%1000))
+	}
+	return fmt.Sprintf("%s%02d:%02d:%02d:%02d", sign, h, m, s, int(int64(d%time.Second)*int64(frameRateNum)/(int64(frameRateDen)*int64(time.Second))))
+}
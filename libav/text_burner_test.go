@@ -0,0 +1,16 @@
+package astilibav
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTextBurnerTimecode(t *testing.T) {
+	d := time.Hour + 2*time.Minute + 3*time.Second + 520*time.Millisecond
+	assert.Equal(t, "01:02:03.520", textBurnerTimecode(d, 0, 0))
+	assert.Equal(t, "01:02:03:13", textBurnerTimecode(d, 25, 1))
+	assert.Equal(t, "01:02:03:15", textBurnerTimecode(d, 30000, 1001))
+	assert.Equal(t, "-00:00:01.000", textBurnerTimecode(-time.Second, 0, 0))
+}
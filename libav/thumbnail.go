@@ -0,0 +1,499 @@
+package astilibav
+
+//#cgo pkg-config: libavformat libavutil libswscale
+//#include <libavformat/avformat.h>
+//#include <libavutil/frame.h>
+//#include <libswscale/swscale.h>
+//static int astilibav_thumbnail_scale(AVFrame *f, uint8_t *dst, int w, int h) {
+//	struct SwsContext *c = sws_getContext(f->width, f->height, f->format, w, h, AV_PIX_FMT_RGBA, SWS_BICUBIC, NULL, NULL, NULL);
+//	if (!c) return AVERROR(EINVAL);
+//	uint8_t *d[4] = {dst, NULL, NULL, NULL};
+//	int l[4] = {w * 4, 0, 0, 0};
+//	int ret = sws_scale(c, (const uint8_t * const *)f->data, f->linesize, 0, f->height, d, l);
+//	sws_freeContext(c);
+//	return ret;
+//}
+import "C"
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avcodec"
+	"github.com/asticode/goav/avformat"
+	"github.com/asticode/goav/avutil"
+)
+
+// ThumbnailOptions represents thumbnail options
+type ThumbnailOptions struct {
+	// Timestamp of the thumbnail, relative to the beginning of the input
+	At time.Duration
+	// String content of the demuxer as you would use in ffmpeg
+	Dict string
+	// Options of the demuxer whose values can contain commas. Entries override the ones of Dict
+	Dictionary map[string]string
+	// JPEG quality between 1 and 100. Defaults to 75
+	Quality int
+	// If > 0, the thumbnail is scaled to this width and the aspect ratio is preserved. The thumbnail is never larger
+	// than the input
+	Width int
+}
+
+// Thumbnail seeks the first video stream of an input, decodes the first frame at or after the provided timestamp
+// and returns it as a JPEG
+// If the input ends before the timestamp, the last decoded frame is used
+func Thumbnail(url string, o ThumbnailOptions) (b []byte, err error) {
+	return ThumbnailWithContext(context.Background(), url, o)
+}
+
+// ThumbnailWithContext is the same as Thumbnail except that probing, seeking and decoding the input are interrupted
+// once the context is done
+func ThumbnailWithContext(ctx context.Context, url string, o ThumbnailOptions) (b []byte, err error) {
+	// Default values
+	if o.Quality <= 0 {
+		o.Quality = jpeg.DefaultQuality
+	}
+
+	// Create closer
+	c := astikit.NewCloser()
+	defer c.Close()
+
+	// Create demuxer
+	eh := astiencoder.NewEventHandler()
+	var d *Demuxer
+	if d, err = NewDemuxer(DemuxerOptions{
+		Dict:              o.Dict,
+		Dictionary:        o.Dictionary,
+		FindStreamInfoCtx: ctx,
+		URL:               url,
+	}, eh, c); err != nil {
+		err = fmt.Errorf("astilibav: creating demuxer failed: %w", err)
+		return
+	}
+
+	// Make sure reading is interrupted once the context is done
+	defer interruptDemuxer(ctx, d)()
+
+	// Get video stream
+	var s *avformat.Stream
+	for _, v := range d.ctxFormat.Streams() {
+		if v.CodecParameters().CodecType() == avutil.AVMEDIA_TYPE_VIDEO {
+			s = v
+			break
+		}
+	}
+	if s == nil {
+		err = errors.New("astilibav: no video stream found")
+		return
+	}
+
+	// Create decoder
+	var dc *Decoder
+	if dc, err = NewDecoder(DecoderOptions{CodecParams: s.CodecParameters()}, eh, c); err != nil {
+		err = fmt.Errorf("astilibav: creating decoder failed: %w", err)
+		return
+	}
+
+	// Get timestamp
+	ts := avutil.AvRescaleQ(int64(o.At), nanosecondRational, s.TimeBase())
+	if st := int64((*C.struct_AVStream)(unsafe.Pointer(s)).start_time); st != avutil.AV_NOPTS_VALUE {
+		ts += st
+	}
+
+	// Seek
+	if ret := d.ctxFormat.AvSeekFrame(s.Index(), ts, avformat.AVSEEK_FLAG_BACKWARD); ret < 0 {
+		err = fmt.Errorf("astilibav: ctxFormat.AvSeekFrame on %s with ts %d failed: %w", url, ts, NewAvError(ret))
+		return
+	}
+
+	// Decode frame
+	var f *avutil.Frame
+	if f, err = thumbnailFrame(d.ctxFormat, dc.ctxCodec, s.Index(), ts); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		err = fmt.Errorf("astilibav: decoding frame failed: %w", err)
+		return
+	}
+	defer defaultBindings.frameFree(f)
+
+	// Encode
+	if b, err = thumbnailJPEG(f, o.Width, o.Quality); err != nil {
+		err = fmt.Errorf("astilibav: encoding jpeg failed: %w", err)
+		return
+	}
+	return
+}
+
+func thumbnailFrame(ctxFormat *avformat.Context, ctxCodec *avcodec.Context, streamIndex int, ts int64) (f *avutil.Frame, err error) {
+	// Alloc pkt
+	pkt := defaultBindings.pktAlloc()
+	defer defaultBindings.pktFree(pkt)
+
+	// Alloc frames
+	// The last decoded frame is kept in case there's no frame after the timestamp
+	f, tmp := defaultBindings.frameAlloc(), defaultBindings.frameAlloc()
+	defer defaultBindings.frameFree(tmp)
+	var decoded, eof bool
+
+	// Loop
+	for {
+		// Read pkt
+		if !eof {
+			if ret := ctxFormat.AvReadFrame(pkt); ret < 0 {
+				if ret != avutil.AVERROR_EOF {
+					err = fmt.Errorf("astilibav: ctxFormat.AvReadFrame failed: %w", NewAvError(ret))
+					break
+				}
+				eof = true
+			} else if pkt.StreamIndex() != streamIndex {
+				defaultBindings.pktUnref(pkt)
+				continue
+			}
+		}
+
+		// Send pkt
+		// A nil pkt flushes the decoder
+		var ret int
+		if eof {
+			ret = avcodec.AvcodecSendPacket(ctxCodec, nil)
+		} else {
+			ret = avcodec.AvcodecSendPacket(ctxCodec, pkt)
+			defaultBindings.pktUnref(pkt)
+		}
+		if ret < 0 && ret != avutil.AVERROR_EOF {
+			err = fmt.Errorf("astilibav: avcodec.AvcodecSendPacket failed: %w", NewAvError(ret))
+			break
+		}
+
+		// Receive frames
+		for {
+			if ret = avcodec.AvcodecReceiveFrame(ctxCodec, tmp); ret < 0 {
+				if ret != avutil.AVERROR_EOF && ret != avutil.AVERROR_EAGAIN {
+					err = fmt.Errorf("astilibav: avcodec.AvcodecReceiveFrame failed: %w", NewAvError(ret))
+				}
+				break
+			}
+
+			// Keep frame
+			defaultBindings.frameUnref(f)
+			defaultBindings.frameMoveRef(f, tmp)
+			decoded = true
+
+			// Frame is at or after the timestamp
+			if pts := int64((*C.struct_AVFrame)(unsafe.Pointer(f)).best_effort_timestamp); pts == avutil.AV_NOPTS_VALUE || pts >= ts {
+				return
+			}
+		}
+
+		// Decoder is either in error or fully flushed
+		if err != nil || (eof && ret == avutil.AVERROR_EOF) {
+			break
+		}
+	}
+
+	// Use last decoded frame
+	if err == nil && !decoded {
+		err = errors.New("astilibav: no frame decoded")
+	}
+	if err != nil {
+		defaultBindings.frameFree(f)
+		f = nil
+	}
+	return
+}
+
+func thumbnailJPEG(f *avutil.Frame, width, quality int) (b []byte, err error) {
+	// Get image
+	var i *image.RGBA
+	if i, err = thumbnailImage(f, width); err != nil {
+		err = fmt.Errorf("astilibav: getting image failed: %w", err)
+		return
+	}
+
+	// Encode
+	buf := &bytes.Buffer{}
+	if err = jpeg.Encode(buf, i, &jpeg.Options{Quality: quality}); err != nil {
+		err = fmt.Errorf("astilibav: jpeg.Encode failed: %w", err)
+		return
+	}
+	return buf.Bytes(), nil
+}
+
+// thumbnailImage converts the video frame to RGBA. If width is > 0, it's scaled to this width and the aspect ratio
+// is preserved. Width is capped to the frame width so that the image can't be bigger than the frame
+func thumbnailImage(f *avutil.Frame, width int) (i *image.RGBA, err error) {
+	// Get size
+	w, h := f.Width(), f.Height()
+	if width > w {
+		width = w
+	}
+	if width > 0 && w > 0 {
+		w, h = width, h*width/w
+	}
+	if w <= 0 || h <= 0 {
+		err = fmt.Errorf("astilibav: invalid size %dx%d", w, h)
+		return
+	}
+
+	// Scale
+	i = image.NewRGBA(image.Rect(0, 0, w, h))
+	if ret := C.astilibav_thumbnail_scale((*C.struct_AVFrame)(unsafe.Pointer(f)), (*C.uint8_t)(unsafe.Pointer(&i.Pix[0])), C.int(w), C.int(h)); ret < 0 {
+		err = fmt.Errorf("astilibav: scaling failed: %w", NewAvError(int(ret)))
+		return
+	}
+	return
+}
+
+// interruptDemuxer makes sure the demuxer's blocking calls are interrupted once the context is done, until the
+// returned func is called
+func interruptDemuxer(ctx context.Context, d *Demuxer) func() {
+	*d.interruptRet = 0
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			*d.interruptRet = 1
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// HTTPInputPolicy represents the inputs that can be provided to http handlers
+// Nothing is allowed by default
+// Only the protocols of the resources opened by the input itself, such as the segments of a playlist or the files of
+// a concat input, are restricted as well, through the "protocol_whitelist" option. Their hosts are not
+type HTTPInputPolicy struct {
+	// Hosts network inputs are allowed to be read from, such as "cdn.example.com"
+	Hosts []string
+	// Protocols inputs are allowed to be read with, such as "https" or "file". Inputs without protocol are files.
+	// Local files are readable by the caller of the handler only if "file" is listed
+	Protocols []string
+}
+
+// Protocols the allowed protocols rely on, which must be whitelisted as well
+var httpInputPolicyProtocolDependencies = map[string][]string{
+	"http":  {"tcp"},
+	"https": {"tcp", "tls"},
+	"rtmp":  {"tcp"},
+	"rtmps": {"tcp", "tls"},
+	"rtp":   {"udp"},
+	"rtsp":  {"rtp", "tcp", "udp"},
+	"tls":   {"tcp"},
+}
+
+// Dictionary returns the demuxer options restricting the protocols of the resources opened by the input
+func (p HTTPInputPolicy) Dictionary() map[string]string {
+	// Get protocols
+	m := make(map[string]bool)
+	for _, v := range p.Protocols {
+		v = strings.ToLower(v)
+		m[v] = true
+		for _, d := range httpInputPolicyProtocolDependencies[v] {
+			m[d] = true
+		}
+	}
+
+	// Sort protocols
+	var ps []string
+	for v := range m {
+		ps = append(ps, v)
+	}
+	sort.Strings(ps)
+
+	// Nothing is allowed
+	// An empty whitelist allows everything, which is why a protocol that doesn't exist is used instead
+	if len(ps) == 0 {
+		ps = []string{"none"}
+	}
+	return map[string]string{"protocol_whitelist": strings.Join(ps, ",")}
+}
+
+// Check returns an error if the input is not allowed
+func (p HTTPInputPolicy) Check(input string) (err error) {
+	// Parse
+	var u *url.URL
+	if u, err = url.Parse(input); err != nil {
+		err = fmt.Errorf("astilibav: parsing %s failed: %w", input, err)
+		return
+	}
+
+	// Check protocol
+	protocol := strings.ToLower(u.Scheme)
+	if protocol == "" {
+		protocol = "file"
+	}
+	if !httpInputPolicyContains(p.Protocols, protocol) {
+		err = fmt.Errorf("astilibav: protocol %s is not allowed", protocol)
+		return
+	}
+
+	// Check host
+	if h := u.Hostname(); h != "" && !httpInputPolicyContains(p.Hosts, h) {
+		err = fmt.Errorf("astilibav: host %s is not allowed", h)
+		return
+	}
+	return
+}
+
+// HTTPOutputPolicy represents the outputs that can be provided to http handlers
+// Nothing is allowed by default
+type HTTPOutputPolicy struct {
+	// Files are written in this dir and must be provided as paths relative to it. If empty, no file is allowed
+	Dir string
+	// Hosts network outputs are allowed to be written to, such as "ingest.example.com"
+	Hosts []string
+	// Network protocols outputs are allowed to be written with, such as "rtmp" or "srt". Files are only allowed
+	// through Dir
+	Protocols []string
+}
+
+// Check returns the output that must be used, which, for files, is their path in the dir
+func (p HTTPOutputPolicy) Check(output string) (o string, err error) {
+	// Parse
+	var u *url.URL
+	if u, err = url.Parse(output); err != nil {
+		err = fmt.Errorf("astilibav: parsing %s failed: %w", output, err)
+		return
+	}
+
+	// File
+	protocol := strings.ToLower(u.Scheme)
+	if protocol == "" || protocol == "file" {
+		return clipHandlerOutput(p.Dir, output)
+	}
+
+	// Check protocol
+	if !httpInputPolicyContains(p.Protocols, protocol) {
+		err = fmt.Errorf("astilibav: protocol %s is not allowed", protocol)
+		return
+	}
+
+	// Check host
+	if h := u.Hostname(); h != "" && !httpInputPolicyContains(p.Hosts, h) {
+		err = fmt.Errorf("astilibav: host %s is not allowed", h)
+		return
+	}
+	o = output
+	return
+}
+
+func httpInputPolicyContains(vs []string, v string) bool {
+	for _, i := range vs {
+		if strings.EqualFold(i, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// ThumbnailHandlerOptions represents thumbnail handler options
+type ThumbnailHandlerOptions struct {
+	Inputs HTTPInputPolicy
+}
+
+// ThumbnailHandler returns an http handler writing the JPEG thumbnail of an input
+// It only accepts POST requests whose form values are "url", "at" as a duration such as "1m30s", "quality" and
+// "width". The url must be allowed by the input policy, and the thumbnail is cancelled if the request is
+func ThumbnailHandler(ho ThumbnailHandlerOptions, l astikit.StdLogger) http.Handler {
+	sl := astikit.AdaptStdLogger(l)
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		// Check method
+		if r.Method != http.MethodPost {
+			rw.Header().Set("Allow", http.MethodPost)
+			rw.Header().Set("Content-Type", "application/json")
+			astiencoder.WriteJSONError(sl, rw, http.StatusMethodNotAllowed, fmt.Errorf("astilibav: method %s is not allowed", r.Method))
+			return
+		}
+
+		// Parse form
+		if err := r.ParseForm(); err != nil {
+			rw.Header().Set("Content-Type", "application/json")
+			astiencoder.WriteJSONError(sl, rw, http.StatusBadRequest, fmt.Errorf("astilibav: parsing form failed: %w", err))
+			return
+		}
+
+		// Get options
+		u, o, err := newThumbnailOptionsFromQuery(r.Form)
+		if err != nil {
+			rw.Header().Set("Content-Type", "application/json")
+			astiencoder.WriteJSONError(sl, rw, http.StatusBadRequest, fmt.Errorf("astilibav: parsing form failed: %w", err))
+			return
+		}
+
+		// Check url
+		if err = ho.Inputs.Check(u); err != nil {
+			rw.Header().Set("Content-Type", "application/json")
+			astiencoder.WriteJSONError(sl, rw, http.StatusForbidden, fmt.Errorf("astilibav: checking url failed: %w", err))
+			return
+		}
+
+		// Make sure the resources opened by the input are allowed as well
+		o.Dictionary = ho.Inputs.Dictionary()
+
+		// Get thumbnail
+		var b []byte
+		if b, err = ThumbnailWithContext(r.Context(), u, o); err != nil {
+			rw.Header().Set("Content-Type", "application/json")
+			astiencoder.WriteJSONError(sl, rw, http.StatusInternalServerError, fmt.Errorf("astilibav: getting thumbnail of %s failed: %w", u, err))
+			return
+		}
+
+		// Write
+		rw.Header().Set("Content-Type", "image/jpeg")
+		if _, err = rw.Write(b); err != nil {
+			sl.Error(fmt.Errorf("astilibav: writing thumbnail failed: %w", err))
+			return
+		}
+	})
+}
+
+func newThumbnailOptionsFromQuery(q url.Values) (u string, o ThumbnailOptions, err error) {
+	// Get url
+	if u = q.Get("url"); u == "" {
+		err = errors.New("astilibav: no url provided")
+		return
+	}
+
+	// Get timestamp
+	if v := q.Get("at"); v != "" {
+		if o.At, err = time.ParseDuration(v); err != nil {
+			err = fmt.Errorf("astilibav: parsing at %s failed: %w", v, err)
+			return
+		}
+	}
+
+	// Get quality
+	if v := q.Get("quality"); v != "" {
+		if o.Quality, err = strconv.Atoi(v); err != nil {
+			err = fmt.Errorf("astilibav: parsing quality %s failed: %w", v, err)
+			return
+		}
+		if o.Quality < 1 || o.Quality > 100 {
+			err = fmt.Errorf("astilibav: quality %d is not between 1 and 100", o.Quality)
+			return
+		}
+	}
+
+	// Get width
+	if v := q.Get("width"); v != "" {
+		if o.Width, err = strconv.Atoi(v); err != nil {
+			err = fmt.Errorf("astilibav: parsing width %s failed: %w", v, err)
+			return
+		}
+	}
+	return
+}
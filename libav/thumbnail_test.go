@@ -0,0 +1,75 @@
+package astilibav
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewThumbnailOptionsFromQuery(t *testing.T) {
+	_, _, err := newThumbnailOptionsFromQuery(url.Values{})
+	assert.Error(t, err)
+	_, _, err = newThumbnailOptionsFromQuery(url.Values{"url": []string{"u"}, "at": []string{"invalid"}})
+	assert.Error(t, err)
+	_, _, err = newThumbnailOptionsFromQuery(url.Values{"url": []string{"u"}, "quality": []string{"101"}})
+	assert.Error(t, err)
+	u, o, err := newThumbnailOptionsFromQuery(url.Values{
+		"at":      []string{"1m30s"},
+		"quality": []string{"90"},
+		"url":     []string{"u"},
+		"width":   []string{"320"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "u", u)
+	assert.Equal(t, ThumbnailOptions{
+		At:      90 * time.Second,
+		Quality: 90,
+		Width:   320,
+	}, o)
+}
+
+func TestHTTPInputPolicy(t *testing.T) {
+	p := HTTPInputPolicy{}
+	assert.Error(t, p.Check("/tmp/input.mp4"))
+	assert.Error(t, p.Check("https://cdn.example.com/input.mp4"))
+	p = HTTPInputPolicy{
+		Hosts:     []string{"cdn.example.com"},
+		Protocols: []string{"https"},
+	}
+	assert.NoError(t, p.Check("https://cdn.example.com/input.mp4"))
+	assert.NoError(t, p.Check("HTTPS://CDN.example.com:443/input.mp4"))
+	assert.Error(t, p.Check("http://cdn.example.com/input.mp4"))
+	assert.Error(t, p.Check("https://169.254.169.254/latest/meta-data"))
+	assert.Error(t, p.Check("/etc/passwd"))
+	assert.Error(t, p.Check("file:///etc/passwd"))
+	p.Protocols = append(p.Protocols, "file")
+	assert.NoError(t, p.Check("/tmp/input.mp4"))
+	assert.NoError(t, p.Check("file:///tmp/input.mp4"))
+	assert.Equal(t, map[string]string{"protocol_whitelist": "file,https,tcp,tls"}, p.Dictionary())
+	assert.Equal(t, map[string]string{"protocol_whitelist": "none"}, HTTPInputPolicy{}.Dictionary())
+}
+
+func TestHTTPOutputPolicy(t *testing.T) {
+	p := HTTPOutputPolicy{}
+	_, err := p.Check("o.ts")
+	assert.Error(t, err)
+	_, err = p.Check("rtmp://ingest.example.com/live")
+	assert.Error(t, err)
+	p = HTTPOutputPolicy{
+		Dir:       "/outputs",
+		Hosts:     []string{"ingest.example.com"},
+		Protocols: []string{"rtmp"},
+	}
+	o, err := p.Check("a/o.ts")
+	assert.NoError(t, err)
+	assert.Equal(t, "/outputs/a/o.ts", o)
+	o, err = p.Check("rtmp://ingest.example.com/live")
+	assert.NoError(t, err)
+	assert.Equal(t, "rtmp://ingest.example.com/live", o)
+	for _, v := range []string{"/etc/o.ts", "../o.ts", "file:///etc/o.ts", "rtmp://other.example.com/live", "srt://ingest.example.com:9000"} {
+		_, err = p.Check(v)
+		assert.Error(t, err, v)
+	}
+}
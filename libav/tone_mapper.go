@@ -0,0 +1,107 @@
+package astilibav
+
+//#cgo pkg-config: libavutil
+//#include <libavutil/pixdesc.h>
+import "C"
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+)
+
+var countToneMapper uint64
+
+// ToneMapper represents an object capable of converting HDR10 or HLG video frames to SDR BT.709 video frames
+// It relies on the zscale filter, which means ffmpeg must have been built with libzimg
+// HDR side data is removed from outgoing frames so that encoders don't signal it
+type ToneMapper struct {
+	*Filterer
+	outputCtx Context
+}
+
+// ToneMapperOptions represents tone mapper options
+type ToneMapperOptions struct {
+	// Possible values are "clip", "gamma", "hable", "linear", "mobius" and "reinhard". Defaults to "hable"
+	Algorithm string
+	Input     FiltererInput
+	Node      astiencoder.NodeOptions
+	// Luminance in cd/m² SDR white is mapped to. Defaults to 100
+	PeakLuminance int
+	// Defaults to yuv420p
+	PixelFormat *avutil.PixelFormat
+	Restamper   FrameRestamper
+}
+
+// NewToneMapper creates a new tone mapper
+func NewToneMapper(o ToneMapperOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (m *ToneMapper, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countToneMapper, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("tone_mapper_%d", count), fmt.Sprintf("Tone Mapper #%d", count), "Maps tones")
+
+	// Check input
+	if o.Input.Context.CodecType != avutil.AVMEDIA_TYPE_VIDEO {
+		err = errors.New("astilibav: tone mapper only handles video")
+		return
+	}
+
+	// Get algorithm
+	switch o.Algorithm {
+	case "":
+		o.Algorithm = "hable"
+	case "clip", "gamma", "hable", "linear", "mobius", "reinhard":
+	default:
+		err = fmt.Errorf("astilibav: invalid algorithm %s", o.Algorithm)
+		return
+	}
+
+	// Default values
+	if o.PeakLuminance <= 0 {
+		o.PeakLuminance = 100
+	}
+	pixFmt := avutil.PixelFormat(C.AV_PIX_FMT_YUV420P)
+	if o.PixelFormat != nil {
+		pixFmt = *o.PixelFormat
+	}
+
+	// Get pixel format
+	d := C.av_pix_fmt_desc_get(C.enum_AVPixelFormat(pixFmt))
+	if d == nil {
+		err = fmt.Errorf("astilibav: invalid pixel format %d", pixFmt)
+		return
+	}
+
+	// Create tone mapper
+	m = &ToneMapper{outputCtx: o.Input.Context}
+	m.outputCtx.BitDepth = int(d.comp[0].depth)
+	m.outputCtx.ColorPrimaries = int(C.AVCOL_PRI_BT709)
+	m.outputCtx.ColorRange = int(C.AVCOL_RANGE_MPEG)
+	m.outputCtx.ColorSpace = int(C.AVCOL_SPC_BT709)
+	m.outputCtx.ColorTransfer = int(C.AVCOL_TRC_BT709)
+	m.outputCtx.ContentLightLevel = nil
+	m.outputCtx.MasteringDisplay = nil
+	m.outputCtx.PixelFormat = pixFmt
+
+	// Create filterer
+	// Tone mapping happens in linear light on float RGB frames
+	if m.Filterer, err = NewFilterer(FiltererOptions{
+		Content:   fmt.Sprintf("zscale=t=linear:npl=%d,format=gbrpf32le,zscale=p=bt709,tonemap=tonemap=%s:desat=0,zscale=t=bt709:m=bt709:r=tv,format=%s", o.PeakLuminance, o.Algorithm, C.GoString(d.name)),
+		Inputs:    map[string]FiltererInput{"in": o.Input},
+		Node:      o.Node,
+		Restamper: o.Restamper,
+	}, eh, c); err != nil {
+		err = fmt.Errorf("astilibav: creating filterer failed: %w", err)
+		return
+	}
+	m.dropSideData = []int{sideDataTypeContentLightLevel, sideDataTypeMasteringDisplay}
+	return
+}
+
+// OutputCtx returns the context of the frames coming out of the tone mapper
+// It should be used to create the next nodes, such as the encoder
+func (m *ToneMapper) OutputCtx() Context {
+	return m.outputCtx
+}
@@ -0,0 +1,479 @@
+package astilibav
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+)
+
+var countTR101290Monitor uint64
+
+// TR 101 290 checks
+const (
+	// Priority 1
+	TR101290CheckContinuityCount = "continuity_count_error"
+	TR101290CheckPAT             = "PAT_error"
+	TR101290CheckPID             = "PID_error"
+	TR101290CheckPMT             = "PMT_error"
+	TR101290CheckSyncByte        = "sync_byte_error"
+	// Priority 2
+	TR101290CheckCAT              = "CAT_error"
+	TR101290CheckPCRDiscontinuity = "PCR_discontinuity_indicator_error"
+	TR101290CheckPCRRepetition    = "PCR_repetition_error"
+	TR101290CheckTransport        = "transport_error"
+)
+
+// TR 101 290 limits
+const (
+	tr101290MaxPCRDiscontinuity = 100 * time.Millisecond
+	tr101290MaxPCRRepetition    = 40 * time.Millisecond
+	tr101290MaxTableRepetition  = 500 * time.Millisecond
+)
+
+// TR101290Monitor represents an object capable of checking a MPEG-TS byte stream against ETSI TR 101 290 priority
+// 1 and 2 checks
+// It implements io.Writer so that it can be fed with the output of a muxer (see MuxerOptions.TSWriters) or with
+// the raw bytes of an input
+// Time based checks use the stream clock rebuilt from PCRs, which makes them valid whether the stream is written in
+// real time or not. Sections are expected to fit in a single packet, PCR accuracy and PTS checks are not performed
+type TR101290Monitor struct {
+	*astiencoder.BaseNode
+	b             []byte
+	catSeen       bool
+	eh            *astiencoder.EventHandler
+	lastPAT       time.Duration
+	lastPCR       *int64
+	m             *sync.Mutex
+	now           time.Duration
+	o             TR101290MonitorOptions
+	pcrPID        int
+	pcrPIDFromPMT bool
+	pids          map[int]*tr101290PID
+	pmts          map[int]time.Duration
+	reported      map[string]bool
+	statPriority1 *astikit.CounterAvgStat
+	statPriority2 *astikit.CounterAvgStat
+	synced        bool
+}
+
+type tr101290PID struct {
+	cc         int
+	dup        bool
+	lastSeen   time.Duration
+	referenced bool
+}
+
+// TR101290MonitorOptions represents TR 101 290 monitor options
+type TR101290MonitorOptions struct {
+	Node astiencoder.NodeOptions
+	// Duration after which a PID referenced in a PMT that has not been seen triggers a PID error. Defaults to 5s
+	PIDTimeout time.Duration
+}
+
+// TR101290Violation represents a TR 101 290 violation
+type TR101290Violation struct {
+	Check       string
+	Description string
+	// -1 when the violation is not related to a specific PID
+	PID      int
+	Priority int
+}
+
+// NewTR101290Monitor creates a new TR 101 290 monitor
+func NewTR101290Monitor(o TR101290MonitorOptions, eh *astiencoder.EventHandler) (m *TR101290Monitor) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countTR101290Monitor, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("tr101290_monitor_%d", count), fmt.Sprintf("TR 101 290 Monitor #%d", count), "Monitors TS")
+
+	// Default values
+	if o.PIDTimeout <= 0 {
+		o.PIDTimeout = 5 * time.Second
+	}
+
+	// Create monitor
+	m = &TR101290Monitor{
+		eh:            eh,
+		m:             &sync.Mutex{},
+		o:             o,
+		pcrPID:        -1,
+		pids:          make(map[int]*tr101290PID),
+		pmts:          make(map[int]time.Duration),
+		reported:      make(map[string]bool),
+		statPriority1: astikit.NewCounterAvgStat(),
+		statPriority2: astikit.NewCounterAvgStat(),
+	}
+	m.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(m), eh)
+	m.addStats()
+	return
+}
+
+func (m *TR101290Monitor) addStats() {
+	// Add priority 1
+	m.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of priority 1 violations per second",
+		Label:       "Priority 1",
+		Unit:        "vps",
+	}, m.statPriority1)
+
+	// Add priority 2
+	m.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of priority 2 violations per second",
+		Label:       "Priority 2",
+		Unit:        "vps",
+	}, m.statPriority2)
+}
+
+// Start starts the monitor
+func (m *TR101290Monitor) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	m.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Wait for context to be done
+		<-m.Context().Done()
+	})
+}
+
+// Write implements the io.Writer interface
+func (m *TR101290Monitor) Write(b []byte) (int, error) {
+	// Analyze
+	m.m.Lock()
+	vs := m.write(b)
+	m.m.Unlock()
+
+	// Loop through violations
+	for _, v := range vs {
+		// Update stats
+		if v.Priority == 1 {
+			m.statPriority1.Add(1)
+		} else {
+			m.statPriority2.Add(1)
+		}
+
+		// Send event
+		m.eh.Emit(astiencoder.Event{
+			Name:    EventNameTR101290Violation,
+			Payload: v,
+			Target:  m,
+		})
+	}
+	return len(b), nil
+}
+
+func (m *TR101290Monitor) write(b []byte) (vs []TR101290Violation) {
+	// Prepend remainder
+	if len(m.b) > 0 {
+		b = append(m.b, b...)
+		m.b = nil
+	}
+
+	// Loop through packets
+	for len(b) >= tsPacketSize {
+		// Sync byte is missing
+		if b[0] != 0x47 {
+			if m.synced {
+				m.synced = false
+				vs = append(vs, TR101290Violation{Check: TR101290CheckSyncByte, Description: "sync byte is missing", PID: -1, Priority: 1})
+			}
+			b = b[1:]
+			continue
+		}
+		m.synced = true
+
+		// Analyze packet
+		vs = append(vs, m.analyze(b[:tsPacketSize])...)
+		b = b[tsPacketSize:]
+	}
+
+	// Store remainder
+	if len(b) > 0 {
+		m.b = append([]byte{}, b...)
+	}
+	return
+}
+
+func (m *TR101290Monitor) analyze(p []byte) (vs []TR101290Violation) {
+	// Parse header
+	tei := p[1]&0x80 > 0
+	pusi := p[1]&0x40 > 0
+	pid := int(p[1]&0x1f)<<8 | int(p[2])
+	scrambling := p[3] >> 6
+	afc := (p[3] >> 4) & 0x3
+	cc := int(p[3] & 0xf)
+	var discontinuity bool
+	payloadOffset := 4
+	if afc&0x2 > 0 {
+		if p[4] > 0 {
+			discontinuity = p[5]&0x80 > 0
+		}
+		payloadOffset += 1 + int(p[4])
+	}
+	var payload []byte
+	if afc&0x1 > 0 && payloadOffset < tsPacketSize {
+		payload = p[payloadOffset:]
+	}
+
+	// Transport error
+	if tei {
+		vs = append(vs, TR101290Violation{Check: TR101290CheckTransport, Description: "transport error indicator is set", PID: pid, Priority: 2})
+	}
+
+	// Null packets are not checked any further
+	if pid == tsNullPID {
+		return
+	}
+
+	// Get pid
+	s, ok := m.pids[pid]
+	if !ok {
+		s = &tr101290PID{cc: -1}
+		m.pids[pid] = s
+	}
+	s.lastSeen = m.now
+
+	// Continuity count
+	if s.cc >= 0 && !discontinuity {
+		if payload == nil {
+			if cc != s.cc {
+				vs = append(vs, TR101290Violation{Check: TR101290CheckContinuityCount, Description: fmt.Sprintf("continuity count is %d instead of %d", cc, s.cc), PID: pid, Priority: 1})
+			}
+		} else if cc == s.cc {
+			if s.dup {
+				vs = append(vs, TR101290Violation{Check: TR101290CheckContinuityCount, Description: "packet has been duplicated more than once", PID: pid, Priority: 1})
+			}
+			s.dup = true
+		} else if expected := (s.cc + 1) & 0xf; cc != expected {
+			vs = append(vs, TR101290Violation{Check: TR101290CheckContinuityCount, Description: fmt.Sprintf("continuity count is %d instead of %d", cc, expected), PID: pid, Priority: 1})
+		}
+	}
+	if cc != s.cc {
+		s.dup = false
+	}
+	s.cc = cc
+
+	// Scrambled packets require a CAT
+	if scrambling > 0 && !m.catSeen && !m.reported[TR101290CheckCAT] {
+		m.reported[TR101290CheckCAT] = true
+		vs = append(vs, TR101290Violation{Check: TR101290CheckCAT, Description: "scrambled packet found without CAT", PID: pid, Priority: 2})
+	}
+
+	// Switch on pid
+	_, isPMT := m.pmts[pid]
+	switch {
+	case pid == 0:
+		if scrambling > 0 {
+			vs = append(vs, TR101290Violation{Check: TR101290CheckPAT, Description: "PAT is scrambled", PID: pid, Priority: 1})
+		}
+		if pusi && payload != nil {
+			vs = append(vs, m.handlePAT(payload)...)
+		}
+	case pid == 1:
+		m.catSeen = true
+	case isPMT:
+		if scrambling > 0 {
+			vs = append(vs, TR101290Violation{Check: TR101290CheckPMT, Description: "PMT is scrambled", PID: pid, Priority: 1})
+		}
+		if pusi && payload != nil {
+			vs = append(vs, m.handlePMT(pid, payload)...)
+		}
+	}
+
+	// PCR
+	if pcr, ok := tsPacketPCR(p); ok {
+		if m.pcrPID < 0 {
+			m.pcrPID = pid
+		}
+		if pid == m.pcrPID {
+			vs = append(vs, m.handlePCR(pid, pcr, discontinuity)...)
+		}
+	}
+	return
+}
+
+// tr101290Section returns the section starting in the payload
+func tr101290Section(payload []byte) (tableID byte, data []byte, ok bool) {
+	// Skip pointer field
+	if len(payload) < 1 || int(payload[0])+1 >= len(payload) {
+		return
+	}
+	s := payload[1+int(payload[0]):]
+
+	// Get section
+	if len(s) < 3 {
+		return
+	}
+	l := int(s[1]&0xf)<<8 | int(s[2])
+	if l < 9 || len(s) < 3+l {
+		return
+	}
+	return s[0], s[3 : 3+l-4], true
+}
+
+func (m *TR101290Monitor) handlePAT(payload []byte) (vs []TR101290Violation) {
+	// Get section
+	tableID, d, ok := tr101290Section(payload)
+	if !ok {
+		return
+	}
+
+	// Invalid table id
+	if tableID != 0x00 {
+		vs = append(vs, TR101290Violation{Check: TR101290CheckPAT, Description: fmt.Sprintf("table id is %#x instead of 0x00", tableID), PID: 0, Priority: 1})
+		return
+	}
+
+	// Update last PAT
+	m.lastPAT = m.now
+	delete(m.reported, TR101290CheckPAT)
+
+	// Loop through programs
+	for i := 5; i+4 <= len(d); i += 4 {
+		// NIT
+		if d[i] == 0 && d[i+1] == 0 {
+			continue
+		}
+
+		// Add PMT
+		if pid := int(d[i+2]&0x1f)<<8 | int(d[i+3]); !m.isPMT(pid) {
+			m.pmts[pid] = m.now
+		}
+	}
+	return
+}
+
+func (m *TR101290Monitor) isPMT(pid int) bool {
+	_, ok := m.pmts[pid]
+	return ok
+}
+
+func (m *TR101290Monitor) handlePMT(pid int, payload []byte) (vs []TR101290Violation) {
+	// Get section
+	tableID, d, ok := tr101290Section(payload)
+	if !ok {
+		return
+	}
+
+	// Invalid table id
+	if tableID != 0x02 {
+		vs = append(vs, TR101290Violation{Check: TR101290CheckPMT, Description: fmt.Sprintf("table id is %#x instead of 0x02", tableID), PID: pid, Priority: 1})
+		return
+	}
+
+	// Update last PMT
+	m.pmts[pid] = m.now
+	delete(m.reported, tr101290ReportedKey(TR101290CheckPMT, pid))
+
+	// Get PCR pid
+	if len(d) < 9 {
+		return
+	}
+	if pcrPID := int(d[5]&0x1f)<<8 | int(d[6]); pcrPID != tsNullPID && !m.pcrPIDFromPMT {
+		m.pcrPID = pcrPID
+		m.pcrPIDFromPMT = true
+	}
+
+	// Loop through elementary streams
+	for i := 9 + (int(d[7]&0xf)<<8 | int(d[8])); i+5 <= len(d); {
+		// Reference pid
+		esPID := int(d[i+1]&0x1f)<<8 | int(d[i+2])
+		s, ok := m.pids[esPID]
+		if !ok {
+			s = &tr101290PID{
+				cc:       -1,
+				lastSeen: m.now,
+			}
+			m.pids[esPID] = s
+		}
+		s.referenced = true
+
+		// Next
+		i += 5 + (int(d[i+3]&0xf)<<8 | int(d[i+4]))
+	}
+	return
+}
+
+func (m *TR101290Monitor) handlePCR(pid int, pcr int64, discontinuity bool) (vs []TR101290Violation) {
+	// First PCR
+	if m.lastPCR == nil {
+		m.lastPCR = &pcr
+		return
+	}
+
+	// Get delta
+	d := pcr - *m.lastPCR
+	m.lastPCR = &pcr
+	if d < -tsPCRWrap/2 {
+		d += tsPCRWrap
+	}
+	delta := time.Duration(d * 1000 / (tsPCRClock / 1000000))
+
+	// Discontinuity is signaled
+	if discontinuity {
+		return
+	}
+
+	// Check PCR
+	if delta < 0 || delta > tr101290MaxPCRDiscontinuity {
+		vs = append(vs, TR101290Violation{Check: TR101290CheckPCRDiscontinuity, Description: fmt.Sprintf("PCR delta is %s without discontinuity indicator", delta), PID: pid, Priority: 2})
+		return
+	} else if delta > tr101290MaxPCRRepetition {
+		vs = append(vs, TR101290Violation{Check: TR101290CheckPCRRepetition, Description: fmt.Sprintf("PCR interval is %s", delta), PID: pid, Priority: 2})
+	}
+
+	// Update stream clock
+	m.now += delta
+
+	// Check tables and pids now that the clock has moved
+	vs = append(vs, m.checkTimeouts()...)
+	return
+}
+
+func tr101290ReportedKey(check string, pid int) string {
+	return fmt.Sprintf("%s_%d", check, pid)
+}
+
+func (m *TR101290Monitor) checkTimeouts() (vs []TR101290Violation) {
+	// PAT
+	if m.now-m.lastPAT > tr101290MaxTableRepetition && !m.reported[TR101290CheckPAT] {
+		m.reported[TR101290CheckPAT] = true
+		vs = append(vs, TR101290Violation{Check: TR101290CheckPAT, Description: fmt.Sprintf("PAT has not been received for more than %s", tr101290MaxTableRepetition), PID: 0, Priority: 1})
+	}
+
+	// PMTs
+	var pids []int
+	for pid := range m.pmts {
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+	for _, pid := range pids {
+		k := tr101290ReportedKey(TR101290CheckPMT, pid)
+		if m.now-m.pmts[pid] > tr101290MaxTableRepetition && !m.reported[k] {
+			m.reported[k] = true
+			vs = append(vs, TR101290Violation{Check: TR101290CheckPMT, Description: fmt.Sprintf("PMT has not been received for more than %s", tr101290MaxTableRepetition), PID: pid, Priority: 1})
+		}
+	}
+
+	// Referenced pids
+	pids = []int{}
+	for pid, s := range m.pids {
+		if s.referenced {
+			pids = append(pids, pid)
+		}
+	}
+	sort.Ints(pids)
+	for _, pid := range pids {
+		k := tr101290ReportedKey(TR101290CheckPID, pid)
+		if m.now-m.pids[pid].lastSeen > m.o.PIDTimeout {
+			if !m.reported[k] {
+				m.reported[k] = true
+				vs = append(vs, TR101290Violation{Check: TR101290CheckPID, Description: fmt.Sprintf("PID has not been received for more than %s", m.o.PIDTimeout), PID: pid, Priority: 1})
+			}
+		} else {
+			delete(m.reported, k)
+		}
+	}
+	return
+}
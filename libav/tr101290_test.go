@@ -0,0 +1,78 @@
+package astilibav
+
+import (
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/stretchr/testify/assert"
+)
+
+func tr101290TestPacket(pid, cc int, pcr int64) []byte {
+	b := tsAnalyzerTestPacket(pid, pcr)
+	b[3] |= byte(cc & 0xf)
+	return b
+}
+
+func tr101290TestSection(pid, cc int, tableID byte, data []byte) []byte {
+	b := tr101290TestPacket(pid, cc, -1)
+	b[1] |= 0x40
+	s := []byte{0, tableID, 0xb0, byte(5 + len(data) + 4), 0, 1, 0xc1, 0, 0}
+	s = append(s, data...)
+	s = append(s, 0, 0, 0, 0)
+	copy(b[4:], s)
+	for i := 4 + len(s); i < tsPacketSize; i++ {
+		b[i] = 0xff
+	}
+	return b
+}
+
+func tr101290TestChecks(vs []TR101290Violation) (cs []string) {
+	cs = []string{}
+	for _, v := range vs {
+		cs = append(cs, v.Check)
+	}
+	return
+}
+
+func TestTR101290Monitor(t *testing.T) {
+	m := NewTR101290Monitor(TR101290MonitorOptions{PIDTimeout: time.Second}, astiencoder.NewEventHandler())
+
+	// Tables
+	assert.Empty(t, m.write(tr101290TestSection(0, 0, 0x00, []byte{0, 1, 0xf0, 0x00})))
+	assert.True(t, m.isPMT(0x1000))
+	assert.Empty(t, m.write(tr101290TestSection(0x1000, 0, 0x02, []byte{0xe1, 0x00, 0xf0, 0x00, 0x1b, 0xe1, 0x00, 0xf0, 0x00, 0x0f, 0xe1, 0x01, 0xf0, 0x00})))
+	assert.Equal(t, 0x100, m.pcrPID)
+	assert.True(t, m.pids[0x100].referenced)
+	assert.True(t, m.pids[0x101].referenced)
+	assert.Equal(t, []string{TR101290CheckPMT}, tr101290TestChecks(m.write(tr101290TestSection(0x1000, 1, 0x03, nil))))
+
+	// Continuity count
+	assert.Empty(t, m.write(tr101290TestPacket(0x101, 0, -1)))
+	assert.Empty(t, m.write(tr101290TestPacket(0x101, 1, -1)))
+	assert.Empty(t, m.write(tr101290TestPacket(0x101, 1, -1)))
+	assert.Equal(t, []string{TR101290CheckContinuityCount}, tr101290TestChecks(m.write(tr101290TestPacket(0x101, 1, -1))))
+	assert.Equal(t, []string{TR101290CheckContinuityCount}, tr101290TestChecks(m.write(tr101290TestPacket(0x101, 3, -1))))
+	assert.Empty(t, m.write(tr101290TestPacket(0x101, 4, -1)))
+	assert.Empty(t, m.write(tr101290TestPacket(tsNullPID, 7, -1)))
+
+	// Sync byte and transport error
+	b := tr101290TestPacket(0x101, 5, -1)
+	b[1] |= 0x80
+	assert.Equal(t, []string{TR101290CheckSyncByte, TR101290CheckTransport}, tr101290TestChecks(m.write(append([]byte{0}, b...))))
+
+	// PCR
+	assert.Empty(t, m.write(tr101290TestPacket(0x100, 0, 0)))
+	assert.Equal(t, []string{TR101290CheckPCRRepetition}, tr101290TestChecks(m.write(tr101290TestPacket(0x100, 1, tsPCRClock/20))))
+	assert.Equal(t, []string{TR101290CheckPCRDiscontinuity}, tr101290TestChecks(m.write(tr101290TestPacket(0x100, 2, tsPCRClock))))
+	assert.Equal(t, 50*time.Millisecond, m.now)
+
+	// Timeouts
+	var cs []string
+	for i := 1; i <= 30; i++ {
+		cs = append(cs, tr101290TestChecks(m.write(tr101290TestPacket(0x100, 2+i, tsPCRClock+int64(i)*tsPCRClock/25)))...)
+	}
+	assert.Equal(t, []string{TR101290CheckPAT, TR101290CheckPMT, TR101290CheckPID}, cs)
+	assert.Empty(t, m.write(tr101290TestSection(0, 1, 0x00, []byte{0, 1, 0xf0, 0x00})))
+	assert.False(t, m.reported[TR101290CheckPAT])
+}
@@ -0,0 +1,229 @@
+package astilibav
+
+import (
+	"sync"
+	"time"
+
+	"github.com/asticode/go-astikit"
+)
+
+// MPEG-TS constants
+const (
+	tsNullPID = 0x1fff
+	// PCRs are 33 bits at 90kHz multiplied by 300 plus a 9 bits extension, which gives a 27MHz clock
+	tsPCRClock = 27000000
+	tsPCRWrap  = (1 << 33) * 300
+)
+
+// tsAnalyzer analyzes a MPEG-TS byte stream as it is written
+// Only the first PID carrying PCRs is used to measure PCR intervals and jitter
+// PCR jitter is the difference between the PCR delta and the time it takes to transmit the bytes between 2 PCRs,
+// which only depends on the stream itself and not on when it is written. When the mux rate is not known, it is
+// rebuilt from the PCRs received so far
+type tsAnalyzer struct {
+	b              []byte
+	elapsedPCR     int64
+	firstPCR       *tsPCR
+	lastPCR        *tsPCR
+	m              *sync.Mutex
+	maxPCRInterval time.Duration
+	maxPCRJitter   time.Duration
+	muxRate        int
+	nulls          uint64
+	pcrPID         int
+	prevNulls      uint64
+	prevTotal      uint64
+	total          uint64
+}
+
+type tsPCR struct {
+	pos uint64
+	v   int64
+}
+
+// newTSAnalyzer creates a new MPEG-TS analyzer, muxRate being in bits per second or 0 if not known
+func newTSAnalyzer(muxRate int) *tsAnalyzer {
+	return &tsAnalyzer{
+		m:       &sync.Mutex{},
+		muxRate: muxRate,
+		pcrPID:  -1,
+	}
+}
+
+func (a *tsAnalyzer) addStats(s *astikit.Stater) {
+	// Add stuffing
+	s.AddStat(astikit.StatMetadata{
+		Description: "Percentage of null packets written",
+		Label:       "Stuffing",
+		Unit:        "%",
+	}, newTSAnalyzerStat(a, a.stuffing))
+
+	// Add PCR interval
+	s.AddStat(astikit.StatMetadata{
+		Description: "Maximum interval between 2 PCRs",
+		Label:       "PCR interval",
+		Unit:        "ms",
+	}, newTSAnalyzerStat(a, a.pcrInterval))
+
+	// Add PCR jitter
+	s.AddStat(astikit.StatMetadata{
+		Description: "Maximum difference between the PCR delta and the transmission time of the bytes between 2 PCRs",
+		Label:       "PCR jitter",
+		Unit:        "ms",
+	}, newTSAnalyzerStat(a, a.pcrJitter))
+}
+
+func (a *tsAnalyzer) write(b []byte) {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	// Prepend remainder
+	if len(a.b) > 0 {
+		b = append(a.b, b...)
+		a.b = nil
+	}
+
+	// Loop through packets
+	for len(b) >= tsPacketSize {
+		// Resync on next sync byte
+		if b[0] != 0x47 {
+			b = b[1:]
+			continue
+		}
+
+		// Analyze packet
+		a.analyze(b[:tsPacketSize])
+		b = b[tsPacketSize:]
+	}
+
+	// Store remainder
+	if len(b) > 0 {
+		a.b = append([]byte{}, b...)
+	}
+}
+
+func (a *tsAnalyzer) analyze(p []byte) {
+	// Count packet
+	a.total++
+	pid := int(p[1]&0x1f)<<8 | int(p[2])
+	if pid == tsNullPID {
+		a.nulls++
+		return
+	}
+
+	// No PCR
+	pcr, ok := tsPacketPCR(p)
+	if !ok {
+		return
+	}
+
+	// Use the first PID carrying PCRs
+	if a.pcrPID < 0 {
+		a.pcrPID = pid
+	} else if pid != a.pcrPID {
+		return
+	}
+
+	// Get position
+	pos := (a.total - 1) * tsPacketSize
+
+	// First PCR
+	if a.lastPCR == nil {
+		a.firstPCR = &tsPCR{pos: pos, v: pcr}
+		a.lastPCR = a.firstPCR
+		return
+	}
+
+	// Get PCR delta
+	d := pcr - a.lastPCR.v
+	if d < 0 {
+		d += tsPCRWrap
+	}
+	a.elapsedPCR += d
+	i := time.Duration(d * 1000 / (tsPCRClock / 1000000))
+
+	// Update interval
+	if i > a.maxPCRInterval {
+		a.maxPCRInterval = i
+	}
+
+	// Get the transmission time of the bytes between both PCRs
+	var tt time.Duration
+	if n := pos - a.lastPCR.pos; a.muxRate > 0 {
+		tt = time.Duration(float64(n*8) / float64(a.muxRate) * 1e9)
+	} else if total := pos - a.firstPCR.pos; total > 0 {
+		tt = time.Duration(float64(n) / float64(total) * float64(a.elapsedPCR) * 1e3 / (tsPCRClock / 1e6))
+	}
+
+	// Update jitter
+	j := tt - i
+	if j < 0 {
+		j = -j
+	}
+	if j > a.maxPCRJitter {
+		a.maxPCRJitter = j
+	}
+	a.lastPCR = &tsPCR{
+		pos: pos,
+		v:   pcr,
+	}
+}
+
+// tsPacketPCR returns the PCR of the packet in a 27MHz clock, if any
+func tsPacketPCR(p []byte) (pcr int64, ok bool) {
+	// No adaptation field, no PCR flag or adaptation field is too small
+	if p[3]&0x20 == 0 || p[4] < 7 || p[5]&0x10 == 0 {
+		return
+	}
+
+	// Parse
+	base := int64(p[6])<<25 | int64(p[7])<<17 | int64(p[8])<<9 | int64(p[9])<<1 | int64(p[10])>>7
+	ext := int64(p[10]&0x1)<<8 | int64(p[11])
+	return base*300 + ext, true
+}
+
+func (a *tsAnalyzer) stuffing() interface{} {
+	nulls, total := a.nulls-a.prevNulls, a.total-a.prevTotal
+	a.prevNulls, a.prevTotal = a.nulls, a.total
+	if total == 0 {
+		return 0.0
+	}
+	return float64(nulls) / float64(total) * 100
+}
+
+func (a *tsAnalyzer) pcrInterval() interface{} {
+	v := a.maxPCRInterval
+	a.maxPCRInterval = 0
+	return float64(v) / float64(time.Millisecond)
+}
+
+func (a *tsAnalyzer) pcrJitter() interface{} {
+	v := a.maxPCRJitter
+	a.maxPCRJitter = 0
+	return float64(v) / float64(time.Millisecond)
+}
+
+type tsAnalyzerStat struct {
+	a  *tsAnalyzer
+	fn func() interface{}
+}
+
+func newTSAnalyzerStat(a *tsAnalyzer, fn func() interface{}) *tsAnalyzerStat {
+	return &tsAnalyzerStat{
+		a:  a,
+		fn: fn,
+	}
+}
+
+// Start implements the astikit.StatHandler interface
+func (s *tsAnalyzerStat) Start() {}
+
+// Stop implements the astikit.StatHandler interface
+func (s *tsAnalyzerStat) Stop() {}
+
+// Value implements the astikit.StatHandler interface
+func (s *tsAnalyzerStat) Value(delta time.Duration) interface{} {
+	s.a.m.Lock()
+	defer s.a.m.Unlock()
+	return s.fn()
+}
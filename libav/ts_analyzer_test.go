@@ -0,0 +1,68 @@
+package astilibav
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tsAnalyzerTestPacket(pid int, pcr int64) []byte {
+	b := make([]byte, tsPacketSize)
+	b[0] = 0x47
+	b[1] = byte(pid >> 8 & 0x1f)
+	b[2] = byte(pid)
+	b[3] = 0x10
+	if pcr >= 0 {
+		base, ext := pcr/300, pcr%300
+		b[3] = 0x30
+		b[4] = 7
+		b[5] = 0x10
+		b[6] = byte(base >> 25)
+		b[7] = byte(base >> 17)
+		b[8] = byte(base >> 9)
+		b[9] = byte(base >> 1)
+		b[10] = byte(base&0x1)<<7 | 0x7e | byte(ext>>8)
+		b[11] = byte(ext)
+	}
+	return b
+}
+
+func TestTSAnalyzer(t *testing.T) {
+	// Stuffing
+	a := newTSAnalyzer(tsPacketSize * 8 * 25)
+	var b []byte
+	b = append(b, tsAnalyzerTestPacket(0x100, -1)...)
+	b = append(b, tsAnalyzerTestPacket(tsNullPID, -1)...)
+	b = append(b, tsAnalyzerTestPacket(tsNullPID, -1)...)
+	b = append(b, tsAnalyzerTestPacket(0, -1)...)
+	a.write(b[:300])
+	assert.Equal(t, uint64(1), a.total)
+	a.write(b[300:])
+	assert.Equal(t, uint64(4), a.total)
+	assert.Equal(t, uint64(2), a.nulls)
+	assert.Equal(t, 50.0, a.stuffing())
+	assert.Equal(t, 0.0, a.stuffing())
+
+	// PCR with a mux rate of 25 packets per second
+	pcr, ok := tsPacketPCR(tsAnalyzerTestPacket(0x100, 123456789))
+	assert.True(t, ok)
+	assert.Equal(t, int64(123456789), pcr)
+	a.write(tsAnalyzerTestPacket(0x100, tsPCRClock))
+	a.write(tsAnalyzerTestPacket(0x101, 0))
+	a.write(tsAnalyzerTestPacket(0x100, tsPCRClock+tsPCRClock/25))
+	a.write(tsAnalyzerTestPacket(0x100, tsPCRClock+tsPCRClock/10))
+	assert.Equal(t, 60.0, a.pcrInterval())
+	assert.Equal(t, 40.0, a.pcrJitter())
+	assert.Equal(t, 0.0, a.pcrInterval())
+	assert.Equal(t, 0.0, a.pcrJitter())
+
+	// PCR with a rebuilt mux rate
+	a = newTSAnalyzer(0)
+	a.write(tsAnalyzerTestPacket(0x100, 0))
+	a.write(tsAnalyzerTestPacket(0x100, tsPCRClock/25))
+	assert.Equal(t, 0.0, a.pcrJitter())
+	a.write(tsAnalyzerTestPacket(0x100, -1))
+	a.write(tsAnalyzerTestPacket(0x100, tsPCRClock/25+tsPCRClock/10))
+	assert.Equal(t, 100.0, a.pcrInterval())
+	assert.InDelta(t, 6.667, a.pcrJitter(), 0.001)
+}
@@ -0,0 +1,144 @@
+package astilibav
+
+import (
+	"time"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/goav/avutil"
+)
+
+// UnitMetadata represents metadata attached to a pkt or a frame by the node that has created it. It's propagated
+// through nodes so that units can be correlated end to end
+// It must be considered as immutable since it's shared between units: use With to add key/values
+type UnitMetadata struct {
+	// Wall clock time at which the unit has been read by its source node
+	CaptureTime time.Time
+	// Whether the unit is the first one following a discontinuity, such as the demuxer looping
+	Discontinuity bool
+	// Whether nodes buffering units, such as decoders, must drop them before handling this unit, such as after the
+	// demuxer has seeked
+	Flush bool
+	// User-defined key/values
+	Data map[string]string
+	// Node that has created the unit
+	Source astiencoder.Node
+}
+
+// With returns a copy of the metadata with the key/value added
+func (m *UnitMetadata) With(k, v string) *UnitMetadata {
+	// Copy
+	c := &UnitMetadata{Data: make(map[string]string)}
+	if m != nil {
+		c.CaptureTime = m.CaptureTime
+		c.Discontinuity = m.Discontinuity
+		c.Flush = m.Flush
+		c.Source = m.Source
+		for k, v := range m.Data {
+			c.Data[k] = v
+		}
+	}
+
+	// Add key/value
+	c.Data[k] = v
+	return c
+}
+
+// withFlush returns a copy of the metadata with the flush flag set
+func (m *UnitMetadata) withFlush() *UnitMetadata {
+	c := &UnitMetadata{Flush: true}
+	if m != nil {
+		c.CaptureTime = m.CaptureTime
+		c.Data = m.Data
+		c.Discontinuity = m.Discontinuity
+		c.Source = m.Source
+	}
+	return c
+}
+
+// Default pts tracker values
+const (
+	defaultPtsTrackerSize = 1024
+)
+
+// ptsTracker stores values indexed by the pts of the units sent to a codec or a filter graph until the units
+// coming out of it with the same pts claim them
+// Since units can come out reordered (e.g. B-frames coming out of an encoder in decode order), only the claimed
+// value is removed. Values that are never claimed are evicted, the oldest first, once the tracker is full
+type ptsTracker struct {
+	m     map[int64]interface{}
+	order []int64
+	size  int
+}
+
+func newPtsTracker(size int) *ptsTracker {
+	return &ptsTracker{
+		m:    make(map[int64]interface{}),
+		size: size,
+	}
+}
+
+func (t *ptsTracker) add(pts int64, v interface{}) {
+	// Store
+	if _, ok := t.m[pts]; !ok {
+		t.order = append(t.order, pts)
+	}
+	t.m[pts] = v
+
+	// Evict the oldest values
+	for len(t.m) > t.size {
+		delete(t.m, t.order[0])
+		t.order = t.order[1:]
+	}
+
+	// Claimed values are not removed from the order right away
+	if len(t.order) > 2*t.size {
+		order := make([]int64, 0, len(t.m))
+		for _, k := range t.order {
+			if _, ok := t.m[k]; ok {
+				order = append(order, k)
+			}
+		}
+		t.order = order
+	}
+}
+
+func (t *ptsTracker) get(pts int64) (v interface{}, ok bool) {
+	if v, ok = t.m[pts]; ok {
+		delete(t.m, pts)
+	}
+	return
+}
+
+// unitMetadataTracker keeps track of the metadata of the units sent to a codec or a filter graph so that it can be
+// attached to the units coming out of it, which may have been delayed or reordered
+// Outgoing units are matched with incoming units through their pts, and fallback to the metadata of the last
+// incoming unit when there's no match (e.g. when the filter graph changes timestamps)
+type unitMetadataTracker struct {
+	last *UnitMetadata
+	t    *ptsTracker
+}
+
+func newUnitMetadataTracker() *unitMetadataTracker {
+	return &unitMetadataTracker{t: newPtsTracker(defaultPtsTrackerSize)}
+}
+
+func (t *unitMetadataTracker) add(pts int64, m *UnitMetadata) {
+	t.last = m
+	if m != nil && pts != avutil.AV_NOPTS_VALUE {
+		t.t.add(pts, m)
+	}
+}
+
+func (t *unitMetadataTracker) get(pts int64) *UnitMetadata {
+	// No pts
+	if pts == avutil.AV_NOPTS_VALUE {
+		return t.last
+	}
+
+	// Get metadata
+	v, ok := t.t.get(pts)
+	if !ok {
+		return t.last
+	}
+	return v.(*UnitMetadata)
+}
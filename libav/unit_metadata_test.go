@@ -0,0 +1,85 @@
+package astilibav
+
+import (
+	"testing"
+
+	"github.com/asticode/goav/avutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnitMetadataWith(t *testing.T) {
+	var m *UnitMetadata
+	m1 := m.With("k1", "v1")
+	assert.Equal(t, map[string]string{"k1": "v1"}, m1.Data)
+	m1.Discontinuity = true
+	m1.Flush = true
+	m2 := m1.With("k2", "v2")
+	assert.True(t, m2.Discontinuity)
+	assert.True(t, m2.Flush)
+	assert.Equal(t, map[string]string{"k1": "v1"}, m1.Data)
+	assert.Equal(t, map[string]string{"k1": "v1", "k2": "v2"}, m2.Data)
+}
+
+func TestUnitMetadataWithFlush(t *testing.T) {
+	var m *UnitMetadata
+	assert.True(t, m.withFlush().Flush)
+	m = &UnitMetadata{Data: map[string]string{"k": "v"}, Discontinuity: true}
+	m1 := m.withFlush()
+	assert.False(t, m.Flush)
+	assert.True(t, m1.Flush)
+	assert.True(t, m1.Discontinuity)
+	assert.Equal(t, m.Data, m1.Data)
+}
+
+func TestUnitMetadataTracker(t *testing.T) {
+	m1, m2, m3, m4 := &UnitMetadata{}, &UnitMetadata{}, &UnitMetadata{}, &UnitMetadata{}
+	tr := newUnitMetadataTracker()
+	assert.Nil(t, tr.get(0))
+	tr.add(0, m1)
+	tr.add(2, m2)
+	tr.add(1, m3)
+	assert.Equal(t, m1, tr.get(0))
+	assert.Equal(t, m3, tr.get(1))
+	assert.Equal(t, m2, tr.get(2))
+	assert.Len(t, tr.t.m, 0)
+	tr.add(avutil.AV_NOPTS_VALUE, m4)
+	assert.Equal(t, m4, tr.get(5))
+	assert.Equal(t, m4, tr.get(avutil.AV_NOPTS_VALUE))
+}
+
+func TestUnitMetadataTrackerReordered(t *testing.T) {
+	// Frames are sent in presentation order whereas pkts come out in decode order: I0 P3 B1 B2
+	ms := []*UnitMetadata{{}, {}, {}, {}}
+	tr := newUnitMetadataTracker()
+	for pts, m := range ms {
+		tr.add(int64(pts), m)
+	}
+	for _, pts := range []int{0, 3, 1, 2} {
+		assert.Same(t, ms[pts], tr.get(int64(pts)))
+	}
+	assert.Len(t, tr.t.m, 0)
+}
+
+func TestPtsTracker(t *testing.T) {
+	tr := newPtsTracker(2)
+	tr.add(1, "1")
+	tr.add(2, "2")
+	tr.add(3, "3")
+	_, ok := tr.get(1)
+	assert.False(t, ok)
+	v, ok := tr.get(3)
+	assert.True(t, ok)
+	assert.Equal(t, "3", v)
+	_, ok = tr.get(3)
+	assert.False(t, ok)
+	for i := int64(4); i < 10; i++ {
+		tr.add(i, i)
+		_, ok = tr.get(i)
+		assert.True(t, ok)
+	}
+	assert.Len(t, tr.m, 1)
+	assert.True(t, len(tr.order) <= 4)
+	v, ok = tr.get(2)
+	assert.True(t, ok)
+	assert.Equal(t, "2", v)
+}
@@ -0,0 +1,233 @@
+package astilibav
+
+//#cgo pkg-config: libavcodec libavfilter libavformat libavutil
+//#include "compat.h"
+import "C"
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+)
+
+var countVolume uint64
+
+// Volume represents an object capable of applying a gain to audio frames
+// The gain can be updated at runtime, either by calling SetGain or by emitting an EventNameVolumeSetGain event whose
+// target is the volume and whose payload is the gain in dB as a float64. When the gain changes, it ramps linearly
+// over the next frame to prevent clicks
+// u8, s16, s32, s64, flt and dbl sample formats are supported, whether packed or planar
+type Volume struct {
+	*astiencoder.BaseNode
+	applied          float64
+	c                *astikit.Chan
+	d                *frameDispatcher
+	eh               *astiencoder.EventHandler
+	gain             float64
+	m                *sync.Mutex // Locks gain
+	p                *framePool
+	statIncomingRate *astikit.CounterAvgStat
+	statWorkRatio    *astikit.DurationPercentageStat
+}
+
+// VolumeOptions represents volume options
+type VolumeOptions struct {
+	// Initial gain in dB. 0 means the volume is unchanged and -Inf means it's muted
+	Gain float64
+	Node astiencoder.NodeOptions
+}
+
+// NewVolume creates a new volume
+func NewVolume(o VolumeOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (v *Volume) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countVolume, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("volume_%d", count), fmt.Sprintf("Volume #%d", count), "Changes volume")
+
+	// Create volume
+	v = &Volume{
+		applied: o.Gain,
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh:               eh,
+		gain:             o.Gain,
+		m:                &sync.Mutex{},
+		p:                newFramePool(c),
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statWorkRatio:    astikit.NewDurationPercentageStat(),
+	}
+	v.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(v), eh)
+	v.d = newFrameDispatcher(v, eh, c)
+	v.addStats()
+
+	// Handle gain updates
+	eh.Add(v, EventNameVolumeSetGain, func(e astiencoder.Event) bool {
+		g, ok := e.Payload.(float64)
+		if !ok {
+			eh.Emit(astiencoder.EventError(v, fmt.Errorf("astilibav: payload %+v is not a gain", e.Payload)))
+			return false
+		}
+		v.SetGain(g)
+		return false
+	})
+	return
+}
+
+func (v *Volume) addStats() {
+	// Add incoming rate
+	v.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of frames coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "fps",
+	}, v.statIncomingRate)
+
+	// Add work ratio
+	v.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, v.statWorkRatio)
+
+	// Add dispatcher stats
+	v.d.addStats(v.Stater())
+
+	// Add chan stats
+	v.c.AddStats(v.Stater())
+}
+
+// Gain returns the gain in dB
+func (v *Volume) Gain() float64 {
+	v.m.Lock()
+	defer v.m.Unlock()
+	return v.gain
+}
+
+// SetGain updates the gain in dB, starting with the next incoming frame
+func (v *Volume) SetGain(g float64) {
+	v.m.Lock()
+	defer v.m.Unlock()
+	v.gain = g
+}
+
+// Connect implements the FrameHandlerConnector interface
+func (v *Volume) Connect(h FrameHandler) {
+	// Add handler
+	v.d.addHandler(h)
+
+	// Connect nodes
+	astiencoder.ConnectNodes(v, h)
+}
+
+// Disconnect implements the FrameHandlerConnector interface
+func (v *Volume) Disconnect(h FrameHandler) {
+	// Delete handler
+	v.d.delHandler(h)
+
+	// Disconnect nodes
+	astiencoder.DisconnectNodes(v, h)
+}
+
+// Start starts the volume
+func (v *Volume) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	v.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to wait for all dispatcher subprocesses to be done so that they are properly closed
+		defer v.d.wait()
+
+		// Make sure to stop the chan properly
+		defer v.c.Stop()
+
+		// Start chan
+		v.c.Start(v.Context())
+	})
+}
+
+// HandleEOS implements the EOSHandler interface
+func (v *Volume) HandleEOS(p *EOSHandlerPayload) {
+	v.c.Add(func() {
+		// Forward end of stream
+		v.d.dispatchEOS()
+	})
+}
+
+// HandleFrame implements the FrameHandler interface
+func (v *Volume) HandleFrame(p *FrameHandlerPayload) {
+	v.c.Add(func() {
+		// Handle pause
+		defer v.HandlePause()
+
+		// Increment incoming rate
+		v.statIncomingRate.Add(1)
+
+		// Get gains
+		from, to := v.applied, v.Gain()
+		v.applied = to
+
+		// Nothing to change
+		if from == 0 && to == 0 {
+			v.d.dispatch(p.Frame, p.Descriptor, p.Metadata)
+			return
+		}
+
+		// Get samples
+		s, err := frameExporterSamples(p.Frame)
+		if err != nil {
+			v.eh.Emit(astiencoder.EventError(v, fmt.Errorf("astilibav: getting samples failed: %w", err)))
+			return
+		}
+
+		// Copy frame
+		f := v.p.get()
+		defer v.p.put(f)
+		if ret := defaultBindings.frameRef(f, p.Frame); ret < 0 {
+			emitAvError(v, v.eh, ret, "avutil.AvFrameRef failed")
+			return
+		}
+
+		// Since data is shared with the other handlers of the previous node, it must be copied before being updated
+		if ret := avutil.AvFrameMakeWritable(f); ret < 0 {
+			emitAvError(v, v.eh, ret, "avutil.AvFrameMakeWritable failed")
+			return
+		}
+
+		// Apply gain
+		v.statWorkRatio.Begin()
+		volumeApply(s, int(C.astilibav_frame_channels((*C.AVFrame)(unsafe.Pointer(f)))), volumeFactor(from), volumeFactor(to))
+		err = frameExporterSetSamples(f, s)
+		v.statWorkRatio.End()
+		if err != nil {
+			v.eh.Emit(astiencoder.EventError(v, fmt.Errorf("astilibav: setting samples failed: %w", err)))
+			return
+		}
+
+		// Dispatch frame
+		v.d.dispatch(f, p.Descriptor, p.Metadata)
+	})
+}
+
+// volumeFactor converts a gain in dB to a linear factor
+func volumeFactor(g float64) float64 {
+	return math.Pow(10, g/20)
+}
+
+// volumeApply multiplies interleaved normalized samples by a factor going linearly from one value to another, the last
+// sample being multiplied by the final value
+func volumeApply(s []float64, channels int, from, to float64) {
+	n := len(s) / channels
+	for idx := 0; idx < n*channels; idx++ {
+		// Get factor
+		l := to
+		if from != to {
+			l = from + (to-from)*float64(idx/channels+1)/float64(n)
+		}
+
+		// Apply factor
+		s[idx] *= l
+	}
+}
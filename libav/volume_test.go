@@ -0,0 +1,26 @@
+package astilibav
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVolumeFactor(t *testing.T) {
+	assert.Equal(t, 1.0, volumeFactor(0))
+	assert.InDelta(t, 2, volumeFactor(6.0206), 0.0001)
+	assert.Equal(t, 0.0, volumeFactor(math.Inf(-1)))
+}
+
+func TestVolumeApply(t *testing.T) {
+	// Constant factor
+	s := []float64{0.25, -0.25}
+	volumeApply(s, 1, 2, 2)
+	assert.Equal(t, []float64{0.5, -0.5}, s)
+
+	// Ramp is applied per sample, channels sharing the same factor
+	s = []float64{1, 1, 1, 1}
+	volumeApply(s, 2, 1, 0)
+	assert.Equal(t, []float64{0.5, 0.5, 0, 0}, s)
+}
@@ -0,0 +1,397 @@
+package astilibav
+
+//#cgo pkg-config: libavcodec libavfilter libavformat libavutil libswscale
+//#include <errno.h>
+//#include <stdlib.h>
+//#include <libavcodec/avcodec.h>
+//#include <libavformat/avformat.h>
+//#include <libavutil/frame.h>
+//#include <libswscale/swscale.h>
+//#include "compat.h"
+//typedef struct {
+//	AVCodecContext *codec;
+//	int eof;
+//	AVFormatContext *fmt;
+//	AVFrame *frame;
+//	AVPacket *pkt;
+//	int stream;
+//	struct SwsContext *sws;
+//} astilibav_watermark_reader;
+//static void astilibav_watermark_close(astilibav_watermark_reader **r) {
+//	if (!*r) return;
+//	avcodec_free_context(&(*r)->codec);
+//	avformat_close_input(&(*r)->fmt);
+//	av_frame_free(&(*r)->frame);
+//	av_packet_free(&(*r)->pkt);
+//	sws_freeContext((*r)->sws);
+//	av_freep(r);
+//}
+//static int astilibav_watermark_open(const char *path, astilibav_watermark_reader **r) {
+//	if (!(*r = av_mallocz(sizeof(astilibav_watermark_reader)))) return AVERROR(ENOMEM);
+//	int ret;
+//	if ((ret = avformat_open_input(&(*r)->fmt, path, NULL, NULL)) < 0) goto fail;
+//	if ((ret = avformat_find_stream_info((*r)->fmt, NULL)) < 0) goto fail;
+//	if ((ret = av_find_best_stream((*r)->fmt, AVMEDIA_TYPE_VIDEO, -1, -1, NULL, 0)) < 0) goto fail;
+//	(*r)->stream = ret;
+//	AVCodecParameters *p = (*r)->fmt->streams[ret]->codecpar;
+//	const AVCodec *c = avcodec_find_decoder(p->codec_id);
+//	if (!c) { ret = AVERROR_DECODER_NOT_FOUND; goto fail; }
+//	if (!((*r)->codec = avcodec_alloc_context3(c))) { ret = AVERROR(ENOMEM); goto fail; }
+//	if ((ret = avcodec_parameters_to_context((*r)->codec, p)) < 0) goto fail;
+//	if ((ret = avcodec_open2((*r)->codec, c, NULL)) < 0) goto fail;
+//	if (!((*r)->frame = av_frame_alloc()) || !((*r)->pkt = av_packet_alloc())) { ret = AVERROR(ENOMEM); goto fail; }
+//	return 0;
+//fail:
+//	astilibav_watermark_close(r);
+//	return ret;
+//}
+//static int astilibav_watermark_read(astilibav_watermark_reader *r, AVFrame *out, int64_t *pts, int64_t *duration) {
+//	int ret;
+//	for (;;) {
+//		if ((ret = avcodec_receive_frame(r->codec, r->frame)) == 0) {
+//			// Alpha is kept
+//			AVRational tb = r->fmt->streams[r->stream]->time_base;
+//			*pts = r->frame->best_effort_timestamp == AV_NOPTS_VALUE ? 0 : av_rescale_q(r->frame->best_effort_timestamp, tb, AV_TIME_BASE_Q);
+//			*duration = av_rescale_q(astilibav_frame_duration(r->frame), tb, AV_TIME_BASE_Q);
+//			out->format = AV_PIX_FMT_YUVA420P;
+//			out->height = r->frame->height;
+//			out->width = r->frame->width;
+//			if ((ret = av_frame_get_buffer(out, 0)) < 0) return ret;
+//			r->sws = sws_getCachedContext(r->sws, r->frame->width, r->frame->height, r->frame->format, out->width, out->height, out->format, SWS_BICUBIC, NULL, NULL, NULL);
+//			if (!r->sws) return AVERROR(EINVAL);
+//			ret = sws_scale(r->sws, (const uint8_t * const *)r->frame->data, r->frame->linesize, 0, r->frame->height, out->data, out->linesize);
+//			av_frame_unref(r->frame);
+//			return ret < 0 ? ret : 0;
+//		}
+//		if (ret != AVERROR(EAGAIN)) return ret;
+//		if ((ret = av_read_frame(r->fmt, r->pkt)) == AVERROR_EOF) {
+//			// Flush decoder
+//			if (r->eof) return AVERROR_EOF;
+//			r->eof = 1;
+//			if ((ret = avcodec_send_packet(r->codec, NULL)) < 0) return ret;
+//			continue;
+//		}
+//		if (ret < 0) return ret;
+//		if (r->pkt->stream_index == r->stream) ret = avcodec_send_packet(r->codec, r->pkt);
+//		av_packet_unref(r->pkt);
+//		if (ret < 0) return ret;
+//	}
+//}
+//static int astilibav_watermark_blend(AVFrame *dst, const AVFrame *wm, int x, int y, int opacity) {
+//	if (dst->format != AV_PIX_FMT_YUV420P && dst->format != AV_PIX_FMT_YUVJ420P) return AVERROR(ENOSYS);
+//	for (int p = 0; p < 3; p++) {
+//		int s = p == 0 ? 0 : 1;
+//		int px = x >> s, py = y >> s, w = (wm->width + s) >> s, h = (wm->height + s) >> s;
+//		int dw = (dst->width + s) >> s, dh = (dst->height + s) >> s;
+//		for (int j = py < 0 ? -py : 0; j < h && py + j < dh; j++) {
+//			uint8_t *d = dst->data[p] + (py + j) * dst->linesize[p];
+//			const uint8_t *v = wm->data[p] + j * wm->linesize[p];
+//			const uint8_t *a = wm->data[3] + (j << s) * wm->linesize[3];
+//			for (int i = px < 0 ? -px : 0; i < w && px + i < dw; i++) {
+//				int al = a[i << s] * opacity / 255;
+//				d[px + i] = (d[px + i] * (255 - al) + v[i] * al) / 255;
+//			}
+//		}
+//	}
+//	return 0;
+//}
+import "C"
+import (
+	"context"
+	"fmt"
+	"image"
+	"math"
+	"sort"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/asticode/go-astiencoder"
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/goav/avutil"
+)
+
+var countWatermark uint64
+
+// Duration of the last frame of animated images when it's unknown
+const defaultWatermarkFrameDuration = 100 * time.Millisecond
+
+// Watermark represents an object capable of overlaying an image with alpha, such as a PNG, onto video frames
+// Animated images, such as APNGs, are looped based on the timestamps of video frames. The image can be swapped at
+// runtime, in which case its animation restarts
+// Only yuv420p and yuvj420p video frames are supported
+type Watermark struct {
+	*astiencoder.BaseNode
+	c                *astikit.Chan
+	d                *frameDispatcher
+	eh               *astiencoder.EventHandler
+	i                *watermarkImage
+	o                WatermarkOptions
+	p                *framePool
+	start            *time.Duration
+	statIncomingRate *astikit.CounterAvgStat
+	statWorkRatio    *astikit.DurationPercentageStat
+}
+
+// WatermarkOptions represents watermark options
+type WatermarkOptions struct {
+	Node astiencoder.NodeOptions
+	// Between 0 and 1. Defaults to 1
+	Opacity float64
+	// Path to the image, which can be anything libavformat can demux and libavcodec can decode
+	Path string
+	// Position of the top left corner of the image, in pixels. Even values are used since chroma is subsampled
+	X int
+	Y int
+}
+
+type watermarkImage struct {
+	// Duration of the whole animation
+	duration time.Duration
+	fs       []*avutil.Frame
+	// Position of each frame in the animation
+	ptss []time.Duration
+}
+
+// NewWatermark creates a new watermark
+func NewWatermark(o WatermarkOptions, eh *astiencoder.EventHandler, c *astikit.Closer) (w *Watermark, err error) {
+	// Extend node metadata
+	count := atomic.AddUint64(&countWatermark, uint64(1))
+	o.Node.Metadata = o.Node.Metadata.Extend(fmt.Sprintf("watermark_%d", count), fmt.Sprintf("Watermark #%d", count), "Watermarks")
+
+	// Check opacity
+	if o.Opacity == 0 {
+		o.Opacity = 1
+	} else if o.Opacity < 0 || o.Opacity > 1 {
+		err = fmt.Errorf("astilibav: invalid opacity %f", o.Opacity)
+		return
+	}
+
+	// Create watermark
+	w = &Watermark{
+		c: astikit.NewChan(astikit.ChanOptions{
+			AddStrategy: astikit.ChanAddStrategyBlockWhenStarted,
+			ProcessAll:  true,
+		}),
+		eh:               eh,
+		o:                o,
+		p:                newFramePool(c),
+		statIncomingRate: astikit.NewCounterAvgStat(),
+		statWorkRatio:    astikit.NewDurationPercentageStat(),
+	}
+	w.BaseNode = astiencoder.NewBaseNode(o.Node, astiencoder.NewEventGeneratorNode(w), eh)
+	w.d = newFrameDispatcher(w, eh, c)
+	w.addStats()
+
+	// Load image
+	if w.i, err = w.load(o.Path); err != nil {
+		err = fmt.Errorf("astilibav: loading image failed: %w", err)
+		return
+	}
+	return
+}
+
+func (w *Watermark) addStats() {
+	// Add incoming rate
+	w.Stater().AddStat(astikit.StatMetadata{
+		Description: "Number of frames coming in per second",
+		Label:       "Incoming rate",
+		Unit:        "fps",
+	}, w.statIncomingRate)
+
+	// Add work ratio
+	w.Stater().AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent doing some actual work",
+		Label:       "Work ratio",
+		Unit:        "%",
+	}, w.statWorkRatio)
+
+	// Add dispatcher stats
+	w.d.addStats(w.Stater())
+
+	// Add chan stats
+	w.c.AddStats(w.Stater())
+}
+
+func (w *Watermark) load(path string) (i *watermarkImage, err error) {
+	// Open image
+	cp := C.CString(path)
+	defer C.free(unsafe.Pointer(cp))
+	var r *C.astilibav_watermark_reader
+	if ret := C.astilibav_watermark_open(cp, &r); ret < 0 {
+		err = fmt.Errorf("astilibav: astilibav_watermark_open on %s failed: %w", path, NewAvError(int(ret)))
+		return
+	}
+	defer C.astilibav_watermark_close(&r)
+
+	// Loop through frames
+	i = &watermarkImage{}
+	var last time.Duration
+	for {
+		// Read frame
+		f := w.p.get()
+		var pts, duration C.int64_t
+		if ret := int(C.astilibav_watermark_read(r, (*C.AVFrame)(unsafe.Pointer(f)), &pts, &duration)); ret < 0 {
+			w.p.put(f)
+			if ret != avutil.AVERROR_EOF {
+				w.put(i)
+				err = fmt.Errorf("astilibav: astilibav_watermark_read on %s failed: %w", path, NewAvError(ret))
+				return
+			}
+			break
+		}
+
+		// Append frame
+		i.fs = append(i.fs, f)
+		i.ptss = append(i.ptss, time.Duration(pts)*time.Microsecond)
+		last = time.Duration(duration) * time.Microsecond
+	}
+
+	// No frames
+	if len(i.fs) == 0 {
+		err = fmt.Errorf("astilibav: no frames in %s", path)
+		return
+	}
+
+	// Get animation duration
+	if len(i.fs) > 1 {
+		if last <= 0 {
+			last = defaultWatermarkFrameDuration
+		}
+		i.duration = i.ptss[len(i.ptss)-1] - i.ptss[0] + last
+	}
+	return
+}
+
+func (w *Watermark) put(i *watermarkImage) {
+	for _, f := range i.fs {
+		w.p.put(f)
+	}
+}
+
+// SetImage loads the image located at the provided path and swaps it with the current one before the next incoming
+// frame is handled
+func (w *Watermark) SetImage(path string) error {
+	// Load image outside of the chan so that frames are not delayed
+	i, err := w.load(path)
+	if err != nil {
+		return fmt.Errorf("astilibav: loading image failed: %w", err)
+	}
+
+	// Swap image
+	w.c.Add(func() {
+		w.put(w.i)
+		w.i = i
+		w.start = nil
+	})
+	return nil
+}
+
+// Connect implements the FrameHandlerConnector interface
+func (w *Watermark) Connect(h FrameHandler) {
+	// Add handler
+	w.d.addHandler(h)
+
+	// Connect nodes
+	astiencoder.ConnectNodes(w, h)
+}
+
+// Disconnect implements the FrameHandlerConnector interface
+func (w *Watermark) Disconnect(h FrameHandler) {
+	// Delete handler
+	w.d.delHandler(h)
+
+	// Disconnect nodes
+	astiencoder.DisconnectNodes(w, h)
+}
+
+// Snapshot implements the astiencoder.Snapshotter interface
+func (w *Watermark) Snapshot(ctx context.Context) (image.Image, error) {
+	return w.d.snapshot(ctx)
+}
+
+// Start starts the watermark
+func (w *Watermark) Start(ctx context.Context, t astiencoder.CreateTaskFunc) {
+	w.BaseNode.Start(ctx, t, func(t *astikit.Task) {
+		// Make sure to wait for all dispatcher subprocesses to be done so that they are properly closed
+		defer w.d.wait()
+
+		// Make sure to stop the chan properly
+		defer w.c.Stop()
+
+		// Start chan
+		w.c.Start(w.Context())
+	})
+}
+
+// HandleEOS implements the EOSHandler interface
+func (w *Watermark) HandleEOS(p *EOSHandlerPayload) {
+	w.c.Add(func() {
+		// Forward end of stream
+		w.d.dispatchEOS()
+	})
+}
+
+// HandleFrame implements the FrameHandler interface
+func (w *Watermark) HandleFrame(p *FrameHandlerPayload) {
+	w.c.Add(func() {
+		// Handle pause
+		defer w.HandlePause()
+
+		// Increment incoming rate
+		w.statIncomingRate.Add(1)
+
+		// Get image frame
+		var elapsed time.Duration
+		if pts := p.Frame.Pts(); pts != avutil.AV_NOPTS_VALUE && p.Descriptor != nil {
+			t := time.Duration(avutil.AvRescaleQ(pts, p.Descriptor.TimeBase(), nanosecondRational))
+			if w.start == nil {
+				w.start = &t
+			}
+			elapsed = t - *w.start
+		}
+		wf := w.i.fs[watermarkFrameIndex(w.i.ptss, w.i.duration, elapsed)]
+
+		// Copy frame
+		f := w.p.get()
+		defer w.p.put(f)
+		if ret := defaultBindings.frameRef(f, p.Frame); ret < 0 {
+			emitAvError(w, w.eh, ret, "avutil.AvFrameRef failed")
+			return
+		}
+
+		// Since data is shared with the other handlers of the previous node, it must be copied before being updated
+		if ret := avutil.AvFrameMakeWritable(f); ret < 0 {
+			emitAvError(w, w.eh, ret, "avutil.AvFrameMakeWritable failed")
+			return
+		}
+
+		// Blend
+		w.statWorkRatio.Begin()
+		if ret := C.astilibav_watermark_blend((*C.AVFrame)(unsafe.Pointer(f)), (*C.AVFrame)(unsafe.Pointer(wf)), C.int(w.o.X&^1), C.int(w.o.Y&^1), C.int(math.Round(w.o.Opacity*255))); ret < 0 {
+			w.statWorkRatio.End()
+			emitAvError(w, w.eh, int(ret), "astilibav_watermark_blend failed")
+			return
+		}
+		w.statWorkRatio.End()
+
+		// Dispatch frame
+		w.d.dispatch(f, p.Descriptor, p.Metadata)
+	})
+}
+
+// watermarkFrameIndex returns the index of the frame of a looped animation that should be displayed after the
+// provided elapsed time
+func watermarkFrameIndex(ptss []time.Duration, duration, elapsed time.Duration) int {
+	// Not animated
+	if len(ptss) <= 1 || duration <= 0 {
+		return 0
+	}
+
+	// Loop
+	e := ptss[0] + elapsed%duration
+	if e < ptss[0] {
+		e += duration
+	}
+	return sort.Search(len(ptss), func(idx int) bool { return ptss[idx] > e }) - 1
+}
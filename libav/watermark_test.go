@@ -0,0 +1,29 @@
+package astilibav
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatermarkFrameIndex(t *testing.T) {
+	// Not animated
+	assert.Equal(t, 0, watermarkFrameIndex([]time.Duration{0}, 0, time.Second))
+
+	// Animated
+	ptss := []time.Duration{0, 100 * time.Millisecond, 300 * time.Millisecond}
+	assert.Equal(t, 0, watermarkFrameIndex(ptss, 400*time.Millisecond, 0))
+	assert.Equal(t, 0, watermarkFrameIndex(ptss, 400*time.Millisecond, 99*time.Millisecond))
+	assert.Equal(t, 1, watermarkFrameIndex(ptss, 400*time.Millisecond, 100*time.Millisecond))
+	assert.Equal(t, 2, watermarkFrameIndex(ptss, 400*time.Millisecond, 399*time.Millisecond))
+
+	// Looped
+	assert.Equal(t, 0, watermarkFrameIndex(ptss, 400*time.Millisecond, 400*time.Millisecond))
+	assert.Equal(t, 1, watermarkFrameIndex(ptss, 400*time.Millisecond, 950*time.Millisecond))
+
+	// First frame doesn't start at 0 and elapsed time is negative
+	ptss = []time.Duration{time.Second, 1100 * time.Millisecond}
+	assert.Equal(t, 1, watermarkFrameIndex(ptss, 200*time.Millisecond, 150*time.Millisecond))
+	assert.Equal(t, 1, watermarkFrameIndex(ptss, 200*time.Millisecond, -50*time.Millisecond))
+}
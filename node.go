@@ -109,6 +109,7 @@ func DisconnectNodes(parent, child Node) {
 type NodeOptions struct {
 	Metadata       NodeMetadata
 	NoIndirectStop bool
+	RateLimit      NodeRateLimitOptions
 }
 
 // BaseNode represents a base node
@@ -127,6 +128,7 @@ type BaseNode struct {
 	oStop           *sync.Once
 	parents         map[string]Node
 	parentsStarted  map[string]bool
+	rl              *nodeRateLimiter
 	s               *astikit.Stater
 	status          string
 }
@@ -150,6 +152,12 @@ func NewBaseNode(o NodeOptions, eg EventGenerator, eh *EventHandler) (n *BaseNod
 		HandleFunc: n.statsHandleFunc,
 		Period:     2 * time.Second,
 	})
+
+	// Limit ingest rate
+	if o.RateLimit.Rate > 0 {
+		n.rl = newNodeRateLimiter(o.RateLimit)
+		n.addRateLimitStats()
+	}
 	return
 }
 
@@ -0,0 +1,126 @@
+package astiencoder
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/asticode/go-astikit"
+)
+
+// NodeRateLimitOptions represents node ingest rate limit options
+type NodeRateLimitOptions struct {
+	// Number of items that can be ingested at once above the rate. Defaults to 1
+	Burst int
+	// Maximum number of packets or frames ingested per second. If <= 0, ingest is not limited
+	Rate float64
+}
+
+// RateLimitHandler represents an object that can limit the rate at which it ingests packets or frames
+type RateLimitHandler interface {
+	HandleRateLimit()
+}
+
+type nodeRateLimiter struct {
+	m          *sync.Mutex
+	next       time.Time
+	o          NodeRateLimitOptions
+	statCount  *nodeRateLimiterStat
+	statWaited *astikit.DurationPercentageStat
+}
+
+func newNodeRateLimiter(o NodeRateLimitOptions) *nodeRateLimiter {
+	// Default values
+	if o.Burst <= 0 {
+		o.Burst = 1
+	}
+	return &nodeRateLimiter{
+		m:          &sync.Mutex{},
+		o:          o,
+		statCount:  &nodeRateLimiterStat{},
+		statWaited: astikit.NewDurationPercentageStat(),
+	}
+}
+
+// delay returns the duration the caller must wait before ingesting a new item
+func (l *nodeRateLimiter) delay(now time.Time) (d time.Duration) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	// Items are spaced by an interval and up to burst items can be ingested ahead of time
+	interval := time.Duration(float64(time.Second) / l.o.Rate)
+	if min := now.Add(-time.Duration(l.o.Burst-1) * interval); l.next.Before(min) {
+		l.next = min
+	}
+	if l.next.After(now) {
+		d = l.next.Sub(now)
+	}
+	l.next = l.next.Add(interval)
+	return
+}
+
+type nodeRateLimiterStat struct {
+	v uint64
+}
+
+func (s *nodeRateLimiterStat) add() {
+	atomic.AddUint64(&s.v, 1)
+}
+
+// Start implements the astikit.StatHandler interface
+func (s *nodeRateLimiterStat) Start() {}
+
+// Stop implements the astikit.StatHandler interface
+func (s *nodeRateLimiterStat) Stop() {}
+
+// Value implements the astikit.StatHandler interface
+func (s *nodeRateLimiterStat) Value(delta time.Duration) interface{} {
+	return atomic.LoadUint64(&s.v)
+}
+
+func (n *BaseNode) addRateLimitStats() {
+	// Add throttled count
+	n.s.AddStat(astikit.StatMetadata{
+		Description: "Number of packets or frames whose ingest has been delayed by the rate limit",
+		Label:       "Throttled count",
+	}, n.rl.statCount)
+
+	// Add throttled ratio
+	n.s.AddStat(astikit.StatMetadata{
+		Description: "Percentage of time spent waiting for the rate limit",
+		Label:       "Throttled ratio",
+		Unit:        "%",
+	}, n.rl.statWaited)
+}
+
+// HandleRateLimit implements the RateLimitHandler interface
+// It blocks until the node is allowed to ingest a new packet or frame
+func (n *BaseNode) HandleRateLimit() {
+	// Rate is not limited
+	if n.rl == nil {
+		return
+	}
+
+	// No need to wait
+	d := n.rl.delay(time.Now())
+	if d <= 0 {
+		return
+	}
+
+	// Update stats
+	n.rl.statCount.add()
+	n.rl.statWaited.Begin()
+	defer n.rl.statWaited.End()
+
+	// Wait
+	t := time.NewTimer(d)
+	defer t.Stop()
+	var done <-chan struct{}
+	if ctx := n.Context(); ctx != nil {
+		done = ctx.Done()
+	}
+	select {
+	case <-t.C:
+	case <-done:
+	}
+}
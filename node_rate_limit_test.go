@@ -0,0 +1,20 @@
+package astiencoder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodeRateLimiter(t *testing.T) {
+	n := time.Unix(0, 0)
+	l := newNodeRateLimiter(NodeRateLimitOptions{Burst: 2, Rate: 10})
+	assert.Equal(t, time.Duration(0), l.delay(n))
+	assert.Equal(t, time.Duration(0), l.delay(n))
+	assert.Equal(t, 100*time.Millisecond, l.delay(n))
+	assert.Equal(t, 200*time.Millisecond, l.delay(n))
+	assert.Equal(t, time.Duration(0), l.delay(n.Add(time.Second)))
+	assert.Equal(t, time.Duration(0), l.delay(n.Add(time.Second)))
+	assert.Equal(t, 100*time.Millisecond, l.delay(n.Add(time.Second)))
+}
@@ -0,0 +1,119 @@
+package astiencoder
+
+import "fmt"
+
+// Log severities
+const (
+	LogSeverityDebug = "debug"
+	LogSeverityError = "error"
+	LogSeverityInfo  = "info"
+	LogSeverityWarn  = "warn"
+)
+
+// LogRecord represents a structured log record built out of an event
+// Fields have the same meaning whatever the event, so that they can be mapped as is on slog attributes, zap fields
+// or zerolog fields
+type LogRecord struct {
+	// Name of the event
+	Event   string
+	Message string
+	// Name of the node targeted by the event, if any
+	Node string
+	// Payload of the event when it's not an error
+	Payload  interface{}
+	Severity string
+	Workflow string
+}
+
+// StructuredLogger represents an object capable of writing structured log records
+// Adapting slog, zap or zerolog only requires mapping the severity on a level and the other fields on attributes
+type StructuredLogger interface {
+	Log(r LogRecord)
+}
+
+// StructuredLoggerFunc allows using a func as a structured logger
+type StructuredLoggerFunc func(r LogRecord)
+
+// Log implements the StructuredLogger interface
+func (f StructuredLoggerFunc) Log(r LogRecord) {
+	f(r)
+}
+
+// StructuredLoggerOptions represents structured logger options
+type StructuredLoggerOptions struct {
+	// Events whose names are not in this map and that are not default events are logged as info
+	Severities map[string]string
+	// If true, node and workflow stats events are logged as well
+	Stats bool
+	// Used when the event target is not a workflow
+	Workflow string
+}
+
+// StructuredLoggerEventHandlerAdapter adapts the event handler so that events are logged as structured records
+func StructuredLoggerEventHandlerAdapter(l StructuredLogger, h *EventHandler, o StructuredLoggerOptions) {
+	h.AddForAll(func(e Event) bool {
+		if r, ok := newLogRecord(e, o); ok {
+			l.Log(r)
+		}
+		return false
+	})
+}
+
+var logRecordDefaultSeverities = map[string]string{
+	EventNameError:             LogSeverityError,
+	EventNameNodeContinued:     LogSeverityDebug,
+	EventNameNodePaused:        LogSeverityDebug,
+	EventNameNodeStarted:       LogSeverityDebug,
+	EventNameNodeStats:         LogSeverityDebug,
+	EventNameNodeStopped:       LogSeverityDebug,
+	EventNameWorkflowContinued: LogSeverityInfo,
+	EventNameWorkflowPaused:    LogSeverityInfo,
+	EventNameWorkflowReport:    LogSeverityInfo,
+	EventNameWorkflowStarted:   LogSeverityInfo,
+	EventNameWorkflowStats:     LogSeverityDebug,
+	EventNameWorkflowStopped:   LogSeverityInfo,
+}
+
+func newLogRecord(e Event, o StructuredLoggerOptions) (r LogRecord, ok bool) {
+	// Stats are not logged
+	if !o.Stats && (e.Name == EventNameNodeStats || e.Name == EventNameWorkflowStats) {
+		return
+	}
+
+	// Create record
+	r = LogRecord{
+		Event:    e.Name,
+		Workflow: o.Workflow,
+	}
+
+	// Get severity
+	var found bool
+	if r.Severity, found = o.Severities[e.Name]; !found {
+		if r.Severity, found = logRecordDefaultSeverities[e.Name]; !found {
+			r.Severity = LogSeverityInfo
+		}
+	}
+
+	// Get target
+	var target string
+	if v, ok := e.Target.(Node); ok {
+		r.Node = v.Metadata().Name
+		target = fmt.Sprintf("node %s", r.Node)
+	} else if v, ok := e.Target.(*Workflow); ok {
+		r.Workflow = v.Name()
+		target = fmt.Sprintf("workflow %s", r.Workflow)
+	}
+
+	// Get message
+	if err, ok := e.Payload.(error); ok {
+		r.Message = err.Error()
+	} else {
+		r.Payload = e.Payload
+		r.Message = e.Name
+		if target != "" {
+			r.Message += " (" + target + ")"
+		}
+	}
+	ok = true
+	return
+}
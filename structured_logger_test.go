@@ -0,0 +1,37 @@
+package astiencoder
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/asticode/go-astikit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStructuredLogger(t *testing.T) {
+	// Setup
+	eh := NewEventHandler()
+	var rs []LogRecord
+	StructuredLoggerEventHandlerAdapter(StructuredLoggerFunc(func(r LogRecord) { rs = append(rs, r) }), eh, StructuredLoggerOptions{
+		Severities: map[string]string{"custom": LogSeverityWarn},
+		Workflow:   "default",
+	})
+	w := NewWorkflow(context.Background(), "test", eh, astikit.NewWorker(astikit.WorkerOptions{}).NewTask, astikit.NewCloser())
+	n := newMockedOutputNode("node", WorkflowReportOutput{}, eh)
+
+	// Emit
+	eh.Emit(Event{Name: EventNameWorkflowStarted, Target: w})
+	eh.Emit(Event{Name: EventNameNodeStats, Target: n})
+	eh.Emit(EventError(n, errors.New("error")))
+	eh.Emit(Event{Name: "custom", Payload: 1, Target: n})
+	eh.Emit(Event{Name: "other"})
+
+	// Assert
+	assert.Equal(t, []LogRecord{
+		{Event: EventNameWorkflowStarted, Message: EventNameWorkflowStarted + " (workflow test)", Severity: LogSeverityInfo, Workflow: "test"},
+		{Event: EventNameError, Message: "error", Node: "node", Severity: LogSeverityError, Workflow: "default"},
+		{Event: "custom", Message: "custom (node node)", Node: "node", Payload: 1, Severity: LogSeverityWarn, Workflow: "default"},
+		{Event: "other", Message: "other", Severity: LogSeverityInfo, Workflow: "default"},
+	}, rs)
+}
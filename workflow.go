@@ -3,29 +3,34 @@ package astiencoder
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"github.com/asticode/go-astikit"
 )
 
 // Workflow represents a workflow
 type Workflow struct {
-	bn   *BaseNode
-	c    *astikit.Closer
-	ctx  context.Context
-	e    *EventHandler
-	name string
-	t    *astikit.Task
-	tf   CreateTaskFunc
+	bn    *BaseNode
+	c     *astikit.Closer
+	clock Clock
+	ctx   context.Context
+	e     *EventHandler
+	m     *sync.Mutex // Locks clock
+	name  string
+	t     *astikit.Task
+	tf    CreateTaskFunc
 }
 
 // NewWorkflow creates a new workflow
 func NewWorkflow(ctx context.Context, name string, e *EventHandler, tf CreateTaskFunc, c *astikit.Closer) (w *Workflow) {
 	w = &Workflow{
-		c:    c,
-		ctx:  ctx,
-		e:    e,
-		name: name,
-		tf:   tf,
+		c:     c,
+		clock: NewWallClock(),
+		ctx:   ctx,
+		e:     e,
+		m:     &sync.Mutex{},
+		name:  name,
+		tf:    tf,
 	}
 	w.bn = NewBaseNode(NodeOptions{Metadata: NodeMetadata{
 		Description: "root",
@@ -40,6 +45,21 @@ func (w *Workflow) Name() string {
 	return w.name
 }
 
+// Clock returns the clock shared by the workflow nodes. Defaults to a wall clock
+func (w *Workflow) Clock() Clock {
+	w.m.Lock()
+	defer w.m.Unlock()
+	return w.clock
+}
+
+// SetClock sets the clock shared by the workflow nodes
+// It must be set before it's handed to the nodes
+func (w *Workflow) SetClock(c Clock) {
+	w.m.Lock()
+	defer w.m.Unlock()
+	w.clock = c
+}
+
 func (w *Workflow) nodes() (ns []Node) {
 	for _, n := range w.indexedNodes() {
 		ns = append(ns, n)
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"image/jpeg"
 	"net/http"
 	"net/url"
 	"path/filepath"
@@ -179,6 +180,7 @@ func (s *workflowPoolServer) handler() http.Handler {
 	r.GET("/api/workflows/:workflow", s.handleWorkflow())
 	r.GET("/api/workflows/:workflow/nodes/:node/continue", s.handleNodeContinue())
 	r.GET("/api/workflows/:workflow/nodes/:node/pause", s.handleNodePause())
+	r.GET("/api/workflows/:workflow/nodes/:node/snapshot", s.handleNodeSnapshot())
 	r.GET("/api/workflows/:workflow/nodes/:node/start", s.handleNodeStart())
 	r.GET("/api/workflows/:workflow/continue", s.handleWorkflowContinue())
 	r.GET("/api/workflows/:workflow/pause", s.handleWorkflowPause())
@@ -357,6 +359,32 @@ func (s *workflowPoolServer) handleNodePause() httprouter.Handle {
 	return s.handleNodeAction(func(w *Workflow, n Node) { n.Pause() })
 }
 
+func (s *workflowPoolServer) handleNodeSnapshot() httprouter.Handle {
+	return func(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.handleWorkflowAction(func(w *Workflow, rw http.ResponseWriter, p httprouter.Params) {
+			// Snapshot
+			i, err := w.SnapshotWithContext(r.Context(), p.ByName("node"))
+			if err != nil {
+				if errors.Is(err, ErrNodeNotFound) {
+					WriteJSONError(s.l, rw, http.StatusNotFound, fmt.Errorf("astiencoder: node %s doesn't exist", p.ByName("node")))
+				} else if errors.Is(err, ErrNodeNotSnapshotter) {
+					WriteJSONError(s.l, rw, http.StatusBadRequest, fmt.Errorf("astiencoder: node %s can't be snapshotted", p.ByName("node")))
+				} else {
+					WriteJSONError(s.l, rw, http.StatusInternalServerError, fmt.Errorf("astiencoder: snapshotting node %s failed: %w", p.ByName("node"), err))
+				}
+				return
+			}
+
+			// Write
+			rw.Header().Set("Content-Type", "image/jpeg")
+			if err = jpeg.Encode(rw, i, nil); err != nil {
+				s.l.Error(fmt.Errorf("astiencoder: writing failed: %w", err))
+				return
+			}
+		})(rw, r, p)
+	}
+}
+
 func (s *workflowPoolServer) handleNodeStart() httprouter.Handle {
 	return s.handleNodeAction(func(w *Workflow, n Node) {
 		if w.Status() == StatusRunning {
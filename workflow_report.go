@@ -0,0 +1,260 @@
+package astiencoder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// WorkflowReport represents a structured report of a workflow run
+type WorkflowReport struct {
+	Duration time.Duration          `json:"duration"`
+	Errors   []WorkflowReportError  `json:"errors,omitempty"`
+	Nodes    []WorkflowReportNode   `json:"nodes,omitempty"`
+	Outputs  []WorkflowReportOutput `json:"outputs,omitempty"`
+	// Ratio between the longest output duration and the run duration
+	Speed     float64   `json:"speed"`
+	StartedAt time.Time `json:"started_at"`
+	StoppedAt time.Time `json:"stopped_at"`
+	Workflow  string    `json:"workflow"`
+}
+
+// WorkflowReportError represents an error that occurred during a workflow run
+type WorkflowReportError struct {
+	At      time.Time `json:"at"`
+	Message string    `json:"message"`
+	Target  string    `json:"target,omitempty"`
+}
+
+// WorkflowReportNode represents a node of a workflow run
+type WorkflowReportNode struct {
+	Duration  time.Duration `json:"duration"`
+	Errors    int           `json:"errors"`
+	Label     string        `json:"label"`
+	Name      string        `json:"name"`
+	StartedAt time.Time     `json:"started_at"`
+	// Last stats received for the node
+	Stats     []EventStat `json:"stats,omitempty"`
+	StoppedAt time.Time   `json:"stopped_at"`
+}
+
+// WorkflowReportOutput represents an output written during a workflow run
+type WorkflowReportOutput struct {
+	Duration time.Duration `json:"duration"`
+	Node     string        `json:"node"`
+	// Only set when the output is a local file
+	Size int64  `json:"size,omitempty"`
+	URL  string `json:"url"`
+}
+
+// WorkflowReportOutputter represents a node that can describe the output it has written
+type WorkflowReportOutputter interface {
+	WorkflowReportOutput() WorkflowReportOutput
+}
+
+// WorkflowReporterOptions represents workflow reporter options
+type WorkflowReporterOptions struct {
+	// If set, the report is written as JSON to this path as well
+	Path string
+}
+
+// WorkflowReporter represents an object capable of producing a report once a workflow is stopped
+type WorkflowReporter struct {
+	e         *EventHandler
+	errors    []workflowReporterError
+	m         *sync.Mutex
+	nodes     map[string]*WorkflowReportNode
+	o         WorkflowReporterOptions
+	startedAt time.Time
+	w         *Workflow
+}
+
+type workflowReporterError struct {
+	e WorkflowReportError
+	// Only set when the target is a node
+	node string
+}
+
+// NewWorkflowReporter creates a new workflow reporter and starts listening to the event handler
+// It must be created before the workflow is started
+func NewWorkflowReporter(w *Workflow, e *EventHandler, o WorkflowReporterOptions) (r *WorkflowReporter) {
+	r = &WorkflowReporter{
+		e:     e,
+		m:     &sync.Mutex{},
+		nodes: make(map[string]*WorkflowReportNode),
+		o:     o,
+		w:     w,
+	}
+	e.AddForAll(r.handleEvent)
+	return
+}
+
+func (r *WorkflowReporter) handleEvent(e Event) bool {
+	// Get time
+	now := time.Now()
+
+	// Switch on event name
+	switch e.Name {
+	case EventNameError:
+		r.m.Lock()
+		var msg string
+		if err, ok := e.Payload.(error); ok {
+			msg = err.Error()
+		} else {
+			msg = fmt.Sprintf("%v", e.Payload)
+		}
+		re := workflowReporterError{e: WorkflowReportError{
+			At:      now,
+			Message: msg,
+			Target:  eventTargetName(e.Target),
+		}}
+		if n, ok := e.Target.(Node); ok {
+			re.node = n.Metadata().Name
+			r.node(n).Errors++
+		}
+		r.errors = append(r.errors, re)
+		r.m.Unlock()
+	case EventNameNodeStarted:
+		r.m.Lock()
+		r.node(e.Target.(Node)).StartedAt = now
+		r.m.Unlock()
+	case EventNameNodeStats:
+		r.m.Lock()
+		if ss, ok := e.Payload.([]EventStat); ok {
+			r.node(e.Target.(Node)).Stats = ss
+		}
+		r.m.Unlock()
+	case EventNameNodeStopped:
+		r.m.Lock()
+		n := r.node(e.Target.(Node))
+		n.StoppedAt = now
+		if !n.StartedAt.IsZero() {
+			n.Duration = now.Sub(n.StartedAt)
+		}
+		r.m.Unlock()
+	case EventNameWorkflowStarted:
+		if e.Target != r.w {
+			return false
+		}
+		r.m.Lock()
+		r.errors = []workflowReporterError{}
+		r.nodes = make(map[string]*WorkflowReportNode)
+		r.startedAt = now
+		r.m.Unlock()
+	case EventNameWorkflowStopped:
+		if e.Target != r.w {
+			return false
+		}
+		r.report(now)
+	}
+	return false
+}
+
+func (r *WorkflowReporter) node(n Node) *WorkflowReportNode {
+	m := n.Metadata()
+	if _, ok := r.nodes[m.Name]; !ok {
+		r.nodes[m.Name] = &WorkflowReportNode{
+			Label: m.Label,
+			Name:  m.Name,
+		}
+	}
+	return r.nodes[m.Name]
+}
+
+func (r *WorkflowReporter) report(stoppedAt time.Time) {
+	// Create report
+	rp := r.newReport(stoppedAt)
+
+	// Send event
+	r.e.Emit(Event{
+		Name:    EventNameWorkflowReport,
+		Payload: rp,
+		Target:  r.w,
+	})
+
+	// Write file
+	if r.o.Path != "" {
+		if err := writeWorkflowReport(r.o.Path, rp); err != nil {
+			r.e.Emit(EventError(r.w, fmt.Errorf("astiencoder: writing workflow report failed: %w", err)))
+		}
+	}
+}
+
+func (r *WorkflowReporter) newReport(stoppedAt time.Time) (rp WorkflowReport) {
+	// Lock
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	// Create report
+	rp = WorkflowReport{
+		Duration:  stoppedAt.Sub(r.startedAt),
+		StartedAt: r.startedAt,
+		StoppedAt: stoppedAt,
+		Workflow:  r.w.Name(),
+	}
+
+	// Index workflow nodes
+	ns := r.w.indexedNodes()
+	var ks []string
+	for k := range ns {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+
+	// Loop through errors
+	for _, e := range r.errors {
+		// Error belongs to a node of another workflow
+		if _, ok := ns[e.node]; e.node != "" && !ok {
+			continue
+		}
+		rp.Errors = append(rp.Errors, e.e)
+	}
+
+	// Loop through nodes
+	for _, k := range ks {
+		// Add node
+		if n, ok := r.nodes[k]; ok {
+			rp.Nodes = append(rp.Nodes, *n)
+		}
+
+		// Add output
+		if v, ok := ns[k].(WorkflowReportOutputter); ok {
+			o := v.WorkflowReportOutput()
+			o.Node = k
+			if o.Size == 0 {
+				if fi, err := os.Stat(o.URL); err == nil && fi.Mode().IsRegular() {
+					o.Size = fi.Size()
+				}
+			}
+			rp.Outputs = append(rp.Outputs, o)
+
+			// Update speed
+			if rp.Duration > 0 {
+				if s := float64(o.Duration) / float64(rp.Duration); s > rp.Speed {
+					rp.Speed = s
+				}
+			}
+		}
+	}
+	return
+}
+
+func writeWorkflowReport(path string, rp WorkflowReport) (err error) {
+	// Marshal
+	var b []byte
+	if b, err = json.MarshalIndent(rp, "", "  "); err != nil {
+		err = fmt.Errorf("astiencoder: marshaling failed: %w", err)
+		return
+	}
+
+	// Write
+	if err = ioutil.WriteFile(path, b, 0644); err != nil {
+		err = fmt.Errorf("astiencoder: writing to %s failed: %w", path, err)
+		return
+	}
+	return
+}
@@ -0,0 +1,77 @@
+package astiencoder
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astikit"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockedOutputNode struct {
+	*BaseNode
+	o WorkflowReportOutput
+}
+
+func newMockedOutputNode(name string, o WorkflowReportOutput, eh *EventHandler) *mockedOutputNode {
+	n := &mockedOutputNode{o: o}
+	n.BaseNode = NewBaseNode(NodeOptions{Metadata: NodeMetadata{Name: name}}, NewEventGeneratorNode(n), eh)
+	return n
+}
+
+func (n *mockedOutputNode) Start(ctx context.Context, t CreateTaskFunc) {}
+
+func (n *mockedOutputNode) WorkflowReportOutput() WorkflowReportOutput { return n.o }
+
+func TestWorkflowReporter(t *testing.T) {
+	// Setup
+	dir, err := ioutil.TempDir("", "astiencoder")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "output.ts")
+	assert.NoError(t, ioutil.WriteFile(p, []byte("test"), 0644))
+	eh := NewEventHandler()
+	w := NewWorkflow(context.Background(), "test", eh, astikit.NewWorker(astikit.WorkerOptions{}).NewTask, astikit.NewCloser())
+	n := newMockedOutputNode("muxer", WorkflowReportOutput{Duration: 4 * time.Second, URL: p}, eh)
+	o := newMockedOutputNode("other", WorkflowReportOutput{}, eh)
+	w.AddChild(n)
+	r := NewWorkflowReporter(w, eh, WorkflowReporterOptions{Path: filepath.Join(dir, "report.json")})
+	var rp *WorkflowReport
+	eh.AddForEventName(EventNameWorkflowReport, func(e Event) bool {
+		v := e.Payload.(WorkflowReport)
+		rp = &v
+		return false
+	})
+
+	// Run
+	eh.Emit(Event{Name: EventNameWorkflowStarted, Target: w})
+	r.startedAt = time.Now().Add(-2 * time.Second)
+	eh.Emit(Event{Name: EventNameNodeStarted, Target: n})
+	eh.Emit(EventError(n, errors.New("error 1")))
+	eh.Emit(EventError(o, errors.New("error 2")))
+	eh.Emit(EventError(w, errors.New("error 3")))
+	eh.Emit(Event{Name: EventNameNodeStats, Payload: []EventStat{{Label: "label"}}, Target: n})
+	eh.Emit(Event{Name: EventNameNodeStopped, Target: n})
+	eh.Emit(Event{Name: EventNameWorkflowStopped, Target: w})
+
+	// Assert
+	if assert.NotNil(t, rp) {
+		assert.Equal(t, "test", rp.Workflow)
+		assert.Equal(t, 2, len(rp.Errors))
+		assert.Equal(t, "error 1", rp.Errors[0].Message)
+		assert.Equal(t, "muxer", rp.Errors[0].Target)
+		assert.Equal(t, "error 3", rp.Errors[1].Message)
+		assert.Equal(t, 1, len(rp.Nodes))
+		assert.Equal(t, 1, rp.Nodes[0].Errors)
+		assert.Equal(t, []EventStat{{Label: "label"}}, rp.Nodes[0].Stats)
+		assert.Equal(t, []WorkflowReportOutput{{Duration: 4 * time.Second, Node: "muxer", Size: 4, URL: p}}, rp.Outputs)
+		assert.InDelta(t, 2, rp.Speed, 0.1)
+	}
+	_, err = os.Stat(filepath.Join(dir, "report.json"))
+	assert.NoError(t, err)
+}
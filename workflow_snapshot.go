@@ -0,0 +1,66 @@
+package astiencoder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"time"
+)
+
+// Errors
+var (
+	ErrNodeNotFound       = errors.New("astiencoder: node.not.found")
+	ErrNodeNotSnapshotter = errors.New("astiencoder: node.not.snapshotter")
+)
+
+// DefaultSnapshotTimeout represents the default duration after which a snapshot is cancelled if no frame has flowed
+// through the node
+var DefaultSnapshotTimeout = 10 * time.Second
+
+// Snapshotter represents a node that can capture the next frame flowing through it as an image
+type Snapshotter interface {
+	Snapshot(ctx context.Context) (image.Image, error)
+}
+
+// Snapshot captures the next frame flowing through the node and returns it as an image
+// It blocks until a frame flows through the node, the workflow is stopped or DefaultSnapshotTimeout is reached
+func (w *Workflow) Snapshot(nodeName string) (image.Image, error) {
+	// Workflow has not been started yet
+	ctx := w.bn.Context()
+	if ctx == nil {
+		ctx = w.ctx
+	}
+	return w.SnapshotWithContext(ctx, nodeName)
+}
+
+// SnapshotWithContext is the same as Snapshot but the snapshot is cancelled when the ctx is done
+func (w *Workflow) SnapshotWithContext(ctx context.Context, nodeName string) (i image.Image, err error) {
+	// Get node
+	n, ok := w.indexedNodes()[nodeName]
+	if !ok {
+		err = fmt.Errorf("astiencoder: node %s: %w", nodeName, ErrNodeNotFound)
+		return
+	}
+
+	// Node is not a snapshotter
+	s, ok := n.(Snapshotter)
+	if !ok {
+		err = fmt.Errorf("astiencoder: node %s: %w", nodeName, ErrNodeNotSnapshotter)
+		return
+	}
+
+	// Add timeout
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultSnapshotTimeout)
+		defer cancel()
+	}
+
+	// Snapshot
+	if i, err = s.Snapshot(ctx); err != nil {
+		err = fmt.Errorf("astiencoder: snapshotting node %s failed: %w", nodeName, err)
+		return
+	}
+	return
+}